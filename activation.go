@@ -0,0 +1,83 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+)
+
+// activationFirstFD - the first file descriptor systemd passes, after stdin, stdout and stderr.
+const activationFirstFD = 3
+
+/*
+activatedSockets - the listening sockets systemd passed in, if the service was socket activated: LISTEN_PID is this
+process, and LISTEN_FDS says how many sockets there are, from fd 3 on. The variables are cleared, so processes this
+one starts (such as upgrades) don't take the sockets for their own.
+*/
+func activatedSockets() ([]net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("Invalid LISTEN_FDS %q from systemd", os.Getenv("LISTEN_FDS"))
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(name)
+	}
+
+	sockets := make([]net.Listener, 0, n)
+	for fd := activationFirstFD; fd < activationFirstFD+n; fd++ {
+		f := os.NewFile(uintptr(fd), "systemd socket "+strconv.Itoa(fd))
+		// FileListener works on a duplicate, which (unlike the original) isn't inherited by child processes.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Socket %v from systemd can't be listened on (it must be a ListenStream socket): %v", fd, err)
+		}
+		sockets = append(sockets, ln)
+	}
+	return sockets, nil
+}
+
+/*
+activatedListeners - listeners that hand out the sockets systemd passed in, in the order the socket unit lists them,
+before opening any of their own. The API's listener is always asked for first, then the HTTPS redirect's, then the Unix
+socket's, so the unit's first socket serves the API, whatever address the config gives it.
+*/
+type activatedListeners struct {
+	listeners
+	sockets []net.Listener
+}
+
+func (a *activatedListeners) Listen(network, addr string) (net.Listener, error) {
+	next := func(network, addr string) (net.Listener, error) {
+		if len(a.sockets) == 0 {
+			return openListener(network, addr)
+		}
+		ln := a.sockets[0]
+		a.sockets = a.sockets[1:]
+		fmt.Printf("Using the socket systemd passed in instead of %v\n", addr)
+		return ln, nil
+	}
+	// tableflip must know about the socket to pass it on to an upgrade, and prefers one its parent passed on.
+	if upg, ok := a.listeners.(upgradeListeners); ok {
+		return upg.ListenWithCallback(network, addr, next)
+	}
+	return next(network, addr)
+}
+
+// Ready - closes any sockets that weren't used, since nothing will accept their connections.
+func (a *activatedListeners) Ready() error {
+	for _, ln := range a.sockets {
+		log.Printf("Closing the unused socket systemd passed in, %v", ln.Addr())
+		ln.Close()
+	}
+	a.sockets = nil
+	return a.listeners.Ready()
+}
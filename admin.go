@@ -0,0 +1,139 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// maxSnapshotBytes - the largest snapshot the restore endpoint accepts.
+const maxSnapshotBytes = 64 << 20
+
+// listParams - the listing parameters that decide how Products are read, rather than what's done with them after.
+var listParams = []string{"q", "name", "name_prefix", "filter", "sort", "consistent"}
+
+/*
+ExplainQuery - reports how a listing query would be executed: the index used, whether the whole table is
+scanned, and the estimated capacity cost. The listing parameters are passed URL-encoded in ?query=,
+e.g. /admin/explain?query=name%3DApple or /admin/explain?query=name_prefix%3DA%26sort%3Dprice. They're parsed
+just as a listing parses them, so a query a listing would refuse responds 400 here too.
+*/
+func (a *API) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Query().Get("query"), "?")
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	consistent, err := consistentRead(query.Get("consistent"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	listing := r.WithContext(r.Context())
+	listing.URL = &url.URL{Path: currentVersion + "/products", RawQuery: raw}
+	var list datastore.ListQuery
+	if list.Sort, err = listSort(listing); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if list.Filter, err = listFilter(listing); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	for param := range query {
+		if !slices.Contains(listParams, param) {
+			list.Params = append(list.Params, param)
+		}
+	}
+	sort.Strings(list.Params)
+
+	plan, err := a.Store.Explain(datastore.WithConsistentRead(r.Context(), consistent), list)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	respond(w, r, http.StatusOK, plan)
+}
+
+/*
+BackupProducts - download the whole catalog as a JSON snapshot, which RestoreProducts (on either backend) can
+load again.
+*/
+func (a *API) BackupProducts(w http.ResponseWriter, r *http.Request) {
+	snap, err := datastore.TakeSnapshot(r.Context(), a.Store)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaJSON)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products-%v.json"`, snap.CreatedAt.Format("20060102T150405Z")))
+	json.NewEncoder(w).Encode(snap)
+}
+
+/*
+TruncateProducts - deletes every Product in the catalog, along with everything kept alongside them (see
+datastore.Datastore.Truncate), to reset a demo or test environment. It must be confirmed with ?confirm=true.
+*/
+func (a *API) TruncateProducts(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("confirmation_required", "Truncating the catalog deletes every product; add ?confirm=true to go ahead"))
+		return
+	}
+	if err := a.Store.Truncate(r.Context()); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	log.Printf("request_id=%v truncated the catalog", requestID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+RestoreProducts - load a JSON snapshot from the request body, keeping its Product IDs. With ?replace=true,
+Products that aren't in the snapshot are deleted.
+*/
+func (a *API) RestoreProducts(w http.ResponseWriter, r *http.Request) {
+	replace := false
+	if v := r.URL.Query().Get("replace"); v != "" {
+		var err error
+		if replace, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_replace", "Invalid replace value %q", v))
+			return
+		}
+	}
+
+	var snap datastore.Snapshot
+	if err := decodeJSON(http.MaxBytesReader(w, r.Body, maxSnapshotBytes), &snap); err != nil {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_snapshot", "Error reading snapshot: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	if err := snap.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	restored, err := datastore.Restore(r.Context(), a.Store, snap, replace)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, restored)
+}
@@ -0,0 +1,185 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package alerts notifies subscribers when a Product's price drops below the threshold they chose.
+
+Subscriptions are kept as records of a hidden registry resource, so every backend stores them without changes of its
+own. Notifier wraps the Datastore: an update that lowers a Product's price is checked against the Product's
+subscriptions there and then, and each one whose threshold it crossed gets a notification job, delivered by email or
+webhook on the job queue so that a slow or failing receiver neither holds up the update nor misses the alert.
+*/
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+/*
+Resource - where subscriptions are stored. It's hidden: the API serves subscriptions under their Product, and checks
+more than the schema can.
+*/
+var Resource = datastore.Resource{
+	Name:   "price-alerts",
+	Table:  "PriceAlerts",
+	Hidden: true,
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["product_id", "threshold", "created_at"],
+		"properties": {
+			"product_id": {"type": "string"},
+			"threshold": {"type": "number", "minimum": 0},
+			"email": {"type": "string"},
+			"webhook_url": {"type": "string"},
+			"created_at": {"type": "string"}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	datastore.RegisterResource(Resource)
+}
+
+/*
+Subscription - a request to be told when a Product's price drops below Threshold, by email to Email or by a POST to
+WebhookURL; exactly one of them is set. Like reviews, subscriptions always have UUIDs.
+*/
+type Subscription struct {
+	XMLName    xml.Name        `json:"-" xml:"price_alert"`
+	Id         string          `json:"id" xml:"id"`
+	ProductId  string          `json:"product_id" xml:"product_id"`
+	Threshold  datastore.Money `json:"threshold" xml:"threshold"`
+	Email      string          `json:"email,omitempty" xml:"email,omitempty"`
+	WebhookURL string          `json:"webhook_url,omitempty" xml:"webhook_url,omitempty"`
+	CreatedAt  time.Time       `json:"created_at" xml:"created_at"`
+}
+
+/*
+Validate - checks the threshold and where the alert goes: an email address, which needs a mail server (canEmail), or
+an absolute http or https URL. Unless allowPrivate, the URL can't name localhost or a private address (see
+PrivateAddr); a name that resolves to one is refused when the webhook is called.
+*/
+func (s Subscription) Validate(canEmail, allowPrivate bool) error {
+	switch {
+	case s.Threshold <= 0:
+		return errors.New("Threshold must be a positive amount")
+	case (s.Email == "") == (s.WebhookURL == ""):
+		return errors.New("A price alert needs either an email or a webhook_url")
+	case s.Email != "" && !canEmail:
+		return errors.New("Email alerts aren't available; use a webhook_url")
+	}
+	if s.Email != "" {
+		if addr, err := mail.ParseAddress(s.Email); err != nil || addr.Address != s.Email {
+			return fmt.Errorf("Invalid email address %q", s.Email)
+		}
+		return nil
+	}
+	u, err := url.Parse(s.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid webhook_url %q; use an absolute http or https URL", s.WebhookURL)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip, err := netip.ParseAddr(host); !allowPrivate && (host == "localhost" || strings.HasSuffix(host, ".localhost") || (err == nil && PrivateAddr(ip))) {
+		return fmt.Errorf("Invalid webhook_url %q; it's on a private network, so use a public address", s.WebhookURL)
+	}
+	return nil
+}
+
+/*
+PrivateAddr - whether webhooks are kept from calling ip: a loopback, link-local (including the cloud metadata
+endpoint, 169.254.169.254), private (RFC 1918, or IPv6 unique local), multicast or unspecified address.
+*/
+func PrivateAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsMulticast() ||
+		ip.IsUnspecified()
+}
+
+// Triggered - whether a price change from old to new takes the price below the threshold. Staying below it doesn't.
+func (s Subscription) Triggered(old, new datastore.Money) bool {
+	return old >= s.Threshold && new < s.Threshold
+}
+
+// record - the subscription as a record of Resource.
+func (s Subscription) record() (datastore.Record, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var r datastore.Record
+	return r, json.Unmarshal(data, &r)
+}
+
+// fromRecord - the subscription a record of Resource holds.
+func fromRecord(r datastore.Record) (Subscription, error) {
+	var s Subscription
+	data, err := json.Marshal(r)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("Invalid price alert <%v>: %v", r.Id(), err)
+	}
+	return s, nil
+}
+
+// Subscribe - stores a new subscription.
+func Subscribe(ctx context.Context, store datastore.Datastore, s Subscription) error {
+	r, err := s.record()
+	if err != nil {
+		return err
+	}
+	return store.AddRecord(ctx, Resource.Name, r)
+}
+
+// Get - the subscription with the given ID, or an error wrapping datastore.ErrNotFound if it doesn't exist.
+func Get(ctx context.Context, store datastore.Datastore, id string) (Subscription, error) {
+	r, err := store.GetRecord(ctx, Resource.Name, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return fromRecord(r)
+}
+
+// Unsubscribe - deletes a subscription.
+func Unsubscribe(ctx context.Context, store datastore.Datastore, id string) error {
+	return store.DeleteRecord(ctx, Resource.Name, id)
+}
+
+/*
+Subscriptions - a Product's subscriptions, oldest first. Records can't be looked up by Product, so this reads every
+subscription in the catalog.
+*/
+func Subscriptions(ctx context.Context, store datastore.Datastore, productID string) ([]Subscription, error) {
+	records, err := store.GetRecords(ctx, Resource.Name)
+	if err != nil {
+		return nil, err
+	}
+	subs := []Subscription{}
+	for _, r := range records {
+		s, err := fromRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		if s.ProductId == productID {
+			subs = append(subs, s)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
@@ -0,0 +1,199 @@
+/*
+Author: Jason Payne
+*/
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/smtp"
+	"strings"
+	"syscall"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/jobs"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+// JobNotify - the job type that delivers one alert.
+const JobNotify = "alerts.notify"
+
+// EventPriceDrop - the event of every Notification so far.
+const EventPriceDrop = "price_drop"
+
+/*
+Notification - what a subscriber is told: the Product as updated, its price before, and the subscription it matched.
+It's the body POSTed to a webhook.
+*/
+type Notification struct {
+	Event        string            `json:"event"`
+	Subscription Subscription      `json:"subscription"`
+	Product      datastore.Product `json:"product"`
+	OldPrice     datastore.Money   `json:"old_price"`
+}
+
+/*
+Notifier - a Datastore that checks every Product update that lowers a price against the Product's subscriptions, and
+queues a notification for each one whose threshold the price fell below. Like search index updates, a notification
+that can't be queued is logged rather than failing the update, which has already been made.
+*/
+type Notifier struct {
+	datastore.Datastore
+	cfg    config.Alerts
+	jobs   *jobs.Queue
+	client *http.Client
+}
+
+// NewNotifier - wraps store so that price drops are checked against subscriptions, registering the job that
+// delivers them.
+func NewNotifier(store datastore.Datastore, cfg config.Alerts, queue *jobs.Queue) (*Notifier, error) {
+	if cfg.SMTP.Addr != "" && cfg.SMTP.From == "" {
+		return nil, errors.New("Email alerts need a from address (alerts.smtp.from)")
+	}
+	n := &Notifier{Datastore: store, cfg: cfg, jobs: queue, client: webhookClient(cfg)}
+	queue.Handle(JobNotify, n.notifyJob)
+	return n, nil
+}
+
+/*
+webhookClient - local helper function that returns the client webhooks are called with. Unless private webhooks are
+allowed, it connects directly (not through a proxy) and refuses to connect to a private address (see PrivateAddr),
+checking each address a webhook's name resolves to, and each redirect, as it connects.
+*/
+func webhookClient(cfg config.Alerts) *http.Client {
+	if cfg.AllowPrivateWebhooks {
+		return &http.Client{Timeout: cfg.WebhookTimeout.Duration}
+	}
+	dialer := &net.Dialer{Control: func(network, address string, _ syscall.RawConn) error {
+		addr, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if PrivateAddr(addr.Addr()) {
+			return fmt.Errorf("Webhook address %v is on a private network", addr.Addr())
+		}
+		return nil
+	}}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: cfg.WebhookTimeout.Duration, Transport: transport}
+}
+
+// CanEmail - whether email alerts can be sent, i.e. a mail server is configured.
+func (n *Notifier) CanEmail() bool {
+	return n.cfg.SMTP.Addr != ""
+}
+
+// PrivateWebhooks - whether webhooks may be on private addresses.
+func (n *Notifier) PrivateWebhooks() bool {
+	return n.cfg.AllowPrivateWebhooks
+}
+
+/*
+UpdateProduct - updates the Product, reading its old price first. A Product that couldn't be read is updated
+without being checked.
+*/
+func (n *Notifier) UpdateProduct(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	old := datastore.Product{Id: p.Id}
+	readErr := n.Datastore.GetProduct(datastore.WithFields(ctx, []string{datastore.FieldPrice}), &old)
+	stored, err := n.Datastore.UpdateProduct(ctx, p)
+	if err == nil && readErr == nil && stored.Price < old.Price {
+		n.check(ctx, old.Price, stored)
+	}
+	return stored, err
+}
+
+// check - queues a notification for each of the Product's subscriptions that the price change triggered.
+func (n *Notifier) check(ctx context.Context, oldPrice datastore.Money, p datastore.Product) {
+	subs, err := Subscriptions(ctx, n.Datastore, p.Id)
+	if err != nil {
+		log.Printf("Price alerts for product %v not checked: %v", p.Id, err)
+		return
+	}
+	for _, s := range subs {
+		if !s.Triggered(oldPrice, p.Price) {
+			continue
+		}
+		note := Notification{Event: EventPriceDrop, Subscription: s, Product: p, OldPrice: oldPrice}
+		if err := n.jobs.Enqueue(ctx, JobNotify, note); err != nil {
+			log.Printf("Price alert %v for product %v not sent: %v", s.Id, p.Id, err)
+		}
+	}
+}
+
+// notifyJob - delivers a notification by webhook or email. A delivery that fails is retried.
+func (n *Notifier) notifyJob(ctx context.Context, payload json.RawMessage) error {
+	var note Notification
+	if err := json.Unmarshal(payload, &note); err != nil {
+		return err
+	}
+	if note.Subscription.WebhookURL != "" {
+		return n.post(ctx, note)
+	}
+	return n.email(note)
+}
+
+// post - local helper function that POSTs the notification to its webhook, which must respond with a 2xx status.
+func (n *Notifier) post(ctx context.Context, note Notification) error {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, note.Subscription.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracecontext.Inject(ctx, req.Header)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error calling price alert webhook %v: %v", note.Subscription.WebhookURL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Price alert webhook %v responded %v", note.Subscription.WebhookURL, resp.Status)
+	}
+	return nil
+}
+
+// email - local helper function that sends the notification through the configured mail server.
+func (n *Notifier) email(note Notification) error {
+	server := n.cfg.SMTP
+	if server.Addr == "" {
+		return fmt.Errorf("Price alert %v is by email, but no mail server is configured", note.Subscription.Id)
+	}
+	var auth smtp.Auth
+	if server.Username != "" {
+		host, _, _ := net.SplitHostPort(server.Addr)
+		auth = smtp.PlainAuth("", server.Username, server.Password, host)
+	}
+
+	p := note.Product
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %v\r\n", server.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", note.Subscription.Email)
+	fmt.Fprintf(&msg, "Subject: Price drop: %v is now %v\r\n", oneLine(p.Name), p.Price)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%v (product %v) has dropped from %v to %v, below your alert threshold of %v.\r\n",
+		oneLine(p.Name), p.Id, note.OldPrice, p.Price, note.Subscription.Threshold)
+	if err := smtp.SendMail(server.Addr, auth, server.From, []string{note.Subscription.Email}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("Error emailing price alert %v: %v", note.Subscription.Id, err)
+	}
+	return nil
+}
+
+// oneLine - local helper function that keeps a product name from breaking out of an email header.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,135 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/alerts"
+	"github.com/bamajap/go-basic-api-app/cache"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+	"github.com/bamajap/go-basic-api-app/jobs"
+	"github.com/bamajap/go-basic-api-app/related"
+	"github.com/bamajap/go-basic-api-app/search"
+	"github.com/bamajap/go-basic-api-app/usage"
+)
+
+/*
+API - the handlers of the product API, and the backends they work on. The handlers reach their backends only
+through an API, never a package variable, so tests can give them a fake store, and one process can serve several
+APIs side by side.
+*/
+type API struct {
+	// Store - where the catalog is kept, with the search index and cache (if configured) in front of it.
+	Store datastore.Datastore
+	// Search - answers /products/search: the search index, if one is configured, or else Store.
+	Search search.Searcher
+	// Index - the search index Product writes are mirrored into; nil when searches read Store.
+	Index *search.Indexed
+	// Alerts - checks price drops against price alert subscriptions; nil unless alerts are enabled.
+	Alerts *alerts.Notifier
+	// Jobs - runs background work, such as search index updates. It isn't started here.
+	Jobs *jobs.Queue
+	// Exporter - writes catalog exports to S3; nil unless an export bucket is configured.
+	Exporter *s3Exporter
+	// Dependencies - what /healthz checks.
+	Dependencies []*dependency
+	// Auth - checks callers' credentials; nil when the API is open.
+	Auth authenticator
+	// AdminAuth - checks the credentials of /admin requests: Auth's, or the admin token; nil when neither is set.
+	AdminAuth authenticator
+	// Signatures - checks the signatures on writes; nil unless signing clients are configured.
+	Signatures *hmacAuth
+	// CSRF - issues and checks the CSRF tokens browsers' writes need; nil unless CSRF protection is enabled.
+	CSRF *csrfTokens
+	// Metrics - counts requests for CloudWatch; nil unless metrics are configured.
+	Metrics *cloudWatch
+	// Responses - the shared cache of listing and search responses; nil unless one is configured.
+	Responses *responseCache
+	// Usage - counts requests by client and endpoint; nil unless usage analytics are enabled.
+	Usage *usage.Tracker
+	// Related - finds the Products related to one, for /product/{id}/related.
+	Related related.Finder
+	// Events - the change events read from the backend's change feed, for whatever reacts to changes. Nothing is
+	// published on it unless the feed is followed.
+	Events *events.Bus
+}
+
+/*
+newAPI - an API over store, with the job queue, search index, price alerts and cache the config asks for. The search
+index and price alerts see every write that reaches store, including those the cache passes through.
+*/
+func newAPI(cfg config.Config, store datastore.Datastore) (*API, error) {
+	queue, err := newJobQueue(cfg.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	index, err := newSearchIndex(cfg, store, queue)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := newS3Exporter(context.Background(), cfg.Export)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := newAuthenticator(cfg.Auth, store)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := newHMACAuth(cfg.Auth.HMAC, store)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newTokenAuth(cfg.Auth.AdminToken)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := newCSRFTokens(cfg.CSRF)
+	if err != nil {
+		return nil, err
+	}
+
+	finder, err := newRelatedFinder(cfg.Related)
+	if err != nil {
+		return nil, err
+	}
+	// Usage is written straight to the backend, past the caches and the search index.
+	tracker, err := newUsageTracker(cfg.Usage, store)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &API{
+		Index: index, Jobs: queue, Exporter: exporter, Auth: auth, AdminAuth: adminAuthenticator(auth, token), Signatures: signatures, CSRF: csrf, Related: finder,
+		Usage: tracker, Events: &events.Bus{},
+	}
+	backend := store
+	if index != nil {
+		store = index
+	}
+	if cfg.Alerts.Enabled {
+		if api.Alerts, err = alerts.NewNotifier(store, cfg.Alerts, queue); err != nil {
+			return nil, err
+		}
+		store = api.Alerts
+	}
+	if api.Responses = newResponseCache(cfg.ResponseCache); api.Responses != nil {
+		store = datastore.Intercept(store, api.Responses.invalidate)
+	}
+	var readCache *cache.Store
+	if cfg.Cache.Enabled {
+		readCache = cache.New(store, cfg.Cache.Size, cfg.Cache.TTL.Duration)
+		store = readCache
+	}
+	api.Store = store
+	api.Dependencies = newDependencies(cfg, backend, api, readCache)
+	api.Search = search.Datastore{Store: store}
+	if index != nil {
+		api.Search = index.Index
+	}
+	return api, nil
+}
@@ -0,0 +1,94 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/datastore/mocks"
+
+	"github.com/stretchr/testify/mock"
+)
+
+/*
+The tests here give the handlers a mock store, which fails the test on any call it wasn't told to expect, to check
+exactly what the handlers ask of the backend.
+*/
+
+func TestGetProductReadsTheRequestedProduct(t *testing.T) {
+	store := mocks.NewDatastore(t)
+	store.EXPECT().GetProduct(mock.Anything, mock.MatchedBy(func(p *datastore.Product) bool { return p.Id == "7" })).
+		Run(func(ctx context.Context, p *datastore.Product) { p.Name, p.Price = "Kiwi", money("0.5") }).
+		Return(nil)
+
+	w := do(testServer(t, config.Default(), store), "GET", "/v1/product/7", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"Name":"Kiwi"`) {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestCreateProductAddsItUnderTheNextID(t *testing.T) {
+	store := mocks.NewDatastore(t)
+	store.EXPECT().NextID(mock.Anything).Return("7", nil).Once()
+	store.EXPECT().AddProduct(mock.Anything, mock.MatchedBy(func(p datastore.Product) bool {
+		return p.Id == "7" && p.Name == "Kiwi" && p.Price == money("0.5")
+	})).Return(nil).Once()
+	// The response is the Product as stored, read back strongly consistently.
+	store.EXPECT().GetProduct(mock.MatchedBy(datastore.ConsistentRead), mock.MatchedBy(func(p *datastore.Product) bool { return p.Id == "7" })).
+		Run(func(ctx context.Context, p *datastore.Product) { p.Name, p.Price = "Kiwi", money("0.5") }).
+		Return(nil).Once()
+
+	w := do(testServer(t, config.Default(), store), "POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/v1/product/7" {
+		t.Fatalf("Got status %v, Location %q; body %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	store := mocks.NewDatastore(t)
+	store.EXPECT().CheckUnique(mock.Anything, mock.Anything).Return(nil).Once()
+
+	w := do(testServer(t, config.Default(), store), "POST", "/v1/product?dry_run=true", `{"Name": "Kiwi", "Price": 0.5}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestDeleteProductUsesTheRequestTenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Tenancy = config.Tenancy{Enabled: true, Tenants: []string{"acme", "globex"}}
+	store := mocks.NewDatastore(t)
+	store.EXPECT().DeleteProduct(
+		mock.MatchedBy(func(ctx context.Context) bool { return datastore.Tenant(ctx) == "globex" }),
+		datastore.Product{Id: "3"},
+	).Return(nil).Once()
+
+	r := newRequest("DELETE", "/v1/product/3", "")
+	r.Header.Set("X-Tenant-ID", "globex")
+	w := record(testServer(t, cfg, store), r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+// TestAPIsAreIndependent - two APIs in one process each see only their own store.
+func TestAPIsAreIndependent(t *testing.T) {
+	first := testServer(t, config.Default(), fixtureStore(t))
+	second := testServer(t, config.Default(), fixtureStore(t))
+
+	if w := do(first, "DELETE", "/v1/product/1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(first, "GET", "/v1/product/1", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Get from the first API: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(second, "GET", "/v1/product/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Get from the second API: got status %v; body %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,358 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errUnauthorized - the error a request without valid credentials responds with.
+var errUnauthorized = i18n.Errorf("unauthorized", "Authentication required")
+
+// The roles a user can have; each allows everything the ones before it do.
+const (
+	// roleReader - may read the catalog.
+	roleReader = "reader"
+	// roleWriter - may change it as well.
+	roleWriter = "writer"
+	// roleAdmin - may use /admin too, including managing users.
+	roleAdmin = "admin"
+)
+
+// roleRank - how much each role allows.
+var roleRank = map[string]int{roleReader: 1, roleWriter: 2, roleAdmin: 3}
+
+// principal - who made a request, as their credentials showed.
+type principal struct {
+	// Name - the user or client's name.
+	Name string
+	// Roles - what they're allowed to do. Users and clients in the config file are admins.
+	Roles []string
+	// Tenants - the tenants they may use while multi-tenancy is enabled; none means every tenant.
+	Tenants []string
+}
+
+// allows - whether the principal has role, or one that allows more.
+func (p principal) allows(role string) bool {
+	for _, r := range p.Roles {
+		if roleRank[r] >= roleRank[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// mayUse - whether the principal may use tenant.
+func (p principal) mayUse(tenant string) bool {
+	return len(p.Tenants) == 0 || slices.Contains(p.Tenants, tenant)
+}
+
+type principalKey struct{}
+
+// requestPrincipal - who made the request, and whether it was authenticated at all.
+func requestPrincipal(r *http.Request) (principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(principal)
+	return p, ok
+}
+
+/*
+authenticator - checks the credentials a request carries, for one authentication scheme. Each scheme is an
+authenticator, so requireAuth enforces them all alike.
+*/
+type authenticator interface {
+	// authenticate - who made the request; an error if it carries no credentials of this scheme, or wrong ones.
+	authenticate(r *http.Request) (principal, error)
+	// challenge - the WWW-Authenticate header sent with a 401, telling the caller how to authenticate.
+	challenge() string
+}
+
+/*
+newAuthenticator - the authenticator for the configured scheme; nil if there's none. Besides the users in the
+config, it accepts those kept in store, which are managed through /admin/users.
+*/
+func newAuthenticator(cfg config.Auth, store datastore.Datastore) (authenticator, error) {
+	switch cfg.Scheme {
+	case "":
+		return nil, nil
+	case config.AuthBasic:
+		return newBasicAuth(cfg.Basic, store)
+	}
+	return nil, fmt.Errorf("Unknown auth scheme %q; use %q", cfg.Scheme, config.AuthBasic)
+}
+
+/*
+requireAuth - refuses requests that auth doesn't accept with 401 Unauthorized, and gives the rest the principal
+it found. If the stored users can't be read, it responds as the datastore error says (503, usually). A nil auth lets
+everything through.
+*/
+func requireAuth(auth authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if auth == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := auth.authenticate(r)
+			if errors.Is(err, datastore.ErrUnavailable) {
+				writeError(w, r, storeStatus(err), err)
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", auth.challenge())
+				writeError(w, r, http.StatusUnauthorized, errUnauthorized)
+				return
+			}
+			noteClient(r, p.Name)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		})
+	}
+}
+
+/*
+requireRole - refuses requests from principals without role with 403 Forbidden; writes need roleWriter, whatever
+role says. Requests that weren't authenticated, because no authentication is configured, are let through.
+*/
+func requireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			needs := role
+			if mutating(r) && roleRank[needs] < roleRank[roleWriter] {
+				needs = roleWriter
+			}
+			if p, ok := requestPrincipal(r); ok && !p.allows(needs) {
+				writeError(w, r, http.StatusForbidden, i18n.Errorf("forbidden", "%v needs the %v role", p.Name, needs))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+requireAdmin - refuses requests to the admin endpoints that wipe or replace the catalog, manage users or expose who
+uses the API, unless they were authenticated: requireRole lets unauthenticated requests through when no scheme is
+configured, which would leave them open to anyone. A signing client's reads are authenticated here, since
+requireSignature only checks writes. Without any credentials configured they respond 403.
+*/
+func requireAdmin(signatures *hmacAuth) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		admin := requireRole(roleAdmin)(next)
+		var signed http.Handler
+		if signatures != nil {
+			signed = requireAuth(signatures)(admin)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := requestPrincipal(r); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if signed != nil {
+				signed.ServeHTTP(w, r)
+				return
+			}
+			writeError(w, r, http.StatusForbidden, i18n.Errorf("admin_auth_required", "%v needs authentication; configure auth or an admin token", r.URL.Path))
+		})
+	}
+}
+
+/*
+tokenAuth - a bearer token that authenticates as an admin: `Authorization: Bearer <token>`. Meant for the admin
+endpoints of deployments without users, and only safe over HTTPS.
+*/
+type tokenAuth struct {
+	token []byte
+}
+
+// newTokenAuth - authentication with the admin token; nil if none is configured.
+func newTokenAuth(token string) (*tokenAuth, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if len(token) < 16 {
+		return nil, fmt.Errorf("The admin token is too short; use at least 16 characters")
+	}
+	return &tokenAuth{token: []byte(token)}, nil
+}
+
+func (t *tokenAuth) authenticate(r *http.Request) (principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), t.token) != 1 {
+		return principal{}, errors.New("No valid admin token")
+	}
+	return principal{Name: "admin-token", Roles: []string{roleAdmin}}, nil
+}
+
+func (t *tokenAuth) challenge() string {
+	return `Bearer realm="admin"`
+}
+
+// anyAuth - accepts the credentials of any of its authenticators, and challenges as the first does.
+type anyAuth []authenticator
+
+/*
+adminAuthenticator - what /admin accepts: the scheme's credentials, or the admin token; nil if neither is
+configured.
+*/
+func adminAuthenticator(auth authenticator, token *tokenAuth) authenticator {
+	switch {
+	case token == nil:
+		return auth
+	case auth == nil:
+		return token
+	}
+	return anyAuth{auth, token}
+}
+
+func (a anyAuth) authenticate(r *http.Request) (principal, error) {
+	var first error
+	for _, auth := range a {
+		p, err := auth.authenticate(r)
+		if err == nil || errors.Is(err, datastore.ErrUnavailable) {
+			return p, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return principal{}, first
+}
+
+func (a anyAuth) challenge() string {
+	return a[0].challenge()
+}
+
+// dummyHash - compared against for unknown users, so they take as long to refuse as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+/*
+basicAuth - HTTP Basic authentication against bcrypt password hashes, of the configured users and then the stored
+ones. A bcrypt comparison is deliberately slow, so each user's last correct password is remembered, as a SHA-256
+hash, and a request repeating it isn't checked again, until the user's password hash changes.
+*/
+type basicAuth struct {
+	users   map[string][]byte
+	tenants map[string][]string
+	store   datastore.Datastore
+	realm   string
+
+	mu       sync.Mutex
+	verified map[string]verifiedPassword
+}
+
+// verifiedPassword - a password that matched a user's hash.
+type verifiedPassword struct {
+	hash string
+	sum  [sha256.Size]byte
+}
+
+// newBasicAuth - Basic authentication for the configured users and htpasswd file, and those in store.
+func newBasicAuth(cfg config.BasicAuth, store datastore.Datastore) (*basicAuth, error) {
+	users := map[string][]byte{}
+	for name, hash := range cfg.Users {
+		users[name] = []byte(hash)
+	}
+	if cfg.HtpasswdFile != "" {
+		if err := readHtpasswd(cfg.HtpasswdFile, users); err != nil {
+			return nil, err
+		}
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("Basic auth has no users; add an admin to users or htpasswd_file, who can add others through /admin/users")
+	}
+	for name, hash := range users {
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("User %q's password isn't a bcrypt hash (use htpasswd -B): %v", name, err)
+		}
+	}
+	return &basicAuth{users: users, tenants: cfg.Tenants, store: store, realm: cfg.Realm, verified: map[string]verifiedPassword{}}, nil
+}
+
+// readHtpasswd - adds the users in an htpasswd file (one "user:hash" per line; # starts a comment) to users.
+func readHtpasswd(path string, users map[string][]byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Error reading htpasswd file: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("%v:%v: expected user:hash", path, line)
+		}
+		users[name] = []byte(hash)
+	}
+	return scanner.Err()
+}
+
+func (b *basicAuth) authenticate(r *http.Request) (principal, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return principal{}, errors.New("No Basic credentials")
+	}
+	hash, p, err := b.user(r.Context(), name)
+	if err != nil {
+		return principal{}, err
+	}
+	known := hash != nil
+
+	sum := sha256.Sum256([]byte(password))
+	b.mu.Lock()
+	last, seen := b.verified[name]
+	b.mu.Unlock()
+	if known && seen && last.hash == string(hash) && subtle.ConstantTimeCompare(last.sum[:], sum[:]) == 1 {
+		return p, nil
+	}
+
+	if !known {
+		hash = dummyHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !known {
+		return principal{}, errors.New("Wrong user name or password")
+	}
+	b.mu.Lock()
+	b.verified[name] = verifiedPassword{hash: string(hash), sum: sum}
+	b.mu.Unlock()
+	return p, nil
+}
+
+// user - the named user's password hash, and who they are if it's right; a nil hash if there's no such user.
+func (b *basicAuth) user(ctx context.Context, name string) ([]byte, principal, error) {
+	if hash, ok := b.users[name]; ok {
+		return hash, principal{Name: name, Roles: []string{roleAdmin}, Tenants: b.tenants[name]}, nil
+	}
+	stored := datastore.User{Name: name}
+	err := b.store.GetUser(ctx, &stored)
+	if errors.Is(err, datastore.ErrNotFound) || (err == nil && stored.Kind != datastore.UserKindUser) {
+		return nil, principal{}, nil
+	}
+	if err != nil {
+		return nil, principal{}, err
+	}
+	return []byte(stored.PasswordHash), principal{Name: name, Roles: stored.Roles, Tenants: stored.Tenants}, nil
+}
+
+func (b *basicAuth) challenge() string {
+	return fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, b.realm)
+}
@@ -0,0 +1,122 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashPassword - a bcrypt hash of password, as htpasswd -B would write it (but quicker to check).
+func hashPassword(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestBasicAuth(t *testing.T) {
+	htpasswd := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(htpasswd, []byte("# CI\nci:"+hashPassword(t, "from-file")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Auth.Scheme = config.AuthBasic
+	cfg.Auth.Basic.Users = map[string]string{"alice": hashPassword(t, "secret")}
+	cfg.Auth.Basic.HtpasswdFile = htpasswd
+	h := testServer(t, cfg, fixtureStore(t))
+
+	cases := []struct {
+		name, path, user, password string
+		status                     int
+	}{
+		{"no credentials", "/v1/product/1", "", "", http.StatusUnauthorized},
+		{"wrong password", "/v1/product/1", "alice", "guess", http.StatusUnauthorized},
+		{"unknown user", "/v1/product/1", "mallory", "secret", http.StatusUnauthorized},
+		{"configured user", "/v1/product/1", "alice", "secret", http.StatusOK},
+		{"configured user again", "/v1/product/1", "alice", "secret", http.StatusOK},
+		{"remembered password changed", "/v1/product/1", "alice", "secret2", http.StatusUnauthorized},
+		{"htpasswd user", "/v1/product/1", "ci", "from-file", http.StatusOK},
+		{"admin", "/admin/backup", "", "", http.StatusUnauthorized},
+		{"catalog", "/catalog", "", "", http.StatusUnauthorized},
+		{"health checks are open", "/healthz", "", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := newRequest("GET", c.path, "")
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.password)
+		}
+		w := record(h, r)
+		if w.Code != c.status {
+			t.Errorf("%v: got status %v, want %v; body %s", c.name, w.Code, c.status, w.Body)
+		}
+		if c.status == http.StatusUnauthorized && (errorCode(w) != "unauthorized" || w.Header().Get("WWW-Authenticate") != `Basic realm="products", charset="UTF-8"`) {
+			t.Errorf("%v: got code %q, WWW-Authenticate %q", c.name, errorCode(w), w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBasicAuthConfig(t *testing.T) {
+	for name, cfg := range map[string]config.Auth{
+		"no users":     {Scheme: config.AuthBasic},
+		"not bcrypt":   {Scheme: config.AuthBasic, Basic: config.BasicAuth{Users: map[string]string{"alice": "secret"}}},
+		"missing file": {Scheme: config.AuthBasic, Basic: config.BasicAuth{HtpasswdFile: "no-such-file"}},
+		"unknown":      {Scheme: "digest"},
+	} {
+		if _, err := newAuthenticator(cfg, nil); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	const token = "an-admin-token-for-tests"
+	cfg := config.Default()
+	cfg.Auth.AdminToken = token
+	withToken := func(method, path string) *http.Request {
+		r := newRequest(method, path, "")
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	for _, tc := range []struct {
+		name   string
+		r      *http.Request
+		fail   map[string]error
+		status int
+		code   string
+	}{
+		{name: "no token", r: newRequest("DELETE", "/admin/products?confirm=true", ""), status: 401, code: "unauthorized"},
+		{name: "unconfirmed", r: withToken("DELETE", "/admin/products"), status: 400, code: "confirmation_required"},
+		{name: "truncate", r: withToken("DELETE", "/admin/products?confirm=true"), status: 204},
+		{name: "truncate fails", r: withToken("DELETE", "/admin/products?confirm=true"), fail: map[string]error{"Truncate": datastore.ErrUnavailable}, status: 503, code: "service_unavailable"},
+		{name: "read", r: withToken("GET", "/admin/features"), status: 200},
+		{name: "backup", r: withToken("GET", "/admin/backup"), status: 200},
+		{name: "retry missing dead letter", r: withToken("POST", "/admin/jobs/dead-letters/nope/retry"), status: 404, code: "not_found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := fixtureStore(t)
+			if tc.fail != nil {
+				store = failing(store, tc.fail)
+			}
+			w := record(testServer(t, cfg, store), tc.r)
+			if w.Code != tc.status || errorCode(w) != tc.code {
+				t.Fatalf("Got status %v, code %q; want %v, %q", w.Code, errorCode(w), tc.status, tc.code)
+			}
+		})
+	}
+
+	cfg.Auth.AdminToken = "short"
+	if _, err := newAPI(cfg, fixtureStore(t)); err == nil {
+		t.Errorf("Got no error for a short admin token")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/gorilla/mux"
+)
+
+// barcodePath - route template for looking a Product up by barcode. Any string is accepted, so that a malformed
+// barcode gets a 400 explaining why rather than a 404.
+func barcodePath() string {
+	return "/product/barcode/{code}"
+}
+
+/*
+GetProductByBarcode - display the Product with a barcode, e.g. one just scanned at a till.
+*/
+func (a *API) GetProductByBarcode(w http.ResponseWriter, r *http.Request) {
+	code := mux.Vars(r)["code"]
+	if err := datastore.ValidBarcode(code); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	fields, err := requestedFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	p, err := a.Store.FindByBarcode(withFields(r, fields).Context(), code)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if status, err := inCurrency(w, r, &p.Price); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localize(w, r, &p); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+
+	body, status, err := a.includeRelated(w, r, resource(p))
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	respond(w, r, http.StatusOK, sparse(body, fields))
+}
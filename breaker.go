@@ -0,0 +1,61 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/breaker"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// breakerMetrics - the datastore circuit breaker's state, and how often it has opened and refused calls.
+var breakerMetrics = expvar.NewMap("datastore_breaker")
+
+/*
+newBreaker - a datastore.Interceptor that refuses calls while the configured circuit breaker is open, with an error
+wrapping datastore.ErrUnavailable, so they respond 503; nil if the breaker isn't enabled.
+*/
+func newBreaker(cfg config.CircuitBreaker) (datastore.Interceptor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Cooldown.Duration <= 0 {
+		return nil, fmt.Errorf("Circuit breaker cooldown must be positive, not %v", cfg.Cooldown)
+	}
+
+	state := new(expvar.String)
+	state.Set(string(breaker.Closed))
+	breakerMetrics.Set("state", state)
+	b := breaker.New(cfg.Failures, cfg.Cooldown.Duration, func(s breaker.State) {
+		log.Printf("Datastore circuit breaker %v", s)
+		state.Set(string(s))
+		if s == breaker.Open {
+			breakerMetrics.Add("opened", 1)
+		}
+	})
+
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		ok, wait := b.Allow()
+		if !ok {
+			breakerMetrics.Add("refused", 1)
+			return datastore.Errorf("circuit_open", "%v not attempted: the datastore is failing, and will be tried again in %v: %w", method, wait.Round(time.Second), datastore.ErrUnavailable)
+		}
+		err := call(ctx)
+		b.Done(breakerFailure(err))
+		return err
+	}, nil
+}
+
+// breakerFailure - whether an error counts towards opening the breaker: a server error, and not the caller giving up.
+func breakerFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && storeStatus(err) >= http.StatusInternalServerError
+}
@@ -0,0 +1,119 @@
+/*
+Author: Jason Payne
+*/
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State - whether a Breaker lets calls through.
+type State string
+
+const (
+	// Closed - calls go through, and consecutive failures are counted.
+	Closed State = "closed"
+	// Open - calls are refused until the cooldown has passed.
+	Open State = "open"
+	// HalfOpen - the cooldown has passed, and one call is let through to see whether the dependency is back.
+	HalfOpen State = "half_open"
+)
+
+/*
+Breaker - a circuit breaker. Once threshold calls in a row have failed it opens, refusing calls for the cooldown
+so that callers fail fast instead of waiting on a dependency that's down. Then it lets a single trial call through:
+if that succeeds it closes again, and if it fails it stays open for another cooldown.
+*/
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	// onChange - called, with the lock held, whenever the state changes.
+	onChange func(State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool // whether the half-open trial call is under way
+}
+
+// New - a closed breaker that opens after threshold failures in a row (at least 1), for cooldown at a time.
+func New(threshold int, cooldown time.Duration, onChange func(State)) *Breaker {
+	if onChange == nil {
+		onChange = func(State) {}
+	}
+	return &Breaker{threshold: max(threshold, 1), cooldown: cooldown, onChange: onChange, state: Closed}
+}
+
+// State - the breaker's state; an open breaker whose cooldown has passed is half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.state
+}
+
+// expire - moves an open breaker whose cooldown has passed to half-open.
+func (b *Breaker) expire() {
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		b.set(HalfOpen)
+	}
+}
+
+func (b *Breaker) set(state State) {
+	if b.state != state {
+		b.state = state
+		b.onChange(state)
+	}
+}
+
+/*
+Allow - whether a call may be made now. If not, it also returns how long until the breaker lets one through. A call
+that's allowed must report how it went with Done.
+*/
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	switch b.state {
+	case Open:
+		return false, b.cooldown - time.Since(b.openedAt)
+	case HalfOpen:
+		if b.trial {
+			return false, 0
+		}
+		b.trial = true
+	}
+	return true, 0
+}
+
+// Done - records whether an allowed call failed.
+func (b *Breaker) Done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.threshold {
+			b.open()
+		}
+	case HalfOpen:
+		b.trial = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.set(Closed)
+	}
+	// A call that was allowed before the breaker opened changes nothing once it has.
+}
+
+func (b *Breaker) open() {
+	b.openedAt = time.Now()
+	b.set(Open)
+}
@@ -0,0 +1,47 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+func TestBreakerFailsFastOnceOpen(t *testing.T) {
+	circuit, err := newBreaker(config.CircuitBreaker{Enabled: true, Failures: 2, Cooldown: config.Duration{Duration: 50 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := datastore.Intercept(failing(fixtureStore(t), map[string]error{"GetAll": errors.New("Boom")}), circuit)
+	h := testServer(t, config.Default(), store)
+
+	// Not found is an answer, so it doesn't count.
+	for i := 0; i < 3; i++ {
+		if w := do(h, "GET", "/v1/product/99", ""); w.Code != http.StatusNotFound {
+			t.Fatalf("Get missing: got status %v; body %s", w.Code, w.Body)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if w := do(h, "GET", "/v1/products", ""); w.Code != http.StatusInternalServerError {
+			t.Fatalf("List %v: got status %v; body %s", i, w.Code, w.Body)
+		}
+	}
+	// Open: every call is refused, not just the failing one.
+	if w := do(h, "GET", "/v1/product/1", ""); w.Code != http.StatusServiceUnavailable || errorCode(w) != "circuit_open" {
+		t.Fatalf("Get while open: got status %v; body %s", w.Code, w.Body)
+	}
+
+	// After the cooldown a successful call closes it again.
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if w := do(h, "GET", "/v1/product/1", ""); w.Code != http.StatusOK {
+			t.Fatalf("Get %v after the cooldown: got status %v; body %s", i, w.Code, w.Body)
+		}
+	}
+}
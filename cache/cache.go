@@ -0,0 +1,264 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package cache provides an in-process read cache that wraps any datastore.Datastore.
+
+GetProduct and GetAll results are kept in an LRU with a TTL; every write through the cache invalidates the entries
+it could have changed. Writes made by other processes aren't seen until the TTL expires, so keep it short when
+several instances share a table. Strongly consistent reads (see datastore.WithConsistentRead) skip the cache.
+*/
+package cache
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// metrics - cache effectiveness, published at /debug/vars.
+var metrics = expvar.NewMap("read_cache")
+
+// key - the entry for a Product ID in the context's tenant; an empty ID is the tenant's GetAll result, which can't
+// clash with a Product because IDs are never empty.
+func key(ctx context.Context, id string) string {
+	return datastore.Tenant(ctx) + "/" + id
+}
+
+type entry struct {
+	key      string
+	product  datastore.Product
+	products []datastore.Product
+	expires  time.Time
+}
+
+/*
+Store - a Datastore whose GetProduct and GetAll are served from memory when possible.
+Every other read goes straight to the wrapped Datastore.
+*/
+type Store struct {
+	datastore.Datastore
+
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+	// gen - bumped on every invalidation, so a read that raced with a write doesn't cache what it read.
+	gen uint64
+}
+
+// New - wraps store with a cache holding at most size entries, each for at most ttl.
+func New(store datastore.Datastore, size int, ttl time.Duration) *Store {
+	return &Store{
+		Datastore: store,
+		size:      size,
+		ttl:       ttl,
+		order:     list.New(),
+		entries:   map[string]*list.Element{},
+	}
+}
+
+// Len - how many entries the cache holds, including any that have expired but haven't been evicted yet.
+func (c *Store) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// get - the live entry for k, if there is one, and the generation to pass to put after a miss.
+func (c *Store) get(k string) (*entry, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[k]
+	if !ok {
+		metrics.Add("misses", 1)
+		return nil, c.gen, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		metrics.Add("misses", 1)
+		return nil, c.gen, false
+	}
+	c.order.MoveToFront(el)
+	metrics.Add("hits", 1)
+	return e, c.gen, true
+}
+
+// lookup - get, except that a strongly consistent read always misses, so it's read from the backend and refreshes
+// the entry.
+func (c *Store) lookup(ctx context.Context, k string) (*entry, uint64, bool) {
+	if !datastore.ConsistentRead(ctx) {
+		return c.get(k)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metrics.Add("consistent_reads", 1)
+	return nil, c.gen, false
+}
+
+// put - stores an entry read at generation gen, evicting the least recently used one if the cache is full.
+func (c *Store) put(e *entry, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	e.expires = time.Now().Add(c.ttl)
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		metrics.Add("evictions", 1)
+	}
+}
+
+// invalidate - drops the entries for the given Product IDs, and the GetAll result, which any write can change.
+func (c *Store) invalidate(ctx context.Context, ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, id := range append(ids, "") {
+		if el, ok := c.entries[key(ctx, id)]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// clear - drops every entry for the context's tenant.
+func (c *Store) clear(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	prefix := key(ctx, "")
+	for k, el := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// remove - must be called with mu held.
+func (c *Store) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+// GetProduct - served from the cache unless the Product has expired since it was cached, or the read is consistent.
+func (c *Store) GetProduct(ctx context.Context, product *datastore.Product) error {
+	e, gen, ok := c.lookup(ctx, key(ctx, product.Id))
+	if ok && !e.product.Expired() {
+		*product = e.product
+		return nil
+	}
+
+	// Entries are always complete Products, whatever fields this caller asked for.
+	if err := c.Datastore.GetProduct(datastore.WithFields(ctx, nil), product); err != nil {
+		return err
+	}
+	c.put(&entry{key: key(ctx, product.Id), product: *product}, gen)
+	return nil
+}
+
+// GetAll - served from the cache; callers get their own copy of the slice.
+func (c *Store) GetAll(ctx context.Context) ([]datastore.Product, error) {
+	e, gen, ok := c.lookup(ctx, key(ctx, ""))
+	if ok {
+		return live(e.products), nil
+	}
+
+	products, err := c.Datastore.GetAll(datastore.WithFields(ctx, nil))
+	if err != nil {
+		return nil, err
+	}
+	c.put(&entry{key: key(ctx, ""), products: products}, gen)
+	return live(products), nil
+}
+
+// live - a copy of products without any that have expired since they were cached.
+func live(products []datastore.Product) []datastore.Product {
+	out := make([]datastore.Product, 0, len(products))
+	for _, p := range products {
+		if !p.Expired() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (c *Store) AddProduct(ctx context.Context, p datastore.Product) error {
+	defer c.invalidate(ctx, p.Id)
+	return c.Datastore.AddProduct(ctx, p)
+}
+
+func (c *Store) AddProducts(ctx context.Context, products []datastore.Product) error {
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.Id
+	}
+	defer c.invalidate(ctx, ids...)
+	return c.Datastore.AddProducts(ctx, products)
+}
+
+func (c *Store) UpdateProduct(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	defer c.invalidate(ctx, p.Id)
+	return c.Datastore.UpdateProduct(ctx, p)
+}
+
+// AddReview / UpdateReview / DeleteReview - these change the Product's rating.
+func (c *Store) AddReview(ctx context.Context, r datastore.Review) error {
+	defer c.invalidate(ctx, r.ProductId)
+	return c.Datastore.AddReview(ctx, r)
+}
+
+func (c *Store) UpdateReview(ctx context.Context, old, r datastore.Review) error {
+	defer c.invalidate(ctx, r.ProductId)
+	return c.Datastore.UpdateReview(ctx, old, r)
+}
+
+func (c *Store) DeleteReview(ctx context.Context, r datastore.Review) error {
+	defer c.invalidate(ctx, r.ProductId)
+	return c.Datastore.DeleteReview(ctx, r)
+}
+
+func (c *Store) AdjustStock(ctx context.Context, id, location string, delta int) (datastore.Product, error) {
+	defer c.invalidate(ctx, id)
+	return c.Datastore.AdjustStock(ctx, id, location, delta)
+}
+
+// AddOrder - an order takes stock from the Products it's for.
+func (c *Store) AddOrder(ctx context.Context, order datastore.Order) error {
+	ids := make([]string, len(order.Lines))
+	for i, line := range order.Lines {
+		ids[i] = line.ProductId
+	}
+	defer c.invalidate(ctx, ids...)
+	return c.Datastore.AddOrder(ctx, order)
+}
+
+func (c *Store) DeleteProduct(ctx context.Context, p datastore.Product) error {
+	defer c.invalidate(ctx, p.Id)
+	return c.Datastore.DeleteProduct(ctx, p)
+}
+
+// Truncate - drops the tenant's entries as well.
+func (c *Store) Truncate(ctx context.Context) error {
+	defer c.clear(ctx)
+	return c.Datastore.Truncate(ctx)
+}
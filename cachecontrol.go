@@ -0,0 +1,151 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+// Route classes, each with its own Cache-Control policy (config.CacheControl).
+const (
+	cacheListings = "listings"
+	cacheProducts = "products"
+	cacheAdmin    = "admin"
+)
+
+// cachePolicies - the parsed config.CacheControl, by route class. A class without one sends no Cache-Control.
+var cachePolicies = map[string]cachePolicy{}
+
+// cachePolicy - a Cache-Control header value, and its max-age (negative if it has none).
+type cachePolicy struct {
+	value  string
+	maxAge int
+}
+
+// cacheDirective - one Cache-Control directive: a token, optionally with a token or quoted-string argument.
+var cacheDirective = regexp.MustCompile(`^[A-Za-z-]+(=([0-9A-Za-z-]+|"[^"]*"))?$`)
+
+/*
+parseCachePolicy - checks a Cache-Control value is a list of directives, and finds its max-age. An empty value is no
+policy.
+*/
+func parseCachePolicy(value string) (cachePolicy, error) {
+	policy := cachePolicy{value: strings.TrimSpace(value), maxAge: -1}
+	if policy.value == "" {
+		return policy, nil
+	}
+	for _, directive := range strings.Split(policy.value, ",") {
+		directive = strings.TrimSpace(directive)
+		if !cacheDirective.MatchString(directive) {
+			return cachePolicy{}, fmt.Errorf("Invalid Cache-Control directive %q", directive)
+		}
+		name, arg, _ := strings.Cut(directive, "=")
+		if strings.EqualFold(name, "max-age") {
+			seconds, err := strconv.Atoi(arg)
+			if err != nil || seconds < 0 {
+				return cachePolicy{}, fmt.Errorf("Invalid max-age %q; use a whole number of seconds", arg)
+			}
+			policy.maxAge = seconds
+		}
+	}
+	return policy, nil
+}
+
+// parseCachePolicies - the route classes' policies from the config.
+func parseCachePolicies(cfg config.CacheControl) (map[string]cachePolicy, error) {
+	policies := map[string]cachePolicy{}
+	for class, value := range map[string]string{cacheListings: cfg.Listings, cacheProducts: cfg.Products, cacheAdmin: cfg.Admin} {
+		policy, err := parseCachePolicy(value)
+		if err != nil {
+			return nil, fmt.Errorf("cache_control.%v: %v", class, err)
+		}
+		if policy.value != "" {
+			policies[class] = policy
+		}
+	}
+	return policies, nil
+}
+
+/*
+cacheable - sends the route class's Cache-Control policy with successful GET and HEAD responses; errors, and other
+methods, are left uncacheable as before. A handler that sets Cache-Control itself keeps its own. With tenancy, the same
+URL is a different catalog per tenant, so shared caches are told the response varies by tenant.
+*/
+func cacheable(class string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := cachePolicies[class]
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cacheWriter{ResponseWriter: w, r: r, policy: policy}, r)
+	})
+}
+
+// cacheableFunc - cacheable for a HandlerFunc.
+func cacheableFunc(class string, next http.HandlerFunc) http.HandlerFunc {
+	return cacheable(class, next).ServeHTTP
+}
+
+// cacheAdminReads - cacheable as middleware for the /admin routes.
+func cacheAdminReads(next http.Handler) http.Handler {
+	return cacheable(cacheAdmin, next)
+}
+
+// cacheWriter - adds the policy's headers as the response starts, once its status is known.
+type cacheWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	policy  cachePolicy
+	started bool
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if !cw.started {
+		cw.started = true
+		if status >= 200 && status < 300 || status == http.StatusNotModified {
+			cw.setHeaders()
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.started {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush - passes flushes through, so streamed responses still stream.
+func (cw *cacheWriter) Flush() {
+	if !cw.started {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setHeaders - Cache-Control, and Expires to match its max-age, unless the handler chose its own.
+func (cw *cacheWriter) setHeaders() {
+	h := cw.Header()
+	if h.Get("Cache-Control") != "" {
+		return
+	}
+	h.Set("Cache-Control", cw.policy.value)
+	if cw.policy.maxAge >= 0 {
+		h.Set("Expires", time.Now().Add(time.Duration(cw.policy.maxAge)*time.Second).UTC().Format(http.TimeFormat))
+	}
+	if cw.r.Header.Get(tenantHeader) != "" {
+		h.Add("Vary", tenantHeader)
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// cartTTL - how long a cart lives after its last change; set from the config.
+var cartTTL = 24 * time.Hour
+
+// cartPath - route template for a single cart. Cart IDs are always UUIDs.
+func cartPath() string {
+	return "/carts/{cart:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// cartItemPath - route template for a single item in a cart.
+func cartItemPath() string {
+	return cartPath() + "/items/{item:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// cartURL - the canonical location of a cart.
+func cartURL(id string) string {
+	return currentVersion + "/carts/" + id
+}
+
+// pathCart - the live cart named in the path; on failure, it has already responded.
+func (a *API) pathCart(w http.ResponseWriter, r *http.Request) (datastore.Cart, bool) {
+	cart := datastore.Cart{Id: mux.Vars(r)["cart"]}
+	if err := a.Store.GetCart(r.Context(), &cart); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return datastore.Cart{}, false
+	}
+	return cart, true
+}
+
+// cartItem - the position of the item named in the path; on failure, it has already responded.
+func cartItem(w http.ResponseWriter, r *http.Request, cart datastore.Cart) (int, bool) {
+	id := mux.Vars(r)["item"]
+	for i, item := range cart.Items {
+		if item.Id == id {
+			return i, true
+		}
+	}
+	writeError(w, r, http.StatusNotFound, i18n.Errorf("cart_item_not_found", "Item <%v> is not in cart <%v>", id, cart.Id))
+	return 0, false
+}
+
+// saveCart - saves a changed cart, restarting its TTL, and responds with it.
+func (a *API) saveCart(w http.ResponseWriter, r *http.Request, status int, cart datastore.Cart) {
+	cart.ExpiresAt = time.Now().UTC().Add(cartTTL).Truncate(time.Second)
+	if err := a.Store.PutCart(r.Context(), cart); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, status, cart)
+}
+
+/*
+CreateCart - start a new, empty cart. Its ID is the session's token for the other cart endpoints.
+*/
+func (a *API) CreateCart(w http.ResponseWriter, r *http.Request) {
+	id, err := datastore.NewUUID()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", cartURL(id))
+	a.saveCart(w, r, http.StatusCreated, datastore.Cart{Id: id, Items: []datastore.CartItem{}})
+}
+
+/*
+GetCart - display a cart.
+*/
+func (a *API) GetCart(w http.ResponseWriter, r *http.Request) {
+	if cart, ok := a.pathCart(w, r); ok {
+		respond(w, r, http.StatusOK, cart)
+	}
+}
+
+/*
+DeleteCart - abandon a cart without checking it out.
+*/
+func (a *API) DeleteCart(w http.ResponseWriter, r *http.Request) {
+	if err := a.Store.DeleteCart(r.Context(), mux.Vars(r)["cart"]); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
+
+/*
+AddCartItem - put a quantity of a Product (or one of its variants) in a cart. Adding one that's already there
+increases its quantity.
+*/
+func (a *API) AddCartItem(w http.ResponseWriter, r *http.Request) {
+	cart, ok := a.pathCart(w, r)
+	if !ok {
+		return
+	}
+	var item datastore.CartItem
+	if err := decodeBody(r, &item); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	switch {
+	case item.Quantity < 1:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_quantity", "Quantity must be at least 1"))
+		return
+	case item.Quantity > maxQuantity:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("quantity_too_large", "Quantity must be at most %v", maxQuantity))
+		return
+	case !datastore.Strategy.Valid(item.ProductId):
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_product_id", "Invalid product ID %q", item.ProductId))
+		return
+	}
+	// Stock and prices are only checked at checkout, but there's no point in adding something that doesn't exist.
+	p := datastore.Product{Id: item.ProductId}
+	if err := a.Store.GetProduct(datastore.IDsOnly(r.Context()), &p); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if item.VariantId != "" {
+		v := datastore.Variant{ProductId: item.ProductId, Id: item.VariantId}
+		if err := a.Store.GetVariant(r.Context(), &v); err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	for i, existing := range cart.Items {
+		if existing.ProductId == item.ProductId && existing.VariantId == item.VariantId {
+			if existing.Quantity+item.Quantity > maxQuantity {
+				writeError(w, r, http.StatusBadRequest, i18n.Errorf("quantity_too_large", "Quantity must be at most %v", maxQuantity))
+				return
+			}
+			cart.Items[i].Quantity += item.Quantity
+			a.saveCart(w, r, http.StatusOK, cart)
+			return
+		}
+	}
+	if len(cart.Items) == maxOrderLines {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("cart_full", "A cart can hold at most %v items", maxOrderLines))
+		return
+	}
+	var err error
+	if item.Id, err = datastore.NewUUID(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	cart.Items = append(cart.Items, item)
+	a.saveCart(w, r, http.StatusOK, cart)
+}
+
+/*
+UpdateCartItem - change the quantity of an item in a cart.
+*/
+func (a *API) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	cart, ok := a.pathCart(w, r)
+	if !ok {
+		return
+	}
+	i, ok := cartItem(w, r, cart)
+	if !ok {
+		return
+	}
+	var body struct {
+		Quantity int `json:"quantity" xml:"quantity"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if body.Quantity < 1 {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_cart_quantity", "Quantity must be at least 1; remove the item instead"))
+		return
+	}
+	if body.Quantity > maxQuantity {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("quantity_too_large", "Quantity must be at most %v", maxQuantity))
+		return
+	}
+	cart.Items[i].Quantity = body.Quantity
+	a.saveCart(w, r, http.StatusOK, cart)
+}
+
+/*
+RemoveCartItem - take an item out of a cart.
+*/
+func (a *API) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	cart, ok := a.pathCart(w, r)
+	if !ok {
+		return
+	}
+	i, ok := cartItem(w, r, cart)
+	if !ok {
+		return
+	}
+	cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+	a.saveCart(w, r, http.StatusOK, cart)
+}
+
+/*
+CheckoutCart - place an order for a cart's items and close the cart. The cart is deleted first, so that of two
+concurrent checkouts only one places an order; if the order fails, the cart is put back.
+*/
+func (a *API) CheckoutCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := a.pathCart(w, r)
+	if !ok {
+		return
+	}
+	if len(cart.Items) == 0 {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("cart_empty", "Cart <%v> is empty", cart.Id))
+		return
+	}
+	if err := a.Store.DeleteCart(r.Context(), cart.Id); err != nil {
+		writeError(w, r, http.StatusConflict, err)
+		return
+	}
+
+	order := datastore.Order{Lines: make([]datastore.OrderLine, len(cart.Items))}
+	for i, item := range cart.Items {
+		order.Lines[i] = datastore.OrderLine{ProductId: item.ProductId, VariantId: item.VariantId, Quantity: item.Quantity}
+	}
+	if status, err := a.placeOrder(r, &order); err != nil {
+		if putErr := a.Store.PutCart(r.Context(), cart); putErr != nil {
+			log.Printf("request_id=%v cart <%v> could not be restored: %v", requestID(r), cart.Id, putErr)
+		}
+		writeError(w, r, status, err)
+		return
+	}
+	w.Header().Set("Location", orderURL(order.Id))
+	respond(w, r, http.StatusCreated, order)
+}
@@ -0,0 +1,92 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// catalogPageSize - how many Products each page of /catalog shows.
+const catalogPageSize = 25
+
+//go:embed templates/catalog.html
+var catalogHTML string
+
+// catalogTemplate - the /catalog page. html/template escapes every value, so Product names are safe to show.
+var catalogTemplate = template.Must(template.New("catalog").Funcs(template.FuncMap{"productURL": productURL}).Parse(catalogHTML))
+
+// catalogPage - what the template shows for one page of the catalog.
+type catalogPage struct {
+	Query       string
+	Products    []datastore.Product
+	First, Last int
+	Total       int
+	// Prev / Next - links to the neighbouring pages; empty at either end.
+	Prev, Next string
+}
+
+/*
+Catalog - an HTML page listing the Products, a page at a time, with a search box, for people to look through the
+catalog in a browser. ?q= searches names the way the listing endpoint does, and ?page= picks the page.
+*/
+func (a *API) Catalog(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if v := r.URL.Query().Get("page"); v != "" {
+		var err error
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_page", "Invalid page %q", v))
+			return
+		}
+	}
+
+	products, status, err := a.listProducts(r)
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	view := catalogPage{Query: query, Total: len(products)}
+	start := min((page-1)*catalogPageSize, len(products))
+	end := min(start+catalogPageSize, len(products))
+	view.Products = products[start:end]
+	view.First, view.Last = start+1, end
+
+	link := func(page int) string {
+		v := url.Values{}
+		if query != "" {
+			v.Set("q", query)
+		}
+		v.Set("page", strconv.Itoa(page))
+		return "?" + v.Encode()
+	}
+	if page > 1 {
+		// Past the end, "previous" is the last page.
+		view.Prev = link(max(min(page-1, (len(products)+catalogPageSize-1)/catalogPageSize), 1))
+	}
+	if end < len(products) {
+		view.Next = link(page + 1)
+	}
+
+	// Rendered in full first, so a template error can still be reported properly.
+	var body bytes.Buffer
+	if err := catalogTemplate.Execute(&body, view); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	body.WriteTo(w)
+}
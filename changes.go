@@ -0,0 +1,125 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// defaultChangesLimit - how many log entries a changes request reads when it doesn't give ?limit.
+const defaultChangesLimit = 100
+
+/*
+productChange - a Product that changed: what happened to it last and when, and, unless it was deleted, the
+Product as it is now.
+*/
+type productChange struct {
+	Id        string      `json:"id" xml:"id,attr"`
+	Change    string      `json:"change" xml:"change,attr"`
+	ChangedAt time.Time   `json:"changed_at" xml:"changed_at,attr"`
+	Product   interface{} `json:"product,omitempty" xml:"product,omitempty"`
+}
+
+/*
+changeFeed - the response to a changes request. NextToken is the since to send next time, whether or not HasMore
+says there are more changes already.
+*/
+type changeFeed struct {
+	XMLName   xml.Name        `json:"-" xml:"changes"`
+	Changes   []productChange `json:"changes" xml:"change"`
+	NextToken string          `json:"next_token" xml:"next_token"`
+	HasMore   bool            `json:"has_more" xml:"has_more"`
+}
+
+/*
+GetProductChanges - the Products created, updated or deleted since ?since=, an RFC 3339 timestamp or the next_token
+of the last response, so clients can keep a copy of the catalog in sync without downloading it again. At most
+?limit= log entries are read (100 by default); a Product changed more than once among them is listed once, with
+its latest change. Changes are kept for datastore.ChangeRetention, so a since older than that gets 410 Gone, and
+the client has to start again from a full listing.
+*/
+func (a *API) GetProductChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since := query.Get("since")
+	after, err := datastore.DecodeChangeToken(since)
+	if err != nil {
+		t, timeErr := time.Parse(time.RFC3339Nano, since)
+		if timeErr != nil {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_since", "Invalid since %q; use an RFC 3339 timestamp or a next_token", since))
+			return
+		}
+		after = datastore.Change{At: t.UTC()}
+	}
+	if time.Since(after.At) > datastore.ChangeRetention {
+		days := int(datastore.ChangeRetention / (24 * time.Hour))
+		writeError(w, r, http.StatusGone, i18n.Errorf("changes_expired", "Changes are only kept for %v days; download the catalog again", days))
+		return
+	}
+	limit := defaultChangesLimit
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_limit", "Invalid limit %q; use 1 to %v", v, maxPageSize))
+			return
+		}
+	}
+
+	changes, err := a.Store.GetChanges(r.Context(), after, limit)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	feed := changeFeed{Changes: []productChange{}, NextToken: since, HasMore: len(changes) == limit}
+	if len(changes) == 0 {
+		respond(w, r, http.StatusOK, feed)
+		return
+	}
+	feed.NextToken = datastore.EncodeChangeToken(changes[len(changes)-1])
+
+	// Keep each Product's latest change, in the order of those.
+	latest := map[string]datastore.Change{}
+	for _, c := range changes {
+		latest[c.ProductId] = c
+	}
+	ids := []string{}
+	for _, c := range changes {
+		if latest[c.ProductId] == c {
+			ids = append(ids, c.ProductId)
+		}
+	}
+	products, _, err := a.Store.GetProducts(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if status, err := productsInCurrency(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	current := make(map[string]datastore.Product, len(products))
+	for _, p := range products {
+		current[p.Id] = p
+	}
+
+	for _, id := range ids {
+		c := productChange{Id: id, Change: latest[id].Kind, ChangedAt: latest[id].At}
+		// A Product deleted after the change the log has read up to is reported deleted already.
+		if p, ok := current[id]; ok {
+			c.Product = resource(p)
+		} else {
+			c.Change = datastore.ChangeDeleted
+		}
+		feed.Changes = append(feed.Changes, c)
+	}
+	respond(w, r, http.StatusOK, feed)
+}
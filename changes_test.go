@@ -0,0 +1,94 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+func TestProductChangesSince(t *testing.T) {
+	start := time.Now().Add(-time.Second).Format(time.RFC3339)
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	changesSince := func(query string) changeFeed {
+		t.Helper()
+		w := do(h, "GET", "/v1/products/changes?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET changes?%v: got status %v; body %s", query, w.Code, w.Body)
+		}
+		var feed struct {
+			Changes []struct {
+				Id      string          `json:"id"`
+				Change  string          `json:"change"`
+				Product json.RawMessage `json:"product"`
+			} `json:"changes"`
+			NextToken string `json:"next_token"`
+			HasMore   bool   `json:"has_more"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		got := changeFeed{NextToken: feed.NextToken, HasMore: feed.HasMore}
+		for _, c := range feed.Changes {
+			if (c.Change == "deleted") != (c.Product == nil) {
+				t.Fatalf("Product %v was %v, but the product is %s", c.Id, c.Change, c.Product)
+			}
+			got.Changes = append(got.Changes, productChange{Id: c.Id, Change: c.Change})
+		}
+		return got
+	}
+	kinds := func(feed changeFeed) map[string]string {
+		m := map[string]string{}
+		for _, c := range feed.Changes {
+			m[c.Id] = c.Change
+		}
+		return m
+	}
+
+	first := changesSince("since=" + url.QueryEscape(start) + "&limit=2")
+	if len(first.Changes) != 2 || !first.HasMore || first.NextToken == "" {
+		t.Fatalf("The first page was %+v", first)
+	}
+	// The fixture's review rated Apple after the Products were added.
+	rest := changesSince("since=" + first.NextToken)
+	if got := kinds(rest); len(got) != 2 || got["3"] != "created" || got["1"] != "updated" || rest.HasMore {
+		t.Fatalf("The second page was %+v", rest)
+	}
+
+	if w := do(h, "PUT", "/v1/product/1", `{"Name": "Apple", "Price": 1.25}`); w.Code != http.StatusOK {
+		t.Fatalf("Update: got status %v; body %s", w.Code, w.Body)
+	}
+	do(h, "PUT", "/v1/product/2", `{"Name": "Blood Orange", "Price": 1.1}`)
+	if w := do(h, "DELETE", "/v1/product/2", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got status %v; body %s", w.Code, w.Body)
+	}
+	since := changesSince("since=" + rest.NextToken)
+	if got := kinds(since); len(got) != 2 || got["1"] != "updated" || got["2"] != "deleted" {
+		t.Fatalf("Changes since the last sync were %+v", since)
+	}
+	if caughtUp := changesSince("since=" + since.NextToken); len(caughtUp.Changes) != 0 || caughtUp.NextToken != since.NextToken {
+		t.Fatalf("Changes once caught up were %+v", caughtUp)
+	}
+
+	for _, c := range []struct {
+		query  string
+		status int
+		code   string
+	}{
+		{"", http.StatusBadRequest, "invalid_since"},
+		{"since=yesterday", http.StatusBadRequest, "invalid_since"},
+		{"since=" + url.QueryEscape(time.Now().AddDate(0, -2, 0).Format(time.RFC3339)), http.StatusGone, "changes_expired"},
+		{"since=" + url.QueryEscape(start) + "&limit=0", http.StatusBadRequest, "invalid_limit"},
+	} {
+		if w := do(h, "GET", "/v1/products/changes?"+c.query, ""); w.Code != c.status || errorCode(w) != c.code {
+			t.Fatalf("GET changes?%v: got status %v, want %v %v; body %s", c.query, w.Code, c.status, c.code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// chaosAll - the key of the fault for every request or call without one of its own.
+const chaosAll = "*"
+
+// errFaultInjected - the error a request failed by fault injection responds with.
+var errFaultInjected = i18n.Errorf("fault_injected", "Fault injected for testing")
+
+/*
+validateChaos - checks the fault injection settings: rates between 0 and 1, no negative delays, error statuses,
+and call keys that name a Datastore method. Route keys can only be checked for their form, since reloads happen
+without the router.
+*/
+func validateChaos(chaos config.Chaos) error {
+	store := reflect.TypeOf((*datastore.Datastore)(nil)).Elem()
+	for key := range chaos.Calls {
+		if _, ok := store.MethodByName(key); !ok && key != chaosAll {
+			return fmt.Errorf("Unknown datastore method %q in chaos calls", key)
+		}
+	}
+	for key := range chaos.Routes {
+		if method, path, ok := strings.Cut(key, " "); key != chaosAll && (!ok || method == "" || !strings.HasPrefix(path, "/")) {
+			return fmt.Errorf("Invalid chaos route %q; use a method and path such as \"GET %v/products\", or %q", key, currentVersion, chaosAll)
+		}
+	}
+	for _, faults := range []map[string]config.Fault{chaos.Routes, chaos.Calls} {
+		for key, f := range faults {
+			switch {
+			case f.ErrorRate < 0 || f.ErrorRate > 1:
+				return fmt.Errorf("The chaos error_rate for %q must be between 0 and 1", key)
+			case f.Latency.Duration < 0 || f.Jitter.Duration < 0:
+				return fmt.Errorf("The chaos latency and jitter for %q can't be negative", key)
+			case f.Status != 0 && (f.Status < 400 || f.Status > 599):
+				return fmt.Errorf("The chaos status for %q must be an error status, from 400 to 599", key)
+			}
+		}
+	}
+	return nil
+}
+
+// fault - the fault configured for key, falling back to the one for every request or call.
+func fault(faults map[string]config.Fault, key string) (config.Fault, bool) {
+	if f, ok := faults[key]; ok {
+		return f, true
+	}
+	f, ok := faults[chaosAll]
+	return f, ok
+}
+
+/*
+inject - waits out a fault's latency, then reports whether it fails this time. It gives up early, with the
+context's error, if the request is abandoned first.
+*/
+func inject(ctx context.Context, f config.Fault) (bool, error) {
+	delay := f.Latency.Duration
+	if f.Jitter.Duration > 0 {
+		delay += time.Duration(rand.Int63n(int64(f.Jitter.Duration) + 1))
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return rand.Float64() < f.ErrorRate, nil
+}
+
+/*
+injectFaults - delays and fails API requests as the chaos routes in force say. The settings are read on every
+request, so faults can be switched on and off with a config reload.
+*/
+func injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes := live.Load().cfg.Chaos.Routes
+		key := chaosAll
+		if route := mux.CurrentRoute(r); route != nil {
+			template, _ := route.GetPathTemplate()
+			key = r.Method + " " + routeKey(template)
+		}
+		f, ok := fault(routes, key)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		failed, err := inject(r.Context(), f)
+		if err != nil {
+			return
+		}
+		if failed {
+			status := f.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			writeError(w, r, status, errFaultInjected)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+injectCallFaults - a datastore.Interceptor that delays and fails backend calls as the chaos calls in force say. A
+failed call isn't made; it returns an error wrapping datastore.ErrUnavailable instead.
+*/
+func injectCallFaults(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	if f, ok := fault(live.Load().cfg.Chaos.Calls, method); ok {
+		failed, err := inject(ctx, f)
+		if err != nil {
+			return err
+		}
+		if failed {
+			return fmt.Errorf("Fault injected into %v: %w", method, datastore.ErrUnavailable)
+		}
+	}
+	return call(ctx)
+}
@@ -0,0 +1,276 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package client is a typed Go client for the products HTTP API.
+
+	c := client.New("http://localhost:8000/v1")
+	p, err := c.Get(ctx, "1")
+	if errors.Is(err, client.ErrNotFound) {
+		...
+	}
+
+Idempotent requests (GET, PUT, DELETE) are retried on network errors, 429 and 502-504 responses; creates are not,
+since a retried create could add the product twice.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// Product - the API's product representation.
+type Product = datastore.Product
+
+// Money - an exact amount, such as a Product's Price.
+type Money = datastore.Money
+
+var (
+	// ErrNotFound - the product doesn't exist (404).
+	ErrNotFound = errors.New("Product not found")
+	// ErrConflict - a product with the same ID already exists (409).
+	ErrConflict = errors.New("Product already exists")
+	// ErrInvalid - the server rejected the request as malformed (400, 415 or 422).
+	ErrInvalid = errors.New("Invalid request")
+	// ErrForbidden - the request isn't allowed, e.g. for an unknown tenant (403).
+	ErrForbidden = errors.New("Forbidden")
+)
+
+/*
+Error - a non-2xx response. Use errors.Is with ErrNotFound, ErrConflict or ErrInvalid to check the common cases.
+*/
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Title / Detail - from the server's problem+json body, or the plain-text body in legacy mode.
+	Title  string
+	Detail string
+	// Code - the server's stable error code, e.g. "product_not_found" or "validation_failed"; empty in legacy mode.
+	Code string
+	// RequestID - the server's X-Request-ID for the request; quote it when reporting a problem.
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if e.RequestID != "" {
+		msg += " (request ID " + e.RequestID + ")"
+	}
+	return fmt.Sprintf("%v %v: %v %v: %v", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), msg)
+}
+
+// Is - maps status codes onto the package's sentinel errors.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrInvalid:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnsupportedMediaType ||
+			e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+/*
+ProductsClient - talks to one API base URL, e.g. http://localhost:8000/v1. The exported fields may be changed
+before first use.
+*/
+type ProductsClient struct {
+	BaseURL string
+	// HTTPClient - the client requests are sent with; defaults to one with a 30 second timeout.
+	HTTPClient *http.Client
+	// MaxRetries - how many times an idempotent request is retried (default 3).
+	MaxRetries int
+	// RetryDelay - the first retry's delay, doubled for each retry after it (default 100ms).
+	RetryDelay time.Duration
+	// Tenant - sent as the X-Tenant-ID header, for servers with multi-tenancy enabled.
+	Tenant string
+}
+
+// New - a client for the API at baseURL with the default settings.
+func New(baseURL string) *ProductsClient {
+	return &ProductsClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		RetryDelay: 100 * time.Millisecond,
+	}
+}
+
+// ListOptions - filters for List; at most one should be set.
+type ListOptions struct {
+	// Name - only products with this name (case-insensitive).
+	Name string
+	// NamePrefix - only products whose name starts with this (case-insensitive).
+	NamePrefix string
+}
+
+// List - the products matching opts, in price-descending order.
+func (c *ProductsClient) List(ctx context.Context, opts ListOptions) ([]Product, error) {
+	products := []Product{}
+	return products, c.do(ctx, http.MethodGet, "/products"+opts.query(), nil, &products)
+}
+
+// query - the listing parameters for opts, with the leading "?"; empty if there are none.
+func (opts ListOptions) query() string {
+	query := url.Values{}
+	if opts.Name != "" {
+		query.Set("name", opts.Name)
+	}
+	if opts.NamePrefix != "" {
+		query.Set("name_prefix", opts.NamePrefix)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// Count - the number of products matching opts.
+func (c *ProductsClient) Count(ctx context.Context, opts ListOptions) (int, error) {
+	var count struct {
+		Count int `json:"count"`
+	}
+	return count.Count, c.do(ctx, http.MethodGet, "/products/count"+opts.query(), nil, &count)
+}
+
+// Get - a single product.
+func (c *ProductsClient) Get(ctx context.Context, id string) (Product, error) {
+	var p Product
+	return p, c.do(ctx, http.MethodGet, "/product/"+url.PathEscape(id), nil, &p)
+}
+
+// Create - adds a product and returns it with its server-assigned ID. Any ID in p is ignored by the server.
+func (c *ProductsClient) Create(ctx context.Context, p Product) (Product, error) {
+	var created Product
+	return created, c.do(ctx, http.MethodPost, "/product", p, &created)
+}
+
+// Update - replaces the product with p.Id and returns it as stored.
+func (c *ProductsClient) Update(ctx context.Context, p Product) (Product, error) {
+	var updated Product
+	return updated, c.do(ctx, http.MethodPut, "/product/"+url.PathEscape(p.Id), p, &updated)
+}
+
+// Delete - removes a product.
+func (c *ProductsClient) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/product/"+url.PathEscape(id), nil, nil)
+}
+
+// do - sends a JSON request, with retries for idempotent methods, and decodes a JSON response into out (if non-nil).
+func (c *ProductsClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	retries := c.MaxRetries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, data)
+		if err == nil && !retryable(resp.StatusCode) || attempt >= retries {
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			return decode(resp, method, c.BaseURL+path, out)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.RetryDelay << uint(attempt)):
+		}
+	}
+}
+
+// send - one attempt at a request.
+func (c *ProductsClient) send(ctx context.Context, method, path string, data []byte) (*http.Response, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.Tenant)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// retryable - whether a response status is worth retrying.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decode - turns an error status into an *Error, or decodes a successful body into out.
+func decode(resp *http.Response, method, url string, out interface{}) error {
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Method: method, URL: url, StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+		var problem struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+			Code   string `json:"code"`
+		}
+		if json.Unmarshal(raw, &problem) == nil && (problem.Title != "" || problem.Detail != "") {
+			apiErr.Title, apiErr.Detail, apiErr.Code = problem.Title, problem.Detail, problem.Code
+		} else {
+			apiErr.Detail = strings.TrimSpace(string(raw))
+		}
+		return apiErr
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Error decoding %v %v response: %v", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies - the proxies whose X-Forwarded-For headers are believed; set from the config.
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies - the configured proxy addresses and ranges, as prefixes.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, p := range proxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q; use an IP address or CIDR range", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// trusted - whether addr is one of the trusted proxies.
+func trusted(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+clientIP - the address a request came from. If it came through trusted proxies, that's the nearest address in
+X-Forwarded-For that isn't one of them; the addresses before it were written by the client, so can't be believed.
+A request through the Unix socket came from a proxy on this host, which is trusted whatever trusted_proxies says.
+*/
+func clientIP(r *http.Request) (netip.Addr, bool) {
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	i := len(forwarded) - 1
+
+	var addr netip.Addr
+	if viaUnixSocket(r) {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr, i = hop.Unmap(), i-1
+	} else {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if addr, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}, false
+		}
+		addr = addr.Unmap()
+	}
+
+	for ; i >= 0 && trusted(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr, true
+}
+
+// clientKey - the client a request is counted against: its IP address, or its /64 if that's IPv6.
+func clientKey(r *http.Request) string {
+	addr, ok := clientIP(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
@@ -0,0 +1,298 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/gorilla/mux"
+)
+
+// maxMetricData - the most data points a single PutMetricData call may send.
+const maxMetricData = 1000
+
+// metricMethods - the request methods metrics are kept for; any other is counted as "OTHER", so clients can't
+// create new metrics at will.
+var metricMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// metricUnits - the CloudWatch unit of each metric that isn't a count.
+var metricUnits = map[string]types.StandardUnit{
+	"Latency": types.StandardUnitMilliseconds,
+}
+
+// metricUnit - the CloudWatch unit of the named metric.
+func metricUnit(name string) types.StandardUnit {
+	if unit, ok := metricUnits[name]; ok {
+		return unit
+	}
+	return types.StandardUnitCount
+}
+
+// metricValue - one metric's value for a request or call.
+type metricValue struct {
+	name  string
+	value float64
+}
+
+// series - the statistics gathered for one set of dimensions since the last PutMetricData.
+type series struct {
+	dimensions []types.Dimension
+	names      []string
+	stats      map[string]*types.StatisticSet
+}
+
+/*
+cloudWatch - records requests and backend calls as CloudWatch metrics, either as EMF log lines or by gathering them
+for PutMetricData. A nil cloudWatch records nothing.
+*/
+type cloudWatch struct {
+	cfg config.Metrics
+	// dimensions - the configured dimensions, in name order, that every metric has.
+	dimensions []types.Dimension
+	// out - where EMF lines are written.
+	out io.Writer
+	// client - sends the gathered statistics, for MetricsPutMetricData.
+	client *cloudwatch.Client
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// newCloudWatch - the metrics the config asks for; nil if it doesn't ask for any.
+func newCloudWatch(ctx context.Context, cfg config.Metrics) (*cloudWatch, error) {
+	if cfg.Output == "" {
+		return nil, nil
+	}
+	if cfg.Namespace == "" {
+		return nil, fmt.Errorf("Metrics namespace can't be empty")
+	}
+
+	c := &cloudWatch{cfg: cfg, out: os.Stdout, series: map[string]*series{}}
+	for name, value := range cfg.Dimensions {
+		c.dimensions = append(c.dimensions, types.Dimension{Name: aws.String(name), Value: aws.String(value)})
+	}
+	sort.Slice(c.dimensions, func(i, j int) bool { return *c.dimensions[i].Name < *c.dimensions[j].Name })
+
+	switch cfg.Output {
+	case config.MetricsEMF:
+	case config.MetricsPutMetricData:
+		if cfg.Interval.Duration <= 0 {
+			return nil, fmt.Errorf("Metrics interval must be positive, not %v", cfg.Interval)
+		}
+		var opts []func(*awsconfig.LoadOptions) error
+		if cfg.Region != "" {
+			opts = append(opts, awsconfig.WithRegion(cfg.Region))
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading AWS config for CloudWatch: %v", err)
+		}
+		awsCfg.APIOptions = append(awsCfg.APIOptions, tracecontext.AWS)
+		c.client = cloudwatch.NewFromConfig(awsCfg)
+	default:
+		return nil, fmt.Errorf("Unknown metrics output %q; use %q or %q", cfg.Output, config.MetricsEMF, config.MetricsPutMetricData)
+	}
+	return c, nil
+}
+
+// record - records the values of a request or call, under the configured dimensions and its own.
+func (c *cloudWatch) record(dimensions []types.Dimension, values []metricValue) {
+	dimensions = append(append([]types.Dimension(nil), c.dimensions...), dimensions...)
+	if c.client == nil {
+		c.writeEMF(time.Now(), dimensions, values)
+		return
+	}
+
+	key, _ := json.Marshal(dimensions)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[string(key)]
+	if !ok {
+		s = &series{dimensions: dimensions, stats: map[string]*types.StatisticSet{}}
+		c.series[string(key)] = s
+	}
+	for _, v := range values {
+		stats, ok := s.stats[v.name]
+		if !ok {
+			s.names = append(s.names, v.name)
+			s.stats[v.name] = &types.StatisticSet{
+				SampleCount: aws.Float64(1), Sum: aws.Float64(v.value), Minimum: aws.Float64(v.value), Maximum: aws.Float64(v.value),
+			}
+			continue
+		}
+		*stats.SampleCount++
+		*stats.Sum += v.value
+		*stats.Minimum = min(*stats.Minimum, v.value)
+		*stats.Maximum = max(*stats.Maximum, v.value)
+	}
+}
+
+/*
+writeEMF - writes values as one line in CloudWatch's embedded metric format: the values and dimensions as fields,
+with an _aws field saying which fields are which.
+*/
+func (c *cloudWatch) writeEMF(at time.Time, dimensions []types.Dimension, values []metricValue) {
+	line := map[string]any{}
+	var names []string
+	for _, d := range dimensions {
+		names = append(names, *d.Name)
+		line[*d.Name] = *d.Value
+	}
+	var metrics []map[string]string
+	for _, v := range values {
+		metrics = append(metrics, map[string]string{"Name": v.name, "Unit": string(metricUnit(v.name))})
+		line[v.name] = v.value
+	}
+	line["_aws"] = map[string]any{
+		"Timestamp": at.UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  c.cfg.Namespace,
+			"Dimensions": [][]string{names},
+			"Metrics":    metrics,
+		}},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := json.NewEncoder(c.out).Encode(line); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// flush - sends the statistics gathered since the last flush with PutMetricData.
+func (c *cloudWatch) flush(ctx context.Context) error {
+	c.mu.Lock()
+	gathered := c.series
+	c.series = map[string]*series{}
+	c.mu.Unlock()
+
+	now := aws.Time(time.Now())
+	var data []types.MetricDatum
+	for _, s := range gathered {
+		for _, name := range s.names {
+			data = append(data, types.MetricDatum{
+				MetricName:      aws.String(name),
+				Dimensions:      s.dimensions,
+				StatisticValues: s.stats[name],
+				Unit:            metricUnit(name),
+				Timestamp:       now,
+			})
+		}
+	}
+	for len(data) > 0 {
+		n := min(len(data), maxMetricData)
+		_, err := c.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(c.cfg.Namespace),
+			MetricData: data[:n],
+		})
+		if err != nil {
+			return fmt.Errorf("Error sending metrics to CloudWatch: %v", err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Start - sends the gathered statistics every interval, until ctx is done; EMF lines are written as they come.
+func (c *cloudWatch) Start(ctx context.Context) {
+	if c == nil || c.client == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.cfg.Interval.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.flush(ctx); err != nil {
+					log.Print(err.Error())
+				}
+			}
+		}
+	}()
+}
+
+/*
+handler - counts the requests next serves under their method and route in router, with their latency and how many
+failed. Routes are named without their patterns, as for schemas, and requests that match none are counted under
+"unmatched".
+*/
+func (c *cloudWatch) handler(router *mux.Router, next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.MatchErr == nil && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = routeKey(template)
+			}
+		}
+		method := r.Method
+		if !metricMethods[method] {
+			method = "OTHER"
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		c.record(
+			[]types.Dimension{{Name: aws.String("Method"), Value: aws.String(method)}, {Name: aws.String("Route"), Value: aws.String(route)}},
+			[]metricValue{
+				{"Requests", 1},
+				{"Latency", float64(time.Since(start).Microseconds()) / 1000},
+				{"ClientErrors", oneIf(rec.status >= 400 && rec.status < 500)},
+				{"ServerErrors", oneIf(rec.status >= 500)},
+			},
+		)
+	})
+}
+
+/*
+recordCall - a datastore.Interceptor that counts backend calls under their method, with their latency and how many
+failed. Not found and conflicts are answers rather than failures, so only the errors that make a 5xx count.
+*/
+func (c *cloudWatch) recordCall(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	err := call(ctx)
+	c.record(
+		[]types.Dimension{{Name: aws.String("Operation"), Value: aws.String(method)}},
+		[]metricValue{
+			{"Calls", 1},
+			{"Latency", float64(time.Since(start).Microseconds()) / 1000},
+			{"Errors", oneIf(err != nil && storeStatus(err) >= http.StatusInternalServerError)},
+		},
+	)
+	return err
+}
+
+// oneIf - 1 if b, else 0, for counting.
+func oneIf(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
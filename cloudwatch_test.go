@@ -0,0 +1,97 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/gorilla/mux"
+)
+
+// emfLines - the EMF lines in out, decoded.
+func emfLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("Metrics aren't JSON lines: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestEMFCountsRequestsByRoute(t *testing.T) {
+	var out bytes.Buffer
+	metrics, err := newCloudWatch(context.Background(), config.Metrics{
+		Output: config.MetricsEMF, Namespace: "Test", Dimensions: map[string]string{"Stage": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.out = &out
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/product/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods(http.MethodGet)
+	h := metrics.handler(router, router)
+	do(h, "GET", "/v1/product/7", "")
+	do(h, "GET", "/nowhere", "")
+
+	lines := emfLines(t, &out)
+	if len(lines) != 2 {
+		t.Fatalf("Got %v lines: %v", len(lines), lines)
+	}
+	first := lines[0]
+	if first["Route"] != "/v1/product/{id}" || first["Method"] != "GET" || first["Stage"] != "test" ||
+		first["Requests"] != 1.0 || first["ClientErrors"] != 1.0 || first["ServerErrors"] != 0.0 {
+		t.Errorf("Got %v", first)
+	}
+	directive := first["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	if directive["Namespace"] != "Test" {
+		t.Errorf("Got namespace %v", directive["Namespace"])
+	}
+	if dims, _ := json.Marshal(directive["Dimensions"]); string(dims) != `[["Stage","Method","Route"]]` {
+		t.Errorf("Got dimensions %s", dims)
+	}
+	if lines[1]["Route"] != "unmatched" {
+		t.Errorf("Got route %v for an unmatched request", lines[1]["Route"])
+	}
+}
+
+func TestPutMetricDataGathersCallStatistics(t *testing.T) {
+	metrics := &cloudWatch{cfg: config.Metrics{Namespace: "Test"}, client: &cloudwatch.Client{}, series: map[string]*series{}}
+	store := datastore.Intercept(failing(fixtureStore(t), map[string]error{"GetAll": datastore.ErrUnavailable}), metrics.recordCall)
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2", "99"} {
+		store.GetProduct(ctx, &datastore.Product{Id: id})
+	}
+	store.GetAll(ctx)
+
+	stats := map[string]map[string]float64{}
+	for _, s := range metrics.series {
+		stats[*s.dimensions[0].Value] = map[string]float64{
+			"samples": *s.stats["Calls"].SampleCount, "calls": *s.stats["Calls"].Sum, "errors": *s.stats["Errors"].Sum,
+		}
+	}
+	// The missing Product is an answer, not a failure.
+	if got := stats["GetProduct"]; got["samples"] != 3 || got["calls"] != 3 || got["errors"] != 0 {
+		t.Errorf("Got GetProduct %v", got)
+	}
+	if got := stats["GetAll"]; got["calls"] != 1 || got["errors"] != 1 {
+		t.Errorf("Got GetAll %v", got)
+	}
+}
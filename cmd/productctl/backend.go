@@ -0,0 +1,81 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/bamajap/go-basic-api-app/client"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+backend - the operations productctl performs, either directly against the datastore or through the HTTP API.
+*/
+type backend interface {
+	List(ctx context.Context, query url.Values) ([]datastore.Product, error)
+	Get(ctx context.Context, id string) (datastore.Product, error)
+	Create(ctx context.Context, p datastore.Product) (datastore.Product, error)
+	Delete(ctx context.Context, id string) error
+}
+
+/*
+directBackend - talks to the datastore in-process, the same way the API's handlers do.
+*/
+type directBackend struct {
+	store datastore.Datastore
+}
+
+func (b directBackend) List(ctx context.Context, query url.Values) ([]datastore.Product, error) {
+	switch {
+	case query.Get("name") != "":
+		return b.store.FindByName(ctx, query.Get("name"))
+	case query.Get("name_prefix") != "":
+		return b.store.SearchByPrefix(ctx, query.Get("name_prefix"))
+	}
+	return b.store.GetAll(ctx)
+}
+
+func (b directBackend) Get(ctx context.Context, id string) (datastore.Product, error) {
+	p := datastore.Product{Id: id}
+	err := b.store.GetProduct(ctx, &p)
+	return p, err
+}
+
+func (b directBackend) Create(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	id, err := b.store.NextID(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Id = id
+	return p, b.store.AddProduct(ctx, p)
+}
+
+func (b directBackend) Delete(ctx context.Context, id string) error {
+	return b.store.DeleteProduct(ctx, datastore.Product{Id: id})
+}
+
+/*
+apiBackend - talks to a running server over its HTTP API, e.g. http://localhost:8000/v1.
+*/
+type apiBackend struct {
+	client *client.ProductsClient
+}
+
+func (b apiBackend) List(ctx context.Context, query url.Values) ([]datastore.Product, error) {
+	return b.client.List(ctx, client.ListOptions{Name: query.Get("name"), NamePrefix: query.Get("name_prefix")})
+}
+
+func (b apiBackend) Get(ctx context.Context, id string) (datastore.Product, error) {
+	return b.client.Get(ctx, id)
+}
+
+func (b apiBackend) Create(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	return b.client.Create(ctx, p)
+}
+
+func (b apiBackend) Delete(ctx context.Context, id string) error {
+	return b.client.Delete(ctx, id)
+}
@@ -0,0 +1,223 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/spf13/cobra"
+)
+
+/*
+fakeCategory - a kind of product the generator makes: the words its names are built from, and the range its prices
+fall in, in cents.
+*/
+type fakeCategory struct {
+	name       string
+	adjectives []string
+	nouns      []string
+	sizes      []string
+	minPrice   int
+	maxPrice   int
+}
+
+// fakeCategories - what a generated catalog stocks, loosely modelled on a grocery store.
+var fakeCategories = []fakeCategory{
+	{
+		name:       "Produce",
+		adjectives: []string{"Organic", "Fresh", "Local", "Ripe", "Baby", "Heirloom"},
+		nouns:      []string{"Apples", "Oranges", "Bananas", "Pears", "Carrots", "Tomatoes", "Spinach", "Avocados", "Grapes", "Peppers"},
+		sizes:      []string{"", "500g", "1kg", "Bunch", "Bag"},
+		minPrice:   49,
+		maxPrice:   699,
+	},
+	{
+		name:       "Bakery",
+		adjectives: []string{"Sourdough", "Wholegrain", "Rye", "Seeded", "Gluten-Free", "Brioche"},
+		nouns:      []string{"Loaf", "Rolls", "Bagels", "Baguette", "Muffins", "Croissants", "Wraps"},
+		sizes:      []string{"", "4 Pack", "6 Pack", "Large"},
+		minPrice:   99,
+		maxPrice:   549,
+	},
+	{
+		name:       "Dairy",
+		adjectives: []string{"Whole", "Semi-Skimmed", "Greek", "Mature", "Salted", "Oat"},
+		nouns:      []string{"Milk", "Yogurt", "Cheddar", "Butter", "Cream", "Mozzarella"},
+		sizes:      []string{"", "250g", "500ml", "1l", "2l"},
+		minPrice:   79,
+		maxPrice:   899,
+	},
+	{
+		name:       "Pantry",
+		adjectives: []string{"Basmati", "Extra Virgin", "Wholewheat", "Smoked", "Roasted", "Crunchy"},
+		nouns:      []string{"Rice", "Olive Oil", "Pasta", "Paprika", "Coffee Beans", "Peanut Butter", "Honey", "Oats"},
+		sizes:      []string{"", "250g", "500g", "1kg", "750ml"},
+		minPrice:   129,
+		maxPrice:   1599,
+	},
+	{
+		name:       "Household",
+		adjectives: []string{"Eco", "Lemon", "Unscented", "Heavy-Duty", "Recycled", "Lavender"},
+		nouns:      []string{"Dish Soap", "Paper Towels", "Laundry Detergent", "Sponges", "Bin Bags", "Surface Spray"},
+		sizes:      []string{"", "2 Pack", "10 Pack", "1l", "Refill"},
+		minPrice:   199,
+		maxPrice:   2499,
+	},
+}
+
+/*
+fakeCatalog - makes random but plausible Products. The same seed always makes the same Products, in the same order.
+*/
+type fakeCatalog struct {
+	rand     *rand.Rand
+	barcodes map[string]bool
+}
+
+func newFakeCatalog(seed int64) *fakeCatalog {
+	return &fakeCatalog{rand: rand.New(rand.NewSource(seed)), barcodes: map[string]bool{}}
+}
+
+/*
+Product - a new Product, without an ID: a name built from a random category's words, a price in that category's range,
+and a barcode that no other Product from this generator has.
+*/
+func (f *fakeCatalog) Product() (datastore.Product, string) {
+	c := fakeCategories[f.rand.Intn(len(fakeCategories))]
+	name := f.pick(c.adjectives) + " " + f.pick(c.nouns)
+	if size := f.pick(c.sizes); size != "" {
+		name += " " + size
+	}
+	cents := c.minPrice + f.rand.Intn(c.maxPrice-c.minPrice+1)
+	// Shop prices mostly end in 9.
+	cents = cents - cents%10 + 9
+	return datastore.Product{
+		Name:    name,
+		Price:   datastore.Money(cents) * 100,
+		Barcode: f.barcode(),
+	}, c.name
+}
+
+// pick - local helper function that chooses one of words.
+func (f *fakeCatalog) pick(words []string) string {
+	return words[f.rand.Intn(len(words))]
+}
+
+/*
+barcode - local helper function that makes an unused EAN-13. They start with 2, which GS1 leaves for numbers used
+only within a store, so none of them is a real product's barcode.
+*/
+func (f *fakeCatalog) barcode() string {
+	for {
+		code := "2"
+		for len(code) < 12 {
+			code += strconv.Itoa(f.rand.Intn(10))
+		}
+		sum := 0
+		for i := range code {
+			d := int(code[i] - '0')
+			// From the right, the digits before the check digit are weighted 3, 1, 3, 1, ...
+			if (len(code)-i)%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		code += strconv.Itoa((10 - sum%10) % 10)
+		if !f.barcodes[code] {
+			f.barcodes[code] = true
+			return code
+		}
+	}
+}
+
+func generateCmd() *cobra.Command {
+	var count, concurrency int
+	var seed int64
+	cmd := &cobra.Command{
+		Use:   "generate --count N",
+		Short: "Create random but realistic products, for demos and load testing",
+		Long: `Creates --count products with realistic names, prices and barcodes, drawn from a handful of grocery
+categories. The products are made from --seed, so a given seed always makes the same ones; without it a seed is
+picked at random and printed, so the catalog can be made again.
+
+Barcodes are unique within one run but not across runs, so generating with the same seed again into the same
+catalog fails with a conflict. Delete the products first (e.g. with DELETE /admin/products) or use another seed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count < 1 {
+				return fmt.Errorf("--count must be at least 1")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if !cmd.Flags().Changed("seed") {
+				seed = time.Now().UnixNano()
+			}
+			b, err := open()
+			if err != nil {
+				return err
+			}
+
+			// Everything is made up front, so the products don't depend on the order the workers create them in.
+			fake := newFakeCatalog(seed)
+			products := make([]datastore.Product, count)
+			perCategory := map[string]int{}
+			for i := range products {
+				var category string
+				products[i], category = fake.Product()
+				perCategory[category]++
+			}
+
+			// The first failure stops the other workers.
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			var next int64 = -1
+			var failed error
+			var once sync.Once
+			var wg sync.WaitGroup
+			for w := 0; w < concurrency; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := atomic.AddInt64(&next, 1); i < int64(len(products)) && ctx.Err() == nil; i = atomic.AddInt64(&next, 1) {
+						if _, err := b.Create(ctx, products[i]); err != nil {
+							once.Do(func() {
+								failed = fmt.Errorf("Error creating %q: %v", products[i].Name, err)
+								cancel()
+							})
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			if failed != nil {
+				return failed
+			}
+			if err := cmd.Context().Err(); err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Created %v products with seed %v\n", count, seed)
+			for _, c := range fakeCategories {
+				if n := perCategory[c.name]; n > 0 {
+					fmt.Fprintf(out, "  %v: %v\n", c.name, n)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&count, "count", "n", 100, "how many products to create")
+	cmd.Flags().Int64Var(&seed, "seed", 0, "seed for the random products; the same seed makes the same products")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "how many products to create at once")
+	return cmd
+}
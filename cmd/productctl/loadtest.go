@@ -0,0 +1,411 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Load test operations, in the order they're reported.
+const (
+	opList   = "list"
+	opGet    = "get"
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+var loadOps = []string{opList, opGet, opCreate, opUpdate, opDelete}
+
+func loadtestCmd() *cobra.Command {
+	var duration time.Duration
+	var concurrency, requests int
+	var rate float64
+	var mix string
+	var keep bool
+	cmd := &cobra.Command{
+		Use:   "loadtest --api URL",
+		Short: "Send a mix of requests to a running server and report latency percentiles and error rates",
+		Long: `Sends a weighted mix of list (GET /products), get (GET /product/{id}), create (POST), update (PUT) and
+delete (DELETE) requests from several concurrent workers, for a set time or number of requests, then reports each
+operation's latency percentiles and error rate.
+
+Updates and deletes only touch products the load test created itself (a create is sent instead until there are
+some), and the ones still left are deleted at the end unless --keep is given, so it's safe to point at a catalog
+with real data. Requests aren't retried, so every error the server returns is counted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if apiURL == "" {
+				return fmt.Errorf("%v needs a running server's --api URL", cmd.CommandPath())
+			}
+			weights, err := parseMix(mix)
+			if err != nil {
+				return err
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+
+			c := client.New(apiURL)
+			c.Tenant = tenant
+			c.MaxRetries = 0
+			c.HTTPClient = &http.Client{
+				Timeout:   30 * time.Second,
+				Transport: &http.Transport{MaxIdleConnsPerHost: concurrency},
+			}
+			t := &loadTest{client: c, weights: weights, requests: int64(requests)}
+			if err := t.prepare(cmd.Context()); err != nil {
+				return err
+			}
+
+			stop := cmd.Context()
+			if duration > 0 {
+				var cancel context.CancelFunc
+				stop, cancel = context.WithTimeout(stop, duration)
+				defer cancel()
+			}
+			if rate > 0 {
+				t.ticks = time.NewTicker(time.Duration(float64(time.Second) / rate)).C
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Sending requests to %v from %v workers...\n", apiURL, concurrency)
+			elapsed := t.run(stop, cmd.Context(), concurrency)
+
+			if !keep {
+				t.cleanup(cmd.Context(), cmd.ErrOrStderr())
+			}
+			return t.report(cmd.OutOrStdout(), elapsed)
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "duration", 30*time.Second, "how long to send requests for (0 for no limit)")
+	cmd.Flags().IntVar(&requests, "requests", 0, "stop after this many requests (0 for no limit)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 10, "how many requests are in flight at once")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "the most requests to send per second, across all workers (0 for as fast as possible)")
+	cmd.Flags().StringVar(&mix, "mix", "list=10,get=60,create=10,update=10,delete=10", "the relative weight of each operation")
+	cmd.Flags().BoolVar(&keep, "keep", false, "keep the products the load test created")
+	return cmd
+}
+
+// parseMix - the weights in a mix such as "get=80,create=20"; operations that aren't named aren't sent.
+func parseMix(mix string) (map[string]int, error) {
+	weights := map[string]int{}
+	total := 0
+	for _, part := range strings.Split(mix, ",") {
+		op, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.Atoi(weight)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid --mix entry %q; use operation=weight, e.g. get=60", part)
+		}
+		known := false
+		for _, o := range loadOps {
+			known = known || o == op
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown --mix operation %q; use %v", op, strings.Join(loadOps, ", "))
+		}
+		weights[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("The --mix weights add up to 0")
+	}
+	return weights, nil
+}
+
+/*
+loadTest - the state shared by the workers: the products there are to read, the ones the test created (which are
+the only ones it changes), and the latencies and errors seen.
+*/
+type loadTest struct {
+	client   *client.ProductsClient
+	weights  map[string]int
+	requests int64
+	// ticks - paces the workers when there's a --rate; nil otherwise.
+	ticks <-chan time.Time
+
+	sent    atomic.Int64
+	created atomic.Int64
+
+	mu   sync.Mutex
+	ids  []string
+	ours []string
+	// reading - how many gets of each product are in flight; a product isn't deleted while it's being read.
+	reading map[string]int
+	results map[string]*opResults
+}
+
+// opResults - what happened to one operation's requests.
+type opResults struct {
+	latencies []time.Duration
+	// errors - counts by status code, or "network" for requests that got no response.
+	errors map[string]int
+}
+
+// prepare - reads the catalog, so that gets have existing products to ask for.
+func (t *loadTest) prepare(ctx context.Context) error {
+	products, err := t.client.List(ctx, client.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("Error reading the catalog before the load test: %v", err)
+	}
+	for _, p := range products {
+		t.ids = append(t.ids, p.Id)
+	}
+	t.reading = map[string]int{}
+	t.results = map[string]*opResults{}
+	for _, op := range loadOps {
+		t.results[op] = &opResults{errors: map[string]int{}}
+	}
+	return nil
+}
+
+/*
+run - sends requests from concurrency workers until stop is done or the request limit is reached. Requests are made
+with ctx rather than stop, so those in flight at the end finish (and the products they create can be cleaned up).
+*/
+func (t *loadTest) run(stop, ctx context.Context, concurrency int) time.Duration {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t.requests == 0 || t.sent.Add(1) <= t.requests {
+				if t.ticks != nil {
+					select {
+					case <-t.ticks:
+					case <-stop.Done():
+						return
+					}
+				}
+				if stop.Err() != nil {
+					return
+				}
+				t.send(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+// pick - a random operation, by weight.
+func (t *loadTest) pick() string {
+	total := 0
+	for _, w := range t.weights {
+		total += w
+	}
+	n := rand.Intn(total)
+	for _, op := range loadOps {
+		if n < t.weights[op] {
+			return op
+		}
+		n -= t.weights[op]
+	}
+	return opGet
+}
+
+// read - a random product ID to get, marked as being read until done is called; "" if there are none.
+func (t *loadTest) read() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.ids) == 0 {
+		return ""
+	}
+	id := t.ids[rand.Intn(len(t.ids))]
+	t.reading[id]++
+	return id
+}
+
+// done - marks the end of a get.
+func (t *loadTest) done(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.reading[id]--; t.reading[id] == 0 {
+		delete(t.reading, id)
+	}
+}
+
+/*
+take - takes a random product of ours out of the pool while it's updated or deleted, so that no other worker changes
+it at the same time. One to delete must not be being read, and stops being handed out for gets. "" if none are free.
+*/
+func (t *loadTest) take(deleting bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.ours) == 0 {
+		return ""
+	}
+	i, start := 0, rand.Intn(len(t.ours))
+	for ; i < len(t.ours); i++ {
+		if !deleting || t.reading[t.ours[(start+i)%len(t.ours)]] == 0 {
+			break
+		}
+	}
+	if i == len(t.ours) {
+		return ""
+	}
+	i = (start + i) % len(t.ours)
+	id := t.ours[i]
+	t.ours[i] = t.ours[len(t.ours)-1]
+	t.ours = t.ours[:len(t.ours)-1]
+	if deleting {
+		for j, other := range t.ids {
+			if other == id {
+				t.ids = append(t.ids[:j], t.ids[j+1:]...)
+				break
+			}
+		}
+	}
+	return id
+}
+
+// release - puts a product taken for an update (or a failed delete) back in the pool.
+func (t *loadTest) release(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ours = append(t.ours, id)
+}
+
+// send - sends one request and records how it went.
+func (t *loadTest) send(ctx context.Context) {
+	op := t.pick()
+	id := ""
+	switch op {
+	case opGet:
+		id = t.read()
+	case opUpdate, opDelete:
+		id = t.take(op == opDelete)
+	}
+	if id == "" && op != opList {
+		op = opCreate
+	}
+
+	var err error
+	start := time.Now()
+	switch op {
+	case opList:
+		_, err = t.client.List(ctx, client.ListOptions{})
+	case opGet:
+		_, err = t.client.Get(ctx, id)
+		t.done(id)
+	case opCreate:
+		var p client.Product
+		n := t.created.Add(1)
+		p, err = t.client.Create(ctx, client.Product{Name: fmt.Sprintf("loadtest %v", n), Price: randomPrice()})
+		if err == nil {
+			t.mu.Lock()
+			t.ids = append(t.ids, p.Id)
+			t.ours = append(t.ours, p.Id)
+			t.mu.Unlock()
+		}
+	case opUpdate:
+		_, err = t.client.Update(ctx, client.Product{Id: id, Name: "loadtest " + id, Price: randomPrice()})
+		t.release(id)
+	case opDelete:
+		if err = t.client.Delete(ctx, id); err != nil && !errors.Is(err, client.ErrNotFound) {
+			t.release(id)
+		}
+	}
+	latency := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.results[op]
+	r.latencies = append(r.latencies, latency)
+	if err != nil {
+		kind := "network"
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			kind = strconv.Itoa(apiErr.StatusCode)
+		}
+		r.errors[kind]++
+	}
+}
+
+// randomPrice - a price for a created or updated product, in cents.
+func randomPrice() client.Money {
+	return client.Money(rand.Intn(10000)+1) * 100
+}
+
+// cleanup - deletes the products the test created that are still there.
+func (t *loadTest) cleanup(ctx context.Context, log io.Writer) {
+	for _, id := range t.ours {
+		if err := t.client.Delete(ctx, id); err != nil && !errors.Is(err, client.ErrNotFound) {
+			fmt.Fprintf(log, "Error deleting load test product %v: %v\n", id, err)
+		}
+	}
+}
+
+// report - writes each operation's request count, error rate and latency percentiles, then the totals.
+func (t *loadTest) report(out io.Writer, elapsed time.Duration) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tREQUESTS\tERRORS\tERROR RATE\tP50\tP90\tP99\tMAX")
+
+	total := &opResults{errors: map[string]int{}}
+	row := func(name string, r *opResults) {
+		errs := 0
+		for _, n := range r.errors {
+			errs += n
+		}
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.2f%%\t%v\t%v\t%v\t%v\n", name, len(r.latencies), errs,
+			100*float64(errs)/math.Max(float64(len(r.latencies)), 1), percentile(r.latencies, 0.5),
+			percentile(r.latencies, 0.9), percentile(r.latencies, 0.99), percentile(r.latencies, 1))
+	}
+	for _, op := range loadOps {
+		r := t.results[op]
+		if len(r.latencies) == 0 {
+			continue
+		}
+		row(op, r)
+		total.latencies = append(total.latencies, r.latencies...)
+		for kind, n := range r.errors {
+			total.errors[kind] += n
+		}
+	}
+	row("total", total)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%v requests in %v (%.1f/s)\n", len(total.latencies), elapsed.Round(time.Millisecond),
+		float64(len(total.latencies))/elapsed.Seconds())
+	kinds := make([]string, 0, len(total.errors))
+	for kind := range total.errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "Errors %v: %v\n", kind, total.errors[kind])
+	}
+	return nil
+}
+
+// percentile - the latency below which the fraction p of the (sorted) latencies fall.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(10 * time.Microsecond)
+}
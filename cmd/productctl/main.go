@@ -0,0 +1,374 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Command productctl - operations tool for the products catalog.
+
+By default it works directly against DynamoDB using the app's config file; with --api it goes through a running
+server's HTTP API instead. Table management and seeding are only available directly.
+*/
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bamajap/go-basic-api-app/client"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/dynamodb"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath string
+	apiURL     string
+	tenant     string
+	cfg        config.Config
+)
+
+// open - the backend selected by the global flags.
+func open() (backend, error) {
+	if apiURL != "" {
+		c := client.New(apiURL)
+		c.Tenant = tenant
+		return apiBackend{client: c}, nil
+	}
+	if err := dynamodb.Connect(cfg); err != nil {
+		return nil, err
+	}
+	return directBackend{store: &dynamodb.Items}, nil
+}
+
+// direct - connects to DynamoDB for the commands that can't go through the API.
+func direct(cmd *cobra.Command) error {
+	if apiURL != "" {
+		return fmt.Errorf("%v works directly against DynamoDB and can't be used with --api", cmd.CommandPath())
+	}
+	return dynamodb.Connect(cfg)
+}
+
+func main() {
+	root := &cobra.Command{
+		Use:           "productctl",
+		Short:         "Manage the products catalog",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if cfg, err = config.Load(configPath); err != nil {
+				return err
+			}
+			if datastore.Strategy, err = datastore.ParseIDStrategy(cfg.IDStrategy); err != nil {
+				return err
+			}
+			if tenant != "" && !datastore.ValidTenant(tenant) {
+				return fmt.Errorf("Invalid tenant name %q", tenant)
+			}
+			cmd.SetContext(datastore.WithTenant(cmd.Context(), tenant))
+			return nil
+		},
+	}
+	root.PersistentFlags().StringVar(&configPath, "config", "", "path to the app's JSON config file")
+	root.PersistentFlags().StringVar(&apiURL, "api", "", "use a running server's API (e.g. http://localhost:8000/v1) instead of DynamoDB")
+	root.PersistentFlags().StringVar(&tenant, "tenant", "", "the tenant to work on, when multi-tenancy is enabled")
+
+	root.AddCommand(listCmd(), getCmd(), createCmd(), deleteCmd(), seedCmd(), tableCmd(), exportCmd(), backupCmd(), restoreCmd(), loadtestCmd(), generateCmd())
+
+	if err := root.ExecuteContext(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func listCmd() *cobra.Command {
+	var name, prefix string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List products, in price-descending order",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			products, err := b.List(cmd.Context(), listQuery(name, prefix))
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tPRICE")
+			for _, p := range products {
+				fmt.Fprintf(w, "%v\t%v\t%v\n", p.Id, p.Name, p.Price)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "only products with this name (case-insensitive)")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "only products whose name starts with this (case-insensitive)")
+	return cmd
+}
+
+func getCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show a single product as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			p, err := b.Get(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), p)
+		},
+	}
+}
+
+func createCmd() *cobra.Command {
+	var name string
+	var price string
+	cmd := &cobra.Command{
+		Use:   "create --name NAME --price PRICE",
+		Short: "Create a product and print it, with its assigned ID",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amount, err := datastore.ParseMoney(price)
+			if err != nil {
+				return err
+			}
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			p, err := b.Create(cmd.Context(), datastore.Product{Name: name, Price: amount})
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), p)
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "product name")
+	cmd.Flags().StringVar(&price, "price", "", "product price, e.g. 0.98")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("price")
+	return cmd
+}
+
+func deleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete ID...",
+		Short: "Delete products",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				if err := b.Delete(cmd.Context(), id); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted %v\n", id)
+			}
+			return nil
+		},
+	}
+}
+
+func seedCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "seed",
+		Short: "Write the seed products from the config (replacing any with the same IDs)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := direct(cmd); err != nil {
+				return err
+			}
+			return dynamodb.Seed(cmd.Context(), cfg)
+		},
+	}
+}
+
+func tableCmd() *cobra.Command {
+	table := &cobra.Command{
+		Use:   "table",
+		Short: "Create or drop the DynamoDB tables",
+	}
+	table.AddCommand(&cobra.Command{
+		Use:   "create",
+		Short: "Create the tables (empty) and wait until they are active",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := direct(cmd); err != nil {
+				return err
+			}
+			return dynamodb.CreateTables(cmd.Context(), cfg)
+		},
+	})
+
+	var yes bool
+	drop := &cobra.Command{
+		Use:   "drop --yes",
+		Short: "Delete the tables and every product in them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				return fmt.Errorf("Dropping the tables deletes all data; pass --yes to confirm")
+			}
+			if err := direct(cmd); err != nil {
+				return err
+			}
+			return dynamodb.DropTables(cmd.Context())
+		},
+	}
+	drop.Flags().BoolVar(&yes, "yes", false, "confirm deleting the tables")
+	table.AddCommand(drop)
+	return table
+}
+
+func exportCmd() *cobra.Command {
+	var format, output, name, prefix string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export products as CSV or JSON",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("Unknown export format %q; use csv or json", format)
+			}
+			b, err := open()
+			if err != nil {
+				return err
+			}
+			products, err := b.List(cmd.Context(), listQuery(name, prefix))
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+
+			if format == "json" {
+				return printJSON(out, products)
+			}
+			w := csv.NewWriter(out)
+			w.Write([]string{"id", "name", "price"})
+			for _, p := range products {
+				w.Write([]string{p.Id, p.Name, p.Price.String()})
+			}
+			w.Flush()
+			return w.Error()
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "csv", "csv or json")
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "file to write (- for stdout)")
+	cmd.Flags().StringVar(&name, "name", "", "only products with this name (case-insensitive)")
+	cmd.Flags().StringVar(&prefix, "prefix", "", "only products whose name starts with this (case-insensitive)")
+	return cmd
+}
+
+func backupCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Write every product to a JSON snapshot",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := direct(cmd); err != nil {
+				return err
+			}
+			snap, err := datastore.TakeSnapshot(cmd.Context(), &dynamodb.Items)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return printJSON(out, snap)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "file to write (- for stdout)")
+	return cmd
+}
+
+func restoreCmd() *cobra.Command {
+	var replace bool
+	cmd := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Load a JSON snapshot, keeping its product IDs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var snap datastore.Snapshot
+			if err := json.NewDecoder(f).Decode(&snap); err != nil {
+				return fmt.Errorf("Error reading snapshot %v: %v", args[0], err)
+			}
+			if err := snap.Validate(); err != nil {
+				return err
+			}
+
+			if err := direct(cmd); err != nil {
+				return err
+			}
+			result, err := datastore.Restore(cmd.Context(), &dynamodb.Items, snap, replace)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %v, updated %v, deleted %v\n", result.Created, result.Updated, result.Deleted)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&replace, "replace", false, "delete products that aren't in the snapshot")
+	return cmd
+}
+
+// listQuery - the listing filters, in the API's query parameter form.
+func listQuery(name, prefix string) url.Values {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	if prefix != "" {
+		query.Set("name_prefix", prefix)
+	}
+	return query
+}
+
+// printJSON - writes v as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,69 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+/*
+decompressBody - decompresses request bodies sent with Content-Encoding: gzip before anything reads them, so
+handlers decode them as if they'd been sent plain. Any other encoding gets 415 Unsupported Media Type, with an
+Accept-Encoding header saying gzip is accepted. A small compressed body can inflate enormously, so the decompressed
+body is limited to the size of the largest request that's read whole, a restore, unless it's NDJSON, which is
+read a line at a time.
+*/
+func decompressBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+		default:
+			w.Header().Set("Accept-Encoding", "gzip")
+			writeError(w, r, http.StatusUnsupportedMediaType, i18n.Errorf("unsupported_encoding", "Unsupported Content-Encoding %q; send the body uncompressed or gzipped", encoding))
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("Error decompressing the request body: %v", err))
+			return
+		}
+		limit := int64(maxSnapshotBytes)
+		if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media == mediaNDJSON {
+			limit = maxStreamedImportBytes
+		}
+
+		r = r.Clone(r.Context())
+		r.Body = http.MaxBytesReader(w, gzipBody{zr, r.Body}, limit)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gzipBody - a decompressed request body; closing it closes the compressed one too.
+type gzipBody struct {
+	*gzip.Reader
+	compressed io.Closer
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.compressed.Close()
+}
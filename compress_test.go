@@ -0,0 +1,55 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+// gzipped - body, compressed.
+func gzipped(body string) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(body))
+	zw.Close()
+	return b.Bytes()
+}
+
+func TestGzippedBodies(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		path        string
+		contentType string
+		encoding    string
+		body        []byte
+		status      int
+		code        string
+	}{
+		{"create", "/v1/product", "application/json", "gzip", gzipped(`{"name": "Pear", "price": 1.5}`), http.StatusCreated, ""},
+		{"schema still checked", "/v1/product", "application/json", "gzip", gzipped(`{"name": "Pear", "price": "cheap"}`), http.StatusBadRequest, "validation_failed"},
+		{"import", "/v1/products/import", "text/csv", "gzip", gzipped("name,price\nPear,1.5\n"), http.StatusOK, ""},
+		{"NDJSON import", "/v1/products/import", mediaNDJSON, "gzip", gzipped(`{"name": "Pear", "price": 1.5}` + "\n"), http.StatusOK, ""},
+		{"not gzip", "/v1/product", "application/json", "gzip", []byte(`{"name": "Pear", "price": 1.5}`), http.StatusBadRequest, "validation_failed"},
+		{"other encoding", "/v1/product", "application/json", "br", []byte("..."), http.StatusUnsupportedMediaType, "unsupported_encoding"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", c.path, bytes.NewReader(c.body))
+			r.Header.Set("Content-Type", c.contentType)
+			r.Header.Set("Content-Encoding", c.encoding)
+			w := record(testServer(t, config.Default(), fixtureStore(t)), r)
+			if w.Code != c.status || errorCode(w) != c.code {
+				t.Fatalf("Got status %v, code %q; body %s", w.Code, errorCode(w), w.Body)
+			}
+			if c.status == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Encoding") != "gzip" {
+				t.Fatalf("Got Accept-Encoding %q", w.Header().Get("Accept-Encoding"))
+			}
+		})
+	}
+}
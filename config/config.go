@@ -0,0 +1,1173 @@
+/*
+Author: Jason Payne
+*/
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+Config - runtime settings for the app. Every field is optional; missing values fall back to Default().
+*/
+type Config struct {
+	// IDStrategy - "int" for sequential Product IDs or "uuid" for random, non-enumerable ones.
+	IDStrategy string `json:"id_strategy"`
+
+	// LegacyRoutes - what the old unversioned paths do: LegacyRedirect (default) or LegacyGone.
+	LegacyRoutes string `json:"legacy_routes"`
+
+	// PutPolicy - what PUT does to a Product that doesn't exist: PutUpdate (default) responds 404, PutUpsert creates
+	// it with the ID in the path.
+	PutPolicy string `json:"put_policy"`
+
+	// Strict - enables the corrected API behavior (problem+json errors, new response fields/envelopes, stricter
+	// status codes). On by default; existing integrations can set it to false while they migrate.
+	Strict bool `json:"strict"`
+
+	// UniqueNames - rejects a create or update that would give a Product the same name (ignoring case) as another
+	// live Product, with 409. Off by default.
+	UniqueNames bool `json:"unique_names"`
+
+	// StrictJSON - rejects a JSON request body with a field the API doesn't know, such as a misspelt "pricee", with
+	// 400, rather than ignoring it. Off by default, since clients may send back fields from responses, such as links.
+	StrictJSON bool `json:"strict_json"`
+
+	// DefaultLocale - the locale Products' own names and descriptions are written in; responses use their
+	// translations into the locale a client asks for, and these where there are none. Default "en".
+	DefaultLocale string `json:"default_locale"`
+
+	// DynamoDB - settings for the DynamoDB backend.
+	DynamoDB DynamoDB `json:"dynamodb"`
+
+	// DummyDB - settings for the in-memory backend.
+	DummyDB DummyDB `json:"dummydb"`
+
+	// Cache - the optional in-process read cache in front of the backend.
+	Cache Cache `json:"cache"`
+
+	// ResponseCache - listing and search responses cached in Redis, shared by every instance.
+	ResponseCache ResponseCache `json:"response_cache"`
+
+	// CircuitBreaker - fails datastore calls fast while the backend is down.
+	CircuitBreaker CircuitBreaker `json:"circuit_breaker"`
+
+	// Retry - retries datastore calls that fail with transient errors.
+	Retry Retry `json:"retry"`
+
+	// Server - the HTTP listener.
+	Server Server `json:"server"`
+
+	// Seed - the Products a new, empty store starts with.
+	Seed Seed `json:"seed"`
+
+	// Replay - records the backend's responses to a file, or serves them from one instead of a backend.
+	Replay Replay `json:"replay"`
+
+	// Tenancy - lets several stores share one deployment, each with its own catalog.
+	Tenancy Tenancy `json:"tenancy"`
+
+	// Currency - converting prices into other currencies with ?currency=.
+	Currency Currency `json:"currency"`
+
+	// Cart - shopping carts.
+	Cart Cart `json:"cart"`
+
+	// CacheControl - the Cache-Control headers reads are sent with, so CDNs and proxies can cache them.
+	CacheControl CacheControl `json:"cache_control"`
+
+	// Search - where /products/search is served from.
+	Search Search `json:"search"`
+
+	// Related - how /product/{id}/related chooses similar Products.
+	Related Related `json:"related"`
+
+	// Jobs - the background job queue.
+	Jobs Jobs `json:"jobs"`
+
+	// Alerts - price-drop alert subscriptions.
+	Alerts Alerts `json:"alerts"`
+
+	// Schedule - periodic maintenance tasks.
+	Schedule Schedule `json:"schedule"`
+
+	// ChangeFeed - publishing change events from the backend's change feed.
+	ChangeFeed ChangeFeed `json:"change_feed"`
+
+	// Export - catalog exports to S3, for analytics pipelines and cold backups.
+	Export Export `json:"export"`
+
+	// Metrics - request and backend metrics for CloudWatch.
+	Metrics Metrics `json:"metrics"`
+
+	// Usage - per-client API usage, kept in the backend for capacity planning and billing.
+	Usage Usage `json:"usage"`
+
+	// ErrorReporting - sends server errors and panics to Sentry.
+	ErrorReporting ErrorReporting `json:"error_reporting"`
+
+	// Middleware - the cross-cutting behaviors requests pass through, and their order.
+	Middleware Middleware `json:"middleware"`
+
+	// Schemas - JSON Schema files that request bodies must match, keyed by method and route, e.g.
+	// {"POST /v1/product": "schemas/product.json"}. Path parameters are written without their patterns, as in
+	// "PUT /v1/product/{id}". Bodies are checked before they're decoded; endpoints without a schema aren't checked.
+	Schemas map[string]string `json:"schemas"`
+
+	// The settings below are reloaded while the app runs, when the config file changes or on SIGHUP.
+
+	// LogLevel - which requests are logged: LogInfo (every one), LogWarn (those that failed) or LogError (only
+	// server errors).
+	LogLevel string `json:"log_level"`
+
+	// RateLimit - a limit on the requests the API serves, across all clients.
+	RateLimit RateLimit `json:"rate_limit"`
+
+	// Auth - who may call the API.
+	Auth Auth `json:"auth"`
+
+	// CORS - which web origins may call the API from a browser.
+	CORS CORS `json:"cors"`
+	// CSRF - protection for browsers' state-changing requests against cross-site request forgery.
+	CSRF CSRF `json:"csrf"`
+
+	// Features - switches parts of the API on or off, by flag name, e.g. {"search": false}. FEATURE_<NAME>
+	// environment variables (e.g. FEATURE_SEARCH=false) take precedence.
+	Features map[string]bool `json:"features"`
+
+	// Chaos - fault injection, for testing how clients cope with a slow or failing API. Never enable it in production.
+	Chaos Chaos `json:"chaos"`
+}
+
+const (
+	// LogInfo - every request is logged.
+	LogInfo = "info"
+	// LogWarn - requests that responded 4xx or 5xx are logged.
+	LogWarn = "warn"
+	// LogError - requests that responded 5xx are logged.
+	LogError = "error"
+)
+
+/*
+RateLimit - a token bucket shared by every request to the API (the /admin and /debug endpoints aren't limited).
+Requests over the limit respond 429 with a Retry-After header.
+*/
+type RateLimit struct {
+	// RequestsPerSecond - the sustained rate allowed; zero (the default) disables the limit.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst - how many requests may arrive at once; defaults to one second's worth.
+	Burst int `json:"burst"`
+	// PerIP - a token bucket for each client IP address, so one client can't use up the shared limit.
+	PerIP ClientRateLimit `json:"per_ip"`
+}
+
+/*
+ClientRateLimit - a token bucket for each client, checked before the shared one. Clients are told apart by IP
+address (see Server.TrustedProxies), with IPv6 addresses grouped by /64, since that's what a single host is given.
+*/
+type ClientRateLimit struct {
+	// RequestsPerSecond - the sustained rate each client is allowed; zero (the default) disables the limit.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst - how many requests a client may send at once; defaults to one second's worth.
+	Burst int `json:"burst"`
+	// Redis - the address (host:port) of a Redis server to keep the buckets in, so every instance shares them.
+	// Without it, each instance keeps its own, in memory.
+	Redis string `json:"redis"`
+}
+
+/*
+Auth - authentication of the API's callers, on every /v1, /admin and /catalog request. A request without valid
+credentials responds 401 with a WWW-Authenticate challenge; /healthz and /debug are open.
+*/
+type Auth struct {
+	// Scheme - how callers authenticate: AuthBasic, or "" (the default) for not at all.
+	Scheme string `json:"scheme"`
+	// Basic - the users for AuthBasic.
+	Basic BasicAuth `json:"basic"`
+	// HMAC - server-to-server callers, whose writes must be signed, whatever the scheme.
+	HMAC HMACAuth `json:"hmac"`
+	// AdminToken - a bearer token that authenticates as an admin on /admin, as well as the scheme's credentials. It's
+	// the only way to use the admin endpoints that change or expose who can use the API while no scheme is set.
+	AdminToken string `json:"admin_token"`
+}
+
+// AuthBasic - HTTP Basic authentication, with user names and passwords; only safe over HTTPS.
+const AuthBasic = "basic"
+
+// BasicAuth - the users who may call the API with Basic authentication.
+type BasicAuth struct {
+	// Users - each user's bcrypt password hash, as written by htpasswd -B, e.g. {"ci": "$2y$10$..."}.
+	Users map[string]string `json:"users"`
+	// HtpasswdFile - a file of "user:hash" lines, as written by htpasswd -B, adding to (or overriding) Users.
+	HtpasswdFile string `json:"htpasswd_file"`
+	// Realm - the realm named in the challenge; "products" by default.
+	Realm string `json:"realm"`
+	// Tenants - the tenants each of the users may use while multi-tenancy is enabled, e.g. {"ci": ["acme"]}. A user
+	// who isn't listed may use every tenant.
+	Tenants map[string][]string `json:"tenants"`
+}
+
+/*
+HMACAuth - request signing. Once any clients are configured, every POST, PUT, PATCH and DELETE must be signed by
+one of them with an HMAC-SHA256 of its timestamp, method, path and body, keyed by that client's secret.
+*/
+type HMACAuth struct {
+	// Clients - each client's shared secret, by client ID.
+	Clients map[string]string `json:"clients"`
+	// Window - how far a request's timestamp may be from the server's clock; older requests are refused as replays.
+	Window Duration `json:"window"`
+	// Tenants - the tenants each client may use while multi-tenancy is enabled, as for BasicAuth.
+	Tenants map[string][]string `json:"tenants"`
+}
+
+/*
+CORS - Cross-Origin Resource Sharing settings. Browsers only let pages on the listed origins read API responses.
+*/
+type CORS struct {
+	// AllowedOrigins - e.g. ["https://shop.example.com"]; "*" allows any origin. None (the default) disables CORS.
+	AllowedOrigins []string `json:"allowed_origins"`
+	// MaxAge - how long browsers may cache a preflight response.
+	MaxAge Duration `json:"max_age"`
+}
+
+/*
+CSRF - cross-site request forgery protection. Browsers send credentials (Basic auth, cookies) with every request to
+the API, including those a page on another site makes, so a browser's state-changing requests must also carry a
+token that only pages able to read the API's cookies have. Requests that aren't from a browser are left alone.
+*/
+type CSRF struct {
+	Enabled bool `json:"enabled"`
+	// Secret - signs the tokens. Instances behind one load balancer must share it; empty (the default) signs with a
+	// random secret of the instance's own.
+	Secret string `json:"secret"`
+	// TTL - how long a token is good for.
+	TTL Duration `json:"ttl"`
+}
+
+/*
+Middleware - the middleware chains, each a list of middleware names, outermost first. Leaving a name out disables
+that behavior; the defaults are every middleware the app has, in the order it has always used them.
+*/
+type Middleware struct {
+	// Server - wrapped around every request, whether or not it matches a route: "request_id" (IDs and the request
+	// log), "error_reports", "cors" and "metrics".
+	Server []string `json:"server"`
+	// Router - applied, with mux.Use, to every route: "recovery".
+	Router []string `json:"router"`
+	// API - applied, with mux.Use, to the routes of each API version: "timeout", "faults", "rate_limit", "csrf",
+	// "auth", "signatures", "roles", "tenant", "consistency", "decompress" and "schema". While auth is configured, "auth" and
+	// "roles" can't be left out. The /admin endpoints always authenticate, whatever this says.
+	API []string `json:"api"`
+}
+
+/*
+Chaos - faults injected into API requests and backend calls. Each matching request or call is delayed by the fault's
+latency, then fails at its error rate. None are configured by default.
+*/
+type Chaos struct {
+	// Routes - faults for API requests, keyed by method and route as for Schemas (e.g. "GET /v1/product/{id}"), or
+	// "*" for every request without a fault of its own.
+	Routes map[string]Fault `json:"routes"`
+	// Calls - faults for datastore calls, keyed by method (e.g. "GetAll"), or "*" for every call without a fault of
+	// its own. A failed call returns an unavailable error, as a backend that couldn't be reached would.
+	Calls map[string]Fault `json:"calls"`
+}
+
+// Fault - a delay and error rate to inject.
+type Fault struct {
+	// Latency - added to every matching request or call, plus up to Jitter more, at random.
+	Latency Duration `json:"latency"`
+	Jitter  Duration `json:"jitter"`
+	// ErrorRate - the fraction, from 0 to 1, of matching requests or calls that fail.
+	ErrorRate float64 `json:"error_rate"`
+	// Status - the status a failed request responds with; 503 if unset. Not used for calls.
+	Status int `json:"status"`
+}
+
+/*
+Schedule - when the maintenance tasks run. Each run is queued as a job (one per tenant for per-catalog tasks), so a
+failed run is retried like any other job.
+*/
+type Schedule struct {
+	// Tasks - a cron expression (e.g. "0 3 * * *", or "@hourly") for each task to run, keyed by TaskPurgeExpired,
+	// TaskRefreshRates, TaskSnapshot or TaskExportS3. Tasks that aren't listed don't run.
+	Tasks map[string]string `json:"tasks"`
+	// Timezone - the IANA time zone the expressions are in, e.g. "Europe/London".
+	Timezone string `json:"timezone"`
+	// SnapshotDir - where TaskSnapshot writes catalog snapshots.
+	SnapshotDir string `json:"snapshot_dir"`
+	// SnapshotKeep - how many of each tenant's snapshots are kept; older ones are deleted.
+	SnapshotKeep int `json:"snapshot_keep"`
+}
+
+const (
+	// TaskPurgeExpired - deletes Products whose expiry has passed, which are otherwise kept until DynamoDB's TTL
+	// gets to them (or forever, in memory).
+	TaskPurgeExpired = "purge_expired"
+	// TaskRefreshRates - fetches exchange rates ahead of their TTL, so requests never wait for the provider.
+	TaskRefreshRates = "refresh_rates"
+	// TaskSnapshot - writes a snapshot of the catalog to SnapshotDir, in the admin backup format.
+	TaskSnapshot = "snapshot"
+	// TaskExportS3 - exports the catalog to the Export bucket.
+	TaskExportS3 = "export_s3"
+)
+
+/*
+Export - where catalog exports are written. Each export is one object per format, named
+<prefix>[<tenant>/]products-<time>.<format>, so earlier exports are never overwritten; use a lifecycle rule on the
+bucket to expire old ones.
+*/
+type Export struct {
+	// Bucket - the S3 bucket; setting it enables exports.
+	Bucket string `json:"bucket"`
+	// Prefix - prepended to every object key, e.g. "exports/".
+	Prefix string `json:"prefix"`
+	// Formats - ExportJSON (the admin backup format, which can be restored) and/or ExportCSV; both by default.
+	Formats []string `json:"formats"`
+	// Region - the bucket's AWS region, if it isn't the SDK's default.
+	Region string `json:"region"`
+	// Endpoint - an S3-compatible endpoint to use instead of AWS's, e.g. LocalStack's or MinIO's.
+	Endpoint string `json:"endpoint"`
+	// PathStyle - addresses the bucket in the path (endpoint/bucket/key) rather than the host name, as LocalStack and
+	// MinIO usually need.
+	PathStyle bool `json:"path_style"`
+}
+
+const (
+	// ExportJSON - a catalog snapshot, as the admin backup endpoint returns.
+	ExportJSON = "json"
+	// ExportCSV - the columns of the CSV export endpoint.
+	ExportCSV = "csv"
+)
+
+/*
+CircuitBreaker - stops calling the backend once it has failed Failures times in a row, so requests respond 503 at
+once instead of each waiting out the SDK's retries. After Cooldown one call is tried, and if it succeeds calls
+resume. Not found, conflicts and abandoned requests aren't failures.
+*/
+type CircuitBreaker struct {
+	Enabled bool `json:"enabled"`
+	// Failures - how many calls in a row must fail to open the breaker.
+	Failures int `json:"failures"`
+	// Cooldown - how long the breaker stays open before trying the backend again.
+	Cooldown Duration `json:"cooldown"`
+}
+
+/*
+Retry - retries of datastore calls that failed because the backend was unavailable (throttling, timeouts, server
+errors), on top of any retries the backend's own client makes. Reads, and writes that replace what was there, are
+retried after any such failure; other writes only when the backend says it turned them away unapplied.
+*/
+type Retry struct {
+	Enabled bool `json:"enabled"`
+	// Attempts - the most times a call is made, including the first.
+	Attempts int `json:"attempts"`
+	// MinBackoff / MaxBackoff - the wait before the first retry, doubling for each one after, up to MaxBackoff.
+	MinBackoff Duration `json:"min_backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+	// Budget - limits retries across all calls, so they can't multiply the load on a backend that's struggling.
+	Budget RetryBudget `json:"budget"`
+}
+
+// RetryBudget - each call earns Ratio of a retry, up to Min, and each retry spends one.
+type RetryBudget struct {
+	// Ratio - the retries each call earns, e.g. 0.1 for at most one retry for every ten calls.
+	Ratio float64 `json:"ratio"`
+	// Min - the retries that can be made in a row, however few calls there have been.
+	Min int `json:"min"`
+}
+
+/*
+Metrics - request and backend call metrics, for deployments on AWS that don't run a metrics server of their own. Each
+request is counted under its method and route (the path template, e.g. /v1/product/{id}), and each backend call
+under its method; both record their latency and failures.
+*/
+type Metrics struct {
+	// Output - where metrics go: MetricsEMF, MetricsPutMetricData, or "" (the default) for nowhere.
+	Output string `json:"output"`
+	// Namespace - the CloudWatch namespace of every metric.
+	Namespace string `json:"namespace"`
+	// Dimensions - added to every metric, e.g. {"Service": "products", "Stage": "prod"}, to tell deployments apart.
+	Dimensions map[string]string `json:"dimensions"`
+	// Interval - how often MetricsPutMetricData sends what it has gathered.
+	Interval Duration `json:"interval"`
+	// Region - the AWS region for MetricsPutMetricData, if it isn't the SDK's default.
+	Region string `json:"region"`
+}
+
+const (
+	// MetricsEMF - writes each request and call to stdout in CloudWatch's embedded metric format, for CloudWatch Logs
+	// (e.g. from Lambda, ECS or the CloudWatch agent) to turn into metrics. Nothing is sent from the app itself.
+	MetricsEMF = "emf"
+	// MetricsPutMetricData - gathers statistics in memory and sends them with the PutMetricData API every Interval.
+	MetricsPutMetricData = "put_metric_data"
+)
+
+/*
+Usage - API usage analytics. Each request is counted under its client (the authenticated user or client, or else its
+IP address), method and route, with its errors and the bytes it sent and received; the counts are rolled up by hour
+and kept in the backend, where every instance's add up.
+*/
+type Usage struct {
+	// Enabled - off by default.
+	Enabled bool `json:"enabled"`
+	// FlushInterval - how often each instance writes its counts to the backend. Default 1m.
+	FlushInterval Duration `json:"flush_interval"`
+	// Retention - how long hourly rollups are kept. Default 2160h (90 days).
+	Retention Duration `json:"retention"`
+	// MaxClients - the most clients counted separately in an hour by one instance; any more are counted together as
+	// "other", so a flood of new addresses can't grow the counts without limit. Default 10,000.
+	MaxClients int `json:"max_clients"`
+}
+
+/*
+ErrorReporting - reports server errors (5xx responses) and panics to Sentry, or a service that accepts Sentry's
+protocol, with the request they happened in.
+*/
+type ErrorReporting struct {
+	// DSN - the project's Sentry DSN; setting it (or the SENTRY_DSN environment variable) enables reporting.
+	DSN string `json:"dsn"`
+	// Environment - the environment reports are filed under, e.g. "production"; SENTRY_ENVIRONMENT by default.
+	Environment string `json:"environment"`
+	// Release - the release reports are filed under; SENTRY_RELEASE, or the build's VCS revision, by default.
+	Release string `json:"release"`
+	// SampleRate - the fraction (0 to 1) of errors reported; 1 by default.
+	SampleRate float64 `json:"sample_rate"`
+}
+
+/*
+Jobs - background job settings. Jobs are queued in memory unless an SQS queue is configured, in which case every
+instance sharing the queue works on them.
+*/
+type Jobs struct {
+	// Workers - how many jobs each instance runs at once.
+	Workers int `json:"workers"`
+	// MaxAttempts - how many times a job is tried before it's dead-lettered.
+	MaxAttempts int `json:"max_attempts"`
+	// MinBackoff / MaxBackoff - bounds of the exponential delay before each retry.
+	MinBackoff Duration `json:"min_backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+	// Capacity - the most jobs the in-memory queue holds; enqueueing more fails until some have run.
+	Capacity int `json:"capacity"`
+	// SQS - keeps jobs in an SQS queue instead of memory, so they survive restarts.
+	SQS SQS `json:"sqs"`
+}
+
+/*
+Alerts - price-drop alert settings. Clients subscribe to a Product with a price threshold, and are notified by
+email or webhook, through the job queue, when an update takes the price from at or above the threshold to below it.
+*/
+type Alerts struct {
+	// Enabled - whether subscriptions are taken, and updates checked against them. It costs every update an extra
+	// read of the Product, for its old price.
+	Enabled bool `json:"enabled"`
+	// WebhookTimeout - how long a webhook has to respond before the delivery fails and is retried.
+	WebhookTimeout Duration `json:"webhook_timeout"`
+	// AllowPrivateWebhooks - lets webhooks be on loopback, link-local and private addresses, e.g. a receiver on the
+	// same network. Off by default, since anyone who can subscribe could otherwise make the app POST to internal
+	// services, such as the cloud metadata endpoint.
+	AllowPrivateWebhooks bool `json:"allow_private_webhooks"`
+	// SMTP - the mail server email alerts are sent through; without it, only webhook subscriptions are taken.
+	SMTP SMTP `json:"smtp"`
+}
+
+// SMTP - a mail server to send email through.
+type SMTP struct {
+	// Addr - the server's host:port, e.g. "smtp.example.com:587". STARTTLS is used if the server offers it.
+	Addr string `json:"addr"`
+	// From - the sender address.
+	From string `json:"from"`
+	// Username / Password - optional PLAIN authentication, which Go only sends over TLS or to localhost.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+/*
+ChangeFeed - turns the backend's changes into change events. By default they're drained from the outbox, where each
+change is put in the same transaction as the write that made it, so an event can't be lost. With ChangeFeedStream,
+they're read from the backend's own feed instead, which has changes made outside the API too (e.g. by another
+service, or by hand in the console): DynamoDB reads each Products table's stream; dummydb, which only the API can
+change, its change log.
+*/
+type ChangeFeed struct {
+	// Enabled - follows the feed; off by default.
+	Enabled bool `json:"enabled"`
+	// Source - where events come from: ChangeFeedOutbox (the default) or ChangeFeedStream.
+	Source string `json:"source"`
+	// PollInterval - how long to wait before reading again once the feed has been read up to date.
+	PollInterval Duration `json:"poll_interval"`
+}
+
+const (
+	// ChangeFeedOutbox - events are drained from the outbox, and deleted from it once published.
+	ChangeFeedOutbox = "outbox"
+	// ChangeFeedStream - events are read from the backend's change feed.
+	ChangeFeedStream = "stream"
+)
+
+/*
+SQS - an SQS-backed job queue. Retries wait up to 15 minutes (SQS's longest delay), whatever MaxBackoff says.
+*/
+type SQS struct {
+	// QueueURL - the queue jobs are sent to; setting it enables SQS.
+	QueueURL string `json:"queue_url"`
+	// DeadLetterURL - optional queue that jobs out of attempts are moved to; otherwise they're only logged.
+	DeadLetterURL string `json:"dead_letter_url"`
+	// Region - the queues' AWS region, if it isn't the SDK's default.
+	Region string `json:"region"`
+}
+
+/*
+Search - search settings. By default searches read the datastore; with a provider, every Product write is mirrored
+into a search index and searches are served from it.
+*/
+type Search struct {
+	// Provider - SearchOpenSearch for an OpenSearch (or Elasticsearch) cluster at URL, or empty to search the datastore.
+	Provider string `json:"provider"`
+	// URL - the cluster's endpoint, e.g. "http://localhost:9200".
+	URL string `json:"url"`
+	// Index - the index name; with tenancy, each tenant's index is prefixed with its name, e.g. "acme.products".
+	Index string `json:"index"`
+	// Username / Password - optional HTTP basic authentication.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Timeout - the limit on each request to the cluster.
+	Timeout Duration `json:"timeout"`
+}
+
+// SearchOpenSearch - searches are served from an OpenSearch or Elasticsearch index.
+const SearchOpenSearch = "opensearch"
+
+// Cart - shopping cart settings.
+type Cart struct {
+	// TTL - how long a cart is kept after its last change before it is treated as abandoned.
+	TTL Duration `json:"ttl"`
+}
+
+/*
+CacheControl - the Cache-Control header sent with successful GET and HEAD responses, by kind of route. Each is a
+header value such as "public, max-age=60"; with a max-age, an Expires header that many seconds ahead is sent too, for
+HTTP/1.0 caches. Empty sends neither, leaving caching to the client's own heuristics.
+*/
+type CacheControl struct {
+	// Listings - reads of many Products: listings, counts, search, changes, exports, a supplier's Products and /catalog.
+	Listings string `json:"listings"`
+	// Products - reads of one Product, by ID or barcode, and of its reviews, variants and price history.
+	Products string `json:"products"`
+	// Admin - /admin reads, such as backups and users. Default "no-store".
+	Admin string `json:"admin"`
+}
+
+/*
+Currency - exchange rate settings. Prices are stored in Base; with a provider configured, read endpoints accept
+?currency= to return them converted.
+*/
+type Currency struct {
+	// Base - the ISO 4217 code of the currency prices are stored in.
+	Base string `json:"base"`
+	// Provider - CurrencyStatic (the Rates below), CurrencyHTTP (an external API at URL), or empty to disable conversion.
+	Provider string `json:"provider"`
+	// Rates - fixed rates from Base, for the static provider, e.g. {"EUR": 0.92}.
+	Rates map[string]float64 `json:"rates"`
+	// URL - the external API; "{base}" is replaced by Base.
+	URL string `json:"url"`
+	// TTL - how long fetched rates are used before they are refreshed.
+	TTL Duration `json:"ttl"`
+	// Timeout - the limit on each request to the external API.
+	Timeout Duration `json:"timeout"`
+}
+
+const (
+	// CurrencyStatic - rates come from the config file.
+	CurrencyStatic = "static"
+	// CurrencyHTTP - rates come from an external API.
+	CurrencyHTTP = "http"
+)
+
+/*
+Related - related product suggestions. Products are compared with the catalog by the Strategy's scoring, and the
+highest scoring are suggested.
+*/
+type Related struct {
+	// Strategy - RelatedSimilarity (the default) or RelatedPrice.
+	Strategy string `json:"strategy"`
+	// Limit - the most Products suggested at once; a request can ask for fewer with ?limit=. Default 10.
+	Limit int `json:"limit"`
+	// PriceBand - how far a price can be from the Product's and still count as similar, as a fraction of it. Default 0.25.
+	PriceBand float64 `json:"price_band"`
+}
+
+const (
+	// RelatedSimilarity - Products in the same category or with tags in common, those at a similar price ranked higher.
+	RelatedSimilarity = "similarity"
+	// RelatedPrice - Products at a similar price, whatever they are.
+	RelatedPrice = "price"
+)
+
+/*
+Tenancy - multi-tenant settings. When enabled, every API request must name its tenant in the X-Tenant-ID header.
+*/
+type Tenancy struct {
+	// Enabled - off by default, in which case everything belongs to a single default tenant.
+	Enabled bool `json:"enabled"`
+	// Tenants - the tenants allowed; requests for any other are refused. Names are lowercase letters, digits and
+	// dashes, up to 32 characters.
+	Tenants []string `json:"tenants"`
+}
+
+// Names - the tenants the backends set up: the configured ones, or just the default tenant ("") when disabled.
+func (t Tenancy) Names() []string {
+	if !t.Enabled {
+		return []string{""}
+	}
+	return t.Tenants
+}
+
+/*
+Replay - record/replay mock mode. Recording passes every datastore call through to the backend and appends it, with
+its results, to File; replaying answers the same calls from File without initializing a backend at all.
+*/
+type Replay struct {
+	// Mode - ReplayRecord, ReplayPlay, or empty (the default) to use the backend normally.
+	Mode string `json:"mode"`
+	// File - the recording, as JSON Lines; recording appends to it.
+	File string `json:"file"`
+}
+
+const (
+	// ReplayRecord - datastore calls are recorded to the file.
+	ReplayRecord = "record"
+	// ReplayPlay - datastore calls are answered from the file.
+	ReplayPlay = "replay"
+)
+
+/*
+Seed - where the initial catalog comes from. By default both backends start with the built-in test Products.
+*/
+type Seed struct {
+	// File - a JSON (array of Products) or CSV (name, price and optional expires_at columns) fixture to seed from
+	// instead, chosen by its .json or .csv extension.
+	File string `json:"file"`
+	// Skip - start with an empty catalog.
+	Skip bool `json:"skip"`
+}
+
+/*
+Server - where and how the API is served.
+*/
+type Server struct {
+	// Addr - the listen address, e.g. ":8000".
+	Addr string `json:"addr"`
+
+	// ReadHeaderTimeout / ReadTimeout - how long a client has to send the request headers / the whole request.
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	// WriteTimeout - how long a handler has to write its response, measured from the end of the request headers.
+	// Large CSV exports are streamed, so this must leave room for them.
+	WriteTimeout Duration `json:"write_timeout"`
+	// IdleTimeout - how long a keep-alive connection may wait for its next request.
+	IdleTimeout Duration `json:"idle_timeout"`
+	// MaxHeaderBytes - the largest request header block accepted.
+	MaxHeaderBytes int `json:"max_header_bytes"`
+
+	// TLS - serves HTTPS instead of plain HTTP when a certificate is configured.
+	TLS TLS `json:"tls"`
+
+	// UnixSocket - also serves plain HTTP on a Unix domain socket, for a reverse proxy on the same host.
+	UnixSocket UnixSocket `json:"unix_socket"`
+
+	// Lambda - how API Gateway's requests arrive when the app is built to run on AWS Lambda (-tags lambda). None of
+	// the settings above apply then.
+	Lambda Lambda `json:"lambda"`
+
+	// TrustedProxies - the addresses (e.g. "10.0.0.7") or CIDR ranges (e.g. "10.0.0.0/8") of load balancers and
+	// proxies in front of the app. A request from one of them is taken to be from the client its X-Forwarded-For
+	// header names; no one else's X-Forwarded-For is believed.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// RequestTimeout - how long an API request (under /v1 or /catalog) may take, on Lambda too: its datastore calls are abandoned
+	// then, and it responds 504 unless its response has started. 0 leaves requests unlimited.
+	RequestTimeout Duration `json:"request_timeout"`
+
+	// ShutdownTimeout - how long in-flight requests get to finish once the server stops taking new ones, on SIGTERM or
+	// SIGINT or after handing over to an upgrade. Any still running then are cut off.
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	// Upgrades - zero-downtime restarts, for deployments on bare VMs.
+	Upgrades Upgrades `json:"upgrades"`
+}
+
+/*
+UnixSocket - a Unix domain socket the API is served on as well as Addr. Whatever connects to it is trusted as a
+proxy is, so its X-Forwarded-For header says who the client is.
+*/
+type UnixSocket struct {
+	// Path - the socket's path, e.g. "/run/products/api.sock"; empty (the default) serves no socket. A socket left
+	// behind by a process that didn't exit cleanly is replaced.
+	Path string `json:"path"`
+	// Mode - the socket's permissions, in octal (default "0660"). Connecting needs write permission.
+	Mode string `json:"mode"`
+}
+
+/*
+Upgrades - graceful binary upgrades. On SIGUSR2 the server starts its executable again (the newly deployed one, if it
+has been replaced) and hands it the listening sockets, so no connection is refused. Once the new process is serving,
+the old one stops accepting connections and exits when its in-flight requests finish. If the new process fails to
+start, the old one carries on.
+*/
+type Upgrades struct {
+	// Enabled - whether SIGUSR2 upgrades the server. Not supported on Windows.
+	Enabled bool `json:"enabled"`
+	// PIDFile - optional file the serving process writes its PID to, so scripts and service managers can signal
+	// whichever process is current.
+	PIDFile string `json:"pid_file"`
+	// Timeout - how long the new process has to start serving before the upgrade is abandoned.
+	Timeout Duration `json:"timeout"`
+}
+
+/*
+Lambda - settings for running behind API Gateway on AWS Lambda.
+*/
+type Lambda struct {
+	// Payload - the API Gateway proxy event format: LambdaPayloadV1 (default) for REST APIs, or LambdaPayloadV2 for
+	// HTTP APIs using the 2.0 payload format.
+	Payload string `json:"payload"`
+}
+
+const (
+	// LambdaPayloadV1 - the REST API (and HTTP API 1.0) proxy integration format.
+	LambdaPayloadV1 = "1.0"
+	// LambdaPayloadV2 - the HTTP API 2.0 payload format.
+	LambdaPayloadV2 = "2.0"
+)
+
+/*
+TLS - certificate settings for serving HTTPS.
+*/
+type TLS struct {
+	// CertFile / KeyFile - PEM files for the server certificate (with any intermediates) and its private key.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// MinVersion - the oldest TLS version accepted: "1.2" (default) or "1.3".
+	MinVersion string `json:"min_version"`
+	// RedirectAddr - optional plain HTTP listen address, e.g. ":80", that redirects every request to HTTPS: 301 for GET
+	// and HEAD, 308 for other methods.
+	RedirectAddr string `json:"redirect_addr"`
+	// Autocert - obtains and renews certificates from Let's Encrypt instead of using CertFile/KeyFile.
+	Autocert Autocert `json:"autocert"`
+}
+
+/*
+Autocert - automatic certificates via ACME (Let's Encrypt).
+*/
+type Autocert struct {
+	// Hostnames - the names certificates may be requested for; any other SNI name is refused. Setting any enables autocert.
+	Hostnames []string `json:"hostnames"`
+	// CacheDir - where certificates and the account key are kept between restarts, to avoid hitting rate limits.
+	CacheDir string `json:"cache_dir"`
+	// Email - optional contact address for expiry and account notices.
+	Email string `json:"email"`
+}
+
+// Enabled - whether HTTPS is configured, with either certificate files or autocert.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.Autocert.Hostnames) > 0
+}
+
+/*
+Cache - settings for the read cache, which serves GetProduct and GetAll from memory.
+*/
+type Cache struct {
+	// Enabled - off by default; each instance caches separately, so others' writes show up only after TTL.
+	Enabled bool `json:"enabled"`
+	// Size - the most entries (Products, plus the full listing) kept before the least recently used is evicted.
+	Size int `json:"size"`
+	// TTL - how long an entry is served before it is read again from the backend.
+	TTL Duration `json:"ttl"`
+}
+
+/*
+ResponseCache - whole listing and search responses, cached in Redis so that a fleet of instances shares one cache.
+Requests are told apart by path, normalized query and the headers that choose the representation; every write to a
+tenant's Products through any instance invalidates its cached responses.
+*/
+type ResponseCache struct {
+	// Redis - the address (host:port) of the Redis server; empty (the default) disables the cache.
+	Redis string `json:"redis"`
+	// TTL - the longest a response is served from the cache, for changes made other than through the API.
+	TTL Duration `json:"ttl"`
+	// MaxBytes - the largest response body cached.
+	MaxBytes int `json:"max_bytes"`
+}
+
+/*
+DummyDB - settings for the in-memory backend. By default it keeps nothing between runs; with WALDir, every write is
+appended to a write-ahead log there, and a restart replays the log on top of the last snapshot.
+*/
+type DummyDB struct {
+	// WALDir - the directory for the log (wal.jsonl) and snapshot (snapshot.json), created if need be.
+	WALDir string `json:"wal_dir"`
+	// CompactInterval - how often the log is folded into a new snapshot and emptied; default 1m.
+	CompactInterval Duration `json:"compact_interval"`
+}
+
+/*
+DynamoDB - client settings for the DynamoDB backend.
+*/
+type DynamoDB struct {
+	// Target - DynamoDBLocal (default) for DynamoDB Local, DynamoDBLocalStack for LocalStack, or DynamoDBAWS for the
+	// real service.
+	Target string `json:"target"`
+	// Endpoint - the URL DynamoDB is reached at, if not the target's own (see ResolvedEndpoint), e.g. another port for
+	// the emulator, or a VPC or FIPS endpoint on AWS.
+	Endpoint string `json:"endpoint"`
+	// Region - the AWS region. Empty uses the SDK's default sources (AWS_REGION, the profile's region), falling back
+	// to DefaultRegion.
+	Region string `json:"region"`
+	// Profile - the shared config and credentials profile to use; empty uses AWS_PROFILE, or else "default". Other
+	// credentials come from the SDK's default chain: the environment, the profile, web identity (e.g. EKS service
+	// accounts), and then the ECS task role or EC2 instance role.
+	Profile string `json:"profile"`
+	// TablePrefix / TableSuffix - added to the name of every table the app uses, e.g. "dev_" for dev_Products, so that
+	// several environments can share one account. Empty by default.
+	TablePrefix string `json:"table_prefix"`
+	TableSuffix string `json:"table_suffix"`
+	// AssumeRole - a role to assume with those credentials, e.g. to reach a table in another account.
+	AssumeRole AssumeRole `json:"assume_role"`
+	// MaxRetries - how many times a failed request is retried.
+	MaxRetries int `json:"max_retries"`
+	// MinRetryDelay / MaxRetryDelay - bounds of the exponential backoff (with jitter) between retries.
+	MinRetryDelay Duration `json:"min_retry_delay"`
+	MaxRetryDelay Duration `json:"max_retry_delay"`
+	// MinThrottleDelay / MaxThrottleDelay - the same bounds, used when DynamoDB throttles a request.
+	MinThrottleDelay Duration `json:"min_throttle_delay"`
+	MaxThrottleDelay Duration `json:"max_throttle_delay"`
+	// RequestTimeout - the limit on a single HTTP request to DynamoDB, including reading the response.
+	RequestTimeout Duration `json:"request_timeout"`
+	// LogLevel - SDK logging: "off", "debug", "debug_with_retries" or "debug_with_http_body".
+	// Anything but "off" is noisy, and "debug_with_http_body" logs item data.
+	LogLevel string `json:"log_level"`
+
+	// BillingMode - "PROVISIONED" (default) or "PAY_PER_REQUEST" for tables created by the app.
+	BillingMode string `json:"billing_mode"`
+	// ReadCapacity / WriteCapacity - the Products table's provisioned RCU/WCU; ignored for PAY_PER_REQUEST.
+	ReadCapacity  int64 `json:"read_capacity"`
+	WriteCapacity int64 `json:"write_capacity"`
+
+	// AutoScaling - capacity scaling for provisioned tables.
+	AutoScaling AutoScaling `json:"auto_scaling"`
+
+	// DAXEndpoint - optional host:port of a DAX cluster to serve reads from; empty reads from DynamoDB directly.
+	DAXEndpoint string `json:"dax_endpoint"`
+	// ConsistentReads - read Products with strongly consistent reads, at twice the read capacity, rather than only
+	// when a request asks for them with ?consistent=true.
+	ConsistentReads bool `json:"consistent_reads"`
+
+	// GlobalTable - replication of the tables to other regions.
+	GlobalTable GlobalTable `json:"global_table"`
+
+	// ScanSegments - how many segments reads of the whole catalog (listings, filters, exports and snapshots) are
+	// split into and scanned in parallel; default 1, a plain Scan.
+	ScanSegments int `json:"scan_segments"`
+}
+
+/*
+The emulator targets, DynamoDBLocal and DynamoDBLocalStack, differ from AWS in only two ways that matter to the app:
+
+  - The endpoint is a plain-HTTP URL on the local machine (or a container) rather than AWS's regional endpoint.
+  - The emulators don't check credentials, but the SDK won't send unsigned requests. Without any credentials
+    configured, placeholder ones are used, so the emulators work without any AWS setup.
+
+DynamoDB requests always go to the endpoint's root, with the table named in the body, so there's no virtual-hosted
+or path-style addressing to choose between, as there is for S3 on LocalStack.
+*/
+const (
+	// DynamoDBLocal - Amazon's DynamoDB Local.
+	DynamoDBLocal = "local"
+	// DynamoDBLocalStack - LocalStack, whose services all share one endpoint.
+	DynamoDBLocalStack = "localstack"
+	// DynamoDBAWS - the DynamoDB service, using the SDK's credentials.
+	DynamoDBAWS = "aws"
+
+	// LocalEndpoint - DynamoDB Local on its default port.
+	LocalEndpoint = "http://localhost:8080"
+	// LocalStackEndpoint - LocalStack's default edge port.
+	LocalStackEndpoint = "http://localhost:4566"
+	// DefaultRegion - the region used when neither the config nor the SDK's default sources name one.
+	DefaultRegion = "us-west-2"
+)
+
+// Emulated - whether the target is an emulator rather than AWS.
+func (d DynamoDB) Emulated() bool {
+	return d.Target == DynamoDBLocal || d.Target == DynamoDBLocalStack
+}
+
+// ResolvedEndpoint - the URL to reach DynamoDB at: Endpoint if set, the emulator's default one, or "" for AWS's own
+// endpoint for the region.
+func (d DynamoDB) ResolvedEndpoint() string {
+	switch {
+	case d.Endpoint != "":
+		return d.Endpoint
+	case d.Target == DynamoDBLocal:
+		return LocalEndpoint
+	case d.Target == DynamoDBLocalStack:
+		return LocalStackEndpoint
+	}
+	return ""
+}
+
+/*
+AssumeRole - an IAM role to assume through STS. The temporary credentials are refreshed before they expire.
+*/
+type AssumeRole struct {
+	// RoleARN - the role to assume; empty uses the credentials as they are.
+	RoleARN string `json:"role_arn"`
+	// SessionName - identifies the app's sessions in CloudTrail; one is generated if empty.
+	SessionName string `json:"session_name"`
+	// ExternalID - required by some cross-account trust policies.
+	ExternalID string `json:"external_id"`
+	// Duration - how long each set of credentials lasts (default 15m, STS's minimum).
+	Duration Duration `json:"duration"`
+}
+
+/*
+AutoScaling - Application Auto Scaling settings for the Products table and its index. Only used in provisioned mode.
+*/
+type AutoScaling struct {
+	// Enabled - registers the table's read/write capacity as scalable targets on start-up. Off by default because
+	// DynamoDB Local has no Application Auto Scaling API.
+	Enabled bool `json:"enabled"`
+	// MinCapacity / MaxCapacity - the range each of read and write capacity may scale within.
+	MinCapacity int64 `json:"min_capacity"`
+	MaxCapacity int64 `json:"max_capacity"`
+	// TargetUtilization - the consumed/provisioned percentage (20-90) that scaling aims to hold.
+	TargetUtilization float64 `json:"target_utilization"`
+}
+
+/*
+GlobalTable - DynamoDB global tables (version 2019.11.21) settings. Every instance writes to Region, the home region,
+so conditional writes, transactions and the ID counter see every write; reads can be served by a nearer replica.
+*/
+type GlobalTable struct {
+	// Enabled - replicates every table to Replicas on start-up. Off by default; DynamoDB Local has no global tables.
+	Enabled bool `json:"enabled"`
+	// Replicas - the regions, besides Region, the tables are replicated to.
+	Replicas []string `json:"replicas"`
+	// ReadRegion - where eventually consistent reads go: "" for Region, one of Replicas, or ReadNearest.
+	ReadRegion string `json:"read_region"`
+	// ReplicationLag - after an instance writes to a tenant's tables, its reads of them go to Region for this long,
+	// so it reads its own writes while they replicate.
+	ReplicationLag Duration `json:"replication_lag"`
+}
+
+// ReadNearest - a GlobalTable.ReadRegion that reads from whichever of Region and Replicas answers fastest at start-up.
+const ReadNearest = "nearest"
+
+/*
+Duration - a time.Duration written in config files as a string, e.g. "250ms" or "5s".
+*/
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("Durations must be strings such as \"5s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+const (
+	// LegacyRedirect - unversioned paths redirect to the current API version.
+	LegacyRedirect = "redirect"
+	// LegacyGone - unversioned paths respond 410 Gone.
+	LegacyGone = "gone"
+)
+
+const (
+	// PutUpdate - PUT only updates existing Products.
+	PutUpdate = "update"
+	// PutUpsert - PUT creates a Product that doesn't exist yet.
+	PutUpsert = "upsert"
+)
+
+// Default - the settings used when no config file is given.
+func Default() Config {
+	return Config{
+		IDStrategy:    "int",
+		LegacyRoutes:  LegacyRedirect,
+		PutPolicy:     PutUpdate,
+		Strict:        true,
+		DefaultLocale: "en",
+		DynamoDB: DynamoDB{
+			Target:           DynamoDBLocal,
+			MaxRetries:       3,
+			MinRetryDelay:    Duration{50 * time.Millisecond},
+			MaxRetryDelay:    Duration{time.Second},
+			MinThrottleDelay: Duration{500 * time.Millisecond},
+			MaxThrottleDelay: Duration{5 * time.Second},
+			RequestTimeout:   Duration{5 * time.Second},
+			LogLevel:         "off",
+			BillingMode:      "PROVISIONED",
+			ReadCapacity:     10,
+			WriteCapacity:    10,
+			AutoScaling: AutoScaling{
+				MinCapacity:       10,
+				MaxCapacity:       100,
+				TargetUtilization: 70,
+			},
+			GlobalTable: GlobalTable{
+				ReplicationLag: Duration{2 * time.Second},
+			},
+			ScanSegments: 1,
+		},
+		DummyDB: DummyDB{
+			CompactInterval: Duration{time.Minute},
+		},
+		Cache: Cache{
+			Size: 1000,
+			TTL:  Duration{30 * time.Second},
+		},
+		ResponseCache: ResponseCache{
+			TTL:      Duration{time.Minute},
+			MaxBytes: 1 << 20,
+		},
+		CircuitBreaker: CircuitBreaker{
+			Failures: 5,
+			Cooldown: Duration{30 * time.Second},
+		},
+		Retry: Retry{
+			Attempts:   3,
+			MinBackoff: Duration{50 * time.Millisecond},
+			MaxBackoff: Duration{time.Second},
+			Budget:     RetryBudget{Ratio: 0.1, Min: 10},
+		},
+		Currency: Currency{
+			Base:    "USD",
+			URL:     "https://api.frankfurter.app/latest?from={base}",
+			TTL:     Duration{time.Hour},
+			Timeout: Duration{5 * time.Second},
+		},
+		Cart: Cart{
+			TTL: Duration{24 * time.Hour},
+		},
+		CacheControl: CacheControl{
+			Admin: "no-store",
+		},
+		Auth: Auth{
+			Basic: BasicAuth{Realm: "products"},
+			HMAC:  HMACAuth{Window: Duration{5 * time.Minute}},
+		},
+		Replay: Replay{
+			File: "recording.jsonl",
+		},
+		Related: Related{
+			Strategy:  RelatedSimilarity,
+			Limit:     10,
+			PriceBand: 0.25,
+		},
+		Search: Search{
+			Index:   "products",
+			Timeout: Duration{5 * time.Second},
+		},
+		Jobs: Jobs{
+			Workers:     4,
+			MaxAttempts: 5,
+			MinBackoff:  Duration{time.Second},
+			MaxBackoff:  Duration{5 * time.Minute},
+			Capacity:    10000,
+		},
+		Alerts: Alerts{
+			WebhookTimeout: Duration{5 * time.Second},
+		},
+		ChangeFeed: ChangeFeed{
+			Source:       ChangeFeedOutbox,
+			PollInterval: Duration{time.Second},
+		},
+		LogLevel: LogInfo,
+		CORS: CORS{
+			MaxAge: Duration{10 * time.Minute},
+		},
+		CSRF: CSRF{
+			TTL: Duration{12 * time.Hour},
+		},
+		Schedule: Schedule{
+			Timezone:     "UTC",
+			SnapshotDir:  "snapshots",
+			SnapshotKeep: 7,
+		},
+		Export: Export{
+			Formats: []string{ExportJSON, ExportCSV},
+		},
+		Metrics: Metrics{
+			Namespace: "ProductAPI",
+			Interval:  Duration{time.Minute},
+		},
+		Usage: Usage{
+			FlushInterval: Duration{time.Minute},
+			Retention:     Duration{90 * 24 * time.Hour},
+			MaxClients:    10000,
+		},
+		ErrorReporting: ErrorReporting{
+			SampleRate: 1,
+		},
+		Middleware: Middleware{
+			Server: []string{"request_id", "error_reports", "cors", "metrics", "usage"},
+			Router: []string{"recovery"},
+			API: []string{
+				"timeout", "faults", "rate_limit", "csrf", "auth", "signatures", "roles", "tenant", "consistency",
+				"decompress", "schema",
+			},
+		},
+		Server: Server{
+			Addr:              ":8000",
+			ReadHeaderTimeout: Duration{5 * time.Second},
+			ReadTimeout:       Duration{30 * time.Second},
+			WriteTimeout:      Duration{2 * time.Minute},
+			IdleTimeout:       Duration{2 * time.Minute},
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    Duration{30 * time.Second},
+			ShutdownTimeout:   Duration{30 * time.Second},
+			Upgrades:          Upgrades{Timeout: Duration{time.Minute}},
+			UnixSocket:        UnixSocket{Mode: "0660"},
+			TLS: TLS{
+				MinVersion: "1.2",
+				Autocert:   Autocert{CacheDir: "autocert-cache"},
+			},
+			Lambda: Lambda{Payload: LambdaPayloadV1},
+		},
+	}
+}
+
+// Load - reads a JSON config file on top of the defaults; an empty path just returns the defaults.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Error opening config file: %v", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("Error reading config file %v: %v", path, err)
+	}
+
+	return cfg, nil
+}
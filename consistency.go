@@ -0,0 +1,43 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// consistentRead - whether a request asks for strongly consistent reads (?consistent=true).
+func consistentRead(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	consistent, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, i18n.Errorf("invalid_consistent", "Invalid consistent value %q; use true or false", v)
+	}
+	return consistent, nil
+}
+
+/*
+readConsistency - lets a request ask for strongly consistent reads with ?consistent=true, e.g. to read back a write
+it has just made: the read cache is skipped and DynamoDB reads the Products table with ConsistentRead, which costs
+twice the read capacity. Otherwise reads are eventually consistent, unless dynamodb.consistent_reads is set.
+*/
+func readConsistency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consistent, err := consistentRead(r.URL.Query().Get("consistent"))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if consistent {
+			r = r.WithContext(datastore.WithConsistentRead(r.Context(), true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+func TestConsistentReadSkipsCache(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cache.Enabled = true
+	store := fixtureStore(t)
+	h := testServer(t, cfg, store)
+
+	price := func(path string) string {
+		t.Helper()
+		w := do(h, "GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %v: got status %v; body %s", path, w.Code, w.Body)
+		}
+		var p datastore.Product
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p.Price.String()
+	}
+
+	price("/v1/product/1")
+	// A write the cache doesn't see, as if another instance made it.
+	if _, err := store.UpdateProduct(context.Background(), datastore.Product{Id: "1", Name: "Apple", Price: money("1.25"), Barcode: "4006381333931"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := price("/v1/product/1"); got != "0.98" {
+		t.Fatalf("Cached read got price %v, want the cached 0.98", got)
+	}
+	if got := price("/v1/product/1?consistent=true"); got != "1.25" {
+		t.Fatalf("Consistent read got price %v, want 1.25", got)
+	}
+	// The consistent read refreshed the cache.
+	if got := price("/v1/product/1"); got != "1.25" {
+		t.Fatalf("Read after a consistent one got price %v, want 1.25", got)
+	}
+
+	w := do(h, "GET", "/v1/product/1?consistent=maybe", "")
+	if w.Code != http.StatusBadRequest || errorCode(w) != "invalid_consistent" {
+		t.Fatalf("GET with a bad consistent value: got status %v, code %q", w.Code, errorCode(w))
+	}
+}
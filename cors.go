@@ -0,0 +1,57 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsExposedHeaders - the response headers, beyond the basic ones, that browser clients may read.
+var corsExposedHeaders = strings.Join([]string{
+	"Location", "Link", "X-Total-Count", "X-Currency", requestIDHeader, "Retry-After", csrfHeader,
+}, ", ")
+
+/*
+withCORS - adds CORS headers to responses for requests from allowed origins, and answers their preflight requests
+itself, since the API's routes don't know about them. The allowed origins are read on every request, so a reloaded
+config applies straight away.
+*/
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		cors := live.Load().cors
+		if origin == "" || len(cors.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Whether the CORS headers are sent depends on the origin, so shared caches must keep responses apart.
+		w.Header().Add("Vary", "Origin")
+		if !slices.Contains(cors.AllowedOrigins, "*") && !slices.Contains(cors.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		// A preflight: any method the route supports is allowed, along with whatever headers were asked for.
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(append(routeMethods, http.MethodOptions), ", "))
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		if cors.MaxAge.Duration > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,155 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// Where CSRF tokens are given to browsers, and where their state-changing requests send them back.
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+/*
+csrfTokens - issues and checks CSRF tokens for the double-submit pattern: a browser is given a token in a cookie,
+and its state-changing requests must repeat it in the X-CSRF-Token header. A page on another site can make the
+browser send the cookie, but can't read it to send the header. Tokens are
+
+	<expiry, Unix seconds>.<random nonce>.<hex HMAC-SHA256 of the two, keyed by the secret>
+
+so one that was planted rather than issued (e.g. by a sibling subdomain setting the cookie) is refused too.
+*/
+type csrfTokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// newCSRFTokens - CSRF tokens as configured; nil unless CSRF protection is enabled.
+func newCSRFTokens(cfg config.CSRF) (*csrfTokens, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.TTL.Duration <= 0 {
+		return nil, fmt.Errorf("CSRF token TTL must be positive, not %v", cfg.TTL)
+	}
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	} else if len(secret) < 16 {
+		return nil, fmt.Errorf("CSRF secret is too short; use at least 16 characters")
+	}
+	return &csrfTokens{secret: secret, ttl: cfg.TTL.Duration}, nil
+}
+
+// mac - the signature of a token's expiry and nonce.
+func (c *csrfTokens) mac(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issue - a new token, good until now plus the TTL.
+func (c *csrfTokens) issue(now time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := strconv.FormatInt(now.Add(c.ttl).Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + c.mac(payload), nil
+}
+
+// valid - whether token was issued with this secret and hasn't expired.
+func (c *csrfTokens) valid(token string, now time.Time) bool {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.mac(payload))) {
+		return false
+	}
+	expiry, _, _ := strings.Cut(payload, ".")
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && now.Before(time.Unix(seconds, 0))
+}
+
+/*
+fromBrowser - whether a request was made by a browser, which would have sent its credentials along whether or not
+the page asking meant it to. Browsers send Origin with every cross-origin request and every POST, and Sec-Fetch-Site
+with every request; other clients send neither, and no cookies.
+*/
+func fromBrowser(r *http.Request) bool {
+	return r.Header.Get("Origin") != "" || r.Header.Get("Sec-Fetch-Site") != "" || len(r.Cookies()) > 0
+}
+
+/*
+requireCSRFToken - refuses a browser's state-changing requests with 403 unless the X-CSRF-Token header repeats a
+valid token from the csrf_token cookie. Other requests are let through; a browser's is given a fresh token, in the
+cookie and the X-CSRF-Token response header, if it doesn't have a valid one, so a page can send it on its next
+write. Requests that aren't from a browser are left alone. A nil tokens lets everything through.
+*/
+func requireCSRFToken(tokens *csrfTokens) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if tokens == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !fromBrowser(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now()
+			var token string
+			if cookie, err := r.Cookie(csrfCookie); err == nil && tokens.valid(cookie.Value, now) {
+				token = cookie.Value
+			}
+
+			if mutating(r) {
+				sent := r.Header.Get(csrfHeader)
+				if token == "" || !hmac.Equal([]byte(sent), []byte(token)) {
+					writeError(w, r, http.StatusForbidden, i18n.Errorf("csrf_token_invalid", "A valid %v header, matching the %v cookie, is required", csrfHeader, csrfCookie))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if token == "" {
+				var err error
+				if token, err = tokens.issue(now); err != nil {
+					writeError(w, r, http.StatusInternalServerError, err)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     csrfCookie,
+					Value:    token,
+					Path:     "/",
+					Expires:  now.Add(tokens.ttl),
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+			w.Header().Set(csrfHeader, token)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
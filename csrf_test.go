@@ -0,0 +1,78 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+func TestCSRF(t *testing.T) {
+	cfg := config.Default()
+	cfg.CSRF.Enabled = true
+	h := testServer(t, cfg, fixtureStore(t))
+	const body = `{"Name": "Kiwi", "Price": 0.5}`
+
+	// A browser's read is given a token, in the cookie and the header.
+	r := newRequest("GET", "/v1/product/1", "")
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	w := record(h, r)
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookie {
+			cookie = c
+		}
+	}
+	if w.Code != http.StatusOK || cookie == nil || w.Header().Get(csrfHeader) != cookie.Value {
+		t.Fatalf("GET from a browser: got status %v, cookie %v, header %q", w.Code, cookie, w.Header().Get(csrfHeader))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		cookie string
+		header string
+		status int
+	}{
+		{"no token", "", "", http.StatusForbidden},
+		{"cookie only", cookie.Value, "", http.StatusForbidden},
+		{"header from another site", "", cookie.Value, http.StatusForbidden},
+		{"mismatched", cookie.Value, cookie.Value + "0", http.StatusForbidden},
+		{"forged", "1.00.00", "1.00.00", http.StatusForbidden},
+		{"matching", cookie.Value, cookie.Value, http.StatusCreated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRequest("POST", "/v1/product", body)
+			r.Header.Set("Origin", "https://evil.example")
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tc.cookie})
+			}
+			if tc.header != "" {
+				r.Header.Set(csrfHeader, tc.header)
+			}
+			w := record(h, r)
+			if w.Code != tc.status || (tc.status == http.StatusForbidden && errorCode(w) != "csrf_token_invalid") {
+				t.Fatalf("Got status %v, code %q; want %v", w.Code, errorCode(w), tc.status)
+			}
+		})
+	}
+
+	// Admin writes are protected too; clients that aren't browsers aren't affected.
+	r = newRequest("DELETE", "/admin/products?confirm=true", "")
+	r.Header.Set("Origin", "https://evil.example")
+	if w := record(h, r); w.Code != http.StatusForbidden {
+		t.Errorf("Admin DELETE from a browser without a token: got status %v; want 403", w.Code)
+	}
+	if w := do(h, "POST", "/v1/product", body); w.Code != http.StatusCreated {
+		t.Errorf("POST from a client that isn't a browser: got status %v; want 201", w.Code)
+	}
+
+	tokens, _ := newCSRFTokens(config.CSRF{Enabled: true, TTL: config.Duration{Duration: time.Minute}})
+	token, _ := tokens.issue(time.Now().Add(-2 * time.Minute))
+	if tokens.valid(token, time.Now()) {
+		t.Errorf("Expired token %q is valid", token)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package currency converts prices from the catalog's base currency using exchange rates from a pluggable Provider.
+
+Prices are always stored in the base currency; conversion only happens on the way out, so changing provider (or a
+rate moving) never alters stored data.
+*/
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+// ErrUnknownCurrency - returned (wrapped) for a currency code the provider has no rate for.
+var ErrUnknownCurrency = errors.New("Unknown currency")
+
+var codeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Code - the normalized (upper-case ISO 4217) form of a currency code, or an error if it isn't one.
+func Code(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if !codeRegexp.MatchString(code) {
+		return "", fmt.Errorf("%w %q; use a three-letter ISO 4217 code such as EUR", ErrUnknownCurrency, s)
+	}
+	return code, nil
+}
+
+/*
+Provider - a source of exchange rates. Rates returns how many units of each currency one unit of base buys.
+*/
+type Provider interface {
+	Rates(ctx context.Context, base string) (map[string]float64, error)
+}
+
+/*
+Static - fixed rates from the config file, for deployments that set their own prices abroad or can't reach an
+external API. They are relative to the base currency they were configured for.
+*/
+type Static map[string]float64
+
+func (s Static) Rates(ctx context.Context, base string) (map[string]float64, error) {
+	return s, nil
+}
+
+/*
+HTTP - rates from an external JSON API. URL may contain "{base}", which is replaced by the base currency; the
+response must have a "rates" object mapping currency codes to rates, as e.g. https://api.frankfurter.app and
+several other free services return.
+*/
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h HTTP) Rates(ctx context.Context, base string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(h.URL, "{base}", base), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid exchange rate URL: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	tracecontext.Inject(ctx, req.Header)
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Exchange rate request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Exchange rate request failed: %v", resp.Status)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Error reading exchange rates: %v", err)
+	}
+	if len(body.Rates) == 0 {
+		return nil, errors.New("The exchange rate response had no rates")
+	}
+	return body.Rates, nil
+}
+
+/*
+Cached - a Provider whose rates are kept for TTL, so a busy API doesn't call the external service on every request.
+If a refresh fails, the previous rates keep being used (and the failure logged) until one succeeds; only when
+there have never been any rates is the error returned.
+*/
+type Cached struct {
+	Provider Provider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	rates   map[string]map[string]float64
+	fetched map[string]time.Time
+}
+
+func (c *Cached) Rates(ctx context.Context, base string) (map[string]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rates, ok := c.rates[base]; ok && time.Since(c.fetched[base]) < c.TTL {
+		return rates, nil
+	}
+
+	rates, err := c.Provider.Rates(ctx, base)
+	if err != nil {
+		if stale, ok := c.rates[base]; ok {
+			log.Printf("Using exchange rates from %v: %v", c.fetched[base].Format(time.RFC3339), err)
+			return stale, nil
+		}
+		return nil, err
+	}
+	if c.rates == nil {
+		c.rates = map[string]map[string]float64{}
+		c.fetched = map[string]time.Time{}
+	}
+	c.rates[base] = rates
+	c.fetched[base] = time.Now()
+	return rates, nil
+}
+
+/*
+Refresh - fetches base's rates now, whatever their age, so that requests don't wait for them. On failure the
+previous rates are kept.
+*/
+func (c *Cached) Refresh(ctx context.Context, base string) error {
+	rates, err := c.Provider.Rates(ctx, base)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rates == nil {
+		c.rates = map[string]map[string]float64{}
+		c.fetched = map[string]time.Time{}
+	}
+	c.rates[base] = rates
+	c.fetched[base] = time.Now()
+	return nil
+}
+
+/*
+Converter - converts prices from Base into other currencies.
+*/
+type Converter struct {
+	Base     string
+	Provider Provider
+}
+
+/*
+Convert - price (in the base currency) in the given currency, rounded to two decimal places. Converting to the
+base currency itself needs no rate.
+*/
+func (c *Converter) Convert(ctx context.Context, price float64, to string) (float64, error) {
+	rate, err := c.Rate(ctx, to)
+	if err != nil {
+		return 0, err
+	}
+	return math.Round(price*rate*100) / 100, nil
+}
+
+// Rate - how many units of the given currency one unit of the base currency buys.
+func (c *Converter) Rate(ctx context.Context, to string) (float64, error) {
+	if to == c.Base {
+		return 1, nil
+	}
+	rates, err := c.Provider.Rates(ctx, c.Base)
+	if err != nil {
+		return 0, err
+	}
+	rate, ok := rates[to]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("%w %v; no exchange rate from %v", ErrUnknownCurrency, to, c.Base)
+	}
+	return rate, nil
+}
@@ -0,0 +1,41 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import "fmt"
+
+/*
+ValidBarcode - checks that a barcode is a GTIN as printed under retail barcodes: 8 (EAN-8), 12 (UPC-A), 13 (EAN-13)
+or 14 (GTIN-14) digits, the last of which is the GS1 check digit. The empty string means no barcode and is valid.
+*/
+func ValidBarcode(code string) error {
+	if code == "" {
+		return nil
+	}
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return fmt.Errorf("Invalid barcode %q; use 8, 12, 13 or 14 digits", code)
+	}
+
+	// From the right, excluding the check digit, digits are weighted 3, 1, 3, 1, ...
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		d := int(code[i] - '0')
+		if d < 0 || d > 9 {
+			return fmt.Errorf("Invalid barcode %q; use digits only", code)
+		}
+		if i == len(code)-1 {
+			continue
+		}
+		if (len(code)-1-i)%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	if check := (10 - sum%10) % 10; int(code[len(code)-1]-'0') != check {
+		return fmt.Errorf("Invalid barcode %q; the check digit should be %v", code, check)
+	}
+	return nil
+}
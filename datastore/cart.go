@@ -0,0 +1,33 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+/*
+Cart - a shopping session's items, to be checked out as an Order. Its UUID doubles as the session's token. A cart
+that goes unchanged until ExpiresAt is abandoned: it's no longer returned, and DynamoDB's TTL deletes it.
+*/
+type Cart struct {
+	XMLName   xml.Name   `json:"-" xml:"cart" dynamodbav:"-"`
+	Id        string     `json:"id" xml:"id" dynamodbav:"cart_id"`
+	Items     []CartItem `json:"items" xml:"item" dynamodbav:"items"`
+	ExpiresAt time.Time  `json:"expires_at" xml:"expires_at" dynamodbav:"expires_at,unixtime"`
+}
+
+// CartItem - a quantity of a Product, or of one of its variants, in a cart. Prices are only fixed at checkout.
+type CartItem struct {
+	Id        string `json:"id" xml:"id" dynamodbav:"item_id"`
+	ProductId string `json:"product_id" xml:"product_id" dynamodbav:"product_id"`
+	VariantId string `json:"variant_id,omitempty" xml:"variant_id,omitempty" dynamodbav:"variant_id,omitempty"`
+	Quantity  int    `json:"quantity" xml:"quantity" dynamodbav:"quantity"`
+}
+
+// Expired - reports whether the cart has been abandoned.
+func (c Cart) Expired() bool {
+	return !c.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,61 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of Change.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// ChangeRetention - how long a backend keeps a Change; syncing from further back means downloading the catalog again.
+const ChangeRetention = 30 * 24 * time.Hour
+
+/*
+Change - an entry in the change log: the Product with ProductId was created, updated (including its rating, by a
+review) or deleted at At. Each tenant has its own log. Products that expire aren't logged; their expires_at says
+when they go.
+*/
+type Change struct {
+	ProductId string
+	Kind      string
+	At        time.Time
+}
+
+/*
+Position - where the change is in the log, which is ordered by time and then by Product ID (a bulk create logs all
+of its Products at once). Positions compare as strings in the same order.
+*/
+func (c Change) Position() string {
+	return fmt.Sprintf("%020d.%v", c.At.UnixNano(), c.ProductId)
+}
+
+// ErrInvalidChangeToken - returned (wrapped) by DecodeChangeToken for a token it didn't issue.
+var ErrInvalidChangeToken = errors.New("Invalid change token")
+
+// EncodeChangeToken - the opaque token for the point in the log just after the change.
+func EncodeChangeToken(c Change) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Position()))
+}
+
+// DecodeChangeToken - the change a token was issued for; only its At and ProductId are known.
+func DecodeChangeToken(token string) (Change, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	nanos, id, found := strings.Cut(string(b), ".")
+	n, convErr := strconv.ParseInt(nanos, 10, 64)
+	if err != nil || !found || convErr != nil || len(nanos) != 20 {
+		return Change{}, fmt.Errorf("%w %q", ErrInvalidChangeToken, token)
+	}
+	return Change{ProductId: id, At: time.Unix(0, n).UTC()}, nil
+}
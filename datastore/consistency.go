@@ -0,0 +1,23 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import "context"
+
+type consistentReadKey struct{}
+
+/*
+WithConsistentRead - returns a context asking the backend for strongly consistent reads, which see every write that
+finished before them, rather than eventually consistent ones, which cost less but can briefly miss a recent write.
+Backends that are always consistent ignore it; caches in front of a backend don't answer such reads.
+*/
+func WithConsistentRead(ctx context.Context, consistent bool) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, consistent)
+}
+
+// ConsistentRead - whether WithConsistentRead asked for strongly consistent reads.
+func ConsistentRead(ctx context.Context) bool {
+	consistent, _ := ctx.Value(consistentReadKey{}).(bool)
+	return consistent
+}
@@ -0,0 +1,387 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Product - Go object representation of items that will be managed by the app.
+*/
+type Product struct {
+	Id   string `json:"id" xml:"id"`
+	Name string
+	// Price - in the base currency.
+	Price Money
+	// ExpiresAt - optional; once passed, the Product is no longer returned and DynamoDB's TTL deletes it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty" dynamodbav:"expires_at,omitempty,unixtime"`
+	// Rating - the average of the Product's reviews, maintained by the backend; any value sent by a client is ignored.
+	Rating *Rating `json:"rating,omitempty" xml:"rating,omitempty" dynamodbav:"-"`
+	// Barcode - optional; a GTIN (see ValidBarcode) that no other Product in the catalog has.
+	Barcode string `json:"barcode,omitempty" xml:"barcode,omitempty" dynamodbav:"barcode,omitempty"`
+	// SupplierId - optional; the ID of the supplier record (see the "suppliers" resource) the Product is bought from.
+	SupplierId string `json:"supplier_id,omitempty" xml:"supplier_id,omitempty" dynamodbav:"supplier_id,omitempty"`
+	// CategoryId - optional; the ID of the category record (see the "categories" resource) the Product is listed under.
+	CategoryId string `json:"category_id,omitempty" xml:"category_id,omitempty" dynamodbav:"category_id,omitempty"`
+	// Tags - optional; up to MaxTags short labels (see ValidTags), such as "organic" or "citrus".
+	Tags []string `json:"tags,omitempty" xml:"tags>tag,omitempty" dynamodbav:"tags,omitempty"`
+	// Description - optional; up to MaxDescriptionLength characters.
+	Description string `json:"description,omitempty" xml:"description,omitempty" dynamodbav:"description,omitempty"`
+	// NameTranslations / DescriptionTranslations - optional; the name and description in other locales (see Localize).
+	NameTranslations        Translations `json:"name_translations,omitempty" xml:"name_translations,omitempty" dynamodbav:"name_translations,omitempty"`
+	DescriptionTranslations Translations `json:"description_translations,omitempty" xml:"description_translations,omitempty" dynamodbav:"description_translations,omitempty"`
+	// UpdatedAt - when the Product was created or last changed, including its rating, to the second; maintained by the
+	// backend like Rating. Products from before it was kept don't have one until they next change.
+	UpdatedAt *time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty" dynamodbav:"updated_at,omitempty,unixtime"`
+	// Stock - how many are held at each warehouse location; maintained by the backend through AdjustStock, like Rating,
+	// so any value sent with a create or update is ignored.
+	Stock StockLevels `json:"stock,omitempty" xml:"stock,omitempty" dynamodbav:"stock,omitempty"`
+}
+
+func (p Product) String() string {
+	return fmt.Sprintf("<(Id: %v) {%v} @ %v>", p.Id, p.Name, p.Price)
+}
+
+// Modified - the UpdatedAt of a Product written at t.
+func Modified(t time.Time) *time.Time {
+	t = t.UTC().Truncate(time.Second)
+	return &t
+}
+
+// Expired - reports whether the Product's expiry time has passed.
+func (p Product) Expired() bool {
+	return p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now())
+}
+
+// The mocks in datastore/mocks are generated from Datastore; see .mockery.yaml.
+//go:generate mockery --config ../.mockery.yaml
+
+/*
+Datastore - the operations every storage backend provides. The handlers only use a backend through this interface,
+so backends can change (or be swapped) without the API behaving any differently.
+
+Every method takes the request's context, so backend calls are abandoned when the client disconnects or the
+request's deadline passes.
+*/
+type Datastore interface {
+	// NextID - assigns the ID for a new Product according to the active ID strategy.
+	NextID(ctx context.Context) (string, error)
+	// GetAll - all of the Products, in price-descending order.
+	GetAll(ctx context.Context) ([]Product, error)
+	// GetProduct - fills in the Product with the given Id, or returns an error if it doesn't exist.
+	GetProduct(ctx context.Context, product *Product) error
+	// GetProducts - the Products with the given IDs, in the order requested, plus the IDs that don't exist.
+	GetProducts(ctx context.Context, ids []string) ([]Product, []string, error)
+	// FindByName / SearchByPrefix - case-insensitive name lookups, in price-descending order.
+	FindByName(ctx context.Context, name string) ([]Product, error)
+	SearchByPrefix(ctx context.Context, prefix string) ([]Product, error)
+	// FilterProducts - the live Products matching a filter expression (see ParseFilter), in price-descending order.
+	FilterProducts(ctx context.Context, expr Expr) ([]Product, error)
+	// FindByBarcode - the live Product with the given barcode, or an error if there isn't one.
+	FindByBarcode(ctx context.Context, code string) (Product, error)
+	// AddProduct / AddProducts - add new Products; an existing ID fails with ErrConflict. AddProducts is all-or-nothing.
+	AddProduct(ctx context.Context, p Product) error
+	AddProducts(ctx context.Context, products []Product) error
+	// CheckUnique - the conflict AddProducts or UpdateProduct would fail with because another live Product has one
+	// of the Products' barcodes (or names, if they're unique), or two of them share one; nothing is written.
+	CheckUnique(ctx context.Context, products []Product) error
+	// UpdateProduct / DeleteProduct - change or remove an existing Product. UpdateProduct returns the Product as
+	// stored afterwards, including fields the backend maintains, or, if the update succeeded but reading it back
+	// didn't, as written with its new UpdatedAt; it never creates one, failing with ErrNotFound instead.
+	UpdateProduct(ctx context.Context, p Product) (Product, error)
+	DeleteProduct(ctx context.Context, p Product) error
+	// AdjustStock - adds delta (negative to take stock out) to a live Product's stock at a location, logging the change,
+	// and returns the Product as stored afterwards. If that would leave less than none there, nothing is written and
+	// the error wraps ErrConflict; a missing Product fails with ErrNotFound.
+	AdjustStock(ctx context.Context, id, location string, delta int) (Product, error)
+	// Truncate - removes every Product in the catalog, with everything kept alongside them (price history, the change
+	// log and outbox, reviews, variants, orders, carts, reservations and resource records), and starts sequential
+	// IDs again from 1. Users are shared by every catalog, so they're kept.
+	Truncate(ctx context.Context) error
+	// ExpiredProducts - the Products whose expiry has passed but that are still stored, hidden from every other read.
+	ExpiredProducts(ctx context.Context) ([]Product, error)
+	// Explain - how a listing query would be executed.
+	Explain(ctx context.Context, query ListQuery) (QueryPlan, error)
+	// AdvanceID - makes sure NextID never hands out id, or a sequential ID below it. A no-op with UUIDs.
+	AdvanceID(ctx context.Context, id string) error
+	// GetPage - up to limit Products in storage order, starting after cursor ("" for the first page).
+	GetPage(ctx context.Context, limit int, cursor string) (Page, error)
+	// Count - how many live Products match the filter, without returning them.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// PriceHistory - every price the Product has had since it was added, oldest first. Adding a Product records its
+	// starting price, and an update records the new price if it changed.
+	PriceHistory(ctx context.Context, id string) ([]PricePoint, error)
+	// GetChanges - up to limit entries of the change log that come after the given one, oldest first. Adding,
+	// updating and deleting Products, and writing their reviews, log a Change; entries older than ChangeRetention
+	// may have been dropped.
+	GetChanges(ctx context.Context, after Change, limit int) ([]Change, error)
+	// Outbox - up to limit of the oldest changes not yet published as events, oldest first. Each Change is put in the
+	// outbox with the write that made it, so none is lost if the process stops before publishing it; entries older
+	// than ChangeRetention may have been dropped.
+	Outbox(ctx context.Context, limit int) ([]Change, error)
+	// DeleteOutbox - removes published changes from the outbox. Changes that aren't in it are ignored.
+	DeleteOutbox(ctx context.Context, changes []Change) error
+	// GetReviews - a Product's reviews, oldest first.
+	GetReviews(ctx context.Context, productID string) ([]Review, error)
+	// GetReview - fills in the Review with the given ProductId and Id, or returns an error if it doesn't exist.
+	GetReview(ctx context.Context, review *Review) error
+	// AddReview / UpdateReview / DeleteReview - change a Product's reviews, keeping its Rating in step. UpdateReview
+	// and DeleteReview fail with ErrConflict if the review's rating changed since it was read.
+	AddReview(ctx context.Context, review Review) error
+	UpdateReview(ctx context.Context, old, review Review) error
+	DeleteReview(ctx context.Context, review Review) error
+	// GetVariants - a Product's variants.
+	GetVariants(ctx context.Context, productID string) ([]Variant, error)
+	// GetVariant - fills in the Variant with the given ProductId and Id, or returns an error if it doesn't exist.
+	GetVariant(ctx context.Context, variant *Variant) error
+	// AddVariant / UpdateVariant / DeleteVariant - change a Product's variants; UpdateVariant and DeleteVariant fail
+	// if the variant doesn't exist.
+	AddVariant(ctx context.Context, variant Variant) error
+	UpdateVariant(ctx context.Context, variant Variant) error
+	DeleteVariant(ctx context.Context, variant Variant) error
+	// AddOrder - places an order, taking each line's quantity out of stock (or using up the line's reservation) in
+	// the same write: a variant line's from the variant, and any other from the locations of a Product that tracks
+	// stock, as StockLevels.Allocate chooses them. If a variant or Product no longer has enough stock, or a
+	// reservation has expired, nothing is written and the error wraps ErrConflict.
+	AddOrder(ctx context.Context, order Order) error
+	// GetOrder - fills in the Order with the given Id, or returns an error if it doesn't exist.
+	GetOrder(ctx context.Context, order *Order) error
+	// GetCart - fills in the Cart with the given Id, or returns an error if it doesn't exist or has expired.
+	GetCart(ctx context.Context, cart *Cart) error
+	// PutCart - saves a cart, replacing any earlier version of it.
+	PutCart(ctx context.Context, cart Cart) error
+	// DeleteCart - removes a live cart, or returns an error if there isn't one; only one of several concurrent
+	// deletes of the same cart succeeds.
+	DeleteCart(ctx context.Context, id string) error
+	// Reserve - takes the reservation's quantity out of its variant's stock and saves it; if there isn't enough
+	// stock, nothing is written and the error wraps ErrConflict.
+	Reserve(ctx context.Context, reservation Reservation) error
+	// GetReservation - fills in the Reservation with the given Id, or returns an error if it doesn't exist or has
+	// expired.
+	GetReservation(ctx context.Context, reservation *Reservation) error
+	// ReleaseReservation - deletes a reservation, whether or not it has expired, returning its quantity to its
+	// variant's stock. Only one of several concurrent releases of the same reservation succeeds.
+	ReleaseReservation(ctx context.Context, reservation Reservation) error
+	// ExpiredReservations - the reservations that have expired but haven't been released.
+	ExpiredReservations(ctx context.Context) ([]Reservation, error)
+	// GetUsers - every User, by name. Users are shared by every tenant, so these ignore the context's tenant.
+	GetUsers(ctx context.Context) ([]User, error)
+	// GetUser - fills in the User with the given Name, or returns an error if it doesn't exist.
+	GetUser(ctx context.Context, user *User) error
+	// AddUser / UpdateUser / DeleteUser - change the Users; AddUser fails with ErrConflict if the name is taken, and
+	// UpdateUser and DeleteUser with ErrNotFound if it isn't.
+	AddUser(ctx context.Context, user User) error
+	UpdateUser(ctx context.Context, user User) error
+	DeleteUser(ctx context.Context, name string) error
+	// GetRecords - every record of a registered Resource, in no particular order.
+	GetRecords(ctx context.Context, resource string) ([]Record, error)
+	// GetRecord - the record of the resource with the given ID, or an error if it doesn't exist.
+	GetRecord(ctx context.Context, resource, id string) (Record, error)
+	// AddRecord / UpdateRecord / DeleteRecord - change a resource's records; AddRecord fails with ErrConflict if the
+	// ID is taken, and UpdateRecord, which replaces the whole record, and DeleteRecord with ErrNotFound if it isn't.
+	AddRecord(ctx context.Context, resource string, record Record) error
+	UpdateRecord(ctx context.Context, resource string, record Record) error
+	DeleteRecord(ctx context.Context, resource, id string) error
+}
+
+// PricePoint - a Product's price from the given time until the next change.
+type PricePoint struct {
+	Price     Money     `json:"price" xml:"price"`
+	ChangedAt time.Time `json:"changed_at" xml:"changed_at"`
+}
+
+// Filter - the listing filters a count can apply; at most one is set, and none means every Product.
+type Filter struct {
+	// Name - an exact, case-insensitive name match, as FindByName.
+	Name string
+	// NamePrefix - a case-insensitive name prefix, as SearchByPrefix.
+	NamePrefix string
+	// Query - a typo-tolerant name search, as RankByName.
+	Query string
+	// Expr - a filter expression (see ParseFilter), as FilterProducts.
+	Expr Expr
+}
+
+/*
+Page - one page of a cursor-paged listing. Pages follow the backend's storage order rather than price order, so
+that each page costs a single bounded read however deep into the catalog it is. Cursor is empty on the last page.
+*/
+type Page struct {
+	Products []Product
+	Cursor   string
+}
+
+// ErrInvalidCursor - returned (wrapped) by GetPage for a cursor it didn't issue.
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// EncodeCursor - the opaque cursor for a page that ends with the Product with the given ID.
+func EncodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// DecodeCursor - the ID of the last Product of the page a cursor was issued for.
+func DecodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !Strategy.Valid(string(id)) {
+		return "", fmt.Errorf("%w %q", ErrInvalidCursor, cursor)
+	}
+	return string(id), nil
+}
+
+// ErrConflict - returned (wrapped) by a backend when a write conflicts with what's stored: a record with the same ID
+// already exists, a concurrent request changed it first, or there isn't enough stock.
+var ErrConflict = errors.New("conflict")
+
+// ErrNotFound - returned (wrapped) by a backend when the record asked for doesn't exist, or has expired.
+var ErrNotFound = errors.New("not found")
+
+/*
+Error - a backend error with a stable code API clients can match on, e.g. "product_not_found" or "barcode_in_use".
+It wraps the sentinel error (ErrNotFound, ErrConflict, ...) that decides the response status.
+*/
+type Error struct {
+	Code string
+	err  error
+}
+
+// Errorf - an Error with the given code; the message is formatted as by fmt.Errorf, so %w wraps the sentinel.
+func Errorf(code, format string, args ...interface{}) error {
+	return &Error{Code: code, err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// ErrorCode - the error's code.
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// ErrUnavailable - returned (wrapped) by a backend that couldn't be reached, or was too busy to answer, even after
+// retrying; the same request may well succeed later.
+var ErrUnavailable = errors.New("unavailable")
+
+/*
+ListQuery - a listing query for Explain to plan: the filter and order a listing reads with, as the API parses them
+from its parameters, and the names of its other parameters, which are applied once the Products have been read.
+*/
+type ListQuery struct {
+	Filter Filter
+	Sort   []SortKey
+	Params []string
+}
+
+/*
+QueryPlan - describes how a backend would execute a listing query, as reported by the explain endpoint.
+*/
+type QueryPlan struct {
+	// Operation - the backend operation used, e.g. GetItem, Query or Scan.
+	Operation string `json:"operation"`
+	// Index - the key or index the operation reads from.
+	Index string `json:"index"`
+	// FullScan - whether every item in the table has to be read.
+	FullScan bool `json:"full_scan"`
+	// EstimatedItems - roughly how many items will be read (not returned).
+	EstimatedItems int64 `json:"estimated_items"`
+	// EstimatedReadUnits - roughly how much read capacity the query consumes.
+	EstimatedReadUnits float64 `json:"estimated_read_units"`
+	// Notes - anything else worth knowing, such as filters that don't reduce the amount read.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// IDStrategy - determines what Product identifiers look like and how they are stored.
+type IDStrategy string
+
+const (
+	// IntIDs - sequential integer identifiers (the original behavior).
+	IntIDs IDStrategy = "int"
+	// UUIDIDs - random version 4 UUIDs, which can't be guessed or enumerated.
+	UUIDIDs IDStrategy = "uuid"
+)
+
+// Strategy - the ID strategy in effect for the running app.
+var Strategy = IntIDs
+
+var uuidPattern = `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+
+var uuidRegexp = regexp.MustCompile(`^` + uuidPattern + `$`)
+
+// ParseIDStrategy - converts a configuration value into an IDStrategy.
+func ParseIDStrategy(s string) (IDStrategy, error) {
+	switch IDStrategy(s) {
+	case "", IntIDs:
+		return IntIDs, nil
+	case UUIDIDs:
+		return UUIDIDs, nil
+	}
+	return "", fmt.Errorf("Unknown ID strategy %q", s)
+}
+
+// Pattern - the route variable pattern matching IDs of this strategy.
+func (s IDStrategy) Pattern() string {
+	if s == UUIDIDs {
+		return uuidPattern
+	}
+	return "[0-9]+"
+}
+
+// Valid - reports whether id is well-formed for this strategy.
+func (s IDStrategy) Valid(id string) bool {
+	if s == UUIDIDs {
+		return uuidRegexp.MatchString(id)
+	}
+	n, err := strconv.Atoi(id)
+	return err == nil && n >= 0
+}
+
+// Compare - orders two IDs as this strategy stores them: -1, 0 or +1. Integer IDs compare numerically.
+func (s IDStrategy) Compare(a, b string) int {
+	if s == IntIDs {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+// NewUUID - generates a random (version 4) UUID string.
+func NewUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("Error generating UUID: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// TestProducts - the built-in dummy data both backends are seeded with by default, using IDs that match the active strategy.
+func TestProducts() ([]Product, error) {
+	products := []Product{
+		{Name: "Apple", Price: MustParseMoney("0.98")},
+		{Name: "Orange", Price: MustParseMoney("0.98")},
+		{Name: "Bananas", Price: MustParseMoney("2.25")},
+		{Name: "Frozen Pizza", Price: MustParseMoney("4.99")},
+	}
+
+	if err := assignIDs(products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
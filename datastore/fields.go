@@ -0,0 +1,49 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import "context"
+
+// Product fields, as named in a sparse fieldset (?fields=).
+const (
+	FieldID          = "id"
+	FieldName        = "name"
+	FieldPrice       = "price"
+	FieldExpiresAt   = "expires_at"
+	FieldRating      = "rating"
+	FieldBarcode     = "barcode"
+	FieldSupplier    = "supplier_id"
+	FieldUpdatedAt   = "updated_at"
+	FieldDescription = "description"
+	FieldStock       = "stock"
+	FieldCategory    = "category_id"
+	FieldTags        = "tags"
+)
+
+// ProductFields - every field a sparse fieldset can name.
+var ProductFields = []string{FieldID, FieldName, FieldPrice, FieldExpiresAt, FieldRating, FieldBarcode, FieldSupplier, FieldUpdatedAt, FieldDescription, FieldStock, FieldCategory, FieldTags}
+
+type fieldsKey struct{}
+
+/*
+WithFields - returns a context telling the backend which Product fields the caller needs, so it can skip reading
+the rest. Backends may still return more; nil fields means all of them.
+*/
+func WithFields(ctx context.Context, fields []string) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+/*
+IDsOnly - returns a context asking the backend for as little of each Product as it can read, for callers that only
+need to know whether Products exist.
+*/
+func IDsOnly(ctx context.Context) context.Context {
+	return WithFields(ctx, []string{FieldID})
+}
+
+// Fields - the fields requested with WithFields; nil if every field is needed.
+func Fields(ctx context.Context) []string {
+	fields, _ := ctx.Value(fieldsKey{}).([]string)
+	return fields
+}
@@ -0,0 +1,414 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"context"
+)
+
+/*
+Interceptor - runs a Datastore call, named by its method, e.g. "GetProduct". It may do something before or after
+call, call it more than once, or not call it at all and return an error instead; whatever call filled in (the
+method's results, or a pointer argument) is what the caller gets back.
+*/
+type Interceptor func(ctx context.Context, method string, call func(ctx context.Context) error) error
+
+/*
+Intercepted - a Datastore whose every call goes through an Interceptor, for behaviour that applies to all of them
+alike, such as fault injection.
+*/
+type Intercepted struct {
+	Datastore
+	intercept Interceptor
+}
+
+// Intercept - wraps store so that each of its calls goes through interceptor.
+func Intercept(store Datastore, interceptor Interceptor) *Intercepted {
+	return &Intercepted{Datastore: store, intercept: interceptor}
+}
+
+func (s *Intercepted) NextID(ctx context.Context) (string, error) {
+	var id string
+	err := s.intercept(ctx, "NextID", func(ctx context.Context) (err error) {
+		id, err = s.Datastore.NextID(ctx)
+		return err
+	})
+	return id, err
+}
+
+func (s *Intercepted) GetAll(ctx context.Context) ([]Product, error) {
+	var products []Product
+	err := s.intercept(ctx, "GetAll", func(ctx context.Context) (err error) {
+		products, err = s.Datastore.GetAll(ctx)
+		return err
+	})
+	return products, err
+}
+
+func (s *Intercepted) GetProduct(ctx context.Context, product *Product) error {
+	return s.intercept(ctx, "GetProduct", func(ctx context.Context) error {
+		return s.Datastore.GetProduct(ctx, product)
+	})
+}
+
+func (s *Intercepted) GetProducts(ctx context.Context, ids []string) ([]Product, []string, error) {
+	var products []Product
+	var missing []string
+	err := s.intercept(ctx, "GetProducts", func(ctx context.Context) (err error) {
+		products, missing, err = s.Datastore.GetProducts(ctx, ids)
+		return err
+	})
+	return products, missing, err
+}
+
+func (s *Intercepted) FindByName(ctx context.Context, name string) ([]Product, error) {
+	var products []Product
+	err := s.intercept(ctx, "FindByName", func(ctx context.Context) (err error) {
+		products, err = s.Datastore.FindByName(ctx, name)
+		return err
+	})
+	return products, err
+}
+
+func (s *Intercepted) SearchByPrefix(ctx context.Context, prefix string) ([]Product, error) {
+	var products []Product
+	err := s.intercept(ctx, "SearchByPrefix", func(ctx context.Context) (err error) {
+		products, err = s.Datastore.SearchByPrefix(ctx, prefix)
+		return err
+	})
+	return products, err
+}
+
+func (s *Intercepted) FilterProducts(ctx context.Context, expr Expr) ([]Product, error) {
+	var products []Product
+	err := s.intercept(ctx, "FilterProducts", func(ctx context.Context) (err error) {
+		products, err = s.Datastore.FilterProducts(ctx, expr)
+		return err
+	})
+	return products, err
+}
+
+func (s *Intercepted) FindByBarcode(ctx context.Context, code string) (Product, error) {
+	var p Product
+	err := s.intercept(ctx, "FindByBarcode", func(ctx context.Context) (err error) {
+		p, err = s.Datastore.FindByBarcode(ctx, code)
+		return err
+	})
+	return p, err
+}
+
+func (s *Intercepted) AddProduct(ctx context.Context, p Product) error {
+	return s.intercept(ctx, "AddProduct", func(ctx context.Context) error {
+		return s.Datastore.AddProduct(ctx, p)
+	})
+}
+
+func (s *Intercepted) AddProducts(ctx context.Context, products []Product) error {
+	return s.intercept(ctx, "AddProducts", func(ctx context.Context) error {
+		return s.Datastore.AddProducts(ctx, products)
+	})
+}
+
+func (s *Intercepted) CheckUnique(ctx context.Context, products []Product) error {
+	return s.intercept(ctx, "CheckUnique", func(ctx context.Context) error {
+		return s.Datastore.CheckUnique(ctx, products)
+	})
+}
+
+func (s *Intercepted) UpdateProduct(ctx context.Context, p Product) (Product, error) {
+	var stored Product
+	err := s.intercept(ctx, "UpdateProduct", func(ctx context.Context) (err error) {
+		stored, err = s.Datastore.UpdateProduct(ctx, p)
+		return err
+	})
+	return stored, err
+}
+
+func (s *Intercepted) AdjustStock(ctx context.Context, id, location string, delta int) (Product, error) {
+	var stored Product
+	err := s.intercept(ctx, "AdjustStock", func(ctx context.Context) (err error) {
+		stored, err = s.Datastore.AdjustStock(ctx, id, location, delta)
+		return err
+	})
+	return stored, err
+}
+
+func (s *Intercepted) DeleteProduct(ctx context.Context, p Product) error {
+	return s.intercept(ctx, "DeleteProduct", func(ctx context.Context) error {
+		return s.Datastore.DeleteProduct(ctx, p)
+	})
+}
+
+func (s *Intercepted) Truncate(ctx context.Context) error {
+	return s.intercept(ctx, "Truncate", func(ctx context.Context) error {
+		return s.Datastore.Truncate(ctx)
+	})
+}
+
+func (s *Intercepted) ExpiredProducts(ctx context.Context) ([]Product, error) {
+	var products []Product
+	err := s.intercept(ctx, "ExpiredProducts", func(ctx context.Context) (err error) {
+		products, err = s.Datastore.ExpiredProducts(ctx)
+		return err
+	})
+	return products, err
+}
+
+func (s *Intercepted) Explain(ctx context.Context, query ListQuery) (QueryPlan, error) {
+	var plan QueryPlan
+	err := s.intercept(ctx, "Explain", func(ctx context.Context) (err error) {
+		plan, err = s.Datastore.Explain(ctx, query)
+		return err
+	})
+	return plan, err
+}
+
+func (s *Intercepted) AdvanceID(ctx context.Context, id string) error {
+	return s.intercept(ctx, "AdvanceID", func(ctx context.Context) error {
+		return s.Datastore.AdvanceID(ctx, id)
+	})
+}
+
+func (s *Intercepted) GetPage(ctx context.Context, limit int, cursor string) (Page, error) {
+	var page Page
+	err := s.intercept(ctx, "GetPage", func(ctx context.Context) (err error) {
+		page, err = s.Datastore.GetPage(ctx, limit, cursor)
+		return err
+	})
+	return page, err
+}
+
+func (s *Intercepted) Count(ctx context.Context, filter Filter) (int, error) {
+	var n int
+	err := s.intercept(ctx, "Count", func(ctx context.Context) (err error) {
+		n, err = s.Datastore.Count(ctx, filter)
+		return err
+	})
+	return n, err
+}
+
+func (s *Intercepted) PriceHistory(ctx context.Context, id string) ([]PricePoint, error) {
+	var history []PricePoint
+	err := s.intercept(ctx, "PriceHistory", func(ctx context.Context) (err error) {
+		history, err = s.Datastore.PriceHistory(ctx, id)
+		return err
+	})
+	return history, err
+}
+
+func (s *Intercepted) GetChanges(ctx context.Context, after Change, limit int) ([]Change, error) {
+	var changes []Change
+	err := s.intercept(ctx, "GetChanges", func(ctx context.Context) (err error) {
+		changes, err = s.Datastore.GetChanges(ctx, after, limit)
+		return err
+	})
+	return changes, err
+}
+
+func (s *Intercepted) Outbox(ctx context.Context, limit int) ([]Change, error) {
+	var changes []Change
+	err := s.intercept(ctx, "Outbox", func(ctx context.Context) (err error) {
+		changes, err = s.Datastore.Outbox(ctx, limit)
+		return err
+	})
+	return changes, err
+}
+
+func (s *Intercepted) DeleteOutbox(ctx context.Context, changes []Change) error {
+	return s.intercept(ctx, "DeleteOutbox", func(ctx context.Context) error {
+		return s.Datastore.DeleteOutbox(ctx, changes)
+	})
+}
+
+func (s *Intercepted) GetReviews(ctx context.Context, productID string) ([]Review, error) {
+	var reviews []Review
+	err := s.intercept(ctx, "GetReviews", func(ctx context.Context) (err error) {
+		reviews, err = s.Datastore.GetReviews(ctx, productID)
+		return err
+	})
+	return reviews, err
+}
+
+func (s *Intercepted) GetReview(ctx context.Context, review *Review) error {
+	return s.intercept(ctx, "GetReview", func(ctx context.Context) error {
+		return s.Datastore.GetReview(ctx, review)
+	})
+}
+
+func (s *Intercepted) AddReview(ctx context.Context, review Review) error {
+	return s.intercept(ctx, "AddReview", func(ctx context.Context) error {
+		return s.Datastore.AddReview(ctx, review)
+	})
+}
+
+func (s *Intercepted) UpdateReview(ctx context.Context, old, review Review) error {
+	return s.intercept(ctx, "UpdateReview", func(ctx context.Context) error {
+		return s.Datastore.UpdateReview(ctx, old, review)
+	})
+}
+
+func (s *Intercepted) DeleteReview(ctx context.Context, review Review) error {
+	return s.intercept(ctx, "DeleteReview", func(ctx context.Context) error {
+		return s.Datastore.DeleteReview(ctx, review)
+	})
+}
+
+func (s *Intercepted) GetVariants(ctx context.Context, productID string) ([]Variant, error) {
+	var variants []Variant
+	err := s.intercept(ctx, "GetVariants", func(ctx context.Context) (err error) {
+		variants, err = s.Datastore.GetVariants(ctx, productID)
+		return err
+	})
+	return variants, err
+}
+
+func (s *Intercepted) GetVariant(ctx context.Context, variant *Variant) error {
+	return s.intercept(ctx, "GetVariant", func(ctx context.Context) error {
+		return s.Datastore.GetVariant(ctx, variant)
+	})
+}
+
+func (s *Intercepted) AddVariant(ctx context.Context, variant Variant) error {
+	return s.intercept(ctx, "AddVariant", func(ctx context.Context) error {
+		return s.Datastore.AddVariant(ctx, variant)
+	})
+}
+
+func (s *Intercepted) UpdateVariant(ctx context.Context, variant Variant) error {
+	return s.intercept(ctx, "UpdateVariant", func(ctx context.Context) error {
+		return s.Datastore.UpdateVariant(ctx, variant)
+	})
+}
+
+func (s *Intercepted) DeleteVariant(ctx context.Context, variant Variant) error {
+	return s.intercept(ctx, "DeleteVariant", func(ctx context.Context) error {
+		return s.Datastore.DeleteVariant(ctx, variant)
+	})
+}
+
+func (s *Intercepted) AddOrder(ctx context.Context, order Order) error {
+	return s.intercept(ctx, "AddOrder", func(ctx context.Context) error {
+		return s.Datastore.AddOrder(ctx, order)
+	})
+}
+
+func (s *Intercepted) GetOrder(ctx context.Context, order *Order) error {
+	return s.intercept(ctx, "GetOrder", func(ctx context.Context) error {
+		return s.Datastore.GetOrder(ctx, order)
+	})
+}
+
+func (s *Intercepted) GetCart(ctx context.Context, cart *Cart) error {
+	return s.intercept(ctx, "GetCart", func(ctx context.Context) error {
+		return s.Datastore.GetCart(ctx, cart)
+	})
+}
+
+func (s *Intercepted) PutCart(ctx context.Context, cart Cart) error {
+	return s.intercept(ctx, "PutCart", func(ctx context.Context) error {
+		return s.Datastore.PutCart(ctx, cart)
+	})
+}
+
+func (s *Intercepted) DeleteCart(ctx context.Context, id string) error {
+	return s.intercept(ctx, "DeleteCart", func(ctx context.Context) error {
+		return s.Datastore.DeleteCart(ctx, id)
+	})
+}
+
+func (s *Intercepted) Reserve(ctx context.Context, reservation Reservation) error {
+	return s.intercept(ctx, "Reserve", func(ctx context.Context) error {
+		return s.Datastore.Reserve(ctx, reservation)
+	})
+}
+
+func (s *Intercepted) GetReservation(ctx context.Context, reservation *Reservation) error {
+	return s.intercept(ctx, "GetReservation", func(ctx context.Context) error {
+		return s.Datastore.GetReservation(ctx, reservation)
+	})
+}
+
+func (s *Intercepted) ReleaseReservation(ctx context.Context, reservation Reservation) error {
+	return s.intercept(ctx, "ReleaseReservation", func(ctx context.Context) error {
+		return s.Datastore.ReleaseReservation(ctx, reservation)
+	})
+}
+
+func (s *Intercepted) ExpiredReservations(ctx context.Context) ([]Reservation, error) {
+	var reservations []Reservation
+	err := s.intercept(ctx, "ExpiredReservations", func(ctx context.Context) (err error) {
+		reservations, err = s.Datastore.ExpiredReservations(ctx)
+		return err
+	})
+	return reservations, err
+}
+
+func (s *Intercepted) GetUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	err := s.intercept(ctx, "GetUsers", func(ctx context.Context) (err error) {
+		users, err = s.Datastore.GetUsers(ctx)
+		return err
+	})
+	return users, err
+}
+
+func (s *Intercepted) GetUser(ctx context.Context, user *User) error {
+	return s.intercept(ctx, "GetUser", func(ctx context.Context) error {
+		return s.Datastore.GetUser(ctx, user)
+	})
+}
+
+func (s *Intercepted) AddUser(ctx context.Context, user User) error {
+	return s.intercept(ctx, "AddUser", func(ctx context.Context) error {
+		return s.Datastore.AddUser(ctx, user)
+	})
+}
+
+func (s *Intercepted) UpdateUser(ctx context.Context, user User) error {
+	return s.intercept(ctx, "UpdateUser", func(ctx context.Context) error {
+		return s.Datastore.UpdateUser(ctx, user)
+	})
+}
+
+func (s *Intercepted) DeleteUser(ctx context.Context, name string) error {
+	return s.intercept(ctx, "DeleteUser", func(ctx context.Context) error {
+		return s.Datastore.DeleteUser(ctx, name)
+	})
+}
+
+func (s *Intercepted) GetRecords(ctx context.Context, resource string) ([]Record, error) {
+	var records []Record
+	err := s.intercept(ctx, "GetRecords", func(ctx context.Context) (err error) {
+		records, err = s.Datastore.GetRecords(ctx, resource)
+		return err
+	})
+	return records, err
+}
+
+func (s *Intercepted) GetRecord(ctx context.Context, resource, id string) (Record, error) {
+	var record Record
+	err := s.intercept(ctx, "GetRecord", func(ctx context.Context) (err error) {
+		record, err = s.Datastore.GetRecord(ctx, resource, id)
+		return err
+	})
+	return record, err
+}
+
+func (s *Intercepted) AddRecord(ctx context.Context, resource string, record Record) error {
+	return s.intercept(ctx, "AddRecord", func(ctx context.Context) error {
+		return s.Datastore.AddRecord(ctx, resource, record)
+	})
+}
+
+func (s *Intercepted) UpdateRecord(ctx context.Context, resource string, record Record) error {
+	return s.intercept(ctx, "UpdateRecord", func(ctx context.Context) error {
+		return s.Datastore.UpdateRecord(ctx, resource, record)
+	})
+}
+
+func (s *Intercepted) DeleteRecord(ctx context.Context, resource, id string) error {
+	return s.intercept(ctx, "DeleteRecord", func(ctx context.Context) error {
+		return s.Datastore.DeleteRecord(ctx, resource, id)
+	})
+}
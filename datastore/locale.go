@@ -0,0 +1,153 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+MaxTranslations / MaxDescriptionLength - the most locales a Product's name or description can be translated into,
+and the longest a description (or a translation of one) can be, in characters.
+*/
+const (
+	MaxTranslations      = 50
+	MaxDescriptionLength = 5000
+)
+
+// localePattern - a BCP 47 language tag, near enough: a language, then subtags such as a script or region.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{1,8})*$`)
+
+// ParseLocale - a locale such as "fr" or "pt-BR", in lower case, or an error if it isn't a language tag.
+func ParseLocale(s string) (string, error) {
+	locale := strings.ToLower(strings.TrimSpace(s))
+	if !localePattern.MatchString(locale) {
+		return "", fmt.Errorf("Invalid locale %q; use a language tag such as \"fr\" or \"pt-BR\"", s)
+	}
+	return locale, nil
+}
+
+// language - a locale's language, e.g. "pt" for "pt-br".
+func language(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+/*
+Translations - a text in other locales, keyed by language tag (in any case). XML has no maps, so there each is a
+<translation lang="fr"> element.
+*/
+type Translations map[string]string
+
+// Lookup - the translation into a locale, compared ignoring case, and whether there is one.
+func (t Translations) Lookup(locale string) (string, bool) {
+	for k, v := range t {
+		if strings.EqualFold(k, locale) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// xmlTranslation - one translation, as XML.
+type xmlTranslation struct {
+	Lang string `xml:"lang,attr"`
+	Text string `xml:",chardata"`
+}
+
+func (t Translations) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	locales := make([]string, 0, len(t))
+	for locale := range t {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	list := make([]xmlTranslation, len(locales))
+	for i, locale := range locales {
+		list[i] = xmlTranslation{locale, t[locale]}
+	}
+	return e.EncodeElement(struct {
+		Translations []xmlTranslation `xml:"translation"`
+	}{list}, start)
+}
+
+func (t *Translations) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var list struct {
+		Translations []xmlTranslation `xml:"translation"`
+	}
+	if err := d.DecodeElement(&list, &start); err != nil {
+		return err
+	}
+	*t = Translations{}
+	for _, tr := range list.Translations {
+		(*t)[tr.Lang] = tr.Text
+	}
+	return nil
+}
+
+/*
+ValidTranslations - checks a Product's description and translations: at most MaxTranslations of each, keyed by
+language tags (no two the same ignoring case), none of them blank, and descriptions no longer than
+MaxDescriptionLength.
+*/
+func ValidTranslations(p Product) error {
+	if len([]rune(p.Description)) > MaxDescriptionLength {
+		return fmt.Errorf("Description is longer than %v characters", MaxDescriptionLength)
+	}
+	for field, t := range map[string]Translations{"name": p.NameTranslations, "description": p.DescriptionTranslations} {
+		if len(t) > MaxTranslations {
+			return fmt.Errorf("The %v has more than %v translations", field, MaxTranslations)
+		}
+		seen := map[string]bool{}
+		for k, v := range t {
+			locale, err := ParseLocale(k)
+			if err != nil {
+				return fmt.Errorf("The %v's translations: %v", field, err)
+			}
+			if seen[locale] {
+				return fmt.Errorf("The %v is translated into %q more than once", field, locale)
+			}
+			seen[locale] = true
+			switch {
+			case strings.TrimSpace(v) == "":
+				return fmt.Errorf("The %v's %v translation is blank", field, k)
+			case len([]rune(v)) > MaxDescriptionLength:
+				return fmt.Errorf("The %v's %v translation is longer than %v characters", field, k, MaxDescriptionLength)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Localize - p with its name and description translated into the first of the locales (lower case, most preferred
+first) it has a translation of either for, and that locale. A regional locale falls back to its language ("fr-ca" to
+"fr"). Reaching one in the language of defaultLocale, which p's own name and description are in, or running out of
+locales, leaves p as it is, in defaultLocale. A name or description that hasn't been translated into the chosen
+locale is left as it is.
+*/
+func Localize(p Product, locales []string, defaultLocale string) (Product, string) {
+	for _, locale := range locales {
+		for _, candidate := range []string{locale, language(locale)} {
+			name, hasName := p.NameTranslations.Lookup(candidate)
+			description, hasDescription := p.DescriptionTranslations.Lookup(candidate)
+			if hasName || hasDescription {
+				if hasName {
+					p.Name = name
+				}
+				if hasDescription {
+					p.Description = description
+				}
+				return p, candidate
+			}
+		}
+		if language(locale) == language(strings.ToLower(defaultLocale)) {
+			break
+		}
+	}
+	return p, defaultLocale
+}
@@ -0,0 +1,366 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+/*
+MergeResource - where merges are recorded, one record each: it says what's been moved so far, so that a merge which
+failed partway can be finished without moving anything twice, and once the merge is done it stays as the record of
+it, since the duplicate is gone. It's hidden: the API serves a Product's merges under the Product.
+*/
+var MergeResource = Resource{
+	Name:   "merges",
+	Table:  "Merges",
+	Hidden: true,
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["into", "from", "started_at"],
+		"properties": {
+			"into": {"type": "string"},
+			"from": {"type": "string"},
+			"started_at": {"type": "string"},
+			"finished_at": {"type": "string"},
+			"reviews": {"type": "integer", "minimum": 0},
+			"variants": {"type": "integer", "minimum": 0},
+			"combined": {"type": "integer", "minimum": 0},
+			"stock": {"type": "integer", "minimum": 0},
+			"moved": {"type": "array", "items": {"type": "object"}},
+			"pending": {"type": "object"}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	RegisterResource(MergeResource)
+}
+
+// MergeResult - what Merge moved from the duplicate to the Product it was merged into.
+type MergeResult struct {
+	// Reviews - how many reviews were moved.
+	Reviews int `json:"reviews" xml:"reviews"`
+	// Variants - how many variants were moved as they were.
+	Variants int `json:"variants" xml:"variants"`
+	// Combined - how many variants had the same size and color as one the Product already had, and were added to
+	// its stock.
+	Combined int `json:"combined" xml:"combined"`
+	// Stock - how much of the duplicate's stock at warehouse locations was added to the Product's.
+	Stock int `json:"stock" xml:"stock"`
+}
+
+/*
+StockMove - stock Merge took from the duplicate and added to the Product: a combined variant's (Variant, added to
+the Product's variant Target) or the duplicate's stock at Location.
+*/
+type StockMove struct {
+	Variant  string `json:"variant,omitempty" xml:"variant,omitempty"`
+	Target   string `json:"target,omitempty" xml:"target,omitempty"`
+	Location string `json:"location,omitempty" xml:"location,omitempty"`
+	Quantity int    `json:"quantity" xml:"quantity"`
+	// Before - the Product's stock there before the move, which tells a merge finishing the move whether it was
+	// added already.
+	Before int `json:"before" xml:"before"`
+}
+
+/*
+MergeRecord - a merge, as it's recorded in MergeResource: what was moved from the duplicate From into the Product
+Into, and, while it's unfinished, the stock move in progress.
+*/
+type MergeRecord struct {
+	XMLName    xml.Name    `json:"-" xml:"merge"`
+	Id         string      `json:"id" xml:"id"`
+	Into       string      `json:"into" xml:"into"`
+	From       string      `json:"from" xml:"from"`
+	StartedAt  time.Time   `json:"started_at" xml:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty" xml:"finished_at,omitempty"`
+	Moved      []StockMove `json:"moved,omitempty" xml:"moved>move,omitempty"`
+	Pending    *StockMove  `json:"pending,omitempty" xml:"pending,omitempty"`
+	MergeResult
+}
+
+// record - the merge as a record of MergeResource.
+func (m MergeRecord) record() (Record, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var r Record
+	return r, json.Unmarshal(data, &r)
+}
+
+// mergeFromRecord - local helper function that reads the merge a record of MergeResource holds.
+func mergeFromRecord(r Record) (MergeRecord, error) {
+	var m MergeRecord
+	data, err := json.Marshal(r)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("Invalid merge <%v>: %v", r.Id(), err)
+	}
+	return m, nil
+}
+
+// Merges - the merges into the Product with the given ID, finished or not, oldest first.
+func Merges(ctx context.Context, store Datastore, into string) ([]MergeRecord, error) {
+	records, err := store.GetRecords(ctx, MergeResource.Name)
+	if err != nil {
+		return nil, err
+	}
+	merges := []MergeRecord{}
+	for _, r := range records {
+		m, err := mergeFromRecord(r)
+		if err != nil {
+			return nil, err
+		}
+		if m.Into == into {
+			merges = append(merges, m)
+		}
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].StartedAt.Before(merges[j].StartedAt) })
+	return merges, nil
+}
+
+/*
+Merge - folds the Product with ID from, a duplicate, into the one with ID into: its reviews move across (keeping
+their IDs, and updating into's Rating), its variants move across too, except that one with the same size and color
+as one of into's has its stock added to that variant instead, its stock at each warehouse location is added to
+into's, and then the duplicate is deleted. into's own fields are kept as they are.
+
+The merge is recorded in MergeResource as it goes, and the record is kept afterwards, with the stock that was moved.
+It isn't atomic: if it fails partway, whatever was moved stays moved and the duplicate is kept, so the merge can be
+run again to finish it. Nothing is moved twice. Reviews and variants that were moved already are found under into,
+and stock is taken from the duplicate before it's added to into, with the move recorded first, so a merge finishing
+it adds the stock only if into's is still what it was before. If into's stock there changes for some other reason in
+between, the move is taken as done and that stock is lost, so don't merge Products while they're being ordered.
+Reservations of the duplicate's variants aren't moved, so they should be left to expire first.
+*/
+func Merge(ctx context.Context, store Datastore, into, from string) (MergeResult, error) {
+	if into == from {
+		return MergeResult{}, errors.New("A product can't be merged into itself")
+	}
+	if err := store.GetProduct(IDsOnly(ctx), &Product{Id: into}); err != nil {
+		return MergeResult{}, err
+	}
+	if err := store.GetProduct(IDsOnly(ctx), &Product{Id: from}); err != nil {
+		return MergeResult{}, err
+	}
+	m, err := startMerge(ctx, store, into, from)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	if m.Pending != nil {
+		if err := finishMove(ctx, store, &m); err != nil {
+			return m.MergeResult, err
+		}
+	}
+
+	reviews, err := store.GetReviews(ctx, from)
+	if err != nil {
+		return m.MergeResult, err
+	}
+	for _, review := range reviews {
+		moved := review
+		moved.ProductId = into
+		if err := store.AddReview(ctx, moved); err != nil && !errors.Is(err, ErrConflict) {
+			return m.MergeResult, fmt.Errorf("Error moving review %v: %w", review.Id, err)
+		}
+		if err := store.DeleteReview(ctx, review); err != nil {
+			return m.MergeResult, fmt.Errorf("Error moving review %v: %w", review.Id, err)
+		}
+		m.Reviews++
+	}
+
+	existing, err := store.GetVariants(ctx, into)
+	if err != nil {
+		return m.MergeResult, err
+	}
+	matches, ids := map[string]*Variant{}, map[string]bool{}
+	for i := range existing {
+		matches[variantKey(existing[i])] = &existing[i]
+		ids[existing[i].Id] = true
+	}
+	variants, err := store.GetVariants(ctx, from)
+	if err != nil {
+		return m.MergeResult, err
+	}
+	for _, variant := range variants {
+		match, ok := matches[variantKey(variant)]
+		switch {
+		case ids[variant.Id]:
+			// Moved by an earlier attempt that failed before deleting the original.
+			m.Variants++
+		case ok:
+			m.Pending = &StockMove{Variant: variant.Id, Target: match.Id, Quantity: variant.Stock, Before: match.Stock}
+			if err := finishMove(ctx, store, &m); err != nil {
+				return m.MergeResult, fmt.Errorf("Error combining variant %v with %v: %w", variant.Id, match.Id, err)
+			}
+			match.Stock += variant.Stock
+			continue
+		default:
+			moved := variant
+			moved.ProductId = into
+			if err := store.AddVariant(ctx, moved); err != nil {
+				return m.MergeResult, fmt.Errorf("Error moving variant %v: %w", variant.Id, err)
+			}
+			matches[variantKey(moved)] = &moved
+			m.Variants++
+		}
+		if err := store.DeleteVariant(ctx, variant); err != nil {
+			return m.MergeResult, fmt.Errorf("Error moving variant %v: %w", variant.Id, err)
+		}
+	}
+
+	duplicate, target := Product{Id: from}, Product{Id: into}
+	if err := store.GetProduct(WithFields(ctx, []string{FieldStock}), &duplicate); err != nil {
+		return m.MergeResult, err
+	}
+	if err := store.GetProduct(WithFields(ctx, []string{FieldStock}), &target); err != nil {
+		return m.MergeResult, err
+	}
+	for _, location := range sortedLocations(duplicate.Stock) {
+		quantity := duplicate.Stock[location]
+		if quantity <= 0 {
+			continue
+		}
+		m.Pending = &StockMove{Location: location, Quantity: quantity, Before: target.Stock[location]}
+		if err := finishMove(ctx, store, &m); err != nil {
+			return m.MergeResult, fmt.Errorf("Error moving stock at location %v: %w", location, err)
+		}
+	}
+
+	if err := store.DeleteProduct(ctx, Product{Id: from}); err != nil && !errors.Is(err, ErrNotFound) {
+		return m.MergeResult, err
+	}
+	finished := time.Now().UTC()
+	m.FinishedAt = &finished
+	return m.MergeResult, saveMerge(ctx, store, m)
+}
+
+/*
+startMerge - local helper function that returns the unfinished merge of from into into, to carry on with, or else
+records a new one. A duplicate that's part way through being merged into another Product can't be merged elsewhere
+until that merge is finished.
+*/
+func startMerge(ctx context.Context, store Datastore, into, from string) (MergeRecord, error) {
+	records, err := store.GetRecords(ctx, MergeResource.Name)
+	if err != nil {
+		return MergeRecord{}, err
+	}
+	for _, r := range records {
+		m, err := mergeFromRecord(r)
+		if err != nil {
+			return MergeRecord{}, err
+		}
+		switch {
+		case m.FinishedAt != nil || m.From != from:
+		case m.Into != into:
+			return MergeRecord{}, Errorf("merge_in_progress", "Product %v is part way through being merged into %v; "+
+				"finish that merge first: %w", from, m.Into, ErrConflict)
+		default:
+			return m, nil
+		}
+	}
+
+	m := MergeRecord{Into: into, From: from, StartedAt: time.Now().UTC()}
+	if m.Id, err = NewUUID(); err != nil {
+		return m, err
+	}
+	r, err := m.record()
+	if err != nil {
+		return m, err
+	}
+	return m, store.AddRecord(ctx, MergeResource.Name, r)
+}
+
+// saveMerge - local helper function that stores how far the merge has got.
+func saveMerge(ctx context.Context, store Datastore, m MergeRecord) error {
+	r, err := m.record()
+	if err != nil {
+		return err
+	}
+	if err := store.UpdateRecord(ctx, MergeResource.Name, r); err != nil {
+		return fmt.Errorf("Error recording merge %v: %w", m.Id, err)
+	}
+	return nil
+}
+
+/*
+finishMove - local helper function that makes m.Pending: records it, takes the stock from the duplicate unless it's
+gone already, and adds it to into unless into's stock there has changed since the move was recorded, which means it
+was added before.
+*/
+func finishMove(ctx context.Context, store Datastore, m *MergeRecord) error {
+	move := *m.Pending
+	if err := saveMerge(ctx, store, *m); err != nil {
+		return err
+	}
+
+	if move.Variant != "" {
+		if err := store.DeleteVariant(ctx, Variant{Id: move.Variant, ProductId: m.From}); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		target := Variant{Id: move.Target, ProductId: m.Into}
+		if err := store.GetVariant(ctx, &target); err != nil {
+			return err
+		}
+		if target.Stock == move.Before {
+			target.Stock += move.Quantity
+			if err := store.UpdateVariant(ctx, target); err != nil {
+				return err
+			}
+		}
+		m.Combined++
+	} else {
+		duplicate, target := Product{Id: m.From}, Product{Id: m.Into}
+		if err := store.GetProduct(WithFields(ctx, []string{FieldStock}), &duplicate); err != nil {
+			return err
+		}
+		if duplicate.Stock[move.Location] == move.Quantity {
+			if _, err := store.AdjustStock(ctx, m.From, move.Location, -move.Quantity); err != nil {
+				return err
+			}
+		}
+		if err := store.GetProduct(WithFields(ctx, []string{FieldStock}), &target); err != nil {
+			return err
+		}
+		if target.Stock[move.Location] == move.Before {
+			if _, err := store.AdjustStock(ctx, m.Into, move.Location, move.Quantity); err != nil {
+				return err
+			}
+		}
+		m.Stock += move.Quantity
+	}
+
+	m.Moved = append(m.Moved, move)
+	m.Pending = nil
+	return saveMerge(ctx, store, *m)
+}
+
+// sortedLocations - local helper function that lists the locations of stock in order, so merges move it in order.
+func sortedLocations(stock StockLevels) []string {
+	locations := make([]string, 0, len(stock))
+	for location := range stock {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// variantKey - local helper function that identifies a variant by its size and color, ignoring case.
+func variantKey(v Variant) string {
+	return strings.ToLower(v.Size) + "\x00" + strings.ToLower(v.Color)
+}
@@ -0,0 +1,2790 @@
+// Code generated by mockery. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	datastore "github.com/bamajap/go-basic-api-app/datastore"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Datastore is an autogenerated mock type for the Datastore type
+type Datastore struct {
+	mock.Mock
+}
+
+type Datastore_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *Datastore) EXPECT() *Datastore_Expecter {
+	return &Datastore_Expecter{mock: &_m.Mock}
+}
+
+// AddOrder provides a mock function with given fields: ctx, order
+func (_m *Datastore) AddOrder(ctx context.Context, order datastore.Order) error {
+	ret := _m.Called(ctx, order)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddOrder")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Order) error); ok {
+		r0 = rf(ctx, order)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddOrder_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddOrder'
+type Datastore_AddOrder_Call struct {
+	*mock.Call
+}
+
+// AddOrder is a helper method to define mock.On call
+//   - ctx context.Context
+//   - order datastore.Order
+func (_e *Datastore_Expecter) AddOrder(ctx interface{}, order interface{}) *Datastore_AddOrder_Call {
+	return &Datastore_AddOrder_Call{Call: _e.mock.On("AddOrder", ctx, order)}
+}
+
+func (_c *Datastore_AddOrder_Call) Run(run func(ctx context.Context, order datastore.Order)) *Datastore_AddOrder_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Order))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddOrder_Call) Return(_a0 error) *Datastore_AddOrder_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddOrder_Call) RunAndReturn(run func(context.Context, datastore.Order) error) *Datastore_AddOrder_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddProduct provides a mock function with given fields: ctx, p
+func (_m *Datastore) AddProduct(ctx context.Context, p datastore.Product) error {
+	ret := _m.Called(ctx, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddProduct")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Product) error); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddProduct_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddProduct'
+type Datastore_AddProduct_Call struct {
+	*mock.Call
+}
+
+// AddProduct is a helper method to define mock.On call
+//   - ctx context.Context
+//   - p datastore.Product
+func (_e *Datastore_Expecter) AddProduct(ctx interface{}, p interface{}) *Datastore_AddProduct_Call {
+	return &Datastore_AddProduct_Call{Call: _e.mock.On("AddProduct", ctx, p)}
+}
+
+func (_c *Datastore_AddProduct_Call) Run(run func(ctx context.Context, p datastore.Product)) *Datastore_AddProduct_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddProduct_Call) Return(_a0 error) *Datastore_AddProduct_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddProduct_Call) RunAndReturn(run func(context.Context, datastore.Product) error) *Datastore_AddProduct_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddProducts provides a mock function with given fields: ctx, products
+func (_m *Datastore) AddProducts(ctx context.Context, products []datastore.Product) error {
+	ret := _m.Called(ctx, products)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddProducts")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []datastore.Product) error); ok {
+		r0 = rf(ctx, products)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddProducts_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddProducts'
+type Datastore_AddProducts_Call struct {
+	*mock.Call
+}
+
+// AddProducts is a helper method to define mock.On call
+//   - ctx context.Context
+//   - products []datastore.Product
+func (_e *Datastore_Expecter) AddProducts(ctx interface{}, products interface{}) *Datastore_AddProducts_Call {
+	return &Datastore_AddProducts_Call{Call: _e.mock.On("AddProducts", ctx, products)}
+}
+
+func (_c *Datastore_AddProducts_Call) Run(run func(ctx context.Context, products []datastore.Product)) *Datastore_AddProducts_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddProducts_Call) Return(_a0 error) *Datastore_AddProducts_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddProducts_Call) RunAndReturn(run func(context.Context, []datastore.Product) error) *Datastore_AddProducts_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddRecord provides a mock function with given fields: ctx, resource, record
+func (_m *Datastore) AddRecord(ctx context.Context, resource string, record datastore.Record) error {
+	ret := _m.Called(ctx, resource, record)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, datastore.Record) error); ok {
+		r0 = rf(ctx, resource, record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddRecord_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddRecord'
+type Datastore_AddRecord_Call struct {
+	*mock.Call
+}
+
+// AddRecord is a helper method to define mock.On call
+//   - ctx context.Context
+//   - resource string
+//   - record datastore.Record
+func (_e *Datastore_Expecter) AddRecord(ctx interface{}, resource interface{}, record interface{}) *Datastore_AddRecord_Call {
+	return &Datastore_AddRecord_Call{Call: _e.mock.On("AddRecord", ctx, resource, record)}
+}
+
+func (_c *Datastore_AddRecord_Call) Run(run func(ctx context.Context, resource string, record datastore.Record)) *Datastore_AddRecord_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(datastore.Record))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddRecord_Call) Return(_a0 error) *Datastore_AddRecord_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddRecord_Call) RunAndReturn(run func(context.Context, string, datastore.Record) error) *Datastore_AddRecord_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddReview provides a mock function with given fields: ctx, review
+func (_m *Datastore) AddReview(ctx context.Context, review datastore.Review) error {
+	ret := _m.Called(ctx, review)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddReview")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Review) error); ok {
+		r0 = rf(ctx, review)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddReview_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddReview'
+type Datastore_AddReview_Call struct {
+	*mock.Call
+}
+
+// AddReview is a helper method to define mock.On call
+//   - ctx context.Context
+//   - review datastore.Review
+func (_e *Datastore_Expecter) AddReview(ctx interface{}, review interface{}) *Datastore_AddReview_Call {
+	return &Datastore_AddReview_Call{Call: _e.mock.On("AddReview", ctx, review)}
+}
+
+func (_c *Datastore_AddReview_Call) Run(run func(ctx context.Context, review datastore.Review)) *Datastore_AddReview_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Review))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddReview_Call) Return(_a0 error) *Datastore_AddReview_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddReview_Call) RunAndReturn(run func(context.Context, datastore.Review) error) *Datastore_AddReview_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddUser provides a mock function with given fields: ctx, user
+func (_m *Datastore) AddUser(ctx context.Context, user datastore.User) error {
+	ret := _m.Called(ctx, user)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddUser'
+type Datastore_AddUser_Call struct {
+	*mock.Call
+}
+
+// AddUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - user datastore.User
+func (_e *Datastore_Expecter) AddUser(ctx interface{}, user interface{}) *Datastore_AddUser_Call {
+	return &Datastore_AddUser_Call{Call: _e.mock.On("AddUser", ctx, user)}
+}
+
+func (_c *Datastore_AddUser_Call) Run(run func(ctx context.Context, user datastore.User)) *Datastore_AddUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.User))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddUser_Call) Return(_a0 error) *Datastore_AddUser_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddUser_Call) RunAndReturn(run func(context.Context, datastore.User) error) *Datastore_AddUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddVariant provides a mock function with given fields: ctx, variant
+func (_m *Datastore) AddVariant(ctx context.Context, variant datastore.Variant) error {
+	ret := _m.Called(ctx, variant)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddVariant")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Variant) error); ok {
+		r0 = rf(ctx, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AddVariant_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddVariant'
+type Datastore_AddVariant_Call struct {
+	*mock.Call
+}
+
+// AddVariant is a helper method to define mock.On call
+//   - ctx context.Context
+//   - variant datastore.Variant
+func (_e *Datastore_Expecter) AddVariant(ctx interface{}, variant interface{}) *Datastore_AddVariant_Call {
+	return &Datastore_AddVariant_Call{Call: _e.mock.On("AddVariant", ctx, variant)}
+}
+
+func (_c *Datastore_AddVariant_Call) Run(run func(ctx context.Context, variant datastore.Variant)) *Datastore_AddVariant_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Variant))
+	})
+	return _c
+}
+
+func (_c *Datastore_AddVariant_Call) Return(_a0 error) *Datastore_AddVariant_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AddVariant_Call) RunAndReturn(run func(context.Context, datastore.Variant) error) *Datastore_AddVariant_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AdjustStock provides a mock function with given fields: ctx, id, location, delta
+func (_m *Datastore) AdjustStock(ctx context.Context, id string, location string, delta int) (datastore.Product, error) {
+	ret := _m.Called(ctx, id, location, delta)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AdjustStock")
+	}
+
+	var r0 datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) (datastore.Product, error)); ok {
+		return rf(ctx, id, location, delta)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) datastore.Product); ok {
+		r0 = rf(ctx, id, location, delta)
+	} else {
+		r0 = ret.Get(0).(datastore.Product)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, id, location, delta)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_AdjustStock_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AdjustStock'
+type Datastore_AdjustStock_Call struct {
+	*mock.Call
+}
+
+// AdjustStock is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+//   - location string
+//   - delta int
+func (_e *Datastore_Expecter) AdjustStock(ctx interface{}, id interface{}, location interface{}, delta interface{}) *Datastore_AdjustStock_Call {
+	return &Datastore_AdjustStock_Call{Call: _e.mock.On("AdjustStock", ctx, id, location, delta)}
+}
+
+func (_c *Datastore_AdjustStock_Call) Run(run func(ctx context.Context, id string, location string, delta int)) *Datastore_AdjustStock_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int))
+	})
+	return _c
+}
+
+func (_c *Datastore_AdjustStock_Call) Return(_a0 datastore.Product, _a1 error) *Datastore_AdjustStock_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_AdjustStock_Call) RunAndReturn(run func(context.Context, string, string, int) (datastore.Product, error)) *Datastore_AdjustStock_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AdvanceID provides a mock function with given fields: ctx, id
+func (_m *Datastore) AdvanceID(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AdvanceID")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_AdvanceID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AdvanceID'
+type Datastore_AdvanceID_Call struct {
+	*mock.Call
+}
+
+// AdvanceID is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+func (_e *Datastore_Expecter) AdvanceID(ctx interface{}, id interface{}) *Datastore_AdvanceID_Call {
+	return &Datastore_AdvanceID_Call{Call: _e.mock.On("AdvanceID", ctx, id)}
+}
+
+func (_c *Datastore_AdvanceID_Call) Run(run func(ctx context.Context, id string)) *Datastore_AdvanceID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_AdvanceID_Call) Return(_a0 error) *Datastore_AdvanceID_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_AdvanceID_Call) RunAndReturn(run func(context.Context, string) error) *Datastore_AdvanceID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CheckUnique provides a mock function with given fields: ctx, products
+func (_m *Datastore) CheckUnique(ctx context.Context, products []datastore.Product) error {
+	ret := _m.Called(ctx, products)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CheckUnique")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []datastore.Product) error); ok {
+		r0 = rf(ctx, products)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_CheckUnique_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CheckUnique'
+type Datastore_CheckUnique_Call struct {
+	*mock.Call
+}
+
+// CheckUnique is a helper method to define mock.On call
+//   - ctx context.Context
+//   - products []datastore.Product
+func (_e *Datastore_Expecter) CheckUnique(ctx interface{}, products interface{}) *Datastore_CheckUnique_Call {
+	return &Datastore_CheckUnique_Call{Call: _e.mock.On("CheckUnique", ctx, products)}
+}
+
+func (_c *Datastore_CheckUnique_Call) Run(run func(ctx context.Context, products []datastore.Product)) *Datastore_CheckUnique_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_CheckUnique_Call) Return(_a0 error) *Datastore_CheckUnique_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_CheckUnique_Call) RunAndReturn(run func(context.Context, []datastore.Product) error) *Datastore_CheckUnique_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Count provides a mock function with given fields: ctx, filter
+func (_m *Datastore) Count(ctx context.Context, filter datastore.Filter) (int, error) {
+	ret := _m.Called(ctx, filter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Count")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Filter) (int, error)); ok {
+		return rf(ctx, filter)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Filter) int); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, datastore.Filter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_Count_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Count'
+type Datastore_Count_Call struct {
+	*mock.Call
+}
+
+// Count is a helper method to define mock.On call
+//   - ctx context.Context
+//   - filter datastore.Filter
+func (_e *Datastore_Expecter) Count(ctx interface{}, filter interface{}) *Datastore_Count_Call {
+	return &Datastore_Count_Call{Call: _e.mock.On("Count", ctx, filter)}
+}
+
+func (_c *Datastore_Count_Call) Run(run func(ctx context.Context, filter datastore.Filter)) *Datastore_Count_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Filter))
+	})
+	return _c
+}
+
+func (_c *Datastore_Count_Call) Return(_a0 int, _a1 error) *Datastore_Count_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_Count_Call) RunAndReturn(run func(context.Context, datastore.Filter) (int, error)) *Datastore_Count_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteCart provides a mock function with given fields: ctx, id
+func (_m *Datastore) DeleteCart(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteCart")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteCart_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteCart'
+type Datastore_DeleteCart_Call struct {
+	*mock.Call
+}
+
+// DeleteCart is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+func (_e *Datastore_Expecter) DeleteCart(ctx interface{}, id interface{}) *Datastore_DeleteCart_Call {
+	return &Datastore_DeleteCart_Call{Call: _e.mock.On("DeleteCart", ctx, id)}
+}
+
+func (_c *Datastore_DeleteCart_Call) Run(run func(ctx context.Context, id string)) *Datastore_DeleteCart_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteCart_Call) Return(_a0 error) *Datastore_DeleteCart_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteCart_Call) RunAndReturn(run func(context.Context, string) error) *Datastore_DeleteCart_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteOutbox provides a mock function with given fields: ctx, changes
+func (_m *Datastore) DeleteOutbox(ctx context.Context, changes []datastore.Change) error {
+	ret := _m.Called(ctx, changes)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteOutbox")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []datastore.Change) error); ok {
+		r0 = rf(ctx, changes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteOutbox_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteOutbox'
+type Datastore_DeleteOutbox_Call struct {
+	*mock.Call
+}
+
+// DeleteOutbox is a helper method to define mock.On call
+//   - ctx context.Context
+//   - changes []datastore.Change
+func (_e *Datastore_Expecter) DeleteOutbox(ctx interface{}, changes interface{}) *Datastore_DeleteOutbox_Call {
+	return &Datastore_DeleteOutbox_Call{Call: _e.mock.On("DeleteOutbox", ctx, changes)}
+}
+
+func (_c *Datastore_DeleteOutbox_Call) Run(run func(ctx context.Context, changes []datastore.Change)) *Datastore_DeleteOutbox_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]datastore.Change))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteOutbox_Call) Return(_a0 error) *Datastore_DeleteOutbox_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteOutbox_Call) RunAndReturn(run func(context.Context, []datastore.Change) error) *Datastore_DeleteOutbox_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteProduct provides a mock function with given fields: ctx, p
+func (_m *Datastore) DeleteProduct(ctx context.Context, p datastore.Product) error {
+	ret := _m.Called(ctx, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteProduct")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Product) error); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteProduct_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteProduct'
+type Datastore_DeleteProduct_Call struct {
+	*mock.Call
+}
+
+// DeleteProduct is a helper method to define mock.On call
+//   - ctx context.Context
+//   - p datastore.Product
+func (_e *Datastore_Expecter) DeleteProduct(ctx interface{}, p interface{}) *Datastore_DeleteProduct_Call {
+	return &Datastore_DeleteProduct_Call{Call: _e.mock.On("DeleteProduct", ctx, p)}
+}
+
+func (_c *Datastore_DeleteProduct_Call) Run(run func(ctx context.Context, p datastore.Product)) *Datastore_DeleteProduct_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteProduct_Call) Return(_a0 error) *Datastore_DeleteProduct_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteProduct_Call) RunAndReturn(run func(context.Context, datastore.Product) error) *Datastore_DeleteProduct_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteRecord provides a mock function with given fields: ctx, resource, id
+func (_m *Datastore) DeleteRecord(ctx context.Context, resource string, id string) error {
+	ret := _m.Called(ctx, resource, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, resource, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteRecord_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteRecord'
+type Datastore_DeleteRecord_Call struct {
+	*mock.Call
+}
+
+// DeleteRecord is a helper method to define mock.On call
+//   - ctx context.Context
+//   - resource string
+//   - id string
+func (_e *Datastore_Expecter) DeleteRecord(ctx interface{}, resource interface{}, id interface{}) *Datastore_DeleteRecord_Call {
+	return &Datastore_DeleteRecord_Call{Call: _e.mock.On("DeleteRecord", ctx, resource, id)}
+}
+
+func (_c *Datastore_DeleteRecord_Call) Run(run func(ctx context.Context, resource string, id string)) *Datastore_DeleteRecord_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteRecord_Call) Return(_a0 error) *Datastore_DeleteRecord_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteRecord_Call) RunAndReturn(run func(context.Context, string, string) error) *Datastore_DeleteRecord_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteReview provides a mock function with given fields: ctx, review
+func (_m *Datastore) DeleteReview(ctx context.Context, review datastore.Review) error {
+	ret := _m.Called(ctx, review)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteReview")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Review) error); ok {
+		r0 = rf(ctx, review)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteReview_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteReview'
+type Datastore_DeleteReview_Call struct {
+	*mock.Call
+}
+
+// DeleteReview is a helper method to define mock.On call
+//   - ctx context.Context
+//   - review datastore.Review
+func (_e *Datastore_Expecter) DeleteReview(ctx interface{}, review interface{}) *Datastore_DeleteReview_Call {
+	return &Datastore_DeleteReview_Call{Call: _e.mock.On("DeleteReview", ctx, review)}
+}
+
+func (_c *Datastore_DeleteReview_Call) Run(run func(ctx context.Context, review datastore.Review)) *Datastore_DeleteReview_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Review))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteReview_Call) Return(_a0 error) *Datastore_DeleteReview_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteReview_Call) RunAndReturn(run func(context.Context, datastore.Review) error) *Datastore_DeleteReview_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteUser provides a mock function with given fields: ctx, name
+func (_m *Datastore) DeleteUser(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteUser'
+type Datastore_DeleteUser_Call struct {
+	*mock.Call
+}
+
+// DeleteUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Datastore_Expecter) DeleteUser(ctx interface{}, name interface{}) *Datastore_DeleteUser_Call {
+	return &Datastore_DeleteUser_Call{Call: _e.mock.On("DeleteUser", ctx, name)}
+}
+
+func (_c *Datastore_DeleteUser_Call) Run(run func(ctx context.Context, name string)) *Datastore_DeleteUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteUser_Call) Return(_a0 error) *Datastore_DeleteUser_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteUser_Call) RunAndReturn(run func(context.Context, string) error) *Datastore_DeleteUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// DeleteVariant provides a mock function with given fields: ctx, variant
+func (_m *Datastore) DeleteVariant(ctx context.Context, variant datastore.Variant) error {
+	ret := _m.Called(ctx, variant)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteVariant")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Variant) error); ok {
+		r0 = rf(ctx, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_DeleteVariant_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteVariant'
+type Datastore_DeleteVariant_Call struct {
+	*mock.Call
+}
+
+// DeleteVariant is a helper method to define mock.On call
+//   - ctx context.Context
+//   - variant datastore.Variant
+func (_e *Datastore_Expecter) DeleteVariant(ctx interface{}, variant interface{}) *Datastore_DeleteVariant_Call {
+	return &Datastore_DeleteVariant_Call{Call: _e.mock.On("DeleteVariant", ctx, variant)}
+}
+
+func (_c *Datastore_DeleteVariant_Call) Run(run func(ctx context.Context, variant datastore.Variant)) *Datastore_DeleteVariant_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Variant))
+	})
+	return _c
+}
+
+func (_c *Datastore_DeleteVariant_Call) Return(_a0 error) *Datastore_DeleteVariant_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_DeleteVariant_Call) RunAndReturn(run func(context.Context, datastore.Variant) error) *Datastore_DeleteVariant_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ExpiredProducts provides a mock function with given fields: ctx
+func (_m *Datastore) ExpiredProducts(ctx context.Context) ([]datastore.Product, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExpiredProducts")
+	}
+
+	var r0 []datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]datastore.Product, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []datastore.Product); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_ExpiredProducts_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ExpiredProducts'
+type Datastore_ExpiredProducts_Call struct {
+	*mock.Call
+}
+
+// ExpiredProducts is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) ExpiredProducts(ctx interface{}) *Datastore_ExpiredProducts_Call {
+	return &Datastore_ExpiredProducts_Call{Call: _e.mock.On("ExpiredProducts", ctx)}
+}
+
+func (_c *Datastore_ExpiredProducts_Call) Run(run func(ctx context.Context)) *Datastore_ExpiredProducts_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_ExpiredProducts_Call) Return(_a0 []datastore.Product, _a1 error) *Datastore_ExpiredProducts_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_ExpiredProducts_Call) RunAndReturn(run func(context.Context) ([]datastore.Product, error)) *Datastore_ExpiredProducts_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ExpiredReservations provides a mock function with given fields: ctx
+func (_m *Datastore) ExpiredReservations(ctx context.Context) ([]datastore.Reservation, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExpiredReservations")
+	}
+
+	var r0 []datastore.Reservation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]datastore.Reservation, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []datastore.Reservation); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Reservation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_ExpiredReservations_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ExpiredReservations'
+type Datastore_ExpiredReservations_Call struct {
+	*mock.Call
+}
+
+// ExpiredReservations is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) ExpiredReservations(ctx interface{}) *Datastore_ExpiredReservations_Call {
+	return &Datastore_ExpiredReservations_Call{Call: _e.mock.On("ExpiredReservations", ctx)}
+}
+
+func (_c *Datastore_ExpiredReservations_Call) Run(run func(ctx context.Context)) *Datastore_ExpiredReservations_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_ExpiredReservations_Call) Return(_a0 []datastore.Reservation, _a1 error) *Datastore_ExpiredReservations_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_ExpiredReservations_Call) RunAndReturn(run func(context.Context) ([]datastore.Reservation, error)) *Datastore_ExpiredReservations_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Explain provides a mock function with given fields: ctx, query
+func (_m *Datastore) Explain(ctx context.Context, query datastore.ListQuery) (datastore.QueryPlan, error) {
+	ret := _m.Called(ctx, query)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Explain")
+	}
+
+	var r0 datastore.QueryPlan
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.ListQuery) (datastore.QueryPlan, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.ListQuery) datastore.QueryPlan); ok {
+		r0 = rf(ctx, query)
+	} else {
+		r0 = ret.Get(0).(datastore.QueryPlan)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, datastore.ListQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_Explain_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Explain'
+type Datastore_Explain_Call struct {
+	*mock.Call
+}
+
+// Explain is a helper method to define mock.On call
+//   - ctx context.Context
+//   - query datastore.ListQuery
+func (_e *Datastore_Expecter) Explain(ctx interface{}, query interface{}) *Datastore_Explain_Call {
+	return &Datastore_Explain_Call{Call: _e.mock.On("Explain", ctx, query)}
+}
+
+func (_c *Datastore_Explain_Call) Run(run func(ctx context.Context, query datastore.ListQuery)) *Datastore_Explain_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.ListQuery))
+	})
+	return _c
+}
+
+func (_c *Datastore_Explain_Call) Return(_a0 datastore.QueryPlan, _a1 error) *Datastore_Explain_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_Explain_Call) RunAndReturn(run func(context.Context, datastore.ListQuery) (datastore.QueryPlan, error)) *Datastore_Explain_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// FilterProducts provides a mock function with given fields: ctx, expr
+func (_m *Datastore) FilterProducts(ctx context.Context, expr datastore.Expr) ([]datastore.Product, error) {
+	ret := _m.Called(ctx, expr)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FilterProducts")
+	}
+
+	var r0 []datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Expr) ([]datastore.Product, error)); ok {
+		return rf(ctx, expr)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Expr) []datastore.Product); ok {
+		r0 = rf(ctx, expr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, datastore.Expr) error); ok {
+		r1 = rf(ctx, expr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_FilterProducts_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FilterProducts'
+type Datastore_FilterProducts_Call struct {
+	*mock.Call
+}
+
+// FilterProducts is a helper method to define mock.On call
+//   - ctx context.Context
+//   - expr datastore.Expr
+func (_e *Datastore_Expecter) FilterProducts(ctx interface{}, expr interface{}) *Datastore_FilterProducts_Call {
+	return &Datastore_FilterProducts_Call{Call: _e.mock.On("FilterProducts", ctx, expr)}
+}
+
+func (_c *Datastore_FilterProducts_Call) Run(run func(ctx context.Context, expr datastore.Expr)) *Datastore_FilterProducts_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Expr))
+	})
+	return _c
+}
+
+func (_c *Datastore_FilterProducts_Call) Return(_a0 []datastore.Product, _a1 error) *Datastore_FilterProducts_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_FilterProducts_Call) RunAndReturn(run func(context.Context, datastore.Expr) ([]datastore.Product, error)) *Datastore_FilterProducts_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// FindByBarcode provides a mock function with given fields: ctx, code
+func (_m *Datastore) FindByBarcode(ctx context.Context, code string) (datastore.Product, error) {
+	ret := _m.Called(ctx, code)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByBarcode")
+	}
+
+	var r0 datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (datastore.Product, error)); ok {
+		return rf(ctx, code)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) datastore.Product); ok {
+		r0 = rf(ctx, code)
+	} else {
+		r0 = ret.Get(0).(datastore.Product)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_FindByBarcode_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FindByBarcode'
+type Datastore_FindByBarcode_Call struct {
+	*mock.Call
+}
+
+// FindByBarcode is a helper method to define mock.On call
+//   - ctx context.Context
+//   - code string
+func (_e *Datastore_Expecter) FindByBarcode(ctx interface{}, code interface{}) *Datastore_FindByBarcode_Call {
+	return &Datastore_FindByBarcode_Call{Call: _e.mock.On("FindByBarcode", ctx, code)}
+}
+
+func (_c *Datastore_FindByBarcode_Call) Run(run func(ctx context.Context, code string)) *Datastore_FindByBarcode_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_FindByBarcode_Call) Return(_a0 datastore.Product, _a1 error) *Datastore_FindByBarcode_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_FindByBarcode_Call) RunAndReturn(run func(context.Context, string) (datastore.Product, error)) *Datastore_FindByBarcode_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// FindByName provides a mock function with given fields: ctx, name
+func (_m *Datastore) FindByName(ctx context.Context, name string) ([]datastore.Product, error) {
+	ret := _m.Called(ctx, name)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByName")
+	}
+
+	var r0 []datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.Product, error)); ok {
+		return rf(ctx, name)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.Product); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_FindByName_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FindByName'
+type Datastore_FindByName_Call struct {
+	*mock.Call
+}
+
+// FindByName is a helper method to define mock.On call
+//   - ctx context.Context
+//   - name string
+func (_e *Datastore_Expecter) FindByName(ctx interface{}, name interface{}) *Datastore_FindByName_Call {
+	return &Datastore_FindByName_Call{Call: _e.mock.On("FindByName", ctx, name)}
+}
+
+func (_c *Datastore_FindByName_Call) Run(run func(ctx context.Context, name string)) *Datastore_FindByName_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_FindByName_Call) Return(_a0 []datastore.Product, _a1 error) *Datastore_FindByName_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_FindByName_Call) RunAndReturn(run func(context.Context, string) ([]datastore.Product, error)) *Datastore_FindByName_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetAll provides a mock function with given fields: ctx
+func (_m *Datastore) GetAll(ctx context.Context) ([]datastore.Product, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetAll")
+	}
+
+	var r0 []datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]datastore.Product, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []datastore.Product); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetAll_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetAll'
+type Datastore_GetAll_Call struct {
+	*mock.Call
+}
+
+// GetAll is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) GetAll(ctx interface{}) *Datastore_GetAll_Call {
+	return &Datastore_GetAll_Call{Call: _e.mock.On("GetAll", ctx)}
+}
+
+func (_c *Datastore_GetAll_Call) Run(run func(ctx context.Context)) *Datastore_GetAll_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetAll_Call) Return(_a0 []datastore.Product, _a1 error) *Datastore_GetAll_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetAll_Call) RunAndReturn(run func(context.Context) ([]datastore.Product, error)) *Datastore_GetAll_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetCart provides a mock function with given fields: ctx, cart
+func (_m *Datastore) GetCart(ctx context.Context, cart *datastore.Cart) error {
+	ret := _m.Called(ctx, cart)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetCart")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Cart) error); ok {
+		r0 = rf(ctx, cart)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetCart_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetCart'
+type Datastore_GetCart_Call struct {
+	*mock.Call
+}
+
+// GetCart is a helper method to define mock.On call
+//   - ctx context.Context
+//   - cart *datastore.Cart
+func (_e *Datastore_Expecter) GetCart(ctx interface{}, cart interface{}) *Datastore_GetCart_Call {
+	return &Datastore_GetCart_Call{Call: _e.mock.On("GetCart", ctx, cart)}
+}
+
+func (_c *Datastore_GetCart_Call) Run(run func(ctx context.Context, cart *datastore.Cart)) *Datastore_GetCart_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Cart))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetCart_Call) Return(_a0 error) *Datastore_GetCart_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetCart_Call) RunAndReturn(run func(context.Context, *datastore.Cart) error) *Datastore_GetCart_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetChanges provides a mock function with given fields: ctx, after, limit
+func (_m *Datastore) GetChanges(ctx context.Context, after datastore.Change, limit int) ([]datastore.Change, error) {
+	ret := _m.Called(ctx, after, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetChanges")
+	}
+
+	var r0 []datastore.Change
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Change, int) ([]datastore.Change, error)); ok {
+		return rf(ctx, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Change, int) []datastore.Change); ok {
+		r0 = rf(ctx, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Change)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, datastore.Change, int) error); ok {
+		r1 = rf(ctx, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetChanges_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetChanges'
+type Datastore_GetChanges_Call struct {
+	*mock.Call
+}
+
+// GetChanges is a helper method to define mock.On call
+//   - ctx context.Context
+//   - after datastore.Change
+//   - limit int
+func (_e *Datastore_Expecter) GetChanges(ctx interface{}, after interface{}, limit interface{}) *Datastore_GetChanges_Call {
+	return &Datastore_GetChanges_Call{Call: _e.mock.On("GetChanges", ctx, after, limit)}
+}
+
+func (_c *Datastore_GetChanges_Call) Run(run func(ctx context.Context, after datastore.Change, limit int)) *Datastore_GetChanges_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Change), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetChanges_Call) Return(_a0 []datastore.Change, _a1 error) *Datastore_GetChanges_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetChanges_Call) RunAndReturn(run func(context.Context, datastore.Change, int) ([]datastore.Change, error)) *Datastore_GetChanges_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetOrder provides a mock function with given fields: ctx, order
+func (_m *Datastore) GetOrder(ctx context.Context, order *datastore.Order) error {
+	ret := _m.Called(ctx, order)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrder")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Order) error); ok {
+		r0 = rf(ctx, order)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetOrder_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetOrder'
+type Datastore_GetOrder_Call struct {
+	*mock.Call
+}
+
+// GetOrder is a helper method to define mock.On call
+//   - ctx context.Context
+//   - order *datastore.Order
+func (_e *Datastore_Expecter) GetOrder(ctx interface{}, order interface{}) *Datastore_GetOrder_Call {
+	return &Datastore_GetOrder_Call{Call: _e.mock.On("GetOrder", ctx, order)}
+}
+
+func (_c *Datastore_GetOrder_Call) Run(run func(ctx context.Context, order *datastore.Order)) *Datastore_GetOrder_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Order))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetOrder_Call) Return(_a0 error) *Datastore_GetOrder_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetOrder_Call) RunAndReturn(run func(context.Context, *datastore.Order) error) *Datastore_GetOrder_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetPage provides a mock function with given fields: ctx, limit, cursor
+func (_m *Datastore) GetPage(ctx context.Context, limit int, cursor string) (datastore.Page, error) {
+	ret := _m.Called(ctx, limit, cursor)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPage")
+	}
+
+	var r0 datastore.Page
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, string) (datastore.Page, error)); ok {
+		return rf(ctx, limit, cursor)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int, string) datastore.Page); ok {
+		r0 = rf(ctx, limit, cursor)
+	} else {
+		r0 = ret.Get(0).(datastore.Page)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int, string) error); ok {
+		r1 = rf(ctx, limit, cursor)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetPage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetPage'
+type Datastore_GetPage_Call struct {
+	*mock.Call
+}
+
+// GetPage is a helper method to define mock.On call
+//   - ctx context.Context
+//   - limit int
+//   - cursor string
+func (_e *Datastore_Expecter) GetPage(ctx interface{}, limit interface{}, cursor interface{}) *Datastore_GetPage_Call {
+	return &Datastore_GetPage_Call{Call: _e.mock.On("GetPage", ctx, limit, cursor)}
+}
+
+func (_c *Datastore_GetPage_Call) Run(run func(ctx context.Context, limit int, cursor string)) *Datastore_GetPage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetPage_Call) Return(_a0 datastore.Page, _a1 error) *Datastore_GetPage_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetPage_Call) RunAndReturn(run func(context.Context, int, string) (datastore.Page, error)) *Datastore_GetPage_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetProduct provides a mock function with given fields: ctx, product
+func (_m *Datastore) GetProduct(ctx context.Context, product *datastore.Product) error {
+	ret := _m.Called(ctx, product)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetProduct")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Product) error); ok {
+		r0 = rf(ctx, product)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetProduct_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetProduct'
+type Datastore_GetProduct_Call struct {
+	*mock.Call
+}
+
+// GetProduct is a helper method to define mock.On call
+//   - ctx context.Context
+//   - product *datastore.Product
+func (_e *Datastore_Expecter) GetProduct(ctx interface{}, product interface{}) *Datastore_GetProduct_Call {
+	return &Datastore_GetProduct_Call{Call: _e.mock.On("GetProduct", ctx, product)}
+}
+
+func (_c *Datastore_GetProduct_Call) Run(run func(ctx context.Context, product *datastore.Product)) *Datastore_GetProduct_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetProduct_Call) Return(_a0 error) *Datastore_GetProduct_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetProduct_Call) RunAndReturn(run func(context.Context, *datastore.Product) error) *Datastore_GetProduct_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetProducts provides a mock function with given fields: ctx, ids
+func (_m *Datastore) GetProducts(ctx context.Context, ids []string) ([]datastore.Product, []string, error) {
+	ret := _m.Called(ctx, ids)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetProducts")
+	}
+
+	var r0 []datastore.Product
+	var r1 []string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) ([]datastore.Product, []string, error)); ok {
+		return rf(ctx, ids)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []datastore.Product); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) []string); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, []string) error); ok {
+		r2 = rf(ctx, ids)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Datastore_GetProducts_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetProducts'
+type Datastore_GetProducts_Call struct {
+	*mock.Call
+}
+
+// GetProducts is a helper method to define mock.On call
+//   - ctx context.Context
+//   - ids []string
+func (_e *Datastore_Expecter) GetProducts(ctx interface{}, ids interface{}) *Datastore_GetProducts_Call {
+	return &Datastore_GetProducts_Call{Call: _e.mock.On("GetProducts", ctx, ids)}
+}
+
+func (_c *Datastore_GetProducts_Call) Run(run func(ctx context.Context, ids []string)) *Datastore_GetProducts_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetProducts_Call) Return(_a0 []datastore.Product, _a1 []string, _a2 error) *Datastore_GetProducts_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *Datastore_GetProducts_Call) RunAndReturn(run func(context.Context, []string) ([]datastore.Product, []string, error)) *Datastore_GetProducts_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetRecord provides a mock function with given fields: ctx, resource, id
+func (_m *Datastore) GetRecord(ctx context.Context, resource string, id string) (datastore.Record, error) {
+	ret := _m.Called(ctx, resource, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRecord")
+	}
+
+	var r0 datastore.Record
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (datastore.Record, error)); ok {
+		return rf(ctx, resource, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) datastore.Record); ok {
+		r0 = rf(ctx, resource, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(datastore.Record)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, resource, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetRecord_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetRecord'
+type Datastore_GetRecord_Call struct {
+	*mock.Call
+}
+
+// GetRecord is a helper method to define mock.On call
+//   - ctx context.Context
+//   - resource string
+//   - id string
+func (_e *Datastore_Expecter) GetRecord(ctx interface{}, resource interface{}, id interface{}) *Datastore_GetRecord_Call {
+	return &Datastore_GetRecord_Call{Call: _e.mock.On("GetRecord", ctx, resource, id)}
+}
+
+func (_c *Datastore_GetRecord_Call) Run(run func(ctx context.Context, resource string, id string)) *Datastore_GetRecord_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetRecord_Call) Return(_a0 datastore.Record, _a1 error) *Datastore_GetRecord_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetRecord_Call) RunAndReturn(run func(context.Context, string, string) (datastore.Record, error)) *Datastore_GetRecord_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetRecords provides a mock function with given fields: ctx, resource
+func (_m *Datastore) GetRecords(ctx context.Context, resource string) ([]datastore.Record, error) {
+	ret := _m.Called(ctx, resource)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRecords")
+	}
+
+	var r0 []datastore.Record
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.Record, error)); ok {
+		return rf(ctx, resource)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.Record); ok {
+		r0 = rf(ctx, resource)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Record)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, resource)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetRecords_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetRecords'
+type Datastore_GetRecords_Call struct {
+	*mock.Call
+}
+
+// GetRecords is a helper method to define mock.On call
+//   - ctx context.Context
+//   - resource string
+func (_e *Datastore_Expecter) GetRecords(ctx interface{}, resource interface{}) *Datastore_GetRecords_Call {
+	return &Datastore_GetRecords_Call{Call: _e.mock.On("GetRecords", ctx, resource)}
+}
+
+func (_c *Datastore_GetRecords_Call) Run(run func(ctx context.Context, resource string)) *Datastore_GetRecords_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetRecords_Call) Return(_a0 []datastore.Record, _a1 error) *Datastore_GetRecords_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetRecords_Call) RunAndReturn(run func(context.Context, string) ([]datastore.Record, error)) *Datastore_GetRecords_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetReservation provides a mock function with given fields: ctx, reservation
+func (_m *Datastore) GetReservation(ctx context.Context, reservation *datastore.Reservation) error {
+	ret := _m.Called(ctx, reservation)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetReservation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Reservation) error); ok {
+		r0 = rf(ctx, reservation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetReservation_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetReservation'
+type Datastore_GetReservation_Call struct {
+	*mock.Call
+}
+
+// GetReservation is a helper method to define mock.On call
+//   - ctx context.Context
+//   - reservation *datastore.Reservation
+func (_e *Datastore_Expecter) GetReservation(ctx interface{}, reservation interface{}) *Datastore_GetReservation_Call {
+	return &Datastore_GetReservation_Call{Call: _e.mock.On("GetReservation", ctx, reservation)}
+}
+
+func (_c *Datastore_GetReservation_Call) Run(run func(ctx context.Context, reservation *datastore.Reservation)) *Datastore_GetReservation_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Reservation))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetReservation_Call) Return(_a0 error) *Datastore_GetReservation_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetReservation_Call) RunAndReturn(run func(context.Context, *datastore.Reservation) error) *Datastore_GetReservation_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetReview provides a mock function with given fields: ctx, review
+func (_m *Datastore) GetReview(ctx context.Context, review *datastore.Review) error {
+	ret := _m.Called(ctx, review)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetReview")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Review) error); ok {
+		r0 = rf(ctx, review)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetReview_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetReview'
+type Datastore_GetReview_Call struct {
+	*mock.Call
+}
+
+// GetReview is a helper method to define mock.On call
+//   - ctx context.Context
+//   - review *datastore.Review
+func (_e *Datastore_Expecter) GetReview(ctx interface{}, review interface{}) *Datastore_GetReview_Call {
+	return &Datastore_GetReview_Call{Call: _e.mock.On("GetReview", ctx, review)}
+}
+
+func (_c *Datastore_GetReview_Call) Run(run func(ctx context.Context, review *datastore.Review)) *Datastore_GetReview_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Review))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetReview_Call) Return(_a0 error) *Datastore_GetReview_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetReview_Call) RunAndReturn(run func(context.Context, *datastore.Review) error) *Datastore_GetReview_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetReviews provides a mock function with given fields: ctx, productID
+func (_m *Datastore) GetReviews(ctx context.Context, productID string) ([]datastore.Review, error) {
+	ret := _m.Called(ctx, productID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetReviews")
+	}
+
+	var r0 []datastore.Review
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.Review, error)); ok {
+		return rf(ctx, productID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.Review); ok {
+		r0 = rf(ctx, productID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Review)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, productID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetReviews_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetReviews'
+type Datastore_GetReviews_Call struct {
+	*mock.Call
+}
+
+// GetReviews is a helper method to define mock.On call
+//   - ctx context.Context
+//   - productID string
+func (_e *Datastore_Expecter) GetReviews(ctx interface{}, productID interface{}) *Datastore_GetReviews_Call {
+	return &Datastore_GetReviews_Call{Call: _e.mock.On("GetReviews", ctx, productID)}
+}
+
+func (_c *Datastore_GetReviews_Call) Run(run func(ctx context.Context, productID string)) *Datastore_GetReviews_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetReviews_Call) Return(_a0 []datastore.Review, _a1 error) *Datastore_GetReviews_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetReviews_Call) RunAndReturn(run func(context.Context, string) ([]datastore.Review, error)) *Datastore_GetReviews_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetUser provides a mock function with given fields: ctx, user
+func (_m *Datastore) GetUser(ctx context.Context, user *datastore.User) error {
+	ret := _m.Called(ctx, user)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUser'
+type Datastore_GetUser_Call struct {
+	*mock.Call
+}
+
+// GetUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - user *datastore.User
+func (_e *Datastore_Expecter) GetUser(ctx interface{}, user interface{}) *Datastore_GetUser_Call {
+	return &Datastore_GetUser_Call{Call: _e.mock.On("GetUser", ctx, user)}
+}
+
+func (_c *Datastore_GetUser_Call) Run(run func(ctx context.Context, user *datastore.User)) *Datastore_GetUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.User))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetUser_Call) Return(_a0 error) *Datastore_GetUser_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetUser_Call) RunAndReturn(run func(context.Context, *datastore.User) error) *Datastore_GetUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetUsers provides a mock function with given fields: ctx
+func (_m *Datastore) GetUsers(ctx context.Context) ([]datastore.User, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUsers")
+	}
+
+	var r0 []datastore.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]datastore.User, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []datastore.User); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetUsers_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetUsers'
+type Datastore_GetUsers_Call struct {
+	*mock.Call
+}
+
+// GetUsers is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) GetUsers(ctx interface{}) *Datastore_GetUsers_Call {
+	return &Datastore_GetUsers_Call{Call: _e.mock.On("GetUsers", ctx)}
+}
+
+func (_c *Datastore_GetUsers_Call) Run(run func(ctx context.Context)) *Datastore_GetUsers_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetUsers_Call) Return(_a0 []datastore.User, _a1 error) *Datastore_GetUsers_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetUsers_Call) RunAndReturn(run func(context.Context) ([]datastore.User, error)) *Datastore_GetUsers_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetVariant provides a mock function with given fields: ctx, variant
+func (_m *Datastore) GetVariant(ctx context.Context, variant *datastore.Variant) error {
+	ret := _m.Called(ctx, variant)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetVariant")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *datastore.Variant) error); ok {
+		r0 = rf(ctx, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_GetVariant_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetVariant'
+type Datastore_GetVariant_Call struct {
+	*mock.Call
+}
+
+// GetVariant is a helper method to define mock.On call
+//   - ctx context.Context
+//   - variant *datastore.Variant
+func (_e *Datastore_Expecter) GetVariant(ctx interface{}, variant interface{}) *Datastore_GetVariant_Call {
+	return &Datastore_GetVariant_Call{Call: _e.mock.On("GetVariant", ctx, variant)}
+}
+
+func (_c *Datastore_GetVariant_Call) Run(run func(ctx context.Context, variant *datastore.Variant)) *Datastore_GetVariant_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*datastore.Variant))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetVariant_Call) Return(_a0 error) *Datastore_GetVariant_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_GetVariant_Call) RunAndReturn(run func(context.Context, *datastore.Variant) error) *Datastore_GetVariant_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetVariants provides a mock function with given fields: ctx, productID
+func (_m *Datastore) GetVariants(ctx context.Context, productID string) ([]datastore.Variant, error) {
+	ret := _m.Called(ctx, productID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetVariants")
+	}
+
+	var r0 []datastore.Variant
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.Variant, error)); ok {
+		return rf(ctx, productID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.Variant); ok {
+		r0 = rf(ctx, productID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Variant)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, productID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_GetVariants_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetVariants'
+type Datastore_GetVariants_Call struct {
+	*mock.Call
+}
+
+// GetVariants is a helper method to define mock.On call
+//   - ctx context.Context
+//   - productID string
+func (_e *Datastore_Expecter) GetVariants(ctx interface{}, productID interface{}) *Datastore_GetVariants_Call {
+	return &Datastore_GetVariants_Call{Call: _e.mock.On("GetVariants", ctx, productID)}
+}
+
+func (_c *Datastore_GetVariants_Call) Run(run func(ctx context.Context, productID string)) *Datastore_GetVariants_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_GetVariants_Call) Return(_a0 []datastore.Variant, _a1 error) *Datastore_GetVariants_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_GetVariants_Call) RunAndReturn(run func(context.Context, string) ([]datastore.Variant, error)) *Datastore_GetVariants_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NextID provides a mock function with given fields: ctx
+func (_m *Datastore) NextID(ctx context.Context) (string, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for NextID")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (string, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_NextID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'NextID'
+type Datastore_NextID_Call struct {
+	*mock.Call
+}
+
+// NextID is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) NextID(ctx interface{}) *Datastore_NextID_Call {
+	return &Datastore_NextID_Call{Call: _e.mock.On("NextID", ctx)}
+}
+
+func (_c *Datastore_NextID_Call) Run(run func(ctx context.Context)) *Datastore_NextID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_NextID_Call) Return(_a0 string, _a1 error) *Datastore_NextID_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_NextID_Call) RunAndReturn(run func(context.Context) (string, error)) *Datastore_NextID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Outbox provides a mock function with given fields: ctx, limit
+func (_m *Datastore) Outbox(ctx context.Context, limit int) ([]datastore.Change, error) {
+	ret := _m.Called(ctx, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Outbox")
+	}
+
+	var r0 []datastore.Change
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int) ([]datastore.Change, error)); ok {
+		return rf(ctx, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int) []datastore.Change); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Change)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_Outbox_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Outbox'
+type Datastore_Outbox_Call struct {
+	*mock.Call
+}
+
+// Outbox is a helper method to define mock.On call
+//   - ctx context.Context
+//   - limit int
+func (_e *Datastore_Expecter) Outbox(ctx interface{}, limit interface{}) *Datastore_Outbox_Call {
+	return &Datastore_Outbox_Call{Call: _e.mock.On("Outbox", ctx, limit)}
+}
+
+func (_c *Datastore_Outbox_Call) Run(run func(ctx context.Context, limit int)) *Datastore_Outbox_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int))
+	})
+	return _c
+}
+
+func (_c *Datastore_Outbox_Call) Return(_a0 []datastore.Change, _a1 error) *Datastore_Outbox_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_Outbox_Call) RunAndReturn(run func(context.Context, int) ([]datastore.Change, error)) *Datastore_Outbox_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PriceHistory provides a mock function with given fields: ctx, id
+func (_m *Datastore) PriceHistory(ctx context.Context, id string) ([]datastore.PricePoint, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PriceHistory")
+	}
+
+	var r0 []datastore.PricePoint
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.PricePoint, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.PricePoint); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.PricePoint)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_PriceHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PriceHistory'
+type Datastore_PriceHistory_Call struct {
+	*mock.Call
+}
+
+// PriceHistory is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id string
+func (_e *Datastore_Expecter) PriceHistory(ctx interface{}, id interface{}) *Datastore_PriceHistory_Call {
+	return &Datastore_PriceHistory_Call{Call: _e.mock.On("PriceHistory", ctx, id)}
+}
+
+func (_c *Datastore_PriceHistory_Call) Run(run func(ctx context.Context, id string)) *Datastore_PriceHistory_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_PriceHistory_Call) Return(_a0 []datastore.PricePoint, _a1 error) *Datastore_PriceHistory_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_PriceHistory_Call) RunAndReturn(run func(context.Context, string) ([]datastore.PricePoint, error)) *Datastore_PriceHistory_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PutCart provides a mock function with given fields: ctx, cart
+func (_m *Datastore) PutCart(ctx context.Context, cart datastore.Cart) error {
+	ret := _m.Called(ctx, cart)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PutCart")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Cart) error); ok {
+		r0 = rf(ctx, cart)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_PutCart_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutCart'
+type Datastore_PutCart_Call struct {
+	*mock.Call
+}
+
+// PutCart is a helper method to define mock.On call
+//   - ctx context.Context
+//   - cart datastore.Cart
+func (_e *Datastore_Expecter) PutCart(ctx interface{}, cart interface{}) *Datastore_PutCart_Call {
+	return &Datastore_PutCart_Call{Call: _e.mock.On("PutCart", ctx, cart)}
+}
+
+func (_c *Datastore_PutCart_Call) Run(run func(ctx context.Context, cart datastore.Cart)) *Datastore_PutCart_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Cart))
+	})
+	return _c
+}
+
+func (_c *Datastore_PutCart_Call) Return(_a0 error) *Datastore_PutCart_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_PutCart_Call) RunAndReturn(run func(context.Context, datastore.Cart) error) *Datastore_PutCart_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ReleaseReservation provides a mock function with given fields: ctx, reservation
+func (_m *Datastore) ReleaseReservation(ctx context.Context, reservation datastore.Reservation) error {
+	ret := _m.Called(ctx, reservation)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseReservation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Reservation) error); ok {
+		r0 = rf(ctx, reservation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_ReleaseReservation_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ReleaseReservation'
+type Datastore_ReleaseReservation_Call struct {
+	*mock.Call
+}
+
+// ReleaseReservation is a helper method to define mock.On call
+//   - ctx context.Context
+//   - reservation datastore.Reservation
+func (_e *Datastore_Expecter) ReleaseReservation(ctx interface{}, reservation interface{}) *Datastore_ReleaseReservation_Call {
+	return &Datastore_ReleaseReservation_Call{Call: _e.mock.On("ReleaseReservation", ctx, reservation)}
+}
+
+func (_c *Datastore_ReleaseReservation_Call) Run(run func(ctx context.Context, reservation datastore.Reservation)) *Datastore_ReleaseReservation_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Reservation))
+	})
+	return _c
+}
+
+func (_c *Datastore_ReleaseReservation_Call) Return(_a0 error) *Datastore_ReleaseReservation_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_ReleaseReservation_Call) RunAndReturn(run func(context.Context, datastore.Reservation) error) *Datastore_ReleaseReservation_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Reserve provides a mock function with given fields: ctx, reservation
+func (_m *Datastore) Reserve(ctx context.Context, reservation datastore.Reservation) error {
+	ret := _m.Called(ctx, reservation)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Reserve")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Reservation) error); ok {
+		r0 = rf(ctx, reservation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_Reserve_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Reserve'
+type Datastore_Reserve_Call struct {
+	*mock.Call
+}
+
+// Reserve is a helper method to define mock.On call
+//   - ctx context.Context
+//   - reservation datastore.Reservation
+func (_e *Datastore_Expecter) Reserve(ctx interface{}, reservation interface{}) *Datastore_Reserve_Call {
+	return &Datastore_Reserve_Call{Call: _e.mock.On("Reserve", ctx, reservation)}
+}
+
+func (_c *Datastore_Reserve_Call) Run(run func(ctx context.Context, reservation datastore.Reservation)) *Datastore_Reserve_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Reservation))
+	})
+	return _c
+}
+
+func (_c *Datastore_Reserve_Call) Return(_a0 error) *Datastore_Reserve_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_Reserve_Call) RunAndReturn(run func(context.Context, datastore.Reservation) error) *Datastore_Reserve_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SearchByPrefix provides a mock function with given fields: ctx, prefix
+func (_m *Datastore) SearchByPrefix(ctx context.Context, prefix string) ([]datastore.Product, error) {
+	ret := _m.Called(ctx, prefix)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SearchByPrefix")
+	}
+
+	var r0 []datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]datastore.Product, error)); ok {
+		return rf(ctx, prefix)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []datastore.Product); ok {
+		r0 = rf(ctx, prefix)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]datastore.Product)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, prefix)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_SearchByPrefix_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SearchByPrefix'
+type Datastore_SearchByPrefix_Call struct {
+	*mock.Call
+}
+
+// SearchByPrefix is a helper method to define mock.On call
+//   - ctx context.Context
+//   - prefix string
+func (_e *Datastore_Expecter) SearchByPrefix(ctx interface{}, prefix interface{}) *Datastore_SearchByPrefix_Call {
+	return &Datastore_SearchByPrefix_Call{Call: _e.mock.On("SearchByPrefix", ctx, prefix)}
+}
+
+func (_c *Datastore_SearchByPrefix_Call) Run(run func(ctx context.Context, prefix string)) *Datastore_SearchByPrefix_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Datastore_SearchByPrefix_Call) Return(_a0 []datastore.Product, _a1 error) *Datastore_SearchByPrefix_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_SearchByPrefix_Call) RunAndReturn(run func(context.Context, string) ([]datastore.Product, error)) *Datastore_SearchByPrefix_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Truncate provides a mock function with given fields: ctx
+func (_m *Datastore) Truncate(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Truncate")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_Truncate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Truncate'
+type Datastore_Truncate_Call struct {
+	*mock.Call
+}
+
+// Truncate is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *Datastore_Expecter) Truncate(ctx interface{}) *Datastore_Truncate_Call {
+	return &Datastore_Truncate_Call{Call: _e.mock.On("Truncate", ctx)}
+}
+
+func (_c *Datastore_Truncate_Call) Run(run func(ctx context.Context)) *Datastore_Truncate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *Datastore_Truncate_Call) Return(_a0 error) *Datastore_Truncate_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_Truncate_Call) RunAndReturn(run func(context.Context) error) *Datastore_Truncate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateProduct provides a mock function with given fields: ctx, p
+func (_m *Datastore) UpdateProduct(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	ret := _m.Called(ctx, p)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateProduct")
+	}
+
+	var r0 datastore.Product
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Product) (datastore.Product, error)); ok {
+		return rf(ctx, p)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Product) datastore.Product); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Get(0).(datastore.Product)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, datastore.Product) error); ok {
+		r1 = rf(ctx, p)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Datastore_UpdateProduct_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateProduct'
+type Datastore_UpdateProduct_Call struct {
+	*mock.Call
+}
+
+// UpdateProduct is a helper method to define mock.On call
+//   - ctx context.Context
+//   - p datastore.Product
+func (_e *Datastore_Expecter) UpdateProduct(ctx interface{}, p interface{}) *Datastore_UpdateProduct_Call {
+	return &Datastore_UpdateProduct_Call{Call: _e.mock.On("UpdateProduct", ctx, p)}
+}
+
+func (_c *Datastore_UpdateProduct_Call) Run(run func(ctx context.Context, p datastore.Product)) *Datastore_UpdateProduct_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Product))
+	})
+	return _c
+}
+
+func (_c *Datastore_UpdateProduct_Call) Return(_a0 datastore.Product, _a1 error) *Datastore_UpdateProduct_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Datastore_UpdateProduct_Call) RunAndReturn(run func(context.Context, datastore.Product) (datastore.Product, error)) *Datastore_UpdateProduct_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateRecord provides a mock function with given fields: ctx, resource, record
+func (_m *Datastore) UpdateRecord(ctx context.Context, resource string, record datastore.Record) error {
+	ret := _m.Called(ctx, resource, record)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, datastore.Record) error); ok {
+		r0 = rf(ctx, resource, record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_UpdateRecord_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateRecord'
+type Datastore_UpdateRecord_Call struct {
+	*mock.Call
+}
+
+// UpdateRecord is a helper method to define mock.On call
+//   - ctx context.Context
+//   - resource string
+//   - record datastore.Record
+func (_e *Datastore_Expecter) UpdateRecord(ctx interface{}, resource interface{}, record interface{}) *Datastore_UpdateRecord_Call {
+	return &Datastore_UpdateRecord_Call{Call: _e.mock.On("UpdateRecord", ctx, resource, record)}
+}
+
+func (_c *Datastore_UpdateRecord_Call) Run(run func(ctx context.Context, resource string, record datastore.Record)) *Datastore_UpdateRecord_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(datastore.Record))
+	})
+	return _c
+}
+
+func (_c *Datastore_UpdateRecord_Call) Return(_a0 error) *Datastore_UpdateRecord_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_UpdateRecord_Call) RunAndReturn(run func(context.Context, string, datastore.Record) error) *Datastore_UpdateRecord_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateReview provides a mock function with given fields: ctx, old, review
+func (_m *Datastore) UpdateReview(ctx context.Context, old datastore.Review, review datastore.Review) error {
+	ret := _m.Called(ctx, old, review)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateReview")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Review, datastore.Review) error); ok {
+		r0 = rf(ctx, old, review)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_UpdateReview_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateReview'
+type Datastore_UpdateReview_Call struct {
+	*mock.Call
+}
+
+// UpdateReview is a helper method to define mock.On call
+//   - ctx context.Context
+//   - old datastore.Review
+//   - review datastore.Review
+func (_e *Datastore_Expecter) UpdateReview(ctx interface{}, old interface{}, review interface{}) *Datastore_UpdateReview_Call {
+	return &Datastore_UpdateReview_Call{Call: _e.mock.On("UpdateReview", ctx, old, review)}
+}
+
+func (_c *Datastore_UpdateReview_Call) Run(run func(ctx context.Context, old datastore.Review, review datastore.Review)) *Datastore_UpdateReview_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Review), args[2].(datastore.Review))
+	})
+	return _c
+}
+
+func (_c *Datastore_UpdateReview_Call) Return(_a0 error) *Datastore_UpdateReview_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_UpdateReview_Call) RunAndReturn(run func(context.Context, datastore.Review, datastore.Review) error) *Datastore_UpdateReview_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateUser provides a mock function with given fields: ctx, user
+func (_m *Datastore) UpdateUser(ctx context.Context, user datastore.User) error {
+	ret := _m.Called(ctx, user)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateUser")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_UpdateUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateUser'
+type Datastore_UpdateUser_Call struct {
+	*mock.Call
+}
+
+// UpdateUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - user datastore.User
+func (_e *Datastore_Expecter) UpdateUser(ctx interface{}, user interface{}) *Datastore_UpdateUser_Call {
+	return &Datastore_UpdateUser_Call{Call: _e.mock.On("UpdateUser", ctx, user)}
+}
+
+func (_c *Datastore_UpdateUser_Call) Run(run func(ctx context.Context, user datastore.User)) *Datastore_UpdateUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.User))
+	})
+	return _c
+}
+
+func (_c *Datastore_UpdateUser_Call) Return(_a0 error) *Datastore_UpdateUser_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_UpdateUser_Call) RunAndReturn(run func(context.Context, datastore.User) error) *Datastore_UpdateUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateVariant provides a mock function with given fields: ctx, variant
+func (_m *Datastore) UpdateVariant(ctx context.Context, variant datastore.Variant) error {
+	ret := _m.Called(ctx, variant)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateVariant")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, datastore.Variant) error); ok {
+		r0 = rf(ctx, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Datastore_UpdateVariant_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateVariant'
+type Datastore_UpdateVariant_Call struct {
+	*mock.Call
+}
+
+// UpdateVariant is a helper method to define mock.On call
+//   - ctx context.Context
+//   - variant datastore.Variant
+func (_e *Datastore_Expecter) UpdateVariant(ctx interface{}, variant interface{}) *Datastore_UpdateVariant_Call {
+	return &Datastore_UpdateVariant_Call{Call: _e.mock.On("UpdateVariant", ctx, variant)}
+}
+
+func (_c *Datastore_UpdateVariant_Call) Run(run func(ctx context.Context, variant datastore.Variant)) *Datastore_UpdateVariant_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(datastore.Variant))
+	})
+	return _c
+}
+
+func (_c *Datastore_UpdateVariant_Call) Return(_a0 error) *Datastore_UpdateVariant_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Datastore_UpdateVariant_Call) RunAndReturn(run func(context.Context, datastore.Variant) error) *Datastore_UpdateVariant_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewDatastore creates a new instance of Datastore. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewDatastore(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Datastore {
+	mock := &Datastore{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
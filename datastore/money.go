@@ -0,0 +1,192 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MoneyDecimals - the decimal places a Money amount has: enough for every currency's minor unit, and for unit prices
+// below a cent.
+const MoneyDecimals = 4
+
+// moneyScale - how many units of Money make one unit of currency.
+const moneyScale = 10000
+
+/*
+Money - an exact amount of money, as a whole number of ten-thousandths of a currency unit. Unlike a float64, it adds
+and compares without rounding surprises: 0.1 + 0.2 is 0.3. It's written as a plain decimal number everywhere (JSON,
+XML, CSV and DynamoDB), e.g. 0.98, so stored data and clients see the same numbers as before.
+*/
+type Money int64
+
+/*
+ParseMoney - the amount written in s, a decimal number such as "0.98" or "-2". It must be exact: an amount with more
+than MoneyDecimals decimal places is an error rather than being rounded.
+*/
+func ParseMoney(s string) (Money, error) {
+	r, err := parseDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("Amount %v has more than %v decimal places", s, MoneyDecimals)
+	}
+	return moneyFromInt(r.Num(), s)
+}
+
+// MustParseMoney - ParseMoney for amounts written in the code, such as fixtures; it panics if s isn't one.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+/*
+RoundMoney - the amount written in s, rounded half away from zero to MoneyDecimals places. For amounts that were
+stored as floats, which can carry a float's error in their last places.
+*/
+func RoundMoney(s string) (Money, error) {
+	r, err := parseDecimal(s)
+	if err != nil {
+		return 0, err
+	}
+	r.Mul(r, big.NewRat(2*moneyScale, 1))
+	n := new(big.Int).Quo(r.Num(), r.Denom())
+	// n is now twice the amount in Money units, truncated toward zero; adding its sign and halving rounds it.
+	n.Add(n, big.NewInt(int64(n.Sign()))).Quo(n, big.NewInt(2))
+	return moneyFromInt(n, s)
+}
+
+// parseDecimal - local helper function that reads s as an exact decimal number.
+func parseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	// big.Rat also reads fractions, such as "1/3", and hexadecimal, neither of which is an amount, and exponents,
+	// which could make it build enormous numbers.
+	if s == "" || strings.ContainsAny(s, "/xXpPeE_") {
+		return nil, fmt.Errorf("Invalid amount %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("Invalid amount %q", s)
+	}
+	return r, nil
+}
+
+// moneyFromInt - local helper function that checks n is in Money's range.
+func moneyFromInt(n *big.Int, s string) (Money, error) {
+	if !n.IsInt64() {
+		return 0, fmt.Errorf("Amount %v is too large", s)
+	}
+	return Money(n.Int64()), nil
+}
+
+// MoneyFromFloat - f, rounded to MoneyDecimals places. Only for amounts that were floats to begin with.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// Float64 - the amount as a float, for arithmetic that is approximate anyway, such as currency conversion.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// Times - the amount multiplied by a quantity; an error, rather than a wrapped-around amount, if it's too large.
+func (m Money) Times(n int) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(n)))
+	return moneyFromInt(product, fmt.Sprintf("%v times %v", m, n))
+}
+
+// Add - the sum of two amounts; an error, rather than a wrapped-around amount, if it's too large.
+func (m Money) Add(other Money) (Money, error) {
+	sum := m + other
+	if (other > 0 && sum < m) || (other < 0 && sum > m) {
+		return 0, fmt.Errorf("Amount %v + %v is too large", m, other)
+	}
+	return sum, nil
+}
+
+// String - the amount as a decimal number without trailing zeros, e.g. "0.98" or "2".
+func (m Money) String() string {
+	sign := ""
+	u := uint64(m)
+	if m < 0 {
+		sign, u = "-", uint64(-m)
+	}
+	whole := strconv.FormatUint(u/moneyScale, 10)
+	fraction := strings.TrimRight(fmt.Sprintf("%0*d", MoneyDecimals, u%moneyScale), "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// MarshalJSON - the amount as a JSON number.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON - reads a JSON number, or a string holding one. null leaves the amount as it was.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalText - the amount as a decimal number, for XML and CSV.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText - reads a decimal number, from XML or CSV.
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalDynamoDBAttributeValue - the amount as a DynamoDB number, which is itself an exact decimal.
+func (m Money) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberN{Value: m.String()}, nil
+}
+
+/*
+UnmarshalDynamoDBAttributeValue - reads a DynamoDB number. Prices used to be written as floats, some with six
+decimal places, so a stored number is rounded rather than refused.
+*/
+func (m *Money) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return fmt.Errorf("An amount must be stored as a number, not %T", av)
+	}
+	parsed, err := RoundMoney(n.Value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,31 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+/*
+Order - a purchase of one or more Products. Unit prices are copied onto its lines when it's placed, so later price
+changes don't alter it. Like reviews, orders always have UUIDs.
+*/
+type Order struct {
+	XMLName   xml.Name    `json:"-" xml:"order" dynamodbav:"-"`
+	Id        string      `json:"id" xml:"id" dynamodbav:"order_id"`
+	Lines     []OrderLine `json:"lines" xml:"line" dynamodbav:"lines"`
+	Total     Money       `json:"total" xml:"total" dynamodbav:"total"`
+	CreatedAt time.Time   `json:"created_at" xml:"created_at" dynamodbav:"created_at"`
+}
+
+// OrderLine - a quantity of a Product, or of one of its variants, at the unit price when the order was placed.
+type OrderLine struct {
+	ProductId string `json:"product_id" xml:"product_id" dynamodbav:"product_id"`
+	VariantId string `json:"variant_id,omitempty" xml:"variant_id,omitempty" dynamodbav:"variant_id,omitempty"`
+	Quantity  int    `json:"quantity" xml:"quantity" dynamodbav:"quantity"`
+	Price     Money  `json:"price" xml:"price" dynamodbav:"price"`
+	// ReservationId - optional; the reservation holding this line's stock, which the order uses up.
+	ReservationId string `json:"reservation_id,omitempty" xml:"reservation_id,omitempty" dynamodbav:"reservation_id,omitempty"`
+}
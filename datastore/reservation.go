@@ -0,0 +1,28 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+/*
+Reservation - a quantity of a variant's stock held for a caller until ExpiresAt. The stock is taken when the
+reservation is made; an order line naming the reservation uses it up, and otherwise it is released, returning
+the stock, once it expires. Its UUID is the caller's token for it.
+*/
+type Reservation struct {
+	XMLName   xml.Name  `json:"-" xml:"reservation" dynamodbav:"-"`
+	Id        string    `json:"id" xml:"id" dynamodbav:"reservation_id"`
+	ProductId string    `json:"product_id" xml:"product_id" dynamodbav:"product_id"`
+	VariantId string    `json:"variant_id" xml:"variant_id" dynamodbav:"variant_id"`
+	Quantity  int       `json:"quantity" xml:"quantity" dynamodbav:"quantity"`
+	ExpiresAt time.Time `json:"expires_at" xml:"expires_at" dynamodbav:"expires_at,unixtime"`
+}
+
+// Expired - reports whether the hold has lapsed, even if the reservation hasn't been released yet.
+func (r Reservation) Expired() bool {
+	return !r.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,149 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+/*
+Resource - an entity type, besides Product, that is stored and served generically. Registering one with
+RegisterResource is all it takes: each backend keeps its records (in DynamoDB, in a table of each tenant's, next to
+its Products table), and the API serves them at /v1/{Name} and /v1/{Name}/{id}, checking every body against Schema.
+*/
+type Resource struct {
+	// Name - the plural name the resource has in routes and messages, e.g. "categories".
+	Name string
+	// Table - the name of the DynamoDB table its records are kept in, e.g. "Categories"; like the others, each tenant
+	// has its own.
+	Table string
+	// Schema - the JSON Schema a record must match, not counting its id, which is always assigned by the API.
+	Schema *schema.Schema
+	// Hidden - the API doesn't serve the resource at /v1/{Name}, e.g. because it has handlers of its own that check
+	// more than the schema can. Its records are still stored like any other's.
+	Hidden bool
+}
+
+// RecordID - the field of a Record holding its ID, a UUID.
+const RecordID = "id"
+
+/*
+Record - one entity of a Resource: a JSON object, with its ID under RecordID. Numbers are float64, as encoding/json
+decodes them.
+*/
+type Record map[string]interface{}
+
+// Id - the record's ID; "" if it hasn't been given one.
+func (r Record) Id() string {
+	id, _ := r[RecordID].(string)
+	return id
+}
+
+/*
+MarshalXML - a record as a <record> element with an element for each field, in name order. Objects nest, and each
+item of an array is an element named after the field.
+*/
+func (r Record) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "record"
+	return marshalXMLObject(e, start, r)
+}
+
+// marshalXMLObject - local helper function that writes an object's fields as child elements of start.
+func marshalXMLObject(e *xml.Encoder, start xml.StartElement, object map[string]interface{}) error {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := marshalXMLValue(e, xml.StartElement{Name: xml.Name{Local: name}}, object[name]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// marshalXMLValue - local helper function that writes a field's value as the element start.
+func marshalXMLValue(e *xml.Encoder, start xml.StartElement, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return marshalXMLObject(e, start, v)
+	case Record:
+		return marshalXMLObject(e, start, v)
+	case []interface{}:
+		for _, item := range v {
+			if err := marshalXMLValue(e, start, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return e.EncodeElement("", start)
+	}
+	return e.EncodeElement(fmt.Sprint(v), start)
+}
+
+// RecordNotFound - the error for a record that doesn't exist.
+func RecordNotFound(resource, id string) error {
+	return Errorf("record_not_found", "There is no <%v> in %v: %w", id, resource, ErrNotFound)
+}
+
+// RecordExists - the error for a record added with an ID that's taken.
+func RecordExists(resource, id string) error {
+	return Errorf("record_exists", "There is already a <%v> in %v: %w", id, resource, ErrConflict)
+}
+
+// resourceName - the names a Resource can have: lower case, so they fit in a path.
+var resourceName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+var (
+	resourcesMu sync.RWMutex
+	resources   []Resource
+)
+
+/*
+RegisterResource - adds a resource type. Resources are registered before the backend is initialized, usually from
+an init function, since that's when the backend creates their tables. A name or table that is already taken, or a
+resource without a schema, is a programming error, so it panics.
+*/
+func RegisterResource(r Resource) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	if !resourceName.MatchString(r.Name) || r.Table == "" || r.Schema == nil {
+		panic(fmt.Sprintf("datastore: resource %q needs a lower-case name, a table and a schema", r.Name))
+	}
+	for _, other := range resources {
+		if other.Name == r.Name || other.Table == r.Table {
+			panic(fmt.Sprintf("datastore: resource %q is already registered", r.Name))
+		}
+	}
+	resources = append(resources, r)
+}
+
+// Resources - the registered resources, in the order they were registered.
+func Resources() []Resource {
+	resourcesMu.RLock()
+	defer resourcesMu.RUnlock()
+	return append([]Resource{}, resources...)
+}
+
+// LookupResource - the registered resource with the given name.
+func LookupResource(name string) (Resource, bool) {
+	for _, r := range Resources() {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
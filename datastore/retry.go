@@ -0,0 +1,130 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrThrottled - returned (wrapped, along with ErrUnavailable) by a backend that turned a call away because it was
+// too busy. The call wasn't made, so it can be tried again whatever it does.
+var ErrThrottled = errors.New("throttled")
+
+/*
+Idempotent - the Datastore methods that have the same effect made twice as once, so a call that failed partway
+(e.g. timed out after the backend had applied it) can be made again: every read, and the writes that replace what
+was there. The others, such as AddProduct, NextID and the deletes, would fail, or do it again, the second time.
+UpdateProduct isn't one either: each call logs a change, puts it in the outbox and may record a price, so a second
+would publish the event twice and record the price again.
+*/
+var Idempotent = map[string]bool{
+	"GetAll": true, "GetProduct": true, "GetProducts": true, "FindByName": true, "SearchByPrefix": true,
+	"FilterProducts": true, "FindByBarcode": true, "CheckUnique": true, "ExpiredProducts": true, "Explain": true,
+	"GetPage": true, "Count": true, "PriceHistory": true, "GetReviews": true, "GetReview": true, "GetVariants": true,
+	"GetVariant": true, "GetOrder": true, "GetCart": true, "GetReservation": true, "ExpiredReservations": true,
+	"GetUsers": true, "GetUser": true, "GetChanges": true, "Outbox": true,
+	"UpdateVariant": true, "PutCart": true, "AdvanceID": true, "UpdateUser": true,
+	"DeleteOutbox": true, "GetRecords": true, "GetRecord": true, "UpdateRecord": true, "Truncate": true,
+}
+
+/*
+RetryPolicy - how Retrying retries. Retries are limited by a budget as well as per call, so that when a backend is
+struggling every caller's retries together can't multiply the load on it: each call adds BudgetRatio of a retry to
+the budget, up to BudgetMin (which it starts with), and each retry spends one.
+*/
+type RetryPolicy struct {
+	// Attempts - the most times a call is made, including the first.
+	Attempts int
+	// MinBackoff / MaxBackoff - the wait before the first retry, doubling for each one after, up to MaxBackoff. Half
+	// of each wait is random, so callers that failed together don't all retry together.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// BudgetRatio - the retries each call earns, e.g. 0.1 for at most one retry for every ten calls.
+	BudgetRatio float64
+	// BudgetMin - the retries that can be made in a row, however few calls have been made.
+	BudgetMin int
+}
+
+// retryBudget - the retries the policy allows just now.
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64
+	max     float64
+	balance float64
+}
+
+// earn - adds a call's share of a retry.
+func (b *retryBudget) earn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = min(b.balance+b.ratio, b.max)
+}
+
+// spend - takes a retry from the budget, reporting whether there was one.
+func (b *retryBudget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
+
+/*
+Retrying - an Interceptor that retries calls failing with ErrUnavailable, under the policy. A call that isn't
+Idempotent is only retried if the backend says it was throttled, and so wasn't made. A call is never retried past
+its context's deadline, or once its context is done.
+*/
+func Retrying(policy RetryPolicy) Interceptor {
+	budget := &retryBudget{ratio: policy.BudgetRatio, max: float64(policy.BudgetMin), balance: float64(policy.BudgetMin)}
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		budget.earn()
+		err := call(ctx)
+		for attempt := 1; attempt < policy.Attempts && retryable(method, err); attempt++ {
+			delay := backoff(policy, attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return err
+			}
+			if !budget.spend() {
+				return err
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			err = call(ctx)
+		}
+		return err
+	}
+}
+
+// retryable - whether a call to method that failed with err may be made again.
+func retryable(method string, err error) bool {
+	if err == nil || !errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	return Idempotent[method] || errors.Is(err, ErrThrottled)
+}
+
+// backoff - how long to wait before the given retry (the first is 1), with jitter.
+func backoff(policy RetryPolicy, retry int) time.Duration {
+	delay := policy.MinBackoff
+	for i := 1; i < retry && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, policy.MaxBackoff)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,47 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"math"
+	"time"
+)
+
+// Review rating bounds.
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+/*
+Review - a customer's rating of a Product, with an optional comment. Reviews always have UUIDs, whatever the
+Product ID strategy, since there is no natural order to number them in.
+*/
+type Review struct {
+	XMLName   xml.Name  `json:"-" xml:"review" dynamodbav:"-"`
+	Id        string    `json:"id" xml:"id" dynamodbav:"review_id"`
+	ProductId string    `json:"product_id" xml:"product_id" dynamodbav:"product_id"`
+	Rating    int       `json:"rating" xml:"rating" dynamodbav:"rating"`
+	Comment   string    `json:"comment,omitempty" xml:"comment,omitempty" dynamodbav:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" dynamodbav:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at" dynamodbav:"updated_at"`
+}
+
+/*
+Rating - the aggregate of a Product's reviews, shown on the Product. Backends keep the sum and count of the
+ratings alongside the Product, so it costs nothing extra to read.
+*/
+type Rating struct {
+	Average float64 `json:"average" xml:"average"`
+	Count   int     `json:"count" xml:"count"`
+}
+
+// NewRating - the aggregate for a sum of count ratings; nil if there are none.
+func NewRating(sum, count int) *Rating {
+	if count <= 0 {
+		return nil
+	}
+	return &Rating{Average: math.Round(float64(sum)/float64(count)*100) / 100, Count: count}
+}
@@ -0,0 +1,445 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Comparison operators of a filter expression. Ordering (=gt=, =ge=, =lt=, =le=) only applies to prices; =in= and =out=
+take a list of values, e.g. name=in=(Apple,Orange), and every other operator exactly one.
+*/
+const (
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpGreater      = "=gt="
+	OpGreaterEqual = "=ge="
+	OpLess         = "=lt="
+	OpLessEqual    = "=le="
+	OpIn           = "=in="
+	OpNotIn        = "=out="
+)
+
+// FilterFields - the fields a filter expression can compare. Prices are compared as amounts, the rest as strings.
+var FilterFields = []string{FieldName, FieldPrice, FieldBarcode, FieldSupplier, FieldCategory}
+
+/*
+MaxFilterLength / MaxFilterDepth / MaxFilterValues - limits on a filter expression's size, on how deeply it nests
+parentheses, and on how many values =in= and =out= take (DynamoDB's IN takes at most 100).
+*/
+const (
+	MaxFilterLength = 2000
+	MaxFilterDepth  = 8
+	MaxFilterValues = 100
+)
+
+// filterReserved - the characters an unquoted value can't contain.
+const filterReserved = `"'();,=!~<> `
+
+/*
+Expr - a parsed filter expression (see ParseFilter): an And, an Or or a Comparison. Backends translate it into their
+own filter expressions as far as they can, and use Match for the rest.
+*/
+type Expr interface {
+	// Match - whether the Product satisfies the expression.
+	Match(p Product) bool
+	// String - the expression in canonical RSQL, the same for every way of writing it with the same meaning.
+	String() string
+}
+
+// And - satisfied when every one of its expressions is.
+type And []Expr
+
+// Or - satisfied when any one of its expressions is.
+type Or []Expr
+
+/*
+Comparison - compares a field with one or more values. For string fields, a "*" in a value matches any run of
+characters (e.g. name==*pizza* matches names containing "pizza"), and names are compared ignoring case. Amounts
+holds the values of a price comparison, parsed.
+*/
+type Comparison struct {
+	Field   string
+	Op      string
+	Values  []string
+	Amounts []Money
+}
+
+func (e And) Match(p Product) bool {
+	for _, x := range e {
+		if !x.Match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e Or) Match(p Product) bool {
+	for _, x := range e {
+		if x.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Comparison) Match(p Product) bool {
+	if c.Field == FieldPrice {
+		return c.matchPrice(p.Price)
+	}
+	value := FilterValue(p, c.Field)
+	matched := false
+	for _, pattern := range c.Values {
+		if c.Field == FieldName {
+			pattern = strings.ToLower(pattern)
+		}
+		if WildcardMatch(pattern, value) {
+			matched = true
+			break
+		}
+	}
+	if c.Negated() {
+		return !matched
+	}
+	return matched
+}
+
+// matchPrice - local helper function that compares a price with the comparison's amounts.
+func (c Comparison) matchPrice(price Money) bool {
+	switch c.Op {
+	case OpGreater:
+		return price > c.Amounts[0]
+	case OpGreaterEqual:
+		return price >= c.Amounts[0]
+	case OpLess:
+		return price < c.Amounts[0]
+	case OpLessEqual:
+		return price <= c.Amounts[0]
+	}
+	matched := false
+	for _, amount := range c.Amounts {
+		if price == amount {
+			matched = true
+		}
+	}
+	return matched != c.Negated()
+}
+
+// Negated - whether the comparison is satisfied by a value that matches none of its values (!= and =out=).
+func (c Comparison) Negated() bool {
+	return c.Op == OpNotEqual || c.Op == OpNotIn
+}
+
+/*
+FilterValue - the value of a string field that comparisons match against: "" if the Product doesn't have one, and
+for names, lower case.
+*/
+func FilterValue(p Product, field string) string {
+	switch field {
+	case FieldName:
+		return strings.ToLower(p.Name)
+	case FieldBarcode:
+		return p.Barcode
+	case FieldSupplier:
+		return p.SupplierId
+	case FieldCategory:
+		return p.CategoryId
+	}
+	return ""
+}
+
+// WildcardMatch - whether s matches pattern, in which each "*" stands for any run of characters, including none.
+func WildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+func (e And) String() string {
+	parts := make([]string, len(e))
+	for i, x := range e {
+		parts[i] = x.String()
+		if _, ok := x.(Or); ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func (e Or) String() string {
+	parts := make([]string, len(e))
+	for i, x := range e {
+		parts[i] = x.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c Comparison) String() string {
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		values[i] = quoteFilterValue(v)
+	}
+	if c.Op == OpIn || c.Op == OpNotIn {
+		return c.Field + c.Op + "(" + strings.Join(values, ",") + ")"
+	}
+	return c.Field + c.Op + values[0]
+}
+
+// quoteFilterValue - local helper function that writes a value as it can be parsed back.
+func quoteFilterValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, filterReserved) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// ExprFields - the fields an expression compares, each once, e.g. so they can be read even when a response leaves
+// them out.
+func ExprFields(e Expr) []string {
+	fields := []string{}
+	seen := map[string]bool{}
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch e := e.(type) {
+		case And:
+			for _, x := range e {
+				walk(x)
+			}
+		case Or:
+			for _, x := range e {
+				walk(x)
+			}
+		case Comparison:
+			if !seen[e.Field] {
+				seen[e.Field] = true
+				fields = append(fields, e.Field)
+			}
+		}
+	}
+	walk(e)
+	return fields
+}
+
+/*
+ParseFilter - parses an RSQL (FIQL) filter expression, such as "price=gt=1.00;name==*Pizza*". Comparisons are
+written field, operator, value(s); ";" joins them with AND and "," with OR, AND binding tighter, and parentheses
+group. A value that contains spaces or any of "'();,=!~<> is quoted with ' or ", with \ escaping the next character.
+*/
+func ParseFilter(s string) (Expr, error) {
+	if len(s) > MaxFilterLength {
+		return nil, fmt.Errorf("Filter is longer than %v characters", MaxFilterLength)
+	}
+	p := &filterParser{s: s}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("Unexpected %q", p.s[p.pos])
+	}
+	return e, nil
+}
+
+// filterParser - a recursive descent parser over a filter expression.
+type filterParser struct {
+	s     string
+	pos   int
+	depth int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%v (at position %v)", fmt.Sprintf(format, args...), p.pos+1)
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// accept - consumes c if it's next.
+func (p *filterParser) accept(c byte) bool {
+	if p.skipSpace(); p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (Expr, error) {
+	var terms Or
+	for {
+		e, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.accept(',') {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) and() (Expr, error) {
+	var terms And
+	for {
+		e, err := p.constraint()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+		if !p.accept(';') {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) constraint() (Expr, error) {
+	if !p.accept('(') {
+		return p.comparison()
+	}
+	if p.depth++; p.depth > MaxFilterDepth {
+		return nil, p.errorf("Parentheses nest more than %v deep", MaxFilterDepth)
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(')') {
+		return nil, p.errorf("Missing )")
+	}
+	p.depth--
+	return e, nil
+}
+
+func (p *filterParser) comparison() (Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos] == '_' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z') {
+		p.pos++
+	}
+	c := Comparison{Field: p.s[start:p.pos]}
+	known := false
+	for _, f := range FilterFields {
+		known = known || f == c.Field
+	}
+	switch {
+	case c.Field == "":
+		return nil, p.errorf("Expected a field name")
+	case !known:
+		p.pos = start
+		return nil, p.errorf("Unknown field %q; use one of %v", c.Field, strings.Join(FilterFields, ", "))
+	}
+
+	start = p.pos
+	switch {
+	case strings.HasPrefix(p.s[p.pos:], OpEqual), strings.HasPrefix(p.s[p.pos:], OpNotEqual):
+		p.pos += 2
+	case p.pos < len(p.s) && p.s[p.pos] == '=':
+		end := strings.IndexByte(p.s[p.pos+1:], '=')
+		if end < 0 {
+			return nil, p.errorf("Expected an operator")
+		}
+		p.pos += end + 2
+	default:
+		return nil, p.errorf("Expected an operator")
+	}
+	c.Op = p.s[start:p.pos]
+	switch c.Op {
+	case OpEqual, OpNotEqual, OpIn, OpNotIn:
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual:
+		if c.Field != FieldPrice {
+			p.pos = start
+			return nil, p.errorf("%v only compares prices", c.Op)
+		}
+	default:
+		p.pos = start
+		return nil, p.errorf("Unknown operator %q", c.Op)
+	}
+
+	list := c.Op == OpIn || c.Op == OpNotIn
+	if list && !p.accept('(') {
+		return nil, p.errorf("%v takes a list of values in parentheses", c.Op)
+	}
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if c.Values = append(c.Values, v); len(c.Values) > MaxFilterValues {
+			return nil, p.errorf("%v takes at most %v values", c.Op, MaxFilterValues)
+		}
+		if !list || !p.accept(',') {
+			break
+		}
+	}
+	if list && !p.accept(')') {
+		return nil, p.errorf("Missing )")
+	}
+
+	if c.Field == FieldPrice {
+		for _, v := range c.Values {
+			amount, err := ParseMoney(v)
+			if err != nil {
+				return nil, err
+			}
+			c.Amounts = append(c.Amounts, amount)
+		}
+	}
+	return c, nil
+}
+
+// value - a quoted or unquoted value.
+func (p *filterParser) value() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.s) && (p.s[p.pos] == '\'' || p.s[p.pos] == '"') {
+		quote := p.s[p.pos]
+		var b strings.Builder
+		for p.pos++; p.pos < len(p.s); p.pos++ {
+			switch c := p.s[p.pos]; {
+			case c == quote:
+				p.pos++
+				return b.String(), nil
+			case c == '\\' && p.pos+1 < len(p.s):
+				p.pos++
+				b.WriteByte(p.s[p.pos])
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", p.errorf("Unterminated quoted value")
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(filterReserved, rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("Expected a value")
+	}
+	return p.s[start:p.pos], nil
+}
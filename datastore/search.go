@@ -0,0 +1,93 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinNameScore - the lowest NameScore that RankByName counts as a match: roughly one typo in every three letters.
+const MinNameScore = 0.65
+
+/*
+NameScore - how closely a Product name matches a search query, from 0 (nothing alike) to 1 (the same, ignoring
+case). A name containing the query scores 0.9; otherwise the query is compared, by Levenshtein distance, with the
+whole name and with each of its words, and the best of those counts. So "bananna" scores 0.71 against "Bananas".
+*/
+func NameScore(query, name string) float64 {
+	query = strings.ToLower(strings.TrimSpace(query))
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case query == "" || name == "":
+		return 0
+	case query == name:
+		return 1
+	case strings.Contains(name, query):
+		return 0.9
+	}
+
+	best := similarity(query, name)
+	for _, word := range strings.Fields(name) {
+		if s := similarity(query, word); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// similarity - 1 less the edit distance between a and b as a fraction of the longer one's length.
+func similarity(a, b string) float64 {
+	longest := utf8.RuneCountInString(a)
+	if n := utf8.RuneCountInString(b); n > longest {
+		longest = n
+	}
+	return 1 - float64(levenshtein([]rune(a), []rune(b)))/float64(longest)
+}
+
+// levenshtein - the fewest single-letter insertions, deletions and substitutions that turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+/*
+RankByName - the Products whose names match query (a NameScore of at least MinNameScore), best match first. Equal
+matches keep the order they were given in, e.g. price-descending from GetAll.
+*/
+func RankByName(products []Product, query string) []Product {
+	type match struct {
+		product Product
+		score   float64
+	}
+	var matches []match
+	for _, p := range products {
+		if score := NameScore(query, p.Name); score >= MinNameScore {
+			matches = append(matches, match{p, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	ranked := make([]Product, len(matches))
+	for i, m := range matches {
+		ranked[i] = m.product
+	}
+	return ranked
+}
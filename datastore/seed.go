@@ -0,0 +1,113 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+SeedProducts - the Products a new store is seeded with: those in the fixture file at path, or TestProducts when
+path is empty. IDs are assigned in file order to match the active strategy, so any IDs in the file are ignored.
+*/
+func SeedProducts(path string) ([]Product, error) {
+	if path == "" {
+		return TestProducts()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening seed file: %v", err)
+	}
+	defer f.Close()
+
+	var products []Product
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&products); err != nil {
+			return nil, fmt.Errorf("Error reading seed file %v: %v", path, err)
+		}
+	case ".csv":
+		if products, err = readSeedCSV(f); err != nil {
+			return nil, fmt.Errorf("Error reading seed file %v: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown seed file type %q; use .json or .csv", filepath.Ext(path))
+	}
+
+	if err := assignIDs(products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// readSeedCSV - reads Products from CSV with a header row; name and price are required, expires_at is optional.
+func readSeedCSV(r io.Reader) ([]Product, error) {
+	in := csv.NewReader(r)
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	name, hasName := columns["name"]
+	price, hasPrice := columns["price"]
+	if !hasName || !hasPrice {
+		return nil, fmt.Errorf("The header needs name and price columns")
+	}
+	expires, hasExpires := columns["expires_at"]
+
+	products := []Product{}
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			return products, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := in.FieldPos(0)
+
+		p := Product{Name: strings.TrimSpace(record[name])}
+		if p.Price, err = ParseMoney(record[price]); err != nil {
+			return nil, fmt.Errorf("Line %v: invalid price %q", line, record[price])
+		}
+		if hasExpires && strings.TrimSpace(record[expires]) != "" {
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(record[expires]))
+			if err != nil {
+				return nil, fmt.Errorf("Line %v: invalid expires_at %q", line, record[expires])
+			}
+			p.ExpiresAt = &t
+		}
+		products = append(products, p)
+	}
+}
+
+// assignIDs - gives the Products sequential IDs from 1, or UUIDs, depending on the active strategy.
+func assignIDs(products []Product) error {
+	for i := range products {
+		if Strategy == UUIDIDs {
+			id, err := NewUUID()
+			if err != nil {
+				return err
+			}
+			products[i].Id = id
+		} else {
+			products[i].Id = strconv.Itoa(i + 1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SnapshotVersion - the snapshot format written by TakeSnapshot.
+const SnapshotVersion = 1
+
+// restoreBatch - how many new Products Restore adds at a time; the size of a single DynamoDB transaction.
+const restoreBatch = 100
+
+/*
+Snapshot - a portable copy of the whole catalog. It only uses the API's Product representation, so a snapshot
+taken from one backend can be restored into the other.
+*/
+type Snapshot struct {
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	IDStrategy IDStrategy `json:"id_strategy"`
+	Products   []Product  `json:"products"`
+}
+
+// RestoreResult - what Restore changed.
+type RestoreResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// TakeSnapshot - copies every live Product in the store. Expired Products aren't included.
+func TakeSnapshot(ctx context.Context, store Datastore) (Snapshot, error) {
+	products, err := store.GetAll(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{
+		Version:    SnapshotVersion,
+		CreatedAt:  time.Now().UTC(),
+		IDStrategy: Strategy,
+		Products:   products,
+	}, nil
+}
+
+// Validate - checks that the snapshot can be restored into the running app.
+func (snap Snapshot) Validate() error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version %v", snap.Version)
+	}
+	if snap.IDStrategy != Strategy {
+		return fmt.Errorf("The snapshot uses %q IDs but the app is configured for %q", snap.IDStrategy, Strategy)
+	}
+	seen := map[string]bool{}
+	for _, p := range snap.Products {
+		if !Strategy.Valid(p.Id) {
+			return fmt.Errorf("Invalid product ID %q in snapshot", p.Id)
+		}
+		if seen[p.Id] {
+			return fmt.Errorf("Product <%v> appears more than once in the snapshot", p.Id)
+		}
+		seen[p.Id] = true
+		if err := ValidStock(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Restore - writes a snapshot's Products back with their original IDs: existing Products are updated and missing
+ones created. With replace, Products that aren't in the snapshot are deleted, so the catalog matches it exactly.
+Stock is adjusted to the snapshot's levels afterwards, since creates and updates leave it alone. The snapshot must use
+the active ID strategy.
+*/
+func Restore(ctx context.Context, store Datastore, snap Snapshot, replace bool) (RestoreResult, error) {
+	var result RestoreResult
+	if err := snap.Validate(); err != nil {
+		return result, err
+	}
+
+	ids := make([]string, len(snap.Products))
+	inSnapshot := map[string]bool{}
+	highest, highestID := -1, ""
+	for i, p := range snap.Products {
+		inSnapshot[p.Id] = true
+		ids[i] = p.Id
+		if n, err := strconv.Atoi(p.Id); err == nil && n > highest {
+			highest, highestID = n, p.Id
+		}
+	}
+
+	if replace {
+		current, err := store.GetAll(ctx)
+		if err != nil {
+			return result, err
+		}
+		for _, p := range current {
+			if inSnapshot[p.Id] {
+				continue
+			}
+			if err := store.DeleteProduct(ctx, p); err != nil {
+				return result, err
+			}
+			result.Deleted++
+		}
+	}
+
+	_, missing, err := store.GetProducts(IDsOnly(ctx), ids)
+	if err != nil {
+		return result, err
+	}
+	isMissing := map[string]bool{}
+	for _, id := range missing {
+		isMissing[id] = true
+	}
+
+	var create []Product
+	for _, p := range snap.Products {
+		if isMissing[p.Id] {
+			create = append(create, p)
+			continue
+		}
+		stored, err := store.UpdateProduct(ctx, p)
+		if err != nil {
+			return result, err
+		}
+		if err := restoreStock(ctx, store, p.Id, stored.Stock, p.Stock); err != nil {
+			return result, err
+		}
+		result.Updated++
+	}
+	for start := 0; start < len(create); start += restoreBatch {
+		end := start + restoreBatch
+		if end > len(create) {
+			end = len(create)
+		}
+		if err := store.AddProducts(ctx, create[start:end]); err != nil {
+			return result, err
+		}
+		for _, p := range create[start:end] {
+			if err := restoreStock(ctx, store, p.Id, nil, p.Stock); err != nil {
+				return result, err
+			}
+		}
+		result.Created += end - start
+	}
+
+	// Restored sequential IDs mustn't be handed out again to new Products.
+	if highestID != "" {
+		if err := store.AdvanceID(ctx, highestID); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// restoreStock - adjusts a Product's stock from the levels it has to the ones it should.
+func restoreStock(ctx context.Context, store Datastore, id string, have, want StockLevels) error {
+	locations := map[string]bool{}
+	for location := range have {
+		locations[location] = true
+	}
+	for location := range want {
+		locations[location] = true
+	}
+	for location := range locations {
+		if delta := want[location] - have[location]; delta != 0 {
+			if _, err := store.AdjustStock(ctx, id, location, delta); err != nil {
+				return fmt.Errorf("Error restoring the stock of product <%v>: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
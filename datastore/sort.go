@@ -0,0 +1,94 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SortKey - one key of a listing's order: a Product field, ascending unless Desc.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// SortFields - the fields a listing can be sorted by.
+var SortFields = []string{FieldID, FieldName, FieldPrice, FieldExpiresAt, FieldRating}
+
+// DefaultSort - the order of a listing that doesn't ask for one: most expensive first.
+var DefaultSort = []SortKey{{Field: FieldPrice, Desc: true}}
+
+/*
+ParseSort - the keys in s, a comma-separated list of fields, each prefixed with "-" to sort it descending, e.g.
+"price,-name".
+*/
+func ParseSort(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		key := SortKey{Field: strings.TrimPrefix(f, "-"), Desc: strings.HasPrefix(f, "-")}
+		if !slices.Contains(SortFields, key.Field) {
+			return nil, fmt.Errorf("Unknown sort field %q; use %v", key.Field, strings.Join(SortFields, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+/*
+SortProducts - sorts products by the keys in turn, then by ID, so that Products the keys don't tell apart (such as two
+at the same price) always come back in the same order, and pages of a listing neither repeat nor skip them. Names
+compare ignoring case; a Product without an expiry date or a rating sorts after those with one, either way.
+*/
+func SortProducts(products []Product, keys []SortKey) {
+	slices.SortFunc(products, func(a, b Product) int {
+		for _, key := range keys {
+			if c := compareField(a, b, key); c != 0 {
+				return c
+			}
+		}
+		return Strategy.Compare(a.Id, b.Id)
+	})
+}
+
+// compareField - local helper function that orders two Products by a single key.
+func compareField(a, b Product, key SortKey) int {
+	var c int
+	switch key.Field {
+	case FieldName:
+		c = cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case FieldPrice:
+		c = cmp.Compare(a.Price, b.Price)
+	case FieldExpiresAt:
+		if a.ExpiresAt == nil || b.ExpiresAt == nil {
+			return compareMissing(a.ExpiresAt == nil, b.ExpiresAt == nil)
+		}
+		c = a.ExpiresAt.Compare(*b.ExpiresAt)
+	case FieldRating:
+		if a.Rating == nil || b.Rating == nil {
+			return compareMissing(a.Rating == nil, b.Rating == nil)
+		}
+		c = cmp.Compare(a.Rating.Average, b.Rating.Average)
+	default:
+		c = Strategy.Compare(a.Id, b.Id)
+	}
+	if key.Desc {
+		return -c
+	}
+	return c
+}
+
+// compareMissing - local helper function that puts a Product missing an optional field after one that has it.
+func compareMissing(aMissing, bMissing bool) int {
+	switch {
+	case aMissing == bMissing:
+		return 0
+	case aMissing:
+		return 1
+	}
+	return -1
+}
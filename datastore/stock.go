@@ -0,0 +1,114 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+// MaxStockAdjustment - the most a single adjustment can add to (or take from) a Product's stock at a location.
+const MaxStockAdjustment = 1000000000
+
+/*
+StockLevels - how many of a Product are held at each warehouse location, keyed by the ID of its record in the
+"locations" resource. XML has no maps, so there each is a <location id="..."> element.
+*/
+type StockLevels map[string]int
+
+// Total - the Product's stock across every location.
+func (s StockLevels) Total() int {
+	total := 0
+	for _, quantity := range s {
+		total += quantity
+	}
+	return total
+}
+
+// xmlStockLevel - one location's stock, as XML.
+type xmlStockLevel struct {
+	Location string `xml:"id,attr"`
+	Quantity int    `xml:",chardata"`
+}
+
+func (s StockLevels) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	locations := make([]string, 0, len(s))
+	for location := range s {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	list := make([]xmlStockLevel, len(locations))
+	for i, location := range locations {
+		list[i] = xmlStockLevel{location, s[location]}
+	}
+	return e.EncodeElement(struct {
+		Locations []xmlStockLevel `xml:"location"`
+	}{list}, start)
+}
+
+func (s *StockLevels) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var list struct {
+		Locations []xmlStockLevel `xml:"location"`
+	}
+	if err := d.DecodeElement(&list, &start); err != nil {
+		return err
+	}
+	*s = StockLevels{}
+	for _, level := range list.Locations {
+		(*s)[level.Location] = level.Quantity
+	}
+	return nil
+}
+
+// ValidStock - checks a Product's stock levels, as restored from a snapshot: location IDs and no negative quantities.
+func ValidStock(p Product) error {
+	for location, quantity := range p.Stock {
+		if !UUIDIDs.Valid(location) {
+			return fmt.Errorf("Invalid location ID %q in the stock of product <%v>", location, p.Id)
+		}
+		if quantity < 0 {
+			return fmt.Errorf("Product <%v> has a negative stock at location %v", p.Id, location)
+		}
+	}
+	return nil
+}
+
+// Adjusted - a copy of the stock levels with delta added at a location, leaving s as it was.
+func (s StockLevels) Adjusted(location string, delta int) StockLevels {
+	adjusted := make(StockLevels, len(s)+1)
+	for k, v := range s {
+		adjusted[k] = v
+	}
+	adjusted[location] += delta
+	return adjusted
+}
+
+/*
+Allocate - how much of quantity to take from each location: as much as each holds, in order of location ID, until
+it's covered. ok is false if the locations hold less than quantity between them.
+*/
+func (s StockLevels) Allocate(quantity int) (taken map[string]int, ok bool) {
+	locations := make([]string, 0, len(s))
+	for location, held := range s {
+		if held > 0 {
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+
+	taken = map[string]int{}
+	for _, location := range locations {
+		if quantity == 0 {
+			break
+		}
+		take := s[location]
+		if take > quantity {
+			take = quantity
+		}
+		taken[location] = take
+		quantity -= take
+	}
+	return taken, quantity == 0
+}
@@ -0,0 +1,814 @@
+/*
+Author: Jason Payne
+*/
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+/*
+Run - checks that the backend behaves as the Datastore interface says, calling every one of its methods: what each
+returns, the order of listings, and the errors (ErrNotFound, ErrConflict, ...) that the handlers turn into statuses.
+Each group of methods works in a catalog of its own.
+*/
+func Run(t *testing.T, be Backend) {
+	t.Run("Products", func(t *testing.T) { testProducts(t, be) })
+	t.Run("Listings", func(t *testing.T) { testListings(t, be) })
+	t.Run("Uniqueness", func(t *testing.T) { testUniqueness(t, be) })
+	t.Run("Expiry", func(t *testing.T) { testExpiry(t, be) })
+	t.Run("Tenants", func(t *testing.T) { testTenants(t, be) })
+	t.Run("Truncate", func(t *testing.T) { testTruncate(t, be) })
+	t.Run("Changes", func(t *testing.T) { testChanges(t, be) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, be) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, be) })
+	t.Run("Variants", func(t *testing.T) { testVariants(t, be) })
+	t.Run("Stock", func(t *testing.T) { testLocationStock(t, be) })
+	t.Run("Orders", func(t *testing.T) { testOrders(t, be) })
+	t.Run("Carts", func(t *testing.T) { testCarts(t, be) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, be) })
+	t.Run("Records", func(t *testing.T) { testRecords(t, be) })
+}
+
+// check - fails the test if err isn't nil.
+func check(t *testing.T, err error, doing string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%v: %v", doing, err)
+	}
+}
+
+// checkIs - fails the test unless err wraps target.
+func checkIs(t *testing.T, err, target error, doing string) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%v: got error %v, want one wrapping %q", doing, err, target)
+	}
+}
+
+// checkIDs - fails the test unless the Products have exactly the IDs given, in that order.
+func checkIDs(t *testing.T, products []datastore.Product, want []string, doing string) {
+	t.Helper()
+	got := []string{}
+	for _, p := range products {
+		got = append(got, p.Id)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%v: got products %v, want %v", doing, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%v: got products %v, want %v", doing, got, want)
+		}
+	}
+}
+
+// checkProduct - fails the test unless got is want as stored: the same ID, name, price and barcode.
+func checkProduct(t *testing.T, got, want datastore.Product, doing string) {
+	t.Helper()
+	if got.Id != want.Id || got.Name != want.Name || got.Price != want.Price || got.Barcode != want.Barcode {
+		t.Fatalf("%v: got %v (barcode %q), want %v (barcode %q)", doing, got, got.Barcode, want, want.Barcode)
+	}
+}
+
+// money - an amount written in the test.
+func money(amount string) datastore.Money {
+	return datastore.MustParseMoney(amount)
+}
+
+// product - adds a Product with a new ID and the given name and price.
+func product(t *testing.T, store datastore.Datastore, ctx context.Context, name, price string) datastore.Product {
+	t.Helper()
+	id, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	p := datastore.Product{Id: id, Name: name, Price: money(price)}
+	check(t, store.AddProduct(ctx, p), "AddProduct")
+	return p
+}
+
+// ids - the Products' IDs, in the same order.
+func ids(products ...datastore.Product) []string {
+	ids := []string{}
+	for _, p := range products {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+// now - the current time, to the second, as DynamoDB stores expiry times.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// uuid - a new UUID, for the records that always have one.
+func uuid(t *testing.T) string {
+	t.Helper()
+	id, err := datastore.NewUUID()
+	check(t, err, "NewUUID")
+	return id
+}
+
+func testProducts(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	first, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	second, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	if first == second {
+		t.Fatalf("NextID handed out %v twice", first)
+	}
+	if datastore.Strategy == datastore.IntIDs {
+		check(t, store.AdvanceID(ctx, "1000"), "AdvanceID")
+		check(t, store.AdvanceID(ctx, "10"), "AdvanceID below the counter")
+		next, err := store.NextID(ctx)
+		check(t, err, "NextID")
+		if n, _ := strconv.Atoi(next); n <= 1000 {
+			t.Fatalf("NextID after AdvanceID(1000) = %v, want more than 1000", next)
+		}
+	}
+
+	p := datastore.Product{Id: first, Name: "Apple", Price: money("0.98"), Barcode: "4006381333931"}
+	check(t, store.AddProduct(ctx, p), "AddProduct")
+	checkIs(t, store.AddProduct(ctx, p), datastore.ErrConflict, "AddProduct with an ID that's taken")
+
+	got := datastore.Product{Id: p.Id}
+	check(t, store.GetProduct(ctx, &got), "GetProduct")
+	checkProduct(t, got, p, "GetProduct")
+	checkIs(t, store.GetProduct(ctx, &datastore.Product{Id: second}), datastore.ErrNotFound, "GetProduct of a missing product")
+
+	byBarcode, err := store.FindByBarcode(ctx, p.Barcode)
+	check(t, err, "FindByBarcode")
+	checkProduct(t, byBarcode, p, "FindByBarcode")
+	_, err = store.FindByBarcode(ctx, "5901234123457")
+	checkIs(t, err, datastore.ErrNotFound, "FindByBarcode of an unused barcode")
+
+	p.Name, p.Price = "Green Apple", money("1.25")
+	stored, err := store.UpdateProduct(ctx, p)
+	check(t, err, "UpdateProduct")
+	checkProduct(t, stored, p, "UpdateProduct")
+	check(t, store.GetProduct(ctx, &got), "GetProduct after UpdateProduct")
+	checkProduct(t, got, p, "GetProduct after UpdateProduct")
+	// The same price again isn't a change, so it doesn't add to the history.
+	p.Name = "Apple"
+	_, err = store.UpdateProduct(ctx, p)
+	check(t, err, "UpdateProduct")
+	_, err = store.UpdateProduct(ctx, datastore.Product{Id: second, Name: "Ghost", Price: money("1")})
+	checkIs(t, err, datastore.ErrNotFound, "UpdateProduct of a missing product")
+	checkIs(t, store.GetProduct(ctx, &datastore.Product{Id: second}), datastore.ErrNotFound, "GetProduct after UpdateProduct of a missing product")
+
+	history, err := store.PriceHistory(ctx, p.Id)
+	check(t, err, "PriceHistory")
+	if len(history) != 2 || history[0].Price != money("0.98") || history[1].Price != money("1.25") {
+		t.Fatalf("PriceHistory = %+v, want prices 0.98 then 1.25", history)
+	}
+
+	check(t, store.DeleteProduct(ctx, p), "DeleteProduct")
+	checkIs(t, store.GetProduct(ctx, &got), datastore.ErrNotFound, "GetProduct after DeleteProduct")
+	checkIs(t, store.DeleteProduct(ctx, p), datastore.ErrNotFound, "DeleteProduct of a deleted product")
+	_, err = store.FindByBarcode(ctx, p.Barcode)
+	checkIs(t, err, datastore.ErrNotFound, "FindByBarcode after DeleteProduct")
+}
+
+func testListings(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	all, err := store.GetAll(ctx)
+	check(t, err, "GetAll")
+	checkIDs(t, all, nil, "GetAll of an empty catalog")
+
+	orange := product(t, store, ctx, "Orange", "0.75")
+	apple := product(t, store, ctx, "Apple", "0.98")
+	pie := product(t, store, ctx, "apple pie", "6.5")
+	bananas := product(t, store, ctx, "Bananas", "2.25")
+
+	all, err = store.GetAll(ctx)
+	check(t, err, "GetAll")
+	checkIDs(t, all, ids(pie, bananas, apple, orange), "GetAll, in price-descending order")
+
+	found, missing, err := store.GetProducts(ctx, []string{bananas.Id, "999999", orange.Id})
+	check(t, err, "GetProducts")
+	checkIDs(t, found, ids(bananas, orange), "GetProducts, in the order asked for")
+	if len(missing) != 1 || missing[0] != "999999" {
+		t.Fatalf("GetProducts missing = %v, want [999999]", missing)
+	}
+
+	byName, err := store.FindByName(ctx, "APPLE")
+	check(t, err, "FindByName")
+	checkIDs(t, byName, ids(apple), "FindByName, ignoring case")
+	byPrefix, err := store.SearchByPrefix(ctx, "app")
+	check(t, err, "SearchByPrefix")
+	checkIDs(t, byPrefix, ids(pie, apple), "SearchByPrefix, ignoring case, in price-descending order")
+
+	filters := []struct {
+		filter string
+		want   []string
+	}{
+		{"price=gt=1.00", ids(pie, bananas)},
+		{"name==*PIE*", ids(pie)},
+		{"name==*ple", ids(apple)},
+		{"name==app*;price=lt=1", ids(apple)},
+		{"name!=*apple*,price=le=0.75", ids(bananas, orange)},
+		{"price=in=(0.75,6.5);name!=orange", ids(pie)},
+		{"name=out=(orange,bananas)", ids(pie, apple)},
+		{"barcode==''", ids(pie, bananas, apple, orange)},
+	}
+	for _, f := range filters {
+		expr, err := datastore.ParseFilter(f.filter)
+		check(t, err, "ParseFilter")
+		found, err := store.FilterProducts(ctx, expr)
+		check(t, err, "FilterProducts")
+		checkIDs(t, found, f.want, "FilterProducts("+f.filter+"), in price-descending order")
+	}
+
+	counts := []struct {
+		filter datastore.Filter
+		want   int
+	}{
+		{datastore.Filter{}, 4},
+		{datastore.Filter{Name: "bananas"}, 1},
+		{datastore.Filter{NamePrefix: "Apple"}, 2},
+		{datastore.Filter{Name: "Kiwi"}, 0},
+		{datastore.Filter{Expr: datastore.Comparison{Field: datastore.FieldPrice, Op: datastore.OpLess, Amounts: []datastore.Money{money("1")}}}, 2},
+		{datastore.Filter{Expr: datastore.Comparison{Field: datastore.FieldName, Op: datastore.OpEqual, Values: []string{"*ie"}}}, 1},
+	}
+	for _, c := range counts {
+		n, err := store.Count(ctx, c.filter)
+		check(t, err, "Count")
+		if n != c.want {
+			t.Fatalf("Count(%+v) = %v, want %v", c.filter, n, c.want)
+		}
+	}
+
+	// Pages are in storage order, so all that can be checked is that they cover the catalog once.
+	var paged []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("GetPage didn't reach the last page after %v pages", pages)
+		}
+		page, err := store.GetPage(ctx, 3, cursor)
+		check(t, err, "GetPage")
+		if len(page.Products) > 3 {
+			t.Fatalf("GetPage returned %v products, more than the limit of 3", len(page.Products))
+		}
+		paged = append(paged, ids(page.Products...)...)
+		if cursor = page.Cursor; cursor == "" {
+			break
+		}
+	}
+	want := ids(orange, apple, pie, bananas)
+	sort.Strings(paged)
+	sort.Strings(want)
+	if len(paged) != len(want) {
+		t.Fatalf("GetPage returned products %v across its pages, want %v", paged, want)
+	}
+	for i := range paged {
+		if paged[i] != want[i] {
+			t.Fatalf("GetPage returned products %v across its pages, want %v", paged, want)
+		}
+	}
+	_, err = store.GetPage(ctx, 3, "not a cursor!")
+	checkIs(t, err, datastore.ErrInvalidCursor, "GetPage with a cursor it didn't issue")
+
+	plan, err := store.Explain(ctx, datastore.ListQuery{Filter: datastore.Filter{Name: "Apple"}})
+	check(t, err, "Explain")
+	if plan.Operation == "" {
+		t.Fatalf("Explain returned a plan without an operation: %+v", plan)
+	}
+
+	// Products at the same price come in ID order, whatever order the backend read them in.
+	tied := []datastore.Product{apple, product(t, store, ctx, "Kiwi", "0.98"), product(t, store, ctx, "Lime", "0.98")}
+	datastore.SortProducts(tied, nil)
+	all, err = store.GetAll(ctx)
+	check(t, err, "GetAll")
+	checkIDs(t, all, ids(pie, bananas, tied[0], tied[1], tied[2], orange), "GetAll, with ties in ID order")
+}
+
+func testUniqueness(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	taken := product(t, store, ctx, "Apple", "0.98")
+	taken.Barcode = "4006381333931"
+	_, err := store.UpdateProduct(ctx, taken)
+	check(t, err, "UpdateProduct setting a barcode")
+
+	id, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	clash := datastore.Product{Id: id, Name: "Orange", Price: money("0.75"), Barcode: taken.Barcode}
+	checkIs(t, store.CheckUnique(ctx, []datastore.Product{clash}), datastore.ErrConflict, "CheckUnique of a barcode in use")
+	checkIs(t, store.AddProduct(ctx, clash), datastore.ErrConflict, "AddProduct with a barcode in use")
+
+	free := clash
+	free.Barcode = "5901234123457"
+	check(t, store.CheckUnique(ctx, []datastore.Product{free}), "CheckUnique of a free barcode")
+	checkIs(t, store.GetProduct(ctx, &datastore.Product{Id: id}), datastore.ErrNotFound, "GetProduct after CheckUnique")
+
+	// AddProducts is all or nothing: the second Product's barcode is taken, so the first isn't added either.
+	nextID, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	batch := []datastore.Product{free, {Id: nextID, Name: "Pear", Price: money("1.5"), Barcode: taken.Barcode}}
+	checkIs(t, store.AddProducts(ctx, batch), datastore.ErrConflict, "AddProducts with a barcode in use")
+	checkIs(t, store.GetProduct(ctx, &datastore.Product{Id: free.Id}), datastore.ErrNotFound, "GetProduct after a failed AddProducts")
+
+	batch[1].Barcode = ""
+	check(t, store.AddProducts(ctx, batch), "AddProducts")
+	for _, p := range batch {
+		got := datastore.Product{Id: p.Id}
+		check(t, store.GetProduct(ctx, &got), "GetProduct after AddProducts")
+		checkProduct(t, got, p, "GetProduct after AddProducts")
+	}
+	checkIs(t, store.AddProducts(ctx, batch[1:]), datastore.ErrConflict, "AddProducts with an ID that's taken")
+}
+
+func testExpiry(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	live := product(t, store, ctx, "Milk", "1.99")
+	id, err := store.NextID(ctx)
+	check(t, err, "NextID")
+	past := now().Add(-time.Hour)
+	expired := datastore.Product{Id: id, Name: "Old Milk", Price: money("0.5"), ExpiresAt: &past}
+	check(t, store.AddProduct(ctx, expired), "AddProduct of an expired product")
+
+	checkIs(t, store.GetProduct(ctx, &datastore.Product{Id: id}), datastore.ErrNotFound, "GetProduct of an expired product")
+	all, err := store.GetAll(ctx)
+	check(t, err, "GetAll")
+	checkIDs(t, all, ids(live), "GetAll, without expired products")
+	_, err = store.UpdateProduct(ctx, datastore.Product{Id: id, Name: "Old Milk", Price: money("0.4")})
+	checkIs(t, err, datastore.ErrNotFound, "UpdateProduct of an expired product")
+
+	gone, err := store.ExpiredProducts(ctx)
+	check(t, err, "ExpiredProducts")
+	checkIDs(t, gone, ids(expired), "ExpiredProducts")
+
+	// An expired Product's ID can be taken again.
+	expired.ExpiresAt = nil
+	check(t, store.AddProduct(ctx, expired), "AddProduct over an expired product")
+	check(t, store.GetProduct(ctx, &datastore.Product{Id: id}), "GetProduct of a replaced expired product")
+}
+
+func testTenants(t *testing.T, be Backend) {
+	store, ours, theirs := be.Store, be.catalog(t), be.catalog(t)
+
+	p := product(t, store, ours, "Apple", "0.98")
+	checkIs(t, store.GetProduct(theirs, &datastore.Product{Id: p.Id}), datastore.ErrNotFound, "GetProduct from another tenant")
+	all, err := store.GetAll(theirs)
+	check(t, err, "GetAll")
+	checkIDs(t, all, nil, "GetAll of another tenant")
+}
+
+func testTruncate(t *testing.T, be Backend) {
+	store, ours, theirs := be.Store, be.catalog(t), be.catalog(t)
+
+	p := product(t, store, ours, "Apple", "0.98")
+	kept := product(t, store, theirs, "Orange", "0.75")
+	check(t, store.Truncate(ours), "Truncate")
+	checkIs(t, store.GetProduct(ours, &datastore.Product{Id: p.Id}), datastore.ErrNotFound, "GetProduct after Truncate")
+	all, err := store.GetAll(ours)
+	check(t, err, "GetAll")
+	checkIDs(t, all, nil, "GetAll after Truncate")
+	check(t, store.GetProduct(theirs, &datastore.Product{Id: kept.Id}), "GetProduct from another tenant after Truncate")
+
+	// The emptied catalog can be used again.
+	product(t, store, ours, "Bananas", "2.25")
+}
+
+func testChanges(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+	start := datastore.Change{At: time.Now().Add(-time.Second)}
+
+	apple := product(t, store, ctx, "Apple", "0.98")
+	bulk := []datastore.Product{{Name: "Orange", Price: money("0.75")}, {Name: "Bananas", Price: money("2.25")}}
+	for i := range bulk {
+		id, err := store.NextID(ctx)
+		check(t, err, "NextID")
+		bulk[i].Id = id
+	}
+	check(t, store.AddProducts(ctx, bulk), "AddProducts")
+	apple.Price = money("1.25")
+	_, err := store.UpdateProduct(ctx, apple)
+	check(t, err, "UpdateProduct")
+	check(t, store.AddReview(ctx, datastore.Review{Id: uuid(t), ProductId: bulk[0].Id, Rating: 4, CreatedAt: now(), UpdatedAt: now()}), "AddReview")
+	check(t, store.DeleteProduct(ctx, bulk[1]), "DeleteProduct")
+
+	changes, err := store.GetChanges(ctx, start, 100)
+	check(t, err, "GetChanges")
+	want := []datastore.Change{
+		{ProductId: apple.Id, Kind: datastore.ChangeCreated},
+		{ProductId: bulk[0].Id, Kind: datastore.ChangeCreated},
+		{ProductId: bulk[1].Id, Kind: datastore.ChangeCreated},
+		{ProductId: apple.Id, Kind: datastore.ChangeUpdated},
+		{ProductId: bulk[0].Id, Kind: datastore.ChangeUpdated},
+		{ProductId: bulk[1].Id, Kind: datastore.ChangeDeleted},
+	}
+	// A bulk add's changes are logged together, so they're in ID order rather than the order given.
+	if bulk[1].Id < bulk[0].Id {
+		want[1], want[2] = want[2], want[1]
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("GetChanges = %+v, want %+v", changes, want)
+	}
+	for i, c := range changes {
+		if c.ProductId != want[i].ProductId || c.Kind != want[i].Kind || (i > 0 && c.Position() <= changes[i-1].Position()) {
+			t.Fatalf("GetChanges = %+v, want %+v, in order", changes, want)
+		}
+	}
+
+	// Reading on from a change returns the rest, a page at a time.
+	page, err := store.GetChanges(ctx, changes[1], 2)
+	check(t, err, "GetChanges after a change")
+	if len(page) != 2 || page[0].Position() != changes[2].Position() || page[1].Position() != changes[3].Position() {
+		t.Fatalf("GetChanges after %+v = %+v, want %+v", changes[1], page, changes[2:4])
+	}
+	rest, err := store.GetChanges(ctx, changes[len(changes)-1], 100)
+	check(t, err, "GetChanges after the last change")
+	if len(rest) != 0 {
+		t.Fatalf("GetChanges after the last change = %+v, want none", rest)
+	}
+}
+
+func testOutbox(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+	apple := product(t, store, ctx, "Apple", "0.98")
+	apple.Price = money("1.25")
+	_, err := store.UpdateProduct(ctx, apple)
+	check(t, err, "UpdateProduct")
+	check(t, store.DeleteProduct(ctx, apple), "DeleteProduct")
+
+	outbox, err := store.Outbox(ctx, 100)
+	check(t, err, "Outbox")
+	kinds := []string{datastore.ChangeCreated, datastore.ChangeUpdated, datastore.ChangeDeleted}
+	if len(outbox) != len(kinds) {
+		t.Fatalf("Outbox = %+v, want %v", outbox, kinds)
+	}
+	for i, c := range outbox {
+		if c.ProductId != apple.Id || c.Kind != kinds[i] {
+			t.Fatalf("Outbox = %+v, want %v of %v", outbox, kinds, apple.Id)
+		}
+	}
+
+	// Published changes are deleted; the rest stay, however often they're read.
+	first, err := store.Outbox(ctx, 2)
+	check(t, err, "Outbox of 2")
+	if len(first) != 2 || first[0].Position() != outbox[0].Position() || first[1].Position() != outbox[1].Position() {
+		t.Fatalf("Outbox of 2 = %+v, want %+v", first, outbox[:2])
+	}
+	check(t, store.DeleteOutbox(ctx, first), "DeleteOutbox")
+	check(t, store.DeleteOutbox(ctx, first), "DeleteOutbox of deleted changes")
+	rest, err := store.Outbox(ctx, 100)
+	check(t, err, "Outbox after DeleteOutbox")
+	if len(rest) != 1 || rest[0].Position() != outbox[2].Position() {
+		t.Fatalf("Outbox after DeleteOutbox = %+v, want %+v", rest, outbox[2:])
+	}
+}
+
+func testReviews(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	p := product(t, store, ctx, "Apple", "0.98")
+	created := now()
+	first := datastore.Review{Id: uuid(t), ProductId: p.Id, Rating: 5, Comment: "Crisp", CreatedAt: created, UpdatedAt: created}
+	second := datastore.Review{Id: uuid(t), ProductId: p.Id, Rating: 2, CreatedAt: created.Add(time.Second), UpdatedAt: created.Add(time.Second)}
+	check(t, store.AddReview(ctx, first), "AddReview")
+	check(t, store.AddReview(ctx, second), "AddReview")
+	checkIs(t, store.AddReview(ctx, first), datastore.ErrConflict, "AddReview with an ID that's taken")
+
+	reviews, err := store.GetReviews(ctx, p.Id)
+	check(t, err, "GetReviews")
+	if len(reviews) != 2 || reviews[0].Id != first.Id || reviews[1].Id != second.Id {
+		t.Fatalf("GetReviews = %+v, want %v then %v", reviews, first.Id, second.Id)
+	}
+	got := datastore.Review{ProductId: p.Id, Id: first.Id}
+	check(t, store.GetReview(ctx, &got), "GetReview")
+	if got.Rating != first.Rating || got.Comment != first.Comment || !got.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("GetReview = %+v, want %+v", got, first)
+	}
+	checkIs(t, store.GetReview(ctx, &datastore.Review{ProductId: p.Id, Id: uuid(t)}), datastore.ErrNotFound, "GetReview of a missing review")
+	checkRating(t, store, ctx, p.Id, &datastore.Rating{Average: 3.5, Count: 2})
+
+	updated := second
+	updated.Rating = 4
+	checkIs(t, store.UpdateReview(ctx, datastore.Review{Rating: 3}, updated), datastore.ErrConflict, "UpdateReview of a review changed since it was read")
+	check(t, store.UpdateReview(ctx, second, updated), "UpdateReview")
+	checkRating(t, store, ctx, p.Id, &datastore.Rating{Average: 4.5, Count: 2})
+
+	checkIs(t, store.DeleteReview(ctx, second), datastore.ErrConflict, "DeleteReview of a review changed since it was read")
+	check(t, store.DeleteReview(ctx, updated), "DeleteReview")
+	check(t, store.DeleteReview(ctx, first), "DeleteReview")
+	checkRating(t, store, ctx, p.Id, nil)
+	reviews, err = store.GetReviews(ctx, p.Id)
+	check(t, err, "GetReviews")
+	if len(reviews) != 0 {
+		t.Fatalf("GetReviews after deleting them all = %+v, want none", reviews)
+	}
+}
+
+// checkRating - fails the test unless the Product's Rating is want.
+func checkRating(t *testing.T, store datastore.Datastore, ctx context.Context, id string, want *datastore.Rating) {
+	t.Helper()
+	p := datastore.Product{Id: id}
+	check(t, store.GetProduct(ctx, &p), "GetProduct")
+	if (p.Rating == nil) != (want == nil) || (want != nil && *p.Rating != *want) {
+		t.Fatalf("Rating = %+v, want %+v", p.Rating, want)
+	}
+}
+
+func testVariants(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	p := product(t, store, ctx, "T-Shirt", "15")
+	price := money("17.5")
+	small := datastore.Variant{Id: uuid(t), ProductId: p.Id, Size: "S", Color: "red", Stock: 3}
+	large := datastore.Variant{Id: uuid(t), ProductId: p.Id, Size: "L", Price: &price, Stock: 1}
+	check(t, store.AddVariant(ctx, small), "AddVariant")
+	check(t, store.AddVariant(ctx, large), "AddVariant")
+	checkIs(t, store.AddVariant(ctx, small), datastore.ErrConflict, "AddVariant with an ID that's taken")
+
+	variants, err := store.GetVariants(ctx, p.Id)
+	check(t, err, "GetVariants")
+	if len(variants) != 2 {
+		t.Fatalf("GetVariants = %+v, want 2 variants", variants)
+	}
+	got := datastore.Variant{ProductId: p.Id, Id: large.Id}
+	check(t, store.GetVariant(ctx, &got), "GetVariant")
+	if got.Size != "L" || got.Stock != 1 || got.Price == nil || *got.Price != price {
+		t.Fatalf("GetVariant = %+v, want %+v", got, large)
+	}
+
+	small.Stock = 10
+	check(t, store.UpdateVariant(ctx, small), "UpdateVariant")
+	checkStock(t, store, ctx, small, 10)
+	missing := datastore.Variant{Id: uuid(t), ProductId: p.Id, Stock: 1}
+	checkIs(t, store.UpdateVariant(ctx, missing), datastore.ErrNotFound, "UpdateVariant of a missing variant")
+	checkIs(t, store.GetVariant(ctx, &missing), datastore.ErrNotFound, "GetVariant after UpdateVariant of a missing variant")
+
+	check(t, store.DeleteVariant(ctx, large), "DeleteVariant")
+	checkIs(t, store.GetVariant(ctx, &large), datastore.ErrNotFound, "GetVariant after DeleteVariant")
+	checkIs(t, store.DeleteVariant(ctx, large), datastore.ErrNotFound, "DeleteVariant of a deleted variant")
+}
+
+// checkStock - fails the test unless the variant has want in stock.
+func checkStock(t *testing.T, store datastore.Datastore, ctx context.Context, v datastore.Variant, want int) {
+	t.Helper()
+	got := datastore.Variant{ProductId: v.ProductId, Id: v.Id}
+	check(t, store.GetVariant(ctx, &got), "GetVariant")
+	if got.Stock != want {
+		t.Fatalf("Variant %v has %v in stock, want %v", v.Id, got.Stock, want)
+	}
+}
+
+func testLocationStock(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	p := product(t, store, ctx, "Crate", "40")
+	north, south := uuid(t), uuid(t)
+	stored, err := store.AdjustStock(ctx, p.Id, north, 5)
+	check(t, err, "AdjustStock")
+	if stored.Stock[north] != 5 {
+		t.Fatalf("AdjustStock = %+v, want 5 at %v", stored.Stock, north)
+	}
+	_, err = store.AdjustStock(ctx, p.Id, south, 2)
+	check(t, err, "AdjustStock at another location")
+	stored, err = store.AdjustStock(ctx, p.Id, north, -3)
+	check(t, err, "AdjustStock taking stock out")
+	if stored.Stock[north] != 2 || stored.Stock.Total() != 4 {
+		t.Fatalf("AdjustStock = %+v, want 2 at %v and 4 in all", stored.Stock, north)
+	}
+	_, err = store.AdjustStock(ctx, p.Id, south, -3)
+	checkIs(t, err, datastore.ErrConflict, "AdjustStock taking out more than there is")
+	_, err = store.AdjustStock(ctx, p.Id, uuid(t), -1)
+	checkIs(t, err, datastore.ErrConflict, "AdjustStock taking stock out of an empty location")
+	_, err = store.AdjustStock(ctx, "999999", north, 1)
+	checkIs(t, err, datastore.ErrNotFound, "AdjustStock of a missing Product")
+
+	// An update keeps the stock, whatever it says.
+	p.Name, p.Stock = "Wooden Crate", datastore.StockLevels{north: 100}
+	_, err = store.UpdateProduct(ctx, p)
+	check(t, err, "UpdateProduct")
+	got := datastore.Product{Id: p.Id}
+	check(t, store.GetProduct(ctx, &got), "GetProduct")
+	if got.Stock[north] != 2 || got.Stock[south] != 2 {
+		t.Fatalf("Stock after UpdateProduct = %+v, want 2 at each location", got.Stock)
+	}
+}
+
+func testOrders(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	p := product(t, store, ctx, "T-Shirt", "15")
+	v := datastore.Variant{Id: uuid(t), ProductId: p.Id, Size: "M", Stock: 5}
+	check(t, store.AddVariant(ctx, v), "AddVariant")
+
+	hold := datastore.Reservation{Id: uuid(t), ProductId: p.Id, VariantId: v.Id, Quantity: 2, ExpiresAt: now().Add(time.Hour)}
+	check(t, store.Reserve(ctx, hold), "Reserve")
+	checkStock(t, store, ctx, v, 3)
+	tooMany := datastore.Reservation{Id: uuid(t), ProductId: p.Id, VariantId: v.Id, Quantity: 4, ExpiresAt: now().Add(time.Hour)}
+	checkIs(t, store.Reserve(ctx, tooMany), datastore.ErrConflict, "Reserve of more than is in stock")
+	checkStock(t, store, ctx, v, 3)
+	got := datastore.Reservation{Id: hold.Id}
+	check(t, store.GetReservation(ctx, &got), "GetReservation")
+	if got.VariantId != v.Id || got.Quantity != 2 || !got.ExpiresAt.Equal(hold.ExpiresAt) {
+		t.Fatalf("GetReservation = %+v, want %+v", got, hold)
+	}
+
+	order := datastore.Order{
+		Id: uuid(t),
+		Lines: []datastore.OrderLine{
+			{ProductId: p.Id, VariantId: v.Id, Quantity: 2, Price: money("15"), ReservationId: hold.Id},
+			{ProductId: p.Id, VariantId: v.Id, Quantity: 1, Price: money("15")},
+		},
+		Total:     45,
+		CreatedAt: now(),
+	}
+	check(t, store.AddOrder(ctx, order), "AddOrder")
+	checkStock(t, store, ctx, v, 2)
+	checkIs(t, store.GetReservation(ctx, &datastore.Reservation{Id: hold.Id}), datastore.ErrNotFound, "GetReservation of a reservation used by an order")
+	placed := datastore.Order{Id: order.Id}
+	check(t, store.GetOrder(ctx, &placed), "GetOrder")
+	if len(placed.Lines) != 2 || placed.Total != 45 || placed.Lines[0].ReservationId != hold.Id {
+		t.Fatalf("GetOrder = %+v, want %+v", placed, order)
+	}
+	checkIs(t, store.GetOrder(ctx, &datastore.Order{Id: uuid(t)}), datastore.ErrNotFound, "GetOrder of a missing order")
+
+	// Neither an order for more than is in stock nor one using a reservation that's gone changes anything.
+	short := datastore.Order{Id: uuid(t), Lines: []datastore.OrderLine{{ProductId: p.Id, VariantId: v.Id, Quantity: 3, Price: money("15")}}, CreatedAt: now()}
+	checkIs(t, store.AddOrder(ctx, short), datastore.ErrConflict, "AddOrder of more than is in stock")
+	used := datastore.Order{Id: uuid(t), Lines: order.Lines[:1], CreatedAt: now()}
+	checkIs(t, store.AddOrder(ctx, used), datastore.ErrConflict, "AddOrder with a reservation that's been used")
+	checkStock(t, store, ctx, v, 2)
+	checkIs(t, store.GetOrder(ctx, &datastore.Order{Id: short.Id}), datastore.ErrNotFound, "GetOrder of a failed order")
+
+	released := datastore.Reservation{Id: uuid(t), ProductId: p.Id, VariantId: v.Id, Quantity: 1, ExpiresAt: now().Add(time.Hour)}
+	check(t, store.Reserve(ctx, released), "Reserve")
+	checkStock(t, store, ctx, v, 1)
+	check(t, store.ReleaseReservation(ctx, released), "ReleaseReservation")
+	checkStock(t, store, ctx, v, 2)
+	checkIs(t, store.ReleaseReservation(ctx, released), datastore.ErrNotFound, "ReleaseReservation of a released reservation")
+	checkStock(t, store, ctx, v, 2)
+
+	lapsed := datastore.Reservation{Id: uuid(t), ProductId: p.Id, VariantId: v.Id, Quantity: 1, ExpiresAt: now().Add(-time.Minute)}
+	check(t, store.Reserve(ctx, lapsed), "Reserve")
+	checkIs(t, store.GetReservation(ctx, &datastore.Reservation{Id: lapsed.Id}), datastore.ErrNotFound, "GetReservation of an expired reservation")
+	expired, err := store.ExpiredReservations(ctx)
+	check(t, err, "ExpiredReservations")
+	if len(expired) != 1 || expired[0].Id != lapsed.Id {
+		t.Fatalf("ExpiredReservations = %+v, want just %v", expired, lapsed.Id)
+	}
+	lapsedOrder := datastore.Order{Id: uuid(t), Lines: []datastore.OrderLine{{ProductId: p.Id, VariantId: v.Id, Quantity: 1, Price: money("15"), ReservationId: lapsed.Id}}, CreatedAt: now()}
+	checkIs(t, store.AddOrder(ctx, lapsedOrder), datastore.ErrConflict, "AddOrder with an expired reservation")
+	check(t, store.ReleaseReservation(ctx, expired[0]), "ReleaseReservation of an expired reservation")
+	checkStock(t, store, ctx, v, 2)
+
+	// A Product without variants has its stock taken from its locations, in order of ID.
+	plain := product(t, store, ctx, "Mug", "8")
+	first, second := uuid(t), uuid(t)
+	if second < first {
+		first, second = second, first
+	}
+	_, err = store.AdjustStock(ctx, plain.Id, first, 2)
+	check(t, err, "AdjustStock")
+	_, err = store.AdjustStock(ctx, plain.Id, second, 3)
+	check(t, err, "AdjustStock at another location")
+	mugs := datastore.Order{Id: uuid(t), Lines: []datastore.OrderLine{
+		{ProductId: plain.Id, Quantity: 1, Price: money("8")},
+		{ProductId: plain.Id, Quantity: 2, Price: money("8")},
+	}, CreatedAt: now()}
+	check(t, store.AddOrder(ctx, mugs), "AddOrder of a Product without variants")
+	stored := datastore.Product{Id: plain.Id}
+	check(t, store.GetProduct(ctx, &stored), "GetProduct")
+	if stored.Stock[first] != 0 || stored.Stock[second] != 2 {
+		t.Fatalf("Stock after AddOrder = %+v, want 0 at %v and 2 at %v", stored.Stock, first, second)
+	}
+	tooManyMugs := datastore.Order{Id: uuid(t), Lines: []datastore.OrderLine{{ProductId: plain.Id, Quantity: 3, Price: money("8")}}, CreatedAt: now()}
+	checkIs(t, store.AddOrder(ctx, tooManyMugs), datastore.ErrConflict, "AddOrder of more of a Product than is in stock")
+	check(t, store.GetProduct(ctx, &stored), "GetProduct")
+	if stored.Stock.Total() != 2 {
+		t.Fatalf("Stock after a failed AddOrder = %+v, want 2 in all", stored.Stock)
+	}
+}
+
+func testCarts(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	cart := datastore.Cart{
+		Id:        uuid(t),
+		Items:     []datastore.CartItem{{Id: uuid(t), ProductId: "1", Quantity: 2}},
+		ExpiresAt: now().Add(time.Hour),
+	}
+	check(t, store.PutCart(ctx, cart), "PutCart")
+	got := datastore.Cart{Id: cart.Id}
+	check(t, store.GetCart(ctx, &got), "GetCart")
+	if len(got.Items) != 1 || got.Items[0].Quantity != 2 || !got.ExpiresAt.Equal(cart.ExpiresAt) {
+		t.Fatalf("GetCart = %+v, want %+v", got, cart)
+	}
+
+	cart.Items = append(cart.Items, datastore.CartItem{Id: uuid(t), ProductId: "2", Quantity: 1})
+	check(t, store.PutCart(ctx, cart), "PutCart replacing a cart")
+	check(t, store.GetCart(ctx, &got), "GetCart")
+	if len(got.Items) != 2 {
+		t.Fatalf("GetCart after replacing it = %+v, want %+v", got, cart)
+	}
+
+	check(t, store.DeleteCart(ctx, cart.Id), "DeleteCart")
+	checkIs(t, store.GetCart(ctx, &datastore.Cart{Id: cart.Id}), datastore.ErrNotFound, "GetCart after DeleteCart")
+	checkIs(t, store.DeleteCart(ctx, cart.Id), datastore.ErrNotFound, "DeleteCart of a deleted cart")
+
+	abandoned := datastore.Cart{Id: uuid(t), Items: []datastore.CartItem{}, ExpiresAt: now().Add(-time.Minute)}
+	check(t, store.PutCart(ctx, abandoned), "PutCart")
+	checkIs(t, store.GetCart(ctx, &datastore.Cart{Id: abandoned.Id}), datastore.ErrNotFound, "GetCart of an abandoned cart")
+	checkIs(t, store.DeleteCart(ctx, abandoned.Id), datastore.ErrNotFound, "DeleteCart of an abandoned cart")
+}
+
+func testUsers(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	// Users are shared by every tenant, so each run uses names of its own.
+	user := datastore.User{Name: "user-" + uuid(t), Kind: datastore.UserKindUser, PasswordHash: "$2a$04$hash", Roles: []string{"reader"}, CreatedAt: now(), UpdatedAt: now()}
+	check(t, store.AddUser(ctx, user), "AddUser")
+	checkIs(t, store.AddUser(ctx, user), datastore.ErrConflict, "AddUser of an existing name")
+	got := datastore.User{Name: user.Name}
+	check(t, store.GetUser(datastore.WithTenant(ctx, ""), &got), "GetUser from another tenant")
+	if got.PasswordHash != user.PasswordHash || len(got.Roles) != 1 || !got.CreatedAt.Equal(user.CreatedAt) {
+		t.Fatalf("GetUser = %+v, want %+v", got, user)
+	}
+
+	// Binding a user to tenants doesn't stop it being shared; the API checks the tenants.
+	user.Roles, user.Tenants = []string{"reader", "writer"}, []string{"acme"}
+	check(t, store.UpdateUser(ctx, user), "UpdateUser")
+	got = datastore.User{Name: user.Name}
+	check(t, store.GetUser(datastore.WithTenant(ctx, ""), &got), "GetUser after UpdateUser")
+	if len(got.Tenants) != 1 || got.Tenants[0] != "acme" {
+		t.Fatalf("GetUser = %+v, want it bound to acme", got)
+	}
+	users, err := store.GetUsers(ctx)
+	check(t, err, "GetUsers")
+	found := false
+	for i, u := range users {
+		if i > 0 && users[i-1].Name >= u.Name {
+			t.Fatalf("GetUsers isn't in name order: %v before %v", users[i-1].Name, u.Name)
+		}
+		if u.Name == user.Name {
+			found = len(u.Roles) == 2
+		}
+	}
+	if !found {
+		t.Fatalf("GetUsers = %+v, want it to include %+v", users, user)
+	}
+
+	check(t, store.DeleteUser(ctx, user.Name), "DeleteUser")
+	checkIs(t, store.GetUser(ctx, &datastore.User{Name: user.Name}), datastore.ErrNotFound, "GetUser after DeleteUser")
+	checkIs(t, store.UpdateUser(ctx, user), datastore.ErrNotFound, "UpdateUser of a deleted user")
+	checkIs(t, store.DeleteUser(ctx, user.Name), datastore.ErrNotFound, "DeleteUser of a deleted user")
+}
+
+// notes - a resource registered for testRecords, so that backends make a place for its records with the rest.
+var notes = datastore.Resource{Name: "storetest-notes", Table: "StoretestNotes", Schema: schema.MustParse(`{"type": "object"}`)}
+
+func init() {
+	datastore.RegisterResource(notes)
+}
+
+func testRecords(t *testing.T, be Backend) {
+	store, ctx := be.Store, be.catalog(t)
+
+	note := datastore.Record{datastore.RecordID: uuid(t), "text": "Restock apples", "tags": []interface{}{"fruit"}, "priority": 2.0}
+	check(t, store.AddRecord(ctx, notes.Name, note), "AddRecord")
+	checkIs(t, store.AddRecord(ctx, notes.Name, note), datastore.ErrConflict, "AddRecord of an existing ID")
+	got, err := store.GetRecord(ctx, notes.Name, note.Id())
+	check(t, err, "GetRecord")
+	if got["text"] != "Restock apples" || got["priority"] != 2.0 || len(got["tags"].([]interface{})) != 1 {
+		t.Fatalf("GetRecord = %v, want %v", got, note)
+	}
+	// What the store returns is a copy.
+	got["text"] = "Changed"
+	if again, _ := store.GetRecord(ctx, notes.Name, note.Id()); again["text"] != "Restock apples" {
+		t.Fatalf("Changing a record GetRecord returned changed the stored one: %v", again)
+	}
+
+	note["text"] = "Restock pears"
+	check(t, store.UpdateRecord(ctx, notes.Name, note), "UpdateRecord")
+	missing := datastore.Record{datastore.RecordID: uuid(t)}
+	checkIs(t, store.UpdateRecord(ctx, notes.Name, missing), datastore.ErrNotFound, "UpdateRecord of a missing record")
+	records, err := store.GetRecords(ctx, notes.Name)
+	check(t, err, "GetRecords")
+	if len(records) != 1 || records[0]["text"] != "Restock pears" {
+		t.Fatalf("GetRecords = %v, want just %v", records, note)
+	}
+	if other, err := store.GetRecords(be.catalog(t), notes.Name); err != nil || len(other) != 0 {
+		t.Fatalf("GetRecords in another tenant = %v, %v; want none", other, err)
+	}
+
+	check(t, store.DeleteRecord(ctx, notes.Name, note.Id()), "DeleteRecord")
+	checkIs(t, store.DeleteRecord(ctx, notes.Name, note.Id()), datastore.ErrNotFound, "DeleteRecord of a deleted record")
+	_, err = store.GetRecord(ctx, notes.Name, note.Id())
+	checkIs(t, err, datastore.ErrNotFound, "GetRecord of a deleted record")
+}
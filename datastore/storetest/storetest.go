@@ -0,0 +1,151 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package storetest runs the same workload against every datastore implementation, so that each backend's tests are
+a few lines long and their results can be compared with each other.
+
+A backend's _test.go file describes how to reach it with a Backend and hands it to Benchmarks:
+
+	func BenchmarkDatastore(b *testing.B) {
+		storetest.Benchmarks(b, storetest.Backend{Store: &Products{}})
+	}
+
+Every benchmark works in a catalog of its own (a tenant that nothing else uses), so they don't see each other's
+Products, or anything already in the store.
+*/
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+Backend - a Datastore under test. Open prepares an empty catalog for the context's tenant and returns a function
+that removes it again; it's nil for stores, like the in-memory one, whose catalogs appear when first written to.
+*/
+type Backend struct {
+	Store datastore.Datastore
+	Open  func(ctx context.Context) (close func() error, err error)
+}
+
+// catalogs - numbers the catalogs opened by this run, so that no two share a tenant.
+var catalogs int64
+
+/*
+catalog - a context for a new, empty catalog in the backend, which is removed when tb's test or benchmark finishes.
+Its tenant is named after the time as well, so a run never picks up one left behind by an earlier run that was
+killed before it could clean up.
+*/
+func (be Backend) catalog(tb testing.TB) context.Context {
+	tb.Helper()
+	tenant := fmt.Sprintf("storetest-%x-%d", time.Now().UnixNano(), atomic.AddInt64(&catalogs, 1))
+	ctx := datastore.WithTenant(context.Background(), tenant)
+	if be.Open != nil {
+		close, err := be.Open(ctx)
+		if err != nil {
+			tb.Fatalf("Error opening a catalog for tenant %v: %v", tenant, err)
+		}
+		tb.Cleanup(func() {
+			if err := close(); err != nil {
+				tb.Errorf("Error removing the catalog for tenant %v: %v", tenant, err)
+			}
+		})
+	}
+	return ctx
+}
+
+// seed - adds n Products to the context's catalog, returning their IDs.
+func seed(tb testing.TB, store datastore.Datastore, ctx context.Context, n int) []string {
+	tb.Helper()
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		p, err := add(store, ctx, i)
+		if err != nil {
+			tb.Fatalf("Error seeding product %v of %v: %v", i+1, n, err)
+		}
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+// add - adds a Product with a new ID, and a name and price made from i.
+func add(store datastore.Datastore, ctx context.Context, i int) (datastore.Product, error) {
+	id, err := store.NextID(ctx)
+	if err != nil {
+		return datastore.Product{}, err
+	}
+	p := datastore.Product{Id: id, Name: fmt.Sprintf("Product %v", i), Price: datastore.Money(i%10000) * 100}
+	return p, store.AddProduct(ctx, p)
+}
+
+/*
+Benchmarks - measures the backend's listing of catalogs of different sizes, its point reads, and concurrent creates
+and updates. The reads and writes run on GOMAXPROCS goroutines (see -cpu), as the API's handlers do; a failure
+there stops only its own goroutine, since the others can't be stopped from it.
+*/
+func Benchmarks(b *testing.B, be Backend) {
+	for _, n := range []int{10, 100, 1000} {
+		ctx := be.catalog(b)
+		seed(b, be.Store, ctx, n)
+		b.Run(fmt.Sprintf("GetAll/%v", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				products, err := be.Store.GetAll(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(products) != n {
+					b.Fatalf("GetAll returned %v products, want %v", len(products), n)
+				}
+			}
+		})
+	}
+
+	ctx := be.catalog(b)
+	ids := seed(b, be.Store, ctx, 100)
+	b.Run("GetProduct", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				p := datastore.Product{Id: ids[rand.Intn(len(ids))]}
+				if err := be.Store.GetProduct(ctx, &p); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("UpdateProduct", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				p := datastore.Product{Id: ids[rand.Intn(len(ids))], Name: "Updated", Price: datastore.Money(rand.Intn(10000)) * 100}
+				if _, err := be.Store.UpdateProduct(ctx, p); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	// Creates grow the catalog as they go, so they get one of their own rather than slowing down the reads above.
+	ctx = be.catalog(b)
+	b.Run("AddProduct", func(b *testing.B) {
+		var n int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := add(be.Store, ctx, int(atomic.AddInt64(&n, 1))); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,39 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxTags / MaxTagLength - the most tags a Product can have, and the longest a tag can be, in characters.
+const (
+	MaxTags      = 20
+	MaxTagLength = 50
+)
+
+/*
+ValidTags - checks a Product's tags: at most MaxTags, none blank or longer than MaxTagLength, and no two the same
+ignoring case.
+*/
+func ValidTags(p Product) error {
+	if len(p.Tags) > MaxTags {
+		return fmt.Errorf("A product can have at most %v tags", MaxTags)
+	}
+	seen := map[string]bool{}
+	for _, tag := range p.Tags {
+		key := strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case key == "":
+			return fmt.Errorf("Tags can't be blank")
+		case len([]rune(tag)) > MaxTagLength:
+			return fmt.Errorf("Tag %q is longer than %v characters", tag, MaxTagLength)
+		case seen[key]:
+			return fmt.Errorf("Tag %q is given more than once", tag)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"context"
+	"regexp"
+)
+
+// tenantKey - the context key for the request's tenant.
+type tenantKey struct{}
+
+// tenantRegexp - tenant names are short lowercase slugs, so they can be used in table names and cache keys.
+var tenantRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ValidTenant - reports whether s can be used as a tenant name.
+func ValidTenant(s string) bool {
+	return tenantRegexp.MatchString(s)
+}
+
+/*
+WithTenant - scopes every Datastore call made with the returned context to one tenant's catalog. Backends keep each
+tenant's Products apart, so the same ID can exist in several tenants.
+*/
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant - the tenant a context is scoped to; "" is the default tenant used when multi-tenancy is off.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
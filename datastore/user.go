@@ -0,0 +1,34 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// The kinds of User.
+const (
+	// UserKindUser - a person, who authenticates with a password.
+	UserKindUser = "user"
+	// UserKindClient - a server-to-server client, which signs its requests with a shared secret.
+	UserKindClient = "client"
+)
+
+/*
+User - someone, or something, that may call the API, managed through /admin/users. Users are shared by every
+tenant, though each may only use its Tenants, if it has any. A user has a bcrypt PasswordHash; a client has the
+Secret it signs requests with, which has to be kept as it is to check signatures.
+*/
+type User struct {
+	XMLName      xml.Name  `json:"-" xml:"user" dynamodbav:"-"`
+	Name         string    `json:"name" xml:"name" dynamodbav:"name"`
+	Kind         string    `json:"kind" xml:"kind" dynamodbav:"kind"`
+	PasswordHash string    `json:"password_hash,omitempty" xml:"password_hash,omitempty" dynamodbav:"password_hash,omitempty"`
+	Secret       string    `json:"secret,omitempty" xml:"secret,omitempty" dynamodbav:"secret,omitempty"`
+	Roles        []string  `json:"roles" xml:"role" dynamodbav:"roles"`
+	Tenants      []string  `json:"tenants,omitempty" xml:"tenant,omitempty" dynamodbav:"tenants,omitempty"`
+	CreatedAt    time.Time `json:"created_at" xml:"created_at" dynamodbav:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" xml:"updated_at" dynamodbav:"updated_at"`
+}
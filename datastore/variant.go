@@ -0,0 +1,20 @@
+/*
+Author: Jason Payne
+*/
+package datastore
+
+import "encoding/xml"
+
+/*
+Variant - a purchasable version of a Product, such as a size or color, with its own stock. Price, if set, overrides
+the Product's price. Like reviews, variants always have UUIDs.
+*/
+type Variant struct {
+	XMLName   xml.Name `json:"-" xml:"variant" dynamodbav:"-"`
+	Id        string   `json:"id" xml:"id" dynamodbav:"variant_id"`
+	ProductId string   `json:"product_id" xml:"product_id" dynamodbav:"product_id"`
+	Size      string   `json:"size,omitempty" xml:"size,omitempty" dynamodbav:"size,omitempty"`
+	Color     string   `json:"color,omitempty" xml:"color,omitempty" dynamodbav:"color,omitempty"`
+	Price     *Money   `json:"price,omitempty" xml:"price,omitempty" dynamodbav:"price,omitempty"`
+	Stock     int      `json:"stock" xml:"stock" dynamodbav:"stock"`
+}
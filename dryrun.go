@@ -0,0 +1,40 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+/*
+dryRun - whether a create or update only asks for its body to be checked (?dry_run=true). A dry run goes through
+the same validation and uniqueness checks as the real request, but writes nothing and assigns no IDs.
+*/
+func dryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dry, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, i18n.Errorf("invalid_dry_run", "Invalid dry_run value %q; use true or false", v)
+	}
+	return dry, nil
+}
+
+/*
+checkOnly - finishes a dry run once the request itself is valid: 204 if the Products' barcodes (and unique names)
+are free, or the error the write would have responded with.
+*/
+func (a *API) checkOnly(w http.ResponseWriter, r *http.Request, products []datastore.Product) {
+	if err := a.Store.CheckUnique(r.Context(), products); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,14 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/datastore/storetest"
+)
+
+func BenchmarkDatastore(b *testing.B) {
+	storetest.Benchmarks(b, storetest.Backend{Store: &Products{}})
+}
@@ -0,0 +1,54 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type Cart = datastore.Cart
+
+func (pArr *Products) GetCart(ctx context.Context, cart *Cart) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	stored, ok := pArr.catalog(ctx, false).carts[cart.Id]
+	if !ok || stored.Expired() {
+		return datastore.Errorf("cart_not_found", "Cart <%v> does not exist: %w", cart.Id, datastore.ErrNotFound)
+	}
+	*cart = stored
+	cart.Items = append([]datastore.CartItem{}, stored.Items...)
+	return nil
+}
+
+// PutCart - saves the cart, dropping any that have been abandoned, as DynamoDB's TTL would.
+func (pArr *Products) PutCart(ctx context.Context, cart Cart) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	if c.carts == nil {
+		c.carts = map[string]Cart{}
+	}
+	for id, stored := range c.carts {
+		if stored.Expired() {
+			delete(c.carts, id)
+		}
+	}
+	cart.Items = append([]datastore.CartItem{}, cart.Items...)
+	c.carts[cart.Id] = cart
+	return pArr.logWrite(ctx, "PutCart", cart)
+}
+
+func (pArr *Products) DeleteCart(ctx context.Context, id string) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	stored, ok := c.carts[id]
+	if !ok || stored.Expired() {
+		return datastore.Errorf("cart_not_found", "Cart <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	delete(c.carts, id)
+	return pArr.logWrite(ctx, "DeleteCart", id)
+}
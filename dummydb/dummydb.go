@@ -4,79 +4,676 @@ Author: Jason Payne
 package dummydb
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/migrate"
 )
 
+type Product = datastore.Product
+
+// Products - the in-memory store. Handlers run concurrently, so every method takes the lock, and results are always
+// copies: callers never get a slice that aliases the store.
+type Products struct {
+	mu sync.RWMutex
+	// tenants - each tenant's catalog, keyed by tenant name ("" when multi-tenancy is off).
+	tenants map[string]*catalog
+	// schemaVersion - the last migration applied.
+	schemaVersion int
+	// uniqueNames - whether two live Products may not share a name.
+	uniqueNames bool
+	// users - keyed by name; shared by every tenant.
+	users map[string]datastore.User
+	// wal - the write-ahead log each write is appended to, if one is configured.
+	wal *wal
+	// at - when the write being made was made: the time of the first call to now, or while a logged write is
+	// replayed, when it was first made. logWrite clears it.
+	at time.Time
+}
+
+// now - when the write being made was made, for the times the store records; must be called with the write lock
+// held, and followed by logWrite.
+func (pArr *Products) now() time.Time {
+	if pArr.at.IsZero() {
+		pArr.at = time.Now().UTC()
+	}
+	return pArr.at
+}
+
 /*
-Product -
+catalog - one tenant's Products, and everything else it keeps. The Products are kept by ID, with indexes of their
+names and barcodes, so that lookups don't have to go through every one; listings sort what they return anyway.
 */
-type Product struct {
-	Id    int `json:"id,string"`
-	Name  string
-	Price float64 `json:",string"`
+type catalog struct {
+	// products - the Products, live and expired, keyed by ID. Update them with put and remove, which keep the
+	// indexes in step.
+	products map[string]Product
+	// names - the IDs of the Products with each name, in lower case.
+	names map[string]map[string]bool
+	// barcodes - the IDs of the Products with each barcode.
+	barcodes map[string]map[string]bool
+	// lastID - the most recently assigned sequential ID.
+	lastID int
+	// history - each Product's prices, oldest first, keyed by ID. It outlives the Product, as in DynamoDB.
+	history map[string][]datastore.PricePoint
+	// changes - the change log, oldest first; changes are dropped once they're older than datastore.ChangeRetention.
+	changes []datastore.Change
+	// outbox - the changes not yet published as events, oldest first; like the log, it keeps them for
+	// datastore.ChangeRetention.
+	outbox []datastore.Change
+	// reviews - each Product's reviews, oldest first, keyed by Product ID.
+	reviews map[string][]datastore.Review
+	// variants - each Product's variants, in the order they were added, keyed by Product ID.
+	variants map[string][]datastore.Variant
+	// orders - keyed by order ID.
+	orders map[string]datastore.Order
+	// carts - keyed by cart ID. Expired carts are dropped as others are saved.
+	carts map[string]datastore.Cart
+	// reservations - keyed by reservation ID, until they are used or released.
+	reservations map[string]datastore.Reservation
+	// records - each registered resource's records, keyed by resource name and then ID.
+	records map[string]map[string]datastore.Record
+}
+
+// newCatalog - a catalog of the given Products, whose sequential IDs go up to lastID.
+func newCatalog(products []Product, lastID int) *catalog {
+	c := &catalog{lastID: lastID}
+	for _, p := range products {
+		c.put(p)
+	}
+	return c
+}
+
+// put - adds a Product, or replaces the one with its ID, and indexes it; must be called with the write lock held.
+func (c *catalog) put(p Product) {
+	c.remove(p.Id)
+	if c.products == nil {
+		c.products = map[string]Product{}
+		c.names = map[string]map[string]bool{}
+		c.barcodes = map[string]map[string]bool{}
+	}
+	c.products[p.Id] = p
+	addToIndex(c.names, strings.ToLower(p.Name), p.Id)
+	if p.Barcode != "" {
+		addToIndex(c.barcodes, p.Barcode, p.Id)
+	}
+}
+
+// remove - removes the Product with the given ID, if there is one, from the catalog and its indexes, reporting
+// whether there was; must be called with the write lock held.
+func (c *catalog) remove(id string) bool {
+	p, ok := c.products[id]
+	if !ok {
+		return false
+	}
+	delete(c.products, id)
+	removeFromIndex(c.names, strings.ToLower(p.Name), id)
+	removeFromIndex(c.barcodes, p.Barcode, id)
+	return true
+}
+
+// addToIndex / removeFromIndex - local helper functions that add an ID to, or remove it from, an index's key.
+func addToIndex(index map[string]map[string]bool, key, id string) {
+	if index[key] == nil {
+		index[key] = map[string]bool{}
+	}
+	index[key][id] = true
 }
 
-func (p Product) String() string {
-	return fmt.Sprintf("<(Id: %v) {%v} @ %v>", p.Id, p.Name, p.Price)
+func removeFromIndex(index map[string]map[string]bool, key, id string) {
+	if delete(index[key], id); len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// indexed - the Products with the given IDs (from an index), live and expired; must be called with the lock held.
+func (c *catalog) indexed(ids map[string]bool) []Product {
+	products := make([]Product, 0, len(ids))
+	for id := range ids {
+		products = append(products, c.products[id])
+	}
+	return products
+}
+
+// recordPrice - appends a Product's current price, as of at, to its history; must be called with the write lock held.
+func (c *catalog) recordPrice(p Product, at time.Time) {
+	if c.history == nil {
+		c.history = map[string][]datastore.PricePoint{}
+	}
+	c.history[p.Id] = append(c.history[p.Id], datastore.PricePoint{Price: p.Price, ChangedAt: at})
+}
+
+// recordChange - appends a change made to a Product at the given time to the change log and the outbox; must be
+// called with the write lock held.
+func (c *catalog) recordChange(id, kind string, at time.Time) {
+	change := datastore.Change{ProductId: id, Kind: kind, At: at}
+	c.changes = append(unexpired(c.changes, change.At), change)
+	c.outbox = append(unexpired(c.outbox, change.At), change)
+}
+
+// unexpired - the changes, oldest first, that are no older than datastore.ChangeRetention at now.
+func unexpired(changes []datastore.Change, now time.Time) []datastore.Change {
+	kept := 0
+	for kept < len(changes) && now.Sub(changes[kept].At) > datastore.ChangeRetention {
+		kept++
+	}
+	return changes[kept:]
 }
 
-type Products []Product
+// catalog - the context's tenant's catalog; must be called with the lock held. A tenant without one gets an empty
+// catalog, which is only kept if create is set (which needs the write lock).
+func (pArr *Products) catalog(ctx context.Context, create bool) *catalog {
+	tenant := datastore.Tenant(ctx)
+	if c, ok := pArr.tenants[tenant]; ok {
+		return c
+	}
+	c := &catalog{}
+	if create {
+		if pArr.tenants == nil {
+			pArr.tenants = map[string]*catalog{}
+		}
+		pArr.tenants[tenant] = c
+	}
+	return c
+}
 
 var Items Products
 
-func (pArr Products) GetAll() (Products, error) {
-	// Price-descending sort
-	sort.Slice(pArr, func(i, j int) bool { return pArr[i].Price > pArr[j].Price })
-	return pArr, nil
+// NextID - assigns the ID for a new Product: auto-incremented, or a UUID depending on the ID strategy.
+func (pArr *Products) NextID(ctx context.Context) (string, error) {
+	if datastore.Strategy == datastore.UUIDIDs {
+		return datastore.NewUUID()
+	}
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	c.lastID++
+	return strconv.Itoa(c.lastID), pArr.logWrite(ctx, "NextID")
+}
+
+// AdvanceID - moves the sequential ID past id, if it isn't already.
+func (pArr *Products) AdvanceID(ctx context.Context, id string) error {
+	if datastore.Strategy == datastore.UUIDIDs {
+		return nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("Invalid product ID %q", id)
+	}
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if c := pArr.catalog(ctx, true); n > c.lastID {
+		c.lastID = n
+		return pArr.logWrite(ctx, "AdvanceID", id)
+	}
+	return nil
+}
+
+func (pArr *Products) GetAll(ctx context.Context) ([]Product, error) {
+	return pArr.filter(ctx, func(Product) bool { return true })
+}
+
+/*
+GetPage - pages through the live Products in ID order (numeric for sequential IDs), emulating a DynamoDB Scan.
+Paging by ID rather than by position means deleting a Product doesn't shift later pages.
+*/
+func (pArr *Products) GetPage(ctx context.Context, limit int, cursor string) (datastore.Page, error) {
+	after := ""
+	if cursor != "" {
+		var err error
+		if after, err = datastore.DecodeCursor(cursor); err != nil {
+			return datastore.Page{}, err
+		}
+	}
+
+	products, err := pArr.GetAll(ctx)
+	if err != nil {
+		return datastore.Page{}, err
+	}
+	sort.Slice(products, func(i, j int) bool { return idLess(products[i].Id, products[j].Id) })
+
+	page := datastore.Page{Products: []Product{}}
+	for _, p := range products {
+		if after != "" && !idLess(after, p.Id) {
+			continue
+		}
+		if len(page.Products) == limit {
+			page.Cursor = datastore.EncodeCursor(page.Products[limit-1].Id)
+			break
+		}
+		page.Products = append(page.Products, p)
+	}
+	return page, nil
+}
+
+// Count - the number of live Products matching filter.
+func (pArr *Products) Count(ctx context.Context, filter datastore.Filter) (int, error) {
+	var products []Product
+	var err error
+	switch {
+	case filter.Query != "":
+		products, err = pArr.GetAll(ctx)
+		products = datastore.RankByName(products, filter.Query)
+	case filter.Name != "":
+		products, err = pArr.FindByName(ctx, filter.Name)
+	case filter.NamePrefix != "":
+		products, err = pArr.SearchByPrefix(ctx, filter.NamePrefix)
+	case filter.Expr != nil:
+		products, err = pArr.FilterProducts(ctx, filter.Expr)
+	default:
+		products, err = pArr.GetAll(ctx)
+	}
+	return len(products), err
+}
+
+// PriceHistory - a copy of the Product's price history, oldest first.
+func (pArr *Products) PriceHistory(ctx context.Context, id string) ([]datastore.PricePoint, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return append([]datastore.PricePoint{}, pArr.catalog(ctx, false).history[id]...), nil
+}
+
+// GetChanges - a copy of up to limit of the changes logged after the given one.
+func (pArr *Products) GetChanges(ctx context.Context, after datastore.Change, limit int) ([]datastore.Change, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	changes := []datastore.Change{}
+	for _, c := range pArr.catalog(ctx, false).changes {
+		if len(changes) == limit {
+			break
+		}
+		if c.Position() > after.Position() {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// Outbox - a copy of up to limit of the oldest changes in the outbox.
+func (pArr *Products) Outbox(ctx context.Context, limit int) ([]datastore.Change, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	outbox := pArr.catalog(ctx, false).outbox
+	if len(outbox) > limit {
+		outbox = outbox[:limit]
+	}
+	return append([]datastore.Change{}, outbox...), nil
+}
+
+// DeleteOutbox - removes the changes from the outbox.
+func (pArr *Products) DeleteOutbox(ctx context.Context, changes []datastore.Change) error {
+	published := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		published[c.Position()] = true
+	}
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	kept := []datastore.Change{}
+	for _, change := range c.outbox {
+		if !published[change.Position()] {
+			kept = append(kept, change)
+		}
+	}
+	c.outbox = kept
+	return pArr.logWrite(ctx, "DeleteOutbox", changes)
+}
+
+// idLess - orders IDs as the active ID strategy stores them.
+func idLess(a, b string) bool {
+	return datastore.Strategy.Compare(a, b) < 0
+}
+
+func (pArr *Products) AddProduct(ctx context.Context, newProduct Product) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	// An expired Product is as good as deleted, so its ID can be taken again (by a PUT upsert).
+	if old, ok := c.products[newProduct.Id]; ok && !old.Expired() {
+		return datastore.Errorf("product_exists", "Product <%v> already exists: %w", newProduct.Id, datastore.ErrConflict)
+	}
+	if err := c.barcodeFree(newProduct); err != nil {
+		return err
+	}
+	if err := pArr.nameFree(c, newProduct); err != nil {
+		return err
+	}
+	newProduct.Rating, newProduct.Stock = nil, nil
+	newProduct.UpdatedAt = datastore.Modified(pArr.now())
+	c.put(newProduct)
+	c.recordPrice(newProduct, pArr.now())
+	c.recordChange(newProduct.Id, datastore.ChangeCreated, pArr.now())
+	return pArr.logWrite(ctx, "AddProduct", newProduct)
+}
+
+// AddProducts - adds all of the Products or, if any ID or unique value is already taken, none of them.
+func (pArr *Products) AddProducts(ctx context.Context, newProducts []Product) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	seen := map[string]bool{}
+	for _, p := range newProducts {
+		if _, ok := c.products[p.Id]; ok || seen[p.Id] {
+			return datastore.Errorf("product_exists", "Product <%v> already exists: %w", p.Id, datastore.ErrConflict)
+		}
+		seen[p.Id] = true
+	}
+	if err := pArr.unique(c, newProducts); err != nil {
+		return err
+	}
+	for _, p := range newProducts {
+		p.Rating, p.Stock = nil, nil
+		p.UpdatedAt = datastore.Modified(pArr.now())
+		c.put(p)
+		c.recordPrice(p, pArr.now())
+		c.recordChange(p.Id, datastore.ChangeCreated, pArr.now())
+	}
+	return pArr.logWrite(ctx, "AddProducts", newProducts)
+}
+
+func (pArr *Products) GetProduct(ctx context.Context, product *Product) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return pArr.catalog(ctx, false).get(product)
+}
+
+// get - looks up a live Product; must be called with the store's lock held.
+func (c *catalog) get(product *Product) error {
+	if p, ok := c.products[product.Id]; ok && !p.Expired() {
+		*product = p
+		return nil
+	}
+	return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", product.Id, datastore.ErrNotFound)
+}
+
+// FindByBarcode - the live Product with the barcode.
+func (pArr *Products) FindByBarcode(ctx context.Context, code string) (Product, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	c := pArr.catalog(ctx, false)
+	for _, p := range c.indexed(c.barcodes[code]) {
+		if code != "" && !p.Expired() {
+			return p, nil
+		}
+	}
+	return Product{}, datastore.Errorf("product_not_found", "No product has barcode %v: %w", code, datastore.ErrNotFound)
+}
+
+// barcodeFree - checks that no other live Product has p's barcode; must be called with the store's lock held.
+func (c *catalog) barcodeFree(p Product) error {
+	if p.Barcode == "" {
+		return nil
+	}
+	for _, other := range c.indexed(c.barcodes[p.Barcode]) {
+		if other.Id != p.Id && !other.Expired() {
+			return datastore.Errorf("barcode_in_use", "Barcode %v is already in use by product <%v>: %w", p.Barcode, other.Id, datastore.ErrConflict)
+		}
+	}
+	return nil
+}
+
+// CheckUnique - the conflict adding or updating the Products would run into over a barcode or (unique) name.
+func (pArr *Products) CheckUnique(ctx context.Context, products []Product) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return pArr.unique(pArr.catalog(ctx, false), products)
+}
+
+// unique - checks that the Products' barcodes and (unique) names are free in c and not shared between them; must be
+// called with the store's lock held.
+func (pArr *Products) unique(c *catalog, products []Product) error {
+	barcodes, names := map[string]bool{}, map[string]bool{}
+	for _, p := range products {
+		if err := c.barcodeFree(p); err != nil {
+			return err
+		}
+		if p.Barcode != "" && barcodes[p.Barcode] {
+			return datastore.Errorf("barcode_in_use", "Barcode %v is already in use: %w", p.Barcode, datastore.ErrConflict)
+		}
+		barcodes[p.Barcode] = true
+		if err := pArr.nameFree(c, p); err != nil {
+			return err
+		}
+		lower := strings.ToLower(p.Name)
+		if pArr.uniqueNames && p.Name != "" && names[lower] {
+			return datastore.Errorf("name_in_use", "Name %q is already in use: %w", p.Name, datastore.ErrConflict)
+		}
+		names[lower] = true
+	}
+	return nil
 }
 
-func (pArr *Products) AddProduct(newProduct Product) error {
-	*pArr = append(*pArr, newProduct)
+// nameFree - with unique names, checks that no other live Product in c has p's name (ignoring case); must be called
+// with the store's lock held.
+func (pArr *Products) nameFree(c *catalog, p Product) error {
+	if !pArr.uniqueNames || p.Name == "" {
+		return nil
+	}
+	for _, other := range c.indexed(c.names[strings.ToLower(p.Name)]) {
+		if other.Id != p.Id && !other.Expired() {
+			return datastore.Errorf("name_in_use", "Name %q is already in use by product <%v>: %w", p.Name, other.Id, datastore.ErrConflict)
+		}
+	}
 	return nil
 }
 
-func (pArr Products) GetProduct(product *Product) error {
-	for _, p := range pArr {
-		if product.Id == p.Id {
-			*product = p
-			return nil
+// FindByName - responds with the Products whose name matches (ignoring case), in price-descending order.
+func (pArr *Products) FindByName(ctx context.Context, name string) ([]Product, error) {
+	pArr.mu.RLock()
+	c := pArr.catalog(ctx, false)
+	matches := live(c.indexed(c.names[strings.ToLower(name)]))
+	pArr.mu.RUnlock()
+
+	datastore.SortProducts(matches, datastore.DefaultSort)
+	return matches, nil
+}
+
+// SearchByPrefix - responds with the Products whose name starts with prefix (ignoring case), in price-descending order.
+func (pArr *Products) SearchByPrefix(ctx context.Context, prefix string) ([]Product, error) {
+	prefix = strings.ToLower(prefix)
+	return pArr.filter(ctx, func(p Product) bool { return strings.HasPrefix(strings.ToLower(p.Name), prefix) })
+}
+
+func (pArr *Products) FilterProducts(ctx context.Context, expr datastore.Expr) ([]Product, error) {
+	return pArr.filter(ctx, expr.Match)
+}
+
+// filter - copies out the live Products that match, in price-descending order.
+func (pArr *Products) filter(ctx context.Context, match func(Product) bool) ([]Product, error) {
+	pArr.mu.RLock()
+	matches := []Product{}
+	for _, p := range pArr.catalog(ctx, false).products {
+		if match(p) {
+			matches = append(matches, p)
+		}
+	}
+	pArr.mu.RUnlock()
+
+	matches = live(matches)
+	datastore.SortProducts(matches, datastore.DefaultSort)
+	return matches, nil
+}
+
+// live - drops the expired Products, hiding them as DynamoDB's TTL would.
+func live(products []Product) []Product {
+	kept := products[:0]
+	for _, p := range products {
+		if !p.Expired() {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (pArr *Products) GetProducts(ctx context.Context, ids []string) ([]Product, []string, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	c := pArr.catalog(ctx, false)
+	products := []Product{}
+	missing := []string{}
+	for _, id := range ids {
+		p := Product{Id: id}
+		if err := c.get(&p); err != nil {
+			missing = append(missing, id)
+			continue
 		}
+		products = append(products, p)
 	}
-	return fmt.Errorf("Product <%v> does not exist", product.Id)
+	return products, missing, nil
 }
 
-func (pArr *Products) UpdateProduct(newProduct Product) error {
-	for i, op := range *pArr {
-		if op.Id == newProduct.Id {
-			(*pArr)[i] = newProduct
-			return nil
+func (pArr *Products) UpdateProduct(ctx context.Context, newProduct Product) (Product, error) {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	if old, ok := c.products[newProduct.Id]; ok && !old.Expired() {
+		if err := c.barcodeFree(newProduct); err != nil {
+			return Product{}, err
+		}
+		if err := pArr.nameFree(c, newProduct); err != nil {
+			return Product{}, err
 		}
+		if old.Price != newProduct.Price {
+			c.recordPrice(newProduct, pArr.now())
+		}
+		// The rating comes from the reviews, and the stock from adjustments, not the update.
+		newProduct.Rating, newProduct.Stock = old.Rating, old.Stock
+		newProduct.UpdatedAt = datastore.Modified(pArr.now())
+		c.put(newProduct)
+		c.recordChange(newProduct.Id, datastore.ChangeUpdated, pArr.now())
+		return newProduct, pArr.logWrite(ctx, "UpdateProduct", newProduct)
+	}
+	return Product{}, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", newProduct.Id, datastore.ErrNotFound)
+}
+
+func (pArr *Products) DeleteProduct(ctx context.Context, p Product) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	if c.remove(p.Id) {
+		c.recordChange(p.Id, datastore.ChangeDeleted, pArr.now())
+		return pArr.logWrite(ctx, "DeleteProduct", p)
 	}
-	return fmt.Errorf("Product <%v> does not exist", newProduct.Id)
+	return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", p.Id, datastore.ErrNotFound)
 }
 
-func (pArr *Products) DeleteProduct(p Product) error {
-	for i, op := range *pArr {
-		if op.Id == p.Id {
-			*pArr = append((*pArr)[:i], (*pArr)[i+1:]...)
-			return nil
+// Truncate - forgets the context's tenant's catalog, so it starts again empty.
+func (pArr *Products) Truncate(ctx context.Context) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	delete(pArr.tenants, datastore.Tenant(ctx))
+	return pArr.logWrite(ctx, "Truncate")
+}
+
+func (pArr *Products) ExpiredProducts(ctx context.Context) ([]Product, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	expired := []Product{}
+	for _, p := range pArr.catalog(ctx, false).products {
+		if p.Expired() {
+			expired = append(expired, p)
 		}
 	}
-	return fmt.Errorf("Product <%v> does not exist", p.Id)
+	sort.Slice(expired, func(i, j int) bool { return idLess(expired[i].Id, expired[j].Id) })
+	return expired, nil
+}
+
+// Explain - describes how a listing query would be executed. A lookup by name uses the catalog's index; every other
+// listing, including one by name prefix, is a linear pass over memory.
+func (pArr *Products) Explain(ctx context.Context, query datastore.ListQuery) (datastore.QueryPlan, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	c := pArr.catalog(ctx, false)
+	f := query.Filter
+	if f.Name != "" {
+		items := len(c.names[strings.ToLower(f.Name)])
+		return datastore.QueryPlan{Operation: "in-memory lookup", Index: "name", EstimatedItems: int64(items)}, nil
+	}
+	plan := datastore.QueryPlan{
+		Operation:      "in-memory scan",
+		Index:          "none",
+		FullScan:       true,
+		EstimatedItems: int64(len(c.products)),
+	}
+	switch {
+	case f.NamePrefix != "":
+		plan.Notes = append(plan.Notes, "A name prefix is matched against every Product's name")
+	case f.Query != "":
+		plan.Notes = append(plan.Notes, "A search scores every Product's name")
+	case f.Expr != nil:
+		plan.Notes = append(plan.Notes, "A filter expression is matched against every Product")
+	}
+	return plan, nil
+}
+
+// migrations - dummydb's schema history. There is nothing to migrate yet, since a store without a write-ahead log is
+// reseeded on every start, but the version is tracked (and logged) the same way as for DynamoDB.
+var migrations []migrate.Migration
+
+func (pArr *Products) SchemaVersion(ctx context.Context) (int, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return pArr.schemaVersion, nil
 }
 
-func Initialize() error {
-	Items = Products{
-		{1, "Apple", 0.98},
-		{2, "Orange", 0.98},
-		{3, "Bananas", 2.25},
-		{4, "Frozen Pizza", 4.99},
+func (pArr *Products) SetSchemaVersion(ctx context.Context, version int) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if version > pArr.schemaVersion {
+		pArr.schemaVersion = version
+		return pArr.logWrite(ctx, "SetSchemaVersion", version)
 	}
 	return nil
 }
 
+/*
+Initialize - seeds the store or, with a write-ahead log configured, recovers it from the log's directory (see
+recoverWAL), then applies any pending migrations.
+*/
+func Initialize(cfg config.Config) error {
+	if err := Items.closeWAL(); err != nil {
+		log.Printf("Closing the write-ahead log failed: %v", err)
+	}
+
+	// Each tenant starts with its own copy of the seed data.
+	tenants := map[string]*catalog{}
+	for _, tenant := range cfg.Tenancy.Names() {
+		var products []Product
+		if !cfg.Seed.Skip {
+			var err error
+			if products, err = datastore.SeedProducts(cfg.Seed.File); err != nil {
+				return err
+			}
+		}
+		tenants[tenant] = newCatalog(products, len(products))
+	}
+	Items.mu.Lock()
+	Items.tenants = tenants
+	Items.uniqueNames = cfg.UniqueNames
+	Items.users = nil
+	Items.mu.Unlock()
+
+	if cfg.DummyDB.WALDir != "" {
+		if err := Items.recoverWAL(cfg.DummyDB); err != nil {
+			return err
+		}
+	}
+	return migrate.Run(context.Background(), &Items, migrations)
+}
+
+// Cleanup - compacts and closes the write-ahead log, if there is one, so the next start has nothing to replay.
 func Cleanup() error {
 	fmt.Println("Cleaning up...")
-	return nil
+	if err := Items.compact(); err != nil {
+		return err
+	}
+	return Items.closeWAL()
 }
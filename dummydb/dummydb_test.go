@@ -0,0 +1,56 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/datastore/storetest"
+)
+
+func TestDatastore(t *testing.T) {
+	storetest.Run(t, storetest.Backend{Store: &Products{}})
+}
+
+// The name and barcode indexes follow Products as they're renamed, relabelled and deleted.
+func TestIndexes(t *testing.T) {
+	ctx := context.Background()
+	store := &Products{}
+	apple := Product{Id: "1", Name: "Apple", Price: datastore.MustParseMoney("0.98"), Barcode: "4006381333931"}
+	if err := store.AddProducts(ctx, []Product{apple, {Id: "2", Name: "apple", Price: datastore.MustParseMoney("1.20")}}); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.FindByName(ctx, "APPLE"); len(found) != 2 || found[0].Id != "2" {
+		t.Fatalf("Got %v, want both apples, dearest first", found)
+	}
+
+	apple.Name, apple.Barcode = "Green Apple", "5901234123457"
+	if _, err := store.UpdateProduct(ctx, apple); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.FindByName(ctx, "apple"); len(found) != 1 || found[0].Id != "2" {
+		t.Fatalf("Got %v, want only product 2 by its old name", found)
+	}
+	if found, _ := store.FindByName(ctx, "green apple"); len(found) != 1 || found[0].Id != "1" {
+		t.Fatalf("Got %v, want product 1 by its new name", found)
+	}
+	if _, err := store.FindByBarcode(ctx, "4006381333931"); err == nil {
+		t.Fatal("The old barcode still finds product 1")
+	}
+	if p, err := store.FindByBarcode(ctx, "5901234123457"); err != nil || p.Id != "1" {
+		t.Fatalf("Got %v, %v; want product 1 by its new barcode", p, err)
+	}
+
+	if err := store.DeleteProduct(ctx, apple); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.FindByName(ctx, "green apple"); len(found) != 0 {
+		t.Fatalf("Got %v after deleting it", found)
+	}
+	if err := store.AddProduct(ctx, Product{Id: "3", Name: "Kiwi", Price: datastore.MustParseMoney("0.40"), Barcode: "5901234123457"}); err != nil {
+		t.Fatalf("The deleted product's barcode wasn't freed: %v", err)
+	}
+}
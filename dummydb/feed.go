@@ -0,0 +1,75 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+)
+
+// feedBatch - how many changes FollowChanges reads from a tenant's log at a time.
+const feedBatch = 100
+
+/*
+FollowChanges - publishes every tenant's changes on the bus as they're logged, from now until the context is done.
+Only the API can change the catalog, so the change log has them all; it's read every cfg.ChangeFeed.PollInterval.
+Events carry the Product as it is when they're published.
+*/
+func FollowChanges(ctx context.Context, cfg config.Config, bus *events.Bus) error {
+	tenants := cfg.Tenancy.Names()
+	after := make(map[string]datastore.Change, len(tenants))
+	for _, tenant := range tenants {
+		after[tenant] = datastore.Change{At: time.Now().UTC()}
+	}
+
+	ticker := time.NewTicker(cfg.ChangeFeed.PollInterval.Duration)
+	defer ticker.Stop()
+	for {
+		for _, tenant := range tenants {
+			tenantCtx := datastore.WithTenant(ctx, tenant)
+			for {
+				changes, err := Items.GetChanges(tenantCtx, after[tenant], feedBatch)
+				if err != nil {
+					return err
+				}
+				if len(changes) == 0 {
+					break
+				}
+				publishChanges(tenantCtx, bus, changes)
+				after[tenant] = changes[len(changes)-1]
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishChanges - publishes the context's tenant's changes, with the Products that still exist.
+func publishChanges(ctx context.Context, bus *events.Bus, changes []datastore.Change) {
+	ids := make([]string, len(changes))
+	for i, c := range changes {
+		ids[i] = c.ProductId
+	}
+	products, _, _ := Items.GetProducts(ctx, ids)
+	current := make(map[string]Product, len(products))
+	for _, p := range products {
+		current[p.Id] = p
+	}
+
+	for _, c := range changes {
+		e := events.Event{Tenant: datastore.Tenant(ctx), Change: c}
+		if p, ok := current[c.ProductId]; ok && c.Kind != datastore.ChangeDeleted {
+			e.Product = &p
+		}
+		bus.Publish(ctx, e)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+)
+
+func TestFollowChanges(t *testing.T) {
+	cfg := config.Default()
+	cfg.Seed.Skip = true
+	cfg.ChangeFeed.PollInterval = config.Duration{Duration: 10 * time.Millisecond}
+	if err := Initialize(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// Changes from before the feed started aren't published.
+	if err := Items.AddProduct(ctx, Product{Id: "1", Name: "Apple", Price: datastore.MustParseMoney("0.98")}); err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan events.Event, 10)
+	bus := &events.Bus{}
+	bus.Subscribe(func(ctx context.Context, e events.Event) { published <- e })
+	feedCtx, stop := context.WithCancel(ctx)
+	stopped := make(chan error)
+	go func() { stopped <- FollowChanges(feedCtx, cfg, bus) }()
+	time.Sleep(50 * time.Millisecond)
+
+	next := func(want string) {
+		t.Helper()
+		select {
+		case e := <-published:
+			if e.ProductId != "1" || e.Kind != want || (e.Product != nil) != (want != datastore.ChangeDeleted) {
+				t.Fatalf("Got %+v, want product 1 %v", e, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No %v event was published", want)
+		}
+	}
+	if _, err := Items.UpdateProduct(ctx, Product{Id: "1", Name: "Apple", Price: datastore.MustParseMoney("1.25")}); err != nil {
+		t.Fatal(err)
+	}
+	next(datastore.ChangeUpdated)
+	if err := Items.DeleteProduct(ctx, Product{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	next(datastore.ChangeDeleted)
+
+	stop()
+	if err := <-stopped; err != context.Canceled {
+		t.Fatalf("FollowChanges returned %v once stopped", err)
+	}
+	if len(published) != 0 {
+		t.Fatalf("Published %+v as well", <-published)
+	}
+}
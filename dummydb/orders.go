@@ -0,0 +1,95 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type Order = datastore.Order
+
+// AddOrder - places the order if every line is in stock, then takes the quantities out of stock: a variant's, or the
+// locations' of a Product without variants that tracks stock. Reserved lines use up their reservations instead.
+func (pArr *Products) AddOrder(ctx context.Context, order Order) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	if _, ok := c.orders[order.Id]; ok {
+		return datastore.Errorf("order_exists", "Order <%v> already exists: %w", order.Id, datastore.ErrConflict)
+	}
+
+	// Check every line before changing any stock, so a failed order leaves nothing behind.
+	wanted := map[string]int{}
+	for _, line := range order.Lines {
+		if line.ReservationId != "" {
+			if res, ok := c.reservations[line.ReservationId]; !ok || res.Expired() {
+				return datastore.Errorf("reservation_expired", "Reservation <%v> has expired: %w", line.ReservationId, datastore.ErrConflict)
+			}
+			continue
+		}
+		if line.VariantId == "" {
+			wanted[line.ProductId] += line.Quantity
+			continue
+		}
+		i := c.variant(line.ProductId, line.VariantId)
+		if i < 0 {
+			return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", line.VariantId, line.ProductId, datastore.ErrNotFound)
+		}
+		if c.variants[line.ProductId][i].Stock < line.Quantity {
+			return datastore.Errorf("out_of_stock", "Variant <%v> of product <%v> is out of stock: %w", line.VariantId, line.ProductId, datastore.ErrConflict)
+		}
+	}
+	taken := map[string]map[string]int{}
+	for id, quantity := range wanted {
+		p, ok := c.products[id]
+		if !ok || p.Expired() {
+			return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+		}
+		if p.Stock == nil {
+			continue
+		}
+		if taken[id], ok = p.Stock.Allocate(quantity); !ok {
+			return datastore.Errorf("out_of_stock", "Product <%v> is out of stock: %w", id, datastore.ErrConflict)
+		}
+	}
+
+	for id, locations := range taken {
+		p := c.products[id]
+		for location, quantity := range locations {
+			p.Stock = p.Stock.Adjusted(location, -quantity)
+		}
+		p.UpdatedAt = datastore.Modified(pArr.now())
+		c.products[id] = p
+		c.recordChange(id, datastore.ChangeUpdated, pArr.now())
+	}
+	for _, line := range order.Lines {
+		switch {
+		case line.ReservationId != "":
+			delete(c.reservations, line.ReservationId)
+		case line.VariantId != "":
+			c.variants[line.ProductId][c.variant(line.ProductId, line.VariantId)].Stock -= line.Quantity
+		}
+	}
+
+	if c.orders == nil {
+		c.orders = map[string]Order{}
+	}
+	order.Lines = append([]datastore.OrderLine{}, order.Lines...)
+	c.orders[order.Id] = order
+	return pArr.logWrite(ctx, "AddOrder", order)
+}
+
+func (pArr *Products) GetOrder(ctx context.Context, order *Order) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	stored, ok := pArr.catalog(ctx, false).orders[order.Id]
+	if !ok {
+		return datastore.Errorf("order_not_found", "Order <%v> does not exist: %w", order.Id, datastore.ErrNotFound)
+	}
+	*order = stored
+	order.Lines = append([]datastore.OrderLine{}, stored.Lines...)
+	return nil
+}
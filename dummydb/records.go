@@ -0,0 +1,84 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// copyRecord - local helper function that copies a record, nested objects and arrays included, so that neither the
+// caller nor the store can change the other's.
+func copyRecord(r datastore.Record) datastore.Record {
+	b, _ := json.Marshal(r)
+	var c datastore.Record
+	json.Unmarshal(b, &c)
+	return c
+}
+
+// GetRecords - every record of the resource.
+func (pArr *Products) GetRecords(ctx context.Context, resource string) ([]datastore.Record, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	records := []datastore.Record{}
+	for _, r := range pArr.catalog(ctx, false).records[resource] {
+		records = append(records, copyRecord(r))
+	}
+	return records, nil
+}
+
+// GetRecord - the record of the resource with the given ID.
+func (pArr *Products) GetRecord(ctx context.Context, resource, id string) (datastore.Record, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	r, ok := pArr.catalog(ctx, false).records[resource][id]
+	if !ok {
+		return nil, datastore.RecordNotFound(resource, id)
+	}
+	return copyRecord(r), nil
+}
+
+// AddRecord - adds a record, unless its ID is taken.
+func (pArr *Products) AddRecord(ctx context.Context, resource string, record datastore.Record) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	if _, ok := c.records[resource][record.Id()]; ok {
+		return datastore.RecordExists(resource, record.Id())
+	}
+	if c.records == nil {
+		c.records = map[string]map[string]datastore.Record{}
+	}
+	if c.records[resource] == nil {
+		c.records[resource] = map[string]datastore.Record{}
+	}
+	c.records[resource][record.Id()] = copyRecord(record)
+	return pArr.logWrite(ctx, "AddRecord", resource, record)
+}
+
+// UpdateRecord - replaces an existing record.
+func (pArr *Products) UpdateRecord(ctx context.Context, resource string, record datastore.Record) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	records := pArr.catalog(ctx, false).records[resource]
+	if _, ok := records[record.Id()]; !ok {
+		return datastore.RecordNotFound(resource, record.Id())
+	}
+	records[record.Id()] = copyRecord(record)
+	return pArr.logWrite(ctx, "UpdateRecord", resource, record)
+}
+
+// DeleteRecord - removes an existing record.
+func (pArr *Products) DeleteRecord(ctx context.Context, resource, id string) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	records := pArr.catalog(ctx, false).records[resource]
+	if _, ok := records[id]; !ok {
+		return datastore.RecordNotFound(resource, id)
+	}
+	delete(records, id)
+	return pArr.logWrite(ctx, "DeleteRecord", resource, id)
+}
@@ -0,0 +1,71 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type Reservation = datastore.Reservation
+
+func (pArr *Products) Reserve(ctx context.Context, reservation Reservation) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	i := c.variant(reservation.ProductId, reservation.VariantId)
+	if i < 0 {
+		return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", reservation.VariantId, reservation.ProductId, datastore.ErrNotFound)
+	}
+	variant := &c.variants[reservation.ProductId][i]
+	if variant.Stock < reservation.Quantity {
+		return datastore.Errorf("out_of_stock", "Variant <%v> of product <%v> is out of stock: %w", variant.Id, variant.ProductId, datastore.ErrConflict)
+	}
+	variant.Stock -= reservation.Quantity
+	if c.reservations == nil {
+		c.reservations = map[string]Reservation{}
+	}
+	c.reservations[reservation.Id] = reservation
+	return pArr.logWrite(ctx, "Reserve", reservation)
+}
+
+func (pArr *Products) GetReservation(ctx context.Context, reservation *Reservation) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	stored, ok := pArr.catalog(ctx, false).reservations[reservation.Id]
+	if !ok || stored.Expired() {
+		return datastore.Errorf("reservation_not_found", "Reservation <%v> does not exist: %w", reservation.Id, datastore.ErrNotFound)
+	}
+	*reservation = stored
+	return nil
+}
+
+// ReleaseReservation - deletes the reservation and returns its stock, unless its variant has since been deleted.
+func (pArr *Products) ReleaseReservation(ctx context.Context, reservation Reservation) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	stored, ok := c.reservations[reservation.Id]
+	if !ok {
+		return datastore.Errorf("reservation_not_found", "Reservation <%v> does not exist: %w", reservation.Id, datastore.ErrNotFound)
+	}
+	delete(c.reservations, reservation.Id)
+	if i := c.variant(stored.ProductId, stored.VariantId); i >= 0 {
+		c.variants[stored.ProductId][i].Stock += stored.Quantity
+	}
+	return pArr.logWrite(ctx, "ReleaseReservation", reservation)
+}
+
+func (pArr *Products) ExpiredReservations(ctx context.Context) ([]Reservation, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	expired := []Reservation{}
+	for _, r := range pArr.catalog(ctx, false).reservations {
+		if r.Expired() {
+			expired = append(expired, r)
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,112 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type Review = datastore.Review
+
+func (pArr *Products) GetReviews(ctx context.Context, productID string) ([]Review, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return append([]Review{}, pArr.catalog(ctx, false).reviews[productID]...), nil
+}
+
+func (pArr *Products) GetReview(ctx context.Context, review *Review) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	c := pArr.catalog(ctx, false)
+	if i := c.review(review.ProductId, review.Id); i >= 0 {
+		*review = c.reviews[review.ProductId][i]
+		return nil
+	}
+	return datastore.Errorf("review_not_found", "Review <%v> of product <%v> does not exist: %w", review.Id, review.ProductId, datastore.ErrNotFound)
+}
+
+func (pArr *Products) AddReview(ctx context.Context, review Review) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	if _, ok := c.products[review.ProductId]; !ok {
+		return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", review.ProductId, datastore.ErrNotFound)
+	}
+	if c.review(review.ProductId, review.Id) >= 0 {
+		return datastore.Errorf("review_exists", "Review <%v> already exists: %w", review.Id, datastore.ErrConflict)
+	}
+	if c.reviews == nil {
+		c.reviews = map[string][]Review{}
+	}
+	c.reviews[review.ProductId] = append(c.reviews[review.ProductId], review)
+	c.rate(review.ProductId, pArr.now())
+	return pArr.logWrite(ctx, "AddReview", review)
+}
+
+func (pArr *Products) UpdateReview(ctx context.Context, old, review Review) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	i := c.review(review.ProductId, review.Id)
+	if i < 0 {
+		return datastore.Errorf("review_not_found", "Review <%v> of product <%v> does not exist: %w", review.Id, review.ProductId, datastore.ErrNotFound)
+	}
+	if c.reviews[review.ProductId][i].Rating != old.Rating {
+		return datastore.Errorf("concurrent_update", "Review <%v> was changed by another request: %w", review.Id, datastore.ErrConflict)
+	}
+	c.reviews[review.ProductId][i] = review
+	c.rate(review.ProductId, pArr.now())
+	return pArr.logWrite(ctx, "UpdateReview", old, review)
+}
+
+func (pArr *Products) DeleteReview(ctx context.Context, review Review) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	i := c.review(review.ProductId, review.Id)
+	if i < 0 {
+		return datastore.Errorf("review_not_found", "Review <%v> of product <%v> does not exist: %w", review.Id, review.ProductId, datastore.ErrNotFound)
+	}
+	if c.reviews[review.ProductId][i].Rating != review.Rating {
+		return datastore.Errorf("concurrent_update", "Review <%v> was changed by another request: %w", review.Id, datastore.ErrConflict)
+	}
+	reviews := c.reviews[review.ProductId]
+	c.reviews[review.ProductId] = append(reviews[:i:i], reviews[i+1:]...)
+	c.rate(review.ProductId, pArr.now())
+	return pArr.logWrite(ctx, "DeleteReview", review)
+}
+
+// review - the position of a review among its Product's, or -1; must be called with the store's lock held.
+func (c *catalog) review(productID, id string) int {
+	for i, r := range c.reviews[productID] {
+		if r.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// rate - recalculates a Product's Rating from its reviews, logging the change (as made at at) if it moved; must be
+// called with the write lock held.
+func (c *catalog) rate(productID string, at time.Time) {
+	p, ok := c.products[productID]
+	if !ok {
+		return
+	}
+	sum := 0
+	for _, r := range c.reviews[productID] {
+		sum += r.Rating
+	}
+	rating := datastore.NewRating(sum, len(c.reviews[productID]))
+	if old := p.Rating; old != nil && rating != nil && *old == *rating {
+		return
+	}
+	p.Rating = rating
+	p.UpdatedAt = datastore.Modified(at)
+	c.products[productID] = p
+	c.recordChange(productID, datastore.ChangeUpdated, at)
+}
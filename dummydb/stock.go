@@ -0,0 +1,29 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// AdjustStock - replaces the Product's stock levels with adjusted copies, so Products already read aren't changed.
+func (pArr *Products) AdjustStock(ctx context.Context, id, location string, delta int) (Product, error) {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	p, ok := c.products[id]
+	if !ok || p.Expired() {
+		return Product{}, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	if p.Stock[location]+delta < 0 {
+		return Product{}, datastore.Errorf("insufficient_stock", "Product <%v> has only %v in stock at location %v: %w", id, p.Stock[location], location, datastore.ErrConflict)
+	}
+	p.Stock = p.Stock.Adjusted(location, delta)
+	p.UpdatedAt = datastore.Modified(pArr.now())
+	c.products[id] = p
+	c.recordChange(id, datastore.ChangeUpdated, pArr.now())
+	return p, pArr.logWrite(ctx, "AdjustStock", id, location, delta)
+}
@@ -0,0 +1,75 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type User = datastore.User
+
+// copyUser - the user, with Roles and Tenants slices of its own.
+func copyUser(u User) User {
+	u.Roles = append([]string{}, u.Roles...)
+	u.Tenants = append([]string(nil), u.Tenants...)
+	return u
+}
+
+func (pArr *Products) GetUsers(ctx context.Context) ([]User, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	users := []User{}
+	for _, u := range pArr.users {
+		users = append(users, copyUser(u))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+func (pArr *Products) GetUser(ctx context.Context, user *User) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	stored, ok := pArr.users[user.Name]
+	if !ok {
+		return datastore.Errorf("user_not_found", "User <%v> does not exist: %w", user.Name, datastore.ErrNotFound)
+	}
+	*user = copyUser(stored)
+	return nil
+}
+
+func (pArr *Products) AddUser(ctx context.Context, user User) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if _, ok := pArr.users[user.Name]; ok {
+		return datastore.Errorf("user_exists", "User <%v> already exists: %w", user.Name, datastore.ErrConflict)
+	}
+	if pArr.users == nil {
+		pArr.users = map[string]User{}
+	}
+	pArr.users[user.Name] = copyUser(user)
+	return pArr.logWrite(ctx, "AddUser", user)
+}
+
+func (pArr *Products) UpdateUser(ctx context.Context, user User) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if _, ok := pArr.users[user.Name]; !ok {
+		return datastore.Errorf("user_not_found", "User <%v> does not exist: %w", user.Name, datastore.ErrNotFound)
+	}
+	pArr.users[user.Name] = copyUser(user)
+	return pArr.logWrite(ctx, "UpdateUser", user)
+}
+
+func (pArr *Products) DeleteUser(ctx context.Context, name string) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if _, ok := pArr.users[name]; !ok {
+		return datastore.Errorf("user_not_found", "User <%v> does not exist: %w", name, datastore.ErrNotFound)
+	}
+	delete(pArr.users, name)
+	return pArr.logWrite(ctx, "DeleteUser", name)
+}
@@ -0,0 +1,80 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+type Variant = datastore.Variant
+
+func (pArr *Products) GetVariants(ctx context.Context, productID string) ([]Variant, error) {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	return append([]Variant{}, pArr.catalog(ctx, false).variants[productID]...), nil
+}
+
+func (pArr *Products) GetVariant(ctx context.Context, variant *Variant) error {
+	pArr.mu.RLock()
+	defer pArr.mu.RUnlock()
+	c := pArr.catalog(ctx, false)
+	if i := c.variant(variant.ProductId, variant.Id); i >= 0 {
+		*variant = c.variants[variant.ProductId][i]
+		return nil
+	}
+	return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+}
+
+func (pArr *Products) AddVariant(ctx context.Context, variant Variant) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, true)
+	if _, ok := c.products[variant.ProductId]; !ok {
+		return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", variant.ProductId, datastore.ErrNotFound)
+	}
+	if c.variant(variant.ProductId, variant.Id) >= 0 {
+		return datastore.Errorf("variant_exists", "Variant <%v> already exists: %w", variant.Id, datastore.ErrConflict)
+	}
+	if c.variants == nil {
+		c.variants = map[string][]Variant{}
+	}
+	c.variants[variant.ProductId] = append(c.variants[variant.ProductId], variant)
+	return pArr.logWrite(ctx, "AddVariant", variant)
+}
+
+func (pArr *Products) UpdateVariant(ctx context.Context, variant Variant) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	if i := c.variant(variant.ProductId, variant.Id); i >= 0 {
+		c.variants[variant.ProductId][i] = variant
+		return pArr.logWrite(ctx, "UpdateVariant", variant)
+	}
+	return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+}
+
+func (pArr *Products) DeleteVariant(ctx context.Context, variant Variant) error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	c := pArr.catalog(ctx, false)
+	i := c.variant(variant.ProductId, variant.Id)
+	if i < 0 {
+		return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+	}
+	variants := c.variants[variant.ProductId]
+	c.variants[variant.ProductId] = append(variants[:i:i], variants[i+1:]...)
+	return pArr.logWrite(ctx, "DeleteVariant", variant)
+}
+
+// variant - the position of a variant among its Product's, or -1; must be called with the store's lock held.
+func (c *catalog) variant(productID, id string) int {
+	for i, v := range c.variants[productID] {
+		if v.Id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,372 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// walFile / snapshotFile - the names of the log and the snapshot in the WAL directory.
+const (
+	walFile      = "wal.jsonl"
+	snapshotFile = "snapshot.json"
+)
+
+/*
+walOps - the writes that are logged, by method name. Replaying an entry calls the same method again, with the
+arguments it was first called with.
+*/
+var walOps = map[string]bool{
+	"NextID": true, "AdvanceID": true, "AddProduct": true, "AddProducts": true, "UpdateProduct": true,
+	"AdjustStock": true, "DeleteProduct": true, "Truncate": true, "DeleteOutbox": true, "SetSchemaVersion": true,
+	"PutCart": true, "DeleteCart": true, "AddOrder": true, "Reserve": true, "ReleaseReservation": true,
+	"AddReview": true, "UpdateReview": true, "DeleteReview": true, "AddVariant": true, "UpdateVariant": true,
+	"DeleteVariant": true, "AddUser": true, "UpdateUser": true, "DeleteUser": true,
+	"AddRecord": true, "UpdateRecord": true, "DeleteRecord": true,
+}
+
+// walEntry - one line of the log: a write, the tenant it was made in, when, and its arguments after the context.
+type walEntry struct {
+	Seq    int64             `json:"seq"`
+	At     time.Time         `json:"at"`
+	Tenant string            `json:"tenant,omitempty"`
+	Op     string            `json:"op"`
+	Args   []json.RawMessage `json:"args,omitempty"`
+}
+
+// walSnapshot - the whole store, as of the log entry numbered Seq.
+type walSnapshot struct {
+	Seq           int64                   `json:"seq"`
+	SchemaVersion int                     `json:"schema_version"`
+	Users         map[string]User         `json:"users,omitempty"`
+	Tenants       map[string]catalogState `json:"tenants"`
+}
+
+// catalogState - a catalog as it's written to a snapshot.
+type catalogState struct {
+	Products     []Product                              `json:"products"`
+	LastID       int                                    `json:"last_id"`
+	History      map[string][]datastore.PricePoint      `json:"history,omitempty"`
+	Changes      []datastore.Change                     `json:"changes,omitempty"`
+	Outbox       []datastore.Change                     `json:"outbox,omitempty"`
+	Reviews      map[string][]Review                    `json:"reviews,omitempty"`
+	Variants     map[string][]Variant                   `json:"variants,omitempty"`
+	Orders       map[string]Order                       `json:"orders,omitempty"`
+	Carts        map[string]Cart                        `json:"carts,omitempty"`
+	Reservations map[string]Reservation                 `json:"reservations,omitempty"`
+	Records      map[string]map[string]datastore.Record `json:"records,omitempty"`
+}
+
+func (c *catalog) state() catalogState {
+	products := make([]Product, 0, len(c.products))
+	for _, p := range c.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return idLess(products[i].Id, products[j].Id) })
+	return catalogState{
+		Products: products, LastID: c.lastID, History: c.history, Changes: c.changes, Outbox: c.outbox,
+		Reviews: c.reviews, Variants: c.variants, Orders: c.orders, Carts: c.carts, Reservations: c.reservations,
+		Records: c.records,
+	}
+}
+
+func (s catalogState) catalog() *catalog {
+	c := newCatalog(s.Products, s.LastID)
+	*c = catalog{
+		products: c.products, names: c.names, barcodes: c.barcodes, lastID: s.LastID, history: s.History, changes: s.Changes, outbox: s.Outbox,
+		reviews: s.Reviews, variants: s.Variants, orders: s.Orders, carts: s.Carts, reservations: s.Reservations,
+		records: s.Records,
+	}
+	return c
+}
+
+// wal - an open write-ahead log.
+type wal struct {
+	dir  string
+	file *os.File
+	// seq - the number of the last entry appended; compacted - the number of the last entry in the snapshot.
+	seq, compacted int64
+	// stop - stops the periodic compaction.
+	stop context.CancelFunc
+}
+
+/*
+logWrite - appends a write that has just been made to the write-ahead log, if there is one, and syncs it to disk;
+must be called with the write lock held, so that entries are in the order the writes were made. A write that can't
+be logged fails as unavailable, though it has been made in memory, and won't survive a restart.
+*/
+func (pArr *Products) logWrite(ctx context.Context, op string, args ...interface{}) error {
+	at := pArr.now()
+	pArr.at = time.Time{}
+	if pArr.wal == nil {
+		return nil
+	}
+	e := walEntry{Seq: pArr.wal.seq + 1, At: at, Tenant: datastore.Tenant(ctx), Op: op}
+	for _, arg := range args {
+		b, err := json.Marshal(arg)
+		if err != nil {
+			return fmt.Errorf("Error encoding %v for the write-ahead log: %v", op, err)
+		}
+		e.Args = append(e.Args, b)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("Error encoding %v for the write-ahead log: %v", op, err)
+	}
+	if _, err := pArr.wal.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Appending %v to the write-ahead log failed: %v: %w", op, err, datastore.ErrUnavailable)
+	}
+	if err := pArr.wal.file.Sync(); err != nil {
+		return fmt.Errorf("Syncing the write-ahead log failed: %v: %w", err, datastore.ErrUnavailable)
+	}
+	pArr.wal.seq = e.Seq
+	return nil
+}
+
+/*
+recoverWAL - restores the store from the log directory: the snapshot, if there is one, replaces the seeded catalogs
+(tenants it doesn't have keep theirs), and then the log's entries after it are replayed, each with the time it was
+first made. The first start, with an empty directory, keeps the seed data. A last line cut short by a crash is
+dropped; any other unreadable line stops the app from starting. A write that fails when it's replayed, which can
+only happen when it depended on something that has expired since (such as an order using a reservation), is logged
+and skipped. The store is then compacted, and compacted again every cfg.CompactInterval.
+*/
+func (pArr *Products) recoverWAL(cfg config.DummyDB) error {
+	if cfg.CompactInterval.Duration <= 0 {
+		return fmt.Errorf("Write-ahead log compact interval must be positive, not %v", cfg.CompactInterval)
+	}
+	if err := os.MkdirAll(cfg.WALDir, 0755); err != nil {
+		return fmt.Errorf("Error creating write-ahead log directory: %v", err)
+	}
+	path := filepath.Join(cfg.WALDir, walFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Error opening write-ahead log: %v", err)
+	}
+
+	seq, err := pArr.loadSnapshot(cfg.WALDir)
+	if errors.Is(err, os.ErrNotExist) {
+		if info, statErr := file.Stat(); statErr == nil && info.Size() > 0 {
+			err = fmt.Errorf("Write-ahead log %v has no snapshot to replay it onto; remove it to start again", path)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	replayed, end, err := pArr.replay(file, &seq)
+	if err == nil {
+		// Appends go after the last whole entry, overwriting any that was cut short.
+		if err = file.Truncate(end); err == nil {
+			_, err = file.Seek(end, io.SeekStart)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Error replaying write-ahead log %v: %v", path, err)
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %v writes from the write-ahead log", replayed)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	pArr.mu.Lock()
+	pArr.wal = &wal{dir: cfg.WALDir, file: file, seq: seq, compacted: -1, stop: stop}
+	pArr.mu.Unlock()
+	if err := pArr.compact(); err != nil {
+		pArr.closeWAL()
+		return err
+	}
+	go pArr.compactEvery(ctx, cfg.CompactInterval.Duration)
+	return nil
+}
+
+// loadSnapshot - local helper function that replaces the store's contents with the snapshot in dir, returning its
+// sequence number.
+func (pArr *Products) loadSnapshot(dir string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return 0, err
+	}
+	var snap walSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("Error reading write-ahead log snapshot: %v", err)
+	}
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	for tenant, state := range snap.Tenants {
+		pArr.tenants[tenant] = state.catalog()
+	}
+	pArr.users = snap.Users
+	pArr.schemaVersion = snap.SchemaVersion
+	return snap.Seq, nil
+}
+
+/*
+replay - local helper function that replays the log's entries numbered after *seq, moving *seq to the last. It
+returns how many were replayed and where the last whole entry ends.
+*/
+func (pArr *Products) replay(r io.Reader, seq *int64) (int, int64, error) {
+	in := bufio.NewReader(r)
+	replayed, end := 0, int64(0)
+	for line := 1; ; line++ {
+		b, err := in.ReadBytes('\n')
+		if err == io.EOF {
+			return replayed, end, nil
+		}
+		if err != nil {
+			return replayed, end, err
+		}
+		var e walEntry
+		if err := json.Unmarshal(bytes.TrimSpace(b), &e); err != nil {
+			return replayed, end, fmt.Errorf("Line %v: %v", line, err)
+		}
+		end += int64(len(b))
+		if e.Seq <= *seq {
+			continue
+		}
+		*seq = e.Seq
+		method, args, err := pArr.decodeEntry(e)
+		if err != nil {
+			return replayed, end, fmt.Errorf("Line %v: %v", line, err)
+		}
+		pArr.mu.Lock()
+		pArr.at = e.At
+		pArr.mu.Unlock()
+		out := method.Call(args)
+		// A write that fails doesn't get as far as logWrite.
+		pArr.mu.Lock()
+		pArr.at = time.Time{}
+		pArr.mu.Unlock()
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			log.Printf("Write-ahead log entry %v (%v) was not replayed: %v", e.Seq, e.Op, err)
+			continue
+		}
+		replayed++
+	}
+}
+
+// decodeEntry - local helper function that finds the method a log entry calls and decodes its arguments.
+func (pArr *Products) decodeEntry(e walEntry) (reflect.Value, []reflect.Value, error) {
+	if !walOps[e.Op] {
+		return reflect.Value{}, nil, fmt.Errorf("Unknown operation %q", e.Op)
+	}
+	method := reflect.ValueOf(pArr).MethodByName(e.Op)
+	t := method.Type()
+	if len(e.Args) != t.NumIn()-1 {
+		return reflect.Value{}, nil, fmt.Errorf("%v takes %v arguments, not %v", e.Op, t.NumIn()-1, len(e.Args))
+	}
+	args := []reflect.Value{reflect.ValueOf(datastore.WithTenant(context.Background(), e.Tenant))}
+	for i, arg := range e.Args {
+		v := reflect.New(t.In(i + 1))
+		if err := json.Unmarshal(arg, v.Interface()); err != nil {
+			return reflect.Value{}, nil, fmt.Errorf("Error decoding %v argument %v: %v", e.Op, i+1, err)
+		}
+		args = append(args, v.Elem())
+	}
+	return method, args, nil
+}
+
+/*
+compact - writes a snapshot of the whole store and empties the log, whose entries it now includes. The snapshot is
+written to a temporary file and renamed into place, so a crash leaves either the old snapshot or the new one; if it
+comes after the rename but before the log is emptied, the entries the snapshot includes are skipped on replay.
+Writes wait while it runs.
+*/
+func (pArr *Products) compact() error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	w := pArr.wal
+	if w == nil || w.compacted == w.seq {
+		return nil
+	}
+
+	snap := walSnapshot{Seq: w.seq, SchemaVersion: pArr.schemaVersion, Users: pArr.users, Tenants: map[string]catalogState{}}
+	for tenant, c := range pArr.tenants {
+		snap.Tenants[tenant] = c.state()
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("Error encoding write-ahead log snapshot: %v", err)
+	}
+	path := filepath.Join(w.dir, snapshotFile)
+	if err := writeSynced(path+".tmp", data); err != nil {
+		return fmt.Errorf("Error writing write-ahead log snapshot: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("Error writing write-ahead log snapshot: %v", err)
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("Error emptying write-ahead log: %v", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Error emptying write-ahead log: %v", err)
+	}
+	w.compacted = w.seq
+	return nil
+}
+
+// writeSynced - local helper function that writes a file and syncs it to disk.
+func writeSynced(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compactEvery - compacts the log every interval until ctx is done.
+func (pArr *Products) compactEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pArr.compact(); err != nil {
+				log.Printf("Compacting the write-ahead log failed: %v", err)
+			}
+		}
+	}
+}
+
+// closeWAL - stops logging writes, if they were being logged.
+func (pArr *Products) closeWAL() error {
+	pArr.mu.Lock()
+	defer pArr.mu.Unlock()
+	if pArr.wal == nil {
+		return nil
+	}
+	pArr.wal.stop()
+	err := pArr.wal.file.Close()
+	pArr.wal = nil
+	return err
+}
@@ -0,0 +1,106 @@
+/*
+Author: Jason Payne
+*/
+package dummydb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// walConfig - a config that logs to dir, without compacting during the test.
+func walConfig(dir string) config.Config {
+	cfg := config.Default()
+	cfg.DummyDB.WALDir = dir
+	cfg.DummyDB.CompactInterval = config.Duration{Duration: time.Hour}
+	return cfg
+}
+
+func TestWALRecovers(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(dir)
+	if err := Initialize(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Items.closeWAL() })
+	ctx := context.Background()
+
+	id, err := Items.NextID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pear := Product{Id: id, Name: "Pear", Price: datastore.MustParseMoney("1.10")}
+	if err := Items.AddProduct(ctx, pear); err != nil {
+		t.Fatal(err)
+	}
+	// Half of the writes are in the snapshot, and the rest only in the log.
+	if err := Items.compact(); err != nil {
+		t.Fatal(err)
+	}
+	pear.Price = datastore.MustParseMoney("0.90")
+	if _, err := Items.UpdateProduct(ctx, pear); err != nil {
+		t.Fatal(err)
+	}
+	if err := Items.DeleteProduct(ctx, Product{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Items.AddUser(ctx, User{Name: "ci", Kind: datastore.UserKindUser, Roles: []string{"reader"}}); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := Items.PriceHistory(ctx, pear.Id)
+
+	// A crash in the middle of an append leaves part of a line.
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq": 99, "op": "AddPro`)
+	f.Close()
+
+	// The seed file is ignored once there's a snapshot.
+	cfg.Seed.Skip = true
+	if err := Initialize(cfg); err != nil {
+		t.Fatal(err)
+	}
+	got := Product{Id: pear.Id}
+	if err := Items.GetProduct(ctx, &got); err != nil || got.Price != pear.Price {
+		t.Fatalf("Got %v, %v; want %v", got, err, pear)
+	}
+	if err := Items.GetProduct(ctx, &Product{Id: "1"}); err == nil {
+		t.Fatal("The deleted product was restored")
+	}
+	if err := Items.GetUser(ctx, &User{Name: "ci"}); err != nil {
+		t.Fatal(err)
+	}
+	// Replayed writes keep the times they were first made.
+	if replayed, _ := Items.PriceHistory(ctx, pear.Id); len(replayed) != 2 || !replayed[1].ChangedAt.Equal(history[1].ChangedAt) {
+		t.Fatalf("Got price history %v, want %v", replayed, history)
+	}
+	// New IDs carry on from the recovered ones, and new writes are logged after the cut-off line.
+	if next, err := Items.NextID(ctx); err != nil || next != "6" {
+		t.Fatalf("Got next ID %v, %v; want 6", next, err)
+	}
+	if err := Initialize(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if next, err := Items.NextID(ctx); err != nil || next != "7" {
+		t.Fatalf("After another restart, got next ID %v, %v; want 7", next, err)
+	}
+}
+
+func TestWALWithoutSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, walFile), []byte(`{"seq":1,"op":"NextID"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Initialize(walConfig(dir)); err == nil {
+		Items.closeWAL()
+		t.Fatal("A log without a snapshot was replayed onto the seed data")
+	}
+}
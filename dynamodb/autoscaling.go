@@ -0,0 +1,95 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aas "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	aastypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// scalingTarget - one capacity dimension of the table or an index, and the utilization metric that drives it.
+type scalingTarget struct {
+	resourceID string
+	dimension  aastypes.ScalableDimension
+	metric     aastypes.MetricType
+}
+
+// scalingTargets - the read and write capacity of a Products table and of its NameIndex.
+func scalingTargets(tableName string) []scalingTarget {
+	table := "table/" + tableName
+	index := table + "/index/" + NameIndex
+	return []scalingTarget{
+		{table, aastypes.ScalableDimensionDynamoDBTableReadCapacityUnits, aastypes.MetricTypeDynamoDBReadCapacityUtilization},
+		{table, aastypes.ScalableDimensionDynamoDBTableWriteCapacityUnits, aastypes.MetricTypeDynamoDBWriteCapacityUtilization},
+		{index, aastypes.ScalableDimensionDynamoDBIndexReadCapacityUnits, aastypes.MetricTypeDynamoDBReadCapacityUtilization},
+		{index, aastypes.ScalableDimensionDynamoDBIndexWriteCapacityUnits, aastypes.MetricTypeDynamoDBWriteCapacityUtilization},
+	}
+}
+
+// enableAutoScaling - local helper function that registers the table's capacity with Application Auto Scaling and
+// attaches a target tracking policy to each dimension. Both calls are idempotent, so this runs on every start
+// and picks up config changes. On-demand tables scale by themselves and are skipped.
+func enableAutoScaling(awsCfg aws.Config, cfg config.DynamoDB, table string) error {
+	scaling := cfg.AutoScaling
+	if !scaling.Enabled || types.BillingMode(cfg.BillingMode) == types.BillingModePayPerRequest {
+		return nil
+	}
+	if scaling.MinCapacity < 1 || scaling.MaxCapacity < scaling.MinCapacity {
+		return fmt.Errorf("Invalid auto scaling capacity range %v-%v", scaling.MinCapacity, scaling.MaxCapacity)
+	}
+	if scaling.TargetUtilization < 20 || scaling.TargetUtilization > 90 {
+		return fmt.Errorf("Auto scaling target utilization must be between 20 and 90 percent, got %v", scaling.TargetUtilization)
+	}
+
+	if cfg.Target == config.DynamoDBLocal {
+		return fmt.Errorf("Auto scaling isn't available on DynamoDB Local")
+	}
+
+	svc := aas.NewFromConfig(awsCfg, func(o *aas.Options) {
+		// LocalStack serves every service from the one endpoint.
+		if cfg.Target == config.DynamoDBLocalStack {
+			o.BaseEndpoint = aws.String(cfg.ResolvedEndpoint())
+		}
+	})
+
+	for _, t := range scalingTargets(table) {
+		_, err := svc.RegisterScalableTarget(context.Background(), &aas.RegisterScalableTargetInput{
+			ServiceNamespace:  aastypes.ServiceNamespaceDynamodb,
+			ResourceId:        aws.String(t.resourceID),
+			ScalableDimension: t.dimension,
+			MinCapacity:       aws.Int32(int32(scaling.MinCapacity)),
+			MaxCapacity:       aws.Int32(int32(scaling.MaxCapacity)),
+		})
+		if err != nil {
+			return fmt.Errorf("Registering scalable target %v (%v) failed: %v", t.resourceID, t.dimension, err)
+		}
+
+		_, err = svc.PutScalingPolicy(context.Background(), &aas.PutScalingPolicyInput{
+			PolicyName:        aws.String(fmt.Sprintf("%v-%v", t.resourceID, t.metric)),
+			PolicyType:        aastypes.PolicyTypeTargetTrackingScaling,
+			ServiceNamespace:  aastypes.ServiceNamespaceDynamodb,
+			ResourceId:        aws.String(t.resourceID),
+			ScalableDimension: t.dimension,
+			TargetTrackingScalingPolicyConfiguration: &aastypes.TargetTrackingScalingPolicyConfiguration{
+				TargetValue: aws.Float64(scaling.TargetUtilization),
+				PredefinedMetricSpecification: &aastypes.PredefinedMetricSpecification{
+					PredefinedMetricType: t.metric,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Creating scaling policy for %v (%v) failed: %v", t.resourceID, t.dimension, err)
+		}
+	}
+
+	fmt.Printf("Auto scaling enabled for '%v': %v-%v capacity units at %v%% utilization\n", table, scaling.MinCapacity, scaling.MaxCapacity, scaling.TargetUtilization)
+	return nil
+}
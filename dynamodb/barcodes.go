@@ -0,0 +1,84 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+/*
+BarcodeIndex - the global secondary index used for barcode lookups, keyed by the barcode attribute. It's sparse:
+Products without a barcode aren't in it. Barcodes are kept unique by barcodeClaims.
+*/
+const BarcodeIndex = "BarcodeIndex"
+
+// BarcodeAttribute - the Product attribute holding its barcode, and the key of the Barcodes table.
+const BarcodeAttribute = "barcode"
+
+// BarcodesTableName - name for the table recording which Product holds each barcode, e.g. "acme.Barcodes".
+const BarcodesTableName = "Barcodes"
+
+// barcodeIndex - local helper function that describes BarcodeIndex, with throughput matching the table's billing mode.
+func barcodeIndex(cfg config.DynamoDB) types.GlobalSecondaryIndex {
+	index := types.GlobalSecondaryIndex{
+		IndexName: aws.String(BarcodeIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(BarcodeAttribute), KeyType: types.KeyTypeHash},
+		},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+	if types.BillingMode(cfg.BillingMode) != types.BillingModePayPerRequest {
+		index.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits: aws.Int64(cfg.ReadCapacity), WriteCapacityUnits: aws.Int64(cfg.WriteCapacity),
+		}
+	}
+	return index
+}
+
+// barcodeAttributeDefinitions - the attribute definitions BarcodeIndex's key needs.
+func barcodeAttributeDefinitions() []types.AttributeDefinition {
+	return []types.AttributeDefinition{
+		{AttributeName: aws.String(BarcodeAttribute), AttributeType: types.ScalarAttributeTypeS},
+	}
+}
+
+// FindByBarcode - the live Product with the barcode, from BarcodeIndex.
+func (db Products) FindByBarcode(ctx context.Context, code string) (Product, error) {
+	expr, names := projection(ctx)
+	attrNames := map[string]string{"#bc": BarcodeAttribute}
+	for k, v := range names {
+		attrNames[k] = v
+	}
+	result, err := readerFor(ctx).Query(ctx, &dynamodb.QueryInput{
+		TableName:                aws.String(tableName(ctx)),
+		IndexName:                aws.String(BarcodeIndex),
+		KeyConditionExpression:   aws.String("#bc = :bc"),
+		ProjectionExpression:     expr,
+		ExpressionAttributeNames: attrNames,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":bc": &types.AttributeValueMemberS{Value: code},
+		},
+	})
+	if err != nil {
+		return Product{}, fmt.Errorf("Query %v failed:\n%w", BarcodeIndex, unavailable(err))
+	}
+	for _, i := range result.Items {
+		p, err := unmarshalProduct(i)
+		if err != nil {
+			return Product{}, fmt.Errorf("Unmarshalling %v results failed:\n%v", BarcodeIndex, err)
+		}
+		if !p.Expired() {
+			return p, nil
+		}
+	}
+	return Product{}, datastore.Errorf("product_not_found", "No product has barcode %v: %w", code, datastore.ErrNotFound)
+}
@@ -0,0 +1,227 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// batchGetLimit - the maximum number of keys DynamoDB accepts in a single BatchGetItem call.
+const batchGetLimit = 100
+
+// batchGetParallelism - the maximum number of BatchGetItem calls in flight for one GetProducts call.
+const batchGetParallelism = 4
+
+// batchRetries - how many times unprocessed keys/items are retried before a batch operation gives up.
+const batchRetries = 5
+
+// batchGetMetrics - fan-out statistics for GetProducts, published at /debug/vars.
+// "chunks" / "requests" is the average fan-out depth; "max_fanout" is the deepest seen so far.
+var batchGetMetrics = expvar.NewMap("dynamodb_batch_get")
+
+var maxFanout struct {
+	sync.Mutex
+	value int64
+}
+
+// recordFanout - updates the fan-out metrics for a GetProducts call split into n chunks.
+func recordFanout(n int) {
+	batchGetMetrics.Add("requests", 1)
+	batchGetMetrics.Add("chunks", int64(n))
+
+	maxFanout.Lock()
+	defer maxFanout.Unlock()
+	if int64(n) > maxFanout.value {
+		maxFanout.value = int64(n)
+		v := new(expvar.Int)
+		v.Set(maxFanout.value)
+		batchGetMetrics.Set("max_fanout", v)
+	}
+}
+
+// GetProducts - retrieves several Products at once, returned in the order requested, along with the IDs that don't exist.
+// Keys are split into BatchGetItem-sized chunks which are fetched concurrently (at most batchGetParallelism at a time);
+// the first chunk to fail cancels the rest.
+func (db Products) GetProducts(ctx context.Context, ids []string) ([]Product, []string, error) {
+	// BatchGetItem rejects duplicate keys, so only ask for each ID once.
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	chunks := [][]string{}
+	for len(unique) > 0 {
+		n := batchGetLimit
+		if len(unique) < n {
+			n = len(unique)
+		}
+		chunks = append(chunks, unique[:n])
+		unique = unique[n:]
+	}
+	recordFanout(len(chunks))
+
+	// Fetch the chunks in parallel, at most batchGetParallelism at a time.
+	found := map[string]Product{}
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(batchGetParallelism)
+	for _, chunk := range chunks {
+		g.Go(func() error {
+			products, err := batchGet(gctx, chunk)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range products {
+				found[p.Id] = p
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	// BatchGetItem returns items in no particular order, so rebuild the requested order.
+	products := []Product{}
+	missing := []string{}
+	for _, id := range ids {
+		if p, ok := found[id]; ok {
+			products = append(products, p)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return products, missing, nil
+}
+
+// batchGet - local helper function that fetches one chunk of keys, retrying unprocessed keys with exponential backoff.
+func batchGet(ctx context.Context, ids []string) ([]Product, error) {
+	table := tableName(ctx)
+	keys := make([]map[string]types.AttributeValue, len(ids))
+	for i, id := range ids {
+		keys[i] = map[string]types.AttributeValue{IdAttribute: keyValue(id)}
+	}
+	expr, names := projection(ctx)
+	request := map[string]types.KeysAndAttributes{
+		table: {Keys: keys, ConsistentRead: consistentRead(ctx), ProjectionExpression: expr, ExpressionAttributeNames: names},
+	}
+
+	products := []Product{}
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt > batchRetries {
+			return nil, fmt.Errorf("BatchGetItem gave up after %v retries with unprocessed keys", batchRetries)
+		}
+		if attempt > 0 {
+			batchGetMetrics.Add("retries", 1)
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := readerFor(ctx).BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, fmt.Errorf("BatchGetItem failed:\n%w", unavailable(err))
+		}
+
+		for _, i := range result.Responses[table] {
+			p, err := unmarshalProduct(i)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling GetProducts failed:\n%v", err)
+			}
+			if !p.Expired() {
+				products = append(products, p)
+			}
+		}
+
+		request = result.UnprocessedKeys
+	}
+
+	return products, nil
+}
+
+// batchWriteLimit - the maximum number of items DynamoDB accepts in a single BatchWriteItem call.
+const batchWriteLimit = 25
+
+// backoff - the delay before retry number attempt (1, 2, ...) of unprocessed batch work.
+func backoff(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt-1)) * 50 * time.Millisecond
+}
+
+// sleep - waits for d, returning early with ctx's error if it is canceled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// putProducts - writes several Products to a table using BatchWriteItem, 25 items per call, retrying any unprocessed items.
+// It is not atomic and replaces existing Products with the same IDs, so it is only used for seeding; see AddProducts.
+func putProducts(ctx context.Context, table string, products []Product) error {
+	for start := 0; start < len(products); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(products) {
+			end = len(products)
+		}
+
+		writes := make([]types.WriteRequest, 0, end-start)
+		for _, p := range products[start:end] {
+			item, err := marshalProduct(p)
+			if err != nil {
+				return fmt.Errorf("putProducts -> Error marshalling product: %v", err)
+			}
+			writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+
+		if err := batchWrite(ctx, map[string][]types.WriteRequest{table: writes}); err != nil {
+			return fmt.Errorf("putProducts -> Products %v-%v could not be added: %w", start, end-1, unavailable(err))
+		}
+	}
+
+	return nil
+}
+
+// batchWrite - local helper function that sends one BatchWriteItem request, retrying unprocessed items with exponential
+// backoff until ctx is canceled.
+func batchWrite(ctx context.Context, request map[string][]types.WriteRequest) error {
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt > batchRetries {
+			return fmt.Errorf("BatchWriteItem gave up after %v retries with unprocessed items", batchRetries)
+		}
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		result, err := Items.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: request})
+		if err != nil {
+			return fmt.Errorf("BatchWriteItem failed:\n%w", unavailable(err))
+		}
+
+		request = result.UnprocessedItems
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/datastore/storetest"
+)
+
+// BenchmarkDatastore - needs DynamoDB Local, as the tests do (see dynamodb_test.go).
+func BenchmarkDatastore(b *testing.B) {
+	storetest.Benchmarks(b, backend(b))
+}
@@ -0,0 +1,106 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Cart = datastore.Cart
+
+// CartsTableName - name for the table holding shopping carts; each tenant has its own, e.g. "acme.Carts".
+const CartsTableName = "Carts"
+
+// cartIdAttribute - the key of the carts table.
+const cartIdAttribute = "cart_id"
+
+// cartsTable - the carts table belonging to a Products table.
+func cartsTable(table string) string {
+	return siblingTable(table, CartsTableName)
+}
+
+// createCartsTable - local helper function that creates a carts table, if it doesn't exist, with TTL on expires_at
+// so that abandoned carts are deleted.
+func createCartsTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	if err := createChildTable(ctx, cfg, table, cartIdAttribute, "", ""); err != nil {
+		return err
+	}
+	return enableTTL(table)
+}
+
+// cartKey - the key of a cart item.
+func cartKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{cartIdAttribute: &types.AttributeValueMemberS{Value: id}}
+}
+
+// GetCart - if it exists and hasn't expired, retrieves the requested cart. TTL deletes lag expiry, so both are checked.
+func (db Products) GetCart(ctx context.Context, cart *Cart) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(cartsTable(tableName(ctx))),
+		Key:       cartKey(cart.Id),
+	})
+	if err != nil {
+		return fmt.Errorf("GetCart failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return datastore.Errorf("cart_not_found", "Cart <%v> does not exist: %w", cart.Id, datastore.ErrNotFound)
+	}
+	var stored Cart
+	if err := attributevalue.UnmarshalMap(result.Item, &stored); err != nil {
+		return fmt.Errorf("Unmarshalling GetCart failed:\n%v", err)
+	}
+	if stored.Expired() {
+		return datastore.Errorf("cart_not_found", "Cart <%v> does not exist: %w", cart.Id, datastore.ErrNotFound)
+	}
+	*cart = stored
+	return nil
+}
+
+// PutCart - saves the cart.
+func (db *Products) PutCart(ctx context.Context, cart Cart) error {
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return fmt.Errorf("Error marshalling cart: %v", err)
+	}
+	if _, err := Items.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(cartsTable(tableName(ctx))),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("Cart <%v> could not be saved: %w", cart.Id, unavailable(err))
+	}
+	return nil
+}
+
+// DeleteCart - deletes the cart, on condition that it still exists and hasn't expired.
+func (db *Products) DeleteCart(ctx context.Context, id string) error {
+	_, err := Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(cartsTable(tableName(ctx))),
+		Key:                      cartKey(id),
+		ConditionExpression:      aws.String("attribute_exists(#c) AND #e > :now"),
+		ExpressionAttributeNames: map[string]string{"#c": cartIdAttribute, "#e": ExpiresAtAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.Errorf("cart_not_found", "Cart <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Cart <%v> could not be deleted: %w", id, unavailable(err))
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ChangesTableName - name for the table holding the change log. Like the Products table, each tenant has its own, e.g.
+// "acme.Changes".
+const ChangesTableName = "Changes"
+
+// OutboxTableName - name for the table holding each tenant's changes that haven't been published as events yet. Its
+// items are change log items, keyed by position alone.
+const OutboxTableName = "Outbox"
+
+/*
+Change log attributes. Items are partitioned by the UTC day of the change, so reading the log from a point in time
+is a Query per day since, and sorted by the change's datastore.Change.Position within it. TTL deletes them once
+they're datastore.ChangeRetention old.
+*/
+const (
+	changeDayAttribute      = "day"
+	changePositionAttribute = "position"
+	changeIdAttribute       = "product_id"
+	changeKindAttribute     = "change"
+	changeTimeAttribute     = "changed_at"
+)
+
+// changeDay - the partition key of the changes made on the given day.
+func changeDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// changesTable - the change log table belonging to a Products table.
+func changesTable(table string) string {
+	return siblingTable(table, ChangesTableName)
+}
+
+// outboxTable - the outbox table belonging to a Products table.
+func outboxTable(table string) string {
+	return siblingTable(table, OutboxTableName)
+}
+
+// changeItem - the change log (and outbox) item for a change.
+func changeItem(c datastore.Change) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		changeDayAttribute:      &types.AttributeValueMemberS{Value: changeDay(c.At)},
+		changePositionAttribute: &types.AttributeValueMemberS{Value: c.Position()},
+		changeIdAttribute:       &types.AttributeValueMemberS{Value: c.ProductId},
+		changeKindAttribute:     &types.AttributeValueMemberS{Value: c.Kind},
+		changeTimeAttribute:     &types.AttributeValueMemberN{Value: strconv.FormatInt(c.At.UnixNano(), 10)},
+		ExpiresAtAttribute:      &types.AttributeValueMemberN{Value: strconv.FormatInt(c.At.Add(datastore.ChangeRetention).Unix(), 10)},
+	}
+}
+
+// changePuts - the transaction items logging a change to a Product and putting it in the outbox, to go with the
+// write that made it.
+func changePuts(ctx context.Context, id, kind string) []types.TransactWriteItem {
+	item := changeItem(datastore.Change{ProductId: id, Kind: kind, At: time.Now().UTC()})
+	return []types.TransactWriteItem{
+		{Put: &types.Put{TableName: aws.String(changesTable(tableName(ctx))), Item: item}},
+		{Put: &types.Put{TableName: aws.String(outboxTable(tableName(ctx))), Item: item}},
+	}
+}
+
+/*
+recordChanges - logs changes to Products, and puts them in the outbox, after a bulk add, whose transaction has no room
+for them. The Products have been written by then, so a failure is logged rather than returned.
+*/
+func recordChanges(ctx context.Context, kind string, ids ...string) {
+	table := tableName(ctx)
+	at := time.Now().UTC()
+	// Each change is two items, one in each table.
+	for start := 0; start < len(ids); start += batchWriteLimit / 2 {
+		end := start + batchWriteLimit/2
+		if end > len(ids) {
+			end = len(ids)
+		}
+		writes := make([]types.WriteRequest, 0, end-start)
+		for _, id := range ids[start:end] {
+			writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: changeItem(datastore.Change{ProductId: id, Kind: kind, At: at})}})
+		}
+		if err := batchWrite(ctx, map[string][]types.WriteRequest{changesTable(table): writes, outboxTable(table): writes}); err != nil {
+			log.Printf("Changes to products %v could not be logged: %v", ids[start:end], err)
+		}
+	}
+}
+
+// GetChanges - up to limit changes after the given one, reading a day of the log at a time.
+func (db Products) GetChanges(ctx context.Context, after datastore.Change, limit int) ([]datastore.Change, error) {
+	now := time.Now().UTC()
+	from := after.At.UTC()
+	if oldest := now.Add(-datastore.ChangeRetention); from.Before(oldest) {
+		from = oldest
+	}
+
+	changes := []datastore.Change{}
+	for day := from.Truncate(24 * time.Hour); !day.After(now) && len(changes) < limit; day = day.Add(24 * time.Hour) {
+		pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+			TableName:                aws.String(changesTable(tableName(ctx))),
+			KeyConditionExpression:   aws.String("#d = :d AND #p > :p"),
+			ExpressionAttributeNames: map[string]string{"#d": changeDayAttribute, "#p": changePositionAttribute},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":d": &types.AttributeValueMemberS{Value: changeDay(day)},
+				":p": &types.AttributeValueMemberS{Value: after.Position()},
+			},
+			Limit: aws.Int32(int32(limit)),
+		})
+		for pages.HasMorePages() && len(changes) < limit {
+			page, err := pages.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("Query Changes failed:\n%w", unavailable(err))
+			}
+			for _, item := range page.Items {
+				if len(changes) == limit {
+					break
+				}
+				c, err := unmarshalChange(item)
+				if err != nil {
+					return nil, fmt.Errorf("Unmarshalling Changes failed:\n%v", err)
+				}
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes, nil
+}
+
+/*
+Outbox - up to limit of the oldest changes in the outbox. Its items aren't kept in order, so it's scanned whole; it
+only holds what hasn't been published yet. The scan is consistent, and never served by DAX, so that changes just
+published aren't read again.
+*/
+func (db Products) Outbox(ctx context.Context, limit int) ([]datastore.Change, error) {
+	changes := []datastore.Change{}
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{
+		TableName:      aws.String(outboxTable(tableName(ctx))),
+		ConsistentRead: aws.Bool(true),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Scan Outbox failed:\n%w", unavailable(err))
+		}
+		for _, item := range page.Items {
+			c, err := unmarshalChange(item)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling Outbox failed:\n%v", err)
+			}
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Position() < changes[j].Position() })
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+// DeleteOutbox - removes the changes from the outbox.
+func (db Products) DeleteOutbox(ctx context.Context, changes []datastore.Change) error {
+	table := outboxTable(tableName(ctx))
+	for start := 0; start < len(changes); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(changes) {
+			end = len(changes)
+		}
+		deletes := make([]types.WriteRequest, 0, end-start)
+		for _, c := range changes[start:end] {
+			deletes = append(deletes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+				changePositionAttribute: &types.AttributeValueMemberS{Value: c.Position()},
+			}}})
+		}
+		if err := batchWrite(ctx, map[string][]types.WriteRequest{table: deletes}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalChange - the change a change log item records.
+func unmarshalChange(item map[string]types.AttributeValue) (datastore.Change, error) {
+	id, _ := item[changeIdAttribute].(*types.AttributeValueMemberS)
+	kind, _ := item[changeKindAttribute].(*types.AttributeValueMemberS)
+	at, _ := item[changeTimeAttribute].(*types.AttributeValueMemberN)
+	if id == nil || kind == nil || at == nil {
+		return datastore.Change{}, fmt.Errorf("Change item is missing attributes: %v", item)
+	}
+	nanos, err := strconv.ParseInt(at.Value, 10, 64)
+	if err != nil {
+		return datastore.Change{}, err
+	}
+	return datastore.Change{ProductId: id.Value, Kind: kind.Value, At: time.Unix(0, nanos).UTC()}, nil
+}
+
+// createChangesTable - local helper function that creates a change log table, if it doesn't exist, with TTL on
+// expires_at so that changes are deleted once they're too old to sync from.
+func createChangesTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	if err := createChildTable(ctx, cfg, table, changeDayAttribute, changePositionAttribute, types.ScalarAttributeTypeS); err != nil {
+		return err
+	}
+	return enableTTL(table)
+}
+
+// createOutboxTable - local helper function that creates an outbox table, if it doesn't exist, with TTL on
+// expires_at so that changes that are never published don't stay there for ever.
+func createOutboxTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	if err := createChildTable(ctx, cfg, table, changePositionAttribute, "", ""); err != nil {
+		return err
+	}
+	return enableTTL(table)
+}
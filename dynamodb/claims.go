@@ -0,0 +1,453 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+/*
+uniqueAttr - a Product attribute whose values no two live Products in a catalog may share.
+
+A GSI can't enforce uniqueness, so each value in use also has an item in a claims table belonging to the Products
+table, keyed by the value and naming the Product that holds it. Claiming a value is a conditional put on that item,
+in the same transaction as the Product write. A claim left behind by a Product that no longer has the value (e.g.
+one deleted by TTL) is reclaimed when another Product asks for the value.
+*/
+type uniqueAttr struct {
+	// label - what the value is called in errors, e.g. "Barcode".
+	label string
+	// table - the claims table's name, after any tenant prefix.
+	table string
+	// attribute - the Product attribute holding the value, which is also the claims table's key.
+	attribute string
+	// value - the value a Product claims; "" if it claims none.
+	value func(p Product) string
+}
+
+// claimOwnerAttribute - the ID of the Product holding a value (always a string, whatever the ID strategy).
+const claimOwnerAttribute = "product_id"
+
+var (
+	// barcodeClaims - every barcode belongs to at most one Product.
+	barcodeClaims = uniqueAttr{
+		label:     "Barcode",
+		table:     BarcodesTableName,
+		attribute: BarcodeAttribute,
+		value:     func(p Product) string { return p.Barcode },
+	}
+	// nameClaims - with unique names configured, every name (ignoring case) belongs to at most one Product.
+	nameClaims = uniqueAttr{
+		label:     "Name",
+		table:     NamesTableName,
+		attribute: nameLowerAttribute,
+		value: func(p Product) string {
+			_, lower := nameKeys(p.Name)
+			return lower
+		},
+	}
+)
+
+// uniqueAttrs - the attributes whose uniqueness is enforced: barcodes always, and names if configured.
+var uniqueAttrs = []uniqueAttr{barcodeClaims}
+
+// claimsTable - the attribute's claims table belonging to a Products table.
+func (u uniqueAttr) claimsTable(table string) string {
+	return siblingTable(table, u.table)
+}
+
+// createTable - local helper function that creates the attribute's claims table, if it doesn't exist.
+func (u uniqueAttr) createTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, u.claimsTable(table), u.attribute, "", "")
+}
+
+// key - the key of a claims table item.
+func (u uniqueAttr) key(value string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{u.attribute: &types.AttributeValueMemberS{Value: value}}
+}
+
+// item - the claims table item recording that a Product holds a value.
+func (u uniqueAttr) item(value, productID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		u.attribute:         &types.AttributeValueMemberS{Value: value},
+		claimOwnerAttribute: &types.AttributeValueMemberS{Value: productID},
+	}
+}
+
+// claim - the transaction item claiming a value for a Product, on condition that no other Product holds it.
+func (u uniqueAttr) claim(ctx context.Context, value, productID string) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:                aws.String(u.claimsTable(tableName(ctx))),
+		Item:                     u.item(value, productID),
+		ConditionExpression:      aws.String("attribute_not_exists(#v) OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]string{"#v": u.attribute, "#owner": claimOwnerAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: productID},
+		},
+	}}
+}
+
+// release - the transaction item giving up a Product's value. It's a no-op if the Product doesn't hold it.
+func (u uniqueAttr) release(ctx context.Context, value, productID string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                aws.String(u.claimsTable(tableName(ctx))),
+		Key:                      u.key(value),
+		ConditionExpression:      aws.String("attribute_not_exists(#v) OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]string{"#v": u.attribute, "#owner": claimOwnerAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: productID},
+		},
+	}}
+}
+
+// inUse - the error for a value held by another live Product. It wraps datastore.ErrConflict, and lets callers tell
+// it apart from their own write's condition failing.
+type inUse struct {
+	label, value, holder string
+}
+
+func (e inUse) Error() string {
+	if e.holder == "" {
+		return fmt.Sprintf("%v %q is already in use", e.label, e.value)
+	}
+	return fmt.Sprintf("%v %q is already in use by product <%v>", e.label, e.value, e.holder)
+}
+
+func (e inUse) Unwrap() error {
+	return datastore.ErrConflict
+}
+
+// ErrorCode - e.g. "barcode_in_use", matching the in-memory backend.
+func (e inUse) ErrorCode() string {
+	return strings.ToLower(e.label) + "_in_use"
+}
+
+/*
+holder - who has claimed a value that productID wants. If another live Product holds it, the error is an inUse; if
+the claim is stale, stale is the ID of the Product that left it. Both are zero if the value is free or productID's.
+*/
+func (u uniqueAttr) holder(ctx context.Context, value, productID string) (stale string, err error) {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(u.claimsTable(tableName(ctx))),
+		Key:            u.key(value),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("GetItem %v failed:\n%w", u.table, unavailable(err))
+	}
+	owner, ok := result.Item[claimOwnerAttribute].(*types.AttributeValueMemberS)
+	if !ok || owner.Value == productID {
+		return "", nil
+	}
+
+	holder := Product{Id: owner.Value}
+	err = Items.GetProduct(datastore.WithFields(ctx, nil), &holder)
+	switch {
+	case err == nil && u.value(holder) == value:
+		return "", inUse{label: u.label, value: value, holder: holder.Id}
+	case err != nil && !errors.Is(err, datastore.ErrNotFound):
+		return "", err
+	}
+	return owner.Value, nil
+}
+
+/*
+conflict - explains a failed transaction that claimed a value for productID. If another live Product holds the
+value, the error is an inUse. If the claim is stale, it's removed and retry is true. Both are zero when the value
+wasn't the problem.
+*/
+func (u uniqueAttr) conflict(ctx context.Context, value, productID string) (retry bool, err error) {
+	stale, err := u.holder(ctx, value, productID)
+	if err != nil || stale == "" {
+		return false, err
+	}
+
+	// The holder is gone or has another value now; remove its claim, unless it has just been renewed.
+	err = transactWrite(ctx, []types.TransactWriteItem{u.release(ctx, value, stale)})
+	if err != nil && !errors.Is(err, datastore.ErrConflict) {
+		return false, err
+	}
+	return true, nil
+}
+
+// claims - the transaction items claiming a Product's unique values.
+func claims(ctx context.Context, p Product) []types.TransactWriteItem {
+	var writes []types.TransactWriteItem
+	for _, u := range uniqueAttrs {
+		if value := u.value(p); value != "" {
+			writes = append(writes, u.claim(ctx, value, p.Id))
+		}
+	}
+	return writes
+}
+
+// duplicates - an inUse error if two of the Products claim the same value, which one transaction can't do.
+func duplicates(products []Product) error {
+	for _, u := range uniqueAttrs {
+		holders := map[string]string{}
+		for _, p := range products {
+			value := u.value(p)
+			if value == "" {
+				continue
+			}
+			if holder, ok := holders[value]; ok {
+				return inUse{label: u.label, value: value, holder: holder}
+			}
+			holders[value] = p.Id
+		}
+	}
+	return nil
+}
+
+/*
+CheckUnique - reports the conflict adding or updating the Products would run into over a barcode, or a name when
+names are unique, without writing anything. A stale claim isn't a conflict; the write would reclaim it.
+*/
+func (db Products) CheckUnique(ctx context.Context, products []Product) error {
+	if err := duplicates(products); err != nil {
+		return err
+	}
+	for _, u := range uniqueAttrs {
+		for _, p := range products {
+			if value := u.value(p); value != "" {
+				if _, err := u.holder(ctx, value, p.Id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+withClaims - runs a transaction containing claims for the given Products' unique values. If it fails because a
+claim is stale, the claim is removed and the transaction tried once more; if another Product holds a value, the
+error says which.
+*/
+func withClaims(ctx context.Context, products []Product, writes []types.TransactWriteItem) error {
+	for attempt := 0; ; attempt++ {
+		err := transactWrite(ctx, writes)
+		if !errors.Is(err, datastore.ErrConflict) || attempt > 0 {
+			return err
+		}
+		retry := false
+		for _, u := range uniqueAttrs {
+			for _, p := range products {
+				value := u.value(p)
+				if value == "" {
+					continue
+				}
+				stale, conflict := u.conflict(ctx, value, p.Id)
+				if conflict != nil {
+					return conflict
+				}
+				retry = retry || stale
+			}
+		}
+		if !retry {
+			return err
+		}
+	}
+}
+
+/*
+currentValues - a live Product's unique values as stored, by attribute; missing if it has none. A Product that
+doesn't exist, or has expired, is a datastore.ErrNotFound.
+*/
+func currentValues(ctx context.Context, id string) (map[string]string, error) {
+	projection := []string{"#id", "#exp"}
+	attrNames := map[string]string{"#id": IdAttribute, "#exp": ExpiresAtAttribute}
+	for i, u := range uniqueAttrs {
+		projection = append(projection, fmt.Sprintf("#u%v", i))
+		attrNames[fmt.Sprintf("#u%v", i)] = u.attribute
+	}
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:                aws.String(tableName(ctx)),
+		Key:                      map[string]types.AttributeValue{IdAttribute: keyValue(id)},
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: attrNames,
+		ConsistentRead:           aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetItem failed:\n%w", unavailable(err))
+	}
+	if p, err := unmarshalProduct(result.Item); len(result.Item) == 0 || (err == nil && p.Expired()) {
+		return nil, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	values := map[string]string{}
+	for _, u := range uniqueAttrs {
+		if v, ok := result.Item[u.attribute].(*types.AttributeValueMemberS); ok {
+			values[u.attribute] = v.Value
+		}
+	}
+	return values, nil
+}
+
+/*
+claimMoves - the transaction items claiming newProduct's unique values that differ from what's stored, and giving
+up the stored ones. They go in the same transaction as the update, so a value is never on two Products, and a
+failed update doesn't leave its claims behind.
+*/
+func claimMoves(ctx context.Context, newProduct Product) ([]types.TransactWriteItem, error) {
+	old, err := currentValues(ctx, newProduct.Id)
+	if err != nil {
+		return nil, err
+	}
+	var writes []types.TransactWriteItem
+	for _, u := range uniqueAttrs {
+		value := u.value(newProduct)
+		if old[u.attribute] == value {
+			continue
+		}
+		if value != "" {
+			writes = append(writes, u.claim(ctx, value, newProduct.Id))
+		}
+		if old[u.attribute] != "" {
+			writes = append(writes, u.release(ctx, old[u.attribute], newProduct.Id))
+		}
+	}
+	return writes, nil
+}
+
+// releaseClaims - gives up the unique values in a deleted Product's attributes. A failure is logged: the stale claim
+// is reclaimed when another Product asks for the value.
+func releaseClaims(ctx context.Context, id string, attributes map[string]types.AttributeValue) {
+	for _, u := range uniqueAttrs {
+		v, ok := attributes[u.attribute].(*types.AttributeValueMemberS)
+		if !ok {
+			continue
+		}
+		if err := transactWrite(ctx, []types.TransactWriteItem{u.release(ctx, v.Value, id)}); err != nil {
+			log.Printf("%v %q of deleted product <%v> could not be released: %v", u.label, v.Value, id, err)
+		}
+	}
+}
+
+/*
+record - records the values of Products written without transactions, i.e. seeded ones, without checking that
+they're unique. A failure is logged: the Products exist, but their values aren't protected from reuse.
+*/
+func (u uniqueAttr) record(ctx context.Context, table string, products []Product) {
+	var writes []types.WriteRequest
+	for _, p := range products {
+		if value := u.value(p); value != "" {
+			writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: u.item(value, p.Id)}})
+		}
+	}
+	for start := 0; start < len(writes); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(writes) {
+			end = len(writes)
+		}
+		if err := batchWrite(ctx, map[string][]types.WriteRequest{u.claimsTable(table): writes[start:end]}); err != nil {
+			log.Printf("%v claims of seeded products could not be recorded: %v", u.label, err)
+		}
+	}
+}
+
+// recordClaims - records the unique values of seeded Products.
+func recordClaims(ctx context.Context, table string, products []Product) {
+	for _, u := range uniqueAttrs {
+		u.record(ctx, table, products)
+	}
+}
+
+// stored - local helper function that reads the ID and the attribute of every Product in a table that has it.
+func (u uniqueAttr) stored(ctx context.Context, table string) ([]Product, error) {
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{
+		TableName:                aws.String(table),
+		FilterExpression:         aws.String("attribute_exists(#v)"),
+		ProjectionExpression:     aws.String("#id, #v, #n, #exp"),
+		ExpressionAttributeNames: map[string]string{"#id": IdAttribute, "#v": u.attribute, "#n": "Name", "#exp": ExpiresAtAttribute},
+	})
+
+	var products []Product
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			p, err := unmarshalProduct(item)
+			if err != nil {
+				return nil, err
+			}
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// recordExisting - local helper function that records the values of the Products already in a table.
+func (u uniqueAttr) recordExisting(ctx context.Context, table string) error {
+	products, err := u.stored(ctx, table)
+	if err != nil {
+		return err
+	}
+	u.record(ctx, table, products)
+	fmt.Printf("Recorded %v %v claims\n", len(products), strings.ToLower(u.label))
+	return nil
+}
+
+/*
+claimExisting - local helper function that claims the values of the live Products in a table that don't hold a
+claim yet, e.g. when uniqueness has just been switched on. Values that more than one Product already has can't be
+claimed by all of them; they're logged, and stay shared until the Products are changed.
+*/
+func (u uniqueAttr) claimExisting(ctx context.Context, table string) error {
+	products, err := u.stored(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	owners := map[string]string{}
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{TableName: aws.String(u.claimsTable(table))})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			value, _ := item[u.attribute].(*types.AttributeValueMemberS)
+			owner, _ := item[claimOwnerAttribute].(*types.AttributeValueMemberS)
+			if value != nil && owner != nil {
+				owners[value.Value] = owner.Value
+			}
+		}
+	}
+
+	claimed, shared := 0, 0
+	for _, p := range products {
+		value := u.value(p)
+		if value == "" || p.Expired() || owners[value] == p.Id {
+			continue
+		}
+		err := withClaims(ctx, []Product{p}, []types.TransactWriteItem{u.claim(ctx, value, p.Id)})
+		var conflict inUse
+		switch {
+		case errors.As(err, &conflict):
+			log.Printf("%v; product <%v> has it too", conflict, p.Id)
+			shared++
+		case err != nil:
+			return err
+		default:
+			claimed++
+		}
+	}
+	if claimed > 0 || shared > 0 {
+		fmt.Printf("Claimed %v %v values; %v are shared with another product\n", claimed, strings.ToLower(u.label), shared)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+/*
+Count - the number of live Products matching filter, using Select=COUNT so that no items are returned. Items are
+still read (and charged for) to be counted; the saving is in what's sent back. Expired Products that TTL hasn't
+deleted yet are excluded with a filter, as every other read drops them. A filter expression that DynamoDB can't
+apply exactly (see filterBuilder) is counted by reading the matches instead.
+*/
+func (db Products) Count(ctx context.Context, filter datastore.Filter) (int, error) {
+	names := map[string]string{"#exp": ExpiresAtAttribute}
+	values := map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	live := aws.String("attribute_not_exists(#exp) OR #exp > :now")
+
+	// A search is scored on the names, so they have to be read, but nothing else is.
+	if filter.Query != "" {
+		products, err := db.GetAll(datastore.WithFields(ctx, []string{datastore.FieldName}))
+		if err != nil {
+			return 0, err
+		}
+		return len(datastore.RankByName(products, filter.Query)), nil
+	}
+
+	if filter.Expr != nil {
+		expr, exprNames, exprValues, exact := liveFilter(filter.Expr)
+		if !exact {
+			products, err := db.FilterProducts(datastore.IDsOnly(ctx), filter.Expr)
+			return len(products), err
+		}
+		live, names, values = aws.String(expr), exprNames, exprValues
+	}
+
+	if filter.Name == "" && filter.NamePrefix == "" {
+		pages := dynamodb.NewScanPaginator(readerFor(ctx), &dynamodb.ScanInput{
+			TableName:                 aws.String(tableName(ctx)),
+			Select:                    types.SelectCount,
+			FilterExpression:          live,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		count := 0
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("Count failed:\n%w", unavailable(err))
+			}
+			count += int(page.Count)
+		}
+		return count, nil
+	}
+
+	condition := "#b = :b AND #n = :n"
+	bucket, lower := nameKeys(filter.Name)
+	if filter.Name == "" {
+		condition = "#b = :b AND begins_with(#n, :n)"
+		bucket, lower = nameKeys(filter.NamePrefix)
+	}
+	if bucket == "" {
+		return 0, nil
+	}
+	names["#b"] = nameBucketAttribute
+	names["#n"] = nameLowerAttribute
+	values[":b"] = &types.AttributeValueMemberS{Value: bucket}
+	values[":n"] = &types.AttributeValueMemberS{Value: lower}
+
+	pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName(ctx)),
+		IndexName:                 aws.String(NameIndex),
+		KeyConditionExpression:    aws.String(condition),
+		Select:                    types.SelectCount,
+		FilterExpression:          live,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	count := 0
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("Count on %v failed:\n%w", NameIndex, unavailable(err))
+		}
+		count += int(page.Count)
+	}
+	return count, nil
+}
@@ -0,0 +1,62 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-dax-go-v2/dax"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// reader - the read operations the backend uses; both the DynamoDB and DAX clients provide them.
+type reader interface {
+	Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchGetItem(context.Context, *dynamodb.BatchGetItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// reads - the client used for item reads (GetAll, GetProduct, GetProducts and the NameIndex queries): a DAX cluster
+// when one is configured, a global table replica when reads are routed to another region, otherwise the DynamoDB
+// client itself. Writes, table management and the ID counter always go straight to DynamoDB. Reads use readerFor,
+// which picks between reads and the DynamoDB client.
+var reads reader
+
+// consistentReads - whether every item read is strongly consistent (config.DynamoDB.ConsistentReads).
+var consistentReads bool
+
+/*
+consistentRead - local helper function giving the ConsistentRead setting for the context's reads of a Products
+table: strongly consistent if the config or the request asks. DAX passes such reads through to DynamoDB rather than
+answering them from its cache. Queries of NameIndex, a global secondary index, can't be consistent, so they don't use it.
+*/
+func consistentRead(ctx context.Context) *bool {
+	return aws.Bool(consistentReads || datastore.ConsistentRead(ctx))
+}
+
+// readClient - local helper function that connects to the configured DAX cluster, or falls back to DynamoDB.
+func readClient(awsCfg aws.Config, cfg config.DynamoDB) (reader, error) {
+	if cfg.DAXEndpoint == "" {
+		return Items.Client, nil
+	}
+
+	daxCfg := dax.NewConfig(awsCfg, cfg.DAXEndpoint)
+	daxCfg.ReadRetries = cfg.MaxRetries
+	if cfg.RequestTimeout.Duration > 0 {
+		daxCfg.RequestTimeout = cfg.RequestTimeout.Duration
+	}
+
+	client, err := dax.New(daxCfg)
+	if err != nil {
+		return nil, fmt.Errorf("Connecting to DAX at %v failed: %v", cfg.DAXEndpoint, err)
+	}
+
+	fmt.Printf("Reading through DAX at %v\n", cfg.DAXEndpoint)
+	return client, nil
+}
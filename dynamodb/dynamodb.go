@@ -4,106 +4,449 @@ Author: Jason Payne
 package dynamodb
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-)
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 
-/*
-Product - Go object representation of items that will be managed by the app.
-*/
-type Product struct {
-	Id    int `json:"id"`
-	Name  string
-	Price float64
-}
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
 
-func (p Product) String() string {
-	return fmt.Sprintf("<(Id: %v) {%v} @ %v>", p.Id, p.Name, p.Price)
-}
+// Product - the shared Product model, stored as one item per Product.
+type Product = datastore.Product
 
 // Products - wrapper for the DynamoDB Go type that will allow local methods to be called from DynamoDB instances.
 type Products struct {
-	*dynamodb.DynamoDB
+	*dynamodb.Client
 }
 
 // Items - global DynamoDB instance.
 var Items Products
 
-// TableName - name for the table that will serve as the DynamoDB instance.
+// TableName - name for the table that will serve as the DynamoDB instance. Each tenant has its own table, named with
+// the tenant as a prefix; see tableName.
 const TableName = "Products"
 
+// tableName - the Products table for the context's tenant: TableName itself for the default tenant, otherwise e.g.
+// "acme.Products", with the environment's prefix and suffix.
+func tableName(ctx context.Context) string {
+	if tenant := datastore.Tenant(ctx); tenant != "" {
+		return envTable(tenant + "." + TableName)
+	}
+	return envTable(TableName)
+}
+
+// tablePrefix / tableSuffix - wrapped around every table's name (config.DynamoDB.TablePrefix / TableSuffix), so
+// that several environments can share an account.
+var tablePrefix, tableSuffix string
+
+// envTable - the name of a table in the configured environment, e.g. dev_Users.
+func envTable(name string) string {
+	return tablePrefix + name + tableSuffix
+}
+
+// connected - the settings the clients were made with, which Truncate creates tables with.
+var connected struct {
+	cfg config.Config
+	aws aws.Config
+}
+
+// tableAffix - the characters a table name prefix or suffix can use, the same as table names.
+var tableAffix = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// siblingTable - the table called name that belongs with a Products table, e.g. its Reviews.
+func siblingTable(table, name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(table, tableSuffix), TableName) + name + tableSuffix
+}
+
 // IdAttribute - attribute name for the partition key.
 const IdAttribute = "id"
 
+// ExpiresAtAttribute - the TTL attribute; DynamoDB deletes items some time (up to a few days) after it passes,
+// so expired items are also filtered out on read.
+const ExpiresAtAttribute = "expires_at"
+
+// SupplierAttribute - the Product attribute holding its supplier's ID.
+const SupplierAttribute = "supplier_id"
+
+// CategoryAttribute / TagsAttribute - the Product attributes holding its category's ID and its tags, a list.
+const (
+	CategoryAttribute = "category_id"
+	TagsAttribute     = "tags"
+)
+
+// UpdatedAtAttribute - the Product attribute holding when it last changed, in epoch seconds.
+const UpdatedAtAttribute = "updated_at"
+
+// DescriptionAttribute - the Product attribute holding its description.
+const DescriptionAttribute = "description"
+
+// StockAttribute - the Product attribute holding its stock levels, a map from location ID to quantity.
+const StockAttribute = "stock"
+
+// NameTranslationsAttribute / DescriptionTranslationsAttribute - the Product attributes holding the translations of
+// its name and description, each a map from locale to text.
+const (
+	NameTranslationsAttribute        = "name_translations"
+	DescriptionTranslationsAttribute = "description_translations"
+)
+
+// translationsValue - translations as a DynamoDB map.
+func translationsValue(t datastore.Translations) types.AttributeValue {
+	m := make(map[string]types.AttributeValue, len(t))
+	for locale, text := range t {
+		m[locale] = &types.AttributeValueMemberS{Value: text}
+	}
+	return &types.AttributeValueMemberM{Value: m}
+}
+
+// tagsValue - tags as a DynamoDB list.
+func tagsValue(tags []string) types.AttributeValue {
+	l := make([]types.AttributeValue, len(tags))
+	for i, tag := range tags {
+		l[i] = &types.AttributeValueMemberS{Value: tag}
+	}
+	return &types.AttributeValueMemberL{Value: l}
+}
+
+// CountersTableName - name for the table holding the atomic counters used to assign sequential IDs.
+const CountersTableName = "Counters"
+
+// counterKey - the Counters item tracking the last Product ID handed out in the context's tenant's table. It's named
+// after the table.
+func counterKey(ctx context.Context) string {
+	return tableName(ctx)
+}
+
+// keyType - the DynamoDB attribute type of the partition key for the active ID strategy.
+func keyType() types.ScalarAttributeType {
+	if datastore.Strategy == datastore.UUIDIDs {
+		return types.ScalarAttributeTypeS
+	}
+	return types.ScalarAttributeTypeN
+}
+
+// keyValue - the partition key attribute value for a Product ID.
+func keyValue(id string) types.AttributeValue {
+	if keyType() == types.ScalarAttributeTypeS {
+		return &types.AttributeValueMemberS{Value: id}
+	}
+	return &types.AttributeValueMemberN{Value: id}
+}
+
+// marshalProduct - converts a Product into a DynamoDB item with a correctly typed key.
+func marshalProduct(p Product) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return nil, err
+	}
+	item[IdAttribute] = keyValue(p.Id)
+	if bucket, lower := nameKeys(p.Name); bucket != "" {
+		item[nameBucketAttribute] = &types.AttributeValueMemberS{Value: bucket}
+		item[nameLowerAttribute] = &types.AttributeValueMemberS{Value: lower}
+	}
+	return item, nil
+}
+
+// unmarshalProduct - converts a DynamoDB item back into a Product, whichever type the key was stored as.
+func unmarshalProduct(item map[string]types.AttributeValue) (Product, error) {
+	var p Product
+	attrs := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		if k != IdAttribute {
+			attrs[k] = v
+		}
+	}
+	if err := attributevalue.UnmarshalMap(attrs, &p); err != nil {
+		return p, err
+	}
+	switch key := item[IdAttribute].(type) {
+	case *types.AttributeValueMemberN:
+		p.Id = key.Value
+	case *types.AttributeValueMemberS:
+		p.Id = key.Value
+	}
+	p.Rating = datastore.NewRating(intAttribute(item[ratingSumAttribute]), intAttribute(item[ratingCountAttribute]))
+	return p, nil
+}
+
+/*
+projection - the ProjectionExpression (and its attribute names) for the fields requested in the context, or nil
+if every attribute is needed. The key, Price and expires_at are always read, since results are sorted by price and
+expired Products dropped; what's saved is everything else, such as the name and its index keys.
+*/
+func projection(ctx context.Context) (*string, map[string]string) {
+	fields := datastore.Fields(ctx)
+	if fields == nil {
+		return nil, nil
+	}
+	// Name and Price are DynamoDB reserved words, so every attribute goes through a placeholder.
+	names := map[string]string{"#pid": IdAttribute, "#pprice": "Price", "#pexp": ExpiresAtAttribute}
+	expr := "#pid, #pprice, #pexp"
+	for _, f := range fields {
+		switch f {
+		case datastore.FieldName:
+			names["#pname"] = "Name"
+			names["#ntr"] = NameTranslationsAttribute
+			expr += ", #pname, #ntr"
+		case datastore.FieldRating:
+			names["#prs"] = ratingSumAttribute
+			names["#prc"] = ratingCountAttribute
+			expr += ", #prs, #prc"
+		case datastore.FieldBarcode:
+			names["#pbc"] = BarcodeAttribute
+			expr += ", #pbc"
+		case datastore.FieldSupplier:
+			names["#psup"] = SupplierAttribute
+			expr += ", #psup"
+		case datastore.FieldUpdatedAt:
+			names["#pupd"] = UpdatedAtAttribute
+			expr += ", #pupd"
+		case datastore.FieldDescription:
+			names["#pdesc"] = DescriptionAttribute
+			names["#dtr"] = DescriptionTranslationsAttribute
+			expr += ", #pdesc, #dtr"
+		case datastore.FieldStock:
+			names["#pstock"] = StockAttribute
+			expr += ", #pstock"
+		case datastore.FieldCategory:
+			names["#pcat"] = CategoryAttribute
+			expr += ", #pcat"
+		case datastore.FieldTags:
+			names["#ptags"] = TagsAttribute
+			expr += ", #ptags"
+		}
+	}
+	return aws.String(expr), names
+}
+
 // GetAll - responds with all of the Products in price-descending order.
-func (db Products) GetAll() ([]Product, error) {
+func (db Products) GetAll(ctx context.Context) ([]Product, error) {
 	// Price-descending sort
 	temp := []Product{}
 
-	result, err := Items.Scan(&dynamodb.ScanInput{TableName: aws.String(TableName)})
+	expr, names := projection(ctx)
+	err := parallelScan(ctx, "GetAll", &dynamodb.ScanInput{
+		TableName:                aws.String(tableName(ctx)),
+		ConsistentRead:           consistentRead(ctx),
+		ProjectionExpression:     expr,
+		ExpressionAttributeNames: names,
+	}, func(items []map[string]types.AttributeValue) error {
+		for _, i := range items {
+			p, err := unmarshalProduct(i)
+			if err != nil {
+				return fmt.Errorf("Unmarshalling GetAll failed:\n%v", err)
+			}
+			if !p.Expired() {
+				temp = append(temp, p)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Query GetAll failed:\n%v", err)
+		return nil, err
 	}
 
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &temp)
+	// Manually sort the results to get a Price-descending sort
+	datastore.SortProducts(temp, datastore.DefaultSort)
+
+	return temp, nil
+}
+
+/*
+GetPage - a single Scan of up to limit items, resuming from the LastEvaluatedKey encoded in cursor. Expired
+Products are dropped after the read, so a page can hold fewer than limit Products without being the last.
+*/
+func (db Products) GetPage(ctx context.Context, limit int, cursor string) (datastore.Page, error) {
+	expr, names := projection(ctx)
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(tableName(ctx)),
+		Limit:                    aws.Int32(int32(limit)),
+		ConsistentRead:           consistentRead(ctx),
+		ProjectionExpression:     expr,
+		ExpressionAttributeNames: names,
+	}
+	if cursor != "" {
+		id, err := datastore.DecodeCursor(cursor)
+		if err != nil {
+			return datastore.Page{}, err
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{IdAttribute: keyValue(id)}
+	}
+
+	result, err := readerFor(ctx).Scan(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("Unmarshalling GetAll failed:\n%v", err)
+		return datastore.Page{}, fmt.Errorf("Query GetPage failed:\n%w", unavailable(err))
 	}
 
-	// Manually sort the results to get a Price-descending sort
-	sort.Slice(temp, func(i, j int) bool { return temp[i].Price > temp[j].Price })
+	page := datastore.Page{Products: []Product{}}
+	for _, i := range result.Items {
+		p, err := unmarshalProduct(i)
+		if err != nil {
+			return datastore.Page{}, fmt.Errorf("Unmarshalling GetPage failed:\n%v", err)
+		}
+		if !p.Expired() {
+			page.Products = append(page.Products, p)
+		}
+	}
+	// The key schema is just the ID, so that's all the cursor needs to carry.
+	if key, ok := result.LastEvaluatedKey[IdAttribute]; ok {
+		switch key := key.(type) {
+		case *types.AttributeValueMemberN:
+			page.Cursor = datastore.EncodeCursor(key.Value)
+		case *types.AttributeValueMemberS:
+			page.Cursor = datastore.EncodeCursor(key.Value)
+		}
+	}
+	return page, nil
+}
 
-	return temp, nil
+// NextID - assigns the ID for a new Product: the next value of an atomic counter, or a UUID depending on the ID strategy.
+func (db *Products) NextID(ctx context.Context) (string, error) {
+	if datastore.Strategy == datastore.UUIDIDs {
+		return datastore.NewUUID()
+	}
+
+	// ADD is atomic, so concurrent creates can never be handed the same ID.
+	result, err := Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(envTable(CountersTableName)),
+		Key: map[string]types.AttributeValue{
+			"name": &types.AttributeValueMemberS{Value: counterKey(ctx)},
+		},
+		UpdateExpression:          aws.String("ADD #v :one"),
+		ExpressionAttributeNames:  map[string]string{"#v": "value"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+		ReturnValues:              types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return "", fmt.Errorf("NextID -> Counter could not be incremented: %w", unavailable(err))
+	}
+
+	value, ok := result.Attributes["value"].(*types.AttributeValueMemberN)
+	if !ok {
+		return "", fmt.Errorf("NextID -> Counter has no numeric value")
+	}
+	return value.Value, nil
+}
+
+// AdvanceID - raises the ID counter to id if it is lower, so NextID never hands out id or anything below it.
+func (db *Products) AdvanceID(ctx context.Context, id string) error {
+	if datastore.Strategy == datastore.UUIDIDs {
+		return nil
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return fmt.Errorf("AdvanceID -> Invalid product ID %q", id)
+	}
+
+	_, err := Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(envTable(CountersTableName)),
+		Key: map[string]types.AttributeValue{
+			"name": &types.AttributeValueMemberS{Value: counterKey(ctx)},
+		},
+		UpdateExpression:          aws.String("SET #v = :n"),
+		ConditionExpression:       aws.String("attribute_not_exists(#v) OR #v < :n"),
+		ExpressionAttributeNames:  map[string]string{"#v": "value"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":n": &types.AttributeValueMemberN{Value: id}},
+	})
+	// A failed condition just means the counter is already past id.
+	var conditionFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("AdvanceID -> Counter could not be updated: %w", unavailable(err))
+	}
+	return nil
 }
 
 // AddProduct - adds a new Product to the database.
-func (db *Products) AddProduct(newProduct Product) error {
-	data, err := dynamodbattribute.MarshalMap(newProduct)
+func (db *Products) AddProduct(ctx context.Context, newProduct Product) error {
+	// Stock is only ever adjusted (see AdjustStock), so a new Product starts with none.
+	newProduct.Stock = nil
+	newProduct.UpdatedAt = datastore.Modified(time.Now())
+	data, err := marshalProduct(newProduct)
 	if err != nil {
 		return fmt.Errorf("AddProduct -> Error marshalling product: %v", err)
 	}
 
-	// Setup the insert criteria.
-	item := &dynamodb.PutItemInput{
-		Item:      data,
-		TableName: aws.String(TableName),
+	// Setup the insert criteria; the condition stops an existing Product from being silently replaced. An expired one
+	// that TTL hasn't deleted yet is as good as gone, so its ID can be taken again (by a PUT upsert).
+	item := &types.Put{
+		Item:                     data,
+		TableName:                aws.String(tableName(ctx)),
+		ConditionExpression:      aws.String("attribute_not_exists(#id) OR #exp <= :now"),
+		ExpressionAttributeNames: map[string]string{"#id": IdAttribute, "#exp": ExpiresAtAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
 	}
 
-	// Insert the new Product into the database.
-	_, err = Items.PutItem(item)
+	// Insert the new Product into the database, together with its starting price, the change (in the log and the
+	// outbox), and its claims on its unique values.
+	writes := append([]types.TransactWriteItem{{Put: item}, historyPut(ctx, newProduct)}, changePuts(ctx, newProduct.Id, datastore.ChangeCreated)...)
+	writes = append(writes, claims(ctx, newProduct)...)
+	err = withClaims(ctx, []Product{newProduct}, writes)
+	if errors.As(err, &inUse{}) {
+		return fmt.Errorf("AddProduct -> %w", err)
+	}
+	if errors.Is(err, datastore.ErrConflict) {
+		return datastore.Errorf("product_exists", "AddProduct -> Product <%v> already exists: %w", newProduct.Id, datastore.ErrConflict)
+	}
 	if err != nil {
-		return fmt.Errorf("AddProduct -> New product could not be added: %v", err)
+		return fmt.Errorf("AddProduct -> New product could not be added: %w", unavailable(err))
 	}
 
 	return nil
 }
 
 // GetProduct - if it exists, retrieves the requested Product from the database;
-func (db Products) GetProduct(product *Product) error {
+func (db Products) GetProduct(ctx context.Context, product *Product) error {
 	// Setup query criteria.
-	result, err := Items.Query(&dynamodb.QueryInput{
-		TableName:              aws.String(TableName),
-		ScanIndexForward:       aws.Bool(false),
-		KeyConditionExpression: aws.String("id = :id"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":id": {N: aws.String(strconv.Itoa(product.Id))},
+	expr, names := projection(ctx)
+	result, err := readerFor(ctx).Query(ctx, &dynamodb.QueryInput{
+		TableName:                aws.String(tableName(ctx)),
+		ScanIndexForward:         aws.Bool(false),
+		ConsistentRead:           consistentRead(ctx),
+		KeyConditionExpression:   aws.String("id = :id"),
+		ProjectionExpression:     expr,
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": keyValue(product.Id),
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("Query GetProduct failed:\n%w", unavailable(err))
+	}
 
 	// If the product was found, then there should only be one item.
 	for _, i := range result.Items {
-		var p Product
-		err = dynamodbattribute.UnmarshalMap(i, &p)
+		p, err := unmarshalProduct(i)
 		if err != nil {
 			return fmt.Errorf("Unmarshalling GetProduct failed:\n%v", err)
 		}
+		if p.Expired() {
+			break
+		}
 
 		*product = p
 
@@ -111,89 +454,608 @@ func (db Products) GetProduct(product *Product) error {
 	}
 
 	// If the product was not found, then return the appropriate status message.
-	return fmt.Errorf("Product <%v> does not exist", product.Id)
+	return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", product.Id, datastore.ErrNotFound)
 }
 
-// UpdateProduct - if found, this updates an existing Product; otherwise adds the new Product.
-func (db *Products) UpdateProduct(newProduct Product) error {
+// UpdateProduct - if found, this updates an existing, live Product and returns it as stored; otherwise it fails with
+// datastore.ErrNotFound.
+func (db *Products) UpdateProduct(ctx context.Context, newProduct Product) (Product, error) {
+	updated := time.Now()
 	// Setup the update criteria.
 	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String(TableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			IdAttribute: {N: aws.String(strconv.Itoa(newProduct.Id))},
+		TableName: aws.String(tableName(ctx)),
+		Key: map[string]types.AttributeValue{
+			IdAttribute: keyValue(newProduct.Id),
+		},
+		ExpressionAttributeNames: map[string]string{
+			"#n": "Name",
 		},
-		UpdateExpression:         aws.String("SET #n = :name, Price = :price"),
-		ExpressionAttributeNames: map[string]*string{"#n": aws.String("Name")},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":name":  {S: aws.String(newProduct.Name)},
-			":price": {N: aws.String(fmt.Sprintf("%f", newProduct.Price))},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name":  &types.AttributeValueMemberS{Value: newProduct.Name},
+			":price": &types.AttributeValueMemberN{Value: newProduct.Price.String()},
+			":upd":   &types.AttributeValueMemberN{Value: strconv.FormatInt(updated.Unix(), 10)},
 		},
-		ReturnValues: aws.String("ALL_NEW"),
 	}
 
-	// Execute the update.
-	_, err := Items.UpdateItem(input)
+	sets := []string{"#n = :name", "Price = :price", "#upd = :upd"}
+	input.ExpressionAttributeNames["#upd"] = UpdatedAtAttribute
+	removes := []string{}
+
+	// If a unique value is changing, its claims move in the same transaction as the update.
+	moves, err := claimMoves(ctx, newProduct)
 	if err != nil {
-		return fmt.Errorf("New product <%v> could not be updated/added: %v", newProduct, err)
+		return Product{}, fmt.Errorf("Product <%v> could not be updated: %w", newProduct.Id, err)
+	}
+	input.ExpressionAttributeNames["#bc"] = BarcodeAttribute
+	if newProduct.Barcode != "" {
+		sets = append(sets, "#bc = :bc")
+		input.ExpressionAttributeValues[":bc"] = &types.AttributeValueMemberS{Value: newProduct.Barcode}
+	} else {
+		removes = append(removes, "#bc")
 	}
 
-	return nil
+	input.ExpressionAttributeNames["#sup"] = SupplierAttribute
+	if newProduct.SupplierId != "" {
+		sets = append(sets, "#sup = :sup")
+		input.ExpressionAttributeValues[":sup"] = &types.AttributeValueMemberS{Value: newProduct.SupplierId}
+	} else {
+		removes = append(removes, "#sup")
+	}
+
+	input.ExpressionAttributeNames["#cat"] = CategoryAttribute
+	if newProduct.CategoryId != "" {
+		sets = append(sets, "#cat = :cat")
+		input.ExpressionAttributeValues[":cat"] = &types.AttributeValueMemberS{Value: newProduct.CategoryId}
+	} else {
+		removes = append(removes, "#cat")
+	}
+	input.ExpressionAttributeNames["#tags"] = TagsAttribute
+	if len(newProduct.Tags) > 0 {
+		sets = append(sets, "#tags = :tags")
+		input.ExpressionAttributeValues[":tags"] = tagsValue(newProduct.Tags)
+	} else {
+		removes = append(removes, "#tags")
+	}
+
+	input.ExpressionAttributeNames["#desc"] = DescriptionAttribute
+	if newProduct.Description != "" {
+		sets = append(sets, "#desc = :desc")
+		input.ExpressionAttributeValues[":desc"] = &types.AttributeValueMemberS{Value: newProduct.Description}
+	} else {
+		removes = append(removes, "#desc")
+	}
+
+	// Translations are maps from locale to text.
+	input.ExpressionAttributeNames["#ntr"] = NameTranslationsAttribute
+	if len(newProduct.NameTranslations) > 0 {
+		sets = append(sets, "#ntr = :ntr")
+		input.ExpressionAttributeValues[":ntr"] = translationsValue(newProduct.NameTranslations)
+	} else {
+		removes = append(removes, "#ntr")
+	}
+	input.ExpressionAttributeNames["#dtr"] = DescriptionTranslationsAttribute
+	if len(newProduct.DescriptionTranslations) > 0 {
+		sets = append(sets, "#dtr = :dtr")
+		input.ExpressionAttributeValues[":dtr"] = translationsValue(newProduct.DescriptionTranslations)
+	} else {
+		removes = append(removes, "#dtr")
+	}
+
+	// Keep the NameIndex keys in step with the name.
+	input.ExpressionAttributeNames["#nb"] = nameBucketAttribute
+	input.ExpressionAttributeNames["#nl"] = nameLowerAttribute
+	if bucket, lower := nameKeys(newProduct.Name); bucket != "" {
+		sets = append(sets, "#nb = :nb", "#nl = :nl")
+		input.ExpressionAttributeValues[":nb"] = &types.AttributeValueMemberS{Value: bucket}
+		input.ExpressionAttributeValues[":nl"] = &types.AttributeValueMemberS{Value: lower}
+	} else {
+		removes = append(removes, "#nb", "#nl")
+	}
+
+	// The TTL attribute is epoch seconds; removing it makes the Product permanent again.
+	input.ExpressionAttributeNames["#exp"] = ExpiresAtAttribute
+	if newProduct.ExpiresAt != nil {
+		sets = append(sets, "#exp = :exp")
+		input.ExpressionAttributeValues[":exp"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(newProduct.ExpiresAt.Unix(), 10)}
+	} else {
+		removes = append(removes, "#exp")
+	}
+
+	expr := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		expr += " REMOVE " + strings.Join(removes, ", ")
+	}
+	input.UpdateExpression = aws.String(expr)
+
+	// The update must not create a Product, or bring an expired one back.
+	live := "attribute_exists(#id) AND (attribute_not_exists(#exp) OR #exp > :now)"
+	input.ConditionExpression = aws.String(live)
+	input.ExpressionAttributeNames["#id"] = IdAttribute
+	input.ExpressionAttributeValues[":now"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)}
+
+	// The change is logged and put in the outbox in the same transaction as the update, as is a price change. The
+	// condition fails the transaction when the price is unchanged (or the Product is gone), and then the update is
+	// applied with just the change. A claim's condition failing fails both; withClaims says who holds the value, or
+	// reclaims a stale claim and tries again.
+	names := map[string]string{"#price": "Price"}
+	for k, v := range input.ExpressionAttributeNames {
+		names[k] = v
+	}
+	write := func(writes []types.TransactWriteItem) error {
+		writes = append(append(writes, moves...), changePuts(ctx, newProduct.Id, datastore.ChangeUpdated)...)
+		if len(moves) == 0 {
+			return transactWrite(ctx, writes)
+		}
+		return withClaims(ctx, []Product{newProduct}, writes)
+	}
+	err = write([]types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName:                 input.TableName,
+			Key:                       input.Key,
+			UpdateExpression:          input.UpdateExpression,
+			ConditionExpression:       aws.String(live + " AND #price <> :price"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: input.ExpressionAttributeValues,
+		}},
+		historyPut(ctx, newProduct),
+	})
+	var conflict inUse
+	if errors.As(err, &conflict) {
+		return Product{}, fmt.Errorf("Product <%v> could not be updated: %w", newProduct.Id, err)
+	}
+	if errors.Is(err, datastore.ErrConflict) {
+		err = write([]types.TransactWriteItem{
+			{Update: &types.Update{
+				TableName:                 input.TableName,
+				Key:                       input.Key,
+				UpdateExpression:          input.UpdateExpression,
+				ConditionExpression:       input.ConditionExpression,
+				ExpressionAttributeNames:  input.ExpressionAttributeNames,
+				ExpressionAttributeValues: input.ExpressionAttributeValues,
+			}},
+		})
+		if errors.As(err, &conflict) {
+			return Product{}, fmt.Errorf("Product <%v> could not be updated: %w", newProduct.Id, err)
+		}
+		if errors.Is(err, datastore.ErrConflict) {
+			return Product{}, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", newProduct.Id, datastore.ErrNotFound)
+		}
+	}
+	if err != nil {
+		return Product{}, fmt.Errorf("Product <%v> could not be updated: %w", newProduct, unavailable(err))
+	}
+
+	// A transaction can't return the item it wrote, so it's read back. The update is done either way, so if that
+	// fails it's logged and the Product is returned as written, with the updated_at the update set.
+	stored, err := storedProduct(ctx, newProduct.Id)
+	if err != nil {
+		log.Printf("Reading back updated product <%v> failed, so it's returned as written: %v", newProduct.Id, err)
+		newProduct.UpdatedAt = datastore.Modified(updated)
+		return newProduct, nil
+	}
+	return stored, nil
 }
 
-// DeleteProduct - if it exists, deletes the specified Product.
-func (db *Products) DeleteProduct(p Product) error {
-	// Setup the delete criteria.
-	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String(TableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			IdAttribute: {N: aws.String(strconv.Itoa(p.Id))},
-		},
-		ReturnValues: aws.String("ALL_OLD"),
+// storedProduct - local helper function that reads a Product back from the table itself, with a strongly
+// consistent read, rather than through DAX.
+func storedProduct(ctx context.Context, id string) (Product, error) {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName(ctx)),
+		Key:            map[string]types.AttributeValue{IdAttribute: keyValue(id)},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Product{}, fmt.Errorf("GetItem failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return Product{}, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	p, err := unmarshalProduct(result.Item)
+	if err != nil {
+		return Product{}, fmt.Errorf("Unmarshalling product <%v> failed:\n%v", id, err)
 	}
+	return p, nil
+}
 
-	// Process the deletion.
-	results, err := Items.DeleteItem(input)
+/*
+DeleteProduct - if it exists, deletes the specified Product. The delete is a transaction with the change, which
+can't return the item it deleted, so the Product is read first for the unique values whose claims it gives up. If
+it's given a new one in between, that claim is left behind, to be reclaimed as a stale one.
+*/
+func (db *Products) DeleteProduct(ctx context.Context, p Product) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName(ctx)),
+		Key:            map[string]types.AttributeValue{IdAttribute: keyValue(p.Id)},
+		ConsistentRead: aws.Bool(true),
+	})
 	if err != nil {
-		return fmt.Errorf("Product <%v> could not be deleted: %v", p, err)
+		return fmt.Errorf("Product <%v> could not be deleted: %w", p, unavailable(err))
 	}
 
+	// Process the deletion, logging it and putting it in the outbox.
+	err = transactWrite(ctx, append([]types.TransactWriteItem{{Delete: &types.Delete{
+		TableName:                aws.String(tableName(ctx)),
+		Key:                      map[string]types.AttributeValue{IdAttribute: keyValue(p.Id)},
+		ConditionExpression:      aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{"#id": IdAttribute},
+	}}}, changePuts(ctx, p.Id, datastore.ChangeDeleted)...))
+
 	// If there was nothing to delete, then return an appropriate message.
-	if len(results.Attributes) == 0 {
-		return fmt.Errorf("Product <%v> does not exist", p)
+	if errors.Is(err, datastore.ErrConflict) {
+		return datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", p, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Product <%v> could not be deleted: %w", p, unavailable(err))
 	}
 
+	releaseClaims(ctx, p.Id, result.Item)
+
 	return nil
 }
 
-// Initialize - a helper function that sets up the database when the app is run for the first time.
-func Initialize() error {
-	// Initialize the AWS session.
-	const Region = "us-west-2"
-	const Endpoint = "http://localhost:8080"
-	sess, err := session.NewSession(&aws.Config{
-		Region:   aws.String(Region),
-		Endpoint: aws.String(Endpoint),
+/*
+ExpiredProducts - scans for Products past their expiry that DynamoDB's TTL hasn't deleted yet, which can take
+several days.
+*/
+func (db Products) ExpiredProducts(ctx context.Context) ([]Product, error) {
+	pages := dynamodb.NewScanPaginator(readerFor(ctx), &dynamodb.ScanInput{
+		TableName:                aws.String(tableName(ctx)),
+		FilterExpression:         aws.String("#e <= :now"),
+		ExpressionAttributeNames: map[string]string{"#e": ExpiresAtAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
 	})
+
+	expired := []Product{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Scan ExpiredProducts failed:\n%w", unavailable(err))
+		}
+		for _, i := range page.Items {
+			p, err := unmarshalProduct(i)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling ExpiredProducts failed:\n%v", err)
+			}
+			expired = append(expired, p)
+		}
+	}
+	return expired, nil
+}
+
+// readUnitBytes - the number of bytes one read capacity unit covers for a strongly consistent read.
+const readUnitBytes = 4096
+
+// Explain - describes how a listing query would be executed and estimates its read capacity cost
+// from the table statistics DynamoDB reports (which are refreshed roughly every six hours).
+func (db Products) Explain(ctx context.Context, query datastore.ListQuery) (datastore.QueryPlan, error) {
+	result, err := Items.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName(ctx))})
 	if err != nil {
-		return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+		return datastore.QueryPlan{}, fmt.Errorf("DescribeTable failed:\n%w", unavailable(err))
+	}
+	items := aws.ToInt64(result.Table.ItemCount)
+	size := aws.ToInt64(result.Table.TableSizeBytes)
+
+	// Eventually consistent reads cost half a unit per 4KB, rounded up per operation.
+	units := func(bytes int64) float64 {
+		return math.Max(1, math.Ceil(float64(bytes)/readUnitBytes)) / 2
+	}
+	// Strongly consistent reads of the table cost twice that; NameIndex can only be read eventually consistently.
+	tableUnits := units
+	if aws.ToBool(consistentRead(ctx)) {
+		tableUnits = func(bytes int64) float64 { return 2 * units(bytes) }
+	}
+
+	var plan datastore.QueryPlan
+	f := query.Filter
+	switch {
+	case f.Name != "" || f.NamePrefix != "":
+		// Index statistics aren't split by partition, so assume names are spread evenly over ~26 initial letters.
+		indexItems, indexSize := int64(0), int64(0)
+		for _, index := range result.Table.GlobalSecondaryIndexes {
+			if aws.ToString(index.IndexName) == NameIndex {
+				indexItems, indexSize = aws.ToInt64(index.ItemCount), aws.ToInt64(index.IndexSizeBytes)
+			}
+		}
+		plan = datastore.QueryPlan{
+			Operation:          "Query",
+			Index:              NameIndex + " (" + nameBucketAttribute + ", " + nameLowerAttribute + ")",
+			EstimatedItems:     indexItems / 26,
+			EstimatedReadUnits: units(indexSize / 26),
+		}
+		if f.Name != "" && indexItems > 0 {
+			plan.EstimatedItems = 1
+			plan.EstimatedReadUnits = units(indexSize / indexItems)
+		}
+	default:
+		plan = datastore.QueryPlan{
+			Operation:          "Scan",
+			Index:              "none",
+			FullScan:           true,
+			EstimatedItems:     items,
+			EstimatedReadUnits: tableUnits(size),
+		}
 	}
 
+	switch {
+	case f.Query != "":
+		plan.Notes = append(plan.Notes, "A search scores every Product's name, so it reads the whole table")
+	case f.Expr != nil:
+		plan.Notes = append(plan.Notes, "A filter expression is applied by DynamoDB during the Scan: it reduces what's returned, not what's read")
+	}
+	if len(query.Sort) > 0 {
+		plan.Notes = append(plan.Notes, "Sorting is done in memory after all matching items have been read")
+	}
+	for _, param := range query.Params {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%q is applied after items are read, so it doesn't reduce the cost", param))
+	}
+	sort.Strings(plan.Notes)
+
+	return plan, nil
+}
+
+// logLevels - the SDK log levels that can be chosen in config.
+var logLevels = map[string]aws.ClientLogMode{
+	"":                     0,
+	"off":                  0,
+	"debug":                aws.LogRequest | aws.LogResponse,
+	"debug_with_retries":   aws.LogRequest | aws.LogResponse | aws.LogRetries,
+	"debug_with_http_body": aws.LogRequestWithBody | aws.LogResponseWithBody | aws.LogRetries,
+}
+
+// retryBackoff - exponential backoff with jitter between the configured bounds, using the throttle bounds when
+// DynamoDB throttled the request (the v2 SDK's own backoff only has a maximum).
+type retryBackoff struct {
+	cfg config.DynamoDB
+}
+
+func (b retryBackoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	min, max := b.cfg.MinRetryDelay.Duration, b.cfg.MaxRetryDelay.Duration
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		min, max = b.cfg.MinThrottleDelay.Duration, b.cfg.MaxThrottleDelay.Duration
+	}
+
+	delay := max
+	if attempt < 32 && min<<uint(attempt-1) < max {
+		delay = min << uint(attempt-1)
+	}
+	if delay <= 0 {
+		return 0, nil
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)), nil
+}
+
+// unavailable - local helper function that marks err as datastore.ErrUnavailable if it's one the SDK retries
+// (throttling, server errors, timeouts and connection failures), since it was still failing when the retries ran out.
+// Throttling is marked as datastore.ErrThrottled too, since DynamoDB turned the request away without applying it.
+func unavailable(err error) error {
+	if errors.Is(err, datastore.ErrUnavailable) {
+		return err
+	}
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return fmt.Errorf("%w: %w (%w)", err, datastore.ErrUnavailable, datastore.ErrThrottled)
+	}
+	retryable := retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+	if retryable || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", err, datastore.ErrUnavailable)
+	}
+	return err
+}
+
+// emulatorKeys - the placeholder access key each emulator is given when no credentials are configured. LocalStack
+// treats "test" as its default account, 000000000000; DynamoDB Local accepts anything.
+var emulatorKeys = map[string]string{config.DynamoDBLocal: "local", config.DynamoDBLocalStack: "test"}
+
+// clientConfig - builds the SDK client settings (region, credentials, retries, backoff, timeouts and logging) from
+// the app config. Region and credentials come from the SDK's default sources unless the config names them.
+func clientConfig(cfg config.DynamoDB) (aws.Config, error) {
+	if !cfg.Emulated() && cfg.Target != config.DynamoDBAWS {
+		return aws.Config{}, fmt.Errorf("Unknown DynamoDB target %q; use %q, %q or %q", cfg.Target, config.DynamoDBLocal, config.DynamoDBLocalStack, config.DynamoDBAWS)
+	}
+	logMode, ok := logLevels[cfg.LogLevel]
+	if !ok {
+		return aws.Config{}, fmt.Errorf("Unknown DynamoDB log level %q", cfg.LogLevel)
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(cfg.RequestTimeout.Duration)),
+		awsconfig.WithClientLogMode(logMode),
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = cfg.MaxRetries + 1
+				o.Backoff = retryBackoff{cfg}
+			})
+		}),
+	}
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(cfg.Profile))
+	}
+	// The emulators don't check credentials, so none need setting up for them.
+	if cfg.Emulated() && cfg.Profile == "" && os.Getenv("AWS_ACCESS_KEY_ID") == "" && os.Getenv("AWS_PROFILE") == "" {
+		key := emulatorKeys[cfg.Target]
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(key, key, "")))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return awsCfg, fmt.Errorf("Error loading AWS configuration: %v", err)
+	}
+	if awsCfg.Region == "" {
+		awsCfg.Region = config.DefaultRegion
+	}
+	// Requests carry on the trace of whatever they were made for.
+	awsCfg.APIOptions = append(awsCfg.APIOptions, tracecontext.AWS)
+	if role := cfg.AssumeRole; role.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), role.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if role.SessionName != "" {
+				o.RoleSessionName = role.SessionName
+			}
+			if role.ExternalID != "" {
+				o.ExternalID = aws.String(role.ExternalID)
+			}
+			if role.Duration.Duration > 0 {
+				o.Duration = role.Duration.Duration
+			}
+		})
+		awsCfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return awsCfg, nil
+}
+
+// connect - local helper function that creates the DynamoDB (and, if configured, DAX) clients without touching any tables.
+func connect(cfg config.Config) (aws.Config, error) {
+	awsCfg, err := clientConfig(cfg.DynamoDB)
+	if err != nil {
+		return awsCfg, err
+	}
+
+	if !tableAffix.MatchString(cfg.DynamoDB.TablePrefix + cfg.DynamoDB.TableSuffix) {
+		return awsCfg, fmt.Errorf("Table prefix %q and suffix %q may only use letters, digits, '_', '-' and '.'", cfg.DynamoDB.TablePrefix, cfg.DynamoDB.TableSuffix)
+	}
+	tablePrefix, tableSuffix = cfg.DynamoDB.TablePrefix, cfg.DynamoDB.TableSuffix
+	connected.cfg, connected.aws = cfg, awsCfg
+
 	// Initialize the DynamoDB instance.
-	Items = Products{dynamodb.New(sess, aws.NewConfig().WithLogLevel(aws.LogDebugWithHTTPBody))}
-	Items.listTables()
+	Items = Products{dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if endpoint := cfg.DynamoDB.ResolvedEndpoint(); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		if cfg.DynamoDB.GlobalTable.Enabled {
+			noteWrites(o)
+		}
+	})}
+	if reads, err = readClient(awsCfg, cfg.DynamoDB); err != nil {
+		return awsCfg, err
+	}
+	if err := routeReads(context.Background(), awsCfg, cfg.DynamoDB); err != nil {
+		return awsCfg, err
+	}
+	consistentReads = cfg.DynamoDB.ConsistentReads
+	if scanSegments = cfg.DynamoDB.ScanSegments; scanSegments < 1 || scanSegments > MaxScanSegments {
+		return awsCfg, fmt.Errorf("Scan segments must be between 1 and %v, not %v", MaxScanSegments, scanSegments)
+	}
+	// The emulators serve streams at the same endpoint; on AWS, Streams has its own, even when DynamoDB is reached
+	// through another.
+	streams = dynamodbstreams.NewFromConfig(awsCfg, func(o *dynamodbstreams.Options) {
+		if cfg.DynamoDB.Emulated() {
+			o.BaseEndpoint = aws.String(cfg.DynamoDB.ResolvedEndpoint())
+		}
+	})
+	return awsCfg, nil
+}
+
+// Connect - sets up the clients for tools that manage the tables themselves, rather than letting Initialize create them.
+func Connect(cfg config.Config) error {
+	if _, err := connect(cfg); err != nil {
+		return fmt.Errorf("Error connecting to DynamoDB: %v", err)
+	}
+	return nil
+}
 
-	tableExists, err := Items.tableExists(TableName)
+// Initialize - a helper function that sets up the database when the app is run for the first time.
+func Initialize(cfg config.Config) error {
+	awsCfg, err := connect(cfg)
 	if err != nil {
 		return fmt.Errorf("INITIALIZATION ERROR: %v", err)
 	}
+	Items.listTables()
+
+	uniqueAttrs = []uniqueAttr{barcodeClaims}
+	if cfg.UniqueNames {
+		uniqueAttrs = append(uniqueAttrs, nameClaims)
+	}
+
+	// The Counters table is shared by every tenant's table, so it is set up first.
+	countersCreated := false
+	if datastore.Strategy == datastore.IntIDs {
+		countersExist, err := Items.tableExists(envTable(CountersTableName))
+		if err != nil {
+			return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+		}
+
+		if !countersExist {
+			if err := createCountersTable(cfg.DynamoDB); err != nil {
+				return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+			}
+			countersCreated = true
+		}
+	}
+
+	// So is the Users table.
+	if err := createUsersTable(context.Background(), cfg.DynamoDB); err != nil {
+		return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+	}
+
+	for _, tenant := range cfg.Tenancy.Names() {
+		ctx := datastore.WithTenant(context.Background(), tenant)
+		if err := initializeTable(ctx, awsCfg, cfg, countersCreated); err != nil {
+			return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+		}
+	}
+	if err := replicateTables(context.Background(), cfg.DynamoDB, append(sharedTables(), envTable(SchemaTableName))); err != nil {
+		return fmt.Errorf("INITIALIZATION ERROR: %v", err)
+	}
+
+	return nil
+}
+
+// initializeTable - local helper function that sets up the context's tenant's Products table: created and seeded
+// if it doesn't exist yet, then brought up to date.
+func initializeTable(ctx context.Context, awsCfg aws.Config, cfg config.Config, countersCreated bool) error {
+	table := tableName(ctx)
+	tableExists, err := Items.tableExists(table)
+	if err != nil {
+		return err
+	}
 
 	if !tableExists {
-		createTable()
+		if err := createTable(ctx, cfg.DynamoDB, table); err != nil {
+			return err
+		}
+		// Initialize the database with the seed data.
+		products, err := enterTestData(ctx, cfg.Seed, table)
+		if err != nil {
+			return err
+		}
+		if len(products) > 0 {
+			if err := Items.AdvanceID(ctx, products[len(products)-1].Id); err != nil {
+				return err
+			}
+		}
 	} else {
-		fmt.Println("Table already exists!")
+		fmt.Printf("Table '%v' already exists!\n", table)
+		// Products written before the counter existed must never be handed out again.
+		if countersCreated {
+			if err := advancePastExisting(ctx); err != nil {
+				return err
+			}
+		}
 	}
 
-	return nil
+	// Bring tables created by older versions of the app up to date. New tables already have the current schema,
+	// and the migrations leave them unchanged.
+	if err := migrateSchema(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	// Resources can be registered at any time, so their tables aren't part of the schema's history.
+	if err := createResourceTables(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	// Names may have been left unclaimed while uniqueness was off.
+	if cfg.UniqueNames {
+		if err := nameClaims.claimExisting(ctx, table); err != nil {
+			return err
+		}
+	}
+
+	if err := enableAutoScaling(awsCfg, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	return replicateTables(ctx, cfg.DynamoDB, append([]string{table}, childTables(table)...))
 }
 
 // Cleanup - a helper function that performs any cleanup processing.
@@ -203,64 +1065,175 @@ func Cleanup() error {
 	return nil
 }
 
-// createTable - local helper function that creates the Products DynamoDB table.
-func createTable() error {
-	fmt.Println("Creating table...")
+// enableTTL - local helper function that turns on Time To Live for the expires_at attribute, if it isn't already.
+func enableTTL(table string) error {
+	result, err := Items.DescribeTimeToLive(context.Background(), &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("DescribeTimeToLive failed: %v", err)
+	}
+	if ttl := result.TimeToLiveDescription; ttl != nil && aws.ToString(ttl.AttributeName) == ExpiresAtAttribute &&
+		ttl.TimeToLiveStatus != types.TimeToLiveStatusDisabled {
+		return nil
+	}
+
+	_, err = Items.UpdateTimeToLive(context.Background(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(table),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(ExpiresAtAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Enabling TTL failed: %v", err)
+	}
+	return nil
+}
+
+// setBilling - local helper function that applies the configured billing mode to a new table. Provisioned
+// tables get the given read/write capacity; on-demand tables must not specify any.
+func setBilling(input *dynamodb.CreateTableInput, cfg config.DynamoDB, read, write int64) error {
+	switch types.BillingMode(cfg.BillingMode) {
+	case "", types.BillingModeProvisioned:
+		input.BillingMode = types.BillingModeProvisioned
+		input.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits: aws.Int64(read), WriteCapacityUnits: aws.Int64(write),
+		}
+	case types.BillingModePayPerRequest:
+		input.BillingMode = types.BillingModePayPerRequest
+	default:
+		return fmt.Errorf("Unknown billing mode %q", cfg.BillingMode)
+	}
+	return nil
+}
+
+// createTable - local helper function that creates a Products DynamoDB table and waits (up to tableWait) until it is
+// ACTIVE, since a table that is still CREATING can't be written to.
+func createTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	fmt.Printf("Creating table '%v'...\n", table)
 
 	// Setup table create criteria.
 	input := &dynamodb.CreateTableInput{
-		TableName: aws.String(TableName),
-		KeySchema: []*dynamodb.KeySchemaElement{
+		TableName: aws.String(table),
+		KeySchema: []types.KeySchemaElement{
 			{
-				AttributeName: aws.String(IdAttribute), KeyType: aws.String("HASH"),
+				AttributeName: aws.String(IdAttribute), KeyType: types.KeyTypeHash,
 			},
 		},
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+		AttributeDefinitions: []types.AttributeDefinition{
 			{
-				AttributeName: aws.String(IdAttribute), AttributeType: aws.String("N"),
+				AttributeName: aws.String(IdAttribute), AttributeType: keyType(),
 			},
 		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits: aws.Int64(10), WriteCapacityUnits: aws.Int64(10),
-		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{nameIndex(cfg), barcodeIndex(cfg)},
+		StreamSpecification:    streamSpecification,
+	}
+	input.AttributeDefinitions = append(input.AttributeDefinitions, nameAttributeDefinitions()...)
+	input.AttributeDefinitions = append(input.AttributeDefinitions, barcodeAttributeDefinitions()...)
+	if err := setBilling(input, cfg, cfg.ReadCapacity, cfg.WriteCapacity); err != nil {
+		return err
 	}
 
 	// Create the table.
-	if _, err := Items.CreateTable(input); err != nil {
-		fmt.Println("Error during CreateTable:")
-		return fmt.Errorf("%v", err)
+	if _, err := Items.CreateTable(ctx, input); err != nil {
+		return fmt.Errorf("Error creating table %v: %v", table, err)
 	}
 
-	fmt.Printf("Table '%v' successfully created!\n", TableName)
+	waiter := dynamodb.NewTableExistsWaiter(Items)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, tableWait); err != nil {
+		return fmt.Errorf("Waiting for table %v failed: %v", table, err)
+	}
 
-	// Initialize the database with some data for testing purposes.
-	enterTestData()
+	fmt.Printf("Table '%v' successfully created!\n", table)
 
 	return nil
 }
 
-// enterTestData - local helper function that populates the database with some dummy data for testing purposes.
-func enterTestData() error {
-	products := []Product{
-		{1, "Apple", 0.98},
-		{2, "Orange", 0.98},
-		{3, "Bananas", 2.25},
-		{4, "Frozen Pizza", 4.99},
+// createCountersTable - local helper function that creates the Counters table. Each Products table's counter
+// starts at 0 the first time it is used.
+func createCountersTable(cfg config.DynamoDB) error {
+	fmt.Println("Creating counters table...")
+
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(envTable(CountersTableName)),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("name"), KeyType: types.KeyTypeHash,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("name"), AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+	}
+	if err := setBilling(input, cfg, 1, 5); err != nil {
+		return err
 	}
 
-	for _, p := range products {
-		err := Items.AddProduct(p)
+	if _, err := Items.CreateTable(context.Background(), input); err != nil {
+		fmt.Println("Error during CreateTable:")
+		return fmt.Errorf("%v", err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(Items)
+	if err := waiter.Wait(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String(envTable(CountersTableName))}, tableWait); err != nil {
+		return fmt.Errorf("Waiting for table %v failed: %v", envTable(CountersTableName), err)
+	}
+
+	fmt.Printf("Table '%v' successfully created!\n", envTable(CountersTableName))
+
+	return nil
+}
+
+// advancePastExisting - local helper function that moves the context's tenant's counter past the highest ID already
+// in its table, for tables that had Products before the counter existed.
+func advancePastExisting(ctx context.Context) error {
+	highest := 0
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{
+		TableName:            aws.String(tableName(ctx)),
+		ProjectionExpression: aws.String(IdAttribute),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
 		if err != nil {
-			return fmt.Errorf("Error entering test data: %v", err)
+			return fmt.Errorf("Error scanning for the highest ID: %v", err)
+		}
+		for _, i := range page.Items {
+			if key, ok := i[IdAttribute].(*types.AttributeValueMemberN); ok {
+				if id, err := strconv.Atoi(key.Value); err == nil && id > highest {
+					highest = id
+				}
+			}
 		}
 	}
 
-	return nil
+	if highest == 0 {
+		return nil
+	}
+	return Items.AdvanceID(ctx, strconv.Itoa(highest))
+}
+
+// enterTestData - local helper function that populates a table with the configured seed data (by default,
+// some dummy data for testing purposes) and returns what it wrote.
+func enterTestData(ctx context.Context, seed config.Seed, table string) ([]Product, error) {
+	if seed.Skip {
+		return nil, nil
+	}
+	products, err := datastore.SeedProducts(seed.File)
+	if err != nil {
+		return nil, fmt.Errorf("Error entering test data: %v", err)
+	}
+
+	if err := putProducts(ctx, table, products); err != nil {
+		return nil, fmt.Errorf("Error entering test data: %v", err)
+	}
+
+	return products, nil
 }
 
 // tableExists - local helper function that determines if a table with a specific name exists or not.
 func (db *Products) tableExists(name string) (bool, error) {
-	result, err := db.ListTables(&dynamodb.ListTablesInput{})
+	result, err := db.ListTables(context.Background(), &dynamodb.ListTablesInput{})
 
 	if err != nil {
 		fmt.Println("Error during ListTables:")
@@ -268,7 +1241,7 @@ func (db *Products) tableExists(name string) (bool, error) {
 	}
 
 	for _, n := range result.TableNames {
-		if *n == name {
+		if n == name {
 			return true, nil
 		}
 	}
@@ -278,7 +1251,7 @@ func (db *Products) tableExists(name string) (bool, error) {
 
 // listTables - local helper function that lists all DynamoDB tables.
 func (db *Products) listTables() error {
-	result, err := db.ListTables(&dynamodb.ListTablesInput{})
+	result, err := db.ListTables(context.Background(), &dynamodb.ListTablesInput{})
 
 	if err != nil {
 		fmt.Println("Error during ListTables:")
@@ -289,7 +1262,7 @@ func (db *Products) listTables() error {
 	fmt.Println("")
 
 	for _, n := range result.TableNames {
-		fmt.Println(*n)
+		fmt.Println(n)
 	}
 	return nil
 }
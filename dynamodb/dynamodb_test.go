@@ -0,0 +1,150 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore/storetest"
+)
+
+/*
+The tests and benchmarks here run against DynamoDB Local: the one at $DYNAMODB_ENDPOINT if that's set, otherwise
+the one at the default endpoint if it's running, otherwise a container of localImage started for the run (and
+stopped after it). They're skipped if none of these is available, and in short mode.
+*/
+
+// localImage - the DynamoDB Local image started when there's no DynamoDB Local already running.
+const localImage = "amazon/dynamodb-local"
+
+// local - the DynamoDB Local used by this run, found on first use.
+var local struct {
+	once sync.Once
+	cfg  config.Config
+	err  error
+	// container - the ID of the container started for the run, if any.
+	container string
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if local.container != "" {
+		if err := exec.Command("docker", "stop", local.container).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error stopping DynamoDB Local container %v: %v\n", local.container, err)
+		}
+	}
+	os.Exit(code)
+}
+
+// errNoLocal - marks the errors finding DynamoDB Local that skip the tests, rather than failing them.
+type errNoLocal struct {
+	error
+}
+
+/*
+connectLocal - connects the package to DynamoDB Local for a test or benchmark, and returns the config it used. The
+barcode claims are switched on, as Initialize does, since the tests create tables themselves.
+*/
+func connectLocal(tb testing.TB) config.Config {
+	tb.Helper()
+	if testing.Short() {
+		tb.Skip("DynamoDB Local tests are skipped in short mode")
+	}
+	local.once.Do(func() {
+		if local.cfg, local.err = findLocal(); local.err == nil {
+			local.err = Connect(local.cfg)
+			uniqueAttrs = []uniqueAttr{barcodeClaims}
+		}
+	})
+	if _, ok := local.err.(errNoLocal); ok {
+		tb.Skip(local.err)
+	}
+	if local.err != nil {
+		tb.Fatal(local.err)
+	}
+	return local.cfg
+}
+
+// findLocal - the config for the DynamoDB Local to use, starting one if need be.
+func findLocal() (config.Config, error) {
+	cfg := config.Default()
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		cfg.DynamoDB.Endpoint = endpoint
+		return cfg, nil
+	}
+	if answers(cfg.DynamoDB.ResolvedEndpoint()) {
+		return cfg, nil
+	}
+	endpoint, err := startLocal()
+	if err != nil {
+		return cfg, errNoLocal{fmt.Errorf("DynamoDB Local isn't running at %v, and couldn't be started (%v); set DYNAMODB_ENDPOINT to use another", cfg.DynamoDB.ResolvedEndpoint(), err)}
+	}
+	cfg.DynamoDB.Endpoint = endpoint
+	return cfg, nil
+}
+
+// answers - whether something answers HTTP requests at endpoint; DynamoDB Local refuses a bare GET, but it answers.
+func answers(endpoint string) bool {
+	client := http.Client{Timeout: time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// startLocal - starts DynamoDB Local in a container, in memory and on a free port, and waits for it to answer.
+func startLocal() (string, error) {
+	out, err := exec.Command("docker", "run", "--detach", "--rm", "--publish", "127.0.0.1::8000", localImage,
+		"-jar", "DynamoDBLocal.jar", "-inMemory", "-sharedDb").Output()
+	if err != nil {
+		return "", fmt.Errorf("docker run: %v", err)
+	}
+	local.container = strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", local.container, "8000/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("docker port: %v", err)
+	}
+	// One line per address the port is published on.
+	endpoint := "http://" + strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+		if answers(endpoint) {
+			return endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("DynamoDB Local didn't start answering at %v", endpoint)
+}
+
+/*
+backend - the package as a storetest.Backend. Each catalog is a tenant with its own tables, created empty for a test
+and dropped when it finishes, so a run never touches tables it didn't create.
+*/
+func backend(tb testing.TB) storetest.Backend {
+	cfg := connectLocal(tb)
+	return storetest.Backend{
+		Store: &Items,
+		Open: func(ctx context.Context) (func() error, error) {
+			if err := CreateTables(ctx, cfg); err != nil {
+				return nil, err
+			}
+			return func() error { return DropTables(ctx) }, nil
+		},
+	}
+}
+
+func TestDatastore(t *testing.T) {
+	storetest.Run(t, backend(t))
+}
@@ -0,0 +1,261 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// filterAttributes - the attribute each field of a filter expression is compared with. Names are compared in lower
+// case, so through name_lower.
+var filterAttributes = map[string]string{
+	datastore.FieldName:     nameLowerAttribute,
+	datastore.FieldPrice:    "Price",
+	datastore.FieldBarcode:  BarcodeAttribute,
+	datastore.FieldSupplier: SupplierAttribute,
+	datastore.FieldCategory: CategoryAttribute,
+}
+
+/*
+filterBuilder - translates a datastore.Expr into a DynamoDB FilterExpression. DynamoDB has begins_with and contains
+but nothing to match the end of a string, so not every wildcard translates exactly. Where one doesn't, the
+translation matches more than the expression does, and exact is cleared so the caller knows to check the items read
+with Match as well.
+*/
+type filterBuilder struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+	exact  bool
+}
+
+func newFilterBuilder() *filterBuilder {
+	return &filterBuilder{names: map[string]string{}, values: map[string]types.AttributeValue{}, exact: true}
+}
+
+// value - a new placeholder for v.
+func (b *filterBuilder) value(v types.AttributeValue) string {
+	placeholder := ":f" + strconv.Itoa(len(b.values))
+	b.values[placeholder] = v
+	return placeholder
+}
+
+// attribute - the placeholder for a field's attribute.
+func (b *filterBuilder) attribute(field string) string {
+	placeholder := "#f" + strings.ReplaceAll(field, "_", "")
+	b.names[placeholder] = filterAttributes[field]
+	return placeholder
+}
+
+// build - the condition for e, or "" if every item satisfies it (or may, as far as DynamoDB can tell).
+func (b *filterBuilder) build(e datastore.Expr) string {
+	switch e := e.(type) {
+	case datastore.And:
+		conds := []string{}
+		for _, x := range e {
+			if cond := b.build(x); cond != "" {
+				conds = append(conds, cond)
+			}
+		}
+		return join(conds, " AND ")
+	case datastore.Or:
+		conds := []string{}
+		for _, x := range e {
+			cond := b.build(x)
+			if cond == "" {
+				return ""
+			}
+			conds = append(conds, cond)
+		}
+		return join(conds, " OR ")
+	case datastore.Comparison:
+		if e.Field == datastore.FieldPrice {
+			return b.price(e)
+		}
+		return b.match(e)
+	}
+	return ""
+}
+
+// price - the condition for a price comparison; these translate exactly.
+func (b *filterBuilder) price(c datastore.Comparison) string {
+	attr := b.attribute(c.Field)
+	amounts := make([]string, len(c.Amounts))
+	for i, amount := range c.Amounts {
+		amounts[i] = b.value(&types.AttributeValueMemberN{Value: amount.String()})
+	}
+	switch c.Op {
+	case datastore.OpNotEqual:
+		return attr + " <> " + amounts[0]
+	case datastore.OpGreater:
+		return attr + " > " + amounts[0]
+	case datastore.OpGreaterEqual:
+		return attr + " >= " + amounts[0]
+	case datastore.OpLess:
+		return attr + " < " + amounts[0]
+	case datastore.OpLessEqual:
+		return attr + " <= " + amounts[0]
+	case datastore.OpIn:
+		return attr + " IN (" + strings.Join(amounts, ", ") + ")"
+	case datastore.OpNotIn:
+		return "NOT (" + attr + " IN (" + strings.Join(amounts, ", ") + "))"
+	}
+	return attr + " = " + amounts[0]
+}
+
+// match - the condition for a string comparison: any of its patterns matching, or for != and =out=, none of them.
+func (b *filterBuilder) match(c datastore.Comparison) string {
+	attr := b.attribute(c.Field)
+	conds := []string{}
+	for _, v := range c.Values {
+		if c.Field == datastore.FieldName {
+			v = strings.ToLower(v)
+		}
+		cond, exact := b.pattern(attr, v)
+		if !exact {
+			b.exact = false
+		}
+		switch {
+		case c.Negated() && exact && cond != "":
+			conds = append(conds, "NOT ("+cond+")")
+		case c.Negated():
+			// Not matching something that may match, or that always does, isn't narrowed down here.
+			b.exact = false
+		case cond == "":
+			return ""
+		default:
+			conds = append(conds, cond)
+		}
+	}
+	if c.Negated() {
+		return join(conds, " AND ")
+	}
+	return join(conds, " OR ")
+}
+
+/*
+pattern - the condition for an attribute matching a pattern, and whether it's exact. The text before the first "*"
+is matched with begins_with and every other piece with contains, which is exact for "abc", "abc*" and "*abc*", but
+for "*abc" or "a*b" also matches strings that merely contain the pieces.
+*/
+func (b *filterBuilder) pattern(attr, pattern string) (string, bool) {
+	if !strings.Contains(pattern, "*") {
+		if pattern == "" {
+			// Empty values aren't stored, so an empty string is a missing attribute.
+			return "attribute_not_exists(" + attr + ")", true
+		}
+		return attr + " = " + b.value(&types.AttributeValueMemberS{Value: pattern}), true
+	}
+	parts := strings.Split(pattern, "*")
+	conds, pieces := []string{}, 0
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		pieces++
+		v := b.value(&types.AttributeValueMemberS{Value: part})
+		if i == 0 {
+			conds = append(conds, "begins_with("+attr+", "+v+")")
+		} else {
+			conds = append(conds, "contains("+attr+", "+v+")")
+		}
+	}
+	return join(conds, " AND "), pieces <= 1 && parts[len(parts)-1] == ""
+}
+
+// join - local helper function that joins conditions, parenthesized when there are several.
+func join(conds []string, op string) string {
+	switch len(conds) {
+	case 0:
+		return ""
+	case 1:
+		return conds[0]
+	}
+	return "(" + strings.Join(conds, op) + ")"
+}
+
+/*
+liveFilter - a FilterExpression selecting the live items that satisfy expr, with its placeholders, and whether it
+selects exactly those (otherwise the items read have to be checked with expr.Match).
+*/
+func liveFilter(expr datastore.Expr) (string, map[string]string, map[string]types.AttributeValue, bool) {
+	b := newFilterBuilder()
+	b.names["#exp"] = ExpiresAtAttribute
+	b.values[":now"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)}
+	filter := "(attribute_not_exists(#exp) OR #exp > :now)"
+	if cond := b.build(expr); cond != "" {
+		filter += " AND " + cond
+	}
+	// DynamoDB refuses placeholders the expression doesn't use, such as those of a condition that was dropped.
+	used := map[string]bool{}
+	for _, placeholder := range filterPlaceholder.FindAllString(filter, -1) {
+		used[placeholder] = true
+	}
+	for k := range b.names {
+		if !used[k] {
+			delete(b.names, k)
+		}
+	}
+	for k := range b.values {
+		if !used[k] {
+			delete(b.values, k)
+		}
+	}
+	return filter, b.names, b.values, b.exact
+}
+
+// filterPlaceholder - matches the attribute name and value placeholders in a FilterExpression.
+var filterPlaceholder = regexp.MustCompile(`[#:][A-Za-z0-9_]+`)
+
+/*
+FilterProducts - a (parallel) Scan with the expression as its FilterExpression, so DynamoDB only returns the items
+that match (though it still reads, and charges for, every one). Matches that it can't narrow down exactly are checked
+here, so the fields compared are read whatever fields were asked for.
+*/
+func (db Products) FilterProducts(ctx context.Context, expr datastore.Expr) ([]Product, error) {
+	if fields := datastore.Fields(ctx); fields != nil {
+		ctx = datastore.WithFields(ctx, append(append([]string{}, fields...), datastore.ExprFields(expr)...))
+	}
+	filter, names, values, _ := liveFilter(expr)
+	projected, projectedNames := projection(ctx)
+	for k, v := range projectedNames {
+		names[k] = v
+	}
+
+	products := []Product{}
+	err := parallelScan(ctx, "FilterProducts", &dynamodb.ScanInput{
+		TableName:                 aws.String(tableName(ctx)),
+		ConsistentRead:            consistentRead(ctx),
+		FilterExpression:          aws.String(filter),
+		ProjectionExpression:      projected,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}, func(items []map[string]types.AttributeValue) error {
+		for _, item := range items {
+			p, err := unmarshalProduct(item)
+			if err != nil {
+				return fmt.Errorf("Unmarshalling FilterProducts failed:\n%v", err)
+			}
+			if !p.Expired() && expr.Match(p) {
+				products = append(products, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	datastore.SortProducts(products, datastore.DefaultSort)
+	return products, nil
+}
@@ -0,0 +1,264 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// replicaWait - how long to wait for a new replica to become active; it's filled with a copy of the whole table.
+const replicaWait = 30 * time.Minute
+
+// replicaPoll - how often a replica being created is checked on.
+const replicaPoll = 10 * time.Second
+
+// homeRegion - the region every write goes to.
+var homeRegion string
+
+// replicationLag - how long after this instance writes to a tenant's tables its reads of them stay in homeRegion.
+var replicationLag time.Duration
+
+// replicaReads - whether reads go to a replica in another region than homeRegion.
+var replicaReads bool
+
+// recentWrites - when this instance last wrote to each tenant's tables.
+var recentWrites sync.Map
+
+// writeOperations - the DynamoDB operations that write items.
+var writeOperations = map[string]bool{
+	"PutItem": true, "UpdateItem": true, "DeleteItem": true, "BatchWriteItem": true, "TransactWriteItems": true,
+}
+
+/*
+readerFor - the client for the context's reads: reads, unless it's another region's replica and the read must see
+the latest writes. That's the case when the read is strongly consistent, which a replica can only be with writes
+made in its own region, and when this instance wrote to the tenant's tables within the replication lag, so that it
+reads its own writes. Another instance's writes can still take that long to be seen.
+*/
+func readerFor(ctx context.Context) reader {
+	if replicaReads && (aws.ToBool(consistentRead(ctx)) || wroteRecently(ctx)) {
+		return Items.Client
+	}
+	return reads
+}
+
+// wroteRecently - whether this instance wrote to the context's tenant's tables within the replication lag.
+func wroteRecently(ctx context.Context) bool {
+	at, ok := recentWrites.Load(datastore.Tenant(ctx))
+	return ok && time.Since(at.(time.Time)) < replicationLag
+}
+
+// noteWrites - a client option that records when each tenant's tables are written to, for wroteRecently.
+func noteWrites(o *dynamodb.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("NoteWrites", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if writeOperations[awsmiddleware.GetOperationName(ctx)] {
+				recentWrites.Store(datastore.Tenant(ctx), time.Now())
+			}
+			return out, metadata, err
+		}), middleware.After)
+	})
+}
+
+// checkGlobalTable - local helper function that rejects global table settings the app can't use.
+func checkGlobalTable(cfg config.DynamoDB, home string) error {
+	g := cfg.GlobalTable
+	switch {
+	case !g.Enabled:
+		return nil
+	case cfg.Target == config.DynamoDBLocal:
+		return fmt.Errorf("Global tables aren't available on DynamoDB Local")
+	case len(g.Replicas) == 0:
+		return fmt.Errorf("A global table needs at least one replica region")
+	case types.BillingMode(cfg.BillingMode) != types.BillingModePayPerRequest:
+		// Provisioned replicas would need write auto scaling on every table, not just Products.
+		return fmt.Errorf("Global tables need the PAY_PER_REQUEST billing mode")
+	case g.ReadRegion != "" && cfg.DAXEndpoint != "":
+		return fmt.Errorf("A global table's read region can't be used with DAX; use a DAX cluster in the region to read from")
+	case slices.Contains(g.Replicas, home):
+		return fmt.Errorf("Replica region %v is the home region", home)
+	}
+	if r := g.ReadRegion; r != "" && r != config.ReadNearest && r != home && !slices.Contains(g.Replicas, r) {
+		return fmt.Errorf("Read region %v is neither the home region, %v, nor a replica", r, home)
+	}
+	return nil
+}
+
+// replicaClient - local helper function that creates a DynamoDB client for the tables' replicas in a region.
+func replicaClient(awsCfg aws.Config, cfg config.DynamoDB, region string) *dynamodb.Client {
+	return dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		o.Region = region
+		// An emulator serves every region from its one endpoint.
+		if cfg.Emulated() {
+			o.BaseEndpoint = aws.String(cfg.ResolvedEndpoint())
+		}
+	})
+}
+
+/*
+nearestRegion - local helper function that finds which of the home region and the replicas answers fastest. Each
+is asked twice and the second answer timed, so that connecting doesn't count. Regions that can't be reached are
+skipped.
+*/
+func nearestRegion(ctx context.Context, awsCfg aws.Config, cfg config.DynamoDB) string {
+	nearest, best := homeRegion, time.Duration(0)
+	for _, region := range append([]string{homeRegion}, cfg.GlobalTable.Replicas...) {
+		client := replicaClient(awsCfg, cfg, region)
+		input := &dynamodb.ListTablesInput{Limit: aws.Int32(1)}
+		if _, err := client.ListTables(ctx, input); err != nil {
+			log.Printf("Region %v can't be reached: %v", region, err)
+			continue
+		}
+		start := time.Now()
+		if _, err := client.ListTables(ctx, input); err != nil {
+			log.Printf("Region %v can't be reached: %v", region, err)
+			continue
+		}
+		if took := time.Since(start); best == 0 || took < best {
+			nearest, best = region, took
+		}
+	}
+	return nearest
+}
+
+// routeReads - local helper function that points reads at the configured read region's replicas.
+func routeReads(ctx context.Context, awsCfg aws.Config, cfg config.DynamoDB) error {
+	homeRegion = awsCfg.Region
+	replicationLag = cfg.GlobalTable.ReplicationLag.Duration
+	replicaReads = false
+	if err := checkGlobalTable(cfg, homeRegion); err != nil || !cfg.GlobalTable.Enabled {
+		return err
+	}
+
+	region := cfg.GlobalTable.ReadRegion
+	if region == config.ReadNearest {
+		region = nearestRegion(ctx, awsCfg, cfg)
+	}
+	if region == "" || region == homeRegion {
+		return nil
+	}
+	reads = replicaClient(awsCfg, cfg, region)
+	replicaReads = true
+	fmt.Printf("Reading from the replicas in %v; writing to %v\n", region, homeRegion)
+	return nil
+}
+
+/*
+replicateTables - local helper function that makes tables global, replicated to every configured region, adding
+the replicas they don't have yet and waiting until they're active. Replicas in other regions are left in place.
+*/
+func replicateTables(ctx context.Context, cfg config.DynamoDB, tables []string) error {
+	if !cfg.GlobalTable.Enabled {
+		return nil
+	}
+	for _, table := range tables {
+		if err := replicateTable(ctx, cfg, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicateTable - local helper function that adds a table's missing replicas, one at a time, as DynamoDB requires.
+func replicateTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	result, err := Items.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("DescribeTable failed: %v", err)
+	}
+	if spec := result.Table.StreamSpecification; spec != nil && aws.ToBool(spec.StreamEnabled) && spec.StreamViewType != types.StreamViewTypeNewAndOldImages {
+		if err := restream(ctx, table); err != nil {
+			return err
+		}
+	}
+
+	have := map[string]bool{}
+	for _, r := range result.Table.Replicas {
+		have[aws.ToString(r.RegionName)] = true
+	}
+	for _, region := range cfg.GlobalTable.Replicas {
+		if have[region] {
+			continue
+		}
+		fmt.Printf("Replicating table '%v' to %v...\n", table, region)
+		_, err := Items.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:      aws.String(table),
+			ReplicaUpdates: []types.ReplicationGroupUpdate{{Create: &types.CreateReplicationGroupMemberAction{RegionName: aws.String(region)}}},
+		})
+		if err != nil {
+			return fmt.Errorf("Replicating table %v to %v failed: %v", table, region, err)
+		}
+		if err := waitForReplicas(ctx, table); err != nil {
+			return err
+		}
+	}
+	for region := range have {
+		if region != homeRegion && !slices.Contains(cfg.GlobalTable.Replicas, region) {
+			log.Printf("Table %v also has a replica in %v, which isn't configured; it's left in place", table, region)
+		}
+	}
+	return nil
+}
+
+// waitForReplicas - local helper function that waits (up to replicaWait) until a table and all its replicas are active.
+func waitForReplicas(ctx context.Context, table string) error {
+	deadline := time.Now().Add(replicaWait)
+	for {
+		result, err := Items.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return fmt.Errorf("DescribeTable failed: %v", err)
+		}
+		active := result.Table.TableStatus == types.TableStatusActive
+		for _, r := range result.Table.Replicas {
+			switch r.ReplicaStatus {
+			case types.ReplicaStatusActive:
+			case types.ReplicaStatusCreationFailed:
+				return fmt.Errorf("Creating the replica of %v in %v failed: %v", table, aws.ToString(r.RegionName), aws.ToString(r.ReplicaStatusDescription))
+			default:
+				active = false
+			}
+		}
+		if active {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Waiting for the replicas of %v timed out", table)
+		}
+		if err := sleep(ctx, replicaPoll); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+restream - local helper function that switches a table's stream to new and old images, which replication needs, by
+turning it off and on again. Tables created before streams kept old images have the other kind. The old stream's
+records can still be read for 24 hours, but FollowChanges reads the new one from its next start.
+*/
+func restream(ctx context.Context, table string) error {
+	waiter := dynamodb.NewTableExistsWaiter(Items)
+	for _, spec := range []*types.StreamSpecification{{StreamEnabled: aws.Bool(false)}, streamSpecification} {
+		if _, err := Items.UpdateTable(ctx, &dynamodb.UpdateTableInput{TableName: aws.String(table), StreamSpecification: spec}); err != nil {
+			return fmt.Errorf("Updating the stream on %v failed: %v", table, err)
+		}
+		if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, tableWait); err != nil {
+			return fmt.Errorf("Waiting for table %v failed: %v", table, err)
+		}
+	}
+	return nil
+}
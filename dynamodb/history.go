@@ -0,0 +1,158 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// PriceHistoryTableName - name for the table recording each Product's prices over time. Like the Products table, each
+// tenant has its own, e.g. "acme.PriceHistory".
+const PriceHistoryTableName = "PriceHistory"
+
+// Price history attributes. Items are keyed by the Product ID (always a string, whatever the ID strategy) and the
+// time of the change in Unix nanoseconds, so a Product's history reads back in order.
+const (
+	historyIdAttribute    = "product_id"
+	historyTimeAttribute  = "changed_at"
+	historyPriceAttribute = "price"
+)
+
+// historyTable - the price history table belonging to a Products table.
+func historyTable(table string) string {
+	return siblingTable(table, PriceHistoryTableName)
+}
+
+// historyItem - the price history item recording that a Product's price became price at the given time.
+func historyItem(id string, price datastore.Money, at time.Time) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		historyIdAttribute:    &types.AttributeValueMemberS{Value: id},
+		historyTimeAttribute:  &types.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixNano(), 10)},
+		historyPriceAttribute: &types.AttributeValueMemberN{Value: price.String()},
+	}
+}
+
+// historyPut - the transaction item recording a Product's current price, to go with the write that set it.
+func historyPut(ctx context.Context, p Product) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName: aws.String(historyTable(tableName(ctx))),
+		Item:      historyItem(p.Id, p.Price, time.Now().UTC()),
+	}}
+}
+
+/*
+recordPrices - adds the starting prices of Products that were added together. A bulk add already fills a whole
+transaction, so these are written afterwards; the Products exist by then, so a failure is logged rather than
+returned.
+*/
+func recordPrices(ctx context.Context, products []Product) {
+	table := historyTable(tableName(ctx))
+	at := time.Now().UTC()
+	for start := 0; start < len(products); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(products) {
+			end = len(products)
+		}
+		writes := make([]types.WriteRequest, 0, end-start)
+		for _, p := range products[start:end] {
+			writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: historyItem(p.Id, p.Price, at)}})
+		}
+		if err := batchWrite(ctx, map[string][]types.WriteRequest{table: writes}); err != nil {
+			log.Printf("Price history for products %v-%v could not be recorded: %v", start, end-1, err)
+		}
+	}
+}
+
+// PriceHistory - every price the Product has had, oldest first.
+func (db Products) PriceHistory(ctx context.Context, id string) ([]datastore.PricePoint, error) {
+	pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+		TableName:                aws.String(historyTable(tableName(ctx))),
+		KeyConditionExpression:   aws.String("#id = :id"),
+		ExpressionAttributeNames: map[string]string{"#id": historyIdAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+
+	history := []datastore.PricePoint{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query PriceHistory failed:\n%w", unavailable(err))
+		}
+		for _, item := range page.Items {
+			t, _ := item[historyTimeAttribute].(*types.AttributeValueMemberN)
+			p, _ := item[historyPriceAttribute].(*types.AttributeValueMemberN)
+			if t == nil || p == nil {
+				continue
+			}
+			nanos, err := strconv.ParseInt(t.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling PriceHistory failed:\n%v", err)
+			}
+			price, err := datastore.RoundMoney(p.Value)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling PriceHistory failed:\n%v", err)
+			}
+			history = append(history, datastore.PricePoint{Price: price, ChangedAt: time.Unix(0, nanos).UTC()})
+		}
+	}
+	return history, nil
+}
+
+// createHistoryTable - local helper function that creates a price history table, if it doesn't exist.
+func createHistoryTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, table, historyIdAttribute, historyTimeAttribute, types.ScalarAttributeTypeN)
+}
+
+/*
+createChildTable - local helper function that creates a table of records belonging to Products, if it doesn't exist,
+and waits for it. Records are partitioned by the Product ID attribute and sorted by sortKey; with no sortKey, the
+first attribute is the whole key.
+*/
+func createChildTable(ctx context.Context, cfg config.DynamoDB, table, productKey, sortKey string, sortType types.ScalarAttributeType) error {
+	exists, err := Items.tableExists(table)
+	if err != nil || exists {
+		return err
+	}
+
+	fmt.Printf("Creating table '%v'...\n", table)
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(productKey), KeyType: types.KeyTypeHash},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(productKey), AttributeType: types.ScalarAttributeTypeS},
+		},
+	}
+	if sortKey != "" {
+		input.KeySchema = append(input.KeySchema, types.KeySchemaElement{AttributeName: aws.String(sortKey), KeyType: types.KeyTypeRange})
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{AttributeName: aws.String(sortKey), AttributeType: sortType})
+	}
+	if err := setBilling(input, cfg, cfg.ReadCapacity, cfg.WriteCapacity); err != nil {
+		return err
+	}
+	var inUse *types.ResourceInUseException
+	if _, err := Items.CreateTable(ctx, input); err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("Error creating table %v: %v", table, err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(Items)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, tableWait); err != nil {
+		return fmt.Errorf("Waiting for table %v failed: %v", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/migrate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SchemaTableName - name for the table recording which migrations have been applied to each Products table.
+const SchemaTableName = "SchemaVersions"
+
+/*
+migrations - a Products table's schema history. Add new steps to the end; never change or reorder ones that
+have shipped.
+*/
+func migrations(cfg config.DynamoDB, table string) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "add " + NameIndex,
+			Up:          func(ctx context.Context) error { return ensureNameIndex(cfg, table) },
+		},
+		{
+			Version:     2,
+			Description: "backfill " + NameIndex + " keys for items written before the index",
+			Up:          func(ctx context.Context) error { return backfillNameKeys(ctx, table) },
+		},
+		{
+			Version:     3,
+			Description: "enable TTL on " + ExpiresAtAttribute,
+			Up:          func(ctx context.Context) error { return enableTTL(table) },
+		},
+		{
+			Version:     4,
+			Description: "add the " + PriceHistoryTableName + " table",
+			Up:          func(ctx context.Context) error { return createHistoryTable(ctx, cfg, historyTable(table)) },
+		},
+		{
+			Version:     5,
+			Description: "add the " + ReviewsTableName + " table",
+			Up:          func(ctx context.Context) error { return createReviewsTable(ctx, cfg, reviewsTable(table)) },
+		},
+		{
+			Version:     6,
+			Description: "add the " + VariantsTableName + " table",
+			Up:          func(ctx context.Context) error { return createVariantsTable(ctx, cfg, variantsTable(table)) },
+		},
+		{
+			Version:     7,
+			Description: "add the " + OrdersTableName + " table",
+			Up:          func(ctx context.Context) error { return createOrdersTable(ctx, cfg, ordersTable(table)) },
+		},
+		{
+			Version:     8,
+			Description: "add the " + CartsTableName + " table",
+			Up:          func(ctx context.Context) error { return createCartsTable(ctx, cfg, cartsTable(table)) },
+		},
+		{
+			Version:     9,
+			Description: "add the " + ReservationsTableName + " table",
+			Up:          func(ctx context.Context) error { return createReservationsTable(ctx, cfg, reservationsTable(table)) },
+		},
+		{
+			Version:     10,
+			Description: "add " + BarcodeIndex,
+			Up: func(ctx context.Context) error {
+				return ensureIndex(table, barcodeIndex(cfg), barcodeAttributeDefinitions())
+			},
+		},
+		{
+			// Seeding a new table happens before its migrations run, so this also records the seeded barcodes.
+			Version:     11,
+			Description: "add the " + BarcodesTableName + " table and record the barcodes in use",
+			Up: func(ctx context.Context) error {
+				if err := barcodeClaims.createTable(ctx, cfg, table); err != nil {
+					return err
+				}
+				return barcodeClaims.recordExisting(ctx, table)
+			},
+		},
+		{
+			// The names in use are claimed on start-up while unique names are configured, not here.
+			Version:     12,
+			Description: "add the " + NamesTableName + " table",
+			Up:          func(ctx context.Context) error { return nameClaims.createTable(ctx, cfg, table) },
+		},
+		{
+			Version:     13,
+			Description: "add the " + ChangesTableName + " table",
+			Up:          func(ctx context.Context) error { return createChangesTable(ctx, cfg, changesTable(table)) },
+		},
+		{
+			Version:     14,
+			Description: "enable the table's stream, for the change feed",
+			Up:          func(ctx context.Context) error { return enableStream(ctx, table) },
+		},
+		{
+			Version:     15,
+			Description: "add the " + OutboxTableName + " table",
+			Up:          func(ctx context.Context) error { return createOutboxTable(ctx, cfg, outboxTable(table)) },
+		},
+		{
+			// Orders keep the prices they were written with; they are rounded as they're read.
+			Version:     16,
+			Description: "rewrite prices stored as floats as exact decimals",
+			Up: func(ctx context.Context) error {
+				if err := rewritePrices(ctx, table, "Price", IdAttribute); err != nil {
+					return err
+				}
+				if err := rewritePrices(ctx, variantsTable(table), "price", variantProductAttribute, variantIdAttribute); err != nil {
+					return err
+				}
+				return rewritePrices(ctx, historyTable(table), historyPriceAttribute, historyIdAttribute, historyTimeAttribute)
+			},
+		},
+	}
+}
+
+// schemaVersions - the VersionStore for a Products table, kept as an item named after it in the SchemaVersions table.
+type schemaVersions struct {
+	table string
+}
+
+func (v schemaVersions) SchemaVersion(ctx context.Context) (int, error) {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(envTable(SchemaTableName)),
+		Key:            map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: v.table}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, err
+	}
+	value, ok := result.Item["version"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	return strconv.Atoi(value.Value)
+}
+
+func (v schemaVersions) SetSchemaVersion(ctx context.Context, version int) error {
+	_, err := Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(envTable(SchemaTableName)),
+		Key:                      map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: v.table}},
+		UpdateExpression:         aws.String("SET #v = :v, applied_at = :t"),
+		ConditionExpression:      aws.String("attribute_not_exists(#v) OR #v < :v"),
+		ExpressionAttributeNames: map[string]string{"#v": "version"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":v": &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+			":t": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	// Another instance got there first.
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// migrateSchema - creates the SchemaVersions table if needed, then applies any outstanding migrations to a table.
+func migrateSchema(ctx context.Context, cfg config.DynamoDB, table string) error {
+	exists, err := Items.tableExists(envTable(SchemaTableName))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		input := &dynamodb.CreateTableInput{
+			TableName: aws.String(envTable(SchemaTableName)),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("name"), KeyType: types.KeyTypeHash},
+			},
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("name"), AttributeType: types.ScalarAttributeTypeS},
+			},
+		}
+		if err := setBilling(input, cfg, 1, 1); err != nil {
+			return err
+		}
+		var inUse *types.ResourceInUseException
+		if _, err := Items.CreateTable(ctx, input); err != nil && !errors.As(err, &inUse) {
+			return fmt.Errorf("Error creating table %v: %v", envTable(SchemaTableName), err)
+		}
+		waiter := dynamodb.NewTableExistsWaiter(Items)
+		if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(envTable(SchemaTableName))}, tableWait); err != nil {
+			return fmt.Errorf("Waiting for table %v failed: %v", envTable(SchemaTableName), err)
+		}
+	}
+
+	return migrate.Run(ctx, schemaVersions{table}, migrations(cfg, table))
+}
+
+// backfillNameKeys - adds the NameIndex keys to named items that don't have them, so they can be found by name.
+func backfillNameKeys(ctx context.Context, table string) error {
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{
+		TableName:                aws.String(table),
+		FilterExpression:         aws.String("attribute_exists(#n) AND attribute_not_exists(#l)"),
+		ProjectionExpression:     aws.String("#id, #n"),
+		ExpressionAttributeNames: map[string]string{"#id": IdAttribute, "#n": "Name", "#l": nameLowerAttribute},
+	})
+
+	updated := 0
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			name, ok := item["Name"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			bucket, lower := nameKeys(name.Value)
+			if bucket == "" {
+				continue
+			}
+
+			// The condition skips items deleted since the scan, rather than recreating them.
+			_, err := Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:           aws.String(table),
+				Key:                 map[string]types.AttributeValue{IdAttribute: item[IdAttribute]},
+				UpdateExpression:    aws.String("SET #b = :b, #l = :l"),
+				ConditionExpression: aws.String("attribute_exists(#id)"),
+				ExpressionAttributeNames: map[string]string{
+					"#id": IdAttribute, "#b": nameBucketAttribute, "#l": nameLowerAttribute,
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":b": &types.AttributeValueMemberS{Value: bucket},
+					":l": &types.AttributeValueMemberS{Value: lower},
+				},
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if err != nil && !errors.As(err, &conditionFailed) {
+				return err
+			}
+			updated++
+		}
+	}
+	fmt.Printf("Backfilled name keys on %v items\n", updated)
+	return nil
+}
+
+/*
+rewritePrices - rewrites the prices in a table that were written as floats, such as 0.980000, as the exact amounts
+they stand for (0.98). Items are identified by the key attributes given.
+*/
+func rewritePrices(ctx context.Context, table, price string, keys ...string) error {
+	names := map[string]string{"#p": price}
+	projection := []string{"#p"}
+	for i, key := range keys {
+		placeholder := fmt.Sprintf("#k%v", i)
+		names[placeholder] = key
+		projection = append(projection, placeholder)
+	}
+	pages := dynamodb.NewScanPaginator(Items, &dynamodb.ScanInput{
+		TableName:                aws.String(table),
+		FilterExpression:         aws.String("attribute_exists(#p)"),
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: names,
+	})
+
+	updated := 0
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			stored, ok := item[price].(*types.AttributeValueMemberN)
+			if !ok {
+				continue
+			}
+			amount, err := datastore.RoundMoney(stored.Value)
+			if err != nil {
+				return fmt.Errorf("Invalid price in %v: %v", table, err)
+			}
+			if amount.String() == stored.Value {
+				continue
+			}
+
+			key := map[string]types.AttributeValue{}
+			for _, k := range keys {
+				key[k] = item[k]
+			}
+			// The condition skips items deleted or repriced since the scan.
+			_, err = Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                aws.String(table),
+				Key:                      key,
+				UpdateExpression:         aws.String("SET #p = :new"),
+				ConditionExpression:      aws.String("#p = :old"),
+				ExpressionAttributeNames: map[string]string{"#p": price},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":old": stored,
+					":new": &types.AttributeValueMemberN{Value: amount.String()},
+				},
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if err != nil && !errors.As(err, &conditionFailed) {
+				return err
+			}
+			updated++
+		}
+	}
+	fmt.Printf("Rewrote %v prices in %v\n", updated, table)
+	return nil
+}
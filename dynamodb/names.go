@@ -0,0 +1,166 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// NameIndex - the global secondary index used for name lookups and prefix searches.
+//
+// A prefix search needs the name in the index's sort key, and Query needs an exact partition key, so items are
+// partitioned by the first letter of their lowercased name (name_bucket) and sorted by the lowercased name
+// (name_lower). Lookups are therefore case-insensitive. Products without a name aren't indexed.
+const NameIndex = "NameIndex"
+
+// NamesTableName - name for the table recording which Product holds each name when names are unique, e.g. "acme.Names".
+const NamesTableName = "Names"
+
+const (
+	nameBucketAttribute = "name_bucket"
+	nameLowerAttribute  = "name_lower"
+)
+
+// nameKeys - the NameIndex key values for a name; both are empty if the name is.
+func nameKeys(name string) (bucket, lower string) {
+	lower = strings.ToLower(name)
+	if lower == "" {
+		return "", ""
+	}
+	r, _ := utf8.DecodeRuneInString(lower)
+	return string(r), lower
+}
+
+// nameIndex - local helper function that describes NameIndex, with throughput matching the table's billing mode.
+func nameIndex(cfg config.DynamoDB) types.GlobalSecondaryIndex {
+	index := types.GlobalSecondaryIndex{
+		IndexName: aws.String(NameIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(nameBucketAttribute), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(nameLowerAttribute), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+	if types.BillingMode(cfg.BillingMode) != types.BillingModePayPerRequest {
+		index.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits: aws.Int64(cfg.ReadCapacity), WriteCapacityUnits: aws.Int64(cfg.WriteCapacity),
+		}
+	}
+	return index
+}
+
+// nameAttributeDefinitions - the attribute definitions NameIndex's keys need.
+func nameAttributeDefinitions() []types.AttributeDefinition {
+	return []types.AttributeDefinition{
+		{AttributeName: aws.String(nameBucketAttribute), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String(nameLowerAttribute), AttributeType: types.ScalarAttributeTypeS},
+	}
+}
+
+// ensureNameIndex - local helper function that adds NameIndex to a table created before the index existed.
+// Items written before then lack the index keys until backfillNameKeys adds them.
+func ensureNameIndex(cfg config.DynamoDB, table string) error {
+	return ensureIndex(table, nameIndex(cfg), nameAttributeDefinitions())
+}
+
+// ensureIndex - local helper function that adds a global secondary index to a table, if it doesn't have it yet.
+func ensureIndex(table string, index types.GlobalSecondaryIndex, definitions []types.AttributeDefinition) error {
+	name := aws.ToString(index.IndexName)
+	result, err := Items.DescribeTable(context.Background(), &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("DescribeTable failed: %v", err)
+	}
+	for _, existing := range result.Table.GlobalSecondaryIndexes {
+		if aws.ToString(existing.IndexName) == name {
+			return nil
+		}
+	}
+
+	fmt.Printf("Adding index '%v' to '%v'...\n", name, table)
+	_, err = Items.UpdateTable(context.Background(), &dynamodb.UpdateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: definitions,
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:             index.IndexName,
+				KeySchema:             index.KeySchema,
+				Projection:            index.Projection,
+				ProvisionedThroughput: index.ProvisionedThroughput,
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Adding index %v failed: %v", name, err)
+	}
+	return nil
+}
+
+// FindByName - responds with the Products whose name matches (ignoring case), in price-descending order.
+func (db Products) FindByName(ctx context.Context, name string) ([]Product, error) {
+	bucket, lower := nameKeys(name)
+	return queryNameIndex(ctx, "#b = :b AND #n = :n", bucket, lower)
+}
+
+// SearchByPrefix - responds with the Products whose name starts with prefix (ignoring case), in price-descending order.
+func (db Products) SearchByPrefix(ctx context.Context, prefix string) ([]Product, error) {
+	bucket, lower := nameKeys(prefix)
+	return queryNameIndex(ctx, "#b = :b AND begins_with(#n, :n)", bucket, lower)
+}
+
+// queryNameIndex - local helper function that runs a Query against NameIndex and collects every page of results.
+func queryNameIndex(ctx context.Context, condition, bucket, lower string) ([]Product, error) {
+	temp := []Product{}
+	if bucket == "" {
+		return temp, nil
+	}
+
+	expr, names := projection(ctx)
+	attrNames := map[string]string{
+		"#b": nameBucketAttribute,
+		"#n": nameLowerAttribute,
+	}
+	for k, v := range names {
+		attrNames[k] = v
+	}
+	pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+		TableName:                aws.String(tableName(ctx)),
+		IndexName:                aws.String(NameIndex),
+		KeyConditionExpression:   aws.String(condition),
+		ProjectionExpression:     expr,
+		ExpressionAttributeNames: attrNames,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":b": &types.AttributeValueMemberS{Value: bucket},
+			":n": &types.AttributeValueMemberS{Value: lower},
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query %v failed:\n%w", NameIndex, unavailable(err))
+		}
+		for _, i := range page.Items {
+			p, err := unmarshalProduct(i)
+			if err != nil {
+				return nil, fmt.Errorf("Unmarshalling %v results failed:\n%v", NameIndex, err)
+			}
+			if !p.Expired() {
+				temp = append(temp, p)
+			}
+		}
+	}
+
+	datastore.SortProducts(temp, datastore.DefaultSort)
+
+	return temp, nil
+}
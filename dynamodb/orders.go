@@ -0,0 +1,163 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Order = datastore.Order
+
+// OrdersTableName - name for the table holding orders; each tenant has its own, e.g. "acme.Orders".
+const OrdersTableName = "Orders"
+
+// orderIdAttribute - the key of the orders table; orders aren't partitioned by Product, since they can span several.
+const orderIdAttribute = "order_id"
+
+// ordersTable - the orders table belonging to a Products table.
+func ordersTable(table string) string {
+	return siblingTable(table, OrdersTableName)
+}
+
+// createOrdersTable - local helper function that creates an orders table, if it doesn't exist.
+func createOrdersTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, table, orderIdAttribute, "", "")
+}
+
+/*
+AddOrder - places the order in a single transaction with the stock updates for its lines, each conditioned on there
+being enough stock left: a variant's, or for a Product without variants that tracks stock, that of the locations its
+stock is taken from (see StockLevels.Allocate). Reserved lines delete their reservations instead, on condition that
+they haven't expired. Orders have at most 99 lines, to fit in one transaction; the Products' changes are logged
+afterwards, as there's no room for them.
+*/
+func (db *Products) AddOrder(ctx context.Context, order Order) error {
+	item, err := attributevalue.MarshalMap(order)
+	if err != nil {
+		return fmt.Errorf("Error marshalling order: %v", err)
+	}
+
+	wanted := map[string]int{}
+	for _, line := range order.Lines {
+		if line.ReservationId == "" && line.VariantId == "" {
+			wanted[line.ProductId] += line.Quantity
+		}
+	}
+	var takes []types.TransactWriteItem
+	var stocked []string
+	for id, quantity := range wanted {
+		take, err := takeProductStock(ctx, id, quantity)
+		if err != nil {
+			return fmt.Errorf("Order <%v> could not be placed: %w", order.Id, err)
+		}
+		if take != nil {
+			takes = append(takes, *take)
+			stocked = append(stocked, id)
+		}
+	}
+
+	table := tableName(ctx)
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:                aws.String(ordersTable(table)),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#o)"),
+		ExpressionAttributeNames: map[string]string{"#o": orderIdAttribute},
+	}}}
+	for _, line := range order.Lines {
+		if line.ReservationId != "" {
+			writes = append(writes, reservationUse(ctx, line.ReservationId))
+			continue
+		}
+		if line.VariantId != "" {
+			writes = append(writes, takeStock(ctx, line.ProductId, line.VariantId, line.Quantity))
+		}
+	}
+
+	if err := transactWrite(ctx, append(writes, takes...)); err != nil {
+		return fmt.Errorf("Order <%v> could not be placed; a product or variant may be out of stock or a reservation expired: %w", order.Id, err)
+	}
+	recordChanges(ctx, datastore.ChangeUpdated, stocked...)
+	return nil
+}
+
+/*
+takeProductStock - the transaction item taking quantity out of a Product's stock, from the locations Allocate chooses
+given the stock as read now, each conditioned on still holding what is taken. It's nil for a Product that doesn't
+track stock; a Product without enough is out of stock.
+*/
+func takeProductStock(ctx context.Context, id string, quantity int) (*types.TransactWriteItem, error) {
+	p, err := storedProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Expired() {
+		return nil, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+	}
+	if p.Stock == nil {
+		return nil, nil
+	}
+	taken, ok := p.Stock.Allocate(quantity)
+	if !ok {
+		return nil, datastore.Errorf("out_of_stock", "Product <%v> is out of stock: %w", id, datastore.ErrConflict)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	names := map[string]string{"#stock": StockAttribute, "#upd": UpdatedAtAttribute}
+	values := map[string]types.AttributeValue{":upd": &types.AttributeValueMemberN{Value: now}}
+	sets := []string{"#upd = :upd"}
+	conditions := []string{}
+	locations := make([]string, 0, len(taken))
+	for location := range taken {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for i, location := range locations {
+		loc, q := fmt.Sprintf("#l%v", i), fmt.Sprintf(":q%v", i)
+		names[loc] = location
+		values[q] = &types.AttributeValueMemberN{Value: strconv.Itoa(taken[location])}
+		sets = append(sets, fmt.Sprintf("#stock.%v = #stock.%v - %v", loc, loc, q))
+		conditions = append(conditions, fmt.Sprintf("#stock.%v >= %v", loc, q))
+	}
+	return &types.TransactWriteItem{Update: &types.Update{
+		TableName:                 aws.String(tableName(ctx)),
+		Key:                       map[string]types.AttributeValue{IdAttribute: keyValue(id)},
+		UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+		ConditionExpression:       aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}, nil
+}
+
+// GetOrder - if it exists, retrieves the requested order.
+func (db Products) GetOrder(ctx context.Context, order *Order) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(ordersTable(tableName(ctx))),
+		Key: map[string]types.AttributeValue{
+			orderIdAttribute: &types.AttributeValueMemberS{Value: order.Id},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("GetOrder failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return datastore.Errorf("order_not_found", "Order <%v> does not exist: %w", order.Id, datastore.ErrNotFound)
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, order); err != nil {
+		return fmt.Errorf("Unmarshalling GetOrder failed:\n%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// resourceTables - the tables of the registered resources that belong with a Products table.
+func resourceTables(table string) []string {
+	var tables []string
+	for _, r := range datastore.Resources() {
+		tables = append(tables, siblingTable(table, r.Table))
+	}
+	return tables
+}
+
+// createResourceTables - local helper function that creates the registered resources' tables, if they don't exist.
+func createResourceTables(ctx context.Context, cfg config.DynamoDB, table string) error {
+	for _, t := range resourceTables(table) {
+		if err := createChildTable(ctx, cfg, t, datastore.RecordID, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordsTable - the context's tenant's table of a resource's records.
+func recordsTable(ctx context.Context, resource string) (string, error) {
+	r, ok := datastore.LookupResource(resource)
+	if !ok {
+		return "", fmt.Errorf("Unknown resource %q", resource)
+	}
+	return siblingTable(tableName(ctx), r.Table), nil
+}
+
+// recordKey - the key of a record.
+func recordKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{datastore.RecordID: &types.AttributeValueMemberS{Value: id}}
+}
+
+// GetRecords - scans the resource's table for every record.
+func (db Products) GetRecords(ctx context.Context, resource string) ([]datastore.Record, error) {
+	table, err := recordsTable(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	pages := dynamodb.NewScanPaginator(readerFor(ctx), &dynamodb.ScanInput{
+		TableName:      aws.String(table),
+		ConsistentRead: consistentRead(ctx),
+	})
+
+	records := []datastore.Record{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Scan GetRecords failed:\n%w", unavailable(err))
+		}
+		for _, item := range page.Items {
+			var r datastore.Record
+			if err := attributevalue.UnmarshalMap(item, &r); err != nil {
+				return nil, fmt.Errorf("Unmarshalling GetRecords failed:\n%v", err)
+			}
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// GetRecord - if it exists, retrieves the resource's record with the given ID.
+func (db Products) GetRecord(ctx context.Context, resource, id string) (datastore.Record, error) {
+	table, err := recordsTable(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            recordKey(id),
+		ConsistentRead: consistentRead(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetRecord failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return nil, datastore.RecordNotFound(resource, id)
+	}
+	var r datastore.Record
+	if err := attributevalue.UnmarshalMap(result.Item, &r); err != nil {
+		return nil, fmt.Errorf("Unmarshalling GetRecord failed:\n%v", err)
+	}
+	return r, nil
+}
+
+// AddRecord - writes a new record, on condition that its ID isn't taken.
+func (db *Products) AddRecord(ctx context.Context, resource string, record datastore.Record) error {
+	err := putRecord(ctx, resource, record, "attribute_not_exists(#id)")
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.RecordExists(resource, record.Id())
+	}
+	return err
+}
+
+// UpdateRecord - replaces a record, on condition that it exists.
+func (db *Products) UpdateRecord(ctx context.Context, resource string, record datastore.Record) error {
+	err := putRecord(ctx, resource, record, "attribute_exists(#id)")
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.RecordNotFound(resource, record.Id())
+	}
+	return err
+}
+
+// putRecord - local helper function that writes a record whole, on the given condition on its ID.
+func putRecord(ctx context.Context, resource string, record datastore.Record, condition string) error {
+	table, err := recordsTable(ctx, resource)
+	if err != nil {
+		return err
+	}
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("Error marshalling record: %v", err)
+	}
+	_, err = Items.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(table),
+		Item:                     item,
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: map[string]string{"#id": datastore.RecordID},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("Record <%v> could not be written: %w", record.Id(), unavailable(err))
+	}
+	return err
+}
+
+// DeleteRecord - deletes a record, on condition that it exists.
+func (db *Products) DeleteRecord(ctx context.Context, resource, id string) error {
+	table, err := recordsTable(ctx, resource)
+	if err != nil {
+		return err
+	}
+	_, err = Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(table),
+		Key:                      recordKey(id),
+		ConditionExpression:      aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{"#id": datastore.RecordID},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.RecordNotFound(resource, id)
+	}
+	if err != nil {
+		return fmt.Errorf("Record <%v> could not be deleted: %w", id, unavailable(err))
+	}
+	return nil
+}
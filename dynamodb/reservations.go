@@ -0,0 +1,187 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Reservation = datastore.Reservation
+
+/*
+ReservationsTableName - name for the table holding stock reservations; each tenant has its own, e.g.
+"acme.Reservations". It deliberately has no TTL: an expired reservation's stock has to be returned as it's deleted,
+which the app does itself (see ReleaseReservation).
+*/
+const ReservationsTableName = "Reservations"
+
+// reservationIdAttribute - the key of the reservations table.
+const reservationIdAttribute = "reservation_id"
+
+// reservationsTable - the reservations table belonging to a Products table.
+func reservationsTable(table string) string {
+	return siblingTable(table, ReservationsTableName)
+}
+
+// createReservationsTable - local helper function that creates a reservations table, if it doesn't exist.
+func createReservationsTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, table, reservationIdAttribute, "", "")
+}
+
+// reservationKey - the key of a reservation item.
+func reservationKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{reservationIdAttribute: &types.AttributeValueMemberS{Value: id}}
+}
+
+// takeStock - the transaction item taking quantity out of a variant's stock, on condition that it has enough.
+func takeStock(ctx context.Context, productID, variantID string, quantity int) types.TransactWriteItem {
+	return types.TransactWriteItem{Update: &types.Update{
+		TableName:                aws.String(variantsTable(tableName(ctx))),
+		Key:                      variantKey(datastore.Variant{ProductId: productID, Id: variantID}),
+		UpdateExpression:         aws.String("SET #stock = #stock - :q"),
+		ConditionExpression:      aws.String("#stock >= :q"),
+		ExpressionAttributeNames: map[string]string{"#stock": "stock"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q": &types.AttributeValueMemberN{Value: strconv.Itoa(quantity)},
+		},
+	}}
+}
+
+// returnStock - the transaction item putting quantity back into a variant's stock, on condition that the variant
+// still exists (an update would otherwise create a variant with nothing but stock).
+func returnStock(ctx context.Context, productID, variantID string, quantity int) types.TransactWriteItem {
+	return types.TransactWriteItem{Update: &types.Update{
+		TableName:                aws.String(variantsTable(tableName(ctx))),
+		Key:                      variantKey(datastore.Variant{ProductId: productID, Id: variantID}),
+		UpdateExpression:         aws.String("ADD #stock :q"),
+		ConditionExpression:      aws.String("attribute_exists(#v)"),
+		ExpressionAttributeNames: map[string]string{"#stock": "stock", "#v": variantIdAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q": &types.AttributeValueMemberN{Value: strconv.Itoa(quantity)},
+		},
+	}}
+}
+
+// reservationUse - the transaction item using up a reservation, on condition that it exists and hasn't expired.
+func reservationUse(ctx context.Context, id string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                aws.String(reservationsTable(tableName(ctx))),
+		Key:                      reservationKey(id),
+		ConditionExpression:      aws.String("attribute_exists(#r) AND #e > :now"),
+		ExpressionAttributeNames: map[string]string{"#r": reservationIdAttribute, "#e": ExpiresAtAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	}}
+}
+
+// Reserve - saves the reservation in a single transaction with taking its stock.
+func (db *Products) Reserve(ctx context.Context, reservation Reservation) error {
+	item, err := attributevalue.MarshalMap(reservation)
+	if err != nil {
+		return fmt.Errorf("Error marshalling reservation: %v", err)
+	}
+	err = transactWrite(ctx, []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:                aws.String(reservationsTable(tableName(ctx))),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#r)"),
+			ExpressionAttributeNames: map[string]string{"#r": reservationIdAttribute},
+		}},
+		takeStock(ctx, reservation.ProductId, reservation.VariantId, reservation.Quantity),
+	})
+	if err != nil {
+		return fmt.Errorf("Variant <%v> of product <%v> could not be reserved; it may be out of stock: %w", reservation.VariantId, reservation.ProductId, err)
+	}
+	return nil
+}
+
+// GetReservation - if it exists and hasn't expired, retrieves the requested reservation.
+func (db Products) GetReservation(ctx context.Context, reservation *Reservation) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(reservationsTable(tableName(ctx))),
+		Key:       reservationKey(reservation.Id),
+	})
+	if err != nil {
+		return fmt.Errorf("GetReservation failed:\n%w", unavailable(err))
+	}
+	var stored Reservation
+	if len(result.Item) > 0 {
+		if err := attributevalue.UnmarshalMap(result.Item, &stored); err != nil {
+			return fmt.Errorf("Unmarshalling GetReservation failed:\n%v", err)
+		}
+	}
+	if len(result.Item) == 0 || stored.Expired() {
+		return datastore.Errorf("reservation_not_found", "Reservation <%v> does not exist: %w", reservation.Id, datastore.ErrNotFound)
+	}
+	*reservation = stored
+	return nil
+}
+
+/*
+ReleaseReservation - deletes the reservation in a single transaction with returning its stock. If that fails because
+the variant has since been deleted, the reservation is deleted on its own; either way, the delete is conditioned on
+the reservation still existing, so its stock is only ever returned once.
+*/
+func (db *Products) ReleaseReservation(ctx context.Context, reservation Reservation) error {
+	table := aws.String(reservationsTable(tableName(ctx)))
+	exists := aws.String("attribute_exists(#r)")
+	names := map[string]string{"#r": reservationIdAttribute}
+
+	err := transactWrite(ctx, []types.TransactWriteItem{
+		{Delete: &types.Delete{TableName: table, Key: reservationKey(reservation.Id), ConditionExpression: exists, ExpressionAttributeNames: names}},
+		returnStock(ctx, reservation.ProductId, reservation.VariantId, reservation.Quantity),
+	})
+	if !errors.Is(err, datastore.ErrConflict) {
+		return err
+	}
+
+	_, err = Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: table, Key: reservationKey(reservation.Id), ConditionExpression: exists, ExpressionAttributeNames: names})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.Errorf("reservation_not_found", "Reservation <%v> does not exist: %w", reservation.Id, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Reservation <%v> could not be released: %w", reservation.Id, unavailable(err))
+	}
+	return nil
+}
+
+// ExpiredReservations - scans for reservations past their expiry. Reservations are short-lived, so the table stays small.
+func (db Products) ExpiredReservations(ctx context.Context) ([]Reservation, error) {
+	pages := dynamodb.NewScanPaginator(readerFor(ctx), &dynamodb.ScanInput{
+		TableName:                aws.String(reservationsTable(tableName(ctx))),
+		FilterExpression:         aws.String("#e <= :now"),
+		ExpressionAttributeNames: map[string]string{"#e": ExpiresAtAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+
+	expired := []Reservation{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Scan ExpiredReservations failed:\n%w", unavailable(err))
+		}
+		var batch []Reservation
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("Unmarshalling ExpiredReservations failed:\n%v", err)
+		}
+		expired = append(expired, batch...)
+	}
+	return expired, nil
+}
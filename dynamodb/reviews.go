@@ -0,0 +1,198 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Review = datastore.Review
+
+// ReviewsTableName - name for the table holding Product reviews; each tenant has its own, e.g. "acme.Reviews".
+const ReviewsTableName = "Reviews"
+
+// Review keys: reviews are partitioned by Product ID (always a string) and identified by their own UUID.
+const (
+	reviewProductAttribute = "product_id"
+	reviewIdAttribute      = "review_id"
+)
+
+// The running totals kept on each Product item, from which its Rating is calculated.
+const (
+	ratingSumAttribute   = "rating_sum"
+	ratingCountAttribute = "rating_count"
+)
+
+// reviewsTable - the reviews table belonging to a Products table.
+func reviewsTable(table string) string {
+	return siblingTable(table, ReviewsTableName)
+}
+
+// createReviewsTable - local helper function that creates a reviews table, if it doesn't exist.
+func createReviewsTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, table, reviewProductAttribute, reviewIdAttribute, types.ScalarAttributeTypeS)
+}
+
+// reviewKey - the key of a review item.
+func reviewKey(r Review) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		reviewProductAttribute: &types.AttributeValueMemberS{Value: r.ProductId},
+		reviewIdAttribute:      &types.AttributeValueMemberS{Value: r.Id},
+	}
+}
+
+// intAttribute - the value of a numeric attribute, or 0 if it's missing.
+func intAttribute(v types.AttributeValue) int {
+	if n, ok := v.(*types.AttributeValueMemberN); ok {
+		i, _ := strconv.Atoi(n.Value)
+		return i
+	}
+	return 0
+}
+
+/*
+rate - the transaction item adjusting a Product's rating totals by sum and count. The condition stops it from
+creating an item for a Product that has been deleted.
+*/
+func rate(ctx context.Context, productID string, sum, count int) types.TransactWriteItem {
+	return types.TransactWriteItem{Update: &types.Update{
+		TableName:           aws.String(tableName(ctx)),
+		Key:                 map[string]types.AttributeValue{IdAttribute: keyValue(productID)},
+		UpdateExpression:    aws.String("ADD #rs :sum, #rc :count SET #upd = :upd"),
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": IdAttribute, "#rs": ratingSumAttribute, "#rc": ratingCountAttribute, "#upd": UpdatedAtAttribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sum":   &types.AttributeValueMemberN{Value: strconv.Itoa(sum)},
+			":count": &types.AttributeValueMemberN{Value: strconv.Itoa(count)},
+			":upd":   &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	}}
+}
+
+// GetReviews - a Product's reviews, oldest first.
+func (db Products) GetReviews(ctx context.Context, productID string) ([]Review, error) {
+	pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+		TableName:                aws.String(reviewsTable(tableName(ctx))),
+		KeyConditionExpression:   aws.String("#p = :p"),
+		ExpressionAttributeNames: map[string]string{"#p": reviewProductAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":p": &types.AttributeValueMemberS{Value: productID},
+		},
+	})
+
+	reviews := []Review{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query GetReviews failed:\n%w", unavailable(err))
+		}
+		var batch []Review
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("Unmarshalling GetReviews failed:\n%v", err)
+		}
+		reviews = append(reviews, batch...)
+	}
+
+	// Review IDs are random, so the table's order means nothing to a reader.
+	sort.SliceStable(reviews, func(i, j int) bool { return reviews[i].CreatedAt.Before(reviews[j].CreatedAt) })
+	return reviews, nil
+}
+
+// GetReview - if it exists, retrieves the requested review.
+func (db Products) GetReview(ctx context.Context, review *Review) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(reviewsTable(tableName(ctx))),
+		Key:       reviewKey(*review),
+	})
+	if err != nil {
+		return fmt.Errorf("GetReview failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return datastore.Errorf("review_not_found", "Review <%v> of product <%v> does not exist: %w", review.Id, review.ProductId, datastore.ErrNotFound)
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, review); err != nil {
+		return fmt.Errorf("Unmarshalling GetReview failed:\n%v", err)
+	}
+	return nil
+}
+
+// AddReview - adds a review and its rating to the Product's totals, together.
+func (db *Products) AddReview(ctx context.Context, review Review) error {
+	item, err := attributevalue.MarshalMap(review)
+	if err != nil {
+		return fmt.Errorf("AddReview -> Error marshalling review: %v", err)
+	}
+
+	err = transactWrite(ctx, append([]types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:                aws.String(reviewsTable(tableName(ctx))),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#r)"),
+			ExpressionAttributeNames: map[string]string{"#r": reviewIdAttribute},
+		}},
+		rate(ctx, review.ProductId, review.Rating, 1),
+	}, changePuts(ctx, review.ProductId, datastore.ChangeUpdated)...))
+	if err != nil {
+		return fmt.Errorf("AddReview -> Review could not be added: %w", err)
+	}
+	return nil
+}
+
+// UpdateReview - replaces a review, moving the Product's totals by the change in rating. The condition on the old
+// rating keeps the totals right if the review was changed in the meantime.
+func (db *Products) UpdateReview(ctx context.Context, old, review Review) error {
+	item, err := attributevalue.MarshalMap(review)
+	if err != nil {
+		return fmt.Errorf("UpdateReview -> Error marshalling review: %v", err)
+	}
+
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:                 aws.String(reviewsTable(tableName(ctx))),
+		Item:                      item,
+		ConditionExpression:       aws.String("#rating = :old"),
+		ExpressionAttributeNames:  map[string]string{"#rating": "rating"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":old": &types.AttributeValueMemberN{Value: strconv.Itoa(old.Rating)}},
+	}}}
+	if review.Rating != old.Rating {
+		writes = append(writes, rate(ctx, review.ProductId, review.Rating-old.Rating, 0))
+		writes = append(writes, changePuts(ctx, review.ProductId, datastore.ChangeUpdated)...)
+	}
+
+	if err := transactWrite(ctx, writes); err != nil {
+		return fmt.Errorf("UpdateReview -> Review <%v> could not be updated: %w", review.Id, err)
+	}
+	return nil
+}
+
+// DeleteReview - removes a review and takes its rating off the Product's totals.
+func (db *Products) DeleteReview(ctx context.Context, review Review) error {
+	err := transactWrite(ctx, append([]types.TransactWriteItem{
+		{Delete: &types.Delete{
+			TableName:                 aws.String(reviewsTable(tableName(ctx))),
+			Key:                       reviewKey(review),
+			ConditionExpression:       aws.String("#rating = :old"),
+			ExpressionAttributeNames:  map[string]string{"#rating": "rating"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":old": &types.AttributeValueMemberN{Value: strconv.Itoa(review.Rating)}},
+		}},
+		rate(ctx, review.ProductId, -review.Rating, -1),
+	}, changePuts(ctx, review.ProductId, datastore.ChangeUpdated)...))
+	if err != nil {
+		return fmt.Errorf("DeleteReview -> Review <%v> could not be deleted: %w", review.Id, err)
+	}
+	return nil
+}
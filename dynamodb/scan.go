@@ -0,0 +1,76 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MaxScanSegments - the most segments DynamoDB lets a Scan be split into.
+const MaxScanSegments = 1000000
+
+// scanSegments - how many segments reads of a whole table are split into (config.DynamoDB.ScanSegments).
+var scanSegments = 1
+
+/*
+parallelScan - reads everything input selects, page by page, split into scanSegments segments that are scanned at
+the same time, and passes each page's items to each. Calls to each don't overlap, so it needn't lock what it
+collects, but pages arrive in no particular order. The first error, from DynamoDB (wrapped, naming op) or from each,
+stops every segment.
+
+Each segment reads its own share of the table, so a large table is read in a fraction of the time, at the price of
+using read capacity that much faster.
+*/
+func parallelScan(ctx context.Context, op string, input *dynamodb.ScanInput, each func([]map[string]types.AttributeValue) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var first error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for segment := 0; segment < scanSegments; segment++ {
+		in := *input
+		if scanSegments > 1 {
+			in.Segment, in.TotalSegments = aws.Int32(int32(segment)), aws.Int32(int32(scanSegments))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pages := dynamodb.NewScanPaginator(readerFor(ctx), &in)
+			for pages.HasMorePages() {
+				page, err := pages.NextPage(ctx)
+				if err != nil {
+					fail(fmt.Errorf("Query %v failed:\n%w", op, unavailable(err)))
+					return
+				}
+				mu.Lock()
+				if first == nil {
+					err = each(page.Items)
+				}
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,83 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+/*
+AdjustStock - adds delta to the quantity in the Product's stock map, in a transaction with the change. DynamoDB can't
+update a key of a map that isn't there, so a Product without one is given an empty map first. Taking stock out is
+conditioned on there being enough; a failed condition is then told apart from a missing Product by reading it.
+*/
+func (db *Products) AdjustStock(ctx context.Context, id, location string, delta int) (Product, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	live := "attribute_exists(#id) AND (attribute_not_exists(#exp) OR #exp > :now)"
+
+	_, err := Items.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(tableName(ctx)),
+		Key:                      map[string]types.AttributeValue{IdAttribute: keyValue(id)},
+		UpdateExpression:         aws.String("SET #stock = :empty"),
+		ConditionExpression:      aws.String(live + " AND attribute_not_exists(#stock)"),
+		ExpressionAttributeNames: map[string]string{"#id": IdAttribute, "#exp": ExpiresAtAttribute, "#stock": StockAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":empty": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}},
+			":now":   &types.AttributeValueMemberN{Value: now},
+		},
+	})
+	// A failed condition means the map is already there, or the Product isn't, which the adjustment finds out.
+	var conditionFailed *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return Product{}, fmt.Errorf("Stock of product <%v> could not be adjusted: %w", id, unavailable(err))
+	}
+
+	condition := live
+	values := map[string]types.AttributeValue{
+		":zero":  &types.AttributeValueMemberN{Value: "0"},
+		":delta": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+		":upd":   &types.AttributeValueMemberN{Value: now},
+		":now":   &types.AttributeValueMemberN{Value: now},
+	}
+	if delta < 0 {
+		condition += " AND #stock.#loc >= :need"
+		values[":need"] = &types.AttributeValueMemberN{Value: strconv.Itoa(-delta)}
+	}
+	err = transactWrite(ctx, append([]types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName:           aws.String(tableName(ctx)),
+			Key:                 map[string]types.AttributeValue{IdAttribute: keyValue(id)},
+			UpdateExpression:    aws.String("SET #stock.#loc = if_not_exists(#stock.#loc, :zero) + :delta, #upd = :upd"),
+			ConditionExpression: aws.String(condition),
+			ExpressionAttributeNames: map[string]string{
+				"#id": IdAttribute, "#exp": ExpiresAtAttribute, "#stock": StockAttribute, "#loc": location, "#upd": UpdatedAtAttribute,
+			},
+			ExpressionAttributeValues: values,
+		}},
+	}, changePuts(ctx, id, datastore.ChangeUpdated)...))
+	if errors.Is(err, datastore.ErrConflict) {
+		stored, readErr := storedProduct(ctx, id)
+		switch {
+		case readErr != nil:
+			return Product{}, readErr
+		case stored.Expired():
+			return Product{}, datastore.Errorf("product_not_found", "Product <%v> does not exist: %w", id, datastore.ErrNotFound)
+		}
+		return Product{}, datastore.Errorf("insufficient_stock", "Product <%v> has only %v in stock at location %v: %w", id, stored.Stock[location], location, datastore.ErrConflict)
+	}
+	if err != nil {
+		return Product{}, fmt.Errorf("Stock of product <%v> could not be adjusted: %w", id, unavailable(err))
+	}
+	return storedProduct(ctx, id)
+}
@@ -0,0 +1,264 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// streams - the DynamoDB Streams client FollowChanges reads with.
+var streams *dynamodbstreams.Client
+
+// streamSpecification - the stream every Products table has: a record of each item written or deleted, with the
+// item as it was left and as it was before, which global table replication needs.
+var streamSpecification = &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: types.StreamViewTypeNewAndOldImages}
+
+// streamKinds - the change each kind of stream record is.
+var streamKinds = map[streamtypes.OperationType]string{
+	streamtypes.OperationTypeInsert: datastore.ChangeCreated,
+	streamtypes.OperationTypeModify: datastore.ChangeUpdated,
+	streamtypes.OperationTypeRemove: datastore.ChangeDeleted,
+}
+
+// enableStream - local helper function that turns on a Products table's stream, if it isn't already, and waits
+// until the table is active again.
+func enableStream(ctx context.Context, table string) error {
+	result, err := Items.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return fmt.Errorf("DescribeTable failed: %v", err)
+	}
+	if spec := result.Table.StreamSpecification; spec != nil && aws.ToBool(spec.StreamEnabled) {
+		return nil
+	}
+
+	if _, err := Items.UpdateTable(ctx, &dynamodb.UpdateTableInput{TableName: aws.String(table), StreamSpecification: streamSpecification}); err != nil {
+		return fmt.Errorf("Enabling the stream on %v failed: %v", table, err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(Items)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, tableWait); err != nil {
+		return fmt.Errorf("Waiting for table %v failed: %v", table, err)
+	}
+	return nil
+}
+
+/*
+FollowChanges - publishes every tenant's changes on the bus, read from its Products table's stream, from now until
+the context is done. The stream has every write, whether it was made through the API or not, and Products removed
+by TTL when they expire, which are published as deleted.
+
+Every instance that follows the feed reads every shard itself, so each publishes every event. Records are read
+every cfg.ChangeFeed.PollInterval. A shard's records are published in order, and a shard split off from another
+isn't read until its parent has been, so a Product's changes are published in the order they were made. Read errors
+are logged and the read tried again at the next poll, from the last record published.
+*/
+func FollowChanges(ctx context.Context, cfg config.Config, bus *events.Bus) error {
+	arns := map[string]string{}
+	for _, tenant := range cfg.Tenancy.Names() {
+		table := tableName(datastore.WithTenant(ctx, tenant))
+		result, err := Items.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return fmt.Errorf("DescribeTable failed: %v", err)
+		}
+		if result.Table.LatestStreamArn == nil {
+			return fmt.Errorf("Table %v has no stream", table)
+		}
+		arns[tenant] = aws.ToString(result.Table.LatestStreamArn)
+	}
+
+	var wg sync.WaitGroup
+	for tenant, arn := range arns {
+		wg.Add(1)
+		go func(tenant, arn string) {
+			defer wg.Done()
+			f := streamFollower{arn: arn, tenant: tenant, bus: bus, iterators: map[string]*string{}, last: map[string]string{}, done: map[string]bool{}}
+			f.follow(ctx, cfg.ChangeFeed.PollInterval.Duration)
+		}(tenant, arn)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// streamFollower - where FollowChanges has read a tenant's stream up to.
+type streamFollower struct {
+	arn    string
+	tenant string
+	bus    *events.Bus
+	// iterators - where to read each shard being read from next.
+	iterators map[string]*string
+	// last - the sequence number of the last record published from each shard that has been opened; "" until it has
+	// published one.
+	last map[string]string
+	// done - the shards that have been read to their end, or were closed before following started.
+	done map[string]bool
+	// started - whether the shards open when following started have been found.
+	started bool
+}
+
+// follow - reads the stream, a poll at a time, until the context is done.
+func (f *streamFollower) follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := f.openShards(ctx); err != nil {
+			log.Printf("Change feed for %v: %v", f.arn, err)
+		}
+		for shard := range f.iterators {
+			if err := f.readShard(ctx, shard); err != nil {
+				log.Printf("Change feed for %v shard %v: %v", f.arn, shard, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+openShards - gets iterators for the shards that are ready to be read. Until following has started, that's those
+open now, read from their latest record. After that, it's those split off from shards that have been read to the
+end, read from their oldest, and those whose iterator expired, read from after their last record.
+*/
+func (f *streamFollower) openShards(ctx context.Context) error {
+	var shards []streamtypes.Shard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(f.arn)}
+	for {
+		result, err := streams.DescribeStream(ctx, input)
+		if err != nil {
+			return fmt.Errorf("DescribeStream failed: %v", err)
+		}
+		shards = append(shards, result.StreamDescription.Shards...)
+		if result.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		input.ExclusiveStartShardId = result.StreamDescription.LastEvaluatedShardId
+	}
+
+	known := make(map[string]bool, len(shards))
+	for _, s := range shards {
+		known[aws.ToString(s.ShardId)] = true
+	}
+	for _, s := range shards {
+		shard := aws.ToString(s.ShardId)
+		if f.done[shard] || f.iterators[shard] != nil {
+			continue
+		}
+		closed := s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil
+		last, opened := f.last[shard]
+		input := &dynamodbstreams.GetShardIteratorInput{StreamArn: aws.String(f.arn), ShardId: aws.String(shard)}
+		switch parent := aws.ToString(s.ParentShardId); {
+		case !f.started && closed:
+			f.done[shard] = true
+			continue
+		case !f.started, opened && last == "":
+			input.ShardIteratorType = streamtypes.ShardIteratorTypeLatest
+		case opened:
+			input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+			input.SequenceNumber = aws.String(last)
+		case parent != "" && known[parent] && !f.done[parent]:
+			continue
+		default:
+			input.ShardIteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+		}
+		result, err := streams.GetShardIterator(ctx, input)
+		if err != nil {
+			return fmt.Errorf("GetShardIterator failed: %v", err)
+		}
+		f.iterators[shard] = result.ShardIterator
+		f.last[shard] = last
+	}
+	f.started = true
+	return nil
+}
+
+// readShard - publishes a shard's records up to the latest, noting when it has been read to its end.
+func (f *streamFollower) readShard(ctx context.Context, shard string) error {
+	ctx = datastore.WithTenant(ctx, f.tenant)
+	for {
+		result, err := streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: f.iterators[shard]})
+		var expired *streamtypes.ExpiredIteratorException
+		if errors.As(err, &expired) {
+			// openShards gets another, from the last record.
+			delete(f.iterators, shard)
+		}
+		if err != nil {
+			return fmt.Errorf("GetRecords failed: %v", err)
+		}
+		for _, record := range result.Records {
+			e, err := streamEvent(f.tenant, record)
+			if err != nil {
+				log.Printf("Change feed for %v: skipping record %v: %v", f.arn, aws.ToString(record.EventID), err)
+				continue
+			}
+			f.bus.Publish(ctx, e)
+			f.last[shard] = aws.ToString(record.Dynamodb.SequenceNumber)
+		}
+
+		if result.NextShardIterator == nil {
+			delete(f.iterators, shard)
+			f.done[shard] = true
+			return nil
+		}
+		f.iterators[shard] = result.NextShardIterator
+		if len(result.Records) == 0 {
+			return nil
+		}
+	}
+}
+
+// streamEvent - the change event for a stream record.
+func streamEvent(tenant string, record streamtypes.Record) (events.Event, error) {
+	kind, ok := streamKinds[record.EventName]
+	if !ok || record.Dynamodb == nil {
+		return events.Event{}, fmt.Errorf("Unknown stream record %q", record.EventName)
+	}
+	keys, err := attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.Keys)
+	if err != nil {
+		return events.Event{}, err
+	}
+	var id string
+	switch key := keys[IdAttribute].(type) {
+	case *types.AttributeValueMemberN:
+		id = key.Value
+	case *types.AttributeValueMemberS:
+		id = key.Value
+	default:
+		return events.Event{}, errors.New("Stream record has no Product ID")
+	}
+
+	e := events.Event{
+		Tenant: tenant,
+		Change: datastore.Change{ProductId: id, Kind: kind, At: aws.ToTime(record.Dynamodb.ApproximateCreationDateTime).UTC()},
+	}
+	if record.Dynamodb.NewImage != nil {
+		item, err := attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.NewImage)
+		if err != nil {
+			return events.Event{}, err
+		}
+		p, err := unmarshalProduct(item)
+		if err != nil {
+			return events.Event{}, err
+		}
+		e.Product = &p
+	}
+	return e, nil
+}
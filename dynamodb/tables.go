@@ -0,0 +1,171 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tableWait - how long to wait for a table to become active or disappear.
+const tableWait = 5 * time.Minute
+
+// CreateTables - creates the context's tenant's Products table and its price history, change log, outbox, reviews,
+// variants, orders, carts, reservations, barcodes and registered resources' tables (and the shared Users table, and
+// Counters table for sequential IDs, if they don't exist yet), waiting until each is active, and replicates them if
+// they're global tables. Unlike Initialize, the tables are left empty; see Seed.
+func CreateTables(ctx context.Context, cfg config.Config) error {
+	table := tableName(ctx)
+	if err := createTable(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+
+	if err := createHistoryTable(ctx, cfg.DynamoDB, historyTable(table)); err != nil {
+		return err
+	}
+	if err := createChangesTable(ctx, cfg.DynamoDB, changesTable(table)); err != nil {
+		return err
+	}
+	if err := createOutboxTable(ctx, cfg.DynamoDB, outboxTable(table)); err != nil {
+		return err
+	}
+	if err := createReviewsTable(ctx, cfg.DynamoDB, reviewsTable(table)); err != nil {
+		return err
+	}
+	if err := createVariantsTable(ctx, cfg.DynamoDB, variantsTable(table)); err != nil {
+		return err
+	}
+	if err := createOrdersTable(ctx, cfg.DynamoDB, ordersTable(table)); err != nil {
+		return err
+	}
+	if err := createCartsTable(ctx, cfg.DynamoDB, cartsTable(table)); err != nil {
+		return err
+	}
+	if err := createReservationsTable(ctx, cfg.DynamoDB, reservationsTable(table)); err != nil {
+		return err
+	}
+	if err := barcodeClaims.createTable(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	if err := nameClaims.createTable(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	if err := createResourceTables(ctx, cfg.DynamoDB, table); err != nil {
+		return err
+	}
+
+	if err := createUsersTable(ctx, cfg.DynamoDB); err != nil {
+		return err
+	}
+	if datastore.Strategy == datastore.IntIDs {
+		exists, err := Items.tableExists(envTable(CountersTableName))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := createCountersTable(cfg.DynamoDB); err != nil {
+				return fmt.Errorf("Error creating table %v: %v", envTable(CountersTableName), err)
+			}
+		}
+	}
+	return replicateTables(ctx, cfg.DynamoDB, append(append([]string{table}, childTables(table)...), sharedTables()...))
+}
+
+// childTables - the tables that belong to a Products table: its price history, change log, outbox, reviews,
+// variants, orders, carts, reservations, barcodes and names, and the registered resources' tables.
+func childTables(table string) []string {
+	return append([]string{
+		historyTable(table), changesTable(table), outboxTable(table), reviewsTable(table), variantsTable(table),
+		ordersTable(table), cartsTable(table), reservationsTable(table), barcodeClaims.claimsTable(table),
+		nameClaims.claimsTable(table),
+	}, resourceTables(table)...)
+}
+
+// sharedTables - the tables every tenant shares that CreateTables makes: Users, and Counters with sequential IDs.
+func sharedTables() []string {
+	tables := []string{envTable(UsersTableName)}
+	if datastore.Strategy == datastore.IntIDs {
+		tables = append(tables, envTable(CountersTableName))
+	}
+	return tables
+}
+
+// DropTables - deletes the context's tenant's Products table and everything in it, its price history, change log,
+// outbox, reviews, variants, orders, carts, reservations, barcodes and names, and its ID counter and schema version.
+// The Counters, SchemaVersions and Users tables are shared by every tenant, so they are kept.
+func DropTables(ctx context.Context) error {
+	table := tableName(ctx)
+	var notFound *types.ResourceNotFoundException
+
+	_, err := Items.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("Error deleting table %v: %v", table, err)
+	}
+	if err == nil {
+		waiter := dynamodb.NewTableNotExistsWaiter(Items)
+		if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, tableWait); err != nil {
+			return fmt.Errorf("Waiting for table %v to be deleted failed: %v", table, err)
+		}
+		fmt.Printf("Table '%v' deleted\n", table)
+	}
+
+	for _, child := range childTables(table) {
+		if _, err := Items.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(child)}); err == nil {
+			fmt.Printf("Table '%v' deleted\n", child)
+		} else if !errors.As(err, &notFound) {
+			return fmt.Errorf("Error deleting table %v: %v", child, err)
+		}
+	}
+
+	for _, shared := range []string{envTable(CountersTableName), envTable(SchemaTableName)} {
+		_, err := Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(shared),
+			Key:       map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: table}},
+		})
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("Error deleting %v's entry in %v: %v", table, shared, err)
+		}
+	}
+	return nil
+}
+
+/*
+Truncate - empties the context's tenant's catalog by dropping its tables (see DropTables) and creating them again,
+as they were when the app started, which is far quicker than deleting every item. Requests made while the tables are
+being recreated fail.
+*/
+func (db *Products) Truncate(ctx context.Context) error {
+	if err := DropTables(ctx); err != nil {
+		return err
+	}
+	if err := CreateTables(ctx, connected.cfg); err != nil {
+		return err
+	}
+	// Like any new table, it's recorded as having the current schema, and gets TTL.
+	table := tableName(ctx)
+	if err := migrateSchema(ctx, connected.cfg.DynamoDB, table); err != nil {
+		return err
+	}
+	return enableAutoScaling(connected.aws, connected.cfg.DynamoDB, table)
+}
+
+// Seed - writes the configured seed Products to the context's tenant's table, replacing any with the same IDs. With
+// sequential IDs the counter is moved past them, so later creates aren't handed an ID that is already taken.
+func Seed(ctx context.Context, cfg config.Config) error {
+	products, err := enterTestData(ctx, cfg.Seed, tableName(ctx))
+	if err != nil || len(products) == 0 {
+		return err
+	}
+	recordClaims(ctx, tableName(ctx), products)
+	return Items.AdvanceID(ctx, products[len(products)-1].Id)
+}
@@ -0,0 +1,91 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransactLimit - the maximum number of items DynamoDB accepts in a single TransactWriteItems call.
+const TransactLimit = 100
+
+// AddProducts - adds several Products in a single TransactWriteItems call, so either all of them are written or none are.
+// Like AddProduct, each put is conditional; if any ID, barcode or (with unique names) name is already in use, or two
+// of the Products share one, the whole transaction fails with datastore.ErrConflict. Each barcode's and name's claim is
+// an item in the transaction too, so they count towards TransactLimit.
+func (db *Products) AddProducts(ctx context.Context, products []Product) error {
+	if len(products) > TransactLimit {
+		return fmt.Errorf("AddProducts -> At most %v products can be added atomically, got %v", TransactLimit, len(products))
+	}
+
+	writes := make([]types.TransactWriteItem, 0, len(products))
+	updated := datastore.Modified(time.Now())
+	for _, p := range products {
+		p.Stock, p.UpdatedAt = nil, updated
+		item, err := marshalProduct(p)
+		if err != nil {
+			return fmt.Errorf("AddProducts -> Error marshalling product: %v", err)
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName:                aws.String(tableName(ctx)),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+			ExpressionAttributeNames: map[string]string{"#id": IdAttribute},
+		}})
+	}
+
+	for _, p := range products {
+		writes = append(writes, claims(ctx, p)...)
+	}
+	if len(writes) > TransactLimit {
+		return fmt.Errorf("AddProducts -> At most %v products and unique values can be added atomically, got %v", TransactLimit, len(writes))
+	}
+	if err := duplicates(products); err != nil {
+		return fmt.Errorf("AddProducts -> Products could not be added: %w", err)
+	}
+
+	if err := withClaims(ctx, products, writes); err != nil {
+		return fmt.Errorf("AddProducts -> Products could not be added: %w", err)
+	}
+	recordPrices(ctx, products)
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.Id
+	}
+	recordChanges(ctx, datastore.ChangeCreated, ids...)
+	return nil
+}
+
+// transactWrite - local helper function that applies writes atomically. Operations that must not be left half done
+// (e.g. a product together with a related record) should go through here rather than separate or batched writes.
+func transactWrite(ctx context.Context, writes []types.TransactWriteItem) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	_, err := Items.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	if err == nil {
+		return nil
+	}
+
+	// A failed condition cancels the whole transaction; report it the same way as a single conditional put.
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return fmt.Errorf("%v: %w", canceled.ErrorMessage(), datastore.ErrConflict)
+			}
+		}
+	}
+	return fmt.Errorf("TransactWriteItems failed:\n%w", unavailable(err))
+}
@@ -0,0 +1,133 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type User = datastore.User
+
+// UsersTableName - name for the table holding the API's users, which is shared by every tenant, like Counters.
+const UsersTableName = "Users"
+
+// userNameAttribute - the key of the users table.
+const userNameAttribute = "name"
+
+// createUsersTable - local helper function that creates the users table, if it doesn't exist.
+func createUsersTable(ctx context.Context, cfg config.DynamoDB) error {
+	return createChildTable(ctx, cfg, envTable(UsersTableName), userNameAttribute, "", "")
+}
+
+// userKey - the key of a user item.
+func userKey(name string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{userNameAttribute: &types.AttributeValueMemberS{Value: name}}
+}
+
+// GetUsers - every user, sorted by name. Credentials are read consistently, so they're never read through DAX.
+func (db Products) GetUsers(ctx context.Context) ([]User, error) {
+	users := []User{}
+	input := &dynamodb.ScanInput{TableName: aws.String(envTable(UsersTableName)), ConsistentRead: aws.Bool(true)}
+	for {
+		result, err := Items.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("Query GetUsers failed:\n%w", unavailable(err))
+		}
+		var page []User
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("Unmarshalling GetUsers failed:\n%v", err)
+		}
+		users = append(users, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+// GetUser - if it exists, retrieves the requested user.
+func (db Products) GetUser(ctx context.Context, user *User) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(envTable(UsersTableName)),
+		Key:            userKey(user.Name),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("GetUser failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return datastore.Errorf("user_not_found", "User <%v> does not exist: %w", user.Name, datastore.ErrNotFound)
+	}
+	var stored User
+	if err := attributevalue.UnmarshalMap(result.Item, &stored); err != nil {
+		return fmt.Errorf("Unmarshalling GetUser failed:\n%v", err)
+	}
+	*user = stored
+	return nil
+}
+
+// AddUser - saves a new user, on condition that the name isn't taken.
+func (db *Products) AddUser(ctx context.Context, user User) error {
+	return putUser(ctx, user, "attribute_not_exists(#n)", "AddUser",
+		datastore.Errorf("user_exists", "User <%v> already exists: %w", user.Name, datastore.ErrConflict))
+}
+
+// UpdateUser - replaces a user, on condition that it exists.
+func (db *Products) UpdateUser(ctx context.Context, user User) error {
+	return putUser(ctx, user, "attribute_exists(#n)", "UpdateUser",
+		datastore.Errorf("user_not_found", "User <%v> does not exist: %w", user.Name, datastore.ErrNotFound))
+}
+
+// putUser - writes the user if condition holds, returning conditionFailed if it doesn't.
+func putUser(ctx context.Context, user User, condition, method string, conditionFailed error) error {
+	item, err := attributevalue.MarshalMap(user)
+	if err != nil {
+		return fmt.Errorf("Error marshalling user: %v", err)
+	}
+	_, err = Items.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(envTable(UsersTableName)),
+		Item:                     item,
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: map[string]string{"#n": userNameAttribute},
+	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return conditionFailed
+	}
+	if err != nil {
+		return fmt.Errorf("%v -> User <%v> could not be saved: %w", method, user.Name, unavailable(err))
+	}
+	return nil
+}
+
+// DeleteUser - deletes the user, on condition that it exists.
+func (db *Products) DeleteUser(ctx context.Context, name string) error {
+	_, err := Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(envTable(UsersTableName)),
+		Key:                      userKey(name),
+		ConditionExpression:      aws.String("attribute_exists(#n)"),
+		ExpressionAttributeNames: map[string]string{"#n": userNameAttribute},
+	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return datastore.Errorf("user_not_found", "User <%v> does not exist: %w", name, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("User <%v> could not be deleted: %w", name, unavailable(err))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Author: Jason Payne
+*/
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type Variant = datastore.Variant
+
+// VariantsTableName - name for the table holding Product variants; each tenant has its own, e.g. "acme.Variants".
+const VariantsTableName = "Variants"
+
+// Variant keys: variants are partitioned by Product ID (always a string) and identified by their own UUID.
+const (
+	variantProductAttribute = "product_id"
+	variantIdAttribute      = "variant_id"
+)
+
+// variantsTable - the variants table belonging to a Products table.
+func variantsTable(table string) string {
+	return siblingTable(table, VariantsTableName)
+}
+
+// createVariantsTable - local helper function that creates a variants table, if it doesn't exist.
+func createVariantsTable(ctx context.Context, cfg config.DynamoDB, table string) error {
+	return createChildTable(ctx, cfg, table, variantProductAttribute, variantIdAttribute, types.ScalarAttributeTypeS)
+}
+
+// variantKey - the key of a variant item.
+func variantKey(v Variant) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		variantProductAttribute: &types.AttributeValueMemberS{Value: v.ProductId},
+		variantIdAttribute:      &types.AttributeValueMemberS{Value: v.Id},
+	}
+}
+
+// GetVariants - a Product's variants, in variant ID order.
+func (db Products) GetVariants(ctx context.Context, productID string) ([]Variant, error) {
+	pages := dynamodb.NewQueryPaginator(readerFor(ctx), &dynamodb.QueryInput{
+		TableName:                aws.String(variantsTable(tableName(ctx))),
+		KeyConditionExpression:   aws.String("#p = :p"),
+		ExpressionAttributeNames: map[string]string{"#p": variantProductAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":p": &types.AttributeValueMemberS{Value: productID},
+		},
+	})
+
+	variants := []Variant{}
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query GetVariants failed:\n%w", unavailable(err))
+		}
+		var batch []Variant
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			return nil, fmt.Errorf("Unmarshalling GetVariants failed:\n%v", err)
+		}
+		variants = append(variants, batch...)
+	}
+	return variants, nil
+}
+
+// GetVariant - if it exists, retrieves the requested variant.
+func (db Products) GetVariant(ctx context.Context, variant *Variant) error {
+	result, err := Items.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(variantsTable(tableName(ctx))),
+		Key:       variantKey(*variant),
+	})
+	if err != nil {
+		return fmt.Errorf("GetVariant failed:\n%w", unavailable(err))
+	}
+	if len(result.Item) == 0 {
+		return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, variant); err != nil {
+		return fmt.Errorf("Unmarshalling GetVariant failed:\n%v", err)
+	}
+	return nil
+}
+
+// AddVariant - adds a new variant.
+func (db *Products) AddVariant(ctx context.Context, variant Variant) error {
+	return putVariant(ctx, variant, "attribute_not_exists(#v)")
+}
+
+// UpdateVariant - replaces an existing variant.
+func (db *Products) UpdateVariant(ctx context.Context, variant Variant) error {
+	return putVariant(ctx, variant, "attribute_exists(#v)")
+}
+
+// putVariant - local helper function that writes a variant if condition (on its ID, #v) holds.
+func putVariant(ctx context.Context, variant Variant, condition string) error {
+	item, err := attributevalue.MarshalMap(variant)
+	if err != nil {
+		return fmt.Errorf("Error marshalling variant: %v", err)
+	}
+
+	_, err = Items.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(variantsTable(tableName(ctx))),
+		Item:                     item,
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: map[string]string{"#v": variantIdAttribute},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		if strings.HasPrefix(condition, "attribute_not_exists") {
+			return datastore.Errorf("variant_exists", "Variant <%v> already exists: %w", variant.Id, datastore.ErrConflict)
+		}
+		return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Variant <%v> could not be written: %w", variant.Id, unavailable(err))
+	}
+	return nil
+}
+
+// DeleteVariant - if it exists, deletes the variant.
+func (db *Products) DeleteVariant(ctx context.Context, variant Variant) error {
+	_, err := Items.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(variantsTable(tableName(ctx))),
+		Key:                      variantKey(variant),
+		ConditionExpression:      aws.String("attribute_exists(#v)"),
+		ExpressionAttributeNames: map[string]string{"#v": variantIdAttribute},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return datastore.Errorf("variant_not_found", "Variant <%v> of product <%v> does not exist: %w", variant.Id, variant.ProductId, datastore.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("Variant <%v> could not be deleted: %w", variant.Id, unavailable(err))
+	}
+	return nil
+}
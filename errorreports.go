@@ -0,0 +1,131 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gorilla/mux"
+)
+
+// reportFlushTimeout - how long a panic waits for its report to be sent, in case the process doesn't survive it.
+const reportFlushTimeout = 2 * time.Second
+
+// errPanic - the error a request that panicked responds with; what went wrong is only logged and reported.
+var errPanic = errors.New("Internal error")
+
+/*
+initErrorReporting - starts reporting to Sentry if a DSN is configured, returning whether it did. Without one, the
+handlers find no hub in their requests and report nothing.
+*/
+func initErrorReporting(cfg config.ErrorReporting) (bool, error) {
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = os.Getenv("SENTRY_DSN")
+	}
+	if dsn == "" {
+		return false, nil
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		return false, fmt.Errorf("Error reporting sample_rate must be more than 0 and at most 1, not %v", cfg.SampleRate)
+	}
+
+	release := cfg.Release
+	if release == "" && os.Getenv("SENTRY_RELEASE") == "" {
+		release = currentBuild().Commit
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              dsn,
+		Environment:      cfg.Environment,
+		Release:          release,
+		SampleRate:       cfg.SampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error initializing error reporting: %v", err)
+	}
+	return true, nil
+}
+
+/*
+withErrorReports - gives each request its own Sentry hub, carrying the request (without cookies or credentials), its
+ID and its trace ID, so errors reported while serving it say which request it was.
+*/
+func withErrorReports(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetRequest(r)
+		hub.Scope().SetTag("request_id", requestID(r))
+		if span, ok := tracecontext.FromContext(r.Context()); ok {
+			hub.Scope().SetTag("trace_id", span.TraceID)
+		}
+		next.ServeHTTP(w, r.WithContext(sentry.SetHubOnContext(r.Context(), hub)))
+	})
+}
+
+// reportError - reports a server error to the request's hub, if it has one, tagged with its route and tenant.
+func reportError(r *http.Request, err error) {
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		return
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		tagRequest(scope, r)
+		hub.CaptureException(err)
+	})
+}
+
+// tagRequest - tags a report with what the router and middleware learned about the request.
+func tagRequest(scope *sentry.Scope, r *http.Request) {
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		scope.SetTag("route", r.Method+" "+routeKey(template))
+	}
+	if tenant := datastore.Tenant(r.Context()); tenant != "" {
+		scope.SetTag("tenant", tenant)
+	}
+}
+
+/*
+recoverPanics - turns a handler's panic into a 500, rather than a dropped connection, logging it with its stack and
+reporting it. An aborted response (http.ErrAbortHandler) is left to the server, which expects it.
+*/
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			stack := debug.Stack()
+			if p, ok := v.(handlerPanic); ok {
+				v, stack = p.value, p.stack
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			log.Printf("request_id=%v panic: %v\n%s", requestID(r), v, stack)
+			if hub := sentry.GetHubFromContext(r.Context()); hub != nil {
+				hub.WithScope(func(scope *sentry.Scope) {
+					tagRequest(scope, r)
+					hub.RecoverWithContext(r.Context(), v)
+				})
+				hub.Flush(reportFlushTimeout)
+			}
+			writeError(w, r, http.StatusInternalServerError, errPanic)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// sentEvents - a Sentry transport that keeps the events it's given, instead of sending them.
+type sentEvents struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (s *sentEvents) Flush(time.Duration) bool                  { return true }
+func (s *sentEvents) FlushWithContext(ctx context.Context) bool { return true }
+func (s *sentEvents) Configure(sentry.ClientOptions)            {}
+func (s *sentEvents) Close()                                    {}
+
+func (s *sentEvents) SendEvent(event *sentry.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+// reporting - reports errors to the returned transport until the test finishes.
+func reporting(t *testing.T) *sentEvents {
+	t.Helper()
+	sent := &sentEvents{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Transport: sent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := sentry.CurrentHub().Client()
+	sentry.CurrentHub().BindClient(client)
+	t.Cleanup(func() { sentry.CurrentHub().BindClient(previous) })
+	return sent
+}
+
+func TestServerErrorsAreReported(t *testing.T) {
+	sent := reporting(t)
+	store := failing(fixtureStore(t), map[string]error{"GetAll": errors.New("Boom")})
+	h := withErrorReports(testServer(t, config.Default(), store))
+
+	if w := do(h, "GET", "/v1/product/99", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/v1/products", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+
+	if len(sent.events) != 1 {
+		t.Fatalf("Got %v reports; want only the server error's", len(sent.events))
+	}
+	event := sent.events[0]
+	if event.Exception[0].Value != "Boom" || event.Tags["route"] != "GET /v1/products" || event.Request.URL != "http://example.com/v1/products" {
+		t.Errorf("Got %v, tags %v, request %v", event.Exception[0].Value, event.Tags, event.Request.URL)
+	}
+}
+
+func TestPanicsRespond500AndAreReported(t *testing.T) {
+	sent := reporting(t)
+	store := datastore.Intercept(fixtureStore(t), func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		panic("Boom")
+	})
+	h := withErrorReports(testServer(t, config.Default(), store))
+
+	w := do(h, "GET", "/v1/product/1", "")
+	if w.Code != http.StatusInternalServerError || errorCode(w) != "internal_server_error" {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+	if len(sent.events) != 1 || sent.events[0].Message != "Boom" || sent.events[0].Tags["route"] != "GET /v1/product/{id}" {
+		t.Fatalf("Got reports %+v", sent.events)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package events delivers the app's change events: one for each Product created, updated or deleted, however the
+change was made. The backend's change feed (see FollowChanges in dummydb and dynamodb) publishes them on a Bus, and
+whatever needs to react to changes, such as webhooks, server-sent events or a Kafka producer, subscribes to it.
+*/
+package events
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// metrics - event counts by kind, published under "change_events" at /debug/vars.
+var metrics = expvar.NewMap("change_events")
+
+/*
+Event - a change to a Product in a tenant. Product is the Product as the change left it, if the feed knows; it's
+nil for deletes.
+*/
+type Event struct {
+	Tenant string
+	datastore.Change
+	Product *datastore.Product
+}
+
+// Handler - reacts to an event. The context carries the event's tenant.
+type Handler func(ctx context.Context, e Event)
+
+/*
+Bus - passes each published event to every subscriber, in the order they subscribed. Handlers run one at a time on
+the publisher's goroutine, so one that has slow work to do should hand it to a job rather than do it there.
+*/
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// Subscribe - adds a handler for every event published from now on.
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish - delivers an event to the subscribers.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	metrics.Add(e.Kind, 1)
+	ctx = datastore.WithTenant(ctx, e.Tenant)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(ctx, e)
+	}
+}
+
+// Log - a Handler that logs each event.
+func Log(ctx context.Context, e Event) {
+	log.Printf("change_event tenant=%q product=%v change=%v at=%v", e.Tenant, e.ProductId, e.Kind, e.At.Format(time.RFC3339Nano))
+}
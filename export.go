@@ -0,0 +1,46 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// csvHeader - the column headings of the CSV export.
+var csvHeader = []string{"id", "name", "price"}
+
+/*
+ExportProductsCSV - stream the catalog as CSV, applying the same filters as the listing endpoint.
+*/
+func (a *API) ExportProductsCSV(w http.ResponseWriter, r *http.Request) {
+	products, status, err := a.listProducts(r)
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writeCSV(w, products)
+}
+
+// writeCSV - writes products as CSV. Rows are flushed as they are written rather than building the whole file in memory.
+func writeCSV(w io.Writer, products []datastore.Product) error {
+	out := csv.NewWriter(w)
+	out.Write(csvHeader)
+	for i, p := range products {
+		out.Write([]string{p.Id, p.Name, p.Price.String()})
+		if i%100 == 99 {
+			out.Flush()
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,117 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// feature - a part of the API that can be switched on or off per environment without a new build.
+type feature struct {
+	Description string
+	Default     bool
+}
+
+// Feature names.
+const (
+	featureSearch = "search"
+)
+
+// features - every flag the app knows, by name. A flag in the config file that isn't here is an error.
+var features = map[string]feature{
+	featureSearch: {Description: "GET /v1/products/search", Default: true},
+}
+
+// Where a flag's value came from.
+const (
+	flagDefault = "default"
+	flagConfig  = "config"
+	flagEnv     = "env"
+)
+
+// flagState - a flag's value, and where it was set.
+type flagState struct {
+	Name        string `json:"name" xml:"name"`
+	Description string `json:"description" xml:"description"`
+	Enabled     bool   `json:"enabled" xml:"enabled"`
+	Source      string `json:"source" xml:"source"`
+}
+
+// flagEnvVar - the environment variable that overrides a flag, e.g. FEATURE_SEARCH.
+func flagEnvVar(name string) string {
+	return "FEATURE_" + strings.ToUpper(name)
+}
+
+/*
+resolveFlags - every flag's value: its default, overridden by the config file, overridden in turn by its
+environment variable. The environment is read again on every config reload.
+*/
+func resolveFlags(configured map[string]bool) (map[string]flagState, error) {
+	for name := range configured {
+		if _, ok := features[name]; !ok {
+			return nil, fmt.Errorf("Unknown feature flag %q", name)
+		}
+	}
+	flags := map[string]flagState{}
+	for name, f := range features {
+		state := flagState{Name: name, Description: f.Description, Enabled: f.Default, Source: flagDefault}
+		if v, ok := configured[name]; ok {
+			state.Enabled, state.Source = v, flagConfig
+		}
+		if v := os.Getenv(flagEnvVar(name)); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %v value %q; use true or false", flagEnvVar(name), v)
+			}
+			state.Enabled, state.Source = enabled, flagEnv
+		}
+		flags[name] = state
+	}
+	return flags, nil
+}
+
+// enabled - whether the named feature is switched on, in the settings in force.
+func enabled(name string) bool {
+	return live.Load().flags[name].Enabled
+}
+
+/*
+requireFeature - responds 404 to requests for a feature that's switched off, as if it didn't exist.
+*/
+func requireFeature(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !enabled(name) {
+			writeError(w, r, http.StatusNotFound, i18n.Errorf("route_not_found", "No resource at %v", r.URL.Path))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// flagList - the feature flags, by name.
+type flagList struct {
+	XMLName xml.Name    `json:"-" xml:"features"`
+	Flags   []flagState `json:"features" xml:"feature"`
+}
+
+/*
+GetFeatures - list every feature flag, whether it's on, and whether that's its default or was set in the config file
+or the environment.
+*/
+func GetFeatures(w http.ResponseWriter, r *http.Request) {
+	list := flagList{Flags: []flagState{}}
+	for _, state := range live.Load().flags {
+		list.Flags = append(list.Flags, state)
+	}
+	sort.Slice(list.Flags, func(i, j int) bool { return list.Flags[i].Name < list.Flags[j].Name })
+	respond(w, r, http.StatusOK, list)
+}
@@ -0,0 +1,243 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// fieldSet - the Product fields a client asked for with ?fields=; nil means every field.
+type fieldSet map[string]bool
+
+/*
+requestedFields - parses ?fields=, a comma-separated list of field names (case-insensitive), e.g. ?fields=id,name.
+The id is always included, since it identifies the Product. No ?fields= (or an empty one) means every field.
+*/
+func requestedFields(r *http.Request) (fieldSet, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+
+	known := fieldSet{}
+	for _, f := range datastore.ProductFields {
+		known[f] = true
+	}
+	fields := fieldSet{datastore.FieldID: true}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if !known[f] {
+			return nil, fmt.Errorf("Unknown field %q; use %v", f, strings.Join(datastore.ProductFields, ", "))
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+/*
+withFields - passes the fieldset to the backend, so it can avoid reading the other fields. When the Products were
+last updated is read either way, for Last-Modified.
+*/
+func withFields(r *http.Request, fields fieldSet) *http.Request {
+	if fields == nil {
+		return r
+	}
+	names := make([]string, 0, len(fields)+1)
+	for f := range fields {
+		names = append(names, f)
+	}
+	if !fields[datastore.FieldUpdatedAt] {
+		names = append(names, datastore.FieldUpdatedAt)
+	}
+	return r.WithContext(datastore.WithFields(r.Context(), names))
+}
+
+/*
+sparse - trims a response to the requested fields. Unrequested fields are zeroed as well as left out of JSON and
+XML, so protobuf responses (where zero values aren't sent) are trimmed too. Links and included variants are kept;
+they aren't fields.
+*/
+func sparse(v interface{}, fields fieldSet) interface{} {
+	if fields == nil {
+		return v
+	}
+	trim := func(r productResource) productResource {
+		r.fields = fields
+		if !fields[datastore.FieldName] {
+			r.Name, r.NameTranslations = "", nil
+		}
+		if !fields[datastore.FieldPrice] {
+			r.Price = 0
+		}
+		if !fields[datastore.FieldExpiresAt] {
+			r.ExpiresAt = nil
+		}
+		if !fields[datastore.FieldRating] {
+			r.Rating = nil
+		}
+		if !fields[datastore.FieldBarcode] {
+			r.Barcode = ""
+		}
+		if !fields[datastore.FieldSupplier] {
+			r.SupplierId = ""
+		}
+		if !fields[datastore.FieldUpdatedAt] {
+			r.UpdatedAt = nil
+		}
+		if !fields[datastore.FieldDescription] {
+			r.Description, r.DescriptionTranslations = "", nil
+		}
+		if !fields[datastore.FieldStock] {
+			r.Stock = nil
+		}
+		if !fields[datastore.FieldCategory] {
+			r.CategoryId = ""
+		}
+		if !fields[datastore.FieldTags] {
+			r.Tags = nil
+		}
+		return r
+	}
+
+	switch v := v.(type) {
+	case datastore.Product:
+		return trim(productResource{Product: v})
+	case productResource:
+		return trim(v)
+	case productList:
+		list := make(resourceList, len(v))
+		for i, p := range v {
+			list[i] = trim(productResource{Product: p})
+		}
+		return list
+	case resourceList:
+		list := make(resourceList, len(v))
+		for i, r := range v {
+			list[i] = trim(r)
+		}
+		return list
+	case cursorPage:
+		products := make([]productResource, len(v.Products))
+		for i, r := range v.Products {
+			products[i] = trim(r)
+		}
+		v.Products = products
+		return v
+	case searchResults:
+		products := make([]productResource, len(v.Products))
+		for i, r := range v.Products {
+			products[i] = trim(r)
+		}
+		v.Products = products
+		return v
+	case lookupResults:
+		products := make([]productResource, len(v.Products))
+		for i, r := range v.Products {
+			products[i] = trim(r)
+		}
+		v.Products = products
+		return v
+	}
+	return v
+}
+
+// sparseProduct - the JSON and XML form of a productResource with a fieldset.
+type sparseProduct struct {
+	Id        string            `json:"id" xml:"id"`
+	Name      *string           `json:"Name,omitempty" xml:"Name,omitempty"`
+	Price     *datastore.Money  `json:"Price,omitempty" xml:"Price,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+	Rating    *datastore.Rating `json:"rating,omitempty" xml:"rating,omitempty"`
+	Barcode   *string           `json:"barcode,omitempty" xml:"barcode,omitempty"`
+	Supplier  *string           `json:"supplier_id,omitempty" xml:"supplier_id,omitempty"`
+	Category  *string           `json:"category_id,omitempty" xml:"category_id,omitempty"`
+	Tags      []string          `json:"tags,omitempty" xml:"tags>tag,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+	// The translations go with the name and description.
+	NameTranslations        datastore.Translations `json:"name_translations,omitempty" xml:"name_translations,omitempty"`
+	Description             *string                `json:"description,omitempty" xml:"description,omitempty"`
+	DescriptionTranslations datastore.Translations `json:"description_translations,omitempty" xml:"description_translations,omitempty"`
+	Stock                   datastore.StockLevels  `json:"stock,omitempty" xml:"stock,omitempty"`
+	StockTotal              *int                   `json:"stock_total,omitempty" xml:"stock_total,omitempty"`
+	Links                   []link                 `json:"links,omitempty" xml:"link"`
+	Variants                *variantList           `json:"variants,omitempty" xml:"variants,omitempty"`
+}
+
+func (r productResource) sparse() sparseProduct {
+	s := sparseProduct{Id: r.Id, Links: r.Links, Variants: r.Variants}
+	if r.fields[datastore.FieldName] {
+		s.Name, s.NameTranslations = &r.Name, r.NameTranslations
+	}
+	if r.fields[datastore.FieldPrice] {
+		s.Price = &r.Price
+	}
+	if r.fields[datastore.FieldExpiresAt] {
+		s.ExpiresAt = r.ExpiresAt
+	}
+	if r.fields[datastore.FieldRating] {
+		s.Rating = r.Rating
+	}
+	if r.fields[datastore.FieldBarcode] && r.Barcode != "" {
+		s.Barcode = &r.Barcode
+	}
+	if r.fields[datastore.FieldSupplier] && r.SupplierId != "" {
+		s.Supplier = &r.SupplierId
+	}
+	if r.fields[datastore.FieldCategory] && r.CategoryId != "" {
+		s.Category = &r.CategoryId
+	}
+	if r.fields[datastore.FieldTags] {
+		s.Tags = r.Tags
+	}
+	if r.fields[datastore.FieldUpdatedAt] {
+		s.UpdatedAt = r.UpdatedAt
+	}
+	if r.fields[datastore.FieldDescription] && r.Description != "" {
+		s.Description, s.DescriptionTranslations = &r.Description, r.DescriptionTranslations
+	}
+	if r.fields[datastore.FieldStock] {
+		s.Stock, s.StockTotal = r.Stock, stockTotal(r.Stock)
+	}
+	return s
+}
+
+// stockTotal - the total of a Product's stock levels, or nil if it has none to total.
+func stockTotal(stock datastore.StockLevels) *int {
+	if stock == nil {
+		return nil
+	}
+	total := stock.Total()
+	return &total
+}
+
+// plainResource - productResource without its marshalling methods, for encoding every field.
+type plainResource productResource
+
+func (r productResource) MarshalJSON() ([]byte, error) {
+	if r.fields == nil {
+		r.StockTotal = stockTotal(r.Stock)
+		return json.Marshal(plainResource(r))
+	}
+	return json.Marshal(r.sparse())
+}
+
+func (r productResource) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// Always <Product>, as its XMLName says, whatever element a containing list suggests.
+	start.Name = xml.Name{Local: "Product"}
+	if r.fields == nil {
+		r.StockTotal = stockTotal(r.Stock)
+		return e.EncodeElement(plainResource(r), start)
+	}
+	return e.EncodeElement(r.sparse(), start)
+}
@@ -0,0 +1,837 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/dummydb"
+)
+
+// IDs of the records in the test fixture.
+const (
+	fixtureReview      = "11111111-1111-4111-8111-111111111111"
+	fixtureVariant     = "22222222-2222-4222-8222-222222222222"
+	fixtureOrder       = "33333333-3333-4333-8333-333333333333"
+	fixtureCart        = "44444444-4444-4444-8444-444444444444"
+	fixtureCartItem    = "55555555-5555-4555-8555-555555555555"
+	fixtureReservation = "66666666-6666-4666-8666-666666666666"
+	// missingUUID - a well-formed ID that nothing in the fixture has.
+	missingUUID = "99999999-9999-4999-8999-999999999999"
+)
+
+// money - an amount written in a test.
+func money(amount string) datastore.Money {
+	return datastore.MustParseMoney(amount)
+}
+
+/*
+fixtureStore - a fake datastore, in memory, holding Products 1 to 3, and a review, a variant (6 in stock, 1 of them
+reserved), an order, a cart holding one of Product 2, and a reservation for Product 1.
+*/
+func fixtureStore(t *testing.T) datastore.Datastore {
+	t.Helper()
+	store := &dummydb.Products{}
+	ctx := context.Background()
+	products := []datastore.Product{
+		{Name: "Apple", Price: money("0.98"), Barcode: "4006381333931"},
+		{Name: "Orange", Price: money("0.75")},
+		{Name: "Bananas", Price: money("2.25")},
+	}
+	for _, p := range products {
+		id, err := store.NextID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Id = id
+		if err := store.AddProduct(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	later := now.Add(time.Hour)
+	for _, err := range []error{
+		store.AddReview(ctx, datastore.Review{Id: fixtureReview, ProductId: "1", Rating: 4, Comment: "Crisp", CreatedAt: now, UpdatedAt: now}),
+		store.AddVariant(ctx, datastore.Variant{Id: fixtureVariant, ProductId: "1", Size: "L", Stock: 6}),
+		store.Reserve(ctx, datastore.Reservation{Id: fixtureReservation, ProductId: "1", VariantId: fixtureVariant, Quantity: 1, ExpiresAt: later}),
+		store.AddOrder(ctx, datastore.Order{Id: fixtureOrder, Lines: []datastore.OrderLine{{ProductId: "2", Quantity: 2, Price: money("0.75")}}, Total: money("1.5"), CreatedAt: now}),
+		store.PutCart(ctx, datastore.Cart{Id: fixtureCart, Items: []datastore.CartItem{{Id: fixtureCartItem, ProductId: "2", Quantity: 1}}, ExpiresAt: later}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// failing - store, except that each named method fails with its error instead of being called.
+func failing(store datastore.Datastore, errs map[string]error) datastore.Datastore {
+	return datastore.Intercept(store, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		if err, ok := errs[method]; ok {
+			return err
+		}
+		return call(ctx)
+	})
+}
+
+/*
+testServer - the API as main serves it, under cfg, backed by store. The settings configure applies are put back as
+they were when the test finishes, so tests can't affect each other (and mustn't run in parallel).
+*/
+func testServer(t *testing.T, cfg config.Config, store datastore.Datastore) http.Handler {
+	t.Helper()
+	saved := struct {
+		live        *liveSettings
+		strictMode  bool
+		uniqueNames bool
+		strictJSON  bool
+		putPolicy   string
+		cartTTL     time.Duration
+		proxies     []netip.Prefix
+		strategy    datastore.IDStrategy
+		locale      string
+		policies    map[string]cachePolicy
+	}{live.Load(), strictMode, uniqueNames, strictJSON, putPolicy, cartTTL, trustedProxies, datastore.Strategy, defaultLocale, cachePolicies}
+	t.Cleanup(func() {
+		strictMode, uniqueNames, strictJSON = saved.strictMode, saved.uniqueNames, saved.strictJSON
+		putPolicy, cartTTL = saved.putPolicy, saved.cartTTL
+		trustedProxies = saved.proxies
+		live.Store(saved.live)
+		datastore.Strategy = saved.strategy
+		defaultLocale, cachePolicies = saved.locale, saved.policies
+	})
+
+	if err := configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	api, err := newAPI(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newHandler(cfg, api, newRouter(cfg, api))
+}
+
+// newRequest - a request to the API; a body is sent as JSON.
+func newRequest(method, path, body string) *http.Request {
+	if body == "" {
+		return httptest.NewRequest(method, path, nil)
+	}
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// record - the handler's response to r.
+func record(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// do - sends a request without headers of its own to the handler.
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	return record(h, newRequest(method, path, body))
+}
+
+// errorCode - the code in a problem+json error body; "" if the body isn't one.
+func errorCode(w *httptest.ResponseRecorder) string {
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+json") {
+		return ""
+	}
+	var p problem
+	json.Unmarshal(w.Body.Bytes(), &p)
+	return p.Code
+}
+
+// routeCase - a request, and the status (and, for errors, the code) it should get.
+type routeCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	status int
+	code   string
+	// fail - datastore methods that fail, and how.
+	fail map[string]error
+}
+
+// run - runs each case against the fixture, in a store of its own.
+func run(t *testing.T, cfg config.Config, cases []routeCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := fixtureStore(t)
+			if c.fail != nil {
+				store = failing(store, c.fail)
+			}
+			w := do(testServer(t, cfg, store), c.method, c.path, c.body)
+			if w.Code != c.status {
+				t.Fatalf("%v %v: got status %v, want %v; body %s", c.method, c.path, w.Code, c.status, w.Body)
+			}
+			if code := errorCode(w); code != c.code {
+				t.Fatalf("%v %v: got error code %q, want %q; body %s", c.method, c.path, code, c.code, w.Body)
+			}
+		})
+	}
+}
+
+// errUnavailable - a backend outage, as the backends report one.
+var errUnavailable = errors.Join(errors.New("Connection refused"), datastore.ErrUnavailable)
+
+func TestProductRoutes(t *testing.T) {
+	run(t, config.Default(), []routeCase{
+		{name: "list", method: "GET", path: "/v1/products", status: 200},
+		{name: "list root", method: "GET", path: "/v1/", status: 200},
+		{name: "list by name", method: "GET", path: "/v1/products?name=apple", status: 200},
+		{name: "list page", method: "GET", path: "/v1/products?limit=2&offset=1", status: 200},
+		{name: "list bad limit", method: "GET", path: "/v1/products?limit=x", status: 400, code: "invalid_limit"},
+		{name: "list by cursor", method: "GET", path: "/v1/products?cursor=&limit=2", status: 200},
+		{name: "list bad cursor", method: "GET", path: "/v1/products?cursor=nope", status: 400, code: "validation_failed"},
+		{name: "list unknown field", method: "GET", path: "/v1/products?fields=colour", status: 400, code: "validation_failed"},
+		{name: "list backend down", method: "GET", path: "/v1/products", status: 503, code: "service_unavailable", fail: map[string]error{"GetAll": errUnavailable}},
+		{name: "list backend error", method: "GET", path: "/v1/products", status: 500, code: "internal_server_error", fail: map[string]error{"GetAll": errors.New("Boom")}},
+		{name: "list no currency", method: "GET", path: "/v1/products?currency=EUR", status: 400, code: "validation_failed"},
+		{name: "lookup", method: "GET", path: "/v1/products?ids=1,42", status: 200},
+		{name: "lookup by body", method: "POST", path: "/v1/products/lookup", body: `{"ids": ["1", "42"]}`, status: 200},
+		{name: "lookup nothing", method: "GET", path: "/v1/products?ids=", status: 400, code: "no_ids"},
+		{name: "lookup bad ID", method: "POST", path: "/v1/products/lookup", body: `{"ids": ["1", "x"]}`, status: 400, code: "invalid_product_id"},
+		{name: "lookup backend down", method: "GET", path: "/v1/products?ids=1", status: 503, code: "service_unavailable", fail: map[string]error{"GetProducts": errUnavailable}},
+		{name: "count", method: "GET", path: "/v1/products/count", status: 200},
+		{name: "count backend down", method: "GET", path: "/v1/products/count", status: 503, code: "service_unavailable", fail: map[string]error{"Count": errUnavailable}},
+		{name: "search", method: "GET", path: "/v1/products/search?q=aple", status: 200},
+		{name: "export", method: "GET", path: "/v1/products/export.csv", status: 200},
+
+		{name: "get", method: "GET", path: "/v1/product/1", status: 200},
+		{name: "get missing", method: "GET", path: "/v1/product/42", status: 404, code: "product_not_found"},
+		{name: "get invalid ID", method: "GET", path: "/v1/product/abc", status: 404, code: "route_not_found"},
+		{name: "get by barcode", method: "GET", path: "/v1/product/barcode/4006381333931", status: 200},
+		{name: "get by unknown barcode", method: "GET", path: "/v1/product/barcode/5901234123457", status: 404, code: "product_not_found"},
+		{name: "price history", method: "GET", path: "/v1/product/1/price-history", status: 200},
+		{name: "price history missing", method: "GET", path: "/v1/product/42/price-history", status: 404, code: "product_not_found"},
+
+		{name: "create", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 201},
+		{name: "create dry run", method: "POST", path: "/v1/product?dry_run=true", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 204},
+		{name: "create bad JSON", method: "POST", path: "/v1/product", body: `{"Name": `, status: 400, code: "validation_failed"},
+		{name: "create wrong type", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": "cheap"}`, status: 400, code: "validation_failed"},
+		{name: "create trailing data", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5} {"Name": "Lime"}`, status: 400, code: "validation_failed"},
+		{name: "create unknown field", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5, "pricee": 0.6}`, status: 201},
+		{name: "create price too precise", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.12345}`, status: 400, code: "validation_failed"},
+		{name: "create barcode in use", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5, "barcode": "4006381333931"}`, status: 409, code: "barcode_in_use"},
+		{name: "create bad barcode", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5, "barcode": "123"}`, status: 400, code: "validation_failed"},
+		{name: "create without a name", method: "POST", path: "/v1/product", body: `{"Name": " ", "Price": 0.5}`, status: 400, code: "validation_failed"},
+		{name: "create negative price", method: "POST", path: "/v1/product?dry_run=true", body: `{"Name": "Kiwi", "Price": -1}`, status: 400, code: "validation_failed"},
+		{name: "create backend down", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 503, code: "service_unavailable", fail: map[string]error{"AddProduct": errUnavailable}},
+		{name: "create many", method: "POST", path: "/v1/products", body: `[{"Name": "Kiwi", "Price": 0.5}, {"Name": "Lime", "Price": 0.3}]`, status: 201},
+		{name: "create many one invalid", method: "POST", path: "/v1/products", body: `[{"Name": "Kiwi", "Price": 0.5}, {"Name": "", "Price": 0.3}]`, status: 400, code: "validation_failed"},
+
+		{name: "update", method: "PUT", path: "/v1/product/2", body: `{"Name": "Blood Orange", "Price": 1.1}`, status: 200},
+		{name: "update missing", method: "PUT", path: "/v1/product/42", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 404, code: "product_not_found"},
+		{name: "update without a name", method: "PUT", path: "/v1/product/2", body: `{"Price": 1.1}`, status: 400, code: "validation_failed"},
+		{name: "update negative price", method: "PUT", path: "/v1/product/2?dry_run=1", body: `{"Name": "Kiwi", "Price": -1}`, status: 400, code: "validation_failed"},
+		{name: "update dry run", method: "PUT", path: "/v1/product/2?dry_run=1", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 204},
+		{name: "update bad dry run", method: "PUT", path: "/v1/product/2?dry_run=maybe", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 400, code: "invalid_dry_run"},
+		{name: "delete", method: "DELETE", path: "/v1/product/3", status: 204},
+		{name: "delete missing", method: "DELETE", path: "/v1/product/42", status: 404, code: "product_not_found"},
+		{name: "delete conflict", method: "DELETE", path: "/v1/product/3", status: 409, code: "conflict", fail: map[string]error{"DeleteProduct": datastore.ErrConflict}},
+	})
+}
+
+func TestReviewAndVariantRoutes(t *testing.T) {
+	review := "/v1/product/1/reviews/" + fixtureReview
+	variant := "/v1/product/1/variants/" + fixtureVariant
+	run(t, config.Default(), []routeCase{
+		{name: "list reviews", method: "GET", path: "/v1/product/1/reviews", status: 200},
+		{name: "list reviews of a missing product", method: "GET", path: "/v1/product/42/reviews", status: 404, code: "product_not_found"},
+		{name: "get review", method: "GET", path: review, status: 200},
+		{name: "get missing review", method: "GET", path: "/v1/product/1/reviews/" + missingUUID, status: 404, code: "review_not_found"},
+		{name: "create review", method: "POST", path: "/v1/product/1/reviews", body: `{"rating": 5, "comment": "Great"}`, status: 201},
+		{name: "create review out of range", method: "POST", path: "/v1/product/1/reviews", body: `{"rating": 6}`, status: 400, code: "validation_failed"},
+		{name: "create review of a missing product", method: "POST", path: "/v1/product/42/reviews", body: `{"rating": 5}`, status: 404, code: "product_not_found"},
+		{name: "update review", method: "PUT", path: review, body: `{"rating": 2}`, status: 200},
+		{name: "update missing review", method: "PUT", path: "/v1/product/1/reviews/" + missingUUID, body: `{"rating": 2}`, status: 404, code: "review_not_found"},
+		{name: "delete review", method: "DELETE", path: review, status: 204},
+		{name: "delete missing review", method: "DELETE", path: "/v1/product/1/reviews/" + missingUUID, status: 404, code: "review_not_found"},
+
+		{name: "list variants", method: "GET", path: "/v1/product/1/variants", status: 200},
+		{name: "get variant", method: "GET", path: variant, status: 200},
+		{name: "get missing variant", method: "GET", path: "/v1/product/1/variants/" + missingUUID, status: 404, code: "variant_not_found"},
+		{name: "create variant", method: "POST", path: "/v1/product/1/variants", body: `{"size": "S", "stock": 3}`, status: 201},
+		{name: "create variant with negative stock", method: "POST", path: "/v1/product/1/variants", body: `{"size": "S", "stock": -1}`, status: 400, code: "validation_failed"},
+		{name: "create variant of a missing product", method: "POST", path: "/v1/product/42/variants", body: `{"size": "S", "stock": 3}`, status: 404, code: "product_not_found"},
+		{name: "update variant", method: "PUT", path: variant, body: `{"size": "XL", "stock": 2}`, status: 200},
+		{name: "update missing variant", method: "PUT", path: "/v1/product/1/variants/" + missingUUID, body: `{"size": "XL", "stock": 2}`, status: 404, code: "variant_not_found"},
+		{name: "delete variant", method: "DELETE", path: variant, status: 204},
+		{name: "delete missing variant", method: "DELETE", path: "/v1/product/1/variants/" + missingUUID, status: 404, code: "variant_not_found"},
+
+		{name: "merge", method: "POST", path: "/v1/product/1/merge", body: `{"from": "2"}`, status: 200},
+		{name: "merge into itself", method: "POST", path: "/v1/product/1/merge", body: `{"from": "1"}`, status: 400, code: "merge_into_itself"},
+		{name: "merge bad ID", method: "POST", path: "/v1/product/1/merge", body: `{"from": "x"}`, status: 400, code: "invalid_product_id"},
+		{name: "merge missing product", method: "POST", path: "/v1/product/1/merge", body: `{"from": "42"}`, status: 404, code: "product_not_found"},
+		{name: "merge into missing product", method: "POST", path: "/v1/product/42/merge", body: `{"from": "2"}`, status: 404, code: "product_not_found"},
+	})
+}
+
+// TestLookupProducts - a lookup returns the Products in the order asked for, and names the IDs it didn't find.
+func TestLookupProducts(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+	for _, w := range []*httptest.ResponseRecorder{
+		do(h, "GET", "/v1/products?ids=3,42,1&fields=name", ""),
+		do(h, "POST", "/v1/products/lookup?fields=name", `{"ids": ["3", "42", "1"]}`),
+	} {
+		var got struct {
+			Products []struct{ Id, Name string }
+			Missing  []string
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("Lookup: got status %v; body %s", w.Code, w.Body)
+		}
+		if len(got.Products) != 2 || got.Products[0].Name != "Bananas" || got.Products[1].Id != "1" || len(got.Missing) != 1 || got.Missing[0] != "42" {
+			t.Fatalf("Lookup: got %s, want Bananas and Apple, with 42 missing", w.Body)
+		}
+		if strings.Contains(w.Body.String(), "Price") {
+			t.Fatalf("Lookup: got %s, want only names", w.Body)
+		}
+	}
+}
+
+/*
+TestMergeProducts - a merge moves the duplicate's reviews and variants, combining the stock of matching variants, and
+its stock at each location. Repeating merges that failed partway finishes the job without moving any stock twice.
+*/
+func TestMergeProducts(t *testing.T) {
+	store, ctx := fixtureStore(t), context.Background()
+	now := time.Now().UTC()
+	for _, err := range []error{
+		store.AddReview(ctx, datastore.Review{Id: "6f1c2a4e-7d3b-4c8e-9a5f-0b1d2e3f4a5b", ProductId: "2", Rating: 2, CreatedAt: now, UpdatedAt: now}),
+		store.AddVariant(ctx, datastore.Variant{Id: "0e9d8c7b-6a5f-4e3d-8c2b-1a0f9e8d7c6b", ProductId: "2", Size: "l", Stock: 4}),
+		store.AddVariant(ctx, datastore.Variant{Id: "5a4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d", ProductId: "2", Color: "red", Stock: 1}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.AdjustStock(ctx, "1", "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AdjustStock(ctx, "2", "a", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of these fails after taking stock from the duplicate, or after moving everything.
+	adjusted := 0
+	for i, broken := range []datastore.Datastore{
+		failing(store, map[string]error{"UpdateVariant": errors.New("Boom")}),
+		datastore.Intercept(store, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+			if method == "AdjustStock" {
+				if adjusted++; adjusted > 1 {
+					return errors.New("Boom")
+				}
+			}
+			return call(ctx)
+		}),
+		failing(store, map[string]error{"DeleteProduct": errors.New("Boom")}),
+	} {
+		if w := do(testServer(t, config.Default(), broken), "POST", "/v1/product/1/merge", `{"from": "2"}`); w.Code != http.StatusInternalServerError {
+			t.Fatalf("Failing merge %v: got status %v, want 500; body %s", i, w.Code, w.Body)
+		}
+	}
+	h := testServer(t, config.Default(), store)
+
+	w := do(h, "POST", "/v1/product/1/merge", `{"from": "2"}`)
+	var merged datastore.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &merged); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Merge: got status %v; body %s", w.Code, w.Body)
+	}
+	if merged.Name != "Apple" || merged.Rating == nil || merged.Rating.Count != 2 || merged.Rating.Average != 3 {
+		t.Fatalf("Merge: got %s, want Apple rated 3 from 2 reviews", w.Body)
+	}
+	if w := do(h, "GET", "/v1/product/2", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Get duplicate: got status %v, want 404", w.Code)
+	}
+
+	variants, err := store.GetVariants(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stock := map[string]int{}
+	for _, v := range variants {
+		stock[v.Size+v.Color] = v.Stock
+	}
+	if len(variants) != 2 || stock["L"] != 9 || stock["red"] != 1 {
+		t.Fatalf("Variants: got %+v, want L with 9 in stock (one of the fixture's 6 is reserved) and red with 1", variants)
+	}
+	if rest, err := store.GetVariants(ctx, "2"); err != nil || len(rest) != 0 {
+		t.Fatalf("Variants of the duplicate: got %+v, %v; want none", rest, err)
+	}
+	if merged.Stock["a"] != 5 {
+		t.Fatalf("Stock: got %v, want 5 at a", merged.Stock)
+	}
+
+	w = do(h, "GET", "/v1/product/1/merges", "")
+	var got struct {
+		Merges []datastore.MergeRecord `json:"merges"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("Merges: got status %v; body %s", w.Code, w.Body)
+	}
+	if len(got.Merges) != 1 || got.Merges[0].From != "2" || got.Merges[0].FinishedAt == nil || got.Merges[0].Combined != 1 ||
+		got.Merges[0].Stock != 3 || len(got.Merges[0].Moved) != 2 || got.Merges[0].Pending != nil {
+		t.Fatalf("Merges: got %s, want one finished merge from 2, combining 1 variant and moving 3 in stock", w.Body)
+	}
+}
+
+func TestOrderRoutes(t *testing.T) {
+	cart := "/v1/carts/" + fixtureCart
+	reservation := "/v1/reservations/" + fixtureReservation
+	run(t, config.Default(), []routeCase{
+		{name: "reserve", method: "POST", path: "/v1/product/1/reserve", body: `{"variant_id": "` + fixtureVariant + `", "quantity": 2}`, status: 201},
+		{name: "reserve too many", method: "POST", path: "/v1/product/1/reserve", body: `{"variant_id": "` + fixtureVariant + `", "quantity": 99}`, status: 409, code: "out_of_stock"},
+		{name: "reserve without a variant", method: "POST", path: "/v1/product/1/reserve", body: `{"quantity": 1}`, status: 400, code: "variant_required"},
+		{name: "reserve too many at once", method: "POST", path: "/v1/product/1/reserve", body: `{"variant_id": "` + fixtureVariant + `", "quantity": 1000001}`, status: 400, code: "quantity_too_large"},
+		{name: "reserve nothing", method: "POST", path: "/v1/product/1/reserve", body: `{"variant_id": "` + fixtureVariant + `", "quantity": 0}`, status: 400, code: "invalid_quantity"},
+		{name: "get reservation", method: "GET", path: reservation, status: 200},
+		{name: "get missing reservation", method: "GET", path: "/v1/reservations/" + missingUUID, status: 404, code: "reservation_not_found"},
+		{name: "release reservation", method: "DELETE", path: reservation, status: 204},
+		{name: "release missing reservation", method: "DELETE", path: "/v1/reservations/" + missingUUID, status: 404, code: "reservation_not_found"},
+
+		{name: "order", method: "POST", path: "/v1/orders", body: `{"lines": [{"product_id": "1", "variant_id": "` + fixtureVariant + `", "quantity": 2}]}`, status: 201},
+		{name: "order with a reservation", method: "POST", path: "/v1/orders", body: `{"lines": [{"product_id": "1", "variant_id": "` + fixtureVariant + `", "quantity": 1, "reservation_id": "` + fixtureReservation + `"}]}`, status: 201},
+		{name: "order out of stock", method: "POST", path: "/v1/orders", body: `{"lines": [{"product_id": "1", "variant_id": "` + fixtureVariant + `", "quantity": 99}]}`, status: 409, code: "conflict"},
+		{name: "order a missing product", method: "POST", path: "/v1/orders", body: `{"lines": [{"product_id": "42", "quantity": 1}]}`, status: 400, code: "validation_failed"},
+		{name: "order too many", method: "POST", path: "/v1/orders", body: `{"lines": [{"product_id": "3", "quantity": 9000000000000000000}]}`, status: 400, code: "validation_failed"},
+		{name: "order nothing", method: "POST", path: "/v1/orders", body: `{"lines": []}`, status: 400, code: "validation_failed"},
+		{name: "get order", method: "GET", path: "/v1/orders/" + fixtureOrder, status: 200},
+		{name: "get missing order", method: "GET", path: "/v1/orders/" + missingUUID, status: 404, code: "order_not_found"},
+
+		{name: "create cart", method: "POST", path: "/v1/carts", status: 201},
+		{name: "get cart", method: "GET", path: cart, status: 200},
+		{name: "get missing cart", method: "GET", path: "/v1/carts/" + missingUUID, status: 404, code: "cart_not_found"},
+		{name: "add cart item", method: "POST", path: cart + "/items", body: `{"product_id": "3", "quantity": 3}`, status: 200},
+		{name: "add missing product to cart", method: "POST", path: cart + "/items", body: `{"product_id": "42", "quantity": 1}`, status: 400, code: "product_not_found"},
+		{name: "add too many to cart", method: "POST", path: cart + "/items", body: `{"product_id": "2", "quantity": 1000000}`, status: 400, code: "quantity_too_large"},
+		{name: "add nothing to cart", method: "POST", path: cart + "/items", body: `{"product_id": "2", "quantity": 0}`, status: 400, code: "invalid_quantity"},
+		{name: "update cart item", method: "PUT", path: cart + "/items/" + fixtureCartItem, body: `{"quantity": 2}`, status: 200},
+		{name: "update cart item to nothing", method: "PUT", path: cart + "/items/" + fixtureCartItem, body: `{"quantity": 0}`, status: 400, code: "invalid_cart_quantity"},
+		{name: "update missing cart item", method: "PUT", path: cart + "/items/" + missingUUID, body: `{"quantity": 2}`, status: 404, code: "cart_item_not_found"},
+		{name: "remove cart item", method: "DELETE", path: cart + "/items/" + fixtureCartItem, status: 200},
+		{name: "checkout", method: "POST", path: cart + "/checkout", status: 201},
+		{name: "checkout missing cart", method: "POST", path: "/v1/carts/" + missingUUID + "/checkout", status: 404, code: "cart_not_found"},
+		{name: "delete cart", method: "DELETE", path: cart, status: 204},
+		{name: "delete missing cart", method: "DELETE", path: "/v1/carts/" + missingUUID, status: 404, code: "cart_not_found"},
+	})
+}
+
+func TestOrderTotalOverflow(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+	w := do(h, "POST", "/v1/product", `{"Name": "Yacht", "Price": 900000000000000}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST product: got status %v; body %s", w.Code, w.Body)
+	}
+	var p datastore.Product
+	json.Unmarshal(w.Body.Bytes(), &p)
+	w = do(h, "POST", "/v1/orders", `{"lines": [{"product_id": "`+p.Id+`", "quantity": 1000}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST an order whose total overflows: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminAndRouting(t *testing.T) {
+	run(t, config.Default(), []routeCase{
+		{name: "explain", method: "GET", path: "/admin/explain?query=name%3DApple", status: 200},
+		{name: "explain bad sort", method: "GET", path: "/admin/explain?query=sort%3Dnope", status: 400, code: "invalid_sort"},
+		{name: "explain bad filter", method: "GET", path: "/admin/explain?query=filter%3Dprice", status: 400, code: "invalid_filter"},
+		{name: "features", method: "GET", path: "/admin/features", status: 200},
+		{name: "backup without credentials", method: "GET", path: "/admin/backup", status: 403, code: "admin_auth_required"},
+		{name: "dead letters", method: "GET", path: "/admin/jobs/dead-letters", status: 200},
+		{name: "truncate without credentials", method: "DELETE", path: "/admin/products?confirm=true", status: 403, code: "admin_auth_required"},
+		{name: "restore without credentials", method: "POST", path: "/admin/restore", body: `{"version": 1}`, status: 403, code: "admin_auth_required"},
+		{name: "users without credentials", method: "GET", path: "/admin/users", status: 403, code: "admin_auth_required"},
+		{name: "retry without credentials", method: "POST", path: "/admin/jobs/dead-letters/nope/retry", status: 403, code: "admin_auth_required"},
+		{name: "reindex without credentials", method: "POST", path: "/admin/search/reindex", status: 403, code: "admin_auth_required"},
+		{name: "export without credentials", method: "POST", path: "/admin/export", status: 403, code: "admin_auth_required"},
+		{name: "catalog page", method: "GET", path: "/catalog", status: 200},
+		{name: "health", method: "GET", path: "/healthz", status: 200},
+		{name: "datastore down", method: "GET", path: "/healthz", status: 503, fail: map[string]error{"GetProduct": datastore.ErrUnavailable}},
+		{name: "legacy path", method: "GET", path: "/product/1", status: 308},
+		{name: "unknown path", method: "GET", path: "/v1/nothing", status: 404, code: "route_not_found"},
+		{name: "wrong method", method: "PATCH", path: "/v1/product/1", status: 405, code: "method_not_allowed"},
+		{name: "options", method: "OPTIONS", path: "/v1/product/1", status: 204},
+	})
+}
+
+func TestExplainQuery(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+	for _, tc := range []struct {
+		query    string
+		fullScan bool
+		notes    int
+	}{
+		{"name=Apple", false, 0},
+		// A search is applied before a name, as listings apply them.
+		{"q=aple&name=Apple", true, 1},
+		{"name_prefix=App", true, 1},
+		{"sort=-price", true, 0},
+	} {
+		w := do(h, "GET", "/admin/explain?query="+url.QueryEscape(tc.query), "")
+		var plan datastore.QueryPlan
+		json.Unmarshal(w.Body.Bytes(), &plan)
+		if w.Code != http.StatusOK || plan.FullScan != tc.fullScan || len(plan.Notes) != tc.notes {
+			t.Errorf("Explain %q: got status %v, plan %+v", tc.query, w.Code, plan)
+		}
+	}
+}
+
+func TestVerboseHealth(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cache.Enabled = true
+	w := do(testServer(t, cfg, failing(fixtureStore(t), map[string]error{"GetProduct": errors.New("Boom")})), "GET", "/healthz?verbose=true", "")
+
+	var report healthReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil || w.Code != http.StatusServiceUnavailable || report.Status != healthDown {
+		t.Fatalf("Got status %v, report %+v (%v)", w.Code, report, err)
+	}
+	got := map[string]dependencyHealth{}
+	for _, d := range report.Dependencies {
+		got[d.Name] = d
+	}
+	if d := got["datastore"]; d.Status != healthFailing || d.Error != "Boom" || d.LastError != "Boom" || d.LastErrorAt == nil {
+		t.Errorf("Got datastore %+v", d)
+	}
+	if d := got["cache"]; d.Status != healthOK || d.Detail != "0 of 1000 entries" {
+		t.Errorf("Got cache %+v", d)
+	}
+	if d := got["jobs"]; d.Status != healthOK {
+		t.Errorf("Got jobs %+v", d)
+	}
+}
+
+// TestRespondsAsStored - writes respond with the Product as stored: without what the datastore ignores, such as a
+// client's rating and stock, and with what it adds, such as updated_at.
+func TestRespondsAsStored(t *testing.T) {
+	const body = `{"Name": "Kiwi", "Price": 0.5, "rating": {"average": 5, "count": 100}, "updated_at": "2000-01-01T00:00:00Z", "stock": {"` + missingUUID + `": 999}}`
+	cfg := config.Default()
+	cfg.PutPolicy = config.PutUpsert
+	// If reading the Product back fails, the write still succeeded, so it responds with the Product as written.
+	unreadable := map[string]error{"GetProduct": errors.New("Boom"), "GetProducts": errors.New("Boom")}
+
+	for _, store := range []datastore.Datastore{fixtureStore(t), failing(fixtureStore(t), unreadable)} {
+		h := testServer(t, cfg, store)
+		for _, tc := range []struct {
+			method, path string
+		}{
+			{"PUT", "/v1/product/42"},
+			{"POST", "/v1/product"},
+			{"POST", "/v1/products"},
+		} {
+			b := body
+			if tc.path == "/v1/products" {
+				b = "[" + body + "]"
+			}
+			w := do(h, tc.method, tc.path, b)
+			var got map[string]interface{}
+			if tc.path == "/v1/products" {
+				var list []map[string]interface{}
+				json.Unmarshal(w.Body.Bytes(), &list)
+				if len(list) == 1 {
+					got = list[0]
+				}
+			} else {
+				json.Unmarshal(w.Body.Bytes(), &got)
+			}
+			if w.Code != http.StatusCreated || got["Name"] != "Kiwi" || got["rating"] != nil || got["stock"] != nil || got["updated_at"] == "2000-01-01T00:00:00Z" || got["updated_at"] == nil {
+				t.Errorf("%v %v: got status %v; body %s", tc.method, tc.path, w.Code, w.Body)
+			}
+		}
+	}
+}
+
+func TestConfiguredRoutes(t *testing.T) {
+	gone := config.Default()
+	gone.LegacyRoutes = config.LegacyGone
+	run(t, gone, []routeCase{
+		{name: "legacy path gone", method: "GET", path: "/product/1", status: 410, code: "legacy_path_gone"},
+	})
+
+	upsert := config.Default()
+	upsert.PutPolicy = config.PutUpsert
+	run(t, upsert, []routeCase{
+		{name: "upsert", method: "PUT", path: "/v1/product/42", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 201},
+	})
+
+	strictJSON := config.Default()
+	strictJSON.StrictJSON = true
+	run(t, strictJSON, []routeCase{
+		{name: "unknown field", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "pricee": 0.5}`, status: 400, code: "validation_failed"},
+		{name: "unknown review field", method: "POST", path: "/v1/product/1/reviews", body: `{"rating": 5, "coment": "Crisp"}`, status: 400, code: "validation_failed"},
+		{name: "known fields", method: "POST", path: "/v1/product", body: `{"Name": "Kiwi", "Price": 0.5}`, status: 201},
+	})
+
+	tenants := config.Default()
+	tenants.Tenancy = config.Tenancy{Enabled: true, Tenants: []string{"acme"}}
+	run(t, tenants, []routeCase{
+		{name: "no tenant", method: "GET", path: "/v1/products", status: 400, code: "tenant_required"},
+	})
+
+	noSearch := config.Default()
+	noSearch.Features = map[string]bool{featureSearch: false}
+	run(t, noSearch, []routeCase{
+		{name: "search switched off", method: "GET", path: "/v1/products/search?q=apple", status: 404, code: "route_not_found"},
+	})
+
+	chaos := config.Default()
+	chaos.Chaos.Routes = map[string]config.Fault{"GET /v1/product/{id}": {ErrorRate: 1, Status: 500}}
+	run(t, chaos, []routeCase{
+		{name: "fault injected", method: "GET", path: "/v1/product/1", status: 500, code: "fault_injected"},
+		{name: "no fault", method: "GET", path: "/v1/products", status: 200},
+	})
+}
+
+// TestProductLifecycle - a Product created through the API can be read, changed and deleted through it.
+func TestProductLifecycle(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	w := do(h, "POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Create: got status %v; body %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if location != "/v1/product/4" {
+		t.Fatalf("Create: got Location %q, want /v1/product/4", location)
+	}
+
+	w = do(h, "PUT", location, `{"Name": "Gold Kiwi", "Price": 0.8}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Update: got status %v; body %s", w.Code, w.Body)
+	}
+	w = do(h, "GET", location, "")
+	var p datastore.Product
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Name != "Gold Kiwi" || p.Price != money("0.8") {
+		t.Fatalf("Get after update: got %s (%v)", w.Body, err)
+	}
+
+	if w = do(h, "DELETE", location, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got status %v; body %s", w.Code, w.Body)
+	}
+	if w = do(h, "GET", location, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Get after delete: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+// TestExactPrices - prices add up exactly, where float64 would be off: three at 0.1 cost 0.3.
+func TestExactPrices(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	if w := do(h, "POST", "/v1/product", `{"Name": "Gum", "Price": 0.1}`); w.Code != http.StatusCreated {
+		t.Fatalf("Create: got status %v; body %s", w.Code, w.Body)
+	}
+	w := do(h, "POST", "/v1/orders", `{"lines": [{"product_id": "4", "quantity": 3}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Order: got status %v; body %s", w.Code, w.Body)
+	}
+	var order struct {
+		Total json.Number `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil || order.Total != "0.3" {
+		t.Fatalf("Order: got %s (%v), want a total of 0.3", w.Body, err)
+	}
+}
+
+// TestSortedListings - ?sort= orders listings by several fields, and Products it can't tell apart come in ID order.
+func TestSortedListings(t *testing.T) {
+	store := fixtureStore(t)
+	if err := store.AddProduct(context.Background(), datastore.Product{Id: "4", Name: "Kiwi", Price: money("0.98")}); err != nil {
+		t.Fatal(err)
+	}
+	h := testServer(t, config.Default(), store)
+
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{"", "3 1 4 2"},
+		{"?sort=price,-name", "2 4 1 3"},
+		{"?sort=-name", "2 4 3 1"},
+		{"?sort=-price&limit=2&offset=1", "1 4"},
+		{"?sort=price&fields=id", "2 1 4 3"},
+	} {
+		w := do(h, "GET", "/v1/products"+c.query, "")
+		var products []datastore.Product
+		if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+			t.Fatalf("GET %v: got %s (%v)", c.query, w.Body, err)
+		}
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.Id)
+		}
+		if got := strings.Join(ids, " "); got != c.want {
+			t.Errorf("GET %v: got IDs %v, want %v", c.query, got, c.want)
+		}
+	}
+
+	run(t, config.Default(), []routeCase{
+		{name: "unknown sort field", method: "GET", path: "/v1/products?sort=colour", status: 400, code: "invalid_sort"},
+		{name: "sort with a cursor", method: "GET", path: "/v1/products?sort=name&cursor=", status: 400, code: "validation_failed"},
+	})
+}
+
+// TestFilteredListings - ?filter= selects Products with an RSQL expression, for listings and counts alike.
+func TestFilteredListings(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	for _, c := range []struct {
+		filter string
+		want   string
+	}{
+		{"price=gt=0.80", "3 1"},
+		{"name==*AN*", "3 2"},
+		{"name==apple,price=lt=0.8", "1 2"},
+		{"(name==b*,name==o*);price=ge=1", "3"},
+		{"name=out=(apple,orange)&sort=name&fields=id", "3"},
+		{"barcode==4006381333931", "1"},
+		{"name=='no%20such%20thing'", ""},
+	} {
+		w := do(h, "GET", "/v1/products?filter="+c.filter, "")
+		var products []datastore.Product
+		if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+			t.Fatalf("GET filter=%v: got %s (%v)", c.filter, w.Body, err)
+		}
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.Id)
+		}
+		if got := strings.Join(ids, " "); got != c.want {
+			t.Errorf("GET filter=%v: got IDs %v, want %v", c.filter, got, c.want)
+		}
+	}
+	if w := do(h, "GET", "/v1/products/count?filter=price=gt=0.80", ""); !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Errorf("Count: got %s, want 2", w.Body)
+	}
+
+	run(t, config.Default(), []routeCase{
+		{name: "unknown field", method: "GET", path: "/v1/products?filter=colour==red", status: 400, code: "invalid_filter"},
+		{name: "bad price", method: "GET", path: "/v1/products?filter=price=gt=cheap", status: 400, code: "invalid_filter"},
+		{name: "unbalanced", method: "GET", path: "/v1/products?filter=(name==a", status: 400, code: "invalid_filter"},
+		{name: "with name", method: "GET", path: "/v1/products?filter=price=gt=1&name=apple", status: 400, code: "filter_combined"},
+		{name: "with a cursor", method: "GET", path: "/v1/products?filter=price=gt=1&cursor=", status: 400, code: "validation_failed"},
+		{name: "count", method: "GET", path: "/v1/products/count?filter=name==x", status: 200},
+		{name: "count invalid", method: "GET", path: "/v1/products/count?filter=name", status: 400, code: "invalid_filter"},
+		{name: "backend down", method: "GET", path: "/v1/products?filter=price=gt=1", status: 503, code: "service_unavailable", fail: map[string]error{"FilterProducts": errUnavailable}},
+	})
+}
+
+func TestHead(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+	for _, path := range []string{"/v1/product/1", "/v1/products", "/v1/products?fields=name"} {
+		get, head := do(h, "GET", path, ""), do(h, "HEAD", path, "")
+		if head.Code != http.StatusOK || head.Body.Len() != 0 {
+			t.Fatalf("HEAD %v: got %v with %v bytes, want 200 without a body", path, head.Code, head.Body.Len())
+		}
+		for _, header := range []string{"ETag", "Content-Length", "Last-Modified"} {
+			if got, want := head.Header().Get(header), get.Header().Get(header); got == "" || got != want {
+				t.Errorf("HEAD %v: got %v %q, want %q as for GET", path, header, got, want)
+			}
+		}
+		if got := get.Header().Get("Content-Length"); got != strconv.Itoa(get.Body.Len()) {
+			t.Errorf("GET %v: got Content-Length %v for %v bytes", path, got, get.Body.Len())
+		}
+	}
+
+	before := do(h, "HEAD", "/v1/product/1", "").Header().Get("ETag")
+	do(h, "PUT", "/v1/product/1", `{"Name": "Apple", "Price": 1.05}`)
+	if after := do(h, "HEAD", "/v1/product/1", "").Header().Get("ETag"); after == before {
+		t.Errorf("ETag %v didn't change with the Product", after)
+	}
+	if w := do(h, "HEAD", "/v1/product/99", ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD of a missing Product: got %v, want 404", w.Code)
+	}
+}
+
+func TestLocalizedContent(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+	body := `{"Name": "Apple", "Price": 0.98, "description": "Crisp and sweet",
+		"name_translations": {"fr": "Pomme", "de": "Apfel"}, "description_translations": {"fr": "Croquante et sucrée"}}`
+	if w := do(h, "PUT", "/v1/product/1", body); w.Code != http.StatusOK {
+		t.Fatalf("PUT: got %v %s", w.Code, w.Body)
+	}
+
+	for _, c := range []struct {
+		path, acceptLanguage, name, description, language string
+	}{
+		{"/v1/product/1", "fr-CA, en;q=0.5", "Pomme", "Croquante et sucrée", "fr"},
+		{"/v1/product/1", "de", "Apfel", "Crisp and sweet", "de"},
+		{"/v1/product/1", "en-GB, fr;q=0.8", "Apple", "Crisp and sweet", "en"},
+		{"/v1/product/1", "it", "Apple", "Crisp and sweet", "en"},
+		{"/v1/product/1?locale=de", "fr", "Apfel", "Crisp and sweet", "de"},
+	} {
+		r := newRequest("GET", c.path, "")
+		r.Header.Set("Accept-Language", c.acceptLanguage)
+		w := record(h, r)
+		var p datastore.Product
+		json.Unmarshal(w.Body.Bytes(), &p)
+		if p.Name != c.name || p.Description != c.description || w.Header().Get("Content-Language") != c.language {
+			t.Errorf("GET %v in %v: got %q, %q in %v, want %q, %q in %v", c.path, c.acceptLanguage,
+				p.Name, p.Description, w.Header().Get("Content-Language"), c.name, c.description, c.language)
+		}
+		if p.NameTranslations["de"] != "Apfel" {
+			t.Errorf("GET %v: got name_translations %v, want them all", c.path, p.NameTranslations)
+		}
+	}
+
+	r := newRequest("GET", "/v1/products?name=apple", "")
+	r.Header.Set("Accept-Language", "fr")
+	if w := record(h, r); !strings.Contains(w.Body.String(), `"Name":"Pomme"`) {
+		t.Errorf("Listing in French: got %s", w.Body)
+	}
+
+	run(t, config.Default(), []routeCase{
+		{name: "invalid locale", method: "GET", path: "/v1/product/1?locale=not%20a%20locale", status: 400, code: "invalid_locale"},
+		{name: "invalid translation locale", method: "PUT", path: "/v1/product/1", body: `{"Name": "Apple", "Price": 1, "name_translations": {"french": "Pomme"}}`, status: 400, code: "validation_failed"},
+		{name: "blank translation", method: "PUT", path: "/v1/product/1", body: `{"Name": "Apple", "Price": 1, "name_translations": {"fr": " "}}`, status: 400, code: "validation_failed"},
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	cfg := config.Default()
+	cfg.CacheControl.Listings = "public, max-age=30"
+	cfg.CacheControl.Products = "public, max-age=300, stale-while-revalidate=60"
+	h := testServer(t, cfg, fixtureStore(t))
+
+	for _, c := range []struct {
+		method, path, body, cacheControl string
+	}{
+		{"GET", "/v1/products", "", cfg.CacheControl.Listings},
+		{"HEAD", "/v1/products", "", cfg.CacheControl.Listings},
+		{"GET", "/v1/product/1", "", cfg.CacheControl.Products},
+		{"GET", "/v1/product/1/reviews", "", cfg.CacheControl.Products},
+		{"GET", "/admin/features", "", "no-store"},
+		{"GET", "/v1/product/99", "", ""},
+		{"PUT", "/v1/product/1", `{"Name": "Apple", "Price": 1.05}`, ""},
+	} {
+		w := do(h, c.method, c.path, c.body)
+		if got := w.Header().Get("Cache-Control"); got != c.cacheControl {
+			t.Errorf("%v %v: got Cache-Control %q, want %q", c.method, c.path, got, c.cacheControl)
+		}
+		if expires := w.Header().Get("Expires"); strings.Contains(c.cacheControl, "max-age") != (expires != "") {
+			t.Errorf("%v %v: got Expires %q with Cache-Control %q", c.method, c.path, expires, c.cacheControl)
+		}
+	}
+
+	cfg.CacheControl.Listings = "max-age=soon"
+	if err := configure(cfg); err == nil {
+		t.Error("configure accepted an invalid max-age")
+	}
+}
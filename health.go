@@ -0,0 +1,172 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/cache"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// healthTimeout - how long a dependency's check may take before it counts as failing.
+const healthTimeout = 2 * time.Second
+
+// healthProbeID - the Product the datastore check reads. It needn't exist: not found is as healthy an answer as any.
+const healthProbeID = "0"
+
+const (
+	// healthOK - everything is working.
+	healthOK = "ok"
+	// healthDegraded - the API is serving, but something it only needs for some requests is failing.
+	healthDegraded = "degraded"
+	// healthDown - a dependency every request needs is failing.
+	healthDown = "down"
+	// healthFailing - the status of a failing dependency.
+	healthFailing = "failing"
+)
+
+/*
+dependency - something the API relies on, with a check of whether it's working. The last error its check found is
+kept, so a dependency that's flapping shows it even when the latest check passed.
+*/
+type dependency struct {
+	name string
+	// critical - whether the API is down, rather than degraded, while this is failing.
+	critical bool
+	// check - returns an optional detail, e.g. a size, or why the dependency isn't working.
+	check func(ctx context.Context) (string, error)
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt *time.Time
+}
+
+// dependencyHealth - the result of a dependency's check.
+type dependencyHealth struct {
+	Name        string     `json:"name" xml:"name,attr"`
+	Status      string     `json:"status" xml:"status,attr"`
+	Critical    bool       `json:"critical" xml:"critical,attr"`
+	LatencyMS   float64    `json:"latency_ms" xml:"latency_ms,attr"`
+	Detail      string     `json:"detail,omitempty" xml:"detail,omitempty"`
+	Error       string     `json:"error,omitempty" xml:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty" xml:"last_error_at,omitempty"`
+}
+
+// run - checks the dependency, giving up after healthTimeout.
+func (d *dependency) run(ctx context.Context) dependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := d.check(ctx)
+	result := dependencyHealth{
+		Name:      d.name,
+		Status:    healthOK,
+		Critical:  d.critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		now := time.Now().UTC()
+		result.Status, result.Error = healthFailing, err.Error()
+		d.lastError, d.lastErrorAt = err.Error(), &now
+	}
+	result.LastError, result.LastErrorAt = d.lastError, d.lastErrorAt
+	return result
+}
+
+/*
+newDependencies - the checks of what an API built by newAPI relies on. The datastore check reads backend directly,
+not through the cache, and for the first tenant, since every tenant's tables are in the same place.
+*/
+func newDependencies(cfg config.Config, backend datastore.Datastore, api *API, readCache *cache.Store) []*dependency {
+	tenant := cfg.Tenancy.Names()[0]
+	deps := []*dependency{{
+		name:     "datastore",
+		critical: true,
+		check: func(ctx context.Context) (string, error) {
+			err := backend.GetProduct(datastore.IDsOnly(datastore.WithTenant(ctx, tenant)), &datastore.Product{Id: healthProbeID})
+			if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+				return "", err
+			}
+			return "", nil
+		},
+	}}
+	if readCache != nil {
+		deps = append(deps, &dependency{name: "cache", check: func(ctx context.Context) (string, error) {
+			return fmt.Sprintf("%v of %v entries", readCache.Len(), cfg.Cache.Size), nil
+		}})
+	}
+	if api.Index != nil {
+		deps = append(deps, &dependency{name: "search", check: func(ctx context.Context) (string, error) {
+			return "", api.Index.Index.Ping(datastore.WithTenant(ctx, tenant))
+		}})
+	}
+	deps = append(deps, &dependency{name: "jobs", check: func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("%v dead-lettered", len(api.Jobs.DeadLetters())), api.Jobs.Ping(ctx)
+	}})
+	if api.Exporter != nil {
+		deps = append(deps, &dependency{name: "export", check: func(ctx context.Context) (string, error) {
+			return "", api.Exporter.ping(ctx)
+		}})
+	}
+	return deps
+}
+
+// healthReport - the body of a health check response; Dependencies are only listed when asked for.
+type healthReport struct {
+	XMLName      xml.Name           `json:"-" xml:"health"`
+	Status       string             `json:"status" xml:"status,attr"`
+	Dependencies []dependencyHealth `json:"dependencies,omitempty" xml:"dependency"`
+}
+
+/*
+Health - whether the API is working: 200 if it's ok or degraded (a dependency only some requests need is failing),
+and 503 if it's down. Every dependency is checked at once; ?verbose=true lists each one's status, latency and errors.
+*/
+func (a *API) Health(w http.ResponseWriter, r *http.Request) {
+	results := make([]dependencyHealth, len(a.Dependencies))
+	var wg sync.WaitGroup
+	for i, d := range a.Dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = d.run(r.Context())
+		}()
+	}
+	wg.Wait()
+
+	report := healthReport{Status: healthOK}
+	for _, result := range results {
+		switch {
+		case result.Status == healthOK:
+		case result.Critical:
+			report.Status = healthDown
+		case report.Status == healthOK:
+			report.Status = healthDegraded
+		}
+	}
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		report.Dependencies = results
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if report.Status == healthDown {
+		status = http.StatusServiceUnavailable
+	}
+	respond(w, r, status, report)
+}
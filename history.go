@@ -0,0 +1,53 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+priceHistory - the response to a price history request: the Product's prices, oldest first, each with the time
+it took effect.
+*/
+type priceHistory struct {
+	XMLName xml.Name               `json:"-" xml:"price_history"`
+	Id      string                 `json:"id" xml:"id,attr"`
+	Prices  []datastore.PricePoint `json:"prices" xml:"point"`
+}
+
+/*
+GetPriceHistory - every price a Product has had since it was added.
+*/
+func (a *API) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	p := datastore.Product{Id: id}
+	if err = a.Store.GetProduct(datastore.IDsOnly(r.Context()), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	prices, err := a.Store.PriceHistory(r.Context(), id)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	amounts := make([]*datastore.Money, len(prices))
+	for i := range prices {
+		amounts[i] = &prices[i].Price
+	}
+	if status, err := inCurrency(w, r, amounts...); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	respond(w, r, http.StatusOK, priceHistory{Id: id, Prices: prices})
+}
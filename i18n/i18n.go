@@ -0,0 +1,144 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package i18n localizes the API's error messages.
+
+An error created with Errorf carries a stable, machine-readable code along with its English message. The message is
+looked up by code in the client's preferred language (from Accept-Language) and filled in with the same arguments;
+a code with no translation, or an error without a code, keeps its English text. Codes never change between
+languages or releases, so clients should match on the code rather than the message.
+*/
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default - the language of the messages in the code, used when the client accepts nothing better.
+const Default = "en"
+
+/*
+Error - an error with a code identifying what went wrong, whatever language it's described in.
+*/
+type Error struct {
+	Code string
+	Args []interface{}
+	msg  string
+}
+
+// Errorf - an Error with the given code and English message; the args are kept for translating it.
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Args: args, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Coder - an error with a stable code, such as an Error, or a datastore error like "product_not_found".
+type Coder interface {
+	ErrorCode() string
+}
+
+// ErrorCode - the error's code.
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+/*
+Code - the error's code, or for an error without one, a code for the status it was reported with: "validation_failed"
+for a 400 or 422, otherwise named after the status, e.g. "not_found".
+*/
+func Code(err error, status int) string {
+	var coded Coder
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	if status == http.StatusBadRequest || status == http.StatusUnprocessableEntity {
+		return "validation_failed"
+	}
+	text := strings.ToLower(http.StatusText(status))
+	return strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text)
+}
+
+// Languages - the languages there are translations for, besides Default.
+func Languages() []string {
+	langs := make([]string, 0, len(messages))
+	for lang := range messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+/*
+Negotiate - the supported language the Accept-Language header prefers, going by quality values and then order.
+Regional variants fall back to their language ("fr-CA" gets French), and a header naming nothing supported gets Default.
+*/
+func Negotiate(acceptLanguage string) string {
+	for _, tag := range Preferences(acceptLanguage) {
+		lang, _, _ := strings.Cut(tag, "-")
+		if _, ok := messages[lang]; ok || lang == Default {
+			return lang
+		}
+	}
+	return Default
+}
+
+/*
+Preferences - the language tags in an Accept-Language header, in lower case, most preferred first: by quality value
+and then order. Tags with a quality of 0 or one that can't be read, and the "*" wildcard, are left out.
+*/
+func Preferences(acceptLanguage string) []string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+	prefs := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && tag != "*" && q > 0 {
+			prefs = append(prefs, preference{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	tags := make([]string, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+// Message - err's message in lang, if it has a code with a translation; otherwise its own (English) message.
+func Message(lang string, err error) string {
+	var coded *Error
+	if errors.As(err, &coded) {
+		if format, ok := messages[lang][coded.Code]; ok {
+			return fmt.Sprintf(format, coded.Args...)
+		}
+	}
+	return err.Error()
+}
+
+// Title - the name of an HTTP status in lang, falling back to the standard English one.
+func Title(lang string, status int) string {
+	if title, ok := titles[lang][status]; ok {
+		return title
+	}
+	return http.StatusText(status)
+}
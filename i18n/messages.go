@@ -0,0 +1,251 @@
+/*
+Author: Jason Payne
+*/
+package i18n
+
+import "net/http"
+
+/*
+messages - translations of the coded error messages, by language and then code. Each takes the same arguments, in
+the same order, as the English message it translates.
+*/
+var messages = map[string]map[string]string{
+	"es": {
+		"invalid_product_id":          "ID de producto no válido %q",
+		"route_not_found":             "No hay ningún recurso en %v",
+		"method_not_allowed":          "El método %v no está permitido; use uno de %v",
+		"legacy_path_gone":            "Las rutas sin versión se han eliminado; use %v%v en su lugar",
+		"tenant_required":             "La cabecera %v es obligatoria",
+		"unknown_tenant":              "Inquilino desconocido %q",
+		"tenant_forbidden":            "%v no puede usar el inquilino %q",
+		"invalid_tenant":              "Nombre de inquilino no válido %q; use hasta 32 letras minúsculas, dígitos y guiones",
+		"unauthorized":                "Se requiere autenticación",
+		"request_timeout":             "La solicitud tardó más de %v",
+		"forbidden":                   "%v necesita el rol %v",
+		"csrf_token_invalid":          "Se requiere una cabecera %v válida que coincida con la cookie %v",
+		"admin_auth_required":         "%v requiere autenticación; configure auth o un token de administración",
+		"invalid_role":                "Rol no válido %q; use %v, %v o %v",
+		"password_too_short":          "Las contraseñas deben tener al menos %v caracteres",
+		"invalid_user_name":           "Nombre de usuario no válido %q; use hasta 64 letras, dígitos, puntos, guiones, guiones bajos y @",
+		"invalid_user_kind":           "Tipo no válido %q; use %v o %v",
+		"user_configured":             "%v está en el archivo de configuración, por lo que no se puede gestionar aquí",
+		"signing_not_enabled":         "La firma de solicitudes no está activada; configure primero un cliente hmac",
+		"rate_limited":                "Demasiadas solicitudes; inténtelo de nuevo más tarde",
+		"invalid_limit":               "Límite no válido %q; use de 1 a %v",
+		"invalid_offset":              "Desplazamiento no válido %q",
+		"invalid_page":                "Página no válida %q",
+		"invalid_sort":                "Orden no válido %q: %v",
+		"invalid_replace":             "Valor de replace no válido %q",
+		"confirmation_required":       "Vaciar el catálogo borra todos los productos; añada ?confirm=true para continuar",
+		"merge_into_itself":           "Un producto no se puede fusionar consigo mismo",
+		"invalid_dry_run":             "Valor de dry_run no válido %q; use true o false",
+		"invalid_consistent":          "Valor de consistent no válido %q; use true o false",
+		"invalid_snapshot":            "Error al leer la instantánea: %v",
+		"unsupported_media_type":      "Content-Type no admitido; envíe application/json, application/vnd.api+json, application/xml o application/x-protobuf",
+		"unsupported_encoding":        "Content-Encoding %q no admitido; envíe el cuerpo sin comprimir o con gzip",
+		"invalid_since":               "since %q no válido; use una marca de tiempo RFC 3339 o un next_token",
+		"changes_expired":             "Los cambios solo se conservan %v días; vuelva a descargar el catálogo",
+		"not_acceptable":              "No aceptable; la API puede responder con application/json, application/vnd.api+json, application/xml o application/x-protobuf",
+		"unsupported_import":          "Formato de importación no admitido; suba un archivo .csv, .json o .ndjson, o envíe text/csv, application/json o application/x-ndjson",
+		"import_too_large":            "Se pueden importar como máximo %v filas a la vez",
+		"bulk_too_large":              "Se pueden crear como máximo %v productos a la vez, contando cada código de barras y cada nombre único como otro más",
+		"cart_item_not_found":         "El artículo <%v> no está en el carrito <%v>",
+		"invalid_quantity":            "La cantidad debe ser al menos 1",
+		"quantity_too_large":          "La cantidad debe ser como máximo %v",
+		"invalid_cart_quantity":       "La cantidad debe ser al menos 1; quite el artículo en su lugar",
+		"cart_full":                   "Un carrito puede contener como máximo %v artículos",
+		"cart_empty":                  "El carrito <%v> está vacío",
+		"variant_required":            "Solo las variantes controlan existencias; elija una con variant_id",
+		"invalid_reservation_minutes": "Los minutos deben estar entre 1 y %v",
+		"invalid_stock_adjustment":    "El ajuste debe ser un número entero distinto de cero, de como máximo %v en cualquier sentido",
+		"location_in_use":             "La ubicación <%v> aún tiene existencias de %v productos; retírelas primero",
+		"record_in_use":               "%v <%v> todavía está asignado a %v productos; reasígnelos primero",
+		"usage_not_enabled":           "Los análisis de uso no están activados",
+		"invalid_usage_time":          "%v %q no válido; use una marca de tiempo RFC 3339",
+		"invalid_usage_period":        "from debe ser anterior a to",
+		"search_index_not_configured": "No hay ningún índice de búsqueda configurado",
+		"export_not_configured":       "No hay ningún bucket de exportación configurado",
+		"filter_combined":             "El parámetro filter no se puede combinar con q, name o name_prefix",
+		"invalid_filter":              "Filtro no válido %q: %v",
+		"no_ids":                      "No se indicó ningún ID de producto",
+		"too_many_ids":                "Se pueden consultar como máximo %v ID de producto a la vez",
+		"price_alerts_not_enabled":    "Las alertas de precio no están activadas",
+		"fault_injected":              "Fallo inyectado para pruebas",
+		"invalid_locale":              "Configuración regional no válida %q; use una etiqueta de idioma como fr o pt-BR",
+	},
+	"fr": {
+		"invalid_product_id":          "Identifiant de produit non valide %q",
+		"route_not_found":             "Aucune ressource à %v",
+		"method_not_allowed":          "La méthode %v n'est pas autorisée ; utilisez l'une de %v",
+		"legacy_path_gone":            "Les chemins sans version ont été supprimés ; utilisez %v%v à la place",
+		"tenant_required":             "L'en-tête %v est obligatoire",
+		"unknown_tenant":              "Locataire inconnu %q",
+		"tenant_forbidden":            "%v ne peut pas utiliser le locataire %q",
+		"invalid_tenant":              "Nom de locataire non valide %q ; utilisez jusqu'à 32 lettres minuscules, chiffres et tirets",
+		"unauthorized":                "Authentification requise",
+		"request_timeout":             "La requête a pris plus de %v",
+		"forbidden":                   "%v a besoin du rôle %v",
+		"csrf_token_invalid":          "Un en-tête %v valide, correspondant au cookie %v, est requis",
+		"admin_auth_required":         "%v nécessite une authentification ; configurez auth ou un jeton d'administration",
+		"invalid_role":                "Rôle non valide %q ; utilisez %v, %v ou %v",
+		"password_too_short":          "Les mots de passe doivent comporter au moins %v caractères",
+		"invalid_user_name":           "Nom d'utilisateur non valide %q ; utilisez jusqu'à 64 lettres, chiffres, points, tirets, tirets bas et @",
+		"invalid_user_kind":           "Type non valide %q ; utilisez %v ou %v",
+		"user_configured":             "%v figure dans le fichier de configuration et ne peut donc pas être géré ici",
+		"signing_not_enabled":         "La signature des requêtes n'est pas activée ; configurez d'abord un client hmac",
+		"rate_limited":                "Trop de requêtes ; réessayez plus tard",
+		"invalid_limit":               "Limite non valide %q ; utilisez une valeur de 1 à %v",
+		"invalid_offset":              "Décalage non valide %q",
+		"invalid_page":                "Page non valide %q",
+		"invalid_sort":                "Tri non valide %q : %v",
+		"invalid_replace":             "Valeur de replace non valide %q",
+		"confirmation_required":       "Vider le catalogue supprime tous les produits ; ajoutez ?confirm=true pour continuer",
+		"merge_into_itself":           "Un produit ne peut pas être fusionné avec lui-même",
+		"invalid_dry_run":             "Valeur de dry_run non valide %q ; utilisez true ou false",
+		"invalid_consistent":          "Valeur de consistent non valide %q ; utilisez true ou false",
+		"invalid_snapshot":            "Erreur de lecture de l'instantané : %v",
+		"unsupported_media_type":      "Content-Type non pris en charge ; envoyez application/json, application/vnd.api+json, application/xml ou application/x-protobuf",
+		"unsupported_encoding":        "Content-Encoding %q non pris en charge ; envoyez le corps non compressé ou en gzip",
+		"invalid_since":               "since %q invalide ; utilisez un horodatage RFC 3339 ou un next_token",
+		"changes_expired":             "Les modifications ne sont conservées que %v jours ; téléchargez à nouveau le catalogue",
+		"not_acceptable":              "Non acceptable ; l'API peut répondre en application/json, application/vnd.api+json, application/xml ou application/x-protobuf",
+		"unsupported_import":          "Format d'importation non pris en charge ; téléversez un fichier .csv, .json ou .ndjson, ou envoyez text/csv, application/json ou application/x-ndjson",
+		"import_too_large":            "Au plus %v lignes peuvent être importées à la fois",
+		"bulk_too_large":              "Au plus %v produits peuvent être créés à la fois, chaque code-barres et chaque nom unique comptant pour un de plus",
+		"cart_item_not_found":         "L'article <%v> n'est pas dans le panier <%v>",
+		"invalid_quantity":            "La quantité doit être d'au moins 1",
+		"quantity_too_large":          "La quantité doit être au plus %v",
+		"invalid_cart_quantity":       "La quantité doit être d'au moins 1 ; retirez plutôt l'article",
+		"cart_full":                   "Un panier peut contenir au plus %v articles",
+		"cart_empty":                  "Le panier <%v> est vide",
+		"variant_required":            "Seules les variantes gèrent un stock ; choisissez-en une avec variant_id",
+		"invalid_reservation_minutes": "Les minutes doivent être comprises entre 1 et %v",
+		"invalid_stock_adjustment":    "L'ajustement doit être un entier non nul d'au plus %v dans un sens ou dans l'autre",
+		"location_in_use":             "L'emplacement <%v> contient encore du stock de %v produits ; retirez-le d'abord",
+		"record_in_use":               "%v <%v> est encore attribué à %v produits ; réattribuez-les d'abord",
+		"usage_not_enabled":           "Les statistiques d'utilisation ne sont pas activées",
+		"invalid_usage_time":          "%v %q non valide ; utilisez un horodatage RFC 3339",
+		"invalid_usage_period":        "from doit précéder to",
+		"search_index_not_configured": "Aucun index de recherche n'est configuré",
+		"export_not_configured":       "Aucun bucket d'exportation n'est configuré",
+		"filter_combined":             "Le paramètre filter ne peut pas être combiné avec q, name ou name_prefix",
+		"invalid_filter":              "Filtre non valide %q : %v",
+		"no_ids":                      "Aucun ID de produit n'a été fourni",
+		"too_many_ids":                "Au plus %v ID de produits peuvent être recherchés à la fois",
+		"price_alerts_not_enabled":    "Les alertes de prix ne sont pas activées",
+		"fault_injected":              "Panne injectée pour les tests",
+		"invalid_locale":              "Paramètre régional non valide %q ; utilisez une balise de langue comme fr ou pt-BR",
+	},
+	"de": {
+		"invalid_product_id":          "Ungültige Produkt-ID %q",
+		"route_not_found":             "Keine Ressource unter %v",
+		"method_not_allowed":          "Die Methode %v ist nicht erlaubt; verwenden Sie eine von %v",
+		"legacy_path_gone":            "Pfade ohne Version wurden entfernt; verwenden Sie stattdessen %v%v",
+		"tenant_required":             "Der Header %v ist erforderlich",
+		"unknown_tenant":              "Unbekannter Mandant %q",
+		"tenant_forbidden":            "%v darf den Mandanten %q nicht verwenden",
+		"invalid_tenant":              "Ungültiger Mandantenname %q; verwenden Sie bis zu 32 Kleinbuchstaben, Ziffern und Bindestriche",
+		"unauthorized":                "Authentifizierung erforderlich",
+		"request_timeout":             "Die Anfrage hat länger als %v gedauert",
+		"forbidden":                   "%v benötigt die Rolle %v",
+		"csrf_token_invalid":          "Ein gültiger %v-Header, der zum Cookie %v passt, ist erforderlich",
+		"admin_auth_required":         "%v erfordert Authentifizierung; konfigurieren Sie auth oder ein Admin-Token",
+		"invalid_role":                "Ungültige Rolle %q; verwenden Sie %v, %v oder %v",
+		"password_too_short":          "Passwörter müssen mindestens %v Zeichen lang sein",
+		"invalid_user_name":           "Ungültiger Benutzername %q; verwenden Sie bis zu 64 Buchstaben, Ziffern, Punkte, Bindestriche, Unterstriche und @",
+		"invalid_user_kind":           "Ungültige Art %q; verwenden Sie %v oder %v",
+		"user_configured":             "%v steht in der Konfigurationsdatei und kann daher hier nicht verwaltet werden",
+		"signing_not_enabled":         "Das Signieren von Anfragen ist nicht aktiviert; konfigurieren Sie zuerst einen hmac-Client",
+		"rate_limited":                "Zu viele Anfragen; versuchen Sie es später erneut",
+		"invalid_limit":               "Ungültiges Limit %q; verwenden Sie 1 bis %v",
+		"invalid_offset":              "Ungültiger Offset %q",
+		"invalid_page":                "Ungültige Seite %q",
+		"invalid_sort":                "Ungültige Sortierung %q: %v",
+		"invalid_replace":             "Ungültiger replace-Wert %q",
+		"confirmation_required":       "Das Leeren des Katalogs löscht alle Produkte; fügen Sie ?confirm=true hinzu, um fortzufahren",
+		"merge_into_itself":           "Ein Produkt kann nicht mit sich selbst zusammengeführt werden",
+		"invalid_dry_run":             "Ungültiger dry_run-Wert %q; verwenden Sie true oder false",
+		"invalid_consistent":          "Ungültiger consistent-Wert %q; verwenden Sie true oder false",
+		"invalid_snapshot":            "Fehler beim Lesen des Snapshots: %v",
+		"unsupported_media_type":      "Nicht unterstützter Content-Type; senden Sie application/json, application/vnd.api+json, application/xml oder application/x-protobuf",
+		"unsupported_encoding":        "Nicht unterstütztes Content-Encoding %q; senden Sie den Body unkomprimiert oder mit gzip",
+		"invalid_since":               "Ungültiges since %q; verwenden Sie einen RFC-3339-Zeitstempel oder ein next_token",
+		"changes_expired":             "Änderungen werden nur %v Tage aufbewahrt; laden Sie den Katalog erneut herunter",
+		"not_acceptable":              "Nicht akzeptabel; die API kann mit application/json, application/vnd.api+json, application/xml oder application/x-protobuf antworten",
+		"unsupported_import":          "Nicht unterstütztes Importformat; laden Sie eine .csv-, .json- oder .ndjson-Datei hoch oder senden Sie text/csv, application/json oder application/x-ndjson",
+		"import_too_large":            "Es können höchstens %v Zeilen auf einmal importiert werden",
+		"bulk_too_large":              "Es können höchstens %v Produkte auf einmal angelegt werden, wobei jeder Barcode und jeder eindeutige Name als weiteres zählt",
+		"cart_item_not_found":         "Artikel <%v> ist nicht im Warenkorb <%v>",
+		"invalid_quantity":            "Die Menge muss mindestens 1 sein",
+		"quantity_too_large":          "Die Menge darf höchstens %v sein",
+		"invalid_cart_quantity":       "Die Menge muss mindestens 1 sein; entfernen Sie stattdessen den Artikel",
+		"cart_full":                   "Ein Warenkorb kann höchstens %v Artikel enthalten",
+		"cart_empty":                  "Warenkorb <%v> ist leer",
+		"variant_required":            "Nur Varianten führen Bestand; wählen Sie eine mit variant_id",
+		"invalid_reservation_minutes": "Die Minuten müssen zwischen 1 und %v liegen",
+		"invalid_stock_adjustment":    "Die Anpassung muss eine ganze Zahl ungleich null sein, höchstens %v in jede Richtung",
+		"location_in_use":             "Am Standort <%v> liegt noch Bestand von %v Produkten; entnehmen Sie ihn zuerst",
+		"record_in_use":               "%v <%v> ist noch %v Produkten zugeordnet; ordnen Sie diese zuerst neu zu",
+		"usage_not_enabled":           "Die Nutzungsanalyse ist nicht aktiviert",
+		"invalid_usage_time":          "Ungültiges %v %q; verwenden Sie einen RFC-3339-Zeitstempel",
+		"invalid_usage_period":        "from muss vor to liegen",
+		"search_index_not_configured": "Es ist kein Suchindex konfiguriert",
+		"export_not_configured":       "Es ist kein Export-Bucket konfiguriert",
+		"filter_combined":             "Der Parameter filter kann nicht mit q, name oder name_prefix kombiniert werden",
+		"invalid_filter":              "Ungültiger Filter %q: %v",
+		"no_ids":                      "Es wurden keine Produkt-IDs angegeben",
+		"too_many_ids":                "Es können höchstens %v Produkt-IDs auf einmal abgefragt werden",
+		"price_alerts_not_enabled":    "Preisalarme sind nicht aktiviert",
+		"fault_injected":              "Für Tests eingeschleuster Fehler",
+		"invalid_locale":              "Ungültiges Gebietsschema %q; verwenden Sie ein Sprach-Tag wie fr oder pt-BR",
+	},
+}
+
+// titles - the names of the statuses the API responds with, by language.
+var titles = map[string]map[int]string{
+	"es": {
+		http.StatusBadRequest:            "Solicitud incorrecta",
+		http.StatusForbidden:             "Prohibido",
+		http.StatusNotFound:              "No encontrado",
+		http.StatusMethodNotAllowed:      "Método no permitido",
+		http.StatusNotAcceptable:         "No aceptable",
+		http.StatusConflict:              "Conflicto",
+		http.StatusGone:                  "Ya no existe",
+		http.StatusRequestEntityTooLarge: "Contenido demasiado grande",
+		http.StatusUnsupportedMediaType:  "Tipo de contenido no admitido",
+		http.StatusTooManyRequests:       "Demasiadas solicitudes",
+		http.StatusInternalServerError:   "Error interno del servidor",
+		http.StatusBadGateway:            "Puerta de enlace incorrecta",
+		http.StatusServiceUnavailable:    "Servicio no disponible",
+	},
+	"fr": {
+		http.StatusBadRequest:            "Requête incorrecte",
+		http.StatusForbidden:             "Interdit",
+		http.StatusNotFound:              "Introuvable",
+		http.StatusMethodNotAllowed:      "Méthode non autorisée",
+		http.StatusNotAcceptable:         "Non acceptable",
+		http.StatusConflict:              "Conflit",
+		http.StatusGone:                  "Supprimé",
+		http.StatusRequestEntityTooLarge: "Contenu trop volumineux",
+		http.StatusUnsupportedMediaType:  "Type de contenu non pris en charge",
+		http.StatusTooManyRequests:       "Trop de requêtes",
+		http.StatusInternalServerError:   "Erreur interne du serveur",
+		http.StatusBadGateway:            "Mauvaise passerelle",
+		http.StatusServiceUnavailable:    "Service indisponible",
+	},
+	"de": {
+		http.StatusBadRequest:            "Ungültige Anfrage",
+		http.StatusForbidden:             "Verboten",
+		http.StatusNotFound:              "Nicht gefunden",
+		http.StatusMethodNotAllowed:      "Methode nicht erlaubt",
+		http.StatusNotAcceptable:         "Nicht akzeptabel",
+		http.StatusConflict:              "Konflikt",
+		http.StatusGone:                  "Entfernt",
+		http.StatusRequestEntityTooLarge: "Inhalt zu groß",
+		http.StatusUnsupportedMediaType:  "Nicht unterstützter Medientyp",
+		http.StatusTooManyRequests:       "Zu viele Anfragen",
+		http.StatusInternalServerError:   "Interner Serverfehler",
+		http.StatusBadGateway:            "Ungültiges Gateway",
+		http.StatusServiceUnavailable:    "Dienst nicht verfügbar",
+	},
+}
@@ -0,0 +1,411 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+const (
+	// maxImportBytes - the largest import file accepted.
+	maxImportBytes = 10 << 20
+	// maxImportRows - the most rows a single import may contain.
+	maxImportRows = 10000
+	// maxStreamedImportBytes - the largest NDJSON body accepted; it's read a line at a time, so it has no row limit.
+	maxStreamedImportBytes = 1 << 30
+	// maxImportLineBytes - the longest line of an NDJSON import.
+	maxImportLineBytes = 1 << 20
+)
+
+/*
+importRow - the outcome for one row of an import. Rows are numbered from 1, not counting a CSV header.
+*/
+type importRow struct {
+	Row   int    `json:"row" xml:"row,attr"`
+	Id    string `json:"id,omitempty" xml:"id,omitempty"`
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+/*
+importReport - the response to an import: which rows were created, and why the others weren't.
+*/
+type importReport struct {
+	XMLName xml.Name    `json:"-" xml:"import"`
+	Created int         `json:"created" xml:"created"`
+	Failed  int         `json:"failed" xml:"failed"`
+	Rows    []importRow `json:"rows" xml:"rows>row"`
+}
+
+/*
+ImportProducts - create Products from an uploaded CSV, JSON or NDJSON file, reporting the result of each row.
+
+The file may be sent as the "file" field of a multipart/form-data upload, or as the raw request body with a
+text/csv, application/json or application/x-ndjson Content-Type. IDs are assigned by the server, so any id column is
+ignored. Valid rows are created in batches; a row that fails validation (or whose batch fails) doesn't stop the
+others. An NDJSON body is processed as it arrives, and reported on as it goes; see streamImport.
+*/
+func (a *API) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	limit := int64(maxImportBytes)
+	if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media == mediaNDJSON {
+		limit = maxStreamedImportBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	defer r.Body.Close()
+
+	file, format, err := importFile(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == errUnsupportedImport {
+			status = http.StatusUnsupportedMediaType
+		}
+		writeError(w, r, status, err)
+		return
+	}
+	defer file.Close()
+	if format == "ndjson" {
+		a.streamImport(w, r, file)
+		return
+	}
+
+	var products []datastore.Product
+	var report importReport
+	if format == "csv" {
+		products, report.Rows, err = parseImportCSV(file)
+	} else {
+		products, report.Rows, err = parseImportJSON(file)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(report.Rows) > maxImportRows {
+		writeError(w, r, http.StatusRequestEntityTooLarge, i18n.Errorf("import_too_large", "At most %v rows can be imported at once", maxImportRows))
+		return
+	}
+	referenceProblem := a.importReferences(r.Context())
+	for i := range report.Rows {
+		if report.Rows[i].Error == "" {
+			report.Rows[i].Error = referenceProblem(products[i])
+		}
+	}
+
+	// Only the rows that passed validation are written, in batches the size of a bulk create.
+	var batches [][]int
+	size := maxBulkCreate
+	for i := range report.Rows {
+		if report.Rows[i].Error != "" {
+			continue
+		}
+		if n := bulkSize(products[i : i+1]); size+n > maxBulkCreate {
+			batches = append(batches, nil)
+			size = n
+		} else {
+			size += n
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], i)
+	}
+	for _, batch := range batches {
+		if err := a.importBatch(r, products, batch); err != nil {
+			for _, i := range batch {
+				report.Rows[i].Error = err.Error()
+			}
+			continue
+		}
+		for _, i := range batch {
+			report.Rows[i].Id = products[i].Id
+		}
+	}
+
+	for _, row := range report.Rows {
+		if row.Error == "" {
+			report.Created++
+		} else {
+			report.Failed++
+		}
+	}
+	respond(w, r, http.StatusOK, report)
+}
+
+// importBatch - assigns IDs to the Products at the given positions and adds them together.
+func (a *API) importBatch(r *http.Request, products []datastore.Product, batch []int) error {
+	add := make([]datastore.Product, 0, len(batch))
+	for _, i := range batch {
+		id, err := a.Store.NextID(r.Context())
+		if err != nil {
+			return err
+		}
+		products[i].Id = id
+		add = append(add, products[i])
+	}
+	return a.Store.AddProducts(r.Context(), add)
+}
+
+/*
+importSummary - the last line of a streamed import's report: how many rows were created and how many weren't, and
+the error that stopped the import early, if one did.
+*/
+type importSummary struct {
+	Created int    `json:"created"`
+	Failed  int    `json:"failed"`
+	Error   string `json:"error,omitempty"`
+}
+
+/*
+streamImport - imports an NDJSON file, one Product per line, as it's read, so it never holds more than a batch. The
+response is NDJSON too, and starts straight away: each row's importRow (numbered by line; blank lines are skipped) is
+written, and flushed, once its batch has been, so the client can follow the import's progress, and an importSummary
+ends it. Rows already created stay created if the import is stopped early, by an unreadable body or the request
+timing out.
+*/
+func (a *API) streamImport(w http.ResponseWriter, r *http.Request, file io.Reader) {
+	w.Header().Set("Content-Type", mediaNDJSON)
+	w.WriteHeader(http.StatusOK)
+	out := json.NewEncoder(w)
+	var summary importSummary
+
+	// The rows read since the last write, in order, and the valid Products among them.
+	var rows []importRow
+	var products []datastore.Product
+	var batch []int
+	size := 0
+	write := func() error {
+		if len(batch) > 0 {
+			if err := a.importBatch(r, products, batch); err != nil {
+				for _, i := range batch {
+					rows[i].Error = err.Error()
+				}
+			} else {
+				for _, i := range batch {
+					rows[i].Id = products[i].Id
+				}
+			}
+		}
+		for _, row := range rows {
+			if row.Error == "" {
+				summary.Created++
+			} else {
+				summary.Failed++
+			}
+			if err := out.Encode(row); err != nil {
+				return err
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		rows, products, batch, size = rows[:0], products[:0], batch[:0], 0
+		return r.Context().Err()
+	}
+
+	referenceProblem := a.importReferences(r.Context())
+	in := bufio.NewScanner(file)
+	in.Buffer(make([]byte, 0, 64<<10), maxImportLineBytes)
+	for n := 1; in.Scan(); n++ {
+		line := bytes.TrimSpace(in.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		row := importRow{Row: n}
+		var p datastore.Product
+		if err := decodeJSON(bytes.NewReader(line), &p); err != nil {
+			row.Error = err.Error()
+		} else if row.Error = validateImport(p); row.Error == "" {
+			row.Error = referenceProblem(p)
+		}
+		if row.Error == "" {
+			if k := bulkSize([]datastore.Product{p}); size+k > maxBulkCreate {
+				if err := write(); err != nil {
+					summary.Error = err.Error()
+					out.Encode(summary)
+					return
+				}
+				size = k
+			} else {
+				size += k
+			}
+			batch = append(batch, len(rows))
+		}
+		rows = append(rows, row)
+		products = append(products, p)
+	}
+	err := write()
+	if err == nil {
+		err = in.Err()
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	out.Encode(summary)
+}
+
+// errUnsupportedImport - the upload isn't CSV, JSON or NDJSON.
+var errUnsupportedImport = i18n.Errorf("unsupported_import", "Unsupported import format; upload a .csv, .json or .ndjson file, or send text/csv, application/json or application/x-ndjson")
+
+/*
+importFile - finds the file in the request, either a multipart "file" field or the raw body, and whether it's
+"csv", "json" or "ndjson".
+*/
+func importFile(r *http.Request) (io.ReadCloser, string, error) {
+	media, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", errUnsupportedImport
+	}
+
+	if media == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("Error reading the uploaded file: %v", err)
+		}
+		// The file's own type is taken from its name, falling back to the part's Content-Type.
+		format := importFormat(strings.ToLower(path.Ext(header.Filename)))
+		if format == "" {
+			partMedia, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+			format = importFormat(partMedia)
+		}
+		if format == "" {
+			file.Close()
+			return nil, "", errUnsupportedImport
+		}
+		return file, format, nil
+	}
+
+	if format := importFormat(media); format != "" {
+		return r.Body, format, nil
+	}
+	return nil, "", errUnsupportedImport
+}
+
+// importFormat - maps a file extension or media type to "csv", "json" or "ndjson"; "" if it's none of them.
+func importFormat(s string) string {
+	switch s {
+	case ".csv", "text/csv":
+		return "csv"
+	case ".json", mediaJSON:
+		return "json"
+	case ".ndjson", ".jsonl", mediaNDJSON:
+		return "ndjson"
+	}
+	return ""
+}
+
+/*
+parseImportCSV - reads a CSV file with a header row. The name and price columns are required, and expires_at
+(RFC 3339), barcode, supplier_id, category_id and tags (separated by semicolons) are optional; columns are matched by
+heading, case-insensitively, and others are ignored.
+*/
+func parseImportCSV(file io.Reader) ([]datastore.Product, []importRow, error) {
+	in := csv.NewReader(file)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading the CSV header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("The CSV header has no %q column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var products []datastore.Product
+	var rows []importRow
+	for n := 1; len(rows) <= maxImportRows; n++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		row := importRow{Row: n}
+		var p datastore.Product
+		if err != nil {
+			// A malformed line only fails that row, unless the reader can't go on.
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, fmt.Errorf("Error reading the CSV file: %v", err)
+			}
+			row.Error = parseErr.Err.Error()
+		} else {
+			p.Name = field(record, "name")
+			if p.Price, err = datastore.ParseMoney(field(record, "price")); err != nil {
+				row.Error = fmt.Sprintf("Invalid price %q", field(record, "price"))
+			} else if expires := field(record, "expires_at"); expires != "" {
+				if t, err := time.Parse(time.RFC3339, expires); err != nil {
+					row.Error = fmt.Sprintf("Invalid expires_at %q; use an RFC 3339 timestamp", expires)
+				} else {
+					p.ExpiresAt = &t
+				}
+			}
+			p.Barcode = field(record, "barcode")
+			p.SupplierId = field(record, "supplier_id")
+			p.CategoryId = field(record, "category_id")
+			if tags := field(record, "tags"); tags != "" {
+				for _, tag := range strings.Split(tags, ";") {
+					p.Tags = append(p.Tags, strings.TrimSpace(tag))
+				}
+			}
+			if row.Error == "" {
+				row.Error = validateImport(p)
+			}
+		}
+		products = append(products, p)
+		rows = append(rows, row)
+	}
+	return products, rows, nil
+}
+
+/*
+parseImportJSON - reads a JSON array of Products, in the same form the API returns them.
+*/
+func parseImportJSON(file io.Reader) ([]datastore.Product, []importRow, error) {
+	// Each element is decoded separately so that one bad row doesn't fail the whole file.
+	var raw []json.RawMessage
+	if err := decodeJSON(file, &raw); err != nil {
+		return nil, nil, fmt.Errorf("Error reading the JSON file; expected an array of products: %v", err)
+	}
+
+	products := make([]datastore.Product, len(raw))
+	rows := make([]importRow, len(raw))
+	for i, msg := range raw {
+		rows[i].Row = i + 1
+		if err := decodeJSON(bytes.NewReader(msg), &products[i]); err != nil {
+			rows[i].Error = err.Error()
+			continue
+		}
+		rows[i].Error = validateImport(products[i])
+	}
+	return products, rows, nil
+}
+
+// validateImport - the problem with an imported Product, or "" if it can be created.
+func validateImport(p datastore.Product) string {
+	if err := validateProduct(p); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// newJobQueue - the job queue for the config: on SQS if a queue URL is set, or else in memory.
+func newJobQueue(cfg config.Jobs) (*jobs.Queue, error) {
+	if cfg.SQS.QueueURL == "" {
+		return jobs.New(jobs.NewMemory(cfg.Capacity), cfg), nil
+	}
+	backend, err := jobs.NewSQS(context.Background(), cfg.SQS)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.New(backend, cfg), nil
+}
+
+// deadLetterList - the jobs this instance has dead-lettered, newest first.
+type deadLetterList struct {
+	XMLName xml.Name   `json:"-" xml:"jobs"`
+	Jobs    []jobs.Job `json:"jobs" xml:"job"`
+}
+
+/*
+GetDeadLetters - list the jobs this instance gave up on, with why their last attempt failed.
+*/
+func (a *API) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, http.StatusOK, deadLetterList{Jobs: a.Jobs.DeadLetters()})
+}
+
+/*
+RetryDeadLetter - queue a dead-lettered job again, e.g. once whatever it depends on is back.
+*/
+func (a *API) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	job, err := a.Jobs.Retry(r.Context(), mux.Vars(r)["job"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err)
+		return
+	}
+	respond(w, r, http.StatusAccepted, job)
+}
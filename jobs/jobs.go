@@ -0,0 +1,277 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package jobs runs asynchronous work, such as mirroring writes into the search index, on a pool of workers.
+
+Jobs are enqueued by type with a JSON payload and run by the Handler registered for the type, in the tenant that
+enqueued them. A job whose handler fails is retried with exponential backoff; once it has used up its attempts it's
+dead-lettered, and kept (up to a limit) so it can be inspected and retried. The queue itself is a Backend: Memory
+by default, or SQS so that jobs survive restarts and are shared between instances.
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+// metrics - job counts, published under "jobs" at /debug/vars.
+var metrics = expvar.NewMap("jobs")
+
+// Job - a unit of work and its progress.
+type Job struct {
+	Id      string          `json:"id" xml:"id"`
+	Type    string          `json:"type" xml:"type"`
+	Tenant  string          `json:"tenant,omitempty" xml:"tenant,omitempty"`
+	Payload json.RawMessage `json:"payload" xml:"-"`
+	// Attempts - how many times the job has been tried so far.
+	Attempts int `json:"attempts" xml:"attempts"`
+	// LastError - why the last attempt failed.
+	LastError string `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	// EnqueuedAt - when the job was first enqueued.
+	EnqueuedAt time.Time `json:"enqueued_at" xml:"enqueued_at"`
+	// Traceparent / Tracestate - the trace span that enqueued the job, which its handler's calls carry on.
+	Traceparent string `json:"traceparent,omitempty" xml:"-"`
+	Tracestate  string `json:"tracestate,omitempty" xml:"-"`
+}
+
+/*
+Handler - runs a job of one type. The context carries the job's tenant and, if it was enqueued while serving a
+traced request, a span in that request's trace. An error means the job is retried.
+*/
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Delivery - a job received from a Backend. Done removes it from the backend once it has been dealt with.
+type Delivery struct {
+	Job  Job
+	Done func(ctx context.Context) error
+}
+
+/*
+Backend - where queued jobs are kept between Enqueue and a worker picking them up.
+*/
+type Backend interface {
+	// Send - queues a job, to be received no sooner than delay from now.
+	Send(ctx context.Context, job Job, delay time.Duration) error
+	// Receive - waits for jobs to arrive, returning some (possibly none) or the context's error once it's done.
+	Receive(ctx context.Context) ([]Delivery, error)
+	// DeadLetter - keeps a job that has used up its attempts somewhere it can be found, if the backend has such a place.
+	DeadLetter(ctx context.Context, job Job) error
+}
+
+// maxDeadLetters - how many dead-lettered jobs a Queue keeps for DeadLetters.
+const maxDeadLetters = 100
+
+/*
+Queue - the worker pool. Handlers must be registered before Start.
+*/
+type Queue struct {
+	backend     Backend
+	handlers    map[string]Handler
+	workers     int
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	mu   sync.Mutex
+	dead []Job // most recent last
+}
+
+// New - a queue on backend with the configured workers, attempts and backoff.
+func New(backend Backend, cfg config.Jobs) *Queue {
+	return &Queue{
+		backend:     backend,
+		handlers:    map[string]Handler{},
+		workers:     max(cfg.Workers, 1),
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		minBackoff:  cfg.MinBackoff.Duration,
+		maxBackoff:  cfg.MaxBackoff.Duration,
+	}
+}
+
+// Ping - checks that the backend can be reached, for backends that can be checked; memory always can.
+func (q *Queue) Ping(ctx context.Context) error {
+	if p, ok := q.backend.(interface{ Ping(context.Context) error }); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Handle - registers the handler for a job type.
+func (q *Queue) Handle(jobType string, h Handler) {
+	q.handlers[jobType] = h
+}
+
+// Enqueue - queues a job of the given type for the context's tenant; payload is encoded as JSON.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) error {
+	if _, ok := q.handlers[jobType]; !ok {
+		return fmt.Errorf("No handler for job type %q", jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Error encoding %v job: %v", jobType, err)
+	}
+	id, err := datastore.NewUUID()
+	if err != nil {
+		return err
+	}
+	job := Job{Id: id, Type: jobType, Tenant: datastore.Tenant(ctx), Payload: data, EnqueuedAt: time.Now().UTC()}
+	if span, ok := tracecontext.FromContext(ctx); ok {
+		job.Traceparent, job.Tracestate = span.Traceparent(), span.State
+	}
+	if err := q.backend.Send(ctx, job, 0); err != nil {
+		return fmt.Errorf("Error enqueueing %v job: %v", jobType, err)
+	}
+	metrics.Add("enqueued", 1)
+	return nil
+}
+
+// Start - starts the workers; they stop when ctx is done.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// work - one worker: receives jobs and runs them until ctx is done.
+func (q *Queue) work(ctx context.Context) {
+	for {
+		deliveries, err := q.backend.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Receiving jobs failed: %v", err)
+			time.Sleep(q.backoff(1))
+			continue
+		}
+		for _, d := range deliveries {
+			q.run(ctx, d)
+		}
+	}
+}
+
+// run - runs a delivered job, then retries it, dead-letters it or removes it.
+func (q *Queue) run(ctx context.Context, d Delivery) {
+	job := d.Job
+	job.Attempts++
+
+	var err error
+	if h, ok := q.handlers[job.Type]; ok {
+		err = h(jobContext(ctx, job), job.Payload)
+	} else {
+		// Retrying won't help a job nothing can run.
+		err = errors.New("No handler for job type " + job.Type)
+		job.Attempts = q.maxAttempts
+	}
+	if err == nil {
+		metrics.Add("succeeded", 1)
+		q.done(ctx, d)
+		return
+	}
+
+	job.LastError = err.Error()
+	if job.Attempts < q.maxAttempts {
+		metrics.Add("retried", 1)
+		if err := q.backend.Send(ctx, job, q.backoff(job.Attempts)); err != nil {
+			// Leaving the delivery in place lets a durable backend deliver it again.
+			log.Printf("Job %v (%v) could not be requeued: %v", job.Id, job.Type, err)
+			return
+		}
+		q.done(ctx, d)
+		return
+	}
+
+	metrics.Add("dead_lettered", 1)
+	log.Printf("Job %v (%v) failed %v times and was dead-lettered: %v", job.Id, job.Type, job.Attempts, err)
+	q.mu.Lock()
+	q.dead = append(q.dead, job)
+	if len(q.dead) > maxDeadLetters {
+		q.dead = q.dead[1:]
+	}
+	q.mu.Unlock()
+	if err := q.backend.DeadLetter(ctx, job); err != nil {
+		log.Printf("Job %v (%v) could not be moved to the dead-letter queue: %v", job.Id, job.Type, err)
+	}
+	q.done(ctx, d)
+}
+
+// done - removes a delivery from the backend, logging a failure (the job may then run again).
+func (q *Queue) done(ctx context.Context, d Delivery) {
+	if d.Done == nil {
+		return
+	}
+	if err := d.Done(ctx); err != nil {
+		log.Printf("Job %v (%v) could not be removed from the queue: %v", d.Job.Id, d.Job.Type, err)
+	}
+}
+
+// backoff - the delay before the given retry: doubling from the minimum up to the maximum, with jitter.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.minBackoff
+	for i := 1; i < attempt && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxBackoff {
+		delay = q.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// DeadLetters - the jobs this instance has dead-lettered most recently, newest first.
+func (q *Queue) DeadLetters() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.dead))
+	for i, job := range q.dead {
+		jobs[len(q.dead)-1-i] = job
+	}
+	return jobs
+}
+
+// Retry - queues a dead-lettered job again with a fresh set of attempts.
+func (q *Queue) Retry(ctx context.Context, id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.dead {
+		if job.Id != id {
+			continue
+		}
+		job.Attempts = 0
+		job.LastError = ""
+		if err := q.backend.Send(ctx, job, 0); err != nil {
+			return Job{}, fmt.Errorf("Error enqueueing job %v: %v", id, err)
+		}
+		q.dead = append(q.dead[:i], q.dead[i+1:]...)
+		metrics.Add("enqueued", 1)
+		return job, nil
+	}
+	return Job{}, fmt.Errorf("No dead-lettered job %v", id)
+}
+
+// jobContext - local helper function that gives a job's handler its tenant and, if it has one, a span of its own in
+// the trace that enqueued it.
+func jobContext(ctx context.Context, job Job) context.Context {
+	ctx = datastore.WithTenant(ctx, job.Tenant)
+	if parent, ok := tracecontext.Parse(job.Traceparent); ok {
+		parent.State = job.Tracestate
+		ctx = tracecontext.WithSpan(ctx, tracecontext.Start(parent, true))
+	}
+	return ctx
+}
@@ -0,0 +1,58 @@
+/*
+Author: Jason Payne
+*/
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/*
+Memory - an in-process Backend. Jobs are lost when the process stops, and each instance only runs its own.
+*/
+type Memory struct {
+	jobs chan Job
+}
+
+// NewMemory - an in-memory backend holding at most capacity jobs.
+func NewMemory(capacity int) *Memory {
+	return &Memory{jobs: make(chan Job, max(capacity, 1))}
+}
+
+// errQueueFull - the in-memory queue is at capacity.
+var errQueueFull = errors.New("The job queue is full")
+
+func (m *Memory) Send(ctx context.Context, job Job, delay time.Duration) error {
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			select {
+			case m.jobs <- job:
+			default:
+				metrics.Add("dropped", 1)
+			}
+		})
+		return nil
+	}
+	select {
+	case m.jobs <- job:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (m *Memory) Receive(ctx context.Context) ([]Delivery, error) {
+	select {
+	case job := <-m.jobs:
+		return []Delivery{{Job: job}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// DeadLetter - a no-op; the Queue's own list of dead letters is all there is.
+func (m *Memory) DeadLetter(ctx context.Context, job Job) error {
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Author: Jason Payne
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maxSQSDelay - the longest DelaySeconds SQS accepts.
+const maxSQSDelay = 15 * time.Minute
+
+/*
+SQS - a Backend on an Amazon SQS queue, shared by every instance that's configured with it. A retry is sent as a
+new message, delayed by the backoff, and the failed one deleted; a job whose worker dies before it's done becomes
+visible again after the queue's visibility timeout, so handlers must be safe to run twice.
+*/
+type SQS struct {
+	client        *sqs.Client
+	queueURL      string
+	deadLetterURL string
+}
+
+// NewSQS - a backend for the configured queues, using the SDK's default credentials.
+func NewSQS(ctx context.Context, cfg config.SQS) (*SQS, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading AWS config for SQS: %v", err)
+	}
+	awsCfg.APIOptions = append(awsCfg.APIOptions, tracecontext.AWS)
+	return &SQS{client: sqs.NewFromConfig(awsCfg), queueURL: cfg.QueueURL, deadLetterURL: cfg.DeadLetterURL}, nil
+}
+
+// Ping - checks that the queue exists and can be reached.
+func (s *SQS) Ping(ctx context.Context) error {
+	_, err := s.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(s.queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return fmt.Errorf("GetQueueAttributes failed: %v", err)
+	}
+	return nil
+}
+
+// send - sends a job to a queue.
+func (s *SQS) send(ctx context.Context, queueURL string, job Job, delay time.Duration) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(queueURL),
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: int32(min(delay, maxSQSDelay) / time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("SendMessage failed: %v", err)
+	}
+	return nil
+}
+
+func (s *SQS) Send(ctx context.Context, job Job, delay time.Duration) error {
+	return s.send(ctx, s.queueURL, job, delay)
+}
+
+func (s *SQS) Receive(ctx context.Context) ([]Delivery, error) {
+	// Long polling: the call waits up to 20 seconds for messages rather than returning empty straight away.
+	result, err := s.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(s.queueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ReceiveMessage failed: %v", err)
+	}
+
+	deliveries := make([]Delivery, 0, len(result.Messages))
+	for _, m := range result.Messages {
+		receipt := m.ReceiptHandle
+		done := func(ctx context.Context) error {
+			_, err := s.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(s.queueURL), ReceiptHandle: receipt})
+			return err
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(aws.ToString(m.Body)), &job); err != nil {
+			// Not a job this app sent; handing it to the queue as an unknown type dead-letters it.
+			job = Job{Id: aws.ToString(m.MessageId), LastError: fmt.Sprintf("Invalid job message: %v", err)}
+		}
+		deliveries = append(deliveries, Delivery{Job: job, Done: done})
+	}
+	return deliveries, nil
+}
+
+// DeadLetter - moves the job to the dead-letter queue, if one is configured.
+func (s *SQS) DeadLetter(ctx context.Context, job Job) error {
+	if s.deadLetterURL == "" {
+		return nil
+	}
+	return s.send(ctx, s.deadLetterURL, job, 0)
+}
@@ -0,0 +1,323 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+// mediaJSONAPI - JSON:API (https://jsonapi.org) documents, for clients that ask for them in Accept.
+const mediaJSONAPI = "application/vnd.api+json"
+
+// jsonapiType - the JSON:API resource type of Products.
+const jsonapiType = "products"
+
+// jsonapiVariantType - the JSON:API resource type of variants, which only appear as included resources.
+const jsonapiVariantType = "variants"
+
+/*
+jsonapiDocument - a JSON:API top-level document. Products are resources in Data, errors go in Errors, and any
+other response (e.g. an import report) is returned as Meta. A cursor-paged listing also has its next cursor in Meta.
+Variants requested with ?include= are in Included.
+*/
+type jsonapiDocument struct {
+	Data     interface{}      `json:"data,omitempty"`
+	Included []jsonapiVariant `json:"included,omitempty"`
+	Errors   []jsonapiError   `json:"errors,omitempty"`
+	Meta     interface{}      `json:"meta,omitempty"`
+}
+
+// jsonapiResource - a Product as a JSON:API resource object. Its variants are a relationship when they were
+// included.
+type jsonapiResource struct {
+	Type          string                         `json:"type"`
+	Id            string                         `json:"id,omitempty"`
+	Attributes    jsonapiAttributes              `json:"attributes"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+// jsonapiRelationship - a to-many relationship: identifiers of the related resources, which are in Included.
+type jsonapiRelationship struct {
+	Data []jsonapiIdentifier `json:"data"`
+}
+
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// jsonapiVariant - a variant as a JSON:API resource object.
+type jsonapiVariant struct {
+	Type       string `json:"type"`
+	Id         string `json:"id"`
+	Attributes struct {
+		Size  string           `json:"size,omitempty"`
+		Color string           `json:"color,omitempty"`
+		Price *datastore.Money `json:"price,omitempty"`
+		Stock int              `json:"stock"`
+	} `json:"attributes"`
+	Links map[string]string `json:"links"`
+}
+
+type jsonapiAttributes struct {
+	Name      string            `json:"name"`
+	Price     datastore.Money   `json:"price"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Rating    *datastore.Rating `json:"rating,omitempty"`
+	Barcode   string            `json:"barcode,omitempty"`
+	Supplier  string            `json:"supplier_id,omitempty"`
+	Category  string            `json:"category_id,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+
+	NameTranslations        datastore.Translations `json:"name_translations,omitempty"`
+	Description             string                 `json:"description,omitempty"`
+	DescriptionTranslations datastore.Translations `json:"description_translations,omitempty"`
+	Stock                   datastore.StockLevels  `json:"stock,omitempty"`
+	StockTotal              *int                   `json:"stock_total,omitempty"`
+
+	// fields - the sparse fieldset, if one was requested.
+	fields fieldSet
+}
+
+// plainAttributes - jsonapiAttributes without MarshalJSON, for encoding every attribute.
+type plainAttributes jsonapiAttributes
+
+func (a jsonapiAttributes) MarshalJSON() ([]byte, error) {
+	if a.fields == nil {
+		return json.Marshal(plainAttributes(a))
+	}
+	attrs := map[string]interface{}{}
+	if a.fields[datastore.FieldName] {
+		attrs[datastore.FieldName] = a.Name
+		if a.NameTranslations != nil {
+			attrs["name_translations"] = a.NameTranslations
+		}
+	}
+	if a.fields[datastore.FieldPrice] {
+		attrs[datastore.FieldPrice] = a.Price
+	}
+	if a.fields[datastore.FieldExpiresAt] && a.ExpiresAt != nil {
+		attrs[datastore.FieldExpiresAt] = a.ExpiresAt
+	}
+	if a.fields[datastore.FieldRating] && a.Rating != nil {
+		attrs[datastore.FieldRating] = a.Rating
+	}
+	if a.fields[datastore.FieldBarcode] && a.Barcode != "" {
+		attrs[datastore.FieldBarcode] = a.Barcode
+	}
+	if a.fields[datastore.FieldSupplier] && a.Supplier != "" {
+		attrs[datastore.FieldSupplier] = a.Supplier
+	}
+	if a.fields[datastore.FieldCategory] && a.Category != "" {
+		attrs[datastore.FieldCategory] = a.Category
+	}
+	if a.fields[datastore.FieldTags] && a.Tags != nil {
+		attrs[datastore.FieldTags] = a.Tags
+	}
+	if a.fields[datastore.FieldUpdatedAt] && a.UpdatedAt != nil {
+		attrs[datastore.FieldUpdatedAt] = a.UpdatedAt
+	}
+	if a.fields[datastore.FieldDescription] && a.Description != "" {
+		attrs[datastore.FieldDescription] = a.Description
+		if a.DescriptionTranslations != nil {
+			attrs["description_translations"] = a.DescriptionTranslations
+		}
+	}
+	if a.fields[datastore.FieldStock] && a.Stock != nil {
+		attrs[datastore.FieldStock] = a.Stock
+		attrs["stock_total"] = a.StockTotal
+	}
+	return json.Marshal(attrs)
+}
+
+// jsonapiError - a JSON:API error object; its id is the request ID.
+type jsonapiError struct {
+	Id     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// Source - the part of the request at fault, when it's known.
+	Source *jsonapiSource `json:"source,omitempty"`
+}
+
+// jsonapiSource - a JSON Pointer to the request body value an error is about.
+type jsonapiSource struct {
+	Pointer string `json:"pointer"`
+}
+
+func toJSONAPIResource(p datastore.Product, fields fieldSet) jsonapiResource {
+	return jsonapiResource{
+		Type: jsonapiType,
+		Id:   p.Id,
+		Attributes: jsonapiAttributes{
+			Name: p.Name, Price: p.Price, ExpiresAt: p.ExpiresAt, Rating: p.Rating, Barcode: p.Barcode, Supplier: p.SupplierId,
+			Category: p.CategoryId, Tags: p.Tags, UpdatedAt: p.UpdatedAt, NameTranslations: p.NameTranslations, Description: p.Description,
+			DescriptionTranslations: p.DescriptionTranslations, Stock: p.Stock, StockTotal: stockTotal(p.Stock), fields: fields,
+		},
+		Links: map[string]string{"self": productURL(p.Id)},
+	}
+}
+
+func toJSONAPIResources(list resourceList) []jsonapiResource {
+	data := make([]jsonapiResource, len(list))
+	for i, r := range list {
+		data[i] = toJSONAPIResource(r.Product, r.fields)
+	}
+	return data
+}
+
+/*
+jsonapiIncluded - the variants of the Products in list, if they were included, for a document's Included. Each
+corresponding resource in data gets a variants relationship.
+*/
+func jsonapiIncluded(data []jsonapiResource, list resourceList) []jsonapiVariant {
+	var included []jsonapiVariant
+	for i, r := range list {
+		if r.Variants == nil {
+			continue
+		}
+		rel := jsonapiRelationship{Data: []jsonapiIdentifier{}}
+		for _, v := range *r.Variants {
+			rel.Data = append(rel.Data, jsonapiIdentifier{Type: jsonapiVariantType, Id: v.Id})
+			inc := jsonapiVariant{Type: jsonapiVariantType, Id: v.Id, Links: map[string]string{"self": variantURL(v)}}
+			inc.Attributes.Size, inc.Attributes.Color, inc.Attributes.Price, inc.Attributes.Stock = v.Size, v.Color, v.Price, v.Stock
+			included = append(included, inc)
+		}
+		data[i].Relationships = map[string]jsonapiRelationship{jsonapiVariantType: rel}
+	}
+	return included
+}
+
+// toJSONAPI - wraps a response body in a JSON:API document.
+func toJSONAPI(v interface{}) jsonapiDocument {
+	switch v := v.(type) {
+	case datastore.Product:
+		return jsonapiDocument{Data: toJSONAPIResource(v, nil)}
+	case productResource:
+		data := []jsonapiResource{toJSONAPIResource(v.Product, v.fields)}
+		included := jsonapiIncluded(data, resourceList{v})
+		return jsonapiDocument{Data: data[0], Included: included}
+	case productList:
+		list := make(resourceList, len(v))
+		for i, p := range v {
+			list[i] = productResource{Product: p}
+		}
+		return jsonapiDocument{Data: toJSONAPIResources(list)}
+	case resourceList:
+		data := toJSONAPIResources(v)
+		return jsonapiDocument{Data: data, Included: jsonapiIncluded(data, v)}
+	case cursorPage:
+		data := toJSONAPIResources(v.Products)
+		doc := jsonapiDocument{Data: data, Included: jsonapiIncluded(data, v.Products)}
+		if v.NextCursor != "" {
+			doc.Meta = map[string]string{"next_cursor": v.NextCursor}
+		}
+		return doc
+	}
+	return jsonapiDocument{Meta: v}
+}
+
+// writeJSONAPIError - the JSON:API form of writeError.
+func writeJSONAPIError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	lang := errorLanguage(w, r)
+	w.Header().Set("Content-Type", mediaJSONAPI)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	e := jsonapiError{
+		Id:     requestID(r),
+		Status: strconv.Itoa(status),
+		Title:  i18n.Title(lang, status),
+		Detail: i18n.Message(lang, err),
+		Code:   i18n.Code(err, status),
+	}
+
+	// A schema violation is reported as one error per value at fault, as JSON:API intends.
+	var invalid *schema.Error
+	if !errors.As(err, &invalid) {
+		json.NewEncoder(w).Encode(jsonapiDocument{Errors: []jsonapiError{e}})
+		return
+	}
+	errs := make([]jsonapiError, len(invalid.Violations))
+	for i, v := range invalid.Violations {
+		errs[i] = e
+		errs[i].Detail = v.Detail
+		errs[i].Source = &jsonapiSource{Pointer: v.Pointer}
+	}
+	json.NewEncoder(w).Encode(jsonapiDocument{Errors: errs})
+}
+
+/*
+decodeJSONAPI - reads a JSON:API request document into a Product (a single resource) or a productList (an array
+of them, for bulk creates).
+*/
+func decodeJSONAPI(body io.Reader, v interface{}) error {
+	var doc struct {
+		Data    json.RawMessage `json:"data"`
+		Meta    json.RawMessage `json:"meta"`
+		JSONAPI json.RawMessage `json:"jsonapi"`
+	}
+	if err := decodeJSON(body, &doc); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *datastore.Product:
+		var res jsonapiResource
+		if err := decodeJSON(bytes.NewReader(doc.Data), &res); err != nil {
+			return fmt.Errorf("Invalid JSON:API data: %v", err)
+		}
+		p, err := fromJSONAPIResource(res)
+		*v = p
+		return err
+	case *productList:
+		var res []jsonapiResource
+		if err := decodeJSON(bytes.NewReader(doc.Data), &res); err != nil {
+			return fmt.Errorf("Invalid JSON:API data; expected an array of resources: %v", err)
+		}
+		list := make(productList, len(res))
+		for i := range res {
+			var err error
+			if list[i], err = fromJSONAPIResource(res[i]); err != nil {
+				return err
+			}
+		}
+		*v = list
+		return nil
+	}
+	return errUnsupportedMediaType
+}
+
+func fromJSONAPIResource(res jsonapiResource) (datastore.Product, error) {
+	if res.Type != jsonapiType {
+		return datastore.Product{}, fmt.Errorf("Unsupported JSON:API resource type %q; expected %q", res.Type, jsonapiType)
+	}
+	return datastore.Product{
+		Id:         res.Id,
+		Name:       res.Attributes.Name,
+		Price:      res.Attributes.Price,
+		ExpiresAt:  res.Attributes.ExpiresAt,
+		Barcode:    res.Attributes.Barcode,
+		SupplierId: res.Attributes.Supplier,
+		CategoryId: res.Attributes.Category,
+		Tags:       res.Attributes.Tags,
+
+		NameTranslations:        res.Attributes.NameTranslations,
+		Description:             res.Attributes.Description,
+		DescriptionTranslations: res.Attributes.DescriptionTranslations,
+	}, nil
+}
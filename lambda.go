@@ -0,0 +1,36 @@
+//go:build lambda
+
+/*
+Author: Jason Payne
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
+)
+
+/*
+listen - serves handler to API Gateway from AWS Lambda, and blocks for as long as the function runs. Each proxy event
+is turned into an http.Request for the router, and its response into the event's reply, so the handlers behave as
+they do behind the HTTP server. The listener, timeout and TLS settings don't apply; API Gateway has its own.
+*/
+func listen(cfg config.Server, handler http.Handler) error {
+	switch cfg.Lambda.Payload {
+	case config.LambdaPayloadV1:
+		fmt.Println("Serving API Gateway REST API (1.0) events")
+		lambda.Start(httpadapter.New(handler).ProxyWithContext)
+	case config.LambdaPayloadV2:
+		fmt.Println("Serving API Gateway HTTP API (2.0) events")
+		lambda.Start(httpadapter.NewV2(handler).ProxyWithContext)
+	default:
+		return fmt.Errorf("Unknown lambda payload %q; use %q or %q", cfg.Lambda.Payload, config.LambdaPayloadV1, config.LambdaPayloadV2)
+	}
+	return nil
+}
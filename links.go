@@ -0,0 +1,208 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+/*
+link - a hypermedia link, telling clients where (and with which method) they can go next without building URLs
+themselves.
+*/
+type link struct {
+	Rel    string `json:"rel" xml:"rel,attr"`
+	Href   string `json:"href" xml:"href,attr"`
+	Method string `json:"method" xml:"method,attr"`
+}
+
+// productLinks - what can be done with a Product.
+func productLinks(id string) []link {
+	self := productURL(id)
+	return []link{
+		{Rel: "self", Href: self, Method: http.MethodGet},
+		{Rel: "update", Href: self, Method: http.MethodPut},
+		{Rel: "delete", Href: self, Method: http.MethodDelete},
+		{Rel: "price-history", Href: self + "/price-history", Method: http.MethodGet},
+		{Rel: "reviews", Href: self + "/reviews", Method: http.MethodGet},
+		{Rel: "variants", Href: self + "/variants", Method: http.MethodGet},
+	}
+}
+
+/*
+productResource - a Product as the API represents it in strict mode: its fields plus its links, and any related
+resources requested with ?include=.
+*/
+type productResource struct {
+	XMLName xml.Name `json:"-" xml:"Product"`
+	datastore.Product
+	Links []link `json:"links" xml:"link"`
+	// Variants - set only when included, so an included Product without variants has an empty list.
+	Variants *variantList `json:"variants,omitempty" xml:"variants,omitempty"`
+	// StockTotal - the Product's stock across every location; set from Stock as it's encoded.
+	StockTotal *int `json:"stock_total,omitempty" xml:"stock_total,omitempty"`
+
+	// fields - set by sparse when only some fields were requested.
+	fields fieldSet
+}
+
+// resourceList - a listing of productResources, encoded like productList.
+type resourceList []productResource
+
+func (l resourceList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "products"
+	return e.EncodeElement(struct {
+		Products []productResource `xml:"product"`
+	}{l}, start)
+}
+
+// resource - the representation of a Product; links, ratings, barcodes, suppliers, stock, categories and tags are new
+// response fields, so legacy clients don't get them.
+func resource(p datastore.Product) interface{} {
+	if !strictMode {
+		p.Rating, p.Barcode, p.SupplierId, p.Stock, p.CategoryId, p.Tags = nil, "", "", nil, "", nil
+		return p
+	}
+	return productResource{Product: p, Links: productLinks(p.Id)}
+}
+
+// resources - the representation of a listing of Products.
+func resources(products []datastore.Product) interface{} {
+	if !strictMode {
+		list := make(productList, len(products))
+		for i, p := range products {
+			p.Rating, p.Barcode, p.SupplierId, p.Stock, p.CategoryId, p.Tags = nil, "", "", nil, "", nil
+			list[i] = p
+		}
+		return list
+	}
+	list := make(resourceList, len(products))
+	for i, p := range products {
+		list[i] = productResource{Product: p, Links: productLinks(p.Id)}
+	}
+	return list
+}
+
+// maxPageSize - the largest ?limit a listing accepts.
+const maxPageSize = 1000
+
+/*
+paginate - applies ?limit= and ?offset= to a listing. When a limit is given, a Link header points to the next
+and previous pages (where they exist), so clients can page through without working out offsets. Without one,
+the whole listing is returned.
+*/
+func paginate(w http.ResponseWriter, r *http.Request, products []datastore.Product) ([]datastore.Product, error) {
+	query := r.URL.Query()
+	if query.Get("limit") == "" && query.Get("offset") == "" {
+		return products, nil
+	}
+
+	limit, offset := maxPageSize, 0
+	var err error
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			return nil, i18n.Errorf("invalid_limit", "Invalid limit %q; use 1 to %v", v, maxPageSize)
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, i18n.Errorf("invalid_offset", "Invalid offset %q", v)
+		}
+	}
+
+	page := func(offset int) string {
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return r.URL.Path + "?" + query.Encode()
+	}
+	var links []string
+	if offset+limit < len(products) {
+		links = append(links, fmt.Sprintf(`<%v>; rel="next"`, page(offset+limit)))
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, fmt.Sprintf(`<%v>; rel="prev"`, page(prev)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	if offset > len(products) {
+		offset = len(products)
+	}
+	end := offset + limit
+	if end > len(products) {
+		end = len(products)
+	}
+	return products[offset:end], nil
+}
+
+// defaultCursorPageSize - the page size of a cursor-paged listing without ?limit=.
+const defaultCursorPageSize = 100
+
+/*
+cursorPage - a page of a cursor-paged listing. NextCursor is passed back as ?cursor= to get the following page;
+it's omitted on the last one.
+*/
+type cursorPage struct {
+	XMLName    xml.Name          `json:"-" xml:"products"`
+	Products   []productResource `json:"products" xml:"product"`
+	NextCursor string            `json:"next_cursor,omitempty" xml:"next_cursor,attr,omitempty"`
+}
+
+/*
+pageByCursor - a cursor-paged listing, requested with ?cursor= (empty for the first page) and an optional ?limit=.
+Unlike ?offset=, each page is a single bounded read from the backend, however far into the catalog it is; the
+trade-off is that pages follow storage order rather than price order, and can't be combined with name filters or
+searches.
+*/
+func (a *API) pageByCursor(w http.ResponseWriter, r *http.Request) (cursorPage, int, error) {
+	query := r.URL.Query()
+	if query.Get("offset") != "" || query.Get("name") != "" || query.Get("name_prefix") != "" || query.Get("q") != "" || query.Get("sort") != "" || filterParam(r) != "" {
+		return cursorPage{}, http.StatusBadRequest, fmt.Errorf("The cursor parameter can't be combined with offset, name, name_prefix, q, sort or filter")
+	}
+	limit := defaultCursorPageSize
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			return cursorPage{}, http.StatusBadRequest, i18n.Errorf("invalid_limit", "Invalid limit %q; use 1 to %v", v, maxPageSize)
+		}
+	}
+
+	page, err := a.Store.GetPage(r.Context(), limit, query.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, datastore.ErrInvalidCursor) {
+			return cursorPage{}, http.StatusBadRequest, err
+		}
+		return cursorPage{}, storeStatus(err), err
+	}
+	if status, err := productsInCurrency(w, r, page.Products); err != nil {
+		return cursorPage{}, status, err
+	}
+	if status, err := localizeProducts(w, r, page.Products); err != nil {
+		return cursorPage{}, status, err
+	}
+
+	body := cursorPage{Products: make([]productResource, len(page.Products)), NextCursor: page.Cursor}
+	for i, p := range page.Products {
+		body.Products[i] = productResource{Product: p, Links: productLinks(p.Id)}
+	}
+	if page.Cursor != "" {
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("cursor", page.Cursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%v?%v>; rel="next"`, r.URL.Path, query.Encode()))
+	}
+	return body, http.StatusOK, nil
+}
@@ -0,0 +1,21 @@
+//go:build !lambda
+
+/*
+Author: Jason Payne
+*/
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+/*
+listen - serves handler as a long-running HTTP server (see serve) and blocks until it fails. Builds with -tags lambda
+serve it on AWS Lambda instead; see lambda.go.
+*/
+func listen(cfg config.Server, handler http.Handler) error {
+	return serve(cfg, handler)
+}
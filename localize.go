@@ -0,0 +1,64 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// defaultLocale - the locale Products' own names and descriptions are written in (config.Config.DefaultLocale).
+var defaultLocale = "en"
+
+/*
+requestLocales - the locales the client wants Products in, most preferred first: the one named by ?locale=, if there
+is one, otherwise those in the Accept-Language header.
+*/
+func requestLocales(r *http.Request) ([]string, error) {
+	if v := r.URL.Query().Get("locale"); v != "" {
+		locale, err := datastore.ParseLocale(v)
+		if err != nil {
+			return nil, i18n.Errorf("invalid_locale", "Invalid locale %q; use a language tag such as fr or pt-BR", v)
+		}
+		return []string{locale}, nil
+	}
+	return i18n.Preferences(r.Header.Get("Accept-Language")), nil
+}
+
+/*
+localize - translates the Products' names and descriptions in place into the locale the client prefers (see
+datastore.Localize), and says which with Content-Language when they all ended up in the same one. On failure it
+returns the status to respond with.
+*/
+func localize(w http.ResponseWriter, r *http.Request, products ...*datastore.Product) (int, error) {
+	locales, err := requestLocales(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	w.Header().Add("Vary", "Accept-Language")
+
+	used := map[string]bool{}
+	for _, p := range products {
+		var locale string
+		*p, locale = datastore.Localize(*p, locales, defaultLocale)
+		used[locale] = true
+	}
+	if len(used) == 1 {
+		for locale := range used {
+			w.Header().Set("Content-Language", locale)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// localizeProducts - localize for a list of Products.
+func localizeProducts(w http.ResponseWriter, r *http.Request, products []datastore.Product) (int, error) {
+	pointers := make([]*datastore.Product, len(products))
+	for i := range products {
+		pointers[i] = &products[i]
+	}
+	return localize(w, r, pointers...)
+}
@@ -0,0 +1,102 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+/*
+lookupResults - the Products found by a lookup, in the order their IDs were given, and the IDs that weren't found
+(including those of expired Products).
+*/
+type lookupResults struct {
+	XMLName  xml.Name          `json:"-" xml:"lookup"`
+	Products []productResource `json:"products" xml:"product"`
+	Missing  []string          `json:"missing" xml:"missing>id"`
+}
+
+// lookupRequest - the body of POST /products/lookup, for lists of IDs too long for a query string.
+type lookupRequest struct {
+	XMLName xml.Name `json:"-" xml:"lookup"`
+	Ids     []string `json:"ids" xml:"id"`
+}
+
+/*
+LookupProducts - fetch specific Products by ID in one call, with the IDs in the body: {"ids": ["1", "2", "7"]}.
+It responds as GET /products?ids=1,2,7 does.
+*/
+func (a *API) LookupProducts(w http.ResponseWriter, r *http.Request) {
+	var req lookupRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+	a.lookupProducts(w, r, req.Ids)
+}
+
+// lookupIDs - the IDs in the ids query parameter, a comma-separated list.
+func lookupIDs(r *http.Request) []string {
+	ids := []string{}
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+/*
+lookupProducts - responds with the Products with the given IDs, in the order given, and the IDs that don't exist.
+The backend fetches them in as few calls as it can (BatchGetItem in DynamoDB). An ID may be repeated; it's only
+fetched once, but appears as often as it was given.
+*/
+func (a *API) lookupProducts(w http.ResponseWriter, r *http.Request, ids []string) {
+	fields, err := requestedFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	r = withFields(r, fields)
+
+	switch {
+	case len(ids) == 0:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("no_ids", "No product IDs were given"))
+		return
+	case len(ids) > maxPageSize:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("too_many_ids", "At most %v product IDs can be looked up at once", maxPageSize))
+		return
+	}
+	for _, id := range ids {
+		if !datastore.Strategy.Valid(id) {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_product_id", "Invalid product ID %q", id))
+			return
+		}
+	}
+
+	products, missing, err := a.Store.GetProducts(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if status, err := productsInCurrency(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	body := lookupResults{Products: make([]productResource, len(products)), Missing: missing}
+	for i, p := range products {
+		body.Products[i] = productResource{Product: p, Links: productLinks(p.Id)}
+	}
+	respond(w, r, http.StatusOK, sparse(body, fields))
+}
@@ -4,92 +4,455 @@ Author: Jason Payne
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/replay"
 
 	// Run the app in "test" mode.
 	db "github.com/bamajap/go-basic-api-app/dummydb"
 
 	// Run the app with DynamoDB.
 	// db "github.com/bamajap/go-basic-api-app/dynamodb"
-	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
 /*
-GetAllProducts - display all of the Products.
+productID - extracts the Product ID from the request path, validating it against the active ID strategy.
+*/
+func productID(r *http.Request) (string, error) {
+	id := mux.Vars(r)["id"]
+	if !datastore.Strategy.Valid(id) {
+		return "", i18n.Errorf("invalid_product_id", "Invalid product ID %q", id)
+	}
+	return id, nil
+}
+
+/*
+filterParam - the filter parameter. RSQL's ";" once separated query parameters too, so Go's query parsing drops any
+parameter containing one unescaped; filter is read from the raw query instead, letting clients write it either way.
+*/
+func filterParam(r *http.Request) string {
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		if v, ok := strings.CutPrefix(param, "filter="); ok {
+			if unescaped, err := url.QueryUnescape(v); err == nil {
+				return unescaped
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+/*
+listFilter - the filter selected by a listing request's parameters. A filter expression (?filter=) can say anything
+q, name or name_prefix can except for a search, so it can't be combined with them.
+*/
+func listFilter(r *http.Request) (datastore.Filter, error) {
+	query := r.URL.Query()
+	if v := filterParam(r); v != "" {
+		if query.Get("q") != "" || query.Get("name") != "" || query.Get("name_prefix") != "" {
+			return datastore.Filter{}, i18n.Errorf("filter_combined", "The filter parameter can't be combined with q, name or name_prefix")
+		}
+		expr, err := datastore.ParseFilter(v)
+		if err != nil {
+			return datastore.Filter{}, i18n.Errorf("invalid_filter", "Invalid filter %q: %v", v, err)
+		}
+		return datastore.Filter{Expr: expr}, nil
+	}
+	if q := query.Get("q"); q != "" {
+		return datastore.Filter{Query: q}, nil
+	}
+	if name := query.Get("name"); name != "" {
+		return datastore.Filter{Name: name}, nil
+	}
+	return datastore.Filter{NamePrefix: query.Get("name_prefix")}, nil
+}
+
+// listSort - the order a listing request asks for with ?sort=; nil for the default order.
+func listSort(r *http.Request) ([]datastore.SortKey, error) {
+	v := r.URL.Query().Get("sort")
+	if v == "" {
+		return nil, nil
+	}
+	keys, err := datastore.ParseSort(v)
+	if err != nil {
+		return nil, i18n.Errorf("invalid_sort", "Invalid sort %q: %v", v, err)
+	}
+	return keys, nil
+}
+
+/*
+listProducts - fetches the Products for a listing request, in the order asked for with ?sort=. Every listing-style
+endpoint goes through here so that they all honor the same filters and order. On failure it returns the status to
+respond with.
+*/
+func (a *API) listProducts(r *http.Request) ([]datastore.Product, int, error) {
+	keys, err := listSort(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	// The backend has to read the fields being sorted by, even if the response leaves them out.
+	if fields := datastore.Fields(r.Context()); keys != nil && fields != nil {
+		for _, key := range keys {
+			fields = append(fields, key.Field)
+		}
+		r = r.WithContext(datastore.WithFields(r.Context(), fields))
+	}
+
+	filter, err := listFilter(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	products, err := a.filterProducts(r, filter)
+	if err != nil {
+		return nil, storeStatus(err), err
+	}
+	if keys != nil {
+		datastore.SortProducts(products, keys)
+	}
+	return products, http.StatusOK, nil
+}
+
+// filterProducts - local helper function that reads the Products a listing's filters select, in their default order.
+func (a *API) filterProducts(r *http.Request, filter datastore.Filter) ([]datastore.Product, error) {
+	switch {
+	case filter.Query != "":
+		// Scoring needs every name, whatever fields the response has.
+		products, err := a.Store.GetAll(datastore.WithFields(r.Context(), nil))
+		if err != nil {
+			return nil, err
+		}
+		return datastore.RankByName(products, filter.Query), nil
+	case filter.Name != "":
+		return a.Store.FindByName(r.Context(), filter.Name)
+	case filter.NamePrefix != "":
+		return a.Store.SearchByPrefix(r.Context(), filter.NamePrefix)
+	case filter.Expr != nil:
+		return a.Store.FilterProducts(r.Context(), filter.Expr)
+	}
+	return a.Store.GetAll(r.Context())
+}
+
+/*
+CountProducts - the number of Products a listing with the same filters would return, without returning them.
+*/
+func (a *API) CountProducts(w http.ResponseWriter, r *http.Request) {
+	filter, err := listFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	count, err := a.Store.Count(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(count))
+	respond(w, r, http.StatusOK, productCount{Count: count})
+}
+
+/*
+productCount - the body of a count response.
+*/
+type productCount struct {
+	XMLName xml.Name `json:"-" xml:"count"`
+	Count   int      `json:"count" xml:",chardata"`
+}
+
+/*
+GetAllProducts - display all of the Products, or with ?ids=1,2,7 just those (see lookupProducts).
 */
-func GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	p, err := db.Items.GetAll()
+func (a *API) GetAllProducts(w http.ResponseWriter, r *http.Request) {
+	fields, err := requestedFields(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(p)
+	r = withFields(r, fields)
+
+	if r.URL.Query().Has("ids") {
+		a.lookupProducts(w, r, lookupIDs(r))
+		return
+	}
+	if media, _ := negotiate(r); media == mediaNDJSON {
+		a.streamProducts(w, r, fields)
+		return
+	}
+	if r.URL.Query().Has("cursor") {
+		page, status, err := a.pageByCursor(w, r)
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+		body, status, err := a.includeRelated(w, r, page)
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+		respond(w, r, status, sparse(body, fields))
+		return
+	}
+
+	p, status, err := a.listProducts(r)
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	// The whole filtered listing has been read already, so its size is free; a page doesn't show it.
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(p)))
+	if p, err = paginate(w, r, p); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if status, err := productsInCurrency(w, r, p); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, p); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	body, status, err := a.includeRelated(w, r, resources(p))
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	setLastModified(w, r, p)
+	respond(w, r, http.StatusOK, sparse(body, fields))
 }
 
 /*
-CreateProduct - create a new Product and add to the database.
+validateProduct - checks a Product as a client sent it, to create or replace one: it needs a name, a price that
+isn't negative, an expiry (if any) in the future, and valid barcode, translations and tags. Creates, bulk creates,
+updates, their dry runs and imports all check Products with this.
 */
-func CreateProduct(w http.ResponseWriter, r *http.Request) {
-	var p db.Product
+func validateProduct(p datastore.Product) error {
+	switch {
+	case strings.TrimSpace(p.Name) == "":
+		return errors.New("Name is required")
+	case p.Price < 0:
+		return errors.New("Price must be a non-negative number")
+	case p.ExpiresAt != nil && p.Expired():
+		return errors.New("expires_at is in the past")
+	}
+	if err := datastore.ValidBarcode(p.Barcode); err != nil {
+		return err
+	}
+	if err := datastore.ValidTranslations(p); err != nil {
+		return err
+	}
+	return datastore.ValidTags(p)
+}
+
+/*
+CreateProduct - create a new Product, with a server-assigned ID, and add to the database.
+*/
+func (a *API) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	dry, err := dryRun(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var p datastore.Product
+
+	if err := decodeBody(r, &p); err != nil {
+		bodyError(w, r, err)
 		return
 	}
 
 	defer r.Body.Close()
 
-	if err := db.Items.AddProduct(p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validateProduct(p); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if status, err := a.referenceError(r.Context(), []datastore.Product{p}); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if dry {
+		p.Id = ""
+		a.checkOnly(w, r, []datastore.Product{p})
+		return
+	}
+
+	// IDs are always assigned by the server; a client-supplied ID could silently overwrite another Product.
+	id, err := a.Store.NextID(r.Context())
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	p.Id = id
+
+	if err := a.Store.AddProduct(r.Context(), p); err != nil {
+		writeError(w, r, storeStatus(err), err)
 		return
 	}
+	stored := a.storedProduct(r, p)
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(p)
+	w.Header().Set("Location", productURL(p.Id))
+	respond(w, r, http.StatusCreated, resource(stored))
+}
+
+// maxBulkCreate - the most Products a single bulk create request may contain. Bulk creates are all-or-nothing,
+// so this matches the size of a single DynamoDB transaction.
+const maxBulkCreate = 100
+
+// putPolicy - what PUT does to a Product that doesn't exist: config.PutUpdate or config.PutUpsert; set from the config.
+var putPolicy = config.PutUpdate
+
+// uniqueNames - whether Products' names must be unique; set from the config.
+var uniqueNames bool
+
+// bulkSize - how much of a bulk create's limit the Products use: one each, and one more for each barcode and (with
+// unique names) each name, which are claimed in the same transaction.
+func bulkSize(products []datastore.Product) int {
+	n := len(products)
+	for _, p := range products {
+		if p.Barcode != "" {
+			n++
+		}
+		if uniqueNames && p.Name != "" {
+			n++
+		}
+	}
+	return n
+}
+
+/*
+CreateProducts - create several Products in one request, each with a server-assigned ID.
+*/
+func (a *API) CreateProducts(w http.ResponseWriter, r *http.Request) {
+	dry, err := dryRun(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var products productList
+
+	if err := decodeBody(r, &products); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+
+	defer r.Body.Close()
+
+	for i, p := range products {
+		if err := validateProduct(p); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("Product %v: %v", i+1, err))
+			return
+		}
+	}
+	if status, err := a.referenceError(r.Context(), products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+
+	if bulkSize(products) > maxBulkCreate {
+		writeError(w, r, http.StatusRequestEntityTooLarge, i18n.Errorf("bulk_too_large", "At most %v products can be created at once, counting each barcode and unique name as another", maxBulkCreate))
+		return
+	}
+	if dry {
+		for i := range products {
+			products[i].Id = ""
+		}
+		a.checkOnly(w, r, products)
+		return
+	}
+
+	for i := range products {
+		id, err := a.Store.NextID(r.Context())
+		if err != nil {
+			writeError(w, r, storeStatus(err), err)
+			return
+		}
+		products[i].Id = id
+	}
+
+	if err := a.Store.AddProducts(r.Context(), products); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	respond(w, r, http.StatusCreated, resources(a.storedProducts(r, products)))
 }
 
 /*
 GetProduct - display a single Product based on ID or Name.
 */
-func GetProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+func (a *API) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	p := db.Product{Id: id}
-	if err = db.Items.GetProduct(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	fields, err := requestedFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	p := datastore.Product{Id: id}
+	if err = a.Store.GetProduct(withFields(r, fields).Context(), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if status, err := inCurrency(w, r, &p.Price); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localize(w, r, &p); err != nil {
+		writeError(w, r, status, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(p)
+	body, status, err := a.includeRelated(w, r, resource(p))
+	if err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	setLastModified(w, r, []datastore.Product{p})
+	respond(w, r, http.StatusOK, sparse(body, fields))
 }
 
 /*
-UpdateProduct - update an existing Product.
+UpdateProduct - update an existing Product (200), or under the upsert PUT policy, create it (201).
 */
-func UpdateProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+func (a *API) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	dry, err := dryRun(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	var p db.Product
+	var p datastore.Product
 
-	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err = decodeBody(r, &p); err != nil {
+		bodyError(w, r, err)
 		return
 	}
 
@@ -97,42 +460,252 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
 	p.Id = id
 
-	if err = db.Items.UpdateProduct(p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err = validateProduct(p); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if status, err := a.referenceError(r.Context(), []datastore.Product{p}); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if dry {
+		// Only the upsert policy accepts a Product that doesn't exist.
+		current := datastore.Product{Id: id}
+		if err := a.Store.GetProduct(r.Context(), &current); err != nil && (putPolicy != config.PutUpsert || !errors.Is(err, datastore.ErrNotFound)) {
+			writeError(w, r, storeStatus(err), err)
+			return
+		}
+		a.checkOnly(w, r, []datastore.Product{p})
+		return
+	}
+
+	// Under the upsert policy a Product that doesn't exist is created with the ID in the path. If another request
+	// creates it first, the create conflicts rather than overwriting it.
+	created := false
+	stored, err := a.Store.UpdateProduct(r.Context(), p)
+	if errors.Is(err, datastore.ErrNotFound) && putPolicy == config.PutUpsert {
+		created = true
+		if err = a.Store.AddProduct(r.Context(), p); err == nil {
+			err = a.Store.AdvanceID(r.Context(), p.Id)
+		}
+		if err == nil {
+			stored = a.storedProduct(r, p)
+		}
+	}
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(p)
+	// Legacy clients always got 200.
+	// The response is the Product as stored, not as sent, e.g. with its rating.
+	if created && strictMode {
+		w.Header().Set("Location", productURL(stored.Id))
+		respond(w, r, http.StatusCreated, resource(stored))
+		return
+	}
+	respond(w, r, http.StatusOK, resource(stored))
+}
+
+/*
+storedProduct - a Product just written, as the datastore holds it: without what a client sent but the datastore
+doesn't keep (such as a rating) and with what it adds (such as updated_at). It's read strongly consistently, so the
+write is seen. The write has succeeded whatever happens, so if the read fails, the failure is logged and the Product
+is returned as written (see writtenProduct) rather than failing the request.
+*/
+func (a *API) storedProduct(r *http.Request, written datastore.Product) datastore.Product {
+	p := datastore.Product{Id: written.Id}
+	if err := a.Store.GetProduct(datastore.WithConsistentRead(r.Context(), true), &p); err != nil {
+		log.Printf("request_id=%v reading back product %v failed, so it's returned as written: %v", requestID(r), written.Id, err)
+		return writtenProduct(written)
+	}
+	return p
+}
+
+// storedProducts - the Products just written, as storedProduct reads them back, in the same order.
+func (a *API) storedProducts(r *http.Request, written []datastore.Product) []datastore.Product {
+	ids := make([]string, len(written))
+	for i, p := range written {
+		ids[i] = p.Id
+	}
+	found, missing, err := a.Store.GetProducts(datastore.WithConsistentRead(r.Context(), true), ids)
+	if err == nil && len(missing) > 0 {
+		err = fmt.Errorf("Products %v weren't found", missing)
+	}
+	if err != nil {
+		log.Printf("request_id=%v reading back products failed, so they're returned as written: %v", requestID(r), err)
+	}
+	byID := map[string]datastore.Product{}
+	for _, p := range found {
+		byID[p.Id] = p
+	}
+	stored := make([]datastore.Product, len(written))
+	for i, p := range written {
+		var ok bool
+		if stored[i], ok = byID[p.Id]; !ok {
+			stored[i] = writtenProduct(p)
+		}
+	}
+	return stored
+}
+
+/*
+writtenProduct - a Product as it was written, with what the datastore sets on a write that's known without reading
+it back: just its updated_at, which is now. Its rating and stock, which the datastore maintains, are left out.
+*/
+func writtenProduct(p datastore.Product) datastore.Product {
+	p.UpdatedAt = datastore.Modified(time.Now())
+	p.Rating, p.Stock = nil, nil
+	return p
 }
 
 /*
 DeleteProduct - delete a Product from the database.
 */
-func DeleteProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+func (a *API) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	p := db.Product{Id: id}
-	if err = db.Items.DeleteProduct(p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	p := datastore.Product{Id: id}
+	if err = a.Store.DeleteProduct(r.Context(), p); err != nil {
+		writeError(w, r, storeStatus(err), err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+
+	// A successful delete has nothing to return; legacy clients still expect the old result body.
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
+
+/*
+configure - checks cfg and applies the settings the handlers read, everything but the backends an API holds. Tests
+use it to run the handlers under a config of their own.
+*/
+func configure(cfg config.Config) error {
+	var err error
+	if datastore.Strategy, err = datastore.ParseIDStrategy(cfg.IDStrategy); err != nil {
+		return err
+	}
+	settings, err := newLiveSettings(cfg, nil)
+	if err != nil {
+		return err
+	}
+	if cfg.PutPolicy != config.PutUpdate && cfg.PutPolicy != config.PutUpsert {
+		return fmt.Errorf("Unknown put_policy %q; use %q or %q", cfg.PutPolicy, config.PutUpdate, config.PutUpsert)
+	}
+	if err := validateTenancy(cfg.Tenancy, cfg.Auth); err != nil {
+		return err
+	}
+	if err := validateMiddleware(cfg); err != nil {
+		return err
+	}
+	proxies, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if converter, err = newConverter(cfg.Currency); err != nil {
+		return err
+	}
+	locale, err := datastore.ParseLocale(cfg.DefaultLocale)
+	if err != nil {
+		return fmt.Errorf("default_locale: %v", err)
+	}
+	policies, err := parseCachePolicies(cfg.CacheControl)
+	if err != nil {
+		return err
+	}
+
+	live.Store(settings)
+	strictMode = cfg.Strict
+	uniqueNames = cfg.UniqueNames
+	strictJSON = cfg.StrictJSON
+	putPolicy = cfg.PutPolicy
+	defaultLocale = locale
+	cachePolicies = policies
+	cartTTL = cfg.Cart.TTL.Duration
+	trustedProxies = proxies
+	return nil
 }
 
 func main() {
-	fmt.Println("Initializing database...")
-	if initErr := db.Initialize(); initErr != nil {
-		if cleanupErr := db.Cleanup(); cleanupErr != nil {
-			fmt.Println(cleanupErr.Error())
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file (default $CONFIG_FILE)")
+	showVersion := flag.Bool("version", false, "print the build's version, commit and build time, and exit")
+	flag.Parse()
+	if *showVersion {
+		printVersion()
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if err := configure(cfg); err != nil {
+		log.Fatal(err.Error())
+	}
+	if _, err := initErrorReporting(cfg.ErrorReporting); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// The backend selected by the db import above; everything else reaches it through the API built on it below.
+	var store datastore.Datastore = &db.Items
+	switch cfg.Replay.Mode {
+	case config.ReplayPlay:
+		// Every call is answered from the recording, so the backend isn't needed at all.
+		fmt.Printf("Replaying datastore calls from %v\n", cfg.Replay.File)
+		if store, err = replay.NewPlayer(cfg.Replay.File); err != nil {
+			log.Fatal(err.Error())
+		}
+	case "", config.ReplayRecord:
+		fmt.Println("Initializing database...")
+		if initErr := db.Initialize(cfg); initErr != nil {
+			if cleanupErr := db.Cleanup(); cleanupErr != nil {
+				fmt.Println(cleanupErr.Error())
+			}
+			log.Fatal(initErr.Error())
 		}
-		log.Fatal(initErr.Error())
+		if cfg.Replay.Mode == config.ReplayRecord {
+			fmt.Printf("Recording datastore calls to %v\n", cfg.Replay.File)
+			if store, err = replay.NewRecorder(store, cfg.Replay.File); err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+	default:
+		log.Fatalf("Unknown replay mode %q; use %q or %q", cfg.Replay.Mode, config.ReplayRecord, config.ReplayPlay)
+	}
+	// Backend calls can have faults injected (see chaos), whether or not any are configured yet.
+	store = datastore.Intercept(store, injectCallFaults)
+	if cfg.Retry.Enabled {
+		// Inside the breaker, which only sees how a call ended up, after its retries.
+		store = datastore.Intercept(store, datastore.Retrying(datastore.RetryPolicy{
+			Attempts:    cfg.Retry.Attempts,
+			MinBackoff:  cfg.Retry.MinBackoff.Duration,
+			MaxBackoff:  cfg.Retry.MaxBackoff.Duration,
+			BudgetRatio: cfg.Retry.Budget.Ratio,
+			BudgetMin:   cfg.Retry.Budget.Min,
+		}))
+	}
+	circuit, err := newBreaker(cfg.CircuitBreaker)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if circuit != nil {
+		// Outside the faults too, so injected failures can open it.
+		store = datastore.Intercept(store, circuit)
+	}
+	metrics, err := newCloudWatch(context.Background(), cfg.Metrics)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if metrics != nil {
+		// Outside the faults, so injected latency and failures show in the metrics as real ones would.
+		store = datastore.Intercept(store, metrics.recordCall)
 	}
 
 	// Ideally, the server shutdown would get handled gracefully allowing for post-shutdown cleanup tasks like below.
@@ -142,15 +715,50 @@ func main() {
 	// 	}
 	// }()
 
+	api, err := newAPI(cfg, store)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	api.Metrics = metrics
+	scheduler, err := newScheduler(cfg, api)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	go api.sweepReservations(cfg.Tenancy.Names())
+	api.Jobs.Start(context.Background())
+	scheduler.Start(context.Background())
+	metrics.Start(context.Background())
+	api.Usage.Start(context.Background(), cfg.Usage.FlushInterval.Duration)
+	// A replay has no backend to follow.
+	if cfg.ChangeFeed.Enabled && cfg.Replay.Mode != config.ReplayPlay {
+		api.Events.Subscribe(events.Log)
+		switch cfg.ChangeFeed.Source {
+		case config.ChangeFeedOutbox:
+			go api.publishOutbox(context.Background(), cfg.Tenancy.Names(), cfg.ChangeFeed.PollInterval.Duration)
+		case config.ChangeFeedStream:
+			go func() {
+				if err := db.FollowChanges(context.Background(), cfg, api.Events); err != nil {
+					log.Printf("The change feed stopped: %v", err)
+				}
+			}()
+		default:
+			log.Fatalf("Unknown change feed source %q; use %q or %q", cfg.ChangeFeed.Source, config.ChangeFeedOutbox, config.ChangeFeedStream)
+		}
+	}
+
 	fmt.Println("DONE!")
+	if *configPath != "" {
+		go watchConfig(*configPath)
+	}
 
-	router := mux.NewRouter()
-	router.HandleFunc("/", GetAllProducts).Methods(http.MethodGet)
-	router.HandleFunc("/product", CreateProduct).Methods(http.MethodPost)
-	router.HandleFunc("/product/{id:[0-9]+}", GetProduct).Methods(http.MethodGet)
-	router.HandleFunc("/product/{id:[0-9]+}", UpdateProduct).Methods(http.MethodPut)
-	router.HandleFunc("/product/{id:[0-9]+}", DeleteProduct).Methods(http.MethodDelete)
+	router := newRouter(cfg, api)
+	if bodySchemas, err = loadSchemas(cfg.Schemas, router); err != nil {
+		log.Fatal(err.Error())
+	}
 
-	// http://localhost:8000
-	log.Fatal(http.ListenAndServe(":8000", router))
+	// http://localhost:8000/v1
+	if err := listen(cfg.Server, newHandler(cfg, api, router)); err != nil {
+		log.Fatal(err.Error())
+	}
 }
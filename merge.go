@@ -0,0 +1,89 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+)
+
+// mergeRequest - the body of a merge: the duplicate to fold into the Product in the path.
+type mergeRequest struct {
+	XMLName xml.Name `json:"-" xml:"merge"`
+	From    string   `json:"from" xml:"from"`
+}
+
+/*
+MergeProduct - fold a duplicate Product, named by "from" in the body, into the one in the path (see datastore.Merge):
+its reviews and variants move across, variants matching one of the Product's have their stock combined, and the
+duplicate is deleted. The response is the Product as it is afterwards, e.g. with its new rating; what was moved is
+recorded, and served by GetMerges.
+*/
+func (a *API) MergeProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	var req mergeRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	switch {
+	case !datastore.Strategy.Valid(req.From):
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_product_id", "Invalid product ID %q", req.From))
+		return
+	case req.From == id:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("merge_into_itself", "A product can't be merged into itself"))
+		return
+	}
+
+	if _, err := datastore.Merge(r.Context(), a.Store, id, req.From); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	p := datastore.Product{Id: id}
+	if err := a.Store.GetProduct(r.Context(), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, resource(p))
+}
+
+// mergeList - the response to a request for a Product's merges.
+type mergeList struct {
+	XMLName xml.Name                `json:"-" xml:"merges"`
+	Id      string                  `json:"id" xml:"id,attr"`
+	Merges  []datastore.MergeRecord `json:"merges" xml:"merge"`
+}
+
+/*
+GetMerges - the duplicates merged into a Product, oldest first, each with what was moved from it, including the
+stock, and when. A merge that failed partway has no finished_at.
+*/
+func (a *API) GetMerges(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.Store.GetProduct(datastore.IDsOnly(r.Context()), &datastore.Product{Id: id}); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	merges, err := datastore.Merges(r.Context(), a.Store, id)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, mergeList{Id: id, Merges: merges})
+}
@@ -0,0 +1,157 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gorilla/mux"
+)
+
+/*
+middlewareFactory - builds a named middleware for the app as configured. router is the whole router, for middleware
+that needs to know which route a request is for. A nil result means the middleware has nothing to do under this
+config, so it's left out of the chain.
+*/
+type middlewareFactory func(cfg config.Config, api *API, router *mux.Router) mux.MiddlewareFunc
+
+// serverMiddleware - the middleware config.Middleware.Server can name.
+var serverMiddleware = map[string]middlewareFactory{
+	"request_id": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return withRequestID },
+	"error_reports": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc {
+		// Without a client (no DSN is configured), there is nowhere to report to.
+		if sentry.CurrentHub().Client() == nil {
+			return nil
+		}
+		return withErrorReports
+	},
+	"cors": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return withCORS },
+	"metrics": func(_ config.Config, api *API, router *mux.Router) mux.MiddlewareFunc {
+		if api.Metrics == nil {
+			return nil
+		}
+		return func(next http.Handler) http.Handler { return api.Metrics.handler(router, next) }
+	},
+	"usage": func(_ config.Config, api *API, router *mux.Router) mux.MiddlewareFunc {
+		if api.Usage == nil {
+			return nil
+		}
+		return func(next http.Handler) http.Handler { return countUsage(api.Usage, router, next) }
+	},
+}
+
+/*
+routerMiddleware - the middleware config.Middleware.Router can name. They run once the route is known, so what they
+log and report can say which route it was.
+*/
+var routerMiddleware = map[string]middlewareFactory{
+	"recovery": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return recoverPanics },
+}
+
+// apiMiddleware - the middleware config.Middleware.API can name.
+var apiMiddleware = map[string]middlewareFactory{
+	"timeout": func(cfg config.Config, _ *API, _ *mux.Router) mux.MiddlewareFunc {
+		return withTimeout(cfg.Server.RequestTimeout.Duration)
+	},
+	"faults":     func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return injectFaults },
+	"rate_limit": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return rateLimit },
+	"csrf":       func(_ config.Config, api *API, _ *mux.Router) mux.MiddlewareFunc { return requireCSRFToken(api.CSRF) },
+	"auth":       func(_ config.Config, api *API, _ *mux.Router) mux.MiddlewareFunc { return requireAuth(api.Auth) },
+	"signatures": func(_ config.Config, api *API, _ *mux.Router) mux.MiddlewareFunc {
+		return requireSignature(api.Signatures)
+	},
+	"roles":       func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return requireRole(roleReader) },
+	"tenant":      func(cfg config.Config, _ *API, _ *mux.Router) mux.MiddlewareFunc { return requireTenant(cfg.Tenancy) },
+	"consistency": func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return readConsistency },
+	"decompress":  func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return decompressBody },
+	"schema":      func(config.Config, *API, *mux.Router) mux.MiddlewareFunc { return validateSchema },
+}
+
+/*
+validateMiddleware - checks that the chains only name middleware that exists, each once. While auth is configured,
+the API chain must keep "auth" and "roles": leaving them out would open the API to anyone. "tenant" must come after
+"auth" and "signatures", since it checks the tenants the caller may use.
+*/
+func validateMiddleware(cfg config.Config) error {
+	chains := []struct {
+		name      string
+		names     []string
+		factories map[string]middlewareFactory
+	}{
+		{"server", cfg.Middleware.Server, serverMiddleware},
+		{"router", cfg.Middleware.Router, routerMiddleware},
+		{"api", cfg.Middleware.API, apiMiddleware},
+	}
+	for _, chain := range chains {
+		seen := map[string]bool{}
+		for _, name := range chain.names {
+			if _, ok := chain.factories[name]; !ok {
+				return fmt.Errorf("Unknown %v middleware %q; use one of %v", chain.name, name, middlewareNames(chain.factories))
+			}
+			if seen[name] {
+				return fmt.Errorf("Middleware %q is in the %v chain more than once", name, chain.name)
+			}
+			seen[name] = true
+		}
+	}
+
+	if cfg.Auth.Scheme != "" {
+		for _, required := range []string{"auth", "roles"} {
+			if !slices.Contains(cfg.Middleware.API, required) {
+				return fmt.Errorf("The api middleware chain needs %q while auth is configured", required)
+			}
+		}
+	}
+	if tenant := slices.Index(cfg.Middleware.API, "tenant"); tenant >= 0 {
+		for _, before := range []string{"auth", "signatures"} {
+			if slices.Index(cfg.Middleware.API, before) > tenant {
+				return fmt.Errorf("The api middleware chain needs %q before \"tenant\"", before)
+			}
+		}
+	}
+	return nil
+}
+
+// middlewareNames - the names of the middleware in a registry, sorted, for error messages.
+func middlewareNames(factories map[string]middlewareFactory) string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+/*
+middlewareChain - builds the named middleware, in order, leaving out any with nothing to do. The names must have
+passed validateMiddleware.
+*/
+func middlewareChain(names []string, factories map[string]middlewareFactory, cfg config.Config, api *API, router *mux.Router) []mux.MiddlewareFunc {
+	var chain []mux.MiddlewareFunc
+	for _, name := range names {
+		if mw := factories[name](cfg, api, router); mw != nil {
+			chain = append(chain, mw)
+		}
+	}
+	return chain
+}
+
+/*
+newHandler - router wrapped in the server middleware chain: what the listener serves.
+*/
+func newHandler(cfg config.Config, api *API, router *mux.Router) http.Handler {
+	var handler http.Handler = router
+	chain := middlewareChain(cfg.Middleware.Server, serverMiddleware, cfg, api, router)
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
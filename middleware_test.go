@@ -0,0 +1,95 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+func TestMiddlewareChains(t *testing.T) {
+	cfg := config.Default()
+	cfg.Middleware.Server = []string{"cors"}
+	cfg.Middleware.API = []string{"auth", "roles"}
+	h := testServer(t, cfg, fixtureStore(t))
+
+	w := do(h, "GET", "/v1/product/1", "")
+	if w.Code != http.StatusOK || w.Header().Get(requestIDHeader) != "" {
+		t.Fatalf("Got status %v, request ID %q; want 200 without an ID", w.Code, w.Header().Get(requestIDHeader))
+	}
+}
+
+func TestValidateMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*config.Config)
+		valid  bool
+	}{
+		{name: "defaults", modify: func(*config.Config) {}, valid: true},
+		{name: "empty chains", modify: func(c *config.Config) { c.Middleware = config.Middleware{} }, valid: true},
+		{name: "unknown", modify: func(c *config.Config) { c.Middleware.API = []string{"gzip"} }},
+		{name: "wrong chain", modify: func(c *config.Config) { c.Middleware.Server = []string{"auth"} }},
+		{name: "repeated", modify: func(c *config.Config) { c.Middleware.Router = []string{"recovery", "recovery"} }},
+		{name: "auth left out", modify: func(c *config.Config) {
+			c.Auth.Scheme = config.AuthBasic
+			c.Middleware.API = []string{"timeout", "roles"}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Default()
+			tc.modify(&cfg)
+			if err := validateMiddleware(cfg); (err == nil) != tc.valid {
+				t.Fatalf("Got %v; want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	testServer(t, config.Default(), fixtureStore(t))
+	var got tracecontext.Span
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = tracecontext.FromContext(r.Context())
+	}))
+
+	for _, tc := range []struct {
+		name, traceparent string
+		tracestate        []string
+		joined            bool
+		state             string
+	}{
+		{"joins the caller's trace", parent, []string{"vendor=a,other=b", "third=c"}, true, "vendor=a,other=b,third=c"},
+		{"later versions read as 00", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", nil, true, ""},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", nil, false, ""},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", nil, false, ""},
+		{"upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", nil, false, ""},
+		{"trailing data in 00", parent + "-extra", []string{"vendor=a"}, false, ""},
+		{"none", "", nil, false, ""},
+	} {
+		r := newRequest("GET", "/v1/products", "")
+		if tc.traceparent != "" {
+			r.Header.Set("traceparent", tc.traceparent)
+		}
+		for _, state := range tc.tracestate {
+			r.Header.Add("tracestate", state)
+		}
+		record(h, r)
+
+		switch {
+		case tc.joined && (got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.Flags != tracecontext.Sampled):
+			t.Errorf("%v: got %+v, want a span in the caller's sampled trace", tc.name, got)
+		case !tc.joined && (got.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" || got.Flags != 0):
+			t.Errorf("%v: got %+v, want a new, unsampled trace", tc.name, got)
+		case got.SpanID == "00f067aa0ba902b7" || len(got.SpanID) != 16 || got.State != tc.state:
+			t.Errorf("%v: got %+v, want a span of its own with tracestate %q", tc.name, got, tc.state)
+		}
+		if parsed, ok := tracecontext.Parse(got.Traceparent()); !ok || parsed.TraceID != got.TraceID || parsed.SpanID != got.SpanID {
+			t.Errorf("%v: traceparent %v doesn't parse back", tc.name, got.Traceparent())
+		}
+	}
+}
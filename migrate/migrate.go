@@ -0,0 +1,80 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package migrate runs versioned schema migrations against a backend.
+
+Each backend keeps an ordered list of Migrations, numbered from 1, and records the last one applied in a
+VersionStore. On start-up Run applies, in order, every Migration newer than the recorded version. Several
+instances may start at once, so migrations must be idempotent: one may be run again if another instance is
+applying it at the same time.
+*/
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Migration - one forward step in a backend's schema.
+*/
+type Migration struct {
+	// Version - the schema version after this Migration; versions start at 1 and go up by one.
+	Version int
+	// Description - a short summary, printed when the Migration is applied.
+	Description string
+	// Up - applies the Migration.
+	Up func(ctx context.Context) error
+}
+
+/*
+VersionStore - where a backend records its schema version.
+*/
+type VersionStore interface {
+	// SchemaVersion - the last Migration applied; 0 if none have been.
+	SchemaVersion(ctx context.Context) (int, error)
+	// SetSchemaVersion - records that a Migration has been applied. The version must never go backwards.
+	SetSchemaVersion(ctx context.Context, version int) error
+}
+
+// Latest - the schema version once every Migration has been applied.
+func Latest(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+/*
+Run - applies the Migrations newer than the store's schema version, recording each as it completes, so a failed
+run picks up where it left off next time. A store newer than the Migrations (i.e. an older build of the app)
+is an error rather than something to run against.
+*/
+func Run(ctx context.Context, store VersionStore, migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("Migration %q has version %v; expected %v", m.Description, m.Version, i+1)
+		}
+	}
+
+	current, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading the schema version: %v", err)
+	}
+	if latest := Latest(migrations); current > latest {
+		return fmt.Errorf("The schema is at version %v, but this build of the app only knows up to version %v", current, latest)
+	}
+
+	for _, m := range migrations[current:] {
+		fmt.Printf("Applying migration %v: %v...\n", m.Version, m.Description)
+		if err := m.Up(ctx); err != nil {
+			return fmt.Errorf("Migration %v (%v) failed: %v", m.Version, m.Description, err)
+		}
+		if err := store.SetSchemaVersion(ctx, m.Version); err != nil {
+			return fmt.Errorf("Error recording schema version %v: %v", m.Version, err)
+		}
+	}
+	return nil
+}
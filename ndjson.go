@@ -0,0 +1,75 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+/*
+streamProducts - the listing as NDJSON, for clients that send Accept: application/x-ndjson: one product resource per
+line, written and flushed a page at a time as the pages are read from the backend, so the catalog is never held in
+memory at once. Like a cursor-paged listing, it follows storage order and can't be filtered by name or search, or sorted.
+
+Once the first page is sent, the status can't change; if a later page can't be read, the error is logged and the
+response is aborted, so the client sees the stream break off rather than end.
+*/
+func (a *API) streamProducts(w http.ResponseWriter, r *http.Request, fields fieldSet) {
+	query := r.URL.Query()
+	if query.Has("cursor") || query.Get("offset") != "" || query.Get("name") != "" || query.Get("name_prefix") != "" || query.Get("q") != "" || query.Get("sort") != "" || filterParam(r) != "" {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("An NDJSON listing can't be combined with cursor, offset, name, name_prefix, q, sort or filter"))
+		return
+	}
+
+	started := false
+	fail := func(status int, err error) {
+		if !started {
+			writeError(w, r, status, err)
+			return
+		}
+		log.Printf("request_id=%v NDJSON listing aborted: %v", requestID(r), err)
+		panic(http.ErrAbortHandler)
+	}
+
+	page, err := a.Store.GetPage(r.Context(), defaultCursorPageSize, "")
+	for {
+		if err != nil {
+			fail(storeStatus(err), err)
+			return
+		}
+		if status, err := productsInCurrency(w, r, page.Products); err != nil {
+			fail(status, err)
+			return
+		}
+		if status, err := localizeProducts(w, r, page.Products); err != nil {
+			fail(status, err)
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", mediaNDJSON)
+			w.Header().Add("Vary", "Accept")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		enc := json.NewEncoder(w)
+		for _, p := range page.Products {
+			if err := enc.Encode(sparse(productResource{Product: p, Links: productLinks(p.Id)}, fields)); err != nil {
+				// The client has gone.
+				return
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if page.Cursor == "" {
+			return
+		}
+		page, err = a.Store.GetPage(r.Context(), defaultCursorPageSize, page.Cursor)
+	}
+}
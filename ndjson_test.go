@@ -0,0 +1,128 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+func TestNDJSONListingStreamsPages(t *testing.T) {
+	store := fixtureStore(t)
+	ctx := context.Background()
+	for i := 0; i < defaultCursorPageSize; i++ {
+		id, err := store.NextID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddProduct(ctx, datastore.Product{Id: id, Name: "Pear " + id, Price: money("1.5")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pages, reads := 0, 0
+	counted := datastore.Intercept(store, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		switch method {
+		case "GetPage":
+			pages++
+		case "GetAll":
+			reads++
+		}
+		return call(ctx)
+	})
+	h := testServer(t, config.Default(), counted)
+
+	r := newRequest("GET", "/v1/products?fields=name", "")
+	r.Header.Set("Accept", "application/x-ndjson")
+	w := record(h, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != mediaNDJSON {
+		t.Fatalf("Got status %v, Content-Type %q; body %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	lines := 0
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var p struct {
+			Id    string   `json:"id"`
+			Name  string   `json:"name"`
+			Price *float64 `json:"price"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatalf("Line %v isn't a JSON object: %v; %s", lines+1, err, scanner.Bytes())
+		}
+		if p.Id == "" || p.Name == "" || p.Price != nil {
+			t.Fatalf("Line %v should have only the id and name: %s", lines+1, scanner.Bytes())
+		}
+		seen[p.Id] = true
+		lines++
+	}
+	if want := defaultCursorPageSize + 3; lines != want || len(seen) != want {
+		t.Fatalf("Got %v lines (%v products), want %v", lines, len(seen), want)
+	}
+	if pages != 2 || reads != 0 {
+		t.Fatalf("Read %v pages and the whole catalog %v times; want 2 pages only", pages, reads)
+	}
+
+	for _, c := range []struct {
+		name   string
+		path   string
+		store  datastore.Datastore
+		status int
+	}{
+		{"filtered", "/v1/products?name=Apple", store, http.StatusBadRequest},
+		{"backend down", "/v1/products", failing(store, map[string]error{"GetPage": errUnavailable}), http.StatusServiceUnavailable},
+	} {
+		r := newRequest("GET", c.path, "")
+		r.Header.Set("Accept", "application/x-ndjson")
+		if w := record(testServer(t, config.Default(), c.store), r); w.Code != c.status || errorCode(w) == "" {
+			t.Fatalf("%v: got status %v, want %v; body %s", c.name, w.Code, c.status, w.Body)
+		}
+	}
+}
+
+func TestNDJSONImportIsBatchedAsItIsRead(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 2*maxBulkCreate; i++ {
+		fmt.Fprintf(&body, `{"name": "Pear %v", "price": 1.5}`+"\n", i)
+	}
+	body.WriteString("\n{not json}\n" + `{"name": "Free lunch", "price": -1}` + "\n")
+
+	batches := 0
+	store := datastore.Intercept(fixtureStore(t), func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		if method == "AddProducts" {
+			batches++
+		}
+		return call(ctx)
+	})
+	r := newRequest("POST", "/v1/products/import", body.String())
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := record(testServer(t, config.Default(), store), r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != mediaNDJSON {
+		t.Fatalf("Got status %v, Content-Type %q; body %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var summary importSummary
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary != (importSummary{Created: 2 * maxBulkCreate, Failed: 2}) || len(lines) != 2*maxBulkCreate+3 {
+		t.Fatalf("Got %+v and %v lines", summary, len(lines))
+	}
+	var bad importRow
+	json.Unmarshal([]byte(lines[len(lines)-3]), &bad)
+	if bad.Row != 2*maxBulkCreate+2 || bad.Error == "" {
+		t.Fatalf("The unparseable line was reported as %+v", bad)
+	}
+	if batches != 2 {
+		t.Fatalf("Wrote %v batches, want 2", batches)
+	}
+}
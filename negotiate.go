@@ -0,0 +1,224 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/productpb"
+)
+
+const (
+	mediaJSON = "application/json"
+	mediaXML  = "application/xml"
+	// mediaNDJSON - newline-delimited JSON, one value per line; only the product listing streams it.
+	mediaNDJSON = "application/x-ndjson"
+)
+
+// errUnsupportedMediaType - the request body is in a format the API doesn't read.
+var errUnsupportedMediaType = i18n.Errorf("unsupported_media_type", "Unsupported Content-Type; send application/json, application/vnd.api+json, application/xml or application/x-protobuf")
+
+// errNotAcceptable - none of the formats in the Accept header can be produced.
+var errNotAcceptable = i18n.Errorf("not_acceptable", "Not Acceptable; the API can respond with application/json, application/vnd.api+json, application/xml or application/x-protobuf")
+
+/*
+negotiate - picks the response media type from the request's Accept header, honoring q-values.
+JSON is the default when the header is missing or accepts anything.
+*/
+func negotiate(r *http.Request) (string, error) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return mediaJSON, nil
+	}
+
+	type candidate struct {
+		media string
+		q     float64
+	}
+	candidates := []candidate{}
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{media, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		switch c.media {
+		case mediaJSON, "application/*", "*/*":
+			return mediaJSON, nil
+		case mediaXML, "text/xml":
+			return mediaXML, nil
+		case mediaJSONAPI:
+			return mediaJSONAPI, nil
+		case productpb.MediaType:
+			return productpb.MediaType, nil
+		case mediaNDJSON:
+			return mediaNDJSON, nil
+		}
+	}
+
+	// Legacy clients always got JSON, whatever they asked for.
+	if !strictMode {
+		return mediaJSON, nil
+	}
+	return mediaJSON, errNotAcceptable
+}
+
+/*
+bodyFormat - how decodeBody reads the request body, going by its Content-Type: mediaXML, productpb.MediaType,
+mediaJSONAPI or mediaJSON.
+*/
+func bodyFormat(r *http.Request) (string, error) {
+	media := mediaJSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if media, _, err = mime.ParseMediaType(ct); err != nil {
+			return "", errUnsupportedMediaType
+		}
+	}
+
+	switch {
+	case media == mediaXML || media == "text/xml" || strings.HasSuffix(media, "+xml"):
+		return mediaXML, nil
+	case media == productpb.MediaType:
+		return productpb.MediaType, nil
+	case media == mediaJSONAPI:
+		return mediaJSONAPI, nil
+	case media == mediaJSON || strings.HasSuffix(media, "+json") || !strictMode:
+		return mediaJSON, nil
+	}
+	return "", errUnsupportedMediaType
+}
+
+/*
+decodeBody - reads the request body into v, as XML, protobuf, JSON:API or JSON depending on its Content-Type.
+*/
+func decodeBody(r *http.Request, v interface{}) error {
+	format, err := bodyFormat(r)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case mediaXML:
+		return xml.NewDecoder(r.Body).Decode(v)
+	case productpb.MediaType:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case *datastore.Product:
+			return productpb.UnmarshalProduct(b, v)
+		case *productList:
+			return productpb.UnmarshalProductList(b, (*[]datastore.Product)(v))
+		}
+		return errUnsupportedMediaType
+	case mediaJSONAPI:
+		return decodeJSONAPI(r.Body, v)
+	}
+	return decodeJSON(r.Body, v)
+}
+
+// strictJSON - whether JSON request bodies may only have fields the API knows; set from the config.
+var strictJSON bool
+
+/*
+decodeJSON - reads a JSON document into v. Anything after the document is an error, rather than being ignored, as is
+(with strict_json) a field v doesn't have.
+*/
+func decodeJSON(body io.Reader, v interface{}) error {
+	dec := json.NewDecoder(body)
+	if strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("Unexpected data after the JSON document")
+	}
+	return nil
+}
+
+// bodyError - writes the response for a decodeBody failure.
+func bodyError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == errUnsupportedMediaType {
+		writeError(w, r, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, err)
+}
+
+/*
+productList - a listing of Products. It encodes as a bare array in JSON; XML needs a root element.
+*/
+type productList []datastore.Product
+
+func (l productList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "products"
+	return e.EncodeElement(struct {
+		Products []datastore.Product `xml:"product"`
+	}{l}, start)
+}
+
+func (l *productList) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var list struct {
+		Products []datastore.Product `xml:"product"`
+	}
+	if err := d.DecodeElement(&list, &start); err != nil {
+		return err
+	}
+	*l = list.Products
+	return nil
+}
+
+// protobufBody - encodes the product resources that have a protobuf representation (without links, which the proto
+// doesn't define); ok is false for anything else.
+func protobufBody(v interface{}) (b []byte, ok bool) {
+	switch v := v.(type) {
+	case datastore.Product:
+		return productpb.MarshalProduct(v), true
+	case productList:
+		return productpb.MarshalProductList(v), true
+	case productResource:
+		return productpb.MarshalProduct(v.Product), true
+	case resourceList:
+		products := make([]datastore.Product, len(v))
+		for i, r := range v {
+			products[i] = r.Product
+		}
+		return productpb.MarshalProductList(products), true
+	}
+	return nil, false
+}
+
+/*
+result - the legacy body for operations that have nothing else to return.
+*/
+type result struct {
+	XMLName xml.Name `json:"-" xml:"result"`
+	Result  string   `json:"result" xml:",chardata"`
+}
@@ -0,0 +1,179 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/gorilla/mux"
+)
+
+// maxOrderLines - the most lines an order may have. With the order itself, each line's stock update fits in a
+// single DynamoDB transaction.
+const maxOrderLines = 99
+
+// maxQuantity - the most of one item an order line, cart item or reservation can be for.
+const maxQuantity = 1000000
+
+// orderPath - route template for a single order. Order IDs are always UUIDs.
+func orderPath() string {
+	return "/orders/{order:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// orderURL - the canonical location of an order.
+func orderURL(id string) string {
+	return currentVersion + "/orders/" + id
+}
+
+/*
+priceOrder - checks that every line of an order names a live Product (and, for a Product with variants, one of
+them) with enough stock, and fills in the unit prices and total. A Product without variants only tracks stock once
+it has been stocked at a location; a total too large to represent is refused. On failure it returns the status to
+respond with.
+*/
+func (a *API) priceOrder(r *http.Request, order *datastore.Order) (int, error) {
+	if len(order.Lines) == 0 || len(order.Lines) > maxOrderLines {
+		return http.StatusBadRequest, fmt.Errorf("An order needs from 1 to %v lines", maxOrderLines)
+	}
+
+	type item struct{ product, variant, reservation string }
+	seen := map[item]bool{}
+	var total datastore.Money
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		bad := func(format string, args ...interface{}) (int, error) {
+			return http.StatusBadRequest, fmt.Errorf("Line %v: "+format, append([]interface{}{i + 1}, args...)...)
+		}
+		switch {
+		case line.Quantity < 1 || line.Quantity > maxQuantity:
+			return bad("quantity must be from 1 to %v", maxQuantity)
+		case !datastore.Strategy.Valid(line.ProductId):
+			return bad("invalid product ID %q", line.ProductId)
+		case seen[item{line.ProductId, line.VariantId, line.ReservationId}]:
+			return bad("product <%v> is already in the order", line.ProductId)
+		}
+		seen[item{line.ProductId, line.VariantId, line.ReservationId}] = true
+
+		p := datastore.Product{Id: line.ProductId}
+		if err := a.Store.GetProduct(datastore.WithFields(r.Context(), []string{datastore.FieldPrice, datastore.FieldStock}), &p); err != nil {
+			return bad("%v", err)
+		}
+		variants, err := a.Store.GetVariants(r.Context(), p.Id)
+		if err != nil {
+			return storeStatus(err), err
+		}
+
+		line.Price = p.Price
+		var v *datastore.Variant
+		if line.VariantId == "" {
+			if len(variants) > 0 {
+				return bad("product <%v> has variants; choose one with variant_id", p.Id)
+			}
+		} else {
+			v = &datastore.Variant{ProductId: p.Id, Id: line.VariantId}
+			if err := a.Store.GetVariant(r.Context(), v); err != nil {
+				return bad("%v", err)
+			}
+			if v.Price != nil {
+				line.Price = *v.Price
+			}
+		}
+		if status, err := a.checkStock(r, line, p, v); err != nil {
+			return status, fmt.Errorf("Line %v: %v", i+1, err)
+		}
+		subtotal, err := line.Price.Times(line.Quantity)
+		if err == nil {
+			total, err = total.Add(subtotal)
+		}
+		if err != nil {
+			return bad("%v", err)
+		}
+	}
+	order.Total = total
+	return http.StatusOK, nil
+}
+
+/*
+checkStock - checks that an order line's variant (v), or its Product if it has none, has the stock it needs: held by
+the line's reservation, if it has one, or otherwise available now. A Product's stock is its total across locations,
+and one that has never been stocked at a location doesn't track stock. On failure it returns the status to respond
+with.
+*/
+func (a *API) checkStock(r *http.Request, line *datastore.OrderLine, p datastore.Product, v *datastore.Variant) (int, error) {
+	if line.ReservationId == "" {
+		switch {
+		case v != nil && v.Stock < line.Quantity:
+			return http.StatusConflict, fmt.Errorf("only %v of variant <%v> in stock", v.Stock, v.Id)
+		case v == nil && p.Stock != nil && p.Stock.Total() < line.Quantity:
+			return http.StatusConflict, fmt.Errorf("only %v of product <%v> in stock", p.Stock.Total(), p.Id)
+		}
+		return http.StatusOK, nil
+	}
+
+	res := datastore.Reservation{Id: line.ReservationId}
+	if err := a.Store.GetReservation(r.Context(), &res); err != nil {
+		return http.StatusConflict, fmt.Errorf("reservation <%v> has expired or doesn't exist", line.ReservationId)
+	}
+	if res.ProductId != line.ProductId || res.VariantId != line.VariantId || res.Quantity != line.Quantity {
+		return http.StatusBadRequest, fmt.Errorf("reservation <%v> is for %v of variant <%v> of product <%v>", res.Id, res.Quantity, res.VariantId, res.ProductId)
+	}
+	return http.StatusOK, nil
+}
+
+/*
+placeOrder - prices an order and saves it with a new ID. On failure it returns the status to respond with.
+*/
+func (a *API) placeOrder(r *http.Request, order *datastore.Order) (int, error) {
+	if status, err := a.priceOrder(r, order); err != nil {
+		return status, err
+	}
+
+	id, err := datastore.NewUUID()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	order.Id = id
+	order.CreatedAt = time.Now().UTC()
+
+	// Stock is checked again as the order is written, in case another order took it in the meantime.
+	if err := a.Store.AddOrder(r.Context(), *order); err != nil {
+		return storeStatus(err), err
+	}
+	return http.StatusCreated, nil
+}
+
+/*
+CreateOrder - place an order for quantities of Products (and their variants), at their current prices.
+*/
+func (a *API) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	var order datastore.Order
+	if err := decodeBody(r, &order); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if status, err := a.placeOrder(r, &order); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	w.Header().Set("Location", orderURL(order.Id))
+	respond(w, r, http.StatusCreated, order)
+}
+
+/*
+GetOrder - display a single order.
+*/
+func (a *API) GetOrder(w http.ResponseWriter, r *http.Request) {
+	order := datastore.Order{Id: mux.Vars(r)["order"]}
+	if err := a.Store.GetOrder(r.Context(), &order); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, order)
+}
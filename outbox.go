@@ -0,0 +1,73 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+)
+
+// outboxBatch - how many changes drainOutbox publishes at a time.
+const outboxBatch = 100
+
+/*
+publishOutbox - publishes every tenant's outbox on a.Events every interval, until the context is done. Changes are
+only deleted from the outbox once they've been published, so if the app stops partway through a batch, the batch
+is published again when the outbox is next drained: events are delivered at least once. With several instances,
+each drains the outbox, so an event can be published by more than one.
+*/
+func (a *API) publishOutbox(ctx context.Context, tenants []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, tenant := range tenants {
+			if err := a.drainOutbox(datastore.WithTenant(ctx, tenant)); err != nil {
+				log.Printf("The outbox of tenant %q could not be published: %v", tenant, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainOutbox - publishes the context's tenant's outbox until it's empty, oldest first, with each Product as it is now.
+func (a *API) drainOutbox(ctx context.Context) error {
+	for {
+		changes, err := a.Store.Outbox(ctx, outboxBatch)
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+		ids := make([]string, len(changes))
+		for i, c := range changes {
+			ids[i] = c.ProductId
+		}
+		products, _, err := a.Store.GetProducts(ctx, ids)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]datastore.Product, len(products))
+		for _, p := range products {
+			current[p.Id] = p
+		}
+
+		for _, c := range changes {
+			e := events.Event{Tenant: datastore.Tenant(ctx), Change: c}
+			if p, ok := current[c.ProductId]; ok && c.Kind != datastore.ChangeDeleted {
+				e.Product = &p
+			}
+			a.Events.Publish(ctx, e)
+		}
+		if err := a.Store.DeleteOutbox(ctx, changes); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/events"
+)
+
+func TestOutboxIsPublishedOnce(t *testing.T) {
+	store := fixtureStore(t)
+	api, err := newAPI(config.Default(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published []events.Event
+	api.Events.Subscribe(func(ctx context.Context, e events.Event) { published = append(published, e) })
+	ctx := context.Background()
+
+	// The fixture's Products, and the review that rated Apple.
+	if err := api.drainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 4 || published[0].Kind != datastore.ChangeCreated || published[0].Product == nil || published[3].Kind != datastore.ChangeUpdated {
+		t.Fatalf("Published %+v", published)
+	}
+	if err := store.DeleteProduct(ctx, datastore.Product{Id: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	published = nil
+	if err := api.drainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ProductId != "2" || published[0].Kind != datastore.ChangeDeleted || published[0].Product != nil {
+		t.Fatalf("Published %+v after the delete", published)
+	}
+
+	// Changes that couldn't be deleted from the outbox are published again.
+	if err := store.DeleteProduct(ctx, datastore.Product{Id: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	api.Store = failing(store, map[string]error{"DeleteOutbox": errUnavailable})
+	published = nil
+	if err := api.drainOutbox(ctx); err == nil {
+		t.Fatal("The outbox was drained without deleting what was published")
+	}
+	api.Store = store
+	if err := api.drainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 2 || published[0].Position() != published[1].Position() {
+		t.Fatalf("Published %+v when the first try failed", published)
+	}
+}
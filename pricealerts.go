@@ -0,0 +1,148 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/alerts"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// priceAlertPath - route template for a single price alert of a Product. Price alert IDs are always UUIDs.
+func priceAlertPath() string {
+	return productPath() + "/price-alerts/{alert:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// priceAlertURL - the canonical location of a price alert.
+func priceAlertURL(s alerts.Subscription) string {
+	return productURL(s.ProductId) + "/price-alerts/" + s.Id
+}
+
+/*
+priceAlertList - a Product's price alerts. It encodes as a bare array in JSON; XML needs a root element.
+*/
+type priceAlertList []alerts.Subscription
+
+func (l priceAlertList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "price_alerts"
+	return e.EncodeElement(struct {
+		Alerts []alerts.Subscription `xml:"price_alert"`
+	}{l}, start)
+}
+
+// alertedProduct - the Product named in the path, if price alerts are enabled; on failure, it has already responded.
+func (a *API) alertedProduct(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if a.Alerts == nil {
+		writeError(w, r, http.StatusConflict, i18n.Errorf("price_alerts_not_enabled", "Price alerts aren't enabled"))
+		return "", false
+	}
+	return a.reviewedProduct(w, r)
+}
+
+// pathPriceAlert - the price alert named in the path; on failure, it has already responded.
+func (a *API) pathPriceAlert(w http.ResponseWriter, r *http.Request) (alerts.Subscription, bool) {
+	productID, ok := a.alertedProduct(w, r)
+	if !ok {
+		return alerts.Subscription{}, false
+	}
+	id := mux.Vars(r)["alert"]
+	s, err := alerts.Get(r.Context(), a.Store, id)
+	if err == nil && s.ProductId != productID {
+		err = datastore.RecordNotFound(alerts.Resource.Name, id)
+	}
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return alerts.Subscription{}, false
+	}
+	return s, true
+}
+
+/*
+GetPriceAlerts - a Product's price alerts, oldest first.
+*/
+func (a *API) GetPriceAlerts(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.alertedProduct(w, r)
+	if !ok {
+		return
+	}
+	subs, err := alerts.Subscriptions(r.Context(), a.Store, productID)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, priceAlertList(subs))
+}
+
+/*
+GetPriceAlert - a single price alert.
+*/
+func (a *API) GetPriceAlert(w http.ResponseWriter, r *http.Request) {
+	if s, ok := a.pathPriceAlert(w, r); ok {
+		respond(w, r, http.StatusOK, s)
+	}
+}
+
+/*
+CreatePriceAlert - subscribe to a Product's price: once an update takes it below the threshold, a notification is
+sent to the email address or POSTed to the webhook_url given.
+*/
+func (a *API) CreatePriceAlert(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.alertedProduct(w, r)
+	if !ok {
+		return
+	}
+	var s alerts.Subscription
+	if err := decodeBody(r, &s); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+	s.Email, s.WebhookURL = strings.TrimSpace(s.Email), strings.TrimSpace(s.WebhookURL)
+	if err := s.Validate(a.Alerts.CanEmail(), a.Alerts.PrivateWebhooks()); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var err error
+	if s.Id, err = datastore.NewUUID(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.ProductId = productID
+	s.CreatedAt = time.Now().UTC()
+
+	if err := alerts.Subscribe(r.Context(), a.Store, s); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", priceAlertURL(s))
+	respond(w, r, http.StatusCreated, s)
+}
+
+/*
+DeletePriceAlert - unsubscribe.
+*/
+func (a *API) DeletePriceAlert(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.pathPriceAlert(w, r)
+	if !ok {
+		return
+	}
+	if err := alerts.Unsubscribe(r.Context(), a.Store, s.Id); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
@@ -0,0 +1,168 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/alerts"
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+func TestPriceAlertRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Alerts.Enabled = true
+	webhook := `{"threshold": 0.5, "webhook_url": "https://example.com/hook"}`
+	run(t, cfg, []routeCase{
+		{name: "list", method: "GET", path: "/v1/product/1/price-alerts", status: 200},
+		{name: "list of a missing product", method: "GET", path: "/v1/product/42/price-alerts", status: 404, code: "product_not_found"},
+		{name: "create webhook", method: "POST", path: "/v1/product/1/price-alerts", body: webhook, status: 201},
+		{name: "create for a missing product", method: "POST", path: "/v1/product/42/price-alerts", body: webhook, status: 404, code: "product_not_found"},
+		{name: "create without threshold", method: "POST", path: "/v1/product/1/price-alerts", body: `{"webhook_url": "https://example.com/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create with both", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "email": "a@example.com", "webhook_url": "https://example.com/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create with relative webhook", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "webhook_url": "/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create with metadata webhook", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "webhook_url": "http://169.254.169.254/latest/meta-data"}`, status: 400, code: "validation_failed"},
+		{name: "create with localhost webhook", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "webhook_url": "http://localhost:8080/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create with private webhook", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "webhook_url": "http://10.0.0.1/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create with mapped loopback webhook", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "webhook_url": "http://[::ffff:127.0.0.1]/hook"}`, status: 400, code: "validation_failed"},
+		{name: "create email without a mail server", method: "POST", path: "/v1/product/1/price-alerts", body: `{"threshold": 0.5, "email": "a@example.com"}`, status: 400, code: "validation_failed"},
+		{name: "get missing", method: "GET", path: "/v1/product/1/price-alerts/" + missingUUID, status: 404, code: "record_not_found"},
+		{name: "delete missing", method: "DELETE", path: "/v1/product/1/price-alerts/" + missingUUID, status: 404, code: "record_not_found"},
+		{name: "store unavailable", method: "GET", path: "/v1/product/1/price-alerts", status: 503, code: "service_unavailable", fail: map[string]error{"GetRecords": datastore.ErrUnavailable}},
+	})
+	run(t, config.Default(), []routeCase{
+		{name: "not enabled", method: "POST", path: "/v1/product/1/price-alerts", body: webhook, status: 409, code: "price_alerts_not_enabled"},
+	})
+}
+
+// TestPriceAlertLifecycle - an alert is served under its Product only, and is gone once deleted.
+func TestPriceAlertLifecycle(t *testing.T) {
+	cfg := config.Default()
+	cfg.Alerts.Enabled = true
+	h := testServer(t, cfg, fixtureStore(t))
+
+	w := do(h, "POST", "/v1/product/1/price-alerts", `{"threshold": 0.5, "webhook_url": "https://example.com/hook"}`)
+	var created alerts.Subscription
+	if err := json.Unmarshal(w.Body.Bytes(), &created); w.Code != http.StatusCreated || err != nil {
+		t.Fatalf("Create: got status %v; body %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if location != "/v1/product/1/price-alerts/"+created.Id || created.ProductId != "1" || created.Threshold != money("0.5") {
+		t.Fatalf("Create: got %+v at %q", created, location)
+	}
+	if w := do(h, "GET", location, ""); w.Code != http.StatusOK {
+		t.Fatalf("Get: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/v1/product/2/price-alerts/"+created.Id, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Get under another product: got status %v, want 404", w.Code)
+	}
+	var list []alerts.Subscription
+	if w := do(h, "GET", "/v1/product/1/price-alerts", ""); json.Unmarshal(w.Body.Bytes(), &list) != nil || len(list) != 1 {
+		t.Fatalf("List: got %s", w.Body)
+	}
+	if w := do(h, "DELETE", location, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", location, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Get after delete: got status %v, want 404", w.Code)
+	}
+}
+
+// TestPriceDropNotifies - an update that takes the price below the threshold POSTs to the webhook, once.
+func TestPriceDropNotifies(t *testing.T) {
+	delivered := make(chan alerts.Notification, 4)
+	traceparents := make(chan string, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var note alerts.Notification
+		json.NewDecoder(r.Body).Decode(&note)
+		traceparents <- r.Header.Get("traceparent")
+		delivered <- note
+	}))
+	defer hook.Close()
+
+	cfg := config.Default()
+	cfg.Alerts.Enabled = true
+	// The test's webhook is on loopback.
+	cfg.Alerts.AllowPrivateWebhooks = true
+	api, err := newAPI(cfg, fixtureStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api.Jobs.Start(ctx)
+	// The webhook is called in the trace of the update that dropped the price.
+	span := tracecontext.Start(tracecontext.Span{}, false)
+	ctx = tracecontext.WithSpan(ctx, span)
+
+	sub := alerts.Subscription{Id: missingUUID, ProductId: "1", Threshold: money("0.9"), WebhookURL: hook.URL, CreatedAt: time.Now().UTC()}
+	if err := alerts.Subscribe(ctx, api.Store, sub); err != nil {
+		t.Fatal(err)
+	}
+	apple := datastore.Product{Id: "1"}
+	if err := api.Store.GetProduct(ctx, &apple); err != nil {
+		t.Fatal(err)
+	}
+	for _, price := range []string{"0.95", "0.89", "0.5"} {
+		apple.Price = money(price)
+		if _, err := api.Store.UpdateProduct(ctx, apple); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case note := <-delivered:
+		if note.Event != alerts.EventPriceDrop || note.Subscription.Id != sub.Id || note.OldPrice != money("0.95") || note.Product.Price != money("0.89") {
+			t.Fatalf("Got %+v, want the drop from 0.95 to 0.89", note)
+		}
+		if got, ok := tracecontext.Parse(<-traceparents); !ok || got.TraceID != span.TraceID || got.SpanID == span.SpanID {
+			t.Fatalf("Got traceparent %+v, want a span of its own in trace %v", got, span.TraceID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The webhook wasn't called")
+	}
+	select {
+	case note := <-delivered:
+		t.Fatalf("Got %+v as well; a price that was already below the threshold shouldn't notify again", note)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestWebhooksAreKeptOffPrivateNetworks - a webhook whose address turns out to be private isn't called.
+func TestWebhooksAreKeptOffPrivateNetworks(t *testing.T) {
+	called := make(chan bool, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called <- true }))
+	defer hook.Close()
+
+	cfg := config.Default()
+	cfg.Alerts.Enabled = true
+	api, err := newAPI(cfg, fixtureStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api.Jobs.Start(ctx)
+
+	// Stored as it is, as if its name had resolved to a public address when it was created.
+	sub := alerts.Subscription{Id: missingUUID, ProductId: "1", Threshold: money("0.9"), WebhookURL: hook.URL, CreatedAt: time.Now().UTC()}
+	if err := alerts.Subscribe(ctx, api.Store, sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Store.UpdateProduct(ctx, datastore.Product{Id: "1", Name: "Apple", Price: money("0.5")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+		t.Fatal("A webhook on loopback was called")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/currency"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// currencyHeader - names the currency of the prices in a converted response.
+const currencyHeader = "X-Currency"
+
+// converter - converts prices for ?currency=; nil when no exchange rate provider is configured.
+var converter *currency.Converter
+
+// newConverter - the price converter for the config, or nil if conversion is disabled.
+func newConverter(cfg config.Currency) (*currency.Converter, error) {
+	base, err := currency.Code(cfg.Base)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base currency: %v", err)
+	}
+
+	var provider currency.Provider
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case config.CurrencyStatic:
+		provider = currency.Static(cfg.Rates)
+	case config.CurrencyHTTP:
+		provider = currency.HTTP{URL: cfg.URL, Client: &http.Client{Timeout: cfg.Timeout.Duration}}
+	default:
+		return nil, fmt.Errorf("Unknown currency provider %q; use %q or %q", cfg.Provider, config.CurrencyStatic, config.CurrencyHTTP)
+	}
+	return &currency.Converter{Base: base, Provider: &currency.Cached{Provider: provider, TTL: cfg.TTL.Duration}}, nil
+}
+
+/*
+inCurrency - converts the given prices in place into the currency named by ?currency=, if there is one, and says
+which currency they are in with the X-Currency header. On failure it returns the status to respond with.
+*/
+func inCurrency(w http.ResponseWriter, r *http.Request, amounts ...*datastore.Money) (int, error) {
+	v := r.URL.Query().Get("currency")
+	if v == "" {
+		return http.StatusOK, nil
+	}
+	if converter == nil {
+		return http.StatusBadRequest, errors.New("Currency conversion isn't enabled")
+	}
+	code, err := currency.Code(v)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	for _, amount := range amounts {
+		converted, err := converter.Convert(r.Context(), amount.Float64(), code)
+		if err != nil {
+			if errors.Is(err, currency.ErrUnknownCurrency) {
+				return http.StatusBadRequest, err
+			}
+			return http.StatusServiceUnavailable, err
+		}
+		*amount = datastore.MoneyFromFloat(converted)
+	}
+	w.Header().Set(currencyHeader, code)
+	return http.StatusOK, nil
+}
+
+// productsInCurrency - inCurrency for the prices of Products.
+func productsInCurrency(w http.ResponseWriter, r *http.Request, products []datastore.Product) (int, error) {
+	amounts := make([]*datastore.Money, len(products))
+	for i := range products {
+		amounts[i] = &products[i].Price
+	}
+	return inCurrency(w, r, amounts...)
+}
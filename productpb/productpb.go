@@ -0,0 +1,177 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package productpb encodes Products in the protobuf wire format described by proto/product.proto.
+The messages are small enough that they are encoded by hand with protowire, which avoids a protoc
+build step; field numbers here must match the .proto file.
+*/
+package productpb
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MediaType - the Content-Type / Accept value for protobuf bodies.
+const MediaType = "application/x-protobuf"
+
+// Field numbers from proto/product.proto.
+const (
+	productID         protowire.Number = 1
+	productName       protowire.Number = 2
+	productPrice      protowire.Number = 3
+	productExpiresAt  protowire.Number = 4
+	productBarcode    protowire.Number = 5
+	productPriceExact protowire.Number = 6
+	productSupplier   protowire.Number = 7
+	productCategory   protowire.Number = 8
+	productTags       protowire.Number = 9
+
+	listProducts protowire.Number = 1
+)
+
+// MarshalProduct - encodes a Product message.
+func MarshalProduct(p datastore.Product) []byte {
+	var b []byte
+	if p.Id != "" {
+		b = protowire.AppendTag(b, productID, protowire.BytesType)
+		b = protowire.AppendString(b, p.Id)
+	}
+	if p.Name != "" {
+		b = protowire.AppendTag(b, productName, protowire.BytesType)
+		b = protowire.AppendString(b, p.Name)
+	}
+	if p.Price != 0 {
+		b = protowire.AppendTag(b, productPrice, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(p.Price.Float64()))
+		b = protowire.AppendTag(b, productPriceExact, protowire.BytesType)
+		b = protowire.AppendString(b, p.Price.String())
+	}
+	if p.ExpiresAt != nil {
+		b = protowire.AppendTag(b, productExpiresAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(p.ExpiresAt.Unix()))
+	}
+	if p.Barcode != "" {
+		b = protowire.AppendTag(b, productBarcode, protowire.BytesType)
+		b = protowire.AppendString(b, p.Barcode)
+	}
+	if p.SupplierId != "" {
+		b = protowire.AppendTag(b, productSupplier, protowire.BytesType)
+		b = protowire.AppendString(b, p.SupplierId)
+	}
+	if p.CategoryId != "" {
+		b = protowire.AppendTag(b, productCategory, protowire.BytesType)
+		b = protowire.AppendString(b, p.CategoryId)
+	}
+	for _, tag := range p.Tags {
+		b = protowire.AppendTag(b, productTags, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	return b
+}
+
+// MarshalProductList - encodes a ProductList message.
+func MarshalProductList(products []datastore.Product) []byte {
+	var b []byte
+	for _, p := range products {
+		b = protowire.AppendTag(b, listProducts, protowire.BytesType)
+		b = protowire.AppendBytes(b, MarshalProduct(p))
+	}
+	return b
+}
+
+/*
+UnmarshalProduct - decodes a Product message, skipping unknown fields as protobuf requires. The exact price is used
+if the message has one; otherwise the double is rounded to datastore.MoneyDecimals places.
+*/
+func UnmarshalProduct(b []byte, p *datastore.Product) error {
+	exact := false
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf Product: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == productID && typ == protowire.BytesType:
+			p.Id, n = protowire.ConsumeString(b)
+		case num == productName && typ == protowire.BytesType:
+			p.Name, n = protowire.ConsumeString(b)
+		case num == productPrice && typ == protowire.Fixed64Type:
+			var v uint64
+			if v, n = protowire.ConsumeFixed64(b); n >= 0 && !exact {
+				p.Price = datastore.MoneyFromFloat(math.Float64frombits(v))
+			}
+		case num == productPriceExact && typ == protowire.BytesType:
+			var v string
+			if v, n = protowire.ConsumeString(b); n >= 0 {
+				var err error
+				if p.Price, err = datastore.ParseMoney(v); err != nil {
+					return fmt.Errorf("Invalid protobuf Product: %v", err)
+				}
+				exact = true
+			}
+		case num == productExpiresAt && typ == protowire.VarintType:
+			var v uint64
+			if v, n = protowire.ConsumeVarint(b); n >= 0 && v != 0 {
+				t := time.Unix(int64(v), 0).UTC()
+				p.ExpiresAt = &t
+			}
+		case num == productBarcode && typ == protowire.BytesType:
+			p.Barcode, n = protowire.ConsumeString(b)
+		case num == productSupplier && typ == protowire.BytesType:
+			p.SupplierId, n = protowire.ConsumeString(b)
+		case num == productCategory && typ == protowire.BytesType:
+			p.CategoryId, n = protowire.ConsumeString(b)
+		case num == productTags && typ == protowire.BytesType:
+			var tag string
+			if tag, n = protowire.ConsumeString(b); n >= 0 {
+				p.Tags = append(p.Tags, tag)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf Product: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// UnmarshalProductList - decodes a ProductList message.
+func UnmarshalProductList(b []byte, products *[]datastore.Product) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf ProductList: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == listProducts && typ == protowire.BytesType {
+			var msg []byte
+			if msg, n = protowire.ConsumeBytes(b); n >= 0 {
+				var p datastore.Product
+				if err := UnmarshalProduct(msg, &p); err != nil {
+					return err
+				}
+				*products = append(*products, p)
+			}
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("Invalid protobuf ProductList: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+rateLimiter - a token bucket: it holds up to burst tokens, refilled at rate per second, and each request takes one.
+*/
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter - a limiter for the config, starting full; nil if there's no limit.
+func newRateLimiter(cfg config.RateLimit) *rateLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := bucketSize(cfg.RequestsPerSecond, cfg.Burst)
+	return &rateLimiter{rate: cfg.RequestsPerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// bucketSize - the configured burst, or by default one second's worth of requests.
+func bucketSize(rate float64, burst int) float64 {
+	if burst > 0 {
+		return float64(burst)
+	}
+	return math.Max(math.Ceil(rate), 1)
+}
+
+/*
+quota - what a limiter decided about a request, and the state of the bucket afterwards, for the X-RateLimit-*
+headers. A zero limit means the state isn't known.
+*/
+type quota struct {
+	allowed bool
+	// wait - for a refused request, how long until a token will be there.
+	wait time.Duration
+	// limit / remaining - the bucket's size, and the whole tokens left in it.
+	limit, remaining int
+	// reset - how long until the bucket is full again.
+	reset time.Duration
+}
+
+// allow - takes a token if there is one; otherwise reports how long until there will be.
+func (l *rateLimiter) allow() quota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	q := quota{limit: int(l.burst)}
+	if l.tokens >= 1 {
+		l.tokens--
+		q.allowed = true
+	} else {
+		q.wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	q.remaining = int(l.tokens)
+	q.reset = time.Duration((l.burst - l.tokens) / l.rate * float64(time.Second))
+	return q
+}
+
+// clientLimiter - a rate limit for each client, by key.
+type clientLimiter interface {
+	// allow - takes a token from the client's bucket if there is one; otherwise reports how long until there will be.
+	allow(ctx context.Context, client string) quota
+}
+
+/*
+newClientLimiter - a per-client limiter for the config, in Redis if it names a server; nil if there's no limit. A
+Redis limiter shares the client of prev, the limiter it replaces, if that's in Redis on the same server, rather than
+opening connections of its own; releaseClientLimiter closes prev's otherwise.
+*/
+func newClientLimiter(cfg config.ClientRateLimit, prev clientLimiter) clientLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := bucketSize(cfg.RequestsPerSecond, cfg.Burst)
+	if cfg.Redis != "" {
+		if old, ok := prev.(*redisLimiter); ok && old.client.Options().Addr == cfg.Redis {
+			return &redisLimiter{client: old.client, rate: cfg.RequestsPerSecond, burst: burst}
+		}
+		return &redisLimiter{client: redis.NewClient(&redis.Options{Addr: cfg.Redis}), rate: cfg.RequestsPerSecond, burst: burst}
+	}
+	return &memoryLimiter{rate: cfg.RequestsPerSecond, burst: burst, buckets: map[string]*rateLimiter{}, swept: time.Now()}
+}
+
+/*
+releaseClientLimiter - closes the Redis client of old, a limiter that current has replaced, unless current shares it.
+Requests still using old let their clients through, as they do whenever Redis can't be reached.
+*/
+func releaseClientLimiter(old, current clientLimiter) {
+	o, ok := old.(*redisLimiter)
+	if !ok {
+		return
+	}
+	if c, ok := current.(*redisLimiter); ok && c.client == o.client {
+		return
+	}
+	if err := o.client.Close(); err != nil {
+		log.Printf("Error closing the per-IP rate limit's Redis client: %v", err)
+	}
+}
+
+// sweepEvery - how often a memoryLimiter forgets its idle clients.
+const sweepEvery = time.Minute
+
+/*
+memoryLimiter - a token bucket per client, in this instance's memory. A client's bucket is forgotten once it has
+been idle long enough to have filled up, since a new one would be the same.
+*/
+type memoryLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*rateLimiter
+	swept   time.Time
+}
+
+func (m *memoryLimiter) allow(ctx context.Context, client string) quota {
+	m.mu.Lock()
+	now := time.Now()
+	if now.Sub(m.swept) >= sweepEvery {
+		refill := time.Duration(m.burst / m.rate * float64(time.Second))
+		for key, b := range m.buckets {
+			b.mu.Lock()
+			if now.Sub(b.last) >= refill {
+				delete(m.buckets, key)
+			}
+			b.mu.Unlock()
+		}
+		m.swept = now
+	}
+	b, ok := m.buckets[client]
+	if !ok {
+		b = &rateLimiter{rate: m.rate, burst: m.burst, tokens: m.burst, last: now}
+		m.buckets[client] = b
+	}
+	m.mu.Unlock()
+	return b.allow()
+}
+
+/*
+redisTokenBucket - takes a token from the bucket at KEYS[1], refilled at ARGV[1] per second up to ARGV[2], as of
+ARGV[3] (ms). Returns 1 and 0 if it took one, or 0 and how many ms until there will be one, then the whole tokens
+left and how many ms until the bucket is full. The bucket expires once it would be full again.
+*/
+var redisTokenBucket = redis.NewScript(`
+local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens, last = tonumber(bucket[1]) or burst, tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(now - last, 0) / 1000 * rate)
+local allowed, wait = 0, math.ceil((1 - tokens) / rate * 1000)
+if tokens >= 1 then
+  tokens, allowed, wait = tokens - 1, 1, 0
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait, math.floor(tokens), math.ceil((burst - tokens) / rate * 1000)}
+`)
+
+// redisLimiter - a token bucket per client in Redis, shared by every instance using the same server.
+type redisLimiter struct {
+	client *redis.Client
+	rate   float64
+	burst  float64
+}
+
+// allow - as for clientLimiter. If Redis can't be reached, the request is let through: the limit protects the API
+// from clients, and shouldn't take it down with Redis.
+func (l *redisLimiter) allow(ctx context.Context, client string) quota {
+	result, err := redisTokenBucket.Run(ctx, l.client, []string{"ratelimit:" + client}, l.rate, l.burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil || len(result) != 4 {
+		log.Printf("Per-IP rate limit not checked: %v", err)
+		return quota{allowed: true}
+	}
+	return quota{
+		allowed:   result[0] == 1,
+		wait:      time.Duration(result[1]) * time.Millisecond,
+		limit:     int(l.burst),
+		remaining: int(result[2]),
+		reset:     time.Duration(result[3]) * time.Millisecond,
+	}
+}
+
+/*
+rateLimit - refuses requests over the configured rate limits with 429 Too Many Requests, saying in Retry-After how
+many seconds to wait. A client's own limit is checked first, so its refused requests don't use up the shared one.
+The limits in force are read on every request, so a reloaded config applies straight away.
+
+Every response, refused or not, carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (seconds
+until the bucket is full again) so that clients can pace themselves. With both limits, they describe whichever has
+fewer requests left.
+*/
+func rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := live.Load()
+		var shown quota
+		if settings.clientLimiter != nil {
+			q := settings.clientLimiter.allow(r.Context(), clientKey(r))
+			if shown = q; !q.allowed {
+				tooManyRequests(w, r, q)
+				return
+			}
+		}
+		if settings.limiter != nil {
+			q := settings.limiter.allow()
+			if shown.limit == 0 || q.remaining < shown.remaining {
+				shown = q
+			}
+			if !q.allowed {
+				tooManyRequests(w, r, q)
+				return
+			}
+		}
+		setRateLimitHeaders(w, shown)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setRateLimitHeaders - describes a limiter's bucket in the X-RateLimit-* headers, if its state is known.
+func setRateLimitHeaders(w http.ResponseWriter, q quota) {
+	if q.limit == 0 {
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(q.limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(q.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(q.reset.Seconds()))))
+}
+
+// tooManyRequests - responds 429, asking the client to wait before trying again.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, q quota) {
+	setRateLimitHeaders(w, q)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(q.wait.Seconds()))))
+	writeError(w, r, http.StatusTooManyRequests, i18n.Errorf("rate_limited", "Too many requests; try again later"))
+}
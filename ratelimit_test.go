@@ -0,0 +1,153 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// from - a request to the API from the given address, through proxies that added forwarded to X-Forwarded-For.
+func from(remote, forwarded string) *http.Request {
+	r := newRequest("GET", "/v1/product/1", "")
+	r.RemoteAddr = remote
+	if forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded)
+	}
+	return r
+}
+
+func TestClientIP(t *testing.T) {
+	var err error
+	if trustedProxies, err = parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+
+	cases := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"untrusted forwarding ignored", "203.0.113.5:4000", "198.51.100.9", "203.0.113.5"},
+		{"through a proxy", "10.1.2.3:4000", "198.51.100.9", "198.51.100.9"},
+		{"through two proxies", "10.1.2.3:4000", "198.51.100.9, 192.0.2.1", "198.51.100.9"},
+		{"spoofed hop ignored", "10.1.2.3:4000", "1.1.1.1, 198.51.100.9", "198.51.100.9"},
+		{"IPv6 by /64", "[2001:db8:1:2:3:4:5:6]:4000", "", "2001:db8:1:2::/64"},
+	}
+	for _, c := range cases {
+		if got := clientKey(from(c.remote, c.forwarded)); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// The local proxy on the Unix socket is trusted, like the proxies it forwarded through.
+	local := from("@", "1.1.1.1, 198.51.100.9, 10.1.2.3")
+	local = local.WithContext(context.WithValue(local.Context(), unixSocketKey{}, true))
+	if got := clientKey(local); got != "198.51.100.9" {
+		t.Errorf("Through the Unix socket: got %v, want 198.51.100.9", got)
+	}
+}
+
+// perIPServer - the API with a per-IP limit of two requests, in the given Redis server if any.
+func perIPServer(t *testing.T, redis string) http.Handler {
+	cfg := config.Default()
+	cfg.RateLimit.PerIP = config.ClientRateLimit{RequestsPerSecond: 0.001, Burst: 2, Redis: redis}
+	return testServer(t, cfg, fixtureStore(t))
+}
+
+// checkPerIPLimit - a client over its limit is refused, while another still gets through.
+func checkPerIPLimit(t *testing.T, h http.Handler) {
+	t.Helper()
+	for i, want := range []struct {
+		status    int
+		remaining string
+	}{{200, "1"}, {200, "0"}, {429, "0"}} {
+		w := record(h, from("203.0.113.5:4000", ""))
+		if w.Code != want.status || (want.status == 429 && w.Header().Get("Retry-After") == "") {
+			t.Fatalf("Request %v: got status %v, Retry-After %q; want %v", i, w.Code, w.Header().Get("Retry-After"), want.status)
+		}
+		if limit, remaining, reset := w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"), w.Header().Get("X-RateLimit-Reset"); limit != "2" || remaining != want.remaining || reset == "" || reset == "0" {
+			t.Fatalf("Request %v: got X-RateLimit-Limit %q, -Remaining %q, -Reset %q; want 2, %v and a wait", i, limit, remaining, reset, want.remaining)
+		}
+	}
+	if w := record(h, from("203.0.113.6:4000", "")); w.Code != http.StatusOK {
+		t.Fatalf("Another client: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestPerIPLimitInMemory(t *testing.T) {
+	checkPerIPLimit(t, perIPServer(t, ""))
+}
+
+func TestPerIPLimitInRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	checkPerIPLimit(t, perIPServer(t, server.Addr()))
+
+	// Another instance sharing the server shares the buckets.
+	if w := record(perIPServer(t, server.Addr()), from("203.0.113.5:4000", "")); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Another instance: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+// TestReloadReusesRedis - a reload keeps the per-IP limiter's Redis client while the server is the same, and closes it
+// once the server changes.
+func TestReloadReusesRedis(t *testing.T) {
+	first, second := miniredis.RunT(t), miniredis.RunT(t)
+	cfg := config.Default()
+	cfg.RateLimit.PerIP = config.ClientRateLimit{RequestsPerSecond: 1, Redis: first.Addr()}
+	prev, err := newLiveSettings(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := prev.clientLimiter.(*redisLimiter).client
+
+	cfg.RateLimit.PerIP.RequestsPerSecond = 2
+	same, err := newLiveSettings(cfg, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseClientLimiter(prev.clientLimiter, same.clientLimiter)
+	if same.clientLimiter.(*redisLimiter).client != client || client.Ping(context.Background()).Err() != nil {
+		t.Fatal("A reload with the same Redis server didn't keep its client")
+	}
+
+	cfg.RateLimit.PerIP.Redis = second.Addr()
+	moved, err := newLiveSettings(cfg, same)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseClientLimiter(same.clientLimiter, moved.clientLimiter)
+	if moved.clientLimiter.(*redisLimiter).client == client || client.Ping(context.Background()).Err() == nil {
+		t.Fatal("A reload with another Redis server didn't close the old client")
+	}
+}
+
+// With a shared limit as well, the headers describe whichever has fewer requests left.
+func TestRateLimitHeaders(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit = config.RateLimit{RequestsPerSecond: 0.001, Burst: 5}
+	cfg.RateLimit.PerIP = config.ClientRateLimit{RequestsPerSecond: 0.001, Burst: 3}
+	h := testServer(t, cfg, fixtureStore(t))
+
+	for i, want := range []string{"2", "1", "0"} {
+		w := record(h, from("203.0.113.5:4000", ""))
+		if limit, remaining := w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"); limit != "3" || remaining != want {
+			t.Fatalf("Request %v: got X-RateLimit-Limit %q, -Remaining %q; want 3, %v", i, limit, remaining, want)
+		}
+	}
+	w := record(h, from("203.0.113.6:4000", ""))
+	if limit, remaining := w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"); limit != "5" || remaining != "1" {
+		t.Fatalf("Another client: got X-RateLimit-Limit %q, -Remaining %q; want 5, 1", limit, remaining)
+	}
+
+	// Without limits, there are no headers.
+	if w := record(testServer(t, config.Default(), fixtureStore(t)), from("203.0.113.5:4000", "")); w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("Without limits: got X-RateLimit-Limit %q", w.Header().Get("X-RateLimit-Limit"))
+	}
+}
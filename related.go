@@ -0,0 +1,82 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/related"
+)
+
+// newRelatedFinder - the related product finder for the config, scoring with its strategy.
+func newRelatedFinder(cfg config.Related) (related.Finder, error) {
+	if cfg.Limit < 1 || cfg.Limit > maxPageSize {
+		return related.Finder{}, fmt.Errorf("related.limit must be from 1 to %v", maxPageSize)
+	}
+	if cfg.PriceBand < 0 {
+		return related.Finder{}, fmt.Errorf("related.price_band can't be negative")
+	}
+	var scorer related.Scorer
+	switch cfg.Strategy {
+	case config.RelatedSimilarity:
+		scorer = related.Similarity{CategoryWeight: 3, TagWeight: 2, PriceWeight: 1, PriceBand: cfg.PriceBand}
+	case config.RelatedPrice:
+		scorer = related.PriceBand{Band: cfg.PriceBand}
+	default:
+		return related.Finder{}, fmt.Errorf("Unknown related strategy %q; use %q or %q", cfg.Strategy, config.RelatedSimilarity, config.RelatedPrice)
+	}
+	return related.Finder{Scorer: scorer, Limit: cfg.Limit}, nil
+}
+
+/*
+GetRelatedProducts - the Products most like the one named, most alike first, for "you may also like" suggestions:
+by default those in the same category or with tags in common, ranked higher at a similar price. ?limit= asks for
+fewer than the configured most. Takes ?fields=, ?currency= and Accept-Language like a listing.
+*/
+func (a *API) GetRelatedProducts(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	fields, err := requestedFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > a.Related.Limit {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_limit", "Invalid limit %q; use 1 to %v", v, a.Related.Limit))
+			return
+		}
+	}
+
+	// Scoring needs every Product's category, tags and price, so the reads aren't narrowed to the requested fields.
+	p := datastore.Product{Id: id}
+	if err := a.Store.GetProduct(r.Context(), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	all, err := a.Store.GetAll(r.Context())
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	products := a.Related.Find(p, all, limit)
+	if status, err := productsInCurrency(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	respond(w, r, http.StatusOK, sparse(resources(products), fields))
+}
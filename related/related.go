@@ -0,0 +1,144 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package related finds the Products most like a given one, for "you may also like" suggestions. How alike two
+Products are is decided by a pluggable Scorer; the Finder ranks the catalog by it.
+*/
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// Scorer - how related a candidate is to a Product. Higher is more related; 0 or less is not related at all.
+type Scorer interface {
+	Score(p, candidate datastore.Product) float64
+}
+
+// ScorerFunc - a function as a Scorer.
+type ScorerFunc func(p, candidate datastore.Product) float64
+
+func (f ScorerFunc) Score(p, candidate datastore.Product) float64 {
+	return f(p, candidate)
+}
+
+/*
+Similarity - scores candidates by what they share with the Product: CategoryWeight for the same category, up to
+TagWeight for the tags they have in common (as a share of all the tags either has, ignoring case), and up to
+PriceWeight for a price within PriceBand of the Product's. A similar price alone doesn't make a Product related; it
+only ranks those that share a category or tags.
+*/
+type Similarity struct {
+	CategoryWeight float64
+	TagWeight      float64
+	PriceWeight    float64
+	// PriceBand - how far a price can be from the Product's and still count, as a fraction of it, e.g. 0.25 for 25%.
+	PriceBand float64
+}
+
+func (s Similarity) Score(p, candidate datastore.Product) float64 {
+	score := 0.0
+	if p.CategoryId != "" && p.CategoryId == candidate.CategoryId {
+		score += s.CategoryWeight
+	}
+	score += s.TagWeight * tagOverlap(p.Tags, candidate.Tags)
+	if score > 0 {
+		score += s.PriceWeight * priceCloseness(p.Price, candidate.Price, s.PriceBand)
+	}
+	return score
+}
+
+// PriceBand - scores candidates by how close their price is to the Product's; those outside Band aren't related.
+type PriceBand struct {
+	Band float64
+}
+
+func (b PriceBand) Score(p, candidate datastore.Product) float64 {
+	return priceCloseness(p.Price, candidate.Price, b.Band)
+}
+
+// tagOverlap - the share of the tags in either list that are in both, ignoring case: 0 for none, 1 for all.
+func tagOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	tags := map[string]int{}
+	for _, tag := range a {
+		tags[strings.ToLower(tag)] |= 1
+	}
+	for _, tag := range b {
+		tags[strings.ToLower(tag)] |= 2
+	}
+	shared := 0
+	for _, in := range tags {
+		if in == 3 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(tags))
+}
+
+/*
+priceCloseness - 1 for a price the same as the Product's, falling to 0 at band (a fraction of the Product's price)
+away from it, and 0 beyond. Only free Products are close to a free one.
+*/
+func priceCloseness(price, candidate datastore.Money, band float64) float64 {
+	if price == 0 {
+		if candidate == 0 {
+			return 1
+		}
+		return 0
+	}
+	distance := math.Abs(candidate.Float64()-price.Float64()) / price.Float64()
+	if band <= 0 || distance > band {
+		return 0
+	}
+	return 1 - distance/band
+}
+
+// Finder - ranks candidates by how related a Scorer finds them.
+type Finder struct {
+	Scorer Scorer
+	// Limit - the most related Products Find returns.
+	Limit int
+}
+
+/*
+Find - up to limit (or Limit, if that's fewer or limit is 0) of the candidates related to p, most related first; those scored the same keep the
+order they came in. p itself is never among them.
+*/
+func (f Finder) Find(p datastore.Product, candidates []datastore.Product, limit int) []datastore.Product {
+	if limit <= 0 || limit > f.Limit {
+		limit = f.Limit
+	}
+	type scored struct {
+		p     datastore.Product
+		score float64
+	}
+	var matches []scored
+	for _, c := range candidates {
+		if c.Id == p.Id {
+			continue
+		}
+		if score := f.Scorer.Score(p, c); score > 0 {
+			matches = append(matches, scored{c, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	related := make([]datastore.Product, len(matches))
+	for i, m := range matches {
+		related[i] = m.p
+	}
+	return related
+}
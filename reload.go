@@ -0,0 +1,136 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+// configPoll - how often the config file is checked for changes.
+const configPoll = 2 * time.Second
+
+/*
+liveSettings - the settings that can change while the app runs. Handlers read them through live, which a config
+reload replaces as a whole, so a request never sees half of one config and half of another.
+*/
+type liveSettings struct {
+	cfg      config.Config
+	logLevel int
+	// limiter - nil when there's no rate limit.
+	limiter *rateLimiter
+	// clientLimiter - nil when there's no per-IP rate limit.
+	clientLimiter clientLimiter
+	cors          config.CORS
+	flags         map[string]flagState
+}
+
+// live - the settings in force.
+var live atomic.Pointer[liveSettings]
+
+// logLevels - the minimum response status logged at each log level.
+var logLevels = map[string]int{
+	config.LogInfo:  0,
+	config.LogWarn:  400,
+	config.LogError: 500,
+}
+
+// newLiveSettings - the live settings for cfg. Rate limiters whose limits haven't changed are kept from prev (if
+// any), so that a reload doesn't hand every client a fresh burst, and a new per-IP limiter in Redis keeps prev's
+// connection to the same server.
+func newLiveSettings(cfg config.Config, prev *liveSettings) (*liveSettings, error) {
+	level, ok := logLevels[cfg.LogLevel]
+	if !ok {
+		return nil, fmt.Errorf("Unknown log level %q; use %q, %q or %q", cfg.LogLevel, config.LogInfo, config.LogWarn, config.LogError)
+	}
+	if cfg.RateLimit.RequestsPerSecond < 0 || cfg.RateLimit.Burst < 0 || cfg.RateLimit.PerIP.RequestsPerSecond < 0 || cfg.RateLimit.PerIP.Burst < 0 {
+		return nil, fmt.Errorf("Rate limits can't be negative")
+	}
+	flags, err := resolveFlags(cfg.Features)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChaos(cfg.Chaos); err != nil {
+		return nil, err
+	}
+	s := &liveSettings{cfg: cfg, logLevel: level, cors: cfg.CORS, flags: flags}
+	var prevClient clientLimiter
+	if prev != nil {
+		prevClient = prev.clientLimiter
+	}
+	if prev != nil && prev.cfg.RateLimit == cfg.RateLimit {
+		s.limiter, s.clientLimiter = prev.limiter, prev.clientLimiter
+	} else {
+		s.limiter, s.clientLimiter = newRateLimiter(cfg.RateLimit), newClientLimiter(cfg.RateLimit.PerIP, prevClient)
+	}
+	return s, nil
+}
+
+// restartOnly - cfg without the settings a reload applies, for spotting changes that need a restart.
+func restartOnly(cfg config.Config) config.Config {
+	cfg.LogLevel, cfg.RateLimit, cfg.CORS, cfg.Features, cfg.Chaos = "", config.RateLimit{}, config.CORS{}, nil, config.Chaos{}
+	return cfg
+}
+
+// reloadConfig - reads the config file again and applies it. An invalid file leaves the current settings in force.
+func reloadConfig(path string) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		log.Printf("Config not reloaded: %v", err)
+		return
+	}
+	prev := live.Load()
+	s, err := newLiveSettings(cfg, prev)
+	if err != nil {
+		log.Printf("Config not reloaded: %v", err)
+		return
+	}
+	live.Store(s)
+	releaseClientLimiter(prev.clientLimiter, s.clientLimiter)
+	log.Printf("Config reloaded from %v", path)
+	if !reflect.DeepEqual(restartOnly(cfg), restartOnly(prev.cfg)) {
+		log.Printf("Some of the changes to %v only take effect on restart", path)
+	}
+}
+
+/*
+watchConfig - reloads the config file whenever its modification time changes, or when the process receives SIGHUP.
+*/
+func watchConfig(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	modified := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	last := modified()
+
+	ticker := time.NewTicker(configPoll)
+	for {
+		select {
+		case <-hup:
+			last = modified()
+		case <-ticker.C:
+			// A file that's missing or unchanged (e.g. mid-way through being replaced) is left alone.
+			m := modified()
+			if m.IsZero() || m.Equal(last) {
+				continue
+			}
+			last = m
+		}
+		reloadConfig(path)
+	}
+}
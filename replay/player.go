@@ -0,0 +1,339 @@
+/*
+Author: Jason Payne
+*/
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+Player - a Datastore that answers every call from a recording, without a backend. A call that wasn't recorded fails
+with ErrUnavailable, as a backend that couldn't answer would.
+*/
+type Player struct {
+	mu     sync.Mutex
+	calls  map[string][]call
+	played map[string]int
+}
+
+// NewPlayer - loads the recording at path.
+func NewPlayer(path string) (*Player, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening recording %v: %v", path, err)
+	}
+	defer f.Close()
+
+	p := &Player{calls: map[string][]call{}, played: map[string]int{}}
+	dec := json.NewDecoder(f)
+	for n := 1; ; n++ {
+		var c call
+		if err := dec.Decode(&c); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error reading call %v of recording %v: %v", n, path, err)
+		}
+		key := c.key()
+		p.calls[key] = append(p.calls[key], c)
+	}
+	return p, nil
+}
+
+/*
+replay - answers a call from the recording: its results are decoded into results (which are pointers, in the same
+order as the recording's), and its error returned.
+*/
+func (p *Player) replay(ctx context.Context, method string, args interface{}, results ...interface{}) error {
+	c, err := newCall(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	key := c.key()
+
+	p.mu.Lock()
+	recorded := p.calls[key]
+	i := p.played[key]
+	if i < len(recorded) {
+		p.played[key]++
+	} else {
+		i = len(recorded) - 1
+	}
+	p.mu.Unlock()
+
+	if i < 0 {
+		return fmt.Errorf("No recorded %v call matches %s: %w", method, c.Args, datastore.ErrUnavailable)
+	}
+	for j, result := range results {
+		if j < len(recorded[i].Results) {
+			if err := json.Unmarshal(recorded[i].Results[j], result); err != nil {
+				return fmt.Errorf("Error replaying %v: %v", method, err)
+			}
+		}
+	}
+	return recorded[i].Error.err()
+}
+
+func (p *Player) NextID(ctx context.Context) (string, error) {
+	var id string
+	err := p.replay(ctx, "NextID", nil, &id)
+	return id, err
+}
+
+func (p *Player) GetAll(ctx context.Context) ([]datastore.Product, error) {
+	var products []datastore.Product
+	err := p.replay(ctx, "GetAll", nil, &products)
+	return products, err
+}
+
+func (p *Player) GetProduct(ctx context.Context, product *datastore.Product) error {
+	return p.replay(ctx, "GetProduct", *product, product)
+}
+
+func (p *Player) GetProducts(ctx context.Context, ids []string) ([]datastore.Product, []string, error) {
+	var products []datastore.Product
+	var missing []string
+	err := p.replay(ctx, "GetProducts", ids, &products, &missing)
+	return products, missing, err
+}
+
+func (p *Player) FindByName(ctx context.Context, name string) ([]datastore.Product, error) {
+	var products []datastore.Product
+	err := p.replay(ctx, "FindByName", name, &products)
+	return products, err
+}
+
+func (p *Player) SearchByPrefix(ctx context.Context, prefix string) ([]datastore.Product, error) {
+	var products []datastore.Product
+	err := p.replay(ctx, "SearchByPrefix", prefix, &products)
+	return products, err
+}
+
+func (p *Player) FilterProducts(ctx context.Context, expr datastore.Expr) ([]datastore.Product, error) {
+	var products []datastore.Product
+	err := p.replay(ctx, "FilterProducts", expr.String(), &products)
+	return products, err
+}
+
+func (p *Player) FindByBarcode(ctx context.Context, code string) (datastore.Product, error) {
+	var product datastore.Product
+	err := p.replay(ctx, "FindByBarcode", code, &product)
+	return product, err
+}
+
+func (p *Player) AddProduct(ctx context.Context, product datastore.Product) error {
+	return p.replay(ctx, "AddProduct", product)
+}
+
+func (p *Player) AddProducts(ctx context.Context, products []datastore.Product) error {
+	return p.replay(ctx, "AddProducts", products)
+}
+
+func (p *Player) CheckUnique(ctx context.Context, products []datastore.Product) error {
+	return p.replay(ctx, "CheckUnique", products)
+}
+
+func (p *Player) UpdateProduct(ctx context.Context, product datastore.Product) (datastore.Product, error) {
+	var stored datastore.Product
+	err := p.replay(ctx, "UpdateProduct", product, &stored)
+	return stored, err
+}
+
+func (p *Player) AdjustStock(ctx context.Context, id, location string, delta int) (datastore.Product, error) {
+	var stored datastore.Product
+	err := p.replay(ctx, "AdjustStock", []interface{}{id, location, delta}, &stored)
+	return stored, err
+}
+
+func (p *Player) DeleteProduct(ctx context.Context, product datastore.Product) error {
+	return p.replay(ctx, "DeleteProduct", product)
+}
+
+func (p *Player) Truncate(ctx context.Context) error {
+	return p.replay(ctx, "Truncate", nil)
+}
+
+func (p *Player) ExpiredProducts(ctx context.Context) ([]datastore.Product, error) {
+	var products []datastore.Product
+	err := p.replay(ctx, "ExpiredProducts", nil, &products)
+	return products, err
+}
+
+func (p *Player) Explain(ctx context.Context, query datastore.ListQuery) (datastore.QueryPlan, error) {
+	var plan datastore.QueryPlan
+	err := p.replay(ctx, "Explain", query, &plan)
+	return plan, err
+}
+
+func (p *Player) AdvanceID(ctx context.Context, id string) error {
+	return p.replay(ctx, "AdvanceID", id)
+}
+
+func (p *Player) GetPage(ctx context.Context, limit int, cursor string) (datastore.Page, error) {
+	var page datastore.Page
+	err := p.replay(ctx, "GetPage", []interface{}{limit, cursor}, &page)
+	return page, err
+}
+
+func (p *Player) Count(ctx context.Context, filter datastore.Filter) (int, error) {
+	var n int
+	err := p.replay(ctx, "Count", filter, &n)
+	return n, err
+}
+
+func (p *Player) PriceHistory(ctx context.Context, id string) ([]datastore.PricePoint, error) {
+	var history []datastore.PricePoint
+	err := p.replay(ctx, "PriceHistory", id, &history)
+	return history, err
+}
+
+func (p *Player) GetChanges(ctx context.Context, after datastore.Change, limit int) ([]datastore.Change, error) {
+	var changes []datastore.Change
+	err := p.replay(ctx, "GetChanges", []interface{}{after, limit}, &changes)
+	return changes, err
+}
+
+func (p *Player) Outbox(ctx context.Context, limit int) ([]datastore.Change, error) {
+	var changes []datastore.Change
+	err := p.replay(ctx, "Outbox", limit, &changes)
+	return changes, err
+}
+
+func (p *Player) DeleteOutbox(ctx context.Context, changes []datastore.Change) error {
+	return p.replay(ctx, "DeleteOutbox", changes)
+}
+
+func (p *Player) GetReviews(ctx context.Context, productID string) ([]datastore.Review, error) {
+	var reviews []datastore.Review
+	err := p.replay(ctx, "GetReviews", productID, &reviews)
+	return reviews, err
+}
+
+func (p *Player) GetReview(ctx context.Context, review *datastore.Review) error {
+	return p.replay(ctx, "GetReview", *review, review)
+}
+
+func (p *Player) AddReview(ctx context.Context, review datastore.Review) error {
+	return p.replay(ctx, "AddReview", review)
+}
+
+func (p *Player) UpdateReview(ctx context.Context, old, review datastore.Review) error {
+	return p.replay(ctx, "UpdateReview", []datastore.Review{old, review})
+}
+
+func (p *Player) DeleteReview(ctx context.Context, review datastore.Review) error {
+	return p.replay(ctx, "DeleteReview", review)
+}
+
+func (p *Player) GetVariants(ctx context.Context, productID string) ([]datastore.Variant, error) {
+	var variants []datastore.Variant
+	err := p.replay(ctx, "GetVariants", productID, &variants)
+	return variants, err
+}
+
+func (p *Player) GetVariant(ctx context.Context, variant *datastore.Variant) error {
+	return p.replay(ctx, "GetVariant", *variant, variant)
+}
+
+func (p *Player) AddVariant(ctx context.Context, variant datastore.Variant) error {
+	return p.replay(ctx, "AddVariant", variant)
+}
+
+func (p *Player) UpdateVariant(ctx context.Context, variant datastore.Variant) error {
+	return p.replay(ctx, "UpdateVariant", variant)
+}
+
+func (p *Player) DeleteVariant(ctx context.Context, variant datastore.Variant) error {
+	return p.replay(ctx, "DeleteVariant", variant)
+}
+
+func (p *Player) AddOrder(ctx context.Context, order datastore.Order) error {
+	return p.replay(ctx, "AddOrder", order)
+}
+
+func (p *Player) GetOrder(ctx context.Context, order *datastore.Order) error {
+	return p.replay(ctx, "GetOrder", *order, order)
+}
+
+func (p *Player) GetCart(ctx context.Context, cart *datastore.Cart) error {
+	return p.replay(ctx, "GetCart", *cart, cart)
+}
+
+func (p *Player) PutCart(ctx context.Context, cart datastore.Cart) error {
+	return p.replay(ctx, "PutCart", cart)
+}
+
+func (p *Player) DeleteCart(ctx context.Context, id string) error {
+	return p.replay(ctx, "DeleteCart", id)
+}
+
+func (p *Player) Reserve(ctx context.Context, reservation datastore.Reservation) error {
+	return p.replay(ctx, "Reserve", reservation)
+}
+
+func (p *Player) GetReservation(ctx context.Context, reservation *datastore.Reservation) error {
+	return p.replay(ctx, "GetReservation", *reservation, reservation)
+}
+
+func (p *Player) ReleaseReservation(ctx context.Context, reservation datastore.Reservation) error {
+	return p.replay(ctx, "ReleaseReservation", reservation)
+}
+
+func (p *Player) ExpiredReservations(ctx context.Context) ([]datastore.Reservation, error) {
+	var reservations []datastore.Reservation
+	err := p.replay(ctx, "ExpiredReservations", nil, &reservations)
+	return reservations, err
+}
+
+func (p *Player) GetUsers(ctx context.Context) ([]datastore.User, error) {
+	var users []datastore.User
+	err := p.replay(ctx, "GetUsers", nil, &users)
+	return users, err
+}
+
+func (p *Player) GetUser(ctx context.Context, user *datastore.User) error {
+	return p.replay(ctx, "GetUser", *user, user)
+}
+
+func (p *Player) AddUser(ctx context.Context, user datastore.User) error {
+	return p.replay(ctx, "AddUser", user)
+}
+
+func (p *Player) UpdateUser(ctx context.Context, user datastore.User) error {
+	return p.replay(ctx, "UpdateUser", user)
+}
+
+func (p *Player) DeleteUser(ctx context.Context, name string) error {
+	return p.replay(ctx, "DeleteUser", name)
+}
+
+func (p *Player) GetRecords(ctx context.Context, resource string) ([]datastore.Record, error) {
+	var records []datastore.Record
+	err := p.replay(ctx, "GetRecords", resource, &records)
+	return records, err
+}
+
+func (p *Player) GetRecord(ctx context.Context, resource, id string) (datastore.Record, error) {
+	var record datastore.Record
+	err := p.replay(ctx, "GetRecord", []string{resource, id}, &record)
+	return record, err
+}
+
+func (p *Player) AddRecord(ctx context.Context, resource string, record datastore.Record) error {
+	return p.replay(ctx, "AddRecord", []interface{}{resource, record})
+}
+
+func (p *Player) UpdateRecord(ctx context.Context, resource string, record datastore.Record) error {
+	return p.replay(ctx, "UpdateRecord", []interface{}{resource, record})
+}
+
+func (p *Player) DeleteRecord(ctx context.Context, resource, id string) error {
+	return p.replay(ctx, "DeleteRecord", []string{resource, id})
+}
@@ -0,0 +1,393 @@
+/*
+Author: Jason Payne
+*/
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+Recorder - a Datastore that passes every call through to the backend and appends it, with its results, to a
+recording. A call that returns exactly what it did the last time isn't written again, since replaying repeats the
+last result anyway; this keeps periodic background reads from filling the file.
+*/
+type Recorder struct {
+	datastore.Datastore
+
+	mu   sync.Mutex
+	out  *json.Encoder
+	last map[string]call
+}
+
+// NewRecorder - wraps store so that its calls are appended to the recording at path, which is created if need be.
+func NewRecorder(store datastore.Datastore, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening recording %v: %v", path, err)
+	}
+	return &Recorder{Datastore: store, out: json.NewEncoder(f), last: map[string]call{}}, nil
+}
+
+/*
+record - writes a call that's been made. A call that can't be recorded is logged rather than failing the request,
+which has already happened.
+*/
+func (r *Recorder) record(ctx context.Context, method string, args interface{}, err error, results ...interface{}) {
+	c, encodeErr := newCall(ctx, method, args)
+	for _, result := range results {
+		if encodeErr != nil {
+			break
+		}
+		var b []byte
+		b, encodeErr = json.Marshal(result)
+		c.Results = append(c.Results, b)
+	}
+	c.Error = recordError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if encodeErr == nil {
+		key := c.key()
+		if last, ok := r.last[key]; ok && sameResults(last, c) {
+			return
+		}
+		r.last[key] = c
+		encodeErr = r.out.Encode(c)
+	}
+	if encodeErr != nil {
+		log.Printf("Datastore call %v not recorded: %v", method, encodeErr)
+	}
+}
+
+func (r *Recorder) NextID(ctx context.Context) (string, error) {
+	id, err := r.Datastore.NextID(ctx)
+	r.record(ctx, "NextID", nil, err, id)
+	return id, err
+}
+
+func (r *Recorder) GetAll(ctx context.Context) ([]datastore.Product, error) {
+	products, err := r.Datastore.GetAll(ctx)
+	r.record(ctx, "GetAll", nil, err, products)
+	return products, err
+}
+
+func (r *Recorder) GetProduct(ctx context.Context, product *datastore.Product) error {
+	args := *product
+	err := r.Datastore.GetProduct(ctx, product)
+	r.record(ctx, "GetProduct", args, err, product)
+	return err
+}
+
+func (r *Recorder) GetProducts(ctx context.Context, ids []string) ([]datastore.Product, []string, error) {
+	products, missing, err := r.Datastore.GetProducts(ctx, ids)
+	r.record(ctx, "GetProducts", ids, err, products, missing)
+	return products, missing, err
+}
+
+func (r *Recorder) FindByName(ctx context.Context, name string) ([]datastore.Product, error) {
+	products, err := r.Datastore.FindByName(ctx, name)
+	r.record(ctx, "FindByName", name, err, products)
+	return products, err
+}
+
+func (r *Recorder) SearchByPrefix(ctx context.Context, prefix string) ([]datastore.Product, error) {
+	products, err := r.Datastore.SearchByPrefix(ctx, prefix)
+	r.record(ctx, "SearchByPrefix", prefix, err, products)
+	return products, err
+}
+
+func (r *Recorder) FilterProducts(ctx context.Context, expr datastore.Expr) ([]datastore.Product, error) {
+	products, err := r.Datastore.FilterProducts(ctx, expr)
+	r.record(ctx, "FilterProducts", expr.String(), err, products)
+	return products, err
+}
+
+func (r *Recorder) FindByBarcode(ctx context.Context, code string) (datastore.Product, error) {
+	p, err := r.Datastore.FindByBarcode(ctx, code)
+	r.record(ctx, "FindByBarcode", code, err, p)
+	return p, err
+}
+
+func (r *Recorder) AddProduct(ctx context.Context, p datastore.Product) error {
+	err := r.Datastore.AddProduct(ctx, p)
+	r.record(ctx, "AddProduct", p, err)
+	return err
+}
+
+func (r *Recorder) AddProducts(ctx context.Context, products []datastore.Product) error {
+	err := r.Datastore.AddProducts(ctx, products)
+	r.record(ctx, "AddProducts", products, err)
+	return err
+}
+
+func (r *Recorder) CheckUnique(ctx context.Context, products []datastore.Product) error {
+	err := r.Datastore.CheckUnique(ctx, products)
+	r.record(ctx, "CheckUnique", products, err)
+	return err
+}
+
+func (r *Recorder) UpdateProduct(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	stored, err := r.Datastore.UpdateProduct(ctx, p)
+	r.record(ctx, "UpdateProduct", p, err, stored)
+	return stored, err
+}
+
+func (r *Recorder) AdjustStock(ctx context.Context, id, location string, delta int) (datastore.Product, error) {
+	stored, err := r.Datastore.AdjustStock(ctx, id, location, delta)
+	r.record(ctx, "AdjustStock", []interface{}{id, location, delta}, err, stored)
+	return stored, err
+}
+
+func (r *Recorder) DeleteProduct(ctx context.Context, p datastore.Product) error {
+	err := r.Datastore.DeleteProduct(ctx, p)
+	r.record(ctx, "DeleteProduct", p, err)
+	return err
+}
+
+func (r *Recorder) Truncate(ctx context.Context) error {
+	err := r.Datastore.Truncate(ctx)
+	r.record(ctx, "Truncate", nil, err)
+	return err
+}
+
+func (r *Recorder) ExpiredProducts(ctx context.Context) ([]datastore.Product, error) {
+	products, err := r.Datastore.ExpiredProducts(ctx)
+	r.record(ctx, "ExpiredProducts", nil, err, products)
+	return products, err
+}
+
+func (r *Recorder) Explain(ctx context.Context, query datastore.ListQuery) (datastore.QueryPlan, error) {
+	plan, err := r.Datastore.Explain(ctx, query)
+	r.record(ctx, "Explain", query, err, plan)
+	return plan, err
+}
+
+func (r *Recorder) AdvanceID(ctx context.Context, id string) error {
+	err := r.Datastore.AdvanceID(ctx, id)
+	r.record(ctx, "AdvanceID", id, err)
+	return err
+}
+
+func (r *Recorder) GetPage(ctx context.Context, limit int, cursor string) (datastore.Page, error) {
+	page, err := r.Datastore.GetPage(ctx, limit, cursor)
+	r.record(ctx, "GetPage", []interface{}{limit, cursor}, err, page)
+	return page, err
+}
+
+func (r *Recorder) Count(ctx context.Context, filter datastore.Filter) (int, error) {
+	n, err := r.Datastore.Count(ctx, filter)
+	r.record(ctx, "Count", filter, err, n)
+	return n, err
+}
+
+func (r *Recorder) PriceHistory(ctx context.Context, id string) ([]datastore.PricePoint, error) {
+	history, err := r.Datastore.PriceHistory(ctx, id)
+	r.record(ctx, "PriceHistory", id, err, history)
+	return history, err
+}
+
+func (r *Recorder) GetChanges(ctx context.Context, after datastore.Change, limit int) ([]datastore.Change, error) {
+	changes, err := r.Datastore.GetChanges(ctx, after, limit)
+	r.record(ctx, "GetChanges", []interface{}{after, limit}, err, changes)
+	return changes, err
+}
+
+func (r *Recorder) Outbox(ctx context.Context, limit int) ([]datastore.Change, error) {
+	changes, err := r.Datastore.Outbox(ctx, limit)
+	r.record(ctx, "Outbox", limit, err, changes)
+	return changes, err
+}
+
+func (r *Recorder) DeleteOutbox(ctx context.Context, changes []datastore.Change) error {
+	err := r.Datastore.DeleteOutbox(ctx, changes)
+	r.record(ctx, "DeleteOutbox", changes, err)
+	return err
+}
+
+func (r *Recorder) GetReviews(ctx context.Context, productID string) ([]datastore.Review, error) {
+	reviews, err := r.Datastore.GetReviews(ctx, productID)
+	r.record(ctx, "GetReviews", productID, err, reviews)
+	return reviews, err
+}
+
+func (r *Recorder) GetReview(ctx context.Context, review *datastore.Review) error {
+	args := *review
+	err := r.Datastore.GetReview(ctx, review)
+	r.record(ctx, "GetReview", args, err, review)
+	return err
+}
+
+func (r *Recorder) AddReview(ctx context.Context, review datastore.Review) error {
+	err := r.Datastore.AddReview(ctx, review)
+	r.record(ctx, "AddReview", review, err)
+	return err
+}
+
+func (r *Recorder) UpdateReview(ctx context.Context, old, review datastore.Review) error {
+	err := r.Datastore.UpdateReview(ctx, old, review)
+	r.record(ctx, "UpdateReview", []datastore.Review{old, review}, err)
+	return err
+}
+
+func (r *Recorder) DeleteReview(ctx context.Context, review datastore.Review) error {
+	err := r.Datastore.DeleteReview(ctx, review)
+	r.record(ctx, "DeleteReview", review, err)
+	return err
+}
+
+func (r *Recorder) GetVariants(ctx context.Context, productID string) ([]datastore.Variant, error) {
+	variants, err := r.Datastore.GetVariants(ctx, productID)
+	r.record(ctx, "GetVariants", productID, err, variants)
+	return variants, err
+}
+
+func (r *Recorder) GetVariant(ctx context.Context, variant *datastore.Variant) error {
+	args := *variant
+	err := r.Datastore.GetVariant(ctx, variant)
+	r.record(ctx, "GetVariant", args, err, variant)
+	return err
+}
+
+func (r *Recorder) AddVariant(ctx context.Context, variant datastore.Variant) error {
+	err := r.Datastore.AddVariant(ctx, variant)
+	r.record(ctx, "AddVariant", variant, err)
+	return err
+}
+
+func (r *Recorder) UpdateVariant(ctx context.Context, variant datastore.Variant) error {
+	err := r.Datastore.UpdateVariant(ctx, variant)
+	r.record(ctx, "UpdateVariant", variant, err)
+	return err
+}
+
+func (r *Recorder) DeleteVariant(ctx context.Context, variant datastore.Variant) error {
+	err := r.Datastore.DeleteVariant(ctx, variant)
+	r.record(ctx, "DeleteVariant", variant, err)
+	return err
+}
+
+func (r *Recorder) AddOrder(ctx context.Context, order datastore.Order) error {
+	err := r.Datastore.AddOrder(ctx, order)
+	r.record(ctx, "AddOrder", order, err)
+	return err
+}
+
+func (r *Recorder) GetOrder(ctx context.Context, order *datastore.Order) error {
+	args := *order
+	err := r.Datastore.GetOrder(ctx, order)
+	r.record(ctx, "GetOrder", args, err, order)
+	return err
+}
+
+func (r *Recorder) GetCart(ctx context.Context, cart *datastore.Cart) error {
+	args := *cart
+	err := r.Datastore.GetCart(ctx, cart)
+	r.record(ctx, "GetCart", args, err, cart)
+	return err
+}
+
+func (r *Recorder) PutCart(ctx context.Context, cart datastore.Cart) error {
+	err := r.Datastore.PutCart(ctx, cart)
+	r.record(ctx, "PutCart", cart, err)
+	return err
+}
+
+func (r *Recorder) DeleteCart(ctx context.Context, id string) error {
+	err := r.Datastore.DeleteCart(ctx, id)
+	r.record(ctx, "DeleteCart", id, err)
+	return err
+}
+
+func (r *Recorder) Reserve(ctx context.Context, reservation datastore.Reservation) error {
+	err := r.Datastore.Reserve(ctx, reservation)
+	r.record(ctx, "Reserve", reservation, err)
+	return err
+}
+
+func (r *Recorder) GetReservation(ctx context.Context, reservation *datastore.Reservation) error {
+	args := *reservation
+	err := r.Datastore.GetReservation(ctx, reservation)
+	r.record(ctx, "GetReservation", args, err, reservation)
+	return err
+}
+
+func (r *Recorder) ReleaseReservation(ctx context.Context, reservation datastore.Reservation) error {
+	err := r.Datastore.ReleaseReservation(ctx, reservation)
+	r.record(ctx, "ReleaseReservation", reservation, err)
+	return err
+}
+
+func (r *Recorder) ExpiredReservations(ctx context.Context) ([]datastore.Reservation, error) {
+	reservations, err := r.Datastore.ExpiredReservations(ctx)
+	r.record(ctx, "ExpiredReservations", nil, err, reservations)
+	return reservations, err
+}
+
+func (r *Recorder) GetUsers(ctx context.Context) ([]datastore.User, error) {
+	users, err := r.Datastore.GetUsers(ctx)
+	r.record(ctx, "GetUsers", nil, err, users)
+	return users, err
+}
+
+func (r *Recorder) GetUser(ctx context.Context, user *datastore.User) error {
+	args := *user
+	err := r.Datastore.GetUser(ctx, user)
+	r.record(ctx, "GetUser", args, err, user)
+	return err
+}
+
+func (r *Recorder) AddUser(ctx context.Context, user datastore.User) error {
+	err := r.Datastore.AddUser(ctx, user)
+	r.record(ctx, "AddUser", user, err)
+	return err
+}
+
+func (r *Recorder) UpdateUser(ctx context.Context, user datastore.User) error {
+	err := r.Datastore.UpdateUser(ctx, user)
+	r.record(ctx, "UpdateUser", user, err)
+	return err
+}
+
+func (r *Recorder) DeleteUser(ctx context.Context, name string) error {
+	err := r.Datastore.DeleteUser(ctx, name)
+	r.record(ctx, "DeleteUser", name, err)
+	return err
+}
+
+func (r *Recorder) GetRecords(ctx context.Context, resource string) ([]datastore.Record, error) {
+	records, err := r.Datastore.GetRecords(ctx, resource)
+	r.record(ctx, "GetRecords", resource, err, records)
+	return records, err
+}
+
+func (r *Recorder) GetRecord(ctx context.Context, resource, id string) (datastore.Record, error) {
+	record, err := r.Datastore.GetRecord(ctx, resource, id)
+	r.record(ctx, "GetRecord", []string{resource, id}, err, record)
+	return record, err
+}
+
+func (r *Recorder) AddRecord(ctx context.Context, resource string, record datastore.Record) error {
+	err := r.Datastore.AddRecord(ctx, resource, record)
+	r.record(ctx, "AddRecord", []interface{}{resource, record}, err)
+	return err
+}
+
+func (r *Recorder) UpdateRecord(ctx context.Context, resource string, record datastore.Record) error {
+	err := r.Datastore.UpdateRecord(ctx, resource, record)
+	r.record(ctx, "UpdateRecord", []interface{}{resource, record}, err)
+	return err
+}
+
+func (r *Recorder) DeleteRecord(ctx context.Context, resource, id string) error {
+	err := r.Datastore.DeleteRecord(ctx, resource, id)
+	r.record(ctx, "DeleteRecord", []string{resource, id}, err)
+	return err
+}
@@ -0,0 +1,156 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package replay records the calls the API makes to its datastore backend, with their results, and plays them back
+later without the backend, so that frontends and CI can run against a deterministic API with no DynamoDB.
+
+A Recorder wraps the real backend and appends each call to a JSON Lines file; a Player serves the calls in a
+recording. Calls are matched by tenant, sparse fieldset, method and arguments, ignoring timestamps (which are
+usually the current time). The same call made several times is answered with its recorded results in order,
+and then with the last of them, so a listing read before and after a create sees the create.
+*/
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+call - one recorded datastore call. Args is the JSON of the call's arguments (without the context); Results holds
+each of its results in order, including what it filled in through a pointer argument.
+*/
+type call struct {
+	Tenant  string            `json:"tenant,omitempty"`
+	Fields  []string          `json:"fields,omitempty"`
+	Method  string            `json:"method"`
+	Args    json.RawMessage   `json:"args,omitempty"`
+	Results []json.RawMessage `json:"results,omitempty"`
+	Error   *callError        `json:"error,omitempty"`
+}
+
+// callError - a recorded error: its message, its datastore.Error code if it had one, and the sentinel it wrapped.
+type callError struct {
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+	Sentinel string `json:"sentinel,omitempty"`
+}
+
+// sentinels - the datastore errors callers check for with errors.Is, so a replayed error must still wrap them.
+var sentinels = map[string]error{
+	"not_found":      datastore.ErrNotFound,
+	"conflict":       datastore.ErrConflict,
+	"unavailable":    datastore.ErrUnavailable,
+	"invalid_cursor": datastore.ErrInvalidCursor,
+}
+
+// recordError - err as it's recorded; nil for no error.
+func recordError(err error) *callError {
+	if err == nil {
+		return nil
+	}
+	e := &callError{Message: err.Error()}
+	var coded *datastore.Error
+	if errors.As(err, &coded) {
+		e.Code = coded.Code
+	}
+	for name, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			e.Sentinel = name
+		}
+	}
+	return e
+}
+
+// replayedError - a recorded error, with the same message and wrapping the same sentinel as the original.
+type replayedError struct {
+	message  string
+	sentinel error
+}
+
+func (e *replayedError) Error() string {
+	return e.message
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.sentinel
+}
+
+// err - the error to return for the recorded one.
+func (e *callError) err() error {
+	if e == nil {
+		return nil
+	}
+	err := error(&replayedError{message: e.Message, sentinel: sentinels[e.Sentinel]})
+	if e.Code != "" {
+		return datastore.Errorf(e.Code, "%w", err)
+	}
+	return err
+}
+
+/*
+key - what a call is matched on: everything that decides its result, except for timestamps in its arguments, which
+will be different when it's replayed.
+*/
+func (c call) key() string {
+	var args interface{}
+	json.Unmarshal(c.Args, &args)
+	normalized, _ := json.Marshal(withoutTimes(args))
+	return strings.Join([]string{c.Tenant, strings.Join(c.Fields, ","), c.Method, string(normalized)}, "\x00")
+}
+
+// withoutTimes - v with every RFC 3339 timestamp string blanked out.
+func withoutTimes(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return ""
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = withoutTimes(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = withoutTimes(v[k])
+		}
+	}
+	return v
+}
+
+// newCall - a call to method in ctx's tenant, with its arguments (nil for none).
+func newCall(ctx context.Context, method string, args interface{}) (call, error) {
+	c := call{Tenant: datastore.Tenant(ctx), Fields: datastore.Fields(ctx), Method: method}
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return c, err
+		}
+		c.Args = b
+	}
+	return c, nil
+}
+
+// sameResults - whether two calls returned the same thing.
+func sameResults(a, b call) bool {
+	if len(a.Results) != len(b.Results) || (a.Error == nil) != (b.Error == nil) {
+		return false
+	}
+	if a.Error != nil && *a.Error != *b.Error {
+		return false
+	}
+	for i := range a.Results {
+		if !bytes.Equal(a.Results[i], b.Results[i]) {
+			return false
+		}
+	}
+	return true
+}
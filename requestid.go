@@ -0,0 +1,76 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+// requestIDHeader - identifies a request in responses and logs. A caller (or proxy) may supply its own.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRegexp - incoming IDs are kept only if they are short and safe to write to logs.
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// requestID - the ID of the request, as assigned by withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+/*
+withRequestID - gives every request an ID, reusing a valid incoming X-Request-ID or generating one, and echoes it in
+the response. Each request also gets a trace span (see tracecontext), a child of the caller's traceparent if it sent
+one, which the calls made while serving it carry on. Each request (or, depending on the log level, each failed one)
+is logged with its ID, trace ID, status and duration once it completes, so a failing request a user reports can be
+found in the logs.
+*/
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRegexp.MatchString(id) {
+			var err error
+			if id, err = datastore.NewUUID(); err != nil {
+				id = "-"
+			}
+		}
+		w.Header().Set(requestIDHeader, id)
+		span := tracecontext.Start(tracecontext.Extract(r.Header))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		ctx := tracecontext.WithSpan(context.WithValue(r.Context(), requestIDKey{}, id), span)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status >= live.Load().logLevel {
+			log.Printf("request_id=%v trace_id=%v %v %v %v %v", id, span.TraceID, r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Microsecond))
+		}
+	})
+}
+
+// statusRecorder - remembers the status code written, for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Flush - passes flushes through, so streamed responses still stream.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
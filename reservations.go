@@ -0,0 +1,160 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// Reservation holds, in minutes: the default when the request doesn't say, and the longest allowed.
+const (
+	defaultReservationMinutes = 15
+	maxReservationMinutes     = 60
+)
+
+// reservationSweep - how often expired reservations are released. Until then they can't be used, but their stock
+// isn't available either.
+const reservationSweep = time.Minute
+
+// reservationPath - route template for a single reservation. Reservation IDs are always UUIDs.
+func reservationPath() string {
+	return "/reservations/{reservation:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// reservationURL - the canonical location of a reservation.
+func reservationURL(id string) string {
+	return currentVersion + "/reservations/" + id
+}
+
+// reserveRequest - the body of a reservation request.
+type reserveRequest struct {
+	VariantId string `json:"variant_id" xml:"variant_id"`
+	Quantity  int    `json:"quantity" xml:"quantity"`
+	// Minutes - how long to hold the stock; defaults to defaultReservationMinutes.
+	Minutes int `json:"minutes" xml:"minutes"`
+}
+
+/*
+ReserveProduct - hold a quantity of one of a Product's variants for a number of minutes, so that it can't be sold to
+anyone else in the meantime. Naming the reservation on an order line uses it; otherwise it's released when it
+expires, or early with DeleteReservation.
+*/
+func (a *API) ReserveProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	var req reserveRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Minutes == 0 {
+		req.Minutes = defaultReservationMinutes
+	}
+	switch {
+	case req.VariantId == "":
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("variant_required", "Only variants track stock; choose one with variant_id"))
+		return
+	case req.Quantity < 1:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_quantity", "Quantity must be at least 1"))
+		return
+	case req.Quantity > maxQuantity:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("quantity_too_large", "Quantity must be at most %v", maxQuantity))
+		return
+	case req.Minutes < 1 || req.Minutes > maxReservationMinutes:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_reservation_minutes", "Minutes must be from 1 to %v", maxReservationMinutes))
+		return
+	}
+	v := datastore.Variant{ProductId: productID, Id: req.VariantId}
+	if err := a.Store.GetVariant(r.Context(), &v); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	id, err := datastore.NewUUID()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	res := datastore.Reservation{
+		Id:        id,
+		ProductId: productID,
+		VariantId: v.Id,
+		Quantity:  req.Quantity,
+		ExpiresAt: time.Now().UTC().Add(time.Duration(req.Minutes) * time.Minute).Truncate(time.Second),
+	}
+	if err := a.Store.Reserve(r.Context(), res); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", reservationURL(res.Id))
+	respond(w, r, http.StatusCreated, res)
+}
+
+/*
+GetReservation - display a reservation that hasn't expired.
+*/
+func (a *API) GetReservation(w http.ResponseWriter, r *http.Request) {
+	res := datastore.Reservation{Id: mux.Vars(r)["reservation"]}
+	if err := a.Store.GetReservation(r.Context(), &res); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, res)
+}
+
+/*
+DeleteReservation - release a reservation early, returning its stock.
+*/
+func (a *API) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	res := datastore.Reservation{Id: mux.Vars(r)["reservation"]}
+	if err := a.Store.GetReservation(r.Context(), &res); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if err := a.Store.ReleaseReservation(r.Context(), res); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
+
+/*
+sweepReservations - releases every tenant's expired reservations every reservationSweep, for as long as the app
+runs. With several instances, each sweeps; a reservation's release is conditional, so its stock is only returned once.
+*/
+func (a *API) sweepReservations(tenants []string) {
+	for range time.Tick(reservationSweep) {
+		for _, tenant := range tenants {
+			ctx := datastore.WithTenant(context.Background(), tenant)
+			expired, err := a.Store.ExpiredReservations(ctx)
+			if err != nil {
+				log.Printf("Expired reservations could not be listed: %v", err)
+				continue
+			}
+			for _, res := range expired {
+				// Another instance (or a checkout) may have got there first.
+				if err := a.Store.ReleaseReservation(ctx, res); err != nil {
+					log.Printf("Reservation <%v> could not be released: %v", res.Id, err)
+				}
+			}
+		}
+	}
+}
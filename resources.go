@@ -0,0 +1,191 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// categories - product categories, the first resource served through the registry rather than by handlers of its own.
+var categories = datastore.Resource{
+	Name:  "categories",
+	Table: "Categories",
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 100},
+			"description": {"type": "string", "maxLength": 1000},
+			"parent_id": {"type": "string"}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	datastore.RegisterResource(categories)
+	deleteChecks[categories.Name] = unreferenced(categories, datastore.FieldCategory)
+}
+
+// resourcePath - route template for a single record of a resource. Record IDs are always UUIDs.
+func resourcePath(res datastore.Resource) string {
+	return "/" + res.Name + "/{id:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// resourceURL - the canonical location of a record.
+func resourceURL(res datastore.Resource, id string) string {
+	return currentVersion + "/" + res.Name + "/" + id
+}
+
+/*
+recordList - a resource's records. It encodes as a bare array in JSON; XML needs a root element.
+*/
+type recordList []datastore.Record
+
+func (l recordList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "records"
+	return e.EncodeElement(struct {
+		Records []datastore.Record `xml:"record"`
+	}{l}, start)
+}
+
+/*
+resourceRoutes - the routes of every registered resource that isn't hidden: GET and POST on /{name}, and GET, PUT and
+DELETE on /{name}/{id}.
+*/
+func resourceRoutes(r *mux.Router, api *API) {
+	for _, res := range datastore.Resources() {
+		if res.Hidden {
+			continue
+		}
+		h := resourceHandler{api: api, res: res}
+		r.HandleFunc("/"+res.Name, h.list).Methods(http.MethodGet)
+		r.HandleFunc("/"+res.Name, h.create).Methods(http.MethodPost)
+		r.HandleFunc(resourcePath(res), h.get).Methods(http.MethodGet)
+		r.HandleFunc(resourcePath(res), h.update).Methods(http.MethodPut)
+		r.HandleFunc(resourcePath(res), h.delete).Methods(http.MethodDelete)
+	}
+}
+
+/*
+deleteChecks - what must be true before a record of the named resource is deleted, such as that nothing still
+depends on it. A check that fails returns the status to respond with.
+*/
+var deleteChecks = map[string]func(a *API, r *http.Request, id string) (int, error){}
+
+// resourceHandler - the handlers of one resource.
+type resourceHandler struct {
+	api *API
+	res datastore.Resource
+}
+
+/*
+readRecord - decodes the record in a JSON request body and checks it against the resource's schema. Any id in the
+body is dropped; the API assigns IDs, and the path names the record being replaced.
+*/
+func (h resourceHandler) readRecord(r *http.Request) (datastore.Record, error) {
+	if format, err := bodyFormat(r); err != nil || format != mediaJSON {
+		return nil, errUnsupportedMediaType
+	}
+	defer r.Body.Close()
+	var record datastore.Record
+	if err := decodeJSON(r.Body, &record); err != nil {
+		return nil, err
+	}
+	delete(record, datastore.RecordID)
+
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.res.Schema.Validate(body); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// list - every record of the resource.
+func (h resourceHandler) list(w http.ResponseWriter, r *http.Request) {
+	records, err := h.api.Store.GetRecords(r.Context(), h.res.Name)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, recordList(records))
+}
+
+// get - a single record.
+func (h resourceHandler) get(w http.ResponseWriter, r *http.Request) {
+	record, err := h.api.Store.GetRecord(r.Context(), h.res.Name, mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, record)
+}
+
+// create - adds a record, with a new ID.
+func (h resourceHandler) create(w http.ResponseWriter, r *http.Request) {
+	record, err := h.readRecord(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	id, err := datastore.NewUUID()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	record[datastore.RecordID] = id
+
+	if err := h.api.Store.AddRecord(r.Context(), h.res.Name, record); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", resourceURL(h.res, id))
+	respond(w, r, http.StatusCreated, record)
+}
+
+// update - replaces an existing record.
+func (h resourceHandler) update(w http.ResponseWriter, r *http.Request) {
+	record, err := h.readRecord(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	record[datastore.RecordID] = mux.Vars(r)["id"]
+
+	if err := h.api.Store.UpdateRecord(r.Context(), h.res.Name, record); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, record)
+}
+
+// delete - removes a record, once it passes the resource's delete check, if it has one.
+func (h resourceHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if check := deleteChecks[h.res.Name]; check != nil {
+		if status, err := check(h.api, r, id); err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+	}
+	if err := h.api.Store.DeleteRecord(r.Context(), h.res.Name, id); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
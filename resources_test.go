@@ -0,0 +1,278 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+func TestResourceRecords(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	w := do(h, "POST", "/v1/categories", `{"id": "ignored", "name": "Fruit", "description": "Fresh"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST categories: got status %v; body %s", w.Code, w.Body)
+	}
+	var created datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created.Id()
+	if !datastore.UUIDIDs.Valid(id) || w.Header().Get("Location") != "/v1/categories/"+id {
+		t.Fatalf("Created %v at %q; want a new UUID", created, w.Header().Get("Location"))
+	}
+
+	if w := do(h, "PUT", "/v1/categories/"+id, `{"name": "Fruit & Veg"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT category: got status %v; body %s", w.Code, w.Body)
+	}
+	w = do(h, "GET", "/v1/categories/"+id, "")
+	var got datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got["name"] != "Fruit & Veg" || got["description"] != nil {
+		t.Fatalf("GET category: got status %v, %v; want the replacement", w.Code, got)
+	}
+	w = do(h, "GET", "/v1/categories", "")
+	var list []datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list) != 1 || list[0].Id() != id {
+		t.Fatalf("GET categories: got status %v, %v", w.Code, list)
+	}
+	req := newRequest("GET", "/v1/categories/"+id, "")
+	req.Header.Set("Accept", "application/xml")
+	if w := record(h, req); !strings.Contains(w.Body.String(), "<name>Fruit &amp; Veg</name>") {
+		t.Fatalf("GET category as XML: got %s", w.Body)
+	}
+
+	for _, tc := range []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{name: "schema violation", method: "POST", path: "/v1/categories", body: `{"name": "", "color": "red"}`, status: 400, code: "schema_violation"},
+		{name: "missing update", method: "PUT", path: "/v1/categories/" + uuidFor(t), body: `{"name": "Dairy"}`, status: 404, code: "record_not_found"},
+		{name: "bad id", method: "GET", path: "/v1/categories/12", status: 404, code: "route_not_found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, tc.method, tc.path, tc.body)
+			if w.Code != tc.status || errorCode(w) != tc.code {
+				t.Fatalf("Got status %v, code %q; want %v, %q", w.Code, errorCode(w), tc.status, tc.code)
+			}
+		})
+	}
+
+	// A category can't be deleted while a Product is listed under it.
+	if w := do(h, "PUT", "/v1/product/2", `{"Name": "Orange", "Price": 0.75, "category_id": "`+id+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT product with a category: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "DELETE", "/v1/categories/"+id, ""); w.Code != http.StatusConflict || errorCode(w) != "record_in_use" {
+		t.Fatalf("DELETE category in use: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "PUT", "/v1/product/2", `{"Name": "Orange", "Price": 0.75}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT product without a category: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "DELETE", "/v1/categories/"+id, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE category: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/v1/categories/"+id, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted category: got status %v", w.Code)
+	}
+}
+
+// uuidFor - a new UUID, for a record that doesn't exist.
+func uuidFor(t *testing.T) string {
+	t.Helper()
+	id, err := datastore.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// TestSuppliers - Products can name a supplier that exists, and are listed under it.
+func TestSuppliers(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	w := do(h, "POST", "/v1/suppliers", `{"name": "Acme Produce", "lead_time_days": 3}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST suppliers: got status %v; body %s", w.Code, w.Body)
+	}
+	var supplier datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &supplier)
+	id := supplier.Id()
+
+	if w := do(h, "PUT", "/v1/product/2", `{"Name": "Orange", "Price": 0.75, "supplier_id": "`+id+`"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), id) {
+		t.Fatalf("PUT product with a supplier: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5, "supplier_id": "`+id+`"}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST product with a supplier: got status %v; body %s", w.Code, w.Body)
+	}
+	w = do(h, "GET", "/v1/suppliers/"+id+"/products", "")
+	var products []datastore.Product
+	json.Unmarshal(w.Body.Bytes(), &products)
+	if w.Code != http.StatusOK || len(products) != 2 || products[0].Id != "2" || products[1].Id != "4" {
+		t.Fatalf("GET supplier's products: got status %v; body %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{name: "unknown supplier", method: "POST", path: "/v1/product", body: `{"Name": "Lime", "Price": 0.3, "supplier_id": "` + uuidFor(t) + `"}`, status: 400, code: "record_not_found"},
+		{name: "unknown supplier in bulk", method: "POST", path: "/v1/products", body: `[{"Name": "Lime", "Price": 0.3, "supplier_id": "` + uuidFor(t) + `"}]`, status: 400, code: "record_not_found"},
+		{name: "products of an unknown supplier", method: "GET", path: "/v1/suppliers/" + uuidFor(t) + "/products", status: 404, code: "record_not_found"},
+		{name: "supplier schema violation", method: "POST", path: "/v1/suppliers", body: `{"name": "Acme", "lead_time_days": -1}`, status: 400, code: "schema_violation"},
+		{name: "delete a supplier in use", method: "DELETE", path: "/v1/suppliers/" + id, status: 409, code: "record_in_use"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, tc.method, tc.path, tc.body)
+			if w.Code != tc.status || errorCode(w) != tc.code {
+				t.Fatalf("Got status %v, code %q; want %v, %q", w.Code, errorCode(w), tc.status, tc.code)
+			}
+		})
+	}
+}
+
+// TestLocationStock - stock is adjusted per location, totalled in the product view, and never goes negative.
+func TestLocationStock(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	w := do(h, "POST", "/v1/locations", `{"name": "North warehouse", "code": "N1"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST locations: got status %v; body %s", w.Code, w.Body)
+	}
+	var north datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &north)
+	w = do(h, "POST", "/v1/locations", `{"name": "South warehouse"}`)
+	var south datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &south)
+
+	if w := do(h, "POST", "/v1/product/1/stock/"+north.Id(), `{"adjustment": 10}`); w.Code != http.StatusOK {
+		t.Fatalf("POST stock: got status %v; body %s", w.Code, w.Body)
+	}
+	do(h, "POST", "/v1/product/1/stock/"+south.Id(), `{"adjustment": 5}`)
+	w = do(h, "POST", "/v1/product/1/stock/"+north.Id(), `{"adjustment": -3}`)
+	var stock stockView
+	json.Unmarshal(w.Body.Bytes(), &stock)
+	if w.Code != http.StatusOK || stock.Locations[north.Id()] != 7 || stock.Locations[south.Id()] != 5 || stock.Total != 12 {
+		t.Fatalf("POST stock: got status %v; body %s", w.Code, w.Body)
+	}
+
+	// Updating the Product leaves its stock alone.
+	if w := do(h, "PUT", "/v1/product/1", `{"Name": "Apple", "Price": 0.6, "stock": {}}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT product: got status %v; body %s", w.Code, w.Body)
+	}
+	w = do(h, "GET", "/v1/product/1", "")
+	var p struct {
+		Stock      datastore.StockLevels `json:"stock"`
+		StockTotal int                   `json:"stock_total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if p.Stock[north.Id()] != 7 || p.StockTotal != 12 {
+		t.Fatalf("GET product: got body %s; want a stock total of 12", w.Body)
+	}
+	w = do(h, "GET", "/v1/product/2/stock", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Fatalf("GET unstocked product's stock: got status %v; body %s", w.Code, w.Body)
+	}
+
+	// Once a Product without variants is stocked, orders can't take more than it has.
+	do(h, "POST", "/v1/product/3/stock/"+north.Id(), `{"adjustment": 2}`)
+	if w := do(h, "POST", "/v1/orders", `{"lines": [{"product_id": "3", "quantity": 3}]}`); w.Code != http.StatusConflict {
+		t.Fatalf("POST an order for more than is in stock: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := do(h, "POST", "/v1/orders", `{"lines": [{"product_id": "3", "quantity": 2}]}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST an order for what's in stock: got status %v; body %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		name, path, body string
+		status           int
+		code             string
+	}{
+		{name: "take more than there is", path: "/v1/product/1/stock/" + south.Id(), body: `{"adjustment": -6}`, status: 409, code: "insufficient_stock"},
+		{name: "adjust by nothing", path: "/v1/product/1/stock/" + south.Id(), body: `{"adjustment": 0}`, status: 400, code: "invalid_stock_adjustment"},
+		{name: "adjust by too much", path: "/v1/product/1/stock/" + south.Id(), body: `{"adjustment": 2000000000}`, status: 400, code: "invalid_stock_adjustment"},
+		{name: "unknown location", path: "/v1/product/1/stock/" + uuidFor(t), body: `{"adjustment": 1}`, status: 404, code: "record_not_found"},
+		{name: "unknown product", path: "/v1/product/99/stock/" + south.Id(), body: `{"adjustment": 1}`, status: 404, code: "product_not_found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, "POST", tc.path, tc.body)
+			if w.Code != tc.status || errorCode(w) != tc.code {
+				t.Fatalf("Got status %v, code %q; want %v, %q", w.Code, errorCode(w), tc.status, tc.code)
+			}
+		})
+	}
+
+	// A location can only be deleted once it's empty.
+	if w := do(h, "DELETE", "/v1/locations/"+north.Id(), ""); w.Code != http.StatusConflict || errorCode(w) != "location_in_use" {
+		t.Fatalf("DELETE a location holding stock: got status %v, code %q", w.Code, errorCode(w))
+	}
+	do(h, "POST", "/v1/product/1/stock/"+south.Id(), `{"adjustment": -5}`)
+	if w := do(h, "DELETE", "/v1/locations/"+south.Id(), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE an empty location: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+// TestRelatedProducts - Products in the same category or with tags in common are related, the closest first.
+func TestRelatedProducts(t *testing.T) {
+	h := testServer(t, config.Default(), fixtureStore(t))
+
+	w := do(h, "POST", "/v1/categories", `{"name": "Fruit"}`)
+	var category datastore.Record
+	json.Unmarshal(w.Body.Bytes(), &category)
+	fruit := category.Id()
+
+	for path, body := range map[string]string{
+		"/v1/product/1": `{"Name": "Apple", "Price": 0.98, "category_id": "` + fruit + `", "tags": ["fresh", "sweet"]}`,
+		"/v1/product/2": `{"Name": "Orange", "Price": 0.75, "category_id": "` + fruit + `", "tags": ["Citrus", "Fresh"]}`,
+		"/v1/product/3": `{"Name": "Bananas", "Price": 2.25, "tags": ["sweet"]}`,
+	} {
+		if w := do(h, "PUT", path, body); w.Code != http.StatusOK {
+			t.Fatalf("PUT %v: got status %v; body %s", path, w.Code, w.Body)
+		}
+	}
+	do(h, "POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.9, "tags": ["exotic"]}`)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"2", "3"}},
+		{"?limit=1", []string{"2"}},
+	} {
+		w := do(h, "GET", "/v1/product/1/related"+tc.query, "")
+		var products []datastore.Product
+		json.Unmarshal(w.Body.Bytes(), &products)
+		var ids []string
+		for _, p := range products {
+			ids = append(ids, p.Id)
+		}
+		if w.Code != http.StatusOK || strings.Join(ids, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("GET related%v: got status %v, IDs %v; want %v", tc.query, w.Code, ids, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{name: "unknown category", method: "POST", path: "/v1/product", body: `{"Name": "Lime", "Price": 0.3, "category_id": "` + uuidFor(t) + `"}`, status: 400, code: "record_not_found"},
+		{name: "repeated tag", method: "POST", path: "/v1/product", body: `{"Name": "Lime", "Price": 0.3, "tags": ["citrus", "Citrus"]}`, status: 400},
+		{name: "limit over the most", method: "GET", path: "/v1/product/1/related?limit=11", status: 400, code: "invalid_limit"},
+		{name: "unknown product", method: "GET", path: "/v1/product/99/related", status: 404, code: "product_not_found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, tc.method, tc.path, tc.body)
+			if w.Code != tc.status || (tc.code != "" && errorCode(w) != tc.code) {
+				t.Fatalf("Got status %v, code %q; want %v, %q", w.Code, errorCode(w), tc.status, tc.code)
+			}
+		})
+	}
+}
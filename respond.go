@@ -0,0 +1,199 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/productpb"
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+/*
+strictMode - when true (the default for new deployments), responses use the corrected API behavior:
+problem+json error bodies, new response fields/envelopes, and stricter status codes. Existing client
+integrations can turn it off in the config file until they have migrated.
+*/
+var strictMode = true
+
+/*
+problem - an RFC 7807 problem details body, used for errors in strict mode.
+*/
+type problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type    string   `json:"type" xml:"type"`
+	Title   string   `json:"title" xml:"title"`
+	Status  int      `json:"status" xml:"status"`
+	Detail  string   `json:"detail,omitempty" xml:"detail,omitempty"`
+	// Code - identifies the error whatever language Title and Detail are in; clients should match on this.
+	Code string `json:"code" xml:"code"`
+	// RequestID - matches the X-Request-ID response header and the request's log line.
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	// Errors - for a body that doesn't match its schema, each violation, located by JSON Pointer.
+	Errors []schema.Violation `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// respond - writes v as the response body, in whichever format the client negotiated, with the given status.
+func respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	media, err := negotiate(r)
+	if err != nil {
+		writeError(w, r, http.StatusNotAcceptable, err)
+		return
+	}
+
+	// Only product resources are defined in the proto, and only the listing streams NDJSON; everything else
+	// falls back to JSON.
+	if _, ok := protobufBody(v); (media == productpb.MediaType && !ok) || media == mediaNDJSON {
+		media = mediaJSON
+	}
+
+	w.Header().Set("Content-Type", media)
+	w.Header().Add("Vary", "Accept")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(status)
+		encode(w, media, v)
+		return
+	}
+
+	// A read is encoded before it's sent, so that its headers can describe it: its length, and an ETag that changes
+	// whenever the body does. HEAD gets the same headers without the body.
+	var body bytes.Buffer
+	encode(&body, media, v)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if status == http.StatusOK {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(body.Bytes())))
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body.Bytes())
+	}
+}
+
+/*
+setLastModified - sets Last-Modified to when the latest of the Products in a response changed, if every one of them
+has an UpdatedAt. Responses that depend on more than the Products themselves (included variants, prices converted at
+the current exchange rate) don't get one, since they can change while it doesn't; their ETag still changes.
+*/
+func setLastModified(w http.ResponseWriter, r *http.Request, products []datastore.Product) {
+	if q := r.URL.Query(); q.Get("include") != "" || q.Get("currency") != "" {
+		return
+	}
+	var latest time.Time
+	for _, p := range products {
+		if p.UpdatedAt == nil {
+			return
+		}
+		if p.UpdatedAt.After(latest) {
+			latest = *p.UpdatedAt
+		}
+	}
+	if !latest.IsZero() {
+		w.Header().Set("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
+
+// encode - writes v to w in the given media type.
+func encode(w io.Writer, media string, v interface{}) {
+	switch media {
+	case mediaXML:
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(v)
+	case productpb.MediaType:
+		b, _ := protobufBody(v)
+		w.Write(b)
+	case mediaJSONAPI:
+		json.NewEncoder(w).Encode(toJSONAPI(v))
+	default:
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+/*
+errorLanguage - the language to describe an error in, chosen from the request's Accept-Language header and named in
+the response's Content-Language.
+*/
+func errorLanguage(w http.ResponseWriter, r *http.Request) string {
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	return lang
+}
+
+/*
+storeStatus - the status for a failed datastore call: 404, 409 or 503 for the datastore's sentinel errors, 504 if
+the request's deadline passed, or 500.
+*/
+func storeStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, datastore.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, datastore.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, datastore.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError - reports an error: problem details in strict mode, the original plain-text body otherwise.
+// Server errors are also logged, with the request ID, since their details may be the only clue to the cause, and
+// reported if error reporting is on (panics are reported as themselves, by recoverPanics).
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		log.Printf("request_id=%v error: %v", requestID(r), err)
+		if err != errPanic {
+			reportError(r, err)
+		}
+	}
+
+	// JSON:API clients opted in to its error format, whatever the mode.
+	if media, _ := negotiate(r); media == mediaJSONAPI {
+		writeJSONAPIError(w, r, status, err)
+		return
+	}
+
+	if !strictMode {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	lang := errorLanguage(w, r)
+
+	// Problem details are XML or JSON; an unacceptable (or protobuf) Accept header gets the JSON form.
+	media, _ := negotiate(r)
+	if media != mediaXML {
+		media = mediaJSON
+	}
+	w.Header().Set("Content-Type", "application/problem+"+media[len("application/"):])
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	body := problem{
+		Type:      "about:blank",
+		Title:     i18n.Title(lang, status),
+		Status:    status,
+		Detail:    i18n.Message(lang, err),
+		Code:      i18n.Code(err, status),
+		RequestID: requestID(r),
+	}
+	var invalid *schema.Error
+	if errors.As(err, &invalid) {
+		body.Errors = invalid.Violations
+	}
+	encode(w, media, body)
+}
@@ -0,0 +1,239 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// responseCacheMetrics - response cache effectiveness, published at /debug/vars.
+var responseCacheMetrics = expvar.NewMap("response_cache")
+
+// responseCacheTimeout - how long a request waits for Redis before carrying on without the cache.
+const responseCacheTimeout = 100 * time.Millisecond
+
+/*
+productWrites - the Datastore methods that can change what a listing or search shows, and so invalidate the cached
+responses.
+*/
+var productWrites = map[string]bool{
+	"AddProduct": true, "AddProducts": true, "UpdateProduct": true, "AdjustStock": true, "DeleteProduct": true,
+	"Truncate": true, "AddReview": true, "UpdateReview": true, "DeleteReview": true, "AddVariant": true,
+	"UpdateVariant": true, "DeleteVariant": true, "AddOrder": true, "Reserve": true, "ReleaseReservation": true,
+}
+
+/*
+responseCache - listing and search responses, kept in Redis so that every instance shares them. Each tenant's
+responses are keyed under its generation, a counter that every write to its Products bumps: responses cached before a
+write are never read again, and expire in their own time.
+*/
+type responseCache struct {
+	client   *redis.Client
+	ttl      time.Duration
+	maxBytes int
+}
+
+// newResponseCache - the response cache for the config; nil if it names no Redis server.
+func newResponseCache(cfg config.ResponseCache) *responseCache {
+	if cfg.Redis == "" {
+		return nil
+	}
+	return &responseCache{client: redis.NewClient(&redis.Options{Addr: cfg.Redis}), ttl: cfg.TTL.Duration, maxBytes: cfg.MaxBytes}
+}
+
+// cachedResponse - a response as it's kept in Redis.
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// generationKey - the Redis key of a tenant's generation.
+func generationKey(tenant string) string {
+	return "responses:" + tenant + ":generation"
+}
+
+/*
+responseKey - the part of a response's Redis key that identifies the request: its path, its query normalized (keys
+sorted and empty parameters dropped, so "?b=2&a=1&c=" is the same as "?a=1&b=2"), and the headers that choose its
+representation.
+*/
+func responseKey(r *http.Request) string {
+	query := url.Values{}
+	for k, values := range r.URL.Query() {
+		for _, v := range values {
+			if v != "" {
+				query.Add(k, v)
+			}
+		}
+	}
+	sum := sha256.Sum256([]byte(r.URL.Path + "?" + query.Encode() + "\n" + r.Header.Get("Accept") + "\n" + r.Header.Get("Accept-Language")))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+redisCachedResponse - reads the tenant's generation and, under it, the response cached for KEYS[2] (if any), in one
+round trip.
+*/
+var redisCachedResponse = redis.NewScript(`
+local generation = redis.call("GET", KEYS[1]) or "0"
+local response = redis.call("GET", "responses:" .. ARGV[1] .. ":" .. generation .. ":" .. KEYS[2]) or ""
+return {generation, response}
+`)
+
+// lookup - the cached response for a request, if there is one, and the generation to store it under if not.
+func (c *responseCache) lookup(ctx context.Context, tenant, key string) (*cachedResponse, string, error) {
+	result, err := redisCachedResponse.Run(ctx, c.client, []string{generationKey(tenant), key}, tenant).StringSlice()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(result) != 2 {
+		return nil, "", errors.New("Unexpected response cache result")
+	}
+	if result[1] == "" {
+		return nil, result[0], nil
+	}
+	var response cachedResponse
+	if err := json.Unmarshal([]byte(result[1]), &response); err != nil {
+		return nil, "", err
+	}
+	return &response, result[0], nil
+}
+
+// store - caches a response under the generation it was read in.
+func (c *responseCache) store(ctx context.Context, tenant, generation, key string, response cachedResponse) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, "responses:"+tenant+":"+generation+":"+key, b, c.ttl).Err()
+}
+
+/*
+invalidate - an Interceptor that bumps the tenant's generation after each call that writes to its Products, whether
+or not the call succeeded, since one that failed may still have been applied. If Redis can't be reached, the responses
+cached before the write are served until they expire.
+*/
+func (c *responseCache) invalidate(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	err := call(ctx)
+	if productWrites[method] {
+		redisCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), responseCacheTimeout)
+		defer cancel()
+		if incrErr := c.client.Incr(redisCtx, generationKey(datastore.Tenant(ctx))).Err(); incrErr != nil {
+			responseCacheMetrics.Add("errors", 1)
+			log.Printf("Invalidating cached responses after %v failed: %v", method, incrErr)
+		}
+	}
+	return err
+}
+
+/*
+cachedResponses - serves GET and HEAD requests from the response cache, and caches the successful GET responses it
+doesn't have, up to maxBytes. Strongly consistent reads and NDJSON streams bypass it, and a request carries on without
+it if Redis can't be reached. Whether a response came from the cache is in its X-Cache header.
+*/
+func (a *API) cachedResponses(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := a.Responses
+		if c == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next(w, r)
+			return
+		}
+		if media, _ := negotiate(r); media == mediaNDJSON || datastore.ConsistentRead(r.Context()) {
+			next(w, r)
+			return
+		}
+
+		tenant, key := datastore.Tenant(r.Context()), responseKey(r)
+		ctx, cancel := context.WithTimeout(r.Context(), responseCacheTimeout)
+		cached, generation, err := c.lookup(ctx, tenant, key)
+		cancel()
+		switch {
+		case err != nil:
+			responseCacheMetrics.Add("errors", 1)
+			log.Printf("request_id=%v Reading the response cache failed: %v", requestID(r), err)
+			next(w, r)
+			return
+		case cached != nil:
+			responseCacheMetrics.Add("hits", 1)
+			for k, v := range cached.Header {
+				w.Header()[k] = append(w.Header()[k], v...)
+			}
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(cached.Status)
+			if r.Method != http.MethodHead {
+				w.Write(cached.Body)
+			}
+			return
+		}
+		responseCacheMetrics.Add("misses", 1)
+		if r.Method == http.MethodHead {
+			// A HEAD response has no body to cache.
+			w.Header().Set("X-Cache", "MISS")
+			next(w, r)
+			return
+		}
+
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next(rec, r)
+		for k, v := range rec.header {
+			w.Header()[k] = append(w.Header()[k], v...)
+		}
+		w.Header().Set("X-Cache", "MISS")
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+
+		if rec.status != http.StatusOK || rec.body.Len() > c.maxBytes {
+			return
+		}
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(r.Context()), responseCacheTimeout)
+		defer cancel()
+		if err := c.store(ctx, tenant, generation, key, cachedResponse{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}); err != nil {
+			responseCacheMetrics.Add("errors", 1)
+			log.Printf("request_id=%v Writing the response cache failed: %v", requestID(r), err)
+		}
+	}
+}
+
+/*
+bufferedResponse - a handler's response, held until it's finished, so it can be cached as well as sent. Only the
+headers the handler sets itself are kept, not those of the middleware around it, such as request IDs and rate limits.
+*/
+type bufferedResponse struct {
+	header  http.Header
+	status  int
+	started bool
+	body    bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.started {
+		b.started = true
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.started = true
+	return b.body.Write(p)
+}
@@ -0,0 +1,57 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestResponseCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := config.Default()
+	cfg.ResponseCache.Redis = server.Addr()
+	store := fixtureStore(t)
+	// Two instances sharing the store and the cache.
+	a, b := testServer(t, cfg, store), testServer(t, cfg, store)
+
+	for _, c := range []struct {
+		h                   http.Handler
+		method, path, cache string
+	}{
+		{a, "GET", "/v1/products?sort=name&fields=name", "MISS"},
+		{a, "GET", "/v1/products?sort=name&fields=name", "HIT"},
+		{b, "GET", "/v1/products?fields=name&sort=name&q=", "HIT"},
+		{b, "HEAD", "/v1/products?fields=name&sort=name", "HIT"},
+		{a, "GET", "/v1/products?sort=-name&fields=name", "MISS"},
+	} {
+		w := do(c.h, c.method, c.path, "")
+		if w.Code != http.StatusOK || w.Header().Get("X-Cache") != c.cache {
+			t.Fatalf("%v %v: got %v with X-Cache %q, want 200 with %v", c.method, c.path, w.Code, w.Header().Get("X-Cache"), c.cache)
+		}
+		if c.method == "HEAD" && w.Body.Len() != 0 {
+			t.Errorf("HEAD %v: got a body", c.path)
+		}
+	}
+
+	// A write through either instance invalidates the responses cached by both.
+	if w := do(b, "PUT", "/v1/product/1", `{"Name": "Green Apple", "Price": 1.05}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: got %v %s", w.Code, w.Body)
+	}
+	w := do(a, "GET", "/v1/products?sort=name&fields=name", "")
+	if w.Header().Get("X-Cache") != "MISS" || !strings.Contains(w.Body.String(), "Green Apple") {
+		t.Fatalf("After a write: got X-Cache %q and %s", w.Header().Get("X-Cache"), w.Body)
+	}
+
+	// Without Redis, requests are served without the cache.
+	server.Close()
+	if w := do(a, "GET", "/v1/products", ""); w.Code != http.StatusOK || w.Header().Get("X-Cache") != "" {
+		t.Fatalf("Without Redis: got %v with X-Cache %q", w.Code, w.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+// flaky - store, except that the first call to each named method fails with its error; calls counts every call made.
+func flaky(store datastore.Datastore, errs map[string]error, calls map[string]int) datastore.Datastore {
+	return datastore.Intercept(store, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		calls[method]++
+		if err, ok := errs[method]; ok && calls[method] == 1 {
+			return err
+		}
+		return call(ctx)
+	})
+}
+
+func TestRetriesOnlyWhatIsSafeToRetry(t *testing.T) {
+	throttled := fmt.Errorf("Slow down: %w (%w)", datastore.ErrUnavailable, datastore.ErrThrottled)
+	policy := datastore.RetryPolicy{Attempts: 3, BudgetRatio: 0.1, BudgetMin: 10}
+	cases := []struct {
+		name   string
+		method string
+		err    error
+		policy datastore.RetryPolicy
+		do     [3]string
+		status int
+		calls  int
+	}{
+		{"read retried", "GetProduct", errUnavailable, policy, [3]string{"GET", "/v1/product/1", ""}, 200, 2},
+		{"replace retried", "PutCart", errUnavailable, policy, [3]string{"POST", "/v1/carts", ""}, 201, 2},
+		{"update not retried", "UpdateProduct", errUnavailable, policy, [3]string{"PUT", "/v1/product/1", `{"Name": "Kiwi", "Price": 0.5}`}, 503, 1},
+		{"throttled update retried", "UpdateProduct", throttled, policy, [3]string{"PUT", "/v1/product/1", `{"Name": "Kiwi", "Price": 0.5}`}, 200, 2},
+		{"add not retried", "AddProduct", errUnavailable, policy, [3]string{"POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5}`}, 503, 1},
+		{"throttled add retried", "AddProduct", throttled, policy, [3]string{"POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5}`}, 201, 2},
+		{"not found not retried", "GetProduct", datastore.ErrNotFound, policy, [3]string{"GET", "/v1/product/1", ""}, 404, 1},
+		{"no budget", "GetProduct", errUnavailable, datastore.RetryPolicy{Attempts: 3}, [3]string{"GET", "/v1/product/1", ""}, 503, 1},
+		{"other error not retried", "GetProduct", errors.New("Boom"), policy, [3]string{"GET", "/v1/product/1", ""}, 500, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			calls := map[string]int{}
+			store := datastore.Intercept(flaky(fixtureStore(t), map[string]error{c.method: c.err}, calls), datastore.Retrying(c.policy))
+			w := do(testServer(t, config.Default(), store), c.do[0], c.do[1], c.do[2])
+			if w.Code != c.status || calls[c.method] != c.calls {
+				t.Fatalf("Got status %v after %v calls, want %v after %v; body %s", w.Code, calls[c.method], c.status, c.calls, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCommentLength - the longest review comment accepted, in characters.
+const maxCommentLength = 2000
+
+// reviewPath - route template for a single review of a Product. Review IDs are always UUIDs.
+func reviewPath() string {
+	return productPath() + "/reviews/{review:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// reviewURL - the canonical location of a review.
+func reviewURL(r datastore.Review) string {
+	return productURL(r.ProductId) + "/reviews/" + r.Id
+}
+
+/*
+reviewList - a Product's reviews. It encodes as a bare array in JSON; XML needs a root element.
+*/
+type reviewList []datastore.Review
+
+func (l reviewList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "reviews"
+	return e.EncodeElement(struct {
+		Reviews []datastore.Review `xml:"review"`
+	}{l}, start)
+}
+
+// reviewedProduct - the Product named in the path; on failure, it has already responded.
+func (a *API) reviewedProduct(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return "", false
+	}
+	p := datastore.Product{Id: id}
+	if err = a.Store.GetProduct(datastore.IDsOnly(r.Context()), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return "", false
+	}
+	return id, true
+}
+
+// pathReview - the review named in the path, as stored; on failure, it has already responded.
+func (a *API) pathReview(w http.ResponseWriter, r *http.Request) (datastore.Review, bool) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return datastore.Review{}, false
+	}
+	review := datastore.Review{ProductId: productID, Id: mux.Vars(r)["review"]}
+	if err := a.Store.GetReview(r.Context(), &review); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return datastore.Review{}, false
+	}
+	return review, true
+}
+
+// readReview - decodes and validates the rating and comment of a review in the request body.
+func readReview(r *http.Request) (datastore.Review, error) {
+	var review datastore.Review
+	if err := decodeBody(r, &review); err != nil {
+		return review, err
+	}
+	defer r.Body.Close()
+
+	review.Comment = strings.TrimSpace(review.Comment)
+	switch {
+	case review.Rating < datastore.MinRating || review.Rating > datastore.MaxRating:
+		return review, fmt.Errorf("Rating must be from %v to %v", datastore.MinRating, datastore.MaxRating)
+	case utf8.RuneCountInString(review.Comment) > maxCommentLength:
+		return review, fmt.Errorf("Comments can be at most %v characters", maxCommentLength)
+	}
+	return review, nil
+}
+
+// reviewWriteError - responds to a failed review write; a concurrent change to the same review is a conflict.
+func reviewWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, storeStatus(err), err)
+}
+
+/*
+GetReviews - a Product's reviews, oldest first.
+*/
+func (a *API) GetReviews(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	reviews, err := a.Store.GetReviews(r.Context(), productID)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, reviewList(reviews))
+}
+
+/*
+GetReview - a single review.
+*/
+func (a *API) GetReview(w http.ResponseWriter, r *http.Request) {
+	if review, ok := a.pathReview(w, r); ok {
+		respond(w, r, http.StatusOK, review)
+	}
+}
+
+/*
+CreateReview - add a review, with a rating from 1 to 5 and an optional comment, to a Product.
+*/
+func (a *API) CreateReview(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	review, err := readReview(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+
+	if review.Id, err = datastore.NewUUID(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	review.ProductId = productID
+	review.CreatedAt = time.Now().UTC()
+	review.UpdatedAt = review.CreatedAt
+
+	if err := a.Store.AddReview(r.Context(), review); err != nil {
+		reviewWriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", reviewURL(review))
+	respond(w, r, http.StatusCreated, review)
+}
+
+/*
+UpdateReview - change a review's rating and comment.
+*/
+func (a *API) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.pathReview(w, r)
+	if !ok {
+		return
+	}
+	review, err := readReview(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+
+	review.Id, review.ProductId, review.CreatedAt = old.Id, old.ProductId, old.CreatedAt
+	review.UpdatedAt = time.Now().UTC()
+	if err := a.Store.UpdateReview(r.Context(), old, review); err != nil {
+		reviewWriteError(w, r, err)
+		return
+	}
+	respond(w, r, http.StatusOK, review)
+}
+
+/*
+DeleteReview - remove a review.
+*/
+func (a *API) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.pathReview(w, r)
+	if !ok {
+		return
+	}
+	if err := a.Store.DeleteReview(r.Context(), review); err != nil {
+		reviewWriteError(w, r, err)
+		return
+	}
+
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
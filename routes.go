@@ -0,0 +1,214 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// currentVersion - path prefix of the API version that new clients should use.
+const currentVersion = "/v1"
+
+/*
+apiVersions - every mounted API version, keyed by path prefix. A future version is mounted side by side
+by adding its prefix and route table here; older versions keep working until they are removed.
+*/
+var apiVersions = map[string]func(*mux.Router, *API){
+	"/v1": v1Routes,
+}
+
+// productPath - route template for a single Product, matching IDs of the active ID strategy.
+func productPath() string {
+	return "/product/{id:" + datastore.Strategy.Pattern() + "}"
+}
+
+// productURL - the canonical location of a Product.
+func productURL(id string) string {
+	return currentVersion + "/product/" + id
+}
+
+/*
+v1Routes - the version 1 API.
+*/
+func v1Routes(r *mux.Router, api *API) {
+	r.HandleFunc("/", cacheableFunc(cacheListings, api.cachedResponses(api.GetAllProducts))).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/products", cacheableFunc(cacheListings, api.cachedResponses(api.GetAllProducts))).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/products", api.CreateProducts).Methods(http.MethodPost)
+	r.HandleFunc("/products/count", cacheableFunc(cacheListings, api.CountProducts)).Methods(http.MethodGet)
+	r.HandleFunc("/products/lookup", api.LookupProducts).Methods(http.MethodPost)
+	r.HandleFunc("/products/changes", cacheableFunc(cacheListings, api.GetProductChanges)).Methods(http.MethodGet)
+	r.HandleFunc("/products/search", cacheableFunc(cacheListings, requireFeature(featureSearch, api.cachedResponses(api.SearchProducts)))).Methods(http.MethodGet)
+	r.HandleFunc("/products/export.csv", cacheableFunc(cacheListings, api.ExportProductsCSV)).Methods(http.MethodGet)
+	r.HandleFunc("/products/import", api.ImportProducts).Methods(http.MethodPost)
+	r.HandleFunc("/product", api.CreateProduct).Methods(http.MethodPost)
+	r.HandleFunc(productPath(), cacheableFunc(cacheProducts, api.GetProduct)).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(barcodePath(), cacheableFunc(cacheProducts, api.GetProductByBarcode)).Methods(http.MethodGet)
+	r.HandleFunc(productPath(), api.UpdateProduct).Methods(http.MethodPut)
+	r.HandleFunc(productPath(), api.DeleteProduct).Methods(http.MethodDelete)
+	r.HandleFunc(productPath()+"/merge", api.MergeProduct).Methods(http.MethodPost)
+	r.HandleFunc(productPath()+"/merges", api.GetMerges).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/price-history", cacheableFunc(cacheProducts, api.GetPriceHistory)).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/reviews", cacheableFunc(cacheProducts, api.GetReviews)).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/reviews", api.CreateReview).Methods(http.MethodPost)
+	r.HandleFunc(reviewPath(), cacheableFunc(cacheProducts, api.GetReview)).Methods(http.MethodGet)
+	r.HandleFunc(reviewPath(), api.UpdateReview).Methods(http.MethodPut)
+	r.HandleFunc(reviewPath(), api.DeleteReview).Methods(http.MethodDelete)
+	r.HandleFunc(productPath()+"/price-alerts", api.GetPriceAlerts).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/price-alerts", api.CreatePriceAlert).Methods(http.MethodPost)
+	r.HandleFunc(priceAlertPath(), api.GetPriceAlert).Methods(http.MethodGet)
+	r.HandleFunc(priceAlertPath(), api.DeletePriceAlert).Methods(http.MethodDelete)
+	r.HandleFunc(productPath()+"/variants", cacheableFunc(cacheProducts, api.GetVariants)).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/variants", api.CreateVariant).Methods(http.MethodPost)
+	r.HandleFunc(variantPath(), cacheableFunc(cacheProducts, api.GetVariant)).Methods(http.MethodGet)
+	r.HandleFunc(variantPath(), api.UpdateVariant).Methods(http.MethodPut)
+	r.HandleFunc(variantPath(), api.DeleteVariant).Methods(http.MethodDelete)
+	r.HandleFunc(productPath()+"/related", cacheableFunc(cacheListings, api.GetRelatedProducts)).Methods(http.MethodGet)
+	r.HandleFunc(productPath()+"/stock", cacheableFunc(cacheProducts, api.GetStock)).Methods(http.MethodGet)
+	r.HandleFunc(stockLocationPath(), api.AdjustStock).Methods(http.MethodPost)
+	r.HandleFunc(productPath()+"/reserve", api.ReserveProduct).Methods(http.MethodPost)
+	r.HandleFunc(reservationPath(), api.GetReservation).Methods(http.MethodGet)
+	r.HandleFunc(reservationPath(), api.DeleteReservation).Methods(http.MethodDelete)
+	r.HandleFunc("/orders", api.CreateOrder).Methods(http.MethodPost)
+	r.HandleFunc(orderPath(), api.GetOrder).Methods(http.MethodGet)
+	r.HandleFunc("/carts", api.CreateCart).Methods(http.MethodPost)
+	r.HandleFunc(cartPath(), api.GetCart).Methods(http.MethodGet)
+	r.HandleFunc(cartPath(), api.DeleteCart).Methods(http.MethodDelete)
+	r.HandleFunc(cartPath()+"/items", api.AddCartItem).Methods(http.MethodPost)
+	r.HandleFunc(cartItemPath(), api.UpdateCartItem).Methods(http.MethodPut)
+	r.HandleFunc(cartItemPath(), api.RemoveCartItem).Methods(http.MethodDelete)
+	r.HandleFunc(cartPath()+"/checkout", api.CheckoutCart).Methods(http.MethodPost)
+	resourceRoutes(r, api)
+	r.HandleFunc(resourcePath(suppliers)+"/products", cacheableFunc(cacheListings, api.GetSupplierProducts)).Methods(http.MethodGet)
+}
+
+/*
+adminRoutes - operational endpoints. These aren't part of the versioned product API. protect guards every one that
+changes anything, exports the catalog in bulk, manages users or exposes who uses the API; only explain, the feature
+flags and the dead-letter list are left to the admin middleware alone.
+*/
+func adminRoutes(r *mux.Router, api *API, protect mux.MiddlewareFunc) {
+	r.HandleFunc("/explain", api.ExplainQuery).Methods(http.MethodGet)
+	r.HandleFunc("/features", GetFeatures).Methods(http.MethodGet)
+	r.Handle("/backup", protect(http.HandlerFunc(api.BackupProducts))).Methods(http.MethodGet)
+	r.Handle("/restore", protect(http.HandlerFunc(api.RestoreProducts))).Methods(http.MethodPost)
+	r.Handle("/products", protect(http.HandlerFunc(api.TruncateProducts))).Methods(http.MethodDelete)
+	r.Handle("/export", protect(http.HandlerFunc(api.ExportToS3))).Methods(http.MethodPost)
+	r.Handle("/search/reindex", protect(http.HandlerFunc(api.ReindexSearch))).Methods(http.MethodPost)
+	r.HandleFunc("/jobs/dead-letters", api.GetDeadLetters).Methods(http.MethodGet)
+	r.Handle("/usage", protect(http.HandlerFunc(api.GetUsage))).Methods(http.MethodGet)
+	r.Handle("/jobs/dead-letters/{job}/retry", protect(http.HandlerFunc(api.RetryDeadLetter))).Methods(http.MethodPost)
+	r.Handle("/users", protect(http.HandlerFunc(api.GetUsers))).Methods(http.MethodGet)
+	r.Handle("/users", protect(http.HandlerFunc(api.CreateUser))).Methods(http.MethodPost)
+	r.Handle(userPath, protect(http.HandlerFunc(api.GetUser))).Methods(http.MethodGet)
+	r.Handle(userPath, protect(http.HandlerFunc(api.DeleteUser))).Methods(http.MethodDelete)
+	r.Handle(userPath+"/roles", protect(http.HandlerFunc(api.SetUserRoles))).Methods(http.MethodPut)
+	r.Handle(userPath+"/tenants", protect(http.HandlerFunc(api.SetUserTenants))).Methods(http.MethodPut)
+	r.Handle(userPath+"/rotate", protect(http.HandlerFunc(api.RotateUserCredentials))).Methods(http.MethodPost)
+}
+
+/*
+legacyRoutes - the original unversioned paths. Depending on config, they either redirect to the same path
+under the current version (308, so the method and body are preserved) or respond 410 Gone.
+*/
+func legacyRoutes(r *mux.Router, policy string) {
+	handler := legacyRedirect
+	if policy == config.LegacyGone {
+		handler = legacyGone
+	}
+
+	r.HandleFunc("/", handler)
+	r.HandleFunc("/product", handler)
+	r.HandleFunc(productPath(), handler)
+}
+
+func legacyRedirect(w http.ResponseWriter, r *http.Request) {
+	target := *r.URL
+	target.Path = currentVersion + r.URL.Path
+	http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+}
+
+func legacyGone(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusGone, i18n.Errorf("legacy_path_gone", "Unversioned paths have been removed; use %v%v instead", currentVersion, r.URL.Path))
+}
+
+// routeMethods - the methods checked when working out which ones a path supports.
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+/*
+allowedMethods - the methods the router accepts for the request's path; empty if the path doesn't exist.
+*/
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	allowed := []string{}
+	for _, method := range routeMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+/*
+unmatched - handles requests that no route accepts. If the path exists under other methods the response
+is 405 with an Allow header (or, for OPTIONS, just the Allow header); otherwise it is a 404. Both use the
+same error body as every other error, rather than mux's plain-text defaults. The methods are probed
+directly because mux doesn't reliably report a method mismatch from inside subrouters.
+*/
+func unmatched(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := allowedMethods(router, r)
+		if len(methods) == 0 {
+			writeError(w, r, http.StatusNotFound, i18n.Errorf("route_not_found", "No resource at %v", r.URL.Path))
+			return
+		}
+
+		allowed := strings.Join(append(methods, http.MethodOptions), ", ")
+		w.Header().Set("Allow", allowed)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeError(w, r, http.StatusMethodNotAllowed, i18n.Errorf("method_not_allowed", "Method %v is not allowed; use one of %v", r.Method, allowed))
+	})
+}
+
+/*
+newRouter - builds the router for api, with every API version mounted under its prefix.
+*/
+func newRouter(cfg config.Config, api *API) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(middlewareChain(cfg.Middleware.Router, routerMiddleware, cfg, api, router)...)
+	timeout := withTimeout(cfg.Server.RequestTimeout.Duration)
+	for prefix, mount := range apiVersions {
+		version := router.PathPrefix(prefix).Subrouter()
+		version.Use(middlewareChain(cfg.Middleware.API, apiMiddleware, cfg, api, router)...)
+		mount(version, api)
+	}
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(requireCSRFToken(api.CSRF), requireAuth(api.AdminAuth), requireSignature(api.Signatures), requireRole(roleAdmin), requireTenant(cfg.Tenancy), decompressBody, cacheAdminReads)
+	adminRoutes(admin, api, requireAdmin(api.Signatures))
+	router.Handle("/catalog", timeout(rateLimit(requireCSRFToken(api.CSRF)(requireAuth(api.Auth)(requireRole(roleReader)(requireTenant(cfg.Tenancy)(cacheable(cacheListings, http.HandlerFunc(api.Catalog))))))))).Methods(http.MethodGet)
+	legacyRoutes(router, cfg.LegacyRoutes)
+	router.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/healthz", api.Health).Methods(http.MethodGet)
+	router.HandleFunc("/version", Version).Methods(http.MethodGet)
+	router.NotFoundHandler = unmatched(router)
+	router.MethodNotAllowedHandler = unmatched(router)
+
+	return router
+}
@@ -0,0 +1,158 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// exportTypes - the content type of each export format.
+var exportTypes = map[string]string{
+	config.ExportJSON: mediaJSON,
+	config.ExportCSV:  "text/csv; charset=utf-8",
+}
+
+/*
+s3Exporter - writes exports of the catalog to an S3 bucket. Exports are read from the store in one go, like admin
+backups, so every format in an export has the same Products.
+*/
+type s3Exporter struct {
+	client *s3.Client
+	cfg    config.Export
+}
+
+// newS3Exporter - an exporter for the configured bucket, using the SDK's default credentials; nil if none is set.
+func newS3Exporter(ctx context.Context, cfg config.Export) (*s3Exporter, error) {
+	if cfg.Bucket == "" {
+		return nil, nil
+	}
+	if len(cfg.Formats) == 0 {
+		return nil, fmt.Errorf("Export formats can't be empty; use %q and/or %q", config.ExportJSON, config.ExportCSV)
+	}
+	for _, format := range cfg.Formats {
+		if _, ok := exportTypes[format]; !ok {
+			return nil, fmt.Errorf("Unknown export format %q; use %q or %q", format, config.ExportJSON, config.ExportCSV)
+		}
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading AWS config for S3: %v", err)
+	}
+	awsCfg.APIOptions = append(awsCfg.APIOptions, tracecontext.AWS)
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.PathStyle
+	})
+	return &s3Exporter{client: client, cfg: cfg}, nil
+}
+
+// ping - checks that the bucket exists and can be reached with the exporter's credentials.
+func (e *s3Exporter) ping(ctx context.Context) error {
+	if _, err := e.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(e.cfg.Bucket)}); err != nil {
+		return fmt.Errorf("Error reaching s3://%v: %v", e.cfg.Bucket, err)
+	}
+	return nil
+}
+
+// key - the object key of the context's tenant's export, in format, taken at the snapshot's time.
+func (e *s3Exporter) key(ctx context.Context, snap datastore.Snapshot, format string) string {
+	key := e.cfg.Prefix
+	if tenant := datastore.Tenant(ctx); tenant != "" {
+		key += tenant + "/"
+	}
+	return key + "products-" + snap.CreatedAt.Format(snapshotTime) + "." + format
+}
+
+// upload - writes the context's tenant's snapshot to the bucket in each format, returning the object keys.
+func (e *s3Exporter) upload(ctx context.Context, snap datastore.Snapshot) ([]string, error) {
+	var keys []string
+	for _, format := range e.cfg.Formats {
+		var body bytes.Buffer
+		var err error
+		switch format {
+		case config.ExportJSON:
+			err = json.NewEncoder(&body).Encode(snap)
+		case config.ExportCSV:
+			err = writeCSV(&body, snap.Products)
+		}
+		if err != nil {
+			return keys, fmt.Errorf("Error writing the %v export: %v", format, err)
+		}
+
+		key := e.key(ctx, snap, format)
+		_, err = e.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(e.cfg.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body.Bytes()),
+			ContentType: aws.String(exportTypes[format]),
+		})
+		if err != nil {
+			return keys, fmt.Errorf("Error uploading s3://%v/%v: %v", e.cfg.Bucket, key, err)
+		}
+		keys = append(keys, key)
+	}
+	log.Printf("Exported %v products to s3://%v as %v", len(snap.Products), e.cfg.Bucket, keys)
+	return keys, nil
+}
+
+// exportList - the objects an export wrote.
+type exportList struct {
+	XMLName xml.Name `json:"-" xml:"export"`
+	Bucket  string   `json:"bucket" xml:"bucket,attr"`
+	Keys    []string `json:"keys" xml:"key"`
+}
+
+/*
+ExportToS3 - export the catalog to the configured S3 bucket now, rather than waiting for the scheduled export.
+Responds with the keys of the objects written.
+*/
+func (a *API) ExportToS3(w http.ResponseWriter, r *http.Request) {
+	if a.Exporter == nil {
+		writeError(w, r, http.StatusConflict, i18n.Errorf("export_not_configured", "No export bucket is configured"))
+		return
+	}
+	snap, err := datastore.TakeSnapshot(datastore.WithFields(r.Context(), nil), a.Store)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	keys, err := a.Exporter.upload(r.Context(), snap)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	respond(w, r, http.StatusCreated, exportList{Bucket: a.Exporter.cfg.Bucket, Keys: keys})
+}
+
+// exportCatalog - the scheduled export of the tenant's catalog.
+func (a *API) exportCatalog(ctx context.Context, payload json.RawMessage) error {
+	snap, err := datastore.TakeSnapshot(datastore.WithFields(ctx, nil), a.Store)
+	if err != nil {
+		return err
+	}
+	_, err = a.Exporter.upload(ctx, snap)
+	return err
+}
@@ -0,0 +1,181 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/currency"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/jobs"
+	"github.com/bamajap/go-basic-api-app/schedule"
+)
+
+// snapshotTime - the timestamp in snapshot file names, as used for admin backups.
+const snapshotTime = "20060102T150405Z"
+
+/*
+newScheduler - schedules the configured maintenance tasks on api's catalog. Each run enqueues a job on api's queue,
+once per tenant for the tasks that work on a catalog, so a failed run is retried (and dead-lettered) like any other
+job. Every instance runs the schedule; with several instances, enable it on only one of them.
+*/
+func newScheduler(cfg config.Config, api *API) (*schedule.Scheduler, error) {
+	loc, err := time.LoadLocation(cfg.Schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schedule timezone %q: %v", cfg.Schedule.Timezone, err)
+	}
+	s := &schedule.Scheduler{Location: loc}
+
+	for task, spec := range cfg.Schedule.Tasks {
+		tenants := cfg.Tenancy.Names()
+		var handler jobs.Handler
+		switch task {
+		case config.TaskPurgeExpired:
+			handler = api.purgeExpired
+		case config.TaskRefreshRates:
+			if converter == nil {
+				return nil, fmt.Errorf("The %v task needs a currency provider", task)
+			}
+			// Rates aren't per tenant.
+			handler, tenants = refreshRates, []string{""}
+		case config.TaskSnapshot:
+			handler = api.snapshotCatalog(cfg.Schedule.SnapshotDir, cfg.Schedule.SnapshotKeep)
+		case config.TaskExportS3:
+			if api.Exporter == nil {
+				return nil, fmt.Errorf("The %v task needs an export bucket", task)
+			}
+			handler = api.exportCatalog
+		default:
+			return nil, fmt.Errorf("Unknown scheduled task %q; use %q, %q, %q or %q", task, config.TaskPurgeExpired, config.TaskRefreshRates, config.TaskSnapshot, config.TaskExportS3)
+		}
+
+		jobType := "schedule." + task
+		api.Jobs.Handle(jobType, handler)
+		enqueue := func(ctx context.Context) {
+			for _, tenant := range tenants {
+				if err := api.Jobs.Enqueue(datastore.WithTenant(ctx, tenant), jobType, nil); err != nil {
+					log.Printf("Scheduled task %v not run: %v", task, err)
+				}
+			}
+		}
+		if err := s.Add(task, spec, enqueue); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// purgeExpired - deletes the tenant's expired Products. Deleting through the API's store keeps the cache and search index in step.
+func (a *API) purgeExpired(ctx context.Context, payload json.RawMessage) error {
+	expired, err := a.Store.ExpiredProducts(ctx)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, p := range expired {
+		if err := a.Store.DeleteProduct(ctx, p); err != nil {
+			// DynamoDB's TTL may have deleted it first.
+			log.Printf("Expired product <%v> could not be purged: %v", p.Id, err)
+			failed++
+		}
+	}
+	if purged := len(expired) - failed; purged > 0 {
+		log.Printf("Purged %v expired products for tenant %q", purged, datastore.Tenant(ctx))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v expired products could not be purged", failed, len(expired))
+	}
+	return nil
+}
+
+// refreshRates - fetches the base currency's exchange rates ahead of their TTL.
+func refreshRates(ctx context.Context, payload json.RawMessage) error {
+	cached, ok := converter.Provider.(*currency.Cached)
+	if !ok {
+		return nil
+	}
+	return cached.Refresh(ctx, converter.Base)
+}
+
+/*
+snapshotCatalog - writes the tenant's catalog to dir as products-[tenant-]<time>.json, in the admin backup format,
+and deletes all but the keep newest of the tenant's snapshots there.
+*/
+func (a *API) snapshotCatalog(dir string, keep int) jobs.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		snap, err := datastore.TakeSnapshot(datastore.WithFields(ctx, nil), a.Store)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("Error creating snapshot directory: %v", err)
+		}
+
+		prefix := "products-"
+		if tenant := datastore.Tenant(ctx); tenant != "" {
+			prefix += tenant + "-"
+		}
+		path := filepath.Join(dir, prefix+snap.CreatedAt.Format(snapshotTime)+".json")
+		// Written under a temporary name first, so a snapshot that's there is always complete.
+		tmp, err := os.CreateTemp(dir, ".snapshot-*")
+		if err != nil {
+			return fmt.Errorf("Error writing snapshot: %v", err)
+		}
+		defer os.Remove(tmp.Name())
+		if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+			tmp.Close()
+			return fmt.Errorf("Error writing snapshot: %v", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return fmt.Errorf("Error writing snapshot: %v", err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return fmt.Errorf("Error writing snapshot: %v", err)
+		}
+		log.Printf("Wrote snapshot %v (%v products)", path, len(snap.Products))
+
+		return pruneSnapshots(dir, prefix, keep)
+	}
+}
+
+// pruneSnapshots - deletes all but the keep newest snapshots in dir with the given prefix.
+func pruneSnapshots(dir, prefix string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Error listing snapshots: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), prefix)
+		stamp, isJSON := strings.CutSuffix(stamp, ".json")
+		// Another tenant's prefix can start with this one, but its remainder isn't just a timestamp.
+		if _, err := time.Parse(snapshotTime, stamp); ok && isJSON && err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	// The snapshot just written is always kept.
+	keep = max(keep, 1)
+	if len(names) <= keep {
+		return nil
+	}
+	// The timestamps sort in time order.
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,261 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package schedule runs tasks periodically, at times given by cron expressions.
+
+An expression is either the usual five fields - minute (0-59), hour (0-23), day of month (1-31), month (1-12) and
+day of week (0-6, Sunday being 0 or 7) - each "*", a value, a range "a-b", a list "a,b" or any of those with a
+step such as "0-59/15"; or one of the shorthands @hourly, @daily (or @midnight), @weekly, @monthly, @yearly (or
+@annually) and "@every <duration>", e.g. "@every 90m". As with cron, when both the day of month and the day of week
+are restricted, a day matching either one is enough.
+*/
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Schedule - when a task runs. Next returns the first run time after t.
+*/
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// every - a fixed interval, from "@every".
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cron - a five-field expression; each field is a bit set of the values it allows.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// domStar / dowStar - whether the day fields are "*"; only restricted day fields are combined with "or".
+	domStar, dowStar bool
+}
+
+// field - the range of one cron field.
+type field struct {
+	name     string
+	min, max int
+}
+
+var (
+	minutes = field{"minute", 0, 59}
+	hours   = field{"hour", 0, 23}
+	doms    = field{"day of month", 1, 31}
+	months  = field{"month", 1, 12}
+	dows    = field{"day of week", 0, 7}
+)
+
+// shorthands - the @ forms and the expressions they stand for.
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse - the schedule for a cron expression or shorthand.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("Invalid schedule %q; @every needs a duration of at least 1s, e.g. \"@every 10m\"", spec)
+		}
+		return every(d), nil
+	}
+	if expanded, ok := shorthands[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid schedule %q; expected five fields (minute hour day-of-month month day-of-week)", spec)
+	}
+	var c cron
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field field
+	}{{&c.minute, minutes}, {&c.hour, hours}, {&c.dom, doms}, {&c.month, months}, {&c.dow, dows}} {
+		if *f.bits, err = parseField(fields[i], f.field); err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q: %v", spec, err)
+		}
+	}
+	// Sunday may be written as 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar, c.dowStar = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseField - the values a comma-separated list of "*", "n", "a-b" and "x/step" terms allows.
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, term := range strings.Split(s, ",") {
+		rng, stepText, hasStep := strings.Cut(term, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("Invalid %v step %q", f.name, stepText)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = value(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = value(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("Invalid %v range %q", f.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = value(rng, f); err != nil {
+				return 0, err
+			}
+			// "5/15" means from 5 to the end in steps of 15; a lone "5" is just 5.
+			if hasStep {
+				hi = f.max
+			} else {
+				hi = lo
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value - a single number within the field's range.
+func value(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("Invalid %v %q; must be from %v to %v", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
+
+// day - whether the expression allows t's date.
+func (c cron) day(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+/*
+Next - the first matching minute after t, in t's location. It skips forward a month, day or hour at a time when
+that part of the time can't match. An expression that can never match (e.g. "0 0 31 2 *") gives the zero Time.
+*/
+func (c cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		loc := t.Location()
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Task - a named piece of work run on a Schedule.
+type Task struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context)
+}
+
+/*
+Scheduler - runs Tasks at their scheduled times, in Location. A run that's still going when the next is due delays
+it rather than overlapping it.
+*/
+type Scheduler struct {
+	Location *time.Location
+	tasks    []Task
+}
+
+// Add - schedules run by the cron expression spec.
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context)) error {
+	sched, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("Task %v: %v", name, err)
+	}
+	s.tasks = append(s.tasks, Task{Name: name, Schedule: sched, Run: run})
+	return nil
+}
+
+// Start - starts running the tasks; they stop when ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, task := range s.tasks {
+		go s.loop(ctx, task, loc)
+	}
+}
+
+// loop - waits for each of the task's run times in turn and runs it.
+func (s *Scheduler) loop(ctx context.Context, task Task, loc *time.Location) {
+	for {
+		next := task.Schedule.Next(time.Now().In(loc))
+		if next.IsZero() {
+			log.Printf("Scheduled task %v will never run again", task.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			task.Run(ctx)
+		}
+	}
+}
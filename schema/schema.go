@@ -0,0 +1,226 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package schema validates JSON documents against JSON Schema (draft 2020-12), reporting each violation with the RFC
+6901 JSON Pointer of the value at fault.
+
+Only the validation keywords the API's bodies need are implemented: type, enum, const, the numeric, string, array
+and object bounds, pattern, format "date-time", properties / patternProperties / additionalProperties, required,
+items, allOf / anyOf / oneOf / not, and $ref to "#" or a "#/..." pointer within the same document. Annotations and
+any other keyword are ignored, as the specification says unknown keywords must be.
+*/
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+/*
+Schema - a parsed JSON Schema document.
+*/
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Violation - one way a document fails its schema: the JSON Pointer of the value ("" for the whole document) and why.
+type Violation struct {
+	Pointer string `json:"pointer" xml:"pointer"`
+	Detail  string `json:"detail" xml:"detail"`
+}
+
+/*
+Error - the violations found in a document. Validation carries on past the first one, so a client can fix them all
+at once.
+*/
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	details := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		pointer := v.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		details[i] = pointer + ": " + v.Detail
+	}
+	return "The request body doesn't match its schema: " + strings.Join(details, "; ")
+}
+
+// ErrorCode - identifies schema violations in problem bodies.
+func (e *Error) ErrorCode() string {
+	return "schema_violation"
+}
+
+// Load - reads and parses the schema in a file.
+func Load(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading schema %v: %v", path, err)
+	}
+	s, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema %v: %v", path, err)
+	}
+	return s, nil
+}
+
+/*
+Parse - reads a schema document. Every $ref and pattern is checked up front, so a schema that parses can't fail
+part-way through validating a request.
+*/
+func Parse(b []byte) (*Schema, error) {
+	var root interface{}
+	if err := decode(b, &root); err != nil {
+		return nil, err
+	}
+	s := &Schema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.check(root, ""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MustParse - Parse for schemas built into the app, which are known to be valid; it panics if one isn't.
+func MustParse(doc string) *Schema {
+	s, err := Parse([]byte(doc))
+	if err != nil {
+		panic("schema: " + err.Error())
+	}
+	return s
+}
+
+// check - makes sure a schema (at the given pointer) is an object or boolean, with resolvable refs and valid patterns.
+func (s *Schema) check(node interface{}, at string) error {
+	switch n := node.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		if ref, ok := n["$ref"]; ok {
+			ref, ok := ref.(string)
+			if !ok {
+				return fmt.Errorf("$ref at %q must be a string", at)
+			}
+			if _, err := s.resolve(ref); err != nil {
+				return err
+			}
+		}
+		if p, ok := n["pattern"]; ok {
+			if err := s.compile(p, at); err != nil {
+				return err
+			}
+		}
+		if props, ok := n["patternProperties"].(map[string]interface{}); ok {
+			for p := range props {
+				if err := s.compile(p, at+"/patternProperties"); err != nil {
+					return err
+				}
+			}
+		}
+		for key, v := range n {
+			switch key {
+			case "properties", "patternProperties", "$defs", "definitions":
+				children, ok := v.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%v at %q must be an object", key, at)
+				}
+				for name, child := range children {
+					if err := s.check(child, at+"/"+key+"/"+escape(name)); err != nil {
+						return err
+					}
+				}
+			case "allOf", "anyOf", "oneOf":
+				children, ok := v.([]interface{})
+				if !ok || len(children) == 0 {
+					return fmt.Errorf("%v at %q must be a non-empty array", key, at)
+				}
+				for i, child := range children {
+					if err := s.check(child, fmt.Sprintf("%v/%v/%v", at, key, i)); err != nil {
+						return err
+					}
+				}
+			case "items", "additionalProperties", "not":
+				if err := s.check(v, at+"/"+key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("The schema at %q must be an object or a boolean", at)
+}
+
+// compile - compiles a pattern (ECMA-262 patterns are treated as Go regular expressions, which cover the usual cases).
+func (s *Schema) compile(pattern interface{}, at string) error {
+	p, ok := pattern.(string)
+	if !ok {
+		return fmt.Errorf("pattern at %q must be a string", at)
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return fmt.Errorf("Invalid pattern %q at %q: %v", p, at, err)
+	}
+	s.patterns[p] = re
+	return nil
+}
+
+// resolve - the schema a $ref points to; only references within the document ("#" or "#/...") are supported.
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("Unsupported $ref %q; only references within the schema (\"#/...\") are allowed", ref)
+	}
+	node := s.root
+	for _, token := range strings.Split(ref[1:], "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Unresolvable $ref %q", ref)
+		}
+		if node, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("Unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+/*
+Validate - checks a JSON document against the schema. It returns a *Error listing the violations, or the syntax
+error if the document isn't JSON at all.
+*/
+func (s *Schema) Validate(doc []byte) error {
+	var v interface{}
+	if err := decode(doc, &v); err != nil {
+		return err
+	}
+	if violations := s.validate(s.root, v, "", 0); len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// decode - unmarshals JSON, keeping numbers as json.Number so that integers of any size compare exactly.
+func decode(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("Unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// escape - a property name as a JSON Pointer reference token.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,340 @@
+/*
+Author: Jason Payne
+*/
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDepth - how deeply $refs may recurse before a schema is taken to be looping.
+const maxDepth = 64
+
+// validate - the violations of node by the value v at pointer.
+func (s *Schema) validate(node, v interface{}, pointer string, depth int) []Violation {
+	fail := func(format string, args ...interface{}) []Violation {
+		return []Violation{{Pointer: pointer, Detail: fmt.Sprintf(format, args...)}}
+	}
+	if depth > maxDepth {
+		return fail("The schema nests too deeply to validate")
+	}
+
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		if node == false {
+			return fail("No value is allowed here")
+		}
+		return nil
+	}
+
+	var violations []Violation
+	if ref, ok := n["$ref"].(string); ok {
+		target, _ := s.resolve(ref)
+		violations = append(violations, s.validate(target, v, pointer, depth+1)...)
+	}
+
+	if t, ok := n["type"]; ok && !hasType(v, t) {
+		return append(violations, fail("Must be %v, not %v", typeNames(t), typeOf(v))...)
+	}
+	if c, ok := n["const"]; ok && !equal(v, c) {
+		violations = append(violations, fail("Must be %v", literal(c))...)
+	}
+	if e, ok := n["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range e {
+			found = found || equal(v, option)
+		}
+		if !found {
+			options := make([]string, len(e))
+			for i, option := range e {
+				options[i] = literal(option)
+			}
+			violations = append(violations, fail("Must be one of %v", strings.Join(options, ", "))...)
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		violations = append(violations, s.validateNumber(n, v, fail)...)
+	case string:
+		violations = append(violations, s.validateString(n, v, fail)...)
+	case []interface{}:
+		violations = append(violations, s.validateArray(n, v, pointer, depth, fail)...)
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(n, v, pointer, depth, fail)...)
+	}
+
+	if all, ok := n["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			violations = append(violations, s.validate(sub, v, pointer, depth+1)...)
+		}
+	}
+	if some, ok := n["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range some {
+			matched = matched || len(s.validate(sub, v, pointer, depth+1)) == 0
+		}
+		if !matched {
+			violations = append(violations, fail("Must match at least one of the anyOf schemas")...)
+		}
+	}
+	if one, ok := n["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range one {
+			if len(s.validate(sub, v, pointer, depth+1)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			violations = append(violations, fail("Must match exactly one of the oneOf schemas, not %v", matched)...)
+		}
+	}
+	if not, ok := n["not"]; ok && len(s.validate(not, v, pointer, depth+1)) == 0 {
+		violations = append(violations, fail("Must not match the schema in not")...)
+	}
+	return violations
+}
+
+// validateNumber - the numeric bounds.
+func (s *Schema) validateNumber(n map[string]interface{}, v json.Number, fail func(string, ...interface{}) []Violation) []Violation {
+	var violations []Violation
+	x := rat(v)
+	bound := func(keyword, relation string, ok func(cmp int) bool) {
+		if b, isNumber := n[keyword].(json.Number); isNumber && !ok(x.Cmp(rat(b))) {
+			violations = append(violations, fail("Must be %v %v", relation, b)...)
+		}
+	}
+	bound("minimum", ">=", func(cmp int) bool { return cmp >= 0 })
+	bound("maximum", "<=", func(cmp int) bool { return cmp <= 0 })
+	bound("exclusiveMinimum", ">", func(cmp int) bool { return cmp > 0 })
+	bound("exclusiveMaximum", "<", func(cmp int) bool { return cmp < 0 })
+	if m, ok := n["multipleOf"].(json.Number); ok && rat(m).Sign() > 0 {
+		if !new(big.Rat).Quo(x, rat(m)).IsInt() {
+			violations = append(violations, fail("Must be a multiple of %v", m)...)
+		}
+	}
+	return violations
+}
+
+// validateString - the string length, pattern and format.
+func (s *Schema) validateString(n map[string]interface{}, v string, fail func(string, ...interface{}) []Violation) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(v)
+	if min, ok := count(n["minLength"]); ok && length < min {
+		violations = append(violations, fail("Must be at least %v characters long", min)...)
+	}
+	if max, ok := count(n["maxLength"]); ok && length > max {
+		violations = append(violations, fail("Must be at most %v characters long", max)...)
+	}
+	if p, ok := n["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+		violations = append(violations, fail("Must match the pattern %q", p)...)
+	}
+	if f, _ := n["format"].(string); f == "date-time" {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			violations = append(violations, fail("Must be an RFC 3339 date-time")...)
+		}
+	}
+	return violations
+}
+
+// validateArray - the array bounds, uniqueness, and each item.
+func (s *Schema) validateArray(n map[string]interface{}, v []interface{}, pointer string, depth int, fail func(string, ...interface{}) []Violation) []Violation {
+	var violations []Violation
+	if min, ok := count(n["minItems"]); ok && len(v) < min {
+		violations = append(violations, fail("Must have at least %v items", min)...)
+	}
+	if max, ok := count(n["maxItems"]); ok && len(v) > max {
+		violations = append(violations, fail("Must have at most %v items", max)...)
+	}
+	if unique, _ := n["uniqueItems"].(bool); unique {
+	duplicates:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if equal(v[i], v[j]) {
+					violations = append(violations, fail("Items %v and %v are the same; items must be unique", j, i)...)
+					break duplicates
+				}
+			}
+		}
+	}
+	if items, ok := n["items"]; ok {
+		for i, item := range v {
+			violations = append(violations, s.validate(items, item, fmt.Sprintf("%v/%v", pointer, i), depth+1)...)
+		}
+	}
+	return violations
+}
+
+// validateObject - the required and bounded properties, and each property's value.
+func (s *Schema) validateObject(n map[string]interface{}, v map[string]interface{}, pointer string, depth int, fail func(string, ...interface{}) []Violation) []Violation {
+	var violations []Violation
+	if required, ok := n["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := v[name]; !present {
+					violations = append(violations, Violation{Pointer: pointer + "/" + escape(name), Detail: "Is required"})
+				}
+			}
+		}
+	}
+	if min, ok := count(n["minProperties"]); ok && len(v) < min {
+		violations = append(violations, fail("Must have at least %v properties", min)...)
+	}
+	if max, ok := count(n["maxProperties"]); ok && len(v) > max {
+		violations = append(violations, fail("Must have at most %v properties", max)...)
+	}
+
+	// Properties are visited in name order, so that violations are always reported in the same order.
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	properties, _ := n["properties"].(map[string]interface{})
+	patterns, _ := n["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := n["additionalProperties"]
+	for _, name := range names {
+		at := pointer + "/" + escape(name)
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			violations = append(violations, s.validate(sub, v[name], at, depth+1)...)
+		}
+		for p, sub := range patterns {
+			if s.patterns[p].MatchString(name) {
+				matched = true
+				violations = append(violations, s.validate(sub, v[name], at, depth+1)...)
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if additional == false {
+			violations = append(violations, Violation{Pointer: at, Detail: "Is not an allowed property"})
+			continue
+		}
+		violations = append(violations, s.validate(additional, v[name], at, depth+1)...)
+	}
+	return violations
+}
+
+// hasType - whether v is of the type, or one of the types, named by t.
+func hasType(v, t interface{}) bool {
+	if types, ok := t.([]interface{}); ok {
+		for _, t := range types {
+			if hasType(v, t) {
+				return true
+			}
+		}
+		return false
+	}
+	name, _ := t.(string)
+	actual := typeOf(v)
+	return name == actual || (name == "number" && actual == "integer")
+}
+
+// typeOf - the JSON Schema type name of a decoded value; numbers without a fractional part are integers.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if rat(v).IsInt() {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// typeNames - the type keyword's value, for messages, e.g. "string" or "string or null".
+func typeNames(t interface{}) string {
+	types, ok := t.([]interface{})
+	if !ok {
+		return fmt.Sprint(t)
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = fmt.Sprint(t)
+	}
+	return strings.Join(names, " or ")
+}
+
+// equal - JSON equality: numbers compare by value (so 1 equals 1.0), objects regardless of property order.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		return ok && rat(a).Cmp(rat(b)) == 0
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, v := range a {
+			if other, ok := b[name]; !ok || !equal(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// literal - a value as JSON, for messages.
+func literal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+/*
+rat - a JSON number as an exact rational. Numbers with huge exponents (which would take huge amounts of memory to
+hold exactly) are rounded to a float64 instead, which is plenty to compare them against any sensible schema.
+*/
+func rat(n json.Number) *big.Rat {
+	if i := strings.IndexAny(string(n), "eE"); i >= 0 && len(strings.TrimLeft(string(n)[i+1:], "+-0")) > 3 {
+		f, _ := n.Float64()
+		if r := new(big.Rat).SetFloat64(f); r != nil {
+			return r
+		}
+		return new(big.Rat)
+	}
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// count - a non-negative integer keyword value, such as minLength.
+func count(v interface{}) (int, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := n.Int64()
+	return int(i), err == nil && i >= 0
+}
@@ -0,0 +1,108 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// bodySchemas - the schemas request bodies must match, keyed by method and route (see routeKey). Set at start-up.
+var bodySchemas map[string]*schema.Schema
+
+/*
+loadSchemas - reads the configured schema files. A key that doesn't name one of the router's routes is an error,
+since its schema would otherwise silently never apply.
+*/
+func loadSchemas(files map[string]string, router *mux.Router) (map[string]*schema.Schema, error) {
+	routes := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			routes[method+" "+routeKey(template)] = true
+		}
+		return nil
+	})
+
+	schemas := map[string]*schema.Schema{}
+	for key, file := range files {
+		if !routes[key] {
+			return nil, fmt.Errorf("No route matches schema key %q; use a method and path such as \"PUT %v/product/{id}\"", key, currentVersion)
+		}
+		s, err := schema.Load(file)
+		if err != nil {
+			return nil, err
+		}
+		schemas[key] = s
+	}
+	return schemas, nil
+}
+
+/*
+routeKey - a route's path template without the patterns of its variables, e.g. "/v1/product/{id}" for
+"/v1/product/{id:[0-9]+}".
+*/
+func routeKey(template string) string {
+	var key strings.Builder
+	depth, pattern := 0, false
+	for _, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				pattern = false
+			}
+		case ':':
+			pattern = pattern || depth == 1
+		}
+		if !pattern {
+			key.WriteRune(c)
+		}
+	}
+	return key.String()
+}
+
+/*
+validateSchema - checks the body of a request to an endpoint with a schema before its handler decodes it, responding
+400 with every violation if it doesn't match. Only JSON bodies are checked; XML, protobuf and JSON:API documents
+have a different shape, and are left to the handler's own validation.
+*/
+func validateSchema(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s *schema.Schema
+		if route := mux.CurrentRoute(r); route != nil {
+			template, _ := route.GetPathTemplate()
+			s = bodySchemas[r.Method+" "+routeKey(template)]
+		}
+		if format, err := bodyFormat(r); s == nil || err != nil || format != mediaJSON {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("Error reading the request body: %v", err))
+			return
+		}
+		if err := s.Validate(body); err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
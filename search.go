@@ -0,0 +1,154 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/jobs"
+	"github.com/bamajap/go-basic-api-app/search"
+)
+
+// defaultSearchLimit - how many hits a search returns when no ?limit= is given.
+const defaultSearchLimit = 20
+
+/*
+newSearchIndex - the search index for the config, or nil if searches read the datastore. Index updates are queued on
+queue. Each tenant's index is created if it doesn't exist yet; a cluster that can't be reached is logged rather than
+stopping the app, since the datastore doesn't depend on it.
+*/
+func newSearchIndex(cfg config.Config, store datastore.Datastore, queue *jobs.Queue) (*search.Indexed, error) {
+	switch cfg.Search.Provider {
+	case "":
+		return nil, nil
+	case config.SearchOpenSearch:
+	default:
+		return nil, fmt.Errorf("Unknown search provider %q", cfg.Search.Provider)
+	}
+
+	index := search.NewIndexed(store, &search.OpenSearch{
+		URL:      cfg.Search.URL,
+		Index:    cfg.Search.Index,
+		Username: cfg.Search.Username,
+		Password: cfg.Search.Password,
+		Client:   &http.Client{Timeout: cfg.Search.Timeout.Duration},
+	}, queue)
+	for _, tenant := range cfg.Tenancy.Names() {
+		if err := index.Index.EnsureIndex(datastore.WithTenant(context.Background(), tenant)); err != nil {
+			log.Printf("Search index for tenant %q is unavailable: %v", tenant, err)
+		}
+	}
+	return index, nil
+}
+
+// searchResults - a page of search hits, best match first, with facet counts over every match.
+type searchResults struct {
+	XMLName  xml.Name          `json:"-" xml:"search"`
+	Total    int               `json:"total" xml:"total,attr"`
+	Products []productResource `json:"products" xml:"product"`
+	Facets   search.Facets     `json:"facets" xml:"facets"`
+}
+
+// priceParam - an optional non-negative price from the query string.
+func priceParam(r *http.Request, name string) (*datastore.Money, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	price, err := datastore.ParseMoney(v)
+	if err != nil || price < 0 {
+		return nil, fmt.Errorf("Invalid %v %q", name, v)
+	}
+	return &price, nil
+}
+
+/*
+SearchProducts - full-text search of the catalog by name (or exact barcode) with ?q=, optionally bounded by
+?min_price= and ?max_price=, with price and rating facets. Prices are filtered in the base currency.
+*/
+func (a *API) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	fields, err := requestedFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	query := search.Query{Text: r.URL.Query().Get("q"), Limit: defaultSearchLimit}
+	if query.MinPrice, err = priceParam(r, "min_price"); err == nil {
+		query.MaxPrice, err = priceParam(r, "max_price")
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_limit", "Invalid limit %q; use 1 to %v", v, maxPageSize))
+			return
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_offset", "Invalid offset %q", v))
+			return
+		}
+	}
+
+	result, err := a.Search.Search(r.Context(), query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if a.Index != nil {
+			status = http.StatusBadGateway
+		}
+		writeError(w, r, status, err)
+		return
+	}
+
+	products := make([]datastore.Product, len(result.Hits))
+	for i, hit := range result.Hits {
+		products[i] = hit.Product
+	}
+	if status, err := productsInCurrency(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	if status, err := localizeProducts(w, r, products); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+
+	body := searchResults{Total: result.Total, Products: make([]productResource, len(products)), Facets: result.Facets}
+	for i, p := range products {
+		body.Products[i] = productResource{Product: p, Links: productLinks(p.Id)}
+	}
+	respond(w, r, http.StatusOK, sparse(body, fields))
+}
+
+/*
+ReindexSearch - write every Product into the search index, e.g. after enabling search on an existing catalog or
+to repair an index that missed writes.
+*/
+func (a *API) ReindexSearch(w http.ResponseWriter, r *http.Request) {
+	if a.Index == nil {
+		writeError(w, r, http.StatusConflict, i18n.Errorf("search_index_not_configured", "No search index is configured"))
+		return
+	}
+	count, err := a.Index.Reindex(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	respond(w, r, http.StatusOK, struct {
+		XMLName xml.Name `json:"-" xml:"reindex"`
+		Indexed int      `json:"indexed" xml:"indexed"`
+	}{Indexed: count})
+}
@@ -0,0 +1,172 @@
+/*
+Author: Jason Payne
+*/
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/jobs"
+)
+
+// Job types for keeping the index in step with the datastore.
+const (
+	JobIndex  = "search.index"
+	JobDelete = "search.delete"
+	JobClear  = "search.clear"
+)
+
+/*
+Indexed - a Datastore that mirrors every Product write into a search index once the write has succeeded. Index
+updates are background jobs, so they don't slow the request down and are retried if the cluster is unavailable.
+The datastore stays the source of truth: a job that can't be queued is logged rather than failing the request,
+and Reindex repairs any drift.
+*/
+type Indexed struct {
+	datastore.Datastore
+	Index *OpenSearch
+	jobs  *jobs.Queue
+}
+
+// NewIndexed - wraps store so that its Product writes are mirrored into index, registering the jobs that do so.
+func NewIndexed(store datastore.Datastore, index *OpenSearch, queue *jobs.Queue) *Indexed {
+	s := &Indexed{Datastore: store, Index: index, jobs: queue}
+	queue.Handle(JobIndex, s.indexJob)
+	queue.Handle(JobDelete, s.deleteJob)
+	queue.Handle(JobClear, s.clearJob)
+	return s
+}
+
+// refresh - queues the Products with the given IDs to be (re)indexed.
+func (s *Indexed) refresh(ctx context.Context, ids ...string) {
+	if err := s.jobs.Enqueue(ctx, JobIndex, ids); err != nil {
+		log.Printf("Search index not updated for products %v: %v", ids, err)
+	}
+}
+
+// indexJob - re-reads Products, so the index gets what was stored (e.g. with the rating kept), and indexes them.
+// Products deleted since the job was queued are skipped.
+func (s *Indexed) indexJob(ctx context.Context, payload json.RawMessage) error {
+	var ids []string
+	if err := json.Unmarshal(payload, &ids); err != nil {
+		return err
+	}
+	products, _, err := s.Datastore.GetProducts(datastore.WithFields(ctx, nil), ids)
+	if err != nil {
+		return err
+	}
+	return s.Index.Put(ctx, products...)
+}
+
+// deleteJob - removes a deleted Product from the index.
+func (s *Indexed) deleteJob(ctx context.Context, payload json.RawMessage) error {
+	var id string
+	if err := json.Unmarshal(payload, &id); err != nil {
+		return err
+	}
+	return s.Index.Delete(ctx, id)
+}
+
+// clearJob - empties the index after the catalog was truncated.
+func (s *Indexed) clearJob(ctx context.Context, payload json.RawMessage) error {
+	return s.Index.Clear(ctx)
+}
+
+func (s *Indexed) AddProduct(ctx context.Context, p datastore.Product) error {
+	if err := s.Datastore.AddProduct(ctx, p); err != nil {
+		return err
+	}
+	s.refresh(ctx, p.Id)
+	return nil
+}
+
+func (s *Indexed) AddProducts(ctx context.Context, products []datastore.Product) error {
+	if err := s.Datastore.AddProducts(ctx, products); err != nil {
+		return err
+	}
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.Id
+	}
+	s.refresh(ctx, ids...)
+	return nil
+}
+
+func (s *Indexed) UpdateProduct(ctx context.Context, p datastore.Product) (datastore.Product, error) {
+	stored, err := s.Datastore.UpdateProduct(ctx, p)
+	if err != nil {
+		return stored, err
+	}
+	s.refresh(ctx, p.Id)
+	return stored, nil
+}
+
+func (s *Indexed) DeleteProduct(ctx context.Context, p datastore.Product) error {
+	if err := s.Datastore.DeleteProduct(ctx, p); err != nil {
+		return err
+	}
+	if err := s.jobs.Enqueue(ctx, JobDelete, p.Id); err != nil {
+		log.Printf("Search index not updated for deleted product <%v>: %v", p.Id, err)
+	}
+	return nil
+}
+
+func (s *Indexed) Truncate(ctx context.Context) error {
+	if err := s.Datastore.Truncate(ctx); err != nil {
+		return err
+	}
+	if err := s.jobs.Enqueue(ctx, JobClear, nil); err != nil {
+		log.Printf("Search index not cleared after truncating the catalog: %v", err)
+	}
+	return nil
+}
+
+// AddReview / UpdateReview / DeleteReview - these change the Product's rating, which the rating facet counts.
+func (s *Indexed) AddReview(ctx context.Context, r datastore.Review) error {
+	if err := s.Datastore.AddReview(ctx, r); err != nil {
+		return err
+	}
+	s.refresh(ctx, r.ProductId)
+	return nil
+}
+
+func (s *Indexed) UpdateReview(ctx context.Context, old, r datastore.Review) error {
+	if err := s.Datastore.UpdateReview(ctx, old, r); err != nil {
+		return err
+	}
+	s.refresh(ctx, r.ProductId)
+	return nil
+}
+
+func (s *Indexed) DeleteReview(ctx context.Context, r datastore.Review) error {
+	if err := s.Datastore.DeleteReview(ctx, r); err != nil {
+		return err
+	}
+	s.refresh(ctx, r.ProductId)
+	return nil
+}
+
+/*
+Reindex - creates the context's tenant's index if needed and writes every live Product into it, in batches. Products
+deleted without going through Indexed (e.g. by TTL) stay in the index, but searches filter them out by expires_at.
+It returns how many Products were indexed.
+*/
+func (s *Indexed) Reindex(ctx context.Context) (int, error) {
+	if err := s.Index.EnsureIndex(ctx); err != nil {
+		return 0, err
+	}
+	products, err := s.Datastore.GetAll(datastore.WithFields(ctx, nil))
+	if err != nil {
+		return 0, err
+	}
+	const batch = 500
+	for start := 0; start < len(products); start += batch {
+		if err := s.Index.Put(ctx, products[start:min(start+batch, len(products))]...); err != nil {
+			return start, err
+		}
+	}
+	return len(products), nil
+}
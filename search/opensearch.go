@@ -0,0 +1,349 @@
+/*
+Author: Jason Payne
+*/
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/tracecontext"
+)
+
+/*
+OpenSearch - a client for the index Products are mirrored into, using the REST API that OpenSearch and
+Elasticsearch share. Each tenant has its own index: Index for the default tenant, or prefixed with the tenant's
+name, e.g. "acme.products".
+*/
+type OpenSearch struct {
+	URL      string
+	Index    string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// document - a Product as it's indexed. Rating is flattened so it can be filtered and aggregated on.
+type document struct {
+	Id            string     `json:"id"`
+	Name          string     `json:"name"`
+	Price         float64    `json:"price"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Barcode       string     `json:"barcode,omitempty"`
+	SupplierId    string     `json:"supplier_id,omitempty"`
+	CategoryId    string     `json:"category_id,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	RatingAverage *float64   `json:"rating_average,omitempty"`
+	RatingCount   int        `json:"rating_count,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+
+	NameTranslations        datastore.Translations `json:"name_translations,omitempty"`
+	Description             string                 `json:"description,omitempty"`
+	DescriptionTranslations datastore.Translations `json:"description_translations,omitempty"`
+}
+
+func toDocument(p datastore.Product) document {
+	d := document{Id: p.Id, Name: p.Name, Price: p.Price.Float64(), ExpiresAt: p.ExpiresAt, Barcode: p.Barcode, SupplierId: p.SupplierId, UpdatedAt: p.UpdatedAt,
+		CategoryId: p.CategoryId, Tags: p.Tags, NameTranslations: p.NameTranslations, Description: p.Description, DescriptionTranslations: p.DescriptionTranslations}
+	if p.Rating != nil {
+		d.RatingAverage, d.RatingCount = &p.Rating.Average, p.Rating.Count
+	}
+	return d
+}
+
+func (d document) product() datastore.Product {
+	p := datastore.Product{Id: d.Id, Name: d.Name, Price: datastore.MoneyFromFloat(d.Price), ExpiresAt: d.ExpiresAt, Barcode: d.Barcode, SupplierId: d.SupplierId, UpdatedAt: d.UpdatedAt,
+		CategoryId: d.CategoryId, Tags: d.Tags, NameTranslations: d.NameTranslations, Description: d.Description, DescriptionTranslations: d.DescriptionTranslations}
+	if d.RatingAverage != nil {
+		p.Rating = &datastore.Rating{Average: *d.RatingAverage, Count: d.RatingCount}
+	}
+	return p
+}
+
+// mappings - the index's field types; names and descriptions are analyzed for full-text search, the rest are exact
+// values.
+var mappings = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"id":             map[string]string{"type": "keyword"},
+		"name":           map[string]string{"type": "text"},
+		"price":          map[string]string{"type": "double"},
+		"expires_at":     map[string]string{"type": "date"},
+		"barcode":        map[string]string{"type": "keyword"},
+		"supplier_id":    map[string]string{"type": "keyword"},
+		"category_id":    map[string]string{"type": "keyword"},
+		"tags":           map[string]string{"type": "keyword"},
+		"rating_average": map[string]string{"type": "double"},
+		"rating_count":   map[string]string{"type": "integer"},
+		"updated_at":     map[string]string{"type": "date"},
+		"description":    map[string]string{"type": "text"},
+		// Translations are kept with the document but not searched, so each locale doesn't add fields to the index.
+		"name_translations":        map[string]interface{}{"type": "object", "enabled": false},
+		"description_translations": map[string]interface{}{"type": "object", "enabled": false},
+	},
+}
+
+// index - the context's tenant's index.
+func (o *OpenSearch) index(ctx context.Context) string {
+	if tenant := datastore.Tenant(ctx); tenant != "" {
+		return tenant + "." + o.Index
+	}
+	return o.Index
+}
+
+// errNotFound - the cluster responded 404.
+var errNotFound = errors.New("Not found")
+
+/*
+do - sends a request to the cluster and decodes the JSON response into out (if it isn't nil). body is sent as JSON,
+unless it's already []byte (e.g. the newline-delimited JSON of a bulk request).
+*/
+func (o *OpenSearch) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader, contentType = bytes.NewReader(b), "application/x-ndjson"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(o.URL, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("Invalid search URL: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if o.Username != "" {
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+	tracecontext.Inject(ctx, req.Header)
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Search request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Search request %v %v failed: %v %s", method, path, resp.Status, detail)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Error reading the search response: %v", err)
+	}
+	return nil
+}
+
+// EnsureIndex - creates the context's tenant's index, if it doesn't exist.
+func (o *OpenSearch) EnsureIndex(ctx context.Context) error {
+	name := o.index(ctx)
+	err := o.do(ctx, http.MethodHead, "/"+url.PathEscape(name), nil, nil)
+	if err != errNotFound {
+		return err
+	}
+	fmt.Printf("Creating search index '%v'...\n", name)
+	return o.do(ctx, http.MethodPut, "/"+url.PathEscape(name), map[string]interface{}{"mappings": mappings}, nil)
+}
+
+// Ping - checks that the cluster can be reached and has the context's tenant's index.
+func (o *OpenSearch) Ping(ctx context.Context) error {
+	name := o.index(ctx)
+	err := o.do(ctx, http.MethodHead, "/"+url.PathEscape(name), nil, nil)
+	if err == errNotFound {
+		return fmt.Errorf("Search index '%v' doesn't exist", name)
+	}
+	return err
+}
+
+// Put - adds or replaces Products in the context's tenant's index, in a single bulk request.
+func (o *OpenSearch) Put(ctx context.Context, products ...datastore.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, p := range products {
+		action := map[string]interface{}{"index": map[string]string{"_index": o.index(ctx), "_id": p.Id}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(toDocument(p)); err != nil {
+			return err
+		}
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Id    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := o.do(ctx, http.MethodPost, "/_bulk", body.Bytes(), &result); err != nil {
+		return err
+	}
+	if result.Errors {
+		for _, item := range result.Items {
+			for _, r := range item {
+				if len(r.Error) > 0 {
+					return fmt.Errorf("Indexing product <%v> failed: %s", r.Id, r.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Delete - removes a Product from the context's tenant's index; it's not an error if it wasn't there.
+func (o *OpenSearch) Delete(ctx context.Context, id string) error {
+	err := o.do(ctx, http.MethodDelete, "/"+url.PathEscape(o.index(ctx))+"/_doc/"+url.PathEscape(id), nil, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+// Clear - removes every Product from the context's tenant's index, keeping the index itself.
+func (o *OpenSearch) Clear(ctx context.Context) error {
+	query := map[string]interface{}{"query": map[string]interface{}{"match_all": map[string]interface{}{}}}
+	err := o.do(ctx, http.MethodPost, "/"+url.PathEscape(o.index(ctx))+"/_delete_by_query?conflicts=proceed", query, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+// ranges - a range aggregation over field with the given buckets.
+func ranges(field string, buckets []facetRange) map[string]interface{} {
+	var rs []map[string]interface{}
+	for _, b := range buckets {
+		r := map[string]interface{}{"key": b.key, "from": b.from}
+		if b.to != 0 {
+			r["to"] = b.to
+		}
+		rs = append(rs, r)
+	}
+	return map[string]interface{}{"range": map[string]interface{}{"field": field, "ranges": rs, "keyed": false}}
+}
+
+/*
+Search - full-text search of the context's tenant's index. Names are matched with fuzziness, so small typos still
+match, and ranked by relevance, then price; expired Products are filtered out, since TTL deletes them from the
+datastore without going through Indexed.
+*/
+func (o *OpenSearch) Search(ctx context.Context, q Query) (Result, error) {
+	filters := []interface{}{
+		map[string]interface{}{"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{"bool": map[string]interface{}{"must_not": map[string]interface{}{"exists": map[string]string{"field": "expires_at"}}}},
+				map[string]interface{}{"range": map[string]interface{}{"expires_at": map[string]string{"gt": "now"}}},
+			},
+			"minimum_should_match": 1,
+		}},
+	}
+	if q.MinPrice != nil || q.MaxPrice != nil {
+		price := map[string]interface{}{}
+		if q.MinPrice != nil {
+			price["gte"] = q.MinPrice.Float64()
+		}
+		if q.MaxPrice != nil {
+			price["lte"] = q.MaxPrice.Float64()
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"price": price}})
+	}
+
+	query := map[string]interface{}{"filter": filters}
+	sorting := []interface{}{map[string]string{"price": "desc"}}
+	if text := strings.TrimSpace(q.Text); text != "" {
+		query["should"] = []interface{}{
+			map[string]interface{}{"match": map[string]interface{}{"name": map[string]interface{}{"query": text, "fuzziness": "AUTO"}}},
+			map[string]interface{}{"term": map[string]interface{}{"barcode": map[string]interface{}{"value": text, "boost": 10}}},
+		}
+		query["minimum_should_match"] = 1
+		sorting = append([]interface{}{"_score"}, sorting...)
+	}
+
+	size := q.Limit
+	if size <= 0 {
+		size = 10000
+	}
+	request := map[string]interface{}{
+		"from":             q.Offset,
+		"size":             size,
+		"track_total_hits": true,
+		"query":            map[string]interface{}{"bool": query},
+		"sort":             sorting,
+		"aggs": map[string]interface{}{
+			"price":  ranges("price", priceRanges),
+			"rating": ranges("rating_average", ratingRanges),
+		},
+	}
+
+	type aggregation struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int    `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Score  *float64 `json:"_score"`
+				Source document `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations struct {
+			Price  aggregation `json:"price"`
+			Rating aggregation `json:"rating"`
+		} `json:"aggregations"`
+	}
+	err := o.do(ctx, http.MethodPost, "/"+url.PathEscape(o.index(ctx))+"/_search", request, &response)
+	if err == errNotFound {
+		return Result{}, fmt.Errorf("The search index %v doesn't exist", o.index(ctx))
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Total: response.Hits.Total.Value, Facets: Facets{Price: []Bucket{}, Rating: []Bucket{}}}
+	for _, h := range response.Hits.Hits {
+		hit := Hit{Product: h.Source.product(), Score: 1}
+		if h.Score != nil {
+			hit.Score = *h.Score
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	for _, b := range response.Aggregations.Price.Buckets {
+		result.Facets.Price = append(result.Facets.Price, Bucket{Key: b.Key, Count: b.DocCount})
+	}
+	for _, b := range response.Aggregations.Rating.Buckets {
+		result.Facets.Rating = append(result.Facets.Rating, Bucket{Key: b.Key, Count: b.DocCount})
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package search serves product searches: full-text relevance over names (and exact barcodes), price filters and
+facet counts.
+
+Searches come from an OpenSearch (or Elasticsearch) index when one is configured, with Indexed mirroring every
+Product write into it; otherwise Datastore answers the same queries by reading the catalog, so the API is the same
+either way.
+*/
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+/*
+Query - a search. Text matches names, tolerating typos, or a barcode exactly; with no Text every live Product
+matches, in price-descending order. Min/MaxPrice, when set, bound the price inclusively.
+*/
+type Query struct {
+	Text     string
+	MinPrice *datastore.Money
+	MaxPrice *datastore.Money
+	Offset   int
+	Limit    int
+}
+
+// Hit - a Product found by a search, and how relevant it is (higher is better; scores only compare within a search).
+type Hit struct {
+	Product datastore.Product
+	Score   float64
+}
+
+// Bucket - one facet value and how many of the matching Products have it.
+type Bucket struct {
+	Key   string `json:"key" xml:"key,attr"`
+	Count int    `json:"count" xml:"count,attr"`
+}
+
+// Facets - counts over every Product the search matched, not just the page returned.
+type Facets struct {
+	Price  []Bucket `json:"price" xml:"price>bucket"`
+	Rating []Bucket `json:"rating" xml:"rating>bucket"`
+}
+
+// Result - a page of hits, best first, with the total number of matches and their facets.
+type Result struct {
+	Total  int
+	Hits   []Hit
+	Facets Facets
+}
+
+// Searcher - something that can answer a search for the context's tenant.
+type Searcher interface {
+	Search(ctx context.Context, q Query) (Result, error)
+}
+
+// facetRange - a facet bucket covering From (inclusive) up to To (exclusive); a zero To means no upper bound.
+type facetRange struct {
+	key      string
+	from, to float64
+}
+
+func (f facetRange) contains(v float64) bool {
+	return v >= f.from && (f.to == 0 || v < f.to)
+}
+
+// priceRanges / ratingRanges - the facet buckets. Rating buckets overlap ("4+" counts are also in "3+").
+var (
+	priceRanges = []facetRange{
+		{"0-5", 0, 5}, {"5-10", 5, 10}, {"10-25", 10, 25}, {"25-50", 25, 50}, {"50+", 50, 0},
+	}
+	ratingRanges = []facetRange{
+		{"4+", 4, 0}, {"3+", 3, 0}, {"2+", 2, 0}, {"1+", 1, 0},
+	}
+)
+
+/*
+Datastore - answers searches by reading the whole catalog, for deployments without a search index. Text is scored
+with datastore.NameScore, so "bananna" still finds "Bananas", and a Product whose barcode is the text scores 1.
+*/
+type Datastore struct {
+	Store datastore.Datastore
+}
+
+func (d Datastore) Search(ctx context.Context, q Query) (Result, error) {
+	// Scoring needs every name, whatever fields the response has.
+	products, err := d.Store.GetAll(datastore.WithFields(ctx, nil))
+	if err != nil {
+		return Result{}, err
+	}
+
+	text := strings.TrimSpace(q.Text)
+	var hits []Hit
+	for _, p := range products {
+		score := 1.0
+		if text != "" {
+			score = datastore.NameScore(text, p.Name)
+			if p.Barcode != "" && p.Barcode == text {
+				score = 1
+			}
+			if score < datastore.MinNameScore {
+				continue
+			}
+		}
+		if (q.MinPrice != nil && p.Price < *q.MinPrice) || (q.MaxPrice != nil && p.Price > *q.MaxPrice) {
+			continue
+		}
+		hits = append(hits, Hit{Product: p, Score: score})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+
+	result := Result{Total: len(hits), Facets: Facets{
+		Price:  make([]Bucket, len(priceRanges)),
+		Rating: make([]Bucket, len(ratingRanges)),
+	}}
+	for i, r := range priceRanges {
+		result.Facets.Price[i].Key = r.key
+	}
+	for i, r := range ratingRanges {
+		result.Facets.Rating[i].Key = r.key
+	}
+	for _, h := range hits {
+		for i, r := range priceRanges {
+			if r.contains(h.Product.Price.Float64()) {
+				result.Facets.Price[i].Count++
+			}
+		}
+		if h.Product.Rating == nil {
+			continue
+		}
+		for i, r := range ratingRanges {
+			if r.contains(h.Product.Rating.Average) {
+				result.Facets.Rating[i].Count++
+			}
+		}
+	}
+
+	start, end := min(q.Offset, len(hits)), len(hits)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(hits))
+	}
+	result.Hits = hits[start:end]
+	return result, nil
+}
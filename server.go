@@ -0,0 +1,182 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsVersions - the minimum TLS versions that can be configured.
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+/*
+newServer - an http.Server for addr with the configured timeouts and limits.
+*/
+func newServer(cfg config.Server, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+/*
+serve - listens on the configured address, over HTTPS when a certificate is configured, and blocks until the
+server fails or stops. With TLS, an optional second listener redirects plain HTTP requests to HTTPS; in autocert mode
+it also answers ACME HTTP-01 challenges (TLS-ALPN-01 challenges are answered on the HTTPS listener either way). The
+API can be served on a Unix socket as well, always over plain HTTP. When
+it's told to stop (see newListeners), it stops accepting connections and gives in-flight requests up to
+shutdown_timeout to finish before returning.
+*/
+func serve(cfg config.Server, handler http.Handler) error {
+	srv := newServer(cfg, cfg.Addr, handler)
+	var redirect http.Handler
+	certFile, keyFile := cfg.TLS.CertFile, cfg.TLS.KeyFile
+
+	if cfg.TLS.Enabled() {
+		minVersion, ok := tlsVersions[cfg.TLS.MinVersion]
+		if !ok {
+			return fmt.Errorf("Unsupported TLS min_version %q", cfg.TLS.MinVersion)
+		}
+		srv.TLSConfig = &tls.Config{MinVersion: minVersion}
+		redirect = redirectToHTTPS(cfg.Addr)
+
+		if ac := cfg.TLS.Autocert; len(ac.Hostnames) > 0 {
+			m := &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(ac.Hostnames...),
+				Cache:      autocert.DirCache(ac.CacheDir),
+				Email:      ac.Email,
+			}
+			srv.TLSConfig = m.TLSConfig()
+			srv.TLSConfig.MinVersion = minVersion
+			redirect = m.HTTPHandler(redirect)
+			// Certificates come from the manager rather than files.
+			certFile, keyFile = "", ""
+			fmt.Printf("Using automatic certificates for %v\n", ac.Hostnames)
+		}
+	}
+
+	lns, err := newListeners(cfg.Upgrades)
+	if err != nil {
+		return err
+	}
+	defer lns.Stop()
+
+	ln, err := lns.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("Error listening on %v: %v", cfg.Addr, err)
+	}
+	servers := []*http.Server{srv}
+	failed := make(chan error, 3)
+
+	if !cfg.TLS.Enabled() {
+		fmt.Printf("Listening on http://%v\n", ln.Addr())
+		go func() { failed <- srv.Serve(ln) }()
+	} else {
+		if cfg.TLS.RedirectAddr != "" {
+			redirectSrv := newServer(cfg, cfg.TLS.RedirectAddr, redirect)
+			redirectLn, err := lns.Listen("tcp", cfg.TLS.RedirectAddr)
+			if err != nil {
+				return fmt.Errorf("Error listening on %v: %v", cfg.TLS.RedirectAddr, err)
+			}
+			servers = append(servers, redirectSrv)
+			go func() { failed <- redirectSrv.Serve(redirectLn) }()
+		}
+		fmt.Printf("Listening on https://%v\n", ln.Addr())
+		go func() { failed <- srv.ServeTLS(ln, certFile, keyFile) }()
+	}
+	if cfg.UnixSocket.Path != "" {
+		unixSrv, unixLn, err := listenUnix(cfg, lns, handler)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, unixSrv)
+		fmt.Printf("Listening on unix:%v\n", cfg.UnixSocket.Path)
+		go func() { failed <- unixSrv.Serve(unixLn) }()
+	}
+	if err := lns.Ready(); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	case <-lns.Exit():
+	}
+	return shutdown(servers, cfg.ShutdownTimeout.Duration)
+}
+
+/*
+shutdown - stops the servers accepting connections, and waits up to timeout for their in-flight requests to finish.
+*/
+func shutdown(servers []*http.Server, timeout time.Duration) error {
+	fmt.Println("Finishing in-flight requests...")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if errs[i] = srv.Shutdown(ctx); errs[i] != nil {
+				srv.Close()
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("Requests were cut off at shutdown: %v", err)
+	}
+	return nil
+}
+
+/*
+redirectToHTTPS - permanently redirects every request to the same URL on the HTTPS listener at httpsAddr. GET and
+HEAD requests (what browsers and crawlers send) get a 301; anything else gets a 308, since clients turn a 301 into a
+GET and would lose the request's body.
+*/
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, status)
+	})
+}
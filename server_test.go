@@ -0,0 +1,108 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+func TestShutdownFinishesInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	lns, err := newListeners(config.Upgrades{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := lns.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: slow}
+	go srv.Serve(ln)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+	<-started
+	lns.Stop()
+	<-lns.Exit()
+	if err := shutdown([]*http.Server{srv}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-body; got != "done" {
+		t.Fatalf("Got %q; want the in-flight request to finish", got)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatal("The server still accepts connections after shutting down")
+	}
+}
+
+func TestActivatedSockets(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+	if sockets, err := activatedSockets(); err != nil || sockets != nil {
+		t.Fatalf("Got %v, %v; want another process's sockets ignored", sockets, err)
+	}
+
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lns, err := newListeners(config.Upgrades{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &activatedListeners{listeners: lns, sockets: []net.Listener{first}}
+	if ln, err := a.Listen("tcp", ":8000"); err != nil || ln != first {
+		t.Fatalf("Got %v, %v; want the activated socket", ln, err)
+	}
+	ln, err := a.Listen("tcp", "127.0.0.1:0")
+	if err != nil || ln == first {
+		t.Fatalf("Got %v, %v; want a new listener once the activated ones are used", ln, err)
+	}
+	ln.Close()
+	first.Close()
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	cases := []struct {
+		name, httpsAddr, method, host, want string
+		status                              int
+	}{
+		{"default port", ":443", "GET", "api.example.com", "https://api.example.com/v1/products?name=x", 301},
+		{"port dropped", ":443", "HEAD", "api.example.com:80", "https://api.example.com/v1/products?name=x", 301},
+		{"other port", ":8443", "GET", "api.example.com:8080", "https://api.example.com:8443/v1/products?name=x", 301},
+		{"IPv6", ":8443", "GET", "[::1]", "https://[::1]:8443/v1/products?name=x", 301},
+		{"IPv6 default port", ":443", "GET", "[::1]:80", "https://[::1]/v1/products?name=x", 301},
+		{"body kept", ":443", "POST", "api.example.com", "https://api.example.com/v1/products?name=x", 308},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newRequest(c.method, "/v1/products?name=x", "")
+			r.Host = c.host
+			w := record(redirectToHTTPS(c.httpsAddr), r)
+			if w.Code != c.status || w.Header().Get("Location") != c.want {
+				t.Fatalf("Got %v to %q; want %v to %q", w.Code, w.Header().Get("Location"), c.status, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/gorilla/mux"
+)
+
+// The headers a signed request carries.
+const (
+	signatureClientHeader    = "X-Signature-Client"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureHeader          = "X-Signature"
+)
+
+// maxSignedBytes - the largest body that's read to check its signature: that of the largest request, a restore.
+const maxSignedBytes = maxSnapshotBytes
+
+/*
+hmacAuth - verifies signed requests. A client signs a request by sending its ID, the Unix time in seconds, and the
+hex HMAC-SHA256, keyed by its secret, of
+
+	<timestamp>\n<METHOD>\n<path and query>\n<hex SHA-256 of the body>
+
+A request whose timestamp is more than the window from now is refused, as is one whose signature has been seen
+before, so a captured request can't be replayed. Signatures are remembered in memory, per instance, until their
+timestamp leaves the window. Clients in the config are checked first, then those in the store.
+*/
+type hmacAuth struct {
+	secrets map[string][]byte
+	tenants map[string][]string
+	store   datastore.Datastore
+	window  time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // when each signature's timestamp leaves the window
+	lastSweep time.Time
+}
+
+// newHMACAuth - request signing by the configured clients, and those in store; nil if none are configured.
+func newHMACAuth(cfg config.HMACAuth, store datastore.Datastore) (*hmacAuth, error) {
+	if len(cfg.Clients) == 0 {
+		return nil, nil
+	}
+	if cfg.Window.Duration <= 0 {
+		return nil, fmt.Errorf("HMAC signature window must be positive, not %v", cfg.Window)
+	}
+	secrets := map[string][]byte{}
+	for client, secret := range cfg.Clients {
+		if len(secret) < 16 {
+			return nil, fmt.Errorf("Client %q's HMAC secret is too short; use at least 16 characters", client)
+		}
+		secrets[client] = []byte(secret)
+	}
+	return &hmacAuth{secrets: secrets, tenants: cfg.Tenants, store: store, window: cfg.Window.Duration, seen: map[string]time.Time{}, lastSweep: time.Now()}, nil
+}
+
+// sign - the signature of a request with the given timestamp, method, path and query, and body.
+func sign(secret []byte, timestamp, method, uri string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%v\n%v\n%v\n%x", timestamp, method, uri, bodyHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *hmacAuth) authenticate(r *http.Request) (principal, error) {
+	client := r.Header.Get(signatureClientHeader)
+	timestamp := r.Header.Get(signatureTimestampHeader)
+	signature, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if client == "" || timestamp == "" || err != nil || len(signature) == 0 {
+		return principal{}, errors.New("Request isn't signed")
+	}
+	secret, p, err := h.client(r.Context(), client)
+	if err != nil {
+		return principal{}, err
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return principal{}, fmt.Errorf("Invalid signature timestamp %q", timestamp)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := time.Since(signedAt).Abs(); skew > h.window {
+		return principal{}, fmt.Errorf("Signature timestamp is %v from now", skew.Round(time.Second))
+	}
+
+	// The handler reads the body after us, so it's put back.
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBytes+1))
+	r.Body.Close()
+	if err != nil || len(body) > maxSignedBytes {
+		return principal{}, errors.New("Request body couldn't be read to check its signature")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	want, _ := hex.DecodeString(sign(secret, timestamp, r.Method, r.URL.RequestURI(), body))
+	if !hmac.Equal(signature, want) {
+		return principal{}, errors.New("Wrong signature")
+	}
+	if !h.firstUse(string(signature), signedAt.Add(h.window)) {
+		return principal{}, errors.New("Signature has already been used")
+	}
+	return p, nil
+}
+
+// client - the named client's secret, and who it is if the signature is right.
+func (h *hmacAuth) client(ctx context.Context, name string) ([]byte, principal, error) {
+	if secret, ok := h.secrets[name]; ok {
+		return secret, principal{Name: name, Roles: []string{roleAdmin}, Tenants: h.tenants[name]}, nil
+	}
+	stored := datastore.User{Name: name}
+	err := h.store.GetUser(ctx, &stored)
+	if errors.Is(err, datastore.ErrNotFound) || (err == nil && (stored.Kind != datastore.UserKindClient || stored.Secret == "")) {
+		return nil, principal{}, fmt.Errorf("Unknown client %q", name)
+	}
+	if err != nil {
+		return nil, principal{}, err
+	}
+	return []byte(stored.Secret), principal{Name: name, Roles: stored.Roles, Tenants: stored.Tenants}, nil
+}
+
+// firstUse - records a signature as used until expires, reporting whether it hadn't been already.
+func (h *hmacAuth) firstUse(signature string, expires time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.lastSweep) > h.window {
+		for s, at := range h.seen {
+			if now.After(at) {
+				delete(h.seen, s)
+			}
+		}
+		h.lastSweep = now
+	}
+	if _, used := h.seen[signature]; used {
+		return false
+	}
+	h.seen[signature] = expires
+	return true
+}
+
+func (h *hmacAuth) challenge() string {
+	return fmt.Sprintf(`HMAC-SHA256 headers="%v %v %v"`, signatureClientHeader, signatureTimestampHeader, signatureHeader)
+}
+
+// mutating - whether a request changes anything, so must be signed, and needs roleWriter.
+func mutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+/*
+requireSignature - refuses writes that aren't signed by one of auth's clients, as requireAuth does. Reads don't
+need signing, but a signed one is checked the same way, so it's made (and its usage counted) as its client. A nil auth
+lets everything through.
+*/
+func requireSignature(auth *hmacAuth) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if auth == nil {
+			return next
+		}
+		signed := requireAuth(auth)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mutating(r) || r.Header.Get(signatureClientHeader) != "" {
+				signed.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
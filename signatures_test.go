@@ -0,0 +1,61 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+const testSecret = "0123456789abcdef0123"
+
+// signed - a request to the API, signed by the given client and secret at the given time.
+func signed(client, secret string, at time.Time, method, path, body string) *http.Request {
+	r := newRequest(method, path, body)
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set(signatureClientHeader, client)
+	r.Header.Set(signatureTimestampHeader, timestamp)
+	r.Header.Set(signatureHeader, sign([]byte(secret), timestamp, method, path, []byte(body)))
+	return r
+}
+
+func TestSignedWrites(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.HMAC.Clients = map[string]string{"billing": testSecret}
+	h := testServer(t, cfg, fixtureStore(t))
+	now := time.Now()
+	body := `{"Name": "Kiwi", "Price": 0.5}`
+
+	tampered := signed("billing", testSecret, now, "POST", "/v1/product", body)
+	tampered.Body = newRequest("POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.01}`).Body
+	cases := []struct {
+		name   string
+		r      *http.Request
+		status int
+	}{
+		{"reads aren't signed", newRequest("GET", "/v1/product/1", ""), http.StatusOK},
+		{"unsigned write", newRequest("POST", "/v1/product", body), http.StatusUnauthorized},
+		{"signed write", signed("billing", testSecret, now, "POST", "/v1/product", body), http.StatusCreated},
+		{"signed admin write", signed("billing", testSecret, now, "POST", "/admin/search/reindex", ""), http.StatusConflict},
+		{"replayed", signed("billing", testSecret, now, "POST", "/v1/product", body), http.StatusUnauthorized},
+		{"tampered body", tampered, http.StatusUnauthorized},
+		{"wrong secret", signed("billing", "fedcba9876543210fedc", now, "POST", "/v1/product", body), http.StatusUnauthorized},
+		{"unknown client", signed("shipping", testSecret, now, "POST", "/v1/product", body), http.StatusUnauthorized},
+		{"too old", signed("billing", testSecret, now.Add(-10*time.Minute), "POST", "/v1/product", body), http.StatusUnauthorized},
+		{"too far ahead", signed("billing", testSecret, now.Add(10*time.Minute), "POST", "/v1/product", body), http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		w := record(h, c.r)
+		if w.Code != c.status {
+			t.Errorf("%v: got status %v, want %v; body %s", c.name, w.Code, c.status, w.Body)
+		}
+		if c.status == http.StatusUnauthorized && (errorCode(w) != "unauthorized" || w.Header().Get("WWW-Authenticate") == "") {
+			t.Errorf("%v: got code %q, WWW-Authenticate %q", c.name, errorCode(w), w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
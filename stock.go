@@ -0,0 +1,136 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// locations - the warehouses (or shops, or shelves) that hold stock. A Product's stock is kept per location.
+var locations = datastore.Resource{
+	Name:  "locations",
+	Table: "Locations",
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 200},
+			"code": {"type": "string", "maxLength": 50},
+			"address": {"type": "string", "maxLength": 1000},
+			"notes": {"type": "string", "maxLength": 2000}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	datastore.RegisterResource(locations)
+	deleteChecks[locations.Name] = locationEmpty
+}
+
+/*
+locationEmpty - refuses to delete a location while any Product has stock there with 409, since its stock could
+never be adjusted again and would count toward the Product's total for good. Move or write the stock off first.
+*/
+func locationEmpty(a *API, r *http.Request, id string) (int, error) {
+	products, err := a.Store.GetAll(datastore.WithFields(r.Context(), []string{datastore.FieldStock}))
+	if err != nil {
+		return storeStatus(err), err
+	}
+	held := 0
+	for _, p := range products {
+		if p.Stock[id] > 0 {
+			held++
+		}
+	}
+	if held > 0 {
+		return http.StatusConflict, i18n.Errorf("location_in_use", "Location <%v> still holds stock of %v Products; take it out first", id, held)
+	}
+	return http.StatusOK, nil
+}
+
+// stockLocationPath - route template for a Product's stock at one location.
+func stockLocationPath() string {
+	return productPath() + "/stock/{location:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// stockView - a Product's stock at each location, and in all.
+type stockView struct {
+	XMLName   xml.Name              `json:"-" xml:"stock"`
+	ProductId string                `json:"product_id" xml:"product_id"`
+	Locations datastore.StockLevels `json:"locations" xml:"locations"`
+	Total     int                   `json:"total" xml:"total"`
+}
+
+// newStockView - the stock view of a Product; one that has never been stocked has none anywhere.
+func newStockView(p datastore.Product) stockView {
+	levels := p.Stock
+	if levels == nil {
+		levels = datastore.StockLevels{}
+	}
+	return stockView{ProductId: p.Id, Locations: levels, Total: levels.Total()}
+}
+
+// stockAdjustment - the body of a stock adjustment: how many to add at the location, or take away if negative.
+type stockAdjustment struct {
+	Adjustment int `json:"adjustment" xml:"adjustment"`
+}
+
+/*
+GetStock - display a Product's stock at each location, and its total.
+*/
+func (a *API) GetStock(w http.ResponseWriter, r *http.Request) {
+	id, err := productID(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	p := datastore.Product{Id: id}
+	if err = a.Store.GetProduct(datastore.WithFields(r.Context(), []string{datastore.FieldStock}), &p); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, newStockView(p))
+}
+
+/*
+AdjustStock - add to (or take from) a Product's stock at one location, as goods arrive or leave. Adjustments are
+atomic, so concurrent ones are never lost, and one that would leave the location with less than none is refused with
+409. A Product's stock can only be changed this way; creating or updating it leaves its stock alone.
+*/
+func (a *API) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	var req stockAdjustment
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Adjustment == 0 || req.Adjustment > datastore.MaxStockAdjustment || req.Adjustment < -datastore.MaxStockAdjustment {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_stock_adjustment", "Adjustment must be a non-zero whole number no more than %v either way", datastore.MaxStockAdjustment))
+		return
+	}
+	location := mux.Vars(r)["location"]
+	if _, err := a.Store.GetRecord(r.Context(), locations.Name, location); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	p, err := a.Store.AdjustStock(r.Context(), productID, location, req.Adjustment)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, newStockView(p))
+}
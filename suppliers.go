@@ -0,0 +1,153 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/schema"
+
+	"github.com/gorilla/mux"
+)
+
+// suppliers - the companies Products are bought from. A Product names its supplier with supplier_id.
+var suppliers = datastore.Resource{
+	Name:  "suppliers",
+	Table: "Suppliers",
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 200},
+			"contact_name": {"type": "string", "maxLength": 200},
+			"email": {"type": "string", "maxLength": 254},
+			"phone": {"type": "string", "maxLength": 50},
+			"address": {"type": "string", "maxLength": 1000},
+			"lead_time_days": {"type": "integer", "minimum": 0},
+			"notes": {"type": "string", "maxLength": 2000}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	datastore.RegisterResource(suppliers)
+	deleteChecks[suppliers.Name] = unreferenced(suppliers, datastore.FieldSupplier)
+}
+
+// productReference - a record a Product names by ID: its supplier or its category.
+type productReference struct {
+	res datastore.Resource
+	id  string
+}
+
+// references - the records a Product names.
+func references(p datastore.Product) []productReference {
+	var refs []productReference
+	if p.SupplierId != "" {
+		refs = append(refs, productReference{suppliers, p.SupplierId})
+	}
+	if p.CategoryId != "" {
+		refs = append(refs, productReference{categories, p.CategoryId})
+	}
+	return refs
+}
+
+/*
+unreferenced - a delete check refusing with 409 to delete a record of res while any Product still names it in field,
+since those Products would be left naming one that doesn't exist. Reassign them first.
+*/
+func unreferenced(res datastore.Resource, field string) func(a *API, r *http.Request, id string) (int, error) {
+	return func(a *API, r *http.Request, id string) (int, error) {
+		products, err := a.Store.GetAll(datastore.WithFields(r.Context(), []string{field}))
+		if err != nil {
+			return storeStatus(err), err
+		}
+		named := 0
+		for _, p := range products {
+			for _, ref := range references(p) {
+				if ref.res.Name == res.Name && ref.id == id {
+					named++
+				}
+			}
+		}
+		if named > 0 {
+			return http.StatusConflict, i18n.Errorf("record_in_use", "%v <%v> is still named by %v Products; reassign them first", res.Name, id, named)
+		}
+		return http.StatusOK, nil
+	}
+}
+
+/*
+referenceError - checks that every supplier and category the Products name exists, returning the status to respond
+with if one doesn't (400, since the problem is in the request body) or can't be read.
+*/
+func (a *API) referenceError(ctx context.Context, products []datastore.Product) (int, error) {
+	checked := map[productReference]bool{}
+	for _, p := range products {
+		for _, ref := range references(p) {
+			if checked[ref] {
+				continue
+			}
+			if _, err := a.Store.GetRecord(ctx, ref.res.Name, ref.id); err != nil {
+				if errors.Is(err, datastore.ErrNotFound) {
+					return http.StatusBadRequest, err
+				}
+				return storeStatus(err), err
+			}
+			checked[ref] = true
+		}
+	}
+	return http.StatusOK, nil
+}
+
+/*
+importReferences - checks the suppliers and categories of imported rows that are otherwise valid, marking those
+naming one that doesn't exist as failed. Each is only looked up once.
+*/
+func (a *API) importReferences(ctx context.Context) func(p datastore.Product) string {
+	problems := map[productReference]string{}
+	return func(p datastore.Product) string {
+		for _, ref := range references(p) {
+			problem, ok := problems[ref]
+			if !ok {
+				if _, err := a.Store.GetRecord(ctx, ref.res.Name, ref.id); err != nil {
+					problem = err.Error()
+				}
+				problems[ref] = problem
+			}
+			if problem != "" {
+				return problem
+			}
+		}
+		return ""
+	}
+}
+
+/*
+GetSupplierProducts - the Products bought from a supplier, in the same order and form as GET /products.
+*/
+func (a *API) GetSupplierProducts(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := a.Store.GetRecord(r.Context(), suppliers.Name, id); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	all, err := a.Store.GetAll(r.Context())
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	products := []datastore.Product{}
+	for _, p := range all {
+		if p.SupplierId == id {
+			products = append(products, p)
+		}
+	}
+	respond(w, r, http.StatusOK, resources(products))
+}
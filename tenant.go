@@ -0,0 +1,85 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// tenantHeader - the request header naming the tenant when multi-tenancy is enabled.
+const tenantHeader = "X-Tenant-ID"
+
+/*
+validateTenancy - checks the configured tenants before any backend sets up their storage, and that the tenants the
+users and clients in auth may use are among them.
+*/
+func validateTenancy(cfg config.Tenancy, auth config.Auth) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.Tenants) == 0 {
+		return fmt.Errorf("Multi-tenancy is enabled but no tenants are configured")
+	}
+	for _, tenant := range cfg.Tenants {
+		if !datastore.ValidTenant(tenant) {
+			return fmt.Errorf("Invalid tenant name %q; use up to 32 lowercase letters, digits and dashes", tenant)
+		}
+	}
+	for _, users := range []map[string][]string{auth.Basic.Tenants, auth.HMAC.Tenants} {
+		for name, tenants := range users {
+			for _, tenant := range tenants {
+				if !slices.Contains(cfg.Tenants, tenant) {
+					return fmt.Errorf("%v may use tenant %q, which isn't configured", name, tenant)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+requireTenant - scopes each request to the tenant named in its X-Tenant-ID header, refusing requests without one
+(400), for a tenant that isn't configured (403) or for one the user or client they authenticated as may not use
+(403), so it runs after authentication. Every handler reaches the backend through the request's context, so none
+can see another tenant's Products. When multi-tenancy is off, requests use the default tenant.
+*/
+func requireTenant(cfg config.Tenancy) mux.MiddlewareFunc {
+	allowed := map[string]bool{}
+	for _, tenant := range cfg.Tenants {
+		allowed[tenant] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Responses differ by tenant, so shared caches must keep them apart.
+			w.Header().Add("Vary", tenantHeader)
+
+			tenant := r.Header.Get(tenantHeader)
+			switch {
+			case tenant == "":
+				writeError(w, r, http.StatusBadRequest, i18n.Errorf("tenant_required", "The %v header is required", tenantHeader))
+				return
+			case !allowed[tenant]:
+				writeError(w, r, http.StatusForbidden, i18n.Errorf("unknown_tenant", "Unknown tenant %q", tenant))
+				return
+			}
+			if p, ok := requestPrincipal(r); ok && !p.mayUse(tenant) {
+				writeError(w, r, http.StatusForbidden, i18n.Errorf("tenant_forbidden", "%v may not use tenant %q", p.Name, tenant))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(datastore.WithTenant(r.Context(), tenant)))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerPanic - a panic in a handler withTimeout ran, passed on to recoverPanics with the stack where it happened.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+/*
+withTimeout - gives each request's context a deadline, timeout from now, so the datastore calls it makes are
+abandoned once it has passed, and responds 504 Gateway Timeout if the handler hasn't started its response by then.
+The handler is left to notice its cancelled context and return; anything it writes afterwards is dropped. A handler
+that started its response in time (e.g. a streamed export) is waited for. A zero timeout leaves requests unlimited.
+*/
+func withTimeout(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan handlerPanic, 1)
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						p := handlerPanic{value: v, stack: debug.Stack()}
+						if tw.expired() {
+							log.Printf("request_id=%v panic after timing out: %v\n%s", requestID(r), v, p.stack)
+							return
+						}
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case p := <-panicked:
+				panic(p)
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded && tw.expire() {
+					writeError(w, r, http.StatusGatewayTimeout, i18n.Errorf("request_timeout", "The request took longer than %v", timeout))
+					return
+				}
+				// The response had started, so it's finished as well as it can be (or the client has gone).
+				select {
+				case <-done:
+				case p := <-panicked:
+					panic(p)
+				}
+			}
+		})
+	}
+}
+
+/*
+timeoutWriter - the ResponseWriter withTimeout gives the handler. Its headers are the handler's own until it starts
+the response, so they can't change under the 504; once withTimeout has responded, the handler's writes are dropped.
+*/
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu       sync.Mutex
+	started  bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.start(status)
+}
+
+// start - sends the handler's headers, if no response has been started yet; must be called with the lock held.
+func (tw *timeoutWriter) start(status int) {
+	if tw.started || tw.timedOut {
+		return
+	}
+	tw.started = true
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.start(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush - passes flushes through, so streamed responses still stream.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if f, ok := tw.w.(http.Flusher); ok && !tw.timedOut {
+		tw.start(http.StatusOK)
+		f.Flush()
+	}
+}
+
+// expire - marks the request as timed out, unless its response has started; it reports whether it did.
+func (tw *timeoutWriter) expire() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.started {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+// expired - whether withTimeout has responded in the handler's place.
+func (tw *timeoutWriter) expired() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.timedOut
+}
@@ -0,0 +1,61 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+)
+
+func TestSlowHandlersTimeOut(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("late"))
+	}
+	w := record(recoverPanics(withTimeout(10*time.Millisecond)(http.HandlerFunc(slow))), newRequest("GET", "/", ""))
+	if w.Code != http.StatusGatewayTimeout || errorCode(w) != "request_timeout" || strings.Contains(w.Body.String(), "late") {
+		t.Fatalf("Slow handler: got status %v, code %q; body %s", w.Code, errorCode(w), w.Body)
+	}
+
+	streaming := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("id\n"))
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("1\n"))
+	}
+	w = record(withTimeout(10*time.Millisecond)(http.HandlerFunc(streaming)), newRequest("GET", "/", ""))
+	if w.Code != http.StatusOK || w.Body.String() != "id\n1\n" || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Streaming handler: got status %v, Content-Type %q; body %q", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+
+	panicking := func(w http.ResponseWriter, r *http.Request) { panic("boom") }
+	w = record(recoverPanics(withTimeout(time.Second)(http.HandlerFunc(panicking))), newRequest("GET", "/", ""))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Panicking handler: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestTimeoutCancelsDatastoreCalls(t *testing.T) {
+	// A backend that only returns once the call is abandoned.
+	store := datastore.Intercept(fixtureStore(t), func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	returned := make(chan error, 1)
+	h := withTimeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		returned <- store.GetProduct(r.Context(), &datastore.Product{Id: "1"})
+	}))
+
+	if w := record(h, newRequest("GET", "/v1/product/1", "")); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Got status %v; body %s", w.Code, w.Body)
+	}
+	if err := <-returned; err != context.DeadlineExceeded || storeStatus(err) != http.StatusGatewayTimeout {
+		t.Fatalf("The datastore call returned %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package tracecontext propagates W3C Trace Context (https://www.w3.org/TR/trace-context/), so that the app's work
+joins the distributed traces its callers start. Each request served is a span: a child of the caller's, from its
+traceparent header, or the root of a new trace. The span rides in the request's context, and calls the app makes
+while serving it (to AWS, webhooks and other HTTP services) carry it on in their own traceparent and tracestate
+headers, so the spans of the services they reach are its children.
+*/
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// The headers trace context travels in.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// maxTracestate - the longest tracestate passed on; entries past it are dropped, as the spec allows.
+const maxTracestate = 512
+
+/*
+Span - a span's place in a trace: the trace's 32 hex digit ID, the span's own 16 hex digit ID, the trace flags (of
+which only Sampled is defined) and the vendors' tracestate, which is passed on as it came.
+*/
+type Span struct {
+	TraceID string
+	SpanID  string
+	Flags   byte
+	State   string
+}
+
+// Sampled - the flag saying the caller may have recorded its span.
+const Sampled byte = 0x01
+
+// Traceparent - the span as a version 00 traceparent header.
+func (s Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + hex.EncodeToString([]byte{s.Flags})
+}
+
+/*
+Parse - the span in a traceparent header, and whether it's valid. Versions after 00 are read as far as 00 defines
+them, as the spec asks; version ff, IDs of all zeros and anything malformed are invalid.
+*/
+func Parse(traceparent string) (Span, bool) {
+	traceparent = strings.TrimSpace(traceparent)
+	if len(traceparent) < 55 || (len(traceparent) > 55 && (traceparent[:2] == "00" || traceparent[55] != '-')) {
+		return Span{}, false
+	}
+	parts := strings.Split(traceparent[:55], "-")
+	if len(parts) != 4 || !lowerHex(parts[0], 2) || parts[0] == "ff" || !lowerHex(parts[1], 32) || !lowerHex(parts[2], 16) || !lowerHex(parts[3], 2) {
+		return Span{}, false
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return Span{}, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return Span{TraceID: parts[1], SpanID: parts[2], Flags: flags[0]}, true
+}
+
+// lowerHex - local helper function that checks s is n lower-case hex digits.
+func lowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Extract - the caller's span from a request's headers, and whether there was a valid one. Its tracestate is only kept
+with a valid traceparent; repeated tracestate headers are combined, and trimmed to whole entries within 512
+characters.
+*/
+func Extract(h http.Header) (Span, bool) {
+	parent, ok := Parse(h.Get(TraceparentHeader))
+	if !ok {
+		return Span{}, false
+	}
+	entries := []string{}
+	length := 0
+	for _, value := range h.Values(TracestateHeader) {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			if length+len(entry)+len(entries) > maxTracestate {
+				break
+			}
+			entries = append(entries, entry)
+			length += len(entry)
+		}
+	}
+	parent.State = strings.Join(entries, ",")
+	return parent, true
+}
+
+/*
+Start - a new span: a child of parent, in its trace and with its flags and tracestate, or, if there's no parent, the
+root of a new, unsampled trace (the app doesn't record spans itself).
+*/
+func Start(parent Span, ok bool) Span {
+	if !ok {
+		return Span{TraceID: randomHex(16), SpanID: randomHex(8)}
+	}
+	parent.SpanID = randomHex(8)
+	return parent
+}
+
+// randomHex - local helper function that generates n random bytes, in hex, never all zeros.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		if s := hex.EncodeToString(b); strings.Trim(s, "0") != "" {
+			return s
+		}
+	}
+}
+
+type spanKey struct{}
+
+// WithSpan - a context carrying the span.
+func WithSpan(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// FromContext - the context's span, if it has one.
+func FromContext(ctx context.Context) (Span, bool) {
+	s, ok := ctx.Value(spanKey{}).(Span)
+	return s, ok
+}
+
+// Inject - sets the traceparent and tracestate headers of an outgoing request to the context's span, if it has one.
+func Inject(ctx context.Context, h http.Header) {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	h.Set(TraceparentHeader, s.Traceparent())
+	if s.State != "" {
+		h.Set(TracestateHeader, s.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+/*
+AWS - an API option for the AWS SDK's clients that injects the context's span into every request they send,
+including retries. Use it with config.WithAPIOptions.
+*/
+func AWS(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("TraceContext", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			Inject(ctx, req.Header)
+		}
+		return next.HandleBuild(ctx, in)
+	}), middleware.After)
+}
@@ -0,0 +1,87 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+// socketMode - the configured permissions of the Unix socket.
+func socketMode(cfg config.UnixSocket) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(cfg.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("Invalid unix_socket mode %q; use octal permissions such as \"0660\"", cfg.Mode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+/*
+openListener - opens a listener. A Unix socket that nothing is listening on any more, left behind by a process that
+didn't exit cleanly, is removed first; one that something is still listening on is left alone, so listening fails.
+*/
+func openListener(network, addr string) (net.Listener, error) {
+	if network == "unix" {
+		if info, err := os.Lstat(addr); err == nil && info.Mode()&fs.ModeSocket != 0 {
+			conn, err := net.Dial("unix", addr)
+			if err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("Something is already listening on %v", addr)
+			}
+			if err := os.Remove(addr); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+/*
+listenUnix - a listener on the configured socket, with its permissions set. Its server marks its requests as having
+come through the socket (see viaUnixSocket).
+*/
+func listenUnix(cfg config.Server, lns listeners, handler http.Handler) (*http.Server, net.Listener, error) {
+	mode, err := socketMode(cfg.UnixSocket)
+	if err != nil {
+		return nil, nil, err
+	}
+	ln, err := lns.Listen("unix", cfg.UnixSocket.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error listening on %v: %v", cfg.UnixSocket.Path, err)
+	}
+	// A socket systemd passed in has the permissions its unit gave it.
+	if ln.Addr().String() != cfg.UnixSocket.Path {
+		return newUnixServer(cfg, handler), ln, nil
+	}
+	if err := os.Chmod(cfg.UnixSocket.Path, mode); err != nil {
+		ln.Close()
+		return nil, nil, fmt.Errorf("Error setting the permissions of %v: %v", cfg.UnixSocket.Path, err)
+	}
+	return newUnixServer(cfg, handler), ln, nil
+}
+
+// newUnixServer - local helper function that makes the socket's server, which marks the requests it serves.
+func newUnixServer(cfg config.Server, handler http.Handler) *http.Server {
+	srv := newServer(cfg, cfg.UnixSocket.Path, handler)
+	srv.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+		return context.WithValue(ctx, unixSocketKey{}, true)
+	}
+	return srv
+}
+
+type unixSocketKey struct{}
+
+// viaUnixSocket - whether the request came in through the Unix socket.
+func viaUnixSocket(r *http.Request) bool {
+	via, _ := r.Context().Value(unixSocketKey{}).(bool)
+	return via
+}
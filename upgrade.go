@@ -0,0 +1,119 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/bamajap/go-basic-api-app/config"
+
+	"github.com/cloudflare/tableflip"
+)
+
+/*
+listeners - where the servers get their sockets, and how they learn that it's time to stop.
+*/
+type listeners interface {
+	// Listen - a listener on addr; after an upgrade, the one the previous process was serving.
+	Listen(network, addr string) (net.Listener, error)
+	// Ready - called once every server is serving. An upgrade is complete once the new process is ready.
+	Ready() error
+	// Exit - closed when the servers should stop taking connections and finish the requests they have.
+	Exit() <-chan struct{}
+	// Stop - closes Exit.
+	Stop()
+}
+
+/*
+newListeners - the servers' listeners. With upgrades enabled they come from tableflip, which passes them on to the
+next process on SIGUSR2; otherwise they are plain ones. Either way, sockets systemd passed in are used first (see
+activatedSockets), and SIGTERM and SIGINT stop the servers gracefully.
+*/
+func newListeners(cfg config.Upgrades) (listeners, error) {
+	l, err := upgradableListeners(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sockets, err := activatedSockets()
+	if err != nil {
+		l.Stop()
+		return nil, err
+	}
+	if len(sockets) == 0 {
+		return l, nil
+	}
+	return &activatedListeners{listeners: l, sockets: sockets}, nil
+}
+
+// upgradableListeners - local helper function that makes tableflip's listeners, if upgrades are enabled.
+func upgradableListeners(cfg config.Upgrades) (listeners, error) {
+	if !cfg.Enabled {
+		l := &plainListeners{exit: make(chan struct{})}
+		go stopOnSignal(l.Stop)
+		return l, nil
+	}
+
+	upg, err := tableflip.New(tableflip.Options{UpgradeTimeout: cfg.Timeout.Duration, PIDFile: cfg.PIDFile})
+	if err != nil {
+		return nil, fmt.Errorf("Error enabling upgrades: %v", err)
+	}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGUSR2)
+		for range sig {
+			log.Print("Upgrading...")
+			if err := upg.Upgrade(); err != nil {
+				log.Printf("The upgrade failed, so this process carries on serving: %v", err)
+			}
+		}
+	}()
+	go stopOnSignal(upg.Stop)
+	return upgradeListeners{upg}, nil
+}
+
+// upgradeListeners - tableflip's listeners: those the previous process passed on, or else new ones.
+type upgradeListeners struct {
+	*tableflip.Upgrader
+}
+
+func (u upgradeListeners) Listen(network, addr string) (net.Listener, error) {
+	return u.ListenWithCallback(network, addr, openListener)
+}
+
+// stopOnSignal - calls stop on the first SIGTERM or SIGINT. A second one kills the process as usual.
+func stopOnSignal(stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	<-sig
+	signal.Stop(sig)
+	stop()
+}
+
+// plainListeners - listeners for a server that isn't upgraded in place.
+type plainListeners struct {
+	exit chan struct{}
+	once sync.Once
+}
+
+func (l *plainListeners) Listen(network, addr string) (net.Listener, error) {
+	return openListener(network, addr)
+}
+
+func (l *plainListeners) Ready() error {
+	return nil
+}
+
+func (l *plainListeners) Exit() <-chan struct{} {
+	return l.exit
+}
+
+func (l *plainListeners) Stop() {
+	l.once.Do(func() { close(l.exit) })
+}
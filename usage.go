@@ -0,0 +1,168 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+	"github.com/bamajap/go-basic-api-app/usage"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultUsagePeriod - the period /admin/usage reports on when the request doesn't say: the last day.
+const defaultUsagePeriod = 24 * time.Hour
+
+// newUsageTracker - the usage tracker for the config, writing to store; nil unless usage is enabled.
+func newUsageTracker(cfg config.Usage, store datastore.Datastore) (*usage.Tracker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.FlushInterval.Duration <= 0 || cfg.Retention.Duration <= 0 || cfg.MaxClients < 1 {
+		return nil, fmt.Errorf("usage.flush_interval, usage.retention and usage.max_clients must be positive")
+	}
+	return usage.NewTracker(store, cfg.Retention.Duration, cfg.MaxClients)
+}
+
+// usageClient - who a request came from, as far as authentication has found out by the time it's counted.
+type usageClient struct {
+	name string
+}
+
+type usageClientKey struct{}
+
+// noteClient - tells the usage tracker who made the request, once authentication knows.
+func noteClient(r *http.Request, name string) {
+	if c, ok := r.Context().Value(usageClientKey{}).(*usageClient); ok {
+		c.name = name
+	}
+}
+
+/*
+countUsage - counts the requests next serves with the tracker, under their client, method and route in router, with
+the bytes of body they read and wrote. A request is counted under the user or client it authenticated as; one that
+didn't (because the API is open, or its credentials were refused) is counted under its IP address. Methods and routes
+are named as for metrics.
+*/
+func countUsage(tracker *usage.Tracker, router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.MatchErr == nil && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = routeKey(template)
+			}
+		}
+		method := r.Method
+		if !metricMethods[method] {
+			method = "OTHER"
+		}
+
+		client := &usageClient{}
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		rec := &countingWriter{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), usageClientKey{}, client)))
+
+		if client.name == "" {
+			client.name = "ip:" + clientKey(r)
+		}
+		tracker.Count(usage.Request{
+			Client: client.name, Method: method, Route: route, Status: rec.status, BytesIn: body.n, BytesOut: rec.n,
+		})
+	})
+}
+
+// countingReader - counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter - counts the bytes of a response body, as well as recording its status.
+type countingWriter struct {
+	statusRecorder
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.statusRecorder.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// usageReport - the usage over a period, by client and endpoint.
+type usageReport struct {
+	XMLName xml.Name      `json:"-" xml:"usage"`
+	From    time.Time     `json:"from" xml:"from"`
+	To      time.Time     `json:"to" xml:"to"`
+	Usage   []usage.Usage `json:"usage" xml:"endpoint"`
+}
+
+// usageTime - the named query parameter as a time, or def if it isn't given.
+func usageTime(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, i18n.Errorf("invalid_usage_time", "Invalid %v %q; use an RFC 3339 timestamp", name, v)
+	}
+	return t, nil
+}
+
+/*
+GetUsage - report API usage by client and endpoint: requests, errors, error rate and bytes in and out, most requested
+first. ?from= and ?to= (RFC 3339) choose the period, by the hour, defaulting to the last day; ?client= narrows it to
+one client. This instance's counts are written first, if they can be, so they're included; other instances' are as of
+their last flush.
+*/
+func (a *API) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if a.Usage == nil {
+		writeError(w, r, http.StatusConflict, i18n.Errorf("usage_not_enabled", "Usage analytics aren't enabled"))
+		return
+	}
+	to, err := usageTime(r, "to", time.Now().UTC())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	from, err := usageTime(r, "from", to.Add(-defaultUsagePeriod))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_usage_period", "from must be before to"))
+		return
+	}
+
+	if err := a.Usage.Flush(r.Context()); err != nil {
+		log.Printf("request_id=%v Flushing usage failed: %v", requestID(r), err)
+	}
+	report, err := a.Usage.Report(r.Context(), from, to, r.URL.Query().Get("client"))
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, usageReport{From: from.UTC(), To: to.UTC(), Usage: report})
+}
@@ -0,0 +1,394 @@
+/*
+Author: Jason Payne
+*/
+
+/*
+Package usage counts API requests by client and endpoint, for capacity planning and billing.
+
+Counts are rolled up by hour and kept as records of a hidden registry resource, so every backend stores them without
+changes of its own. Each instance gathers its counts in memory and writes them every flush interval to rollups of its
+own, so instances never write the same record and no count is lost to a race; a report adds every instance's up.
+Rollups are kept with the default tenant's data, whichever tenant's requests they count.
+*/
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/schema"
+)
+
+// Resource - where the hourly rollups are stored. It's hidden: they're only read through /admin/usage.
+var Resource = datastore.Resource{
+	Name:   "usage",
+	Table:  "Usage",
+	Hidden: true,
+	Schema: schema.MustParse(`{
+		"type": "object",
+		"required": ["hour", "instance", "client", "method", "route", "requests"],
+		"properties": {
+			"hour": {"type": "string"},
+			"instance": {"type": "string"},
+			"client": {"type": "string"},
+			"method": {"type": "string"},
+			"route": {"type": "string"},
+			"requests": {"type": "integer", "minimum": 0},
+			"client_errors": {"type": "integer", "minimum": 0},
+			"server_errors": {"type": "integer", "minimum": 0},
+			"bytes_in": {"type": "integer", "minimum": 0},
+			"bytes_out": {"type": "integer", "minimum": 0}
+		},
+		"additionalProperties": false
+	}`),
+}
+
+func init() {
+	datastore.RegisterResource(Resource)
+}
+
+// OtherClients - the client that requests are counted under once an instance has seen MaxClients in an hour.
+const OtherClients = "other"
+
+// Request - one request, as it's counted.
+type Request struct {
+	Client, Method, Route string
+	Status                int
+	BytesIn, BytesOut     int64
+}
+
+// Key - what a rollup counts the requests of: one client's requests to one endpoint in one hour.
+type Key struct {
+	Hour   time.Time `json:"hour"`
+	Client string    `json:"client"`
+	Method string    `json:"method"`
+	Route  string    `json:"route"`
+}
+
+// Counts - what's counted of the requests under a Key.
+type Counts struct {
+	Requests     int64 `json:"requests" xml:"requests"`
+	ClientErrors int64 `json:"client_errors" xml:"client_errors"`
+	ServerErrors int64 `json:"server_errors" xml:"server_errors"`
+	BytesIn      int64 `json:"bytes_in" xml:"bytes_in"`
+	BytesOut     int64 `json:"bytes_out" xml:"bytes_out"`
+}
+
+// add - adds other's counts to c.
+func (c *Counts) add(other Counts) {
+	c.Requests += other.Requests
+	c.ClientErrors += other.ClientErrors
+	c.ServerErrors += other.ServerErrors
+	c.BytesIn += other.BytesIn
+	c.BytesOut += other.BytesOut
+}
+
+// rollup - an instance's counts for a Key, as they're stored.
+type rollup struct {
+	Key
+	Instance string `json:"instance"`
+	Counts
+}
+
+// id - the ID of the rollup's record: the same for every flush of it, and for no other rollup.
+func (r rollup) id() string {
+	b := sha256.Sum256([]byte(r.Instance + "\n" + r.Hour.Format(time.RFC3339) + "\n" + r.Client + "\n" + r.Method + "\n" + r.Route))
+	b[6] = (b[6] & 0x0f) | 0x80
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// record - the rollup as a record of Resource.
+func (r rollup) record() (datastore.Record, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	record := datastore.Record{}
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	record[datastore.RecordID] = r.id()
+	return record, nil
+}
+
+// rollupFromRecord - the rollup a record of Resource holds.
+func rollupFromRecord(record datastore.Record) (rollup, error) {
+	var r rollup
+	b, err := json.Marshal(record)
+	if err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(b, &r)
+}
+
+// pending - an instance's counts for a Key since it started, and whether they've changed since they were last written.
+type pending struct {
+	counts  Counts
+	written bool
+	dirty   bool
+}
+
+/*
+Tracker - counts requests in memory, and writes the counts to its store as hourly rollups. The store should be the
+backend itself, so that writing rollups doesn't pass through anything that counts or caches writes. A nil Tracker
+counts nothing.
+*/
+type Tracker struct {
+	store      datastore.Datastore
+	instance   string
+	retention  time.Duration
+	maxClients int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	counts  map[Key]*pending
+	clients map[time.Time]map[string]bool
+	// flushMu - one flush at a time, so a rollup's writes happen in order.
+	flushMu sync.Mutex
+	pruned  time.Time
+}
+
+// NewTracker - a Tracker writing to store, keeping rollups for retention and at most maxClients clients an hour.
+func NewTracker(store datastore.Datastore, retention time.Duration, maxClients int) (*Tracker, error) {
+	instance, err := datastore.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{
+		store:      store,
+		instance:   instance,
+		retention:  retention,
+		maxClients: maxClients,
+		now:        time.Now,
+		counts:     map[Key]*pending{},
+		clients:    map[time.Time]map[string]bool{},
+	}, nil
+}
+
+// Count - counts a request in the current hour.
+func (t *Tracker) Count(req Request) {
+	if t == nil {
+		return
+	}
+	hour := t.now().UTC().Truncate(time.Hour)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clients, ok := t.clients[hour]
+	if !ok {
+		clients = map[string]bool{}
+		t.clients[hour] = clients
+	}
+	if !clients[req.Client] {
+		if len(clients) >= t.maxClients {
+			req.Client = OtherClients
+		}
+		clients[req.Client] = true
+	}
+
+	key := Key{Hour: hour, Client: req.Client, Method: req.Method, Route: req.Route}
+	p, ok := t.counts[key]
+	if !ok {
+		p = &pending{}
+		t.counts[key] = p
+	}
+	p.dirty = true
+	p.counts.add(Counts{Requests: 1, BytesIn: req.BytesIn, BytesOut: req.BytesOut})
+	switch {
+	case req.Status >= 500:
+		p.counts.ServerErrors++
+	case req.Status >= 400:
+		p.counts.ClientErrors++
+	}
+}
+
+/*
+Flush - writes the rollups that have changed since they were last written, and forgets those of past hours once
+they're written. Once an hour it also deletes rollups older than the retention. A rollup that can't be written is
+tried again next time.
+*/
+func (t *Tracker) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+	ctx = datastore.WithTenant(ctx, "")
+
+	hour := t.now().UTC().Truncate(time.Hour)
+	t.mu.Lock()
+	var changed []rollup
+	for key, p := range t.counts {
+		if p.dirty {
+			changed = append(changed, rollup{Key: key, Instance: t.instance, Counts: p.counts})
+		}
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, r := range changed {
+		if err := t.write(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	t.mu.Lock()
+	for key, p := range t.counts {
+		if key.Hour.Before(hour) && p.written && !p.dirty {
+			delete(t.counts, key)
+		}
+	}
+	for h := range t.clients {
+		if h.Before(hour) {
+			delete(t.clients, h)
+		}
+	}
+	t.mu.Unlock()
+
+	if hour.After(t.pruned) {
+		if err := t.prune(ctx, hour.Add(-t.retention)); err != nil {
+			errs = append(errs, err)
+		} else {
+			t.pruned = hour
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// write - stores a rollup, adding its record the first time and replacing it after that.
+func (t *Tracker) write(ctx context.Context, r rollup) error {
+	record, err := r.record()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	p := t.counts[r.Key]
+	written := p.written
+	t.mu.Unlock()
+
+	if written {
+		err = t.store.UpdateRecord(ctx, Resource.Name, record)
+	} else if err = t.store.AddRecord(ctx, Resource.Name, record); errors.Is(err, datastore.ErrConflict) {
+		err = t.store.UpdateRecord(ctx, Resource.Name, record)
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing usage for %v %v %v: %w", r.Client, r.Method, r.Route, err)
+	}
+
+	t.mu.Lock()
+	p.written = true
+	// Requests counted while it was written are written next time.
+	p.dirty = p.counts != r.Counts
+	t.mu.Unlock()
+	return nil
+}
+
+// prune - deletes the rollups of hours before cutoff, whichever instance wrote them.
+func (t *Tracker) prune(ctx context.Context, cutoff time.Time) error {
+	records, err := t.store.GetRecords(ctx, Resource.Name)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		r, err := rollupFromRecord(record)
+		if err != nil || !r.Hour.Before(cutoff) {
+			continue
+		}
+		if err := t.store.DeleteRecord(ctx, Resource.Name, record.Id()); err != nil && !errors.Is(err, datastore.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start - flushes every interval until ctx is done, and once more then, so counts aren't lost on shutdown.
+func (t *Tracker) Start(ctx context.Context, interval time.Duration) {
+	if t == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := t.Flush(context.WithoutCancel(ctx)); err != nil {
+					log.Printf("Error flushing usage: %v", err)
+				}
+				return
+			case <-ticker.C:
+				if err := t.Flush(ctx); err != nil {
+					log.Printf("Error flushing usage: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Usage - a client's use of one endpoint over a report's period.
+type Usage struct {
+	Client string `json:"client" xml:"client"`
+	Method string `json:"method" xml:"method"`
+	Route  string `json:"route" xml:"route"`
+	Counts
+	// ErrorRate - the share of the requests that failed, client and server errors alike, from 0 to 1.
+	ErrorRate float64 `json:"error_rate" xml:"error_rate"`
+}
+
+/*
+Report - every instance's usage in the hours from from up to (not including) to, by client and endpoint, most
+requested first. With client, only that client's. What instances haven't flushed yet isn't included.
+*/
+func (t *Tracker) Report(ctx context.Context, from, to time.Time, client string) ([]Usage, error) {
+	records, err := t.store.GetRecords(datastore.WithTenant(ctx, ""), Resource.Name)
+	if err != nil {
+		return nil, err
+	}
+	from, to = from.UTC().Truncate(time.Hour), to.UTC()
+	totals := map[Key]*Counts{}
+	for _, record := range records {
+		r, err := rollupFromRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid usage record <%v>: %v", record.Id(), err)
+		}
+		if r.Hour.Before(from) || !r.Hour.Before(to) || (client != "" && r.Client != client) {
+			continue
+		}
+		key := Key{Client: r.Client, Method: r.Method, Route: r.Route}
+		if totals[key] == nil {
+			totals[key] = &Counts{}
+		}
+		totals[key].add(r.Counts)
+	}
+
+	report := make([]Usage, 0, len(totals))
+	for key, counts := range totals {
+		u := Usage{Client: key.Client, Method: key.Method, Route: key.Route, Counts: *counts}
+		if counts.Requests > 0 {
+			u.ErrorRate = float64(counts.ClientErrors+counts.ServerErrors) / float64(counts.Requests)
+		}
+		report = append(report, u)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		if a.Client != b.Client {
+			return a.Client < b.Client
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Method < b.Method
+	})
+	return report, nil
+}
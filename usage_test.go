@@ -0,0 +1,112 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+	"github.com/bamajap/go-basic-api-app/usage"
+)
+
+func TestUsage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Usage.Enabled = true
+	cfg.Auth.AdminToken = "an-admin-token-for-tests"
+	h := testServer(t, cfg, fixtureStore(t))
+	admin := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		r := newRequest("GET", path, "")
+		r.Header.Set("Authorization", "Bearer "+cfg.Auth.AdminToken)
+		return record(h, r)
+	}
+
+	body := `{"Name": "Kiwi", "Price": 0.5}`
+	do(h, "GET", "/v1/products", "")
+	do(h, "GET", "/v1/products", "")
+	do(h, "GET", "/v1/product/99", "")
+	do(h, "POST", "/v1/product", body)
+
+	w := admin(h, "/admin/usage")
+	var report struct {
+		Usage []usage.Usage `json:"usage"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET usage: got status %v; body %s", w.Code, w.Body)
+	}
+	got := map[string]usage.Usage{}
+	for _, u := range report.Usage {
+		if u.Client != "ip:192.0.2.1" {
+			t.Errorf("Got client %q; want the request's IP address", u.Client)
+		}
+		got[u.Method+" "+u.Route] = u
+	}
+	if u := got["GET /v1/products"]; u.Requests != 2 || u.BytesOut == 0 || u.ErrorRate != 0 {
+		t.Errorf("GET /v1/products: got %+v", u)
+	}
+	if u := got["GET /v1/product/{id}"]; u.Requests != 1 || u.ClientErrors != 1 || u.ErrorRate != 1 {
+		t.Errorf("GET /v1/product/{id}: got %+v", u)
+	}
+	if u := got["POST /v1/product"]; u.Requests != 1 || u.BytesIn != int64(len(body)) {
+		t.Errorf("POST /v1/product: got %+v", u)
+	}
+	if report.Usage[0].Route != "/v1/products" {
+		t.Errorf("Got %v first; want the most requested", report.Usage[0].Route)
+	}
+
+	w = admin(h, "/admin/usage?client=nobody")
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || len(report.Usage) != 0 {
+		t.Errorf("GET another client's usage: got status %v; body %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/admin/usage?from=yesterday", 400, "invalid_usage_time"},
+		{"/admin/usage?from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z", 400, "invalid_usage_period"},
+	} {
+		if w := admin(h, tc.path); w.Code != tc.status || errorCode(w) != tc.code {
+			t.Errorf("GET %v: got status %v, code %q; want %v, %q", tc.path, w.Code, errorCode(w), tc.status, tc.code)
+		}
+	}
+
+	cfg.Usage.Enabled = false
+	h = testServer(t, cfg, fixtureStore(t))
+	if w := admin(h, "/admin/usage"); w.Code != http.StatusConflict || errorCode(w) != "usage_not_enabled" {
+		t.Errorf("GET usage when it isn't enabled: got status %v, code %q", w.Code, errorCode(w))
+	}
+}
+
+func TestSignedUsage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Usage.Enabled = true
+	cfg.Auth.HMAC.Clients = map[string]string{"billing": testSecret}
+	h := testServer(t, cfg, fixtureStore(t))
+
+	if w := record(h, signed("billing", testSecret, time.Now(), "POST", "/v1/product", `{"Name": "Kiwi", "Price": 0.5}`)); w.Code != http.StatusCreated {
+		t.Fatalf("Signed POST: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, signed("billing", testSecret, time.Now(), "GET", "/v1/product/1", "")); w.Code != http.StatusOK {
+		t.Fatalf("Signed GET: got status %v; body %s", w.Code, w.Body)
+	}
+	w := record(h, signed("billing", testSecret, time.Now(), "GET", "/admin/usage?client=billing", ""))
+	var report struct {
+		Usage []usage.Usage `json:"usage"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	got := map[string]int64{}
+	for _, u := range report.Usage {
+		got[u.Method+" "+u.Route] = u.Requests
+	}
+	if w.Code != http.StatusOK || len(got) != 2 || got["POST /v1/product"] != 1 || got["GET /v1/product/{id}"] != 1 {
+		t.Errorf("GET the signing client's usage: got status %v; body %s", w.Code, w.Body)
+	}
+}
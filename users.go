@@ -0,0 +1,342 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+	"github.com/bamajap/go-basic-api-app/i18n"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userPath - route template for a single user, under /admin.
+const userPath = "/users/{name}"
+
+// userNameRegexp - user names can't contain a colon, which ends the name in Basic credentials and htpasswd files.
+var userNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// minPasswordLength - the shortest password a user may be given.
+const minPasswordLength = 12
+
+/*
+userView - a User as the admin endpoints show it. Password hashes and secrets are never shown; a new password or
+secret is, once, in the response that generated it.
+*/
+type userView struct {
+	XMLName   xml.Name  `json:"-" xml:"user"`
+	Name      string    `json:"name" xml:"name"`
+	Kind      string    `json:"kind" xml:"kind"`
+	Roles     []string  `json:"roles" xml:"role"`
+	Tenants   []string  `json:"tenants,omitempty" xml:"tenant,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+	Password  string    `json:"password,omitempty" xml:"password,omitempty"`
+	Secret    string    `json:"secret,omitempty" xml:"secret,omitempty"`
+}
+
+// viewUser - the view of a user.
+func viewUser(u datastore.User) userView {
+	return userView{Name: u.Name, Kind: u.Kind, Roles: u.Roles, Tenants: u.Tenants, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+// userList - every user, by name.
+type userList struct {
+	XMLName xml.Name   `json:"-" xml:"users"`
+	Users   []userView `json:"users" xml:"user"`
+}
+
+// userRequest - the body of a request to create a user, or to change one's credentials, roles or tenants.
+type userRequest struct {
+	Name     string   `json:"name" xml:"name"`
+	Kind     string   `json:"kind" xml:"kind"`
+	Password string   `json:"password" xml:"password"`
+	Roles    []string `json:"roles" xml:"role"`
+	Tenants  []string `json:"tenants" xml:"tenant"`
+}
+
+// validRoles - the roles, de-duplicated and sorted; on failure, it has already responded.
+func validRoles(w http.ResponseWriter, r *http.Request, roles []string) ([]string, bool) {
+	set := map[string]bool{}
+	for _, role := range roles {
+		if _, ok := roleRank[role]; !ok {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_role", "Invalid role %q; use %v, %v or %v", role, roleReader, roleWriter, roleAdmin))
+			return nil, false
+		}
+		set[role] = true
+	}
+	valid := []string{}
+	for role := range set {
+		valid = append(valid, role)
+	}
+	sort.Strings(valid)
+	return valid, true
+}
+
+/*
+validTenants - the tenants a user may use, de-duplicated and sorted; none means every tenant. On failure, it has
+already responded.
+*/
+func validTenants(w http.ResponseWriter, r *http.Request, tenants []string) ([]string, bool) {
+	set := map[string]bool{}
+	for _, tenant := range tenants {
+		if !datastore.ValidTenant(tenant) {
+			writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_tenant", "Invalid tenant name %q; use up to 32 lowercase letters, digits and dashes", tenant))
+			return nil, false
+		}
+		set[tenant] = true
+	}
+	var valid []string
+	for tenant := range set {
+		valid = append(valid, tenant)
+	}
+	sort.Strings(valid)
+	return valid, true
+}
+
+// newSecret - a random secret, for a client to sign requests with or a generated password.
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+setCredentials - gives a user new credentials: the password asked for, if it's a user and one was, or else a
+generated password or secret, which is shown in the view. On failure, it has already responded.
+*/
+func setCredentials(w http.ResponseWriter, r *http.Request, user *datastore.User, password string, view *userView) bool {
+	if user.Kind == datastore.UserKindClient {
+		secret, err := newSecret()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return false
+		}
+		user.Secret, view.Secret = secret, secret
+		return true
+	}
+
+	switch {
+	case password == "":
+		generated, err := newSecret()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err)
+			return false
+		}
+		password, view.Password = generated, generated
+	case len(password) < minPasswordLength:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("password_too_short", "Passwords must be at least %v characters", minPasswordLength))
+		return false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return false
+	}
+	user.PasswordHash = string(hash)
+	return true
+}
+
+// pathUser - the user named in the path; on failure, it has already responded.
+func (a *API) pathUser(w http.ResponseWriter, r *http.Request) (datastore.User, bool) {
+	user := datastore.User{Name: mux.Vars(r)["name"]}
+	if err := a.Store.GetUser(r.Context(), &user); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return datastore.User{}, false
+	}
+	return user, true
+}
+
+/*
+GetUsers - list the users and clients kept in the store, with their roles. Those in the config file aren't listed.
+*/
+func (a *API) GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.Store.GetUsers(r.Context())
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	list := userList{Users: []userView{}}
+	for _, u := range users {
+		list.Users = append(list.Users, viewUser(u))
+	}
+	respond(w, r, http.StatusOK, list)
+}
+
+/*
+GetUser - display a user, with their roles.
+*/
+func (a *API) GetUser(w http.ResponseWriter, r *http.Request) {
+	if user, ok := a.pathUser(w, r); ok {
+		respond(w, r, http.StatusOK, viewUser(user))
+	}
+}
+
+/*
+CreateUser - add a user, who signs in with a password, or a client, which signs its requests with a secret. A
+client's secret is generated, as is a user's password if none is given; either is only shown in the response.
+*/
+func (a *API) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var body userRequest
+	if err := decodeBody(r, &body); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	switch {
+	case !userNameRegexp.MatchString(body.Name):
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_user_name", "Invalid user name %q; use up to 64 letters, digits, dots, dashes, underscores and @", body.Name))
+		return
+	case body.Kind == "":
+		body.Kind = datastore.UserKindUser
+	case body.Kind != datastore.UserKindUser && body.Kind != datastore.UserKindClient:
+		writeError(w, r, http.StatusBadRequest, i18n.Errorf("invalid_user_kind", "Invalid kind %q; use %v or %v", body.Kind, datastore.UserKindUser, datastore.UserKindClient))
+		return
+	case body.Kind == datastore.UserKindClient && a.Signatures == nil:
+		// Signatures are only checked once an HMAC client is configured, so a client added now could never sign.
+		writeError(w, r, http.StatusConflict, i18n.Errorf("signing_not_enabled", "Request signing isn't enabled; configure an hmac client first"))
+		return
+	}
+	if a.configuredUser(body.Name) {
+		writeError(w, r, http.StatusConflict, i18n.Errorf("user_configured", "%v is in the config file, so can't be managed here", body.Name))
+		return
+	}
+	roles, ok := validRoles(w, r, body.Roles)
+	if !ok {
+		return
+	}
+	tenants, ok := validTenants(w, r, body.Tenants)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	user := datastore.User{Name: body.Name, Kind: body.Kind, Roles: roles, Tenants: tenants, CreatedAt: now, UpdatedAt: now}
+	view := viewUser(user)
+	if !setCredentials(w, r, &user, body.Password, &view) {
+		return
+	}
+	if err := a.Store.AddUser(r.Context(), user); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", "/admin/users/"+user.Name)
+	respond(w, r, http.StatusCreated, view)
+}
+
+/*
+RotateUserCredentials - replace a user's password, or a client's secret, straight away: the old one stops working.
+A user may be given the password in the body; otherwise, one is generated and shown in the response.
+*/
+func (a *API) RotateUserCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.pathUser(w, r)
+	if !ok {
+		return
+	}
+	var body userRequest
+	if r.ContentLength != 0 {
+		if err := decodeBody(r, &body); err != nil {
+			bodyError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	view := viewUser(user)
+	if !setCredentials(w, r, &user, body.Password, &view) {
+		return
+	}
+	if err := a.Store.UpdateUser(r.Context(), user); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, view)
+}
+
+/*
+SetUserRoles - replace a user's roles.
+*/
+func (a *API) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.pathUser(w, r)
+	if !ok {
+		return
+	}
+	var body userRequest
+	if err := decodeBody(r, &body); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+	if user.Roles, ok = validRoles(w, r, body.Roles); !ok {
+		return
+	}
+
+	user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := a.Store.UpdateUser(r.Context(), user); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, viewUser(user))
+}
+
+/*
+SetUserTenants - replace the tenants a user may use while multi-tenancy is enabled; none means every tenant.
+*/
+func (a *API) SetUserTenants(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.pathUser(w, r)
+	if !ok {
+		return
+	}
+	var body userRequest
+	if err := decodeBody(r, &body); err != nil {
+		bodyError(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+	if user.Tenants, ok = validTenants(w, r, body.Tenants); !ok {
+		return
+	}
+
+	user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := a.Store.UpdateUser(r.Context(), user); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	respond(w, r, http.StatusOK, viewUser(user))
+}
+
+/*
+DeleteUser - remove a user; their credentials stop working straight away.
+*/
+func (a *API) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := a.Store.DeleteUser(r.Context(), mux.Vars(r)["name"]); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
+
+// configuredUser - whether name is a user or client in the config file, which always take precedence over the store.
+func (a *API) configuredUser(name string) bool {
+	if basic, ok := a.Auth.(*basicAuth); ok && basic.users[name] != nil {
+		return true
+	}
+	return a.Signatures != nil && a.Signatures.secrets[name] != nil
+}
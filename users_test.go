@@ -0,0 +1,192 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+// as - a request to the API with the given Basic credentials.
+func as(user, password, method, path, body string) *http.Request {
+	r := newRequest(method, path, body)
+	r.SetBasicAuth(user, password)
+	return r
+}
+
+// createdUser - the user (with their new credentials) in a response; it fails the test unless the status is want.
+func createdUser(t *testing.T, w *httptest.ResponseRecorder, want int) userView {
+	t.Helper()
+	var u userView
+	if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil || w.Code != want {
+		t.Fatalf("Got status %v (want %v), error %v; body %s", w.Code, want, err, w.Body)
+	}
+	return u
+}
+
+func TestManagingUsers(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Scheme = config.AuthBasic
+	cfg.Auth.Basic.Users = map[string]string{"root": hashPassword(t, "root-password")}
+	h := testServer(t, cfg, fixtureStore(t))
+	admin := func(method, path, body string) *http.Request { return as("root", "root-password", method, path, body) }
+
+	alice := createdUser(t, record(h, admin("POST", "/admin/users", `{"name": "alice", "roles": ["reader"]}`)), http.StatusCreated)
+	if alice.Password == "" || len(alice.Roles) != 1 {
+		t.Fatalf("Created %+v; want a generated password and the reader role", alice)
+	}
+	if w := record(h, as("alice", alice.Password, "GET", "/v1/product/1", "")); w.Code != http.StatusOK {
+		t.Fatalf("Reader reading: got status %v; body %s", w.Code, w.Body)
+	}
+	for _, r := range []*http.Request{
+		as("alice", alice.Password, "DELETE", "/v1/product/1", ""),
+		as("alice", alice.Password, "GET", "/admin/users", ""),
+	} {
+		if w := record(h, r); w.Code != http.StatusForbidden || errorCode(w) != "forbidden" {
+			t.Fatalf("Reader %v %v: got status %v; body %s", r.Method, r.URL, w.Code, w.Body)
+		}
+	}
+
+	// Roles and passwords take effect straight away.
+	if w := record(h, admin("PUT", "/admin/users/alice/roles", `{"roles": ["writer"]}`)); w.Code != http.StatusOK {
+		t.Fatalf("Setting roles: got status %v; body %s", w.Code, w.Body)
+	}
+	rotated := createdUser(t, record(h, admin("POST", "/admin/users/alice/rotate", `{"password": "a-much-longer-password"}`)), http.StatusOK)
+	if rotated.Password != "" {
+		t.Fatalf("Rotating to a chosen password showed %q", rotated.Password)
+	}
+	if w := record(h, as("alice", alice.Password, "GET", "/v1/product/1", "")); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Old password: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, as("alice", "a-much-longer-password", "DELETE", "/v1/product/1", "")); w.Code != http.StatusNoContent {
+		t.Fatalf("Writer deleting: got status %v; body %s", w.Code, w.Body)
+	}
+
+	list := record(h, admin("GET", "/admin/users", ""))
+	var users userList
+	json.Unmarshal(list.Body.Bytes(), &users)
+	if len(users.Users) != 1 || users.Users[0].Name != "alice" || users.Users[0].Password != "" {
+		t.Fatalf("Listed %s", list.Body)
+	}
+
+	cases := []struct {
+		name, method, path, body, code string
+		status                         int
+	}{
+		{"existing name", "POST", "/admin/users", `{"name": "alice"}`, "user_exists", http.StatusConflict},
+		{"configured name", "POST", "/admin/users", `{"name": "root"}`, "user_configured", http.StatusConflict},
+		{"bad name", "POST", "/admin/users", `{"name": "a:b"}`, "invalid_user_name", http.StatusBadRequest},
+		{"bad kind", "POST", "/admin/users", `{"name": "bob", "kind": "robot"}`, "invalid_user_kind", http.StatusBadRequest},
+		{"client without signing", "POST", "/admin/users", `{"name": "billing", "kind": "client"}`, "signing_not_enabled", http.StatusConflict},
+		{"bad role", "POST", "/admin/users", `{"name": "bob", "roles": ["owner"]}`, "invalid_role", http.StatusBadRequest},
+		{"short password", "POST", "/admin/users", `{"name": "bob", "password": "short"}`, "password_too_short", http.StatusBadRequest},
+		{"unknown user", "GET", "/admin/users/bob", "", "user_not_found", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if w := record(h, admin(c.method, c.path, c.body)); w.Code != c.status || errorCode(w) != c.code {
+			t.Errorf("%v: got status %v, code %q; want %v, %q", c.name, w.Code, errorCode(w), c.status, c.code)
+		}
+	}
+
+	if w := record(h, admin("DELETE", "/admin/users/alice", "")); w.Code != http.StatusNoContent {
+		t.Fatalf("Deleting: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, as("alice", "a-much-longer-password", "GET", "/v1/product/1", "")); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Deleted user: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+func TestStoredClientsSign(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.HMAC.Clients = map[string]string{"deployer": testSecret}
+	h := testServer(t, cfg, fixtureStore(t))
+	now := time.Now()
+
+	create := `{"name": "billing", "kind": "client", "roles": ["reader"]}`
+	client := createdUser(t, record(h, signed("deployer", testSecret, now, "POST", "/admin/users", create)), http.StatusCreated)
+	if client.Secret == "" {
+		t.Fatalf("Created %+v; want a generated secret", client)
+	}
+	list := record(h, signed("deployer", testSecret, now, "GET", "/admin/users", ""))
+	var users userList
+	json.Unmarshal(list.Body.Bytes(), &users)
+	if len(users.Users) != 1 || users.Users[0].Name != "billing" || users.Users[0].Secret != "" {
+		t.Fatalf("Listed %s", list.Body)
+	}
+	body := `{"Name": "Kiwi", "Price": 0.5}`
+	if w := record(h, signed("billing", client.Secret, now, "POST", "/v1/product", body)); w.Code != http.StatusForbidden {
+		t.Fatalf("Signed by a reader: got status %v; body %s", w.Code, w.Body)
+	}
+
+	roles := `{"roles": ["writer"]}`
+	if w := record(h, signed("deployer", testSecret, now, "PUT", "/admin/users/billing/roles", roles)); w.Code != http.StatusOK {
+		t.Fatalf("Setting roles: got status %v; body %s", w.Code, w.Body)
+	}
+	rotated := createdUser(t, record(h, signed("deployer", testSecret, now, "POST", "/admin/users/billing/rotate", "")), http.StatusOK)
+	if rotated.Secret == "" || rotated.Secret == client.Secret {
+		t.Fatalf("Rotated to %q", rotated.Secret)
+	}
+	later := now.Add(time.Second)
+	if w := record(h, signed("billing", client.Secret, later, "POST", "/v1/product", body)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Signed with the old secret: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, signed("billing", rotated.Secret, later, "POST", "/v1/product", body)); w.Code != http.StatusCreated {
+		t.Fatalf("Signed with the new secret: got status %v; body %s", w.Code, w.Body)
+	}
+}
+
+// TestUsersBoundToTenants - with multi-tenancy, users and clients may only use the tenants they're given, if any.
+func TestUsersBoundToTenants(t *testing.T) {
+	cfg := config.Default()
+	cfg.Tenancy = config.Tenancy{Enabled: true, Tenants: []string{"acme", "globex"}}
+	cfg.Auth.Scheme = config.AuthBasic
+	cfg.Auth.Basic.Users = map[string]string{"root": hashPassword(t, "root-password"), "ci": hashPassword(t, "ci-password")}
+	cfg.Auth.Basic.Tenants = map[string][]string{"ci": {"globex"}}
+	h := testServer(t, cfg, fixtureStore(t))
+	in := func(tenant string, r *http.Request) *http.Request {
+		r.Header.Set("X-Tenant-ID", tenant)
+		return r
+	}
+
+	alice := createdUser(t, record(h, in("acme", as("root", "root-password", "POST", "/admin/users", `{"name": "alice", "roles": ["reader"], "tenants": ["acme"]}`))), http.StatusCreated)
+	if len(alice.Tenants) != 1 || alice.Tenants[0] != "acme" {
+		t.Fatalf("Created %+v; want alice bound to acme", alice)
+	}
+	cases := []struct {
+		name, user, password, tenant string
+		status                       int
+	}{
+		{"stored user's tenant", "alice", alice.Password, "acme", http.StatusOK},
+		{"stored user's other tenant", "alice", alice.Password, "globex", http.StatusForbidden},
+		{"configured user's tenant", "ci", "ci-password", "globex", http.StatusOK},
+		{"configured user's other tenant", "ci", "ci-password", "acme", http.StatusForbidden},
+		{"unbound user", "root", "root-password", "globex", http.StatusOK},
+	}
+	for _, c := range cases {
+		w := record(h, in(c.tenant, as(c.user, c.password, "GET", "/v1/products", "")))
+		if w.Code != c.status || (c.status == http.StatusForbidden && errorCode(w) != "tenant_forbidden") {
+			t.Errorf("%v: got status %v; body %s", c.name, w.Code, w.Body)
+		}
+	}
+
+	if w := record(h, in("acme", as("root", "root-password", "PUT", "/admin/users/alice/tenants", `{"tenants": ["globex"]}`))); w.Code != http.StatusOK {
+		t.Fatalf("Setting tenants: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, in("globex", as("alice", alice.Password, "GET", "/v1/products", ""))); w.Code != http.StatusOK {
+		t.Fatalf("New tenant: got status %v; body %s", w.Code, w.Body)
+	}
+	if w := record(h, in("acme", as("root", "root-password", "PUT", "/admin/users/alice/tenants", `{"tenants": ["Acme!"]}`))); w.Code != http.StatusBadRequest || errorCode(w) != "invalid_tenant" {
+		t.Fatalf("Invalid tenant: got status %v; body %s", w.Code, w.Body)
+	}
+
+	cfg.Auth.Basic.Tenants = map[string][]string{"ci": {"initech"}}
+	if err := validateTenancy(cfg.Tenancy, cfg.Auth); err == nil {
+		t.Fatal("A user bound to an unconfigured tenant was accepted")
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bamajap/go-basic-api-app/datastore"
+
+	"github.com/gorilla/mux"
+)
+
+// includeVariants - the ?include= value that embeds each Product's variants in the response.
+const includeVariants = "variants"
+
+// variantPath - route template for a single variant of a Product. Variant IDs are always UUIDs.
+func variantPath() string {
+	return productPath() + "/variants/{variant:" + datastore.UUIDIDs.Pattern() + "}"
+}
+
+// variantURL - the canonical location of a variant.
+func variantURL(v datastore.Variant) string {
+	return productURL(v.ProductId) + "/variants/" + v.Id
+}
+
+/*
+variantList - a Product's variants. It encodes as a bare array in JSON; XML needs a root element.
+*/
+type variantList []datastore.Variant
+
+func (l variantList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "variants"
+	return e.EncodeElement(struct {
+		Variants []datastore.Variant `xml:"variant"`
+	}{l}, start)
+}
+
+// pathVariant - the variant named in the path, as stored; on failure, it has already responded.
+func (a *API) pathVariant(w http.ResponseWriter, r *http.Request) (datastore.Variant, bool) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return datastore.Variant{}, false
+	}
+	variant := datastore.Variant{ProductId: productID, Id: mux.Vars(r)["variant"]}
+	if err := a.Store.GetVariant(r.Context(), &variant); err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return datastore.Variant{}, false
+	}
+	return variant, true
+}
+
+// readVariant - decodes and validates the size, color, price override and stock of a variant in the request body.
+func readVariant(r *http.Request) (datastore.Variant, error) {
+	var variant datastore.Variant
+	if err := decodeBody(r, &variant); err != nil {
+		return variant, err
+	}
+	defer r.Body.Close()
+
+	variant.Size = strings.TrimSpace(variant.Size)
+	variant.Color = strings.TrimSpace(variant.Color)
+	switch {
+	case variant.Size == "" && variant.Color == "":
+		return variant, errors.New("A variant needs a size or a color")
+	case variant.Price != nil && *variant.Price < 0:
+		return variant, errors.New("Price must be a non-negative number")
+	case variant.Stock < 0:
+		return variant, errors.New("Stock can't be negative")
+	}
+	return variant, nil
+}
+
+// variantWriteError - responds to a failed variant write.
+func variantWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, storeStatus(err), err)
+}
+
+// variantsInCurrency - inCurrency for the price overrides of variants.
+func variantsInCurrency(w http.ResponseWriter, r *http.Request, variants []datastore.Variant) (int, error) {
+	var amounts []*datastore.Money
+	for i := range variants {
+		if variants[i].Price != nil {
+			price := *variants[i].Price
+			variants[i].Price = &price
+			amounts = append(amounts, variants[i].Price)
+		}
+	}
+	return inCurrency(w, r, amounts...)
+}
+
+/*
+includeRelated - applies ?include= to a strict-mode Product response, embedding the related resources it names.
+Only variants can be included so far. Each Product's variants are a separate read, so including them in a long
+listing is best combined with a page size. Legacy responses have no place for related resources and are
+returned unchanged.
+*/
+func (a *API) includeRelated(w http.ResponseWriter, r *http.Request, v interface{}) (interface{}, int, error) {
+	include := r.URL.Query().Get("include")
+	if include == "" {
+		return v, http.StatusOK, nil
+	}
+	for _, name := range strings.Split(include, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != includeVariants {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown include %q; use %q", name, includeVariants)
+		}
+	}
+
+	var products []productResource
+	switch v := v.(type) {
+	case productResource:
+		products = []productResource{v}
+	case resourceList:
+		products = append(resourceList{}, v...)
+	case cursorPage:
+		products = append([]productResource{}, v.Products...)
+	default:
+		return v, http.StatusOK, nil
+	}
+
+	for i := range products {
+		variants, err := a.Store.GetVariants(r.Context(), products[i].Id)
+		if err != nil {
+			return nil, storeStatus(err), err
+		}
+		if status, err := variantsInCurrency(w, r, variants); err != nil {
+			return nil, status, err
+		}
+		list := variantList(variants)
+		products[i].Variants = &list
+	}
+
+	switch v := v.(type) {
+	case productResource:
+		return products[0], http.StatusOK, nil
+	case cursorPage:
+		v.Products = products
+		return v, http.StatusOK, nil
+	}
+	return resourceList(products), http.StatusOK, nil
+}
+
+/*
+GetVariants - a Product's variants.
+*/
+func (a *API) GetVariants(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	variants, err := a.Store.GetVariants(r.Context(), productID)
+	if err != nil {
+		writeError(w, r, storeStatus(err), err)
+		return
+	}
+	if status, err := variantsInCurrency(w, r, variants); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	respond(w, r, http.StatusOK, variantList(variants))
+}
+
+/*
+GetVariant - a single variant.
+*/
+func (a *API) GetVariant(w http.ResponseWriter, r *http.Request) {
+	variant, ok := a.pathVariant(w, r)
+	if !ok {
+		return
+	}
+	variants := []datastore.Variant{variant}
+	if status, err := variantsInCurrency(w, r, variants); err != nil {
+		writeError(w, r, status, err)
+		return
+	}
+	respond(w, r, http.StatusOK, variants[0])
+}
+
+/*
+CreateVariant - add a variant, with a size and/or color, its stock and an optional price override, to a Product.
+*/
+func (a *API) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	productID, ok := a.reviewedProduct(w, r)
+	if !ok {
+		return
+	}
+	variant, err := readVariant(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+
+	if variant.Id, err = datastore.NewUUID(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	variant.ProductId = productID
+
+	if err := a.Store.AddVariant(r.Context(), variant); err != nil {
+		variantWriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", variantURL(variant))
+	respond(w, r, http.StatusCreated, variant)
+}
+
+/*
+UpdateVariant - replace a variant's size, color, price override and stock.
+*/
+func (a *API) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.pathVariant(w, r)
+	if !ok {
+		return
+	}
+	variant, err := readVariant(r)
+	if err != nil {
+		bodyError(w, r, err)
+		return
+	}
+
+	variant.Id, variant.ProductId = old.Id, old.ProductId
+	if err := a.Store.UpdateVariant(r.Context(), variant); err != nil {
+		variantWriteError(w, r, err)
+		return
+	}
+	respond(w, r, http.StatusOK, variant)
+}
+
+/*
+DeleteVariant - remove a variant.
+*/
+func (a *API) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	variant, ok := a.pathVariant(w, r)
+	if !ok {
+		return
+	}
+	if err := a.Store.DeleteVariant(r.Context(), variant); err != nil {
+		variantWriteError(w, r, err)
+		return
+	}
+
+	if strictMode {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, result{Result: "success"})
+}
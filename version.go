@@ -0,0 +1,88 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+/*
+The build's version, commit and time, set when it's built, e.g.
+
+	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+
+A commit or time left unset is taken from what Go recorded about the checkout it built (see currentBuild).
+*/
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+/*
+buildInfo - what's deployed.
+*/
+type buildInfo struct {
+	XMLName   xml.Name `json:"-" xml:"version"`
+	Version   string   `json:"version" xml:"version"`
+	Commit    string   `json:"commit,omitempty" xml:"commit,omitempty"`
+	BuildTime string   `json:"build_time,omitempty" xml:"build_time,omitempty"`
+	GoVersion string   `json:"go_version" xml:"go_version"`
+}
+
+// String - the build on one line, for --version.
+func (b buildInfo) String() string {
+	s := "products " + b.Version
+	if b.Commit != "" {
+		s += " commit " + b.Commit
+	}
+	if b.BuildTime != "" {
+		s += " built " + b.BuildTime
+	}
+	return s + " " + b.GoVersion
+}
+
+/*
+currentBuild - the running binary's build. Without ldflags, the commit and time are the VCS revision and commit
+time Go recorded, if it built from a checkout; a commit with uncommitted changes is marked "-dirty".
+*/
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if b.Commit == "" {
+		b.Commit = settings["vcs.revision"]
+		if b.Commit != "" && settings["vcs.modified"] == "true" {
+			b.Commit += "-dirty"
+		}
+	}
+	if b.BuildTime == "" {
+		b.BuildTime = settings["vcs.time"]
+	}
+	return b
+}
+
+/*
+Version - the build that's serving the request. Like /healthz, it needs no credentials, so operators and deploy
+scripts can check what's deployed.
+*/
+func Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, http.StatusOK, currentBuild())
+}
+
+// printVersion - prints the build, for --version.
+func printVersion() {
+	fmt.Println(currentBuild())
+}
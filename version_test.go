@@ -0,0 +1,27 @@
+/*
+Author: Jason Payne
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/bamajap/go-basic-api-app/config"
+)
+
+func TestVersion(t *testing.T) {
+	saved := []string{version, commit, buildTime}
+	t.Cleanup(func() { version, commit, buildTime = saved[0], saved[1], saved[2] })
+	version, commit, buildTime = "1.4.0", "abc123", "2026-10-17T09:00:00Z"
+
+	w := do(testServer(t, config.Default(), fixtureStore(t)), "GET", "/version", "")
+	var got buildInfo
+	json.Unmarshal(w.Body.Bytes(), &got)
+	want := buildInfo{Version: "1.4.0", Commit: "abc123", BuildTime: "2026-10-17T09:00:00Z", GoVersion: runtime.Version()}
+	if w.Code != http.StatusOK || got != want {
+		t.Fatalf("Got status %v, %+v; want %+v", w.Code, got, want)
+	}
+}